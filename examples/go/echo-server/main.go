@@ -12,32 +12,16 @@ import (
 )
 
 func main() {
-	// Load configuration from environment variables
-	paymentAddress := os.Getenv("X402_PAYMENT_ADDRESS")
-	tokenMint := os.Getenv("X402_TOKEN_MINT")
-	network := os.Getenv("X402_NETWORK")
-
-	if paymentAddress == "" {
-		paymentAddress = "YOUR_SOLANA_WALLET_ADDRESS"
-		log.Println("⚠️  X402_PAYMENT_ADDRESS not set, using placeholder")
-	}
-
-	if tokenMint == "" {
-		tokenMint = "EPjFWdd5AufqSSqeM2qN1xzybapC8G4wEGGkZwyTDt1v" // USDC devnet
-		log.Println("⚠️  X402_TOKEN_MINT not set, using USDC devnet")
-	}
-
-	if network == "" {
-		network = "solana-devnet"
+	// Load configuration from X402_* environment variables
+	config, err := echox402.ConfigFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
 	}
 
 	// Initialize X402 configuration
-	echox402.InitX402(&echox402.Config{
-		PaymentAddress: paymentAddress,
-		TokenMint:      tokenMint,
-		Network:        network,
-		AutoVerify:     true,
-	})
+	if err := echox402.InitX402(config); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
 
 	// Create Echo instance
 	e := echo.New()
@@ -70,8 +54,10 @@ func main() {
 		Description: "Data processing service",
 	}))
 
-	// Tiered pricing endpoint
-	e.GET("/api/tiered/:tier", tieredDataHandler)
+	// Tiered pricing endpoint - price computed per request from the tier param
+	e.GET("/api/tiered/:tier", tieredDataHandler, echox402.PaymentRequired(echox402.PaymentRequiredOptions{
+		PriceFunc: tieredPrice,
+	}))
 
 	// Start server
 	port := os.Getenv("PORT")
@@ -80,9 +66,9 @@ func main() {
 	}
 
 	log.Printf("🚀 X402 Echo Server starting on port %s", port)
-	log.Printf("📍 Network: %s", network)
-	log.Printf("💰 Payment Address: %s", paymentAddress)
-	log.Printf("🪙 Token Mint: %s", tokenMint)
+	log.Printf("📍 Network: %s", config.Network)
+	log.Printf("💰 Payment Address: %s", config.PaymentAddress)
+	log.Printf("🪙 Token Mint: %s", config.TokenMint)
 	log.Println("")
 	log.Println("Available endpoints:")
 	log.Println("  GET  /api/free-data         - Free access (no payment)")
@@ -178,47 +164,42 @@ func processHandler(c echo.Context) error {
 	return c.JSON(http.StatusOK, result)
 }
 
-// tieredDataHandler demonstrates dynamic pricing based on tier.
+// tierPricing defines pricing per tier.
+var tierPricing = map[string]string{
+	"basic":    "0.05",
+	"standard": "0.10",
+	"premium":  "0.25",
+	"ultimate": "1.00",
+}
+
+// tieredPrice computes the price for a tiered request from the tier path param.
+func tieredPrice(c echo.Context) (string, string, error) {
+	tier := c.Param("tier")
+	amount, ok := tierPricing[tier]
+	if !ok {
+		return "", "", fmt.Errorf("invalid tier %q. Choose: basic, standard, premium, ultimate", tier)
+	}
+	return amount, fmt.Sprintf("Tiered data access - %s tier", tier), nil
+}
+
+// tieredDataHandler serves tiered data after the dynamically priced payment is verified.
 func tieredDataHandler(c echo.Context) error {
 	tier := c.Param("tier")
+	amount := tierPricing[tier]
 
-	// Define pricing per tier
-	pricing := map[string]string{
-		"basic":    "0.05",
-		"standard": "0.10",
-		"premium":  "0.25",
-		"ultimate": "1.00",
+	auth := echox402.GetPaymentAuthorization(c)
+	if auth != nil {
+		log.Printf("✅ Payment received: %s USDC from %s for %s tier", auth.ActualAmount, auth.PublicKey, tier)
 	}
 
-	amount, ok := pricing[tier]
-	if !ok {
-		return echo.NewHTTPError(http.StatusBadRequest, "Invalid tier. Choose: basic, standard, premium, ultimate")
+	data := map[string]interface{}{
+		"message": fmt.Sprintf("This is %s tier data (paid $%s)", tier, amount),
+		"tier":    tier,
+		"data": map[string]interface{}{
+			"timestamp": "2024-01-01T00:00:00Z",
+			"value":     fmt.Sprintf("%s tier content", tier),
+			"quality":   tier,
+		},
 	}
-
-	// Apply payment middleware dynamically
-	paymentMiddleware := echox402.PaymentRequired(echox402.PaymentRequiredOptions{
-		Amount:      amount,
-		Description: fmt.Sprintf("Tiered data access - %s tier", tier),
-	})
-
-	// Wrap handler with payment middleware
-	handler := paymentMiddleware(func(c echo.Context) error {
-		auth := echox402.GetPaymentAuthorization(c)
-		if auth != nil {
-			log.Printf("✅ Payment received: %s USDC from %s for %s tier", auth.ActualAmount, auth.PublicKey, tier)
-		}
-
-		data := map[string]interface{}{
-			"message": fmt.Sprintf("This is %s tier data (paid $%s)", tier, amount),
-			"tier":    tier,
-			"data": map[string]interface{}{
-				"timestamp": "2024-01-01T00:00:00Z",
-				"value":     fmt.Sprintf("%s tier content", tier),
-				"quality":   tier,
-			},
-		}
-		return c.JSON(http.StatusOK, data)
-	})
-
-	return handler(c)
+	return c.JSON(http.StatusOK, data)
 }
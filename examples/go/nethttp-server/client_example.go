@@ -8,25 +8,19 @@ import (
 	"os"
 
 	"github.com/gagliardetto/solana-go"
-	"github.com/mr-tron/base58"
 	"github.com/openlibx402/go/openlibx402-client"
+	"github.com/openlibx402/go/openlibx402-core/wallet"
 )
 
 // This example demonstrates how to use the X402 client to access paid APIs.
 //
 // To run this example:
-//  1. Set your Solana wallet private key: export X402_PRIVATE_KEY="your-base58-private-key"
+//  1. Point to your Solana wallet keypair file: export X402_WALLET="$HOME/.config/solana/id.json"
 //  2. Make sure the server is running: go run main.go
 //  3. Run this client: go run client_example.go
 func runClientExample() {
-	// Load wallet keypair from environment
-	privateKeyStr := os.Getenv("X402_PRIVATE_KEY")
-	if privateKeyStr == "" {
-		log.Fatal("X402_PRIVATE_KEY environment variable not set")
-	}
-
-	privateKeyBytes := base58.Decode(privateKeyStr)
-	walletKeypair := solana.PrivateKey(privateKeyBytes)
+	// Load wallet keypair from file
+	walletKeypair := loadWallet()
 
 	// Create X402 auto client (automatically handles payments)
 	client := client.NewAutoClient(walletKeypair, "", &client.AutoClientOptions{
@@ -86,13 +80,7 @@ func runClientExample() {
 
 // Example using explicit client (manual payment control)
 func runExplicitClientExample() {
-	privateKeyStr := os.Getenv("X402_PRIVATE_KEY")
-	if privateKeyStr == "" {
-		log.Fatal("X402_PRIVATE_KEY environment variable not set")
-	}
-
-	privateKeyBytes := base58.Decode(privateKeyStr)
-	walletKeypair := solana.PrivateKey(privateKeyBytes)
+	walletKeypair := loadWallet()
 
 	// Create explicit client
 	client := client.NewX402Client(walletKeypair, "", nil, true)
@@ -141,6 +129,20 @@ func runExplicitClientExample() {
 	log.Printf("✅ Response: %s", string(body))
 }
 
+// loadWallet loads the keypair file named by X402_WALLET (default: the
+// Solana CLI keypair). Encrypted keystores prompt for their passphrase.
+func loadWallet() solana.PrivateKey {
+	path := os.Getenv("X402_WALLET")
+	if path == "" {
+		path = os.ExpandEnv("$HOME/.config/solana/id.json")
+	}
+	walletKeypair, err := wallet.LoadFromFile(path)
+	if err != nil {
+		log.Fatalf("failed to load wallet: %v", err)
+	}
+	return walletKeypair
+}
+
 // Uncomment one of these in your main function to run the examples
 func main() {
 	fmt.Println("X402 Client Examples")
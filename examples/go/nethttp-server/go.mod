@@ -5,6 +5,7 @@ go 1.21
 require (
 	github.com/gagliardetto/solana-go v1.11.0
 	github.com/openlibx402/go/openlibx402-client v0.1.0
+	github.com/openlibx402/go/openlibx402-core v0.1.0
 	github.com/openlibx402/go/openlibx402-nethttp v0.1.0
 )
 
@@ -12,11 +13,14 @@ require (
 	filippo.io/edwards25519 v1.0.0-rc.1 // indirect
 	github.com/andres-erbsen/clock v0.0.0-20160526145045-9e14626cd129 // indirect
 	github.com/blendle/zapdriver v1.3.1 // indirect
+	github.com/buger/jsonparser v1.1.1 // indirect
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/fatih/color v1.9.0 // indirect
 	github.com/gagliardetto/binary v0.8.0 // indirect
 	github.com/gagliardetto/treeout v0.1.4 // indirect
 	github.com/google/uuid v1.6.0 // indirect
+	github.com/gorilla/rpc v1.2.0 // indirect
+	github.com/gorilla/websocket v1.4.2 // indirect
 	github.com/json-iterator/go v1.1.12 // indirect
 	github.com/klauspost/compress v1.13.6 // indirect
 	github.com/logrusorgru/aurora v2.0.3+incompatible // indirect
@@ -27,7 +31,7 @@ require (
 	github.com/modern-go/reflect2 v1.0.2 // indirect
 	github.com/mostynb/zstdpool-freelist v0.0.0-20201229113212-927304c0c3b1 // indirect
 	github.com/mr-tron/base58 v1.2.0 // indirect
-	github.com/openlibx402/go/openlibx402-core v0.1.0 // indirect
+	github.com/openlibx402/go/openlibx402-server v0.1.0 // indirect
 	github.com/streamingfast/logging v0.0.0-20230608130331-f22c91403091 // indirect
 	go.mongodb.org/mongo-driver v1.11.0 // indirect
 	go.uber.org/atomic v1.7.0 // indirect
@@ -38,10 +42,12 @@ require (
 	golang.org/x/sys v0.0.0-20210615035016-665e8c7367d1 // indirect
 	golang.org/x/term v0.0.0-20201210144234-2321bbc49cbf // indirect
 	golang.org/x/time v0.0.0-20191024005414-555d28b269f0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
 
 replace (
 	github.com/openlibx402/go/openlibx402-client => ../../../packages/go/openlibx402-client
 	github.com/openlibx402/go/openlibx402-core => ../../../packages/go/openlibx402-core
 	github.com/openlibx402/go/openlibx402-nethttp => ../../../packages/go/openlibx402-nethttp
+	github.com/openlibx402/go/openlibx402-server => ../../../packages/go/openlibx402-server
 )
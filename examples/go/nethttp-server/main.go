@@ -11,32 +11,16 @@ import (
 )
 
 func main() {
-	// Load configuration from environment variables
-	paymentAddress := os.Getenv("X402_PAYMENT_ADDRESS")
-	tokenMint := os.Getenv("X402_TOKEN_MINT")
-	network := os.Getenv("X402_NETWORK")
-
-	if paymentAddress == "" {
-		paymentAddress = "YOUR_SOLANA_WALLET_ADDRESS"
-		log.Println("⚠️  X402_PAYMENT_ADDRESS not set, using placeholder")
-	}
-
-	if tokenMint == "" {
-		tokenMint = "EPjFWdd5AufqSSqeM2qN1xzybapC8G4wEGGkZwyTDt1v" // USDC devnet
-		log.Println("⚠️  X402_TOKEN_MINT not set, using USDC devnet")
-	}
-
-	if network == "" {
-		network = "solana-devnet"
+	// Load configuration from X402_* environment variables
+	config, err := nethttp.ConfigFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
 	}
 
 	// Initialize X402 configuration
-	nethttp.InitX402(&nethttp.Config{
-		PaymentAddress: paymentAddress,
-		TokenMint:      tokenMint,
-		Network:        network,
-		AutoVerify:     true,
-	})
+	if err := nethttp.InitX402(config); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
 
 	// Create HTTP server
 	mux := http.NewServeMux()
@@ -69,9 +53,9 @@ func main() {
 	}
 
 	log.Printf("🚀 X402 Server starting on port %s", port)
-	log.Printf("📍 Network: %s", network)
-	log.Printf("💰 Payment Address: %s", paymentAddress)
-	log.Printf("🪙 Token Mint: %s", tokenMint)
+	log.Printf("📍 Network: %s", config.Network)
+	log.Printf("💰 Payment Address: %s", config.PaymentAddress)
+	log.Printf("🪙 Token Mint: %s", config.TokenMint)
 	log.Println("")
 	log.Println("Available endpoints:")
 	log.Println("  GET  /api/free-data       - Free access (no payment)")
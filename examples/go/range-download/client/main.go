@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/openlibx402/go/openlibx402-client"
+	"github.com/openlibx402/go/openlibx402-core/wallet"
+)
+
+// This example downloads a file priced by byte range, resuming it if it is
+// interrupted: within a run when the server cuts the download off, and
+// across runs from what was already saved, paying only for the rest.
+//
+// To run this example:
+//  1. Point to your Solana wallet keypair file: export X402_WALLET="$HOME/.config/solana/id.json"
+//  2. Start the server: go run ./server
+//  3. Download a file: go run ./client http://localhost:8080/files/dataset.bin dataset.bin
+func main() {
+	if len(os.Args) != 3 {
+		fmt.Fprintln(os.Stderr, "usage: client <url> <file>")
+		os.Exit(2)
+	}
+	url, name := os.Args[1], os.Args[2]
+
+	x402Client := client.NewAutoClient(loadWallet(), "", &client.AutoClientOptions{
+		MaxPaymentAmount: "1.0", // Safety limit per payment
+		AutoRetry:        true,
+		AllowLocal:       true, // Enable for local development
+		ResumeDownloads:  true,
+	})
+	defer x402Client.Close()
+
+	file, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Continue a previous download from where it stopped
+	var opts []client.RequestOption
+	if offset := info.Size(); offset > 0 {
+		log.Printf("⏩ Resuming %s at byte %d", name, offset)
+		opts = append(opts, client.WithHeader("Range", fmt.Sprintf("bytes=%d-", offset)))
+	}
+
+	resp, err := x402Client.Get(context.Background(), url, opts...)
+	if err != nil {
+		log.Fatalf("❌ Error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		if info.Size() > 0 {
+			// The server sent the whole file
+			if err := file.Truncate(0); err != nil {
+				log.Fatal(err)
+			}
+		}
+	case http.StatusPartialContent:
+	case http.StatusRequestedRangeNotSatisfiable:
+		log.Printf("✅ %s is already complete", name)
+		return
+	default:
+		log.Fatalf("❌ Unexpected status: %s", resp.Status)
+	}
+
+	n, err := io.Copy(file, resp.Body)
+	if err != nil {
+		log.Fatalf("❌ Download interrupted after %d bytes, run again to resume: %v", n, err)
+	}
+	spent, _ := x402Client.TotalSpent(0)
+	log.Printf("✅ Saved %d bytes to %s (spent %s USDC)", n, name, spent)
+}
+
+// loadWallet loads the keypair file named by X402_WALLET (default: the
+// Solana CLI keypair). Encrypted keystores prompt for their passphrase.
+func loadWallet() solana.PrivateKey {
+	path := os.Getenv("X402_WALLET")
+	if path == "" {
+		path = os.ExpandEnv("$HOME/.config/solana/id.json")
+	}
+	walletKeypair, err := wallet.LoadFromFile(path)
+	if err != nil {
+		log.Fatalf("failed to load wallet: %v", err)
+	}
+	return walletKeypair
+}
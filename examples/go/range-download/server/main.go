@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	nethttp "github.com/openlibx402/go/openlibx402-nethttp"
+	serverx402 "github.com/openlibx402/go/openlibx402-server"
+)
+
+func main() {
+	// Load configuration from X402_* environment variables
+	config, err := nethttp.ConfigFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	if err := nethttp.InitX402(config); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	dir := os.Getenv("FILES_DIR")
+	if dir == "" {
+		dir = "./files"
+	}
+	files := http.Dir(dir)
+
+	// Files are priced by the bytes requested: a request for the whole file
+	// pays for all of it, and a Range request only for its part
+	mux := http.NewServeMux()
+	mux.Handle("/files/", nethttp.PaymentRequired(nethttp.PaymentRequiredOptions{
+		Description: "File download",
+		RangePricing: &serverx402.RangePricing{
+			PricePerUnit: "0.01", // Per started 10 MiB
+			Stat: func(ctx context.Context, resource string) (fs.FileInfo, error) {
+				name := strings.TrimPrefix(path.Clean(resource), "/files")
+				return os.Stat(filepath.Join(dir, filepath.FromSlash(name)))
+			},
+		},
+	})(http.StripPrefix("/files/", http.FileServer(files))))
+
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8080"
+	}
+
+	log.Printf("🚀 X402 file server starting on port %s", port)
+	log.Printf("📂 Serving %s at /files/ for $0.01 USDC per 10 MiB", dir)
+	if err := http.ListenAndServe(":"+port, mux); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,118 @@
+// Package agent exposes an X402 auto client as tools for AI agents, so that
+// Go agents can call paid APIs declaratively: the model asks for a URL, and
+// the client pays for it within its spending budgets.
+//
+// FetchTool and BudgetTool implement the Tool interface of LangChainGo
+// (github.com/tmc/langchaingo/tools) without depending on it, and describe
+// themselves as function-calling tools with Definition, for agents that
+// call model APIs directly.
+//
+// Example:
+//
+//	autoClient := client.NewAutoClient(walletKeypair, "", &client.AutoClientOptions{
+//	    MaxPaymentAmount: "0.50",
+//	    MaxTotalSpend:    "10.00",
+//	})
+//	tools := agent.Tools(autoClient, nil)
+//
+//	// LangChainGo
+//	executor := agents.NewExecutor(agents.NewOneShotAgent(llm, []tools.Tool{tools[0], tools[1]}))
+//
+//	// Function calling
+//	for _, tool := range tools {
+//	    definitions = append(definitions, tool.Definition())
+//	}
+//	result, err := agent.Call(ctx, tools, call.Name, call.Arguments)
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	client "github.com/openlibx402/go/openlibx402-client"
+	"github.com/openlibx402/go/openlibx402-core"
+)
+
+// DefaultMaxResponseBytes is how much of a response body FetchTool returns
+// by default, 64 KiB, to keep it within the model's context.
+const DefaultMaxResponseBytes = 64 << 10
+
+// Tool is a tool an agent can call. Its methods match the Tool interface of
+// LangChainGo.
+type Tool interface {
+	// Name is the name the model calls the tool by.
+	Name() string
+	// Description tells the model what the tool does and how to call it.
+	Description() string
+	// Call runs the tool with the input the model produced and returns its
+	// result for the model.
+	Call(ctx context.Context, input string) (string, error)
+	// Definition describes the tool for function-calling APIs.
+	Definition() FunctionDefinition
+}
+
+// FunctionDefinition describes a tool for function-calling model APIs, in
+// the shape they share: a name, a description, and a JSON Schema of the
+// arguments.
+type FunctionDefinition struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Parameters  json.RawMessage `json:"parameters"`
+}
+
+// Options configures the tools.
+type Options struct {
+	// MaxResponseBytes bounds the response body FetchTool returns (default:
+	// DefaultMaxResponseBytes). Longer bodies are truncated.
+	MaxResponseBytes int64
+}
+
+// Tools returns a FetchTool and a BudgetTool for autoClient.
+func Tools(autoClient *client.X402AutoClient, opts *Options) []Tool {
+	return []Tool{NewFetchTool(autoClient, opts), NewBudgetTool(autoClient)}
+}
+
+// Call runs the tool named name with input, as function-calling APIs ask
+// for it. It fails if no tool has that name.
+func Call(ctx context.Context, tools []Tool, name, input string) (string, error) {
+	tool := find(tools, name)
+	if tool == nil {
+		return "", fmt.Errorf("unknown tool: %s", name)
+	}
+	return tool.Call(ctx, input)
+}
+
+// find returns the tool named name, or nil.
+func find(tools []Tool, name string) Tool {
+	for _, tool := range tools {
+		if tool.Name() == name {
+			return tool
+		}
+	}
+	return nil
+}
+
+// refusal returns the text reporting a payment the client refused to make,
+// for err from a budget or approval check, so that the model can adapt
+// rather than the agent fail. It returns "" for other errors.
+func refusal(err error) string {
+	var budgetErr *core.BudgetExceededError
+	switch {
+	case errors.As(err, &budgetErr):
+		return fmt.Sprintf("payment refused: %s budget of %s reached (spent %s, requested %s)", budgetErr.Budget, budgetErr.Limit, budgetErr.Spent, budgetErr.Requested)
+	case errors.Is(err, client.ErrPaymentNotApproved):
+		return "payment refused: the payment was not approved"
+	}
+	return ""
+}
+
+// toJSON encodes the result of a tool for the model.
+func toJSON(v interface{}) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
@@ -0,0 +1,124 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"time"
+
+	client "github.com/openlibx402/go/openlibx402-client"
+)
+
+// BudgetTool reports what an auto client has spent and what its budgets
+// leave, so that the model can decide which paid APIs it can afford.
+type BudgetTool struct {
+	client *client.X402AutoClient
+}
+
+// NewBudgetTool creates a BudgetTool for autoClient.
+func NewBudgetTool(autoClient *client.X402AutoClient) *BudgetTool {
+	return &BudgetTool{client: autoClient}
+}
+
+// BudgetInput is the input of BudgetTool: a JSON object, or just the URL
+// to report the per-domain budget for. It may be empty.
+type BudgetInput struct {
+	URL string `json:"url,omitempty"`
+}
+
+// BudgetResult is the result of BudgetTool.
+type BudgetResult struct {
+	TotalSpent    string `json:"total_spent"`
+	SpentLastHour string `json:"spent_last_hour"`
+	Payments      int    `json:"payments"`
+	MaxPerPayment string `json:"max_per_payment,omitempty"`
+	// Budgets lists the spending budgets of the client, if any.
+	Budgets []client.BudgetUsage `json:"budgets,omitempty"`
+}
+
+// Name implements Tool.
+func (t *BudgetTool) Name() string {
+	return "x402_budget"
+}
+
+// Description implements Tool.
+func (t *BudgetTool) Description() string {
+	return `Reports how much has been spent on X402 payments and how much of the spending budget is left. ` +
+		`Input may be empty, or a URL to also report the budget left for its domain. ` +
+		`Returns a JSON object.`
+}
+
+// Definition implements Tool.
+func (t *BudgetTool) Definition() FunctionDefinition {
+	return FunctionDefinition{
+		Name:        t.Name(),
+		Description: "Report the amount spent on X402 payments and the spending budget left.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"url": {"type": "string", "description": "URL to also report the per-domain budget for"}
+			}
+		}`),
+	}
+}
+
+// Call implements Tool.
+func (t *BudgetTool) Call(ctx context.Context, input string) (string, error) {
+	var in BudgetInput
+	input = strings.TrimSpace(input)
+	if strings.HasPrefix(input, "{") {
+		if err := json.Unmarshal([]byte(input), &in); err != nil {
+			return "", err
+		}
+	} else {
+		in.URL = input
+	}
+
+	records, err := t.client.PaymentHistory()
+	if err != nil {
+		return "", err
+	}
+	budgets, err := t.client.BudgetStatus(in.URL)
+	if err != nil {
+		return "", err
+	}
+	var total, lastHour []string
+	hourAgo := time.Now().Add(-time.Hour)
+	for _, record := range records {
+		total = append(total, record.Amount)
+		if record.Timestamp.After(hourAgo) {
+			lastHour = append(lastHour, record.Amount)
+		}
+	}
+	return toJSON(BudgetResult{
+		TotalSpent:    zero(sum(total)),
+		SpentLastHour: zero(sum(lastHour)),
+		Payments:      len(records),
+		MaxPerPayment: t.client.MaxPaymentAmount(),
+		Budgets:       budgets,
+	})
+}
+
+// sum returns the sum of decimal amounts, or "" if there are none.
+func sum(amounts []string) string {
+	if len(amounts) == 0 {
+		return ""
+	}
+	total := new(big.Rat)
+	for _, amount := range amounts {
+		if value, ok := new(big.Rat).SetString(amount); ok {
+			total.Add(total, value)
+		}
+	}
+	s := strings.TrimRight(total.FloatString(9), "0")
+	return strings.TrimSuffix(s, ".")
+}
+
+// zero returns amount, or "0" if it is empty.
+func zero(amount string) string {
+	if amount == "" {
+		return "0"
+	}
+	return amount
+}
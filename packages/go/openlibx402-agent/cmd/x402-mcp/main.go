@@ -0,0 +1,93 @@
+// Command x402-mcp is a Model Context Protocol server that lets desktop
+// agents pay for X402 APIs. MCP clients start it and talk to it over stdin
+// and stdout; it offers the x402_fetch and x402_budget tools of package
+// agent, paying from a local wallet within the given limits.
+//
+// Usage:
+//
+//	x402-mcp [flags]
+//
+// Example MCP client configuration:
+//
+//	{
+//	  "mcpServers": {
+//	    "x402": {
+//	      "command": "x402-mcp",
+//	      "args": ["-max", "0.50", "-max-total", "10"],
+//	      "env": {"X402_WALLET": "/home/me/.config/solana/agent.json"}
+//	    }
+//	  }
+//	}
+//
+// Payments are signed with the wallet in -wallet, X402_WALLET, or the Solana
+// CLI default ~/.config/solana/id.json (see wallet.LoadFromFile); encrypted
+// keystores take their passphrase from X402_WALLET_PASSPHRASE. Logs are
+// written to stderr, as stdout carries the protocol.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	agent "github.com/openlibx402/go/openlibx402-agent"
+	client "github.com/openlibx402/go/openlibx402-client"
+	"github.com/openlibx402/go/openlibx402-core/wallet"
+)
+
+// walletEnv is the environment variable naming the default wallet file.
+const walletEnv = "X402_WALLET"
+
+func main() {
+	walletFile := flag.String("wallet", "", "wallet file (default: $"+walletEnv+" or ~/.config/solana/id.json)")
+	rpcURL := flag.String("rpc", "", "Solana RPC URL (default: the public devnet endpoint)")
+	maxPayment := flag.String("max", "", "refuse to pay more than this amount for a request")
+	maxHour := flag.String("max-hour", "", "spending budget per hour")
+	maxDomain := flag.String("max-domain", "", "spending budget per domain")
+	maxTotal := flag.String("max-total", "", "total spending budget")
+	maxResponse := flag.Int64("max-response", agent.DefaultMaxResponseBytes, "response bytes returned to the model")
+	allowLocal := flag.Bool("allow-local", false, "allow requests to local and private addresses")
+	flag.Parse()
+
+	path := *walletFile
+	if path == "" {
+		path = os.Getenv(walletEnv)
+	}
+	if path == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = filepath.Join(home, ".config", "solana", "id.json")
+		}
+	}
+	key, err := wallet.LoadFromFile(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "x402-mcp: failed to load wallet %s: %v\n", path, err)
+		os.Exit(1)
+	}
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+	autoClient := client.NewAutoClient(key, *rpcURL, &client.AutoClientOptions{
+		AutoRetry:         true,
+		MaxPaymentAmount:  *maxPayment,
+		MaxSpendPerHour:   *maxHour,
+		MaxSpendPerDomain: *maxDomain,
+		MaxTotalSpend:     *maxTotal,
+		AllowLocal:        *allowLocal,
+		Logger:            logger,
+	})
+	defer autoClient.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	logger.Info("x402-mcp: serving", "payer", key.PublicKey())
+	server := agent.NewMCPServer(agent.Tools(autoClient, &agent.Options{MaxResponseBytes: *maxResponse}))
+	if err := server.ServeStdio(ctx); err != nil && ctx.Err() == nil {
+		logger.Error("x402-mcp: stopped", "error", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,161 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	client "github.com/openlibx402/go/openlibx402-client"
+)
+
+// FetchTool fetches URLs with an auto client, paying for those that
+// require payment.
+type FetchTool struct {
+	client           *client.X402AutoClient
+	maxResponseBytes int64
+}
+
+// NewFetchTool creates a FetchTool for autoClient. Payments are subject to
+// the limits the client was created with, such as MaxPaymentAmount and the
+// spending budgets.
+func NewFetchTool(autoClient *client.X402AutoClient, opts *Options) *FetchTool {
+	if opts == nil {
+		opts = &Options{}
+	}
+	maxResponseBytes := opts.MaxResponseBytes
+	if maxResponseBytes <= 0 {
+		maxResponseBytes = DefaultMaxResponseBytes
+	}
+	return &FetchTool{client: autoClient, maxResponseBytes: maxResponseBytes}
+}
+
+// FetchInput is the input of FetchTool: a JSON object, or just the URL to GET.
+type FetchInput struct {
+	URL     string            `json:"url"`
+	Method  string            `json:"method,omitempty"` // Default: GET
+	Body    string            `json:"body,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// FetchResult is the result of FetchTool.
+type FetchResult struct {
+	Status      int    `json:"status"`
+	ContentType string `json:"content_type,omitempty"`
+	Body        string `json:"body"`
+	Truncated   bool   `json:"truncated,omitempty"`
+	// Paid is the amount paid for the request, if it required payment.
+	Paid string `json:"paid,omitempty"`
+	// Captured is the amount charged of a held payment, if the server
+	// reported one.
+	Captured string `json:"captured,omitempty"`
+}
+
+// Name implements Tool.
+func (t *FetchTool) Name() string {
+	return "x402_fetch"
+}
+
+// Description implements Tool.
+func (t *FetchTool) Description() string {
+	return `Fetches a URL over HTTP, paying for it automatically if the API requires an X402 payment. ` +
+		`Input is the URL, or a JSON object {"url": "...", "method": "GET", "body": "...", "headers": {...}}. ` +
+		`Returns a JSON object with the status, body, and the amount paid, if any.`
+}
+
+// Definition implements Tool.
+func (t *FetchTool) Definition() FunctionDefinition {
+	return FunctionDefinition{
+		Name:        t.Name(),
+		Description: "Fetch a URL over HTTP, automatically paying for APIs that require an X402 payment, within the spending budget.",
+		Parameters: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"url": {"type": "string", "description": "URL to fetch"},
+				"method": {"type": "string", "enum": ["GET", "POST", "PUT", "DELETE"], "description": "HTTP method (default GET)"},
+				"body": {"type": "string", "description": "Request body, for POST and PUT"},
+				"headers": {"type": "object", "additionalProperties": {"type": "string"}, "description": "Request headers"}
+			},
+			"required": ["url"]
+		}`),
+	}
+}
+
+// Call implements Tool. Payments refused by the client's budgets or
+// approval are reported to the model in the result; other failures are
+// returned as errors.
+func (t *FetchTool) Call(ctx context.Context, input string) (string, error) {
+	var in FetchInput
+	input = strings.TrimSpace(input)
+	if strings.HasPrefix(input, "{") {
+		if err := json.Unmarshal([]byte(input), &in); err != nil {
+			return "", fmt.Errorf("invalid input: %w", err)
+		}
+	} else {
+		in.URL = input
+	}
+	if in.URL == "" {
+		return "", fmt.Errorf("invalid input: url is required")
+	}
+	if in.Method == "" {
+		in.Method = http.MethodGet
+	}
+
+	var body io.Reader
+	if in.Body != "" {
+		body = strings.NewReader(in.Body)
+	}
+	req, err := http.NewRequestWithContext(ctx, strings.ToUpper(in.Method), in.URL, body)
+	if err != nil {
+		return "", fmt.Errorf("invalid input: %w", err)
+	}
+	for key, value := range in.Headers {
+		req.Header.Set(key, value)
+	}
+
+	start := time.Now()
+	resp, err := t.client.Do(ctx, req)
+	if err != nil {
+		if text := refusal(err); text != "" {
+			return text, nil
+		}
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, t.maxResponseBytes+1))
+	if err != nil {
+		return "", fmt.Errorf("failed to read response: %w", err)
+	}
+	result := FetchResult{
+		Status:      resp.StatusCode,
+		ContentType: resp.Header.Get("Content-Type"),
+	}
+	if int64(len(data)) > t.maxResponseBytes {
+		data, result.Truncated = data[:t.maxResponseBytes], true
+	}
+	result.Body = string(data)
+	result.Paid = t.paidSince(in.URL, start)
+	// A trailer is only read with the whole body
+	result.Captured = client.CapturedAmount(resp)
+	return toJSON(result)
+}
+
+// paidSince returns the sum of the payments for url made since start, or ""
+// if there were none.
+func (t *FetchTool) paidSince(url string, start time.Time) string {
+	records, err := t.client.PaymentHistory()
+	if err != nil {
+		return ""
+	}
+	var amounts []string
+	for _, record := range records {
+		if record.Endpoint == url && !record.Timestamp.Before(start) {
+			amounts = append(amounts, record.Amount)
+		}
+	}
+	return sum(amounts)
+}
@@ -0,0 +1,223 @@
+package agent
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// MCPProtocolVersion is the Model Context Protocol revision MCPServer
+// offers clients that ask for one it does not know.
+const MCPProtocolVersion = "2024-11-05"
+
+// mcpProtocolVersions are the revisions MCPServer speaks; their tool
+// methods are the same.
+var mcpProtocolVersions = map[string]bool{
+	"2024-11-05": true,
+	"2025-03-26": true,
+	"2025-06-18": true,
+}
+
+// JSON-RPC error codes.
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+)
+
+// MCPServer serves tools over the Model Context Protocol, so that desktop
+// agents and other MCP clients can pay for X402 APIs through an auto
+// client. It implements the stdio transport: JSON-RPC messages, one per
+// line, on the client's stdin and stdout.
+//
+// Example (in a command started by the MCP client):
+//
+//	server := agent.NewMCPServer(agent.Tools(autoClient, nil))
+//	if err := server.ServeStdio(ctx); err != nil {
+//	    log.Fatal(err)
+//	}
+type MCPServer struct {
+	tools []Tool
+	// Name and Version identify the server to clients (default:
+	// "openlibx402" and "0.1.0").
+	Name    string
+	Version string
+
+	mu sync.Mutex // Serializes writes
+}
+
+// NewMCPServer creates an MCP server offering tools.
+func NewMCPServer(tools []Tool) *MCPServer {
+	return &MCPServer{tools: tools, Name: "openlibx402", Version: "0.1.0"}
+}
+
+// rpcMessage is a JSON-RPC request or notification.
+type rpcMessage struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// rpcResponse is a JSON-RPC response.
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+// rpcError is the error of a JSON-RPC response.
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// ServeStdio serves the client on stdin and stdout until stdin is closed
+// or ctx is done.
+func (s *MCPServer) ServeStdio(ctx context.Context) error {
+	return s.Serve(ctx, os.Stdin, os.Stdout)
+}
+
+// Serve reads requests from r and writes responses to w until r is
+// exhausted or ctx is done. Requests are handled concurrently, so that a
+// slow paid request does not hold up others.
+func (s *MCPServer) Serve(ctx context.Context, r io.Reader, w io.Writer) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	lines := make(chan []byte)
+	errs := make(chan error, 1)
+	go func() {
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64<<10), 16<<20)
+		for scanner.Scan() {
+			line := append([]byte(nil), scanner.Bytes()...)
+			select {
+			case lines <- line:
+			case <-ctx.Done():
+				return
+			}
+		}
+		errs <- scanner.Err()
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-errs:
+			return err
+		case line := <-lines:
+			if len(line) == 0 {
+				continue
+			}
+			var msg rpcMessage
+			if err := json.Unmarshal(line, &msg); err != nil {
+				s.write(w, rpcResponse{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &rpcError{rpcParseError, "parse error"}})
+				continue
+			}
+			if msg.JSONRPC != "2.0" || msg.Method == "" {
+				if len(msg.ID) > 0 {
+					s.write(w, rpcResponse{JSONRPC: "2.0", ID: msg.ID, Error: &rpcError{rpcInvalidRequest, "invalid request"}})
+				}
+				continue
+			}
+			if len(msg.ID) == 0 {
+				// Notifications, e.g. notifications/initialized, need no response
+				continue
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				result, rpcErr := s.handle(ctx, msg)
+				s.write(w, rpcResponse{JSONRPC: "2.0", ID: msg.ID, Result: result, Error: rpcErr})
+			}()
+		}
+	}
+}
+
+// handle runs a request, returning its result or error.
+func (s *MCPServer) handle(ctx context.Context, msg rpcMessage) (interface{}, *rpcError) {
+	switch msg.Method {
+	case "initialize":
+		var params struct {
+			ProtocolVersion string `json:"protocolVersion"`
+		}
+		json.Unmarshal(msg.Params, &params)
+		version := MCPProtocolVersion
+		if mcpProtocolVersions[params.ProtocolVersion] {
+			version = params.ProtocolVersion
+		}
+		return map[string]interface{}{
+			"protocolVersion": version,
+			"capabilities":    map[string]interface{}{"tools": map[string]interface{}{}},
+			"serverInfo":      map[string]string{"name": s.Name, "version": s.Version},
+		}, nil
+
+	case "ping":
+		return map[string]interface{}{}, nil
+
+	case "tools/list":
+		tools := make([]map[string]interface{}, 0, len(s.tools))
+		for _, tool := range s.tools {
+			definition := tool.Definition()
+			tools = append(tools, map[string]interface{}{
+				"name":        definition.Name,
+				"description": definition.Description,
+				"inputSchema": definition.Parameters,
+			})
+		}
+		return map[string]interface{}{"tools": tools}, nil
+
+	case "tools/call":
+		var params struct {
+			Name      string          `json:"name"`
+			Arguments json.RawMessage `json:"arguments"`
+		}
+		if err := json.Unmarshal(msg.Params, &params); err != nil || params.Name == "" {
+			return nil, &rpcError{rpcInvalidParams, "invalid params: name is required"}
+		}
+		tool := find(s.tools, params.Name)
+		if tool == nil {
+			return nil, &rpcError{rpcInvalidParams, fmt.Sprintf("unknown tool: %s", params.Name)}
+		}
+		input := string(params.Arguments)
+		if input == "" || input == "null" {
+			input = "{}"
+		}
+		text, err := tool.Call(ctx, input)
+		if err != nil {
+			// Tool failures are results the model can see, not protocol errors
+			return toolResult(err.Error(), true), nil
+		}
+		return toolResult(text, false), nil
+	}
+	return nil, &rpcError{rpcMethodNotFound, fmt.Sprintf("method not found: %s", msg.Method)}
+}
+
+// toolResult is the result of tools/call with text content.
+func toolResult(text string, isError bool) map[string]interface{} {
+	return map[string]interface{}{
+		"content": []map[string]string{{"type": "text", "text": text}},
+		"isError": isError,
+	}
+}
+
+// write sends a message to the client, one per line.
+func (s *MCPServer) write(w io.Writer, response rpcResponse) {
+	data, err := json.Marshal(response)
+	if err != nil {
+		data, _ = json.Marshal(rpcResponse{JSONRPC: "2.0", ID: response.ID, Error: &rpcError{rpcInvalidRequest, err.Error()}})
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w.Write(append(data, '\n'))
+}
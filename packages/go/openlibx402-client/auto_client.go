@@ -1,9 +1,17 @@
 package client
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
 	"net/http"
+	"sync"
+	"time"
 
 	"github.com/gagliardetto/solana-go"
 	"github.com/openlibx402/go/openlibx402-core"
@@ -13,13 +21,60 @@ import (
 //
 // When a 402 response is received, the client automatically creates
 // and broadcasts the payment, then retries the request with authorization.
+//
+// An X402AutoClient is safe for concurrent use by multiple goroutines.
+// Requests and their payments run concurrently, except that payments are
+// serialized while a spending budget is set.
 type X402AutoClient struct {
 	client           *X402Client
 	maxRetries       int
 	autoRetry        bool
 	maxPaymentAmount string
+	budget           budget
+	budgetMu         sync.Mutex
+	hosts            hostPolicy
+	approvePayment   func(ctx context.Context, request *core.PaymentRequest) (bool, error)
+	preferredTokens  []string
+	sessions         *sessionCache
+	sessionHeader    string
+
+	declarePayer      bool
+	deferred          bool
+	payerHeader       string
+	deferredHeader    string
+	onDeferredPayment func(request *core.PaymentRequest, authorization *core.PaymentAuthorization, err error)
+	settling          sync.WaitGroup
+
+	plan               string
+	planHeader         string
+	subscriptionHeader string
+	subscriptions      *subscriptionCache
+
+	quotas               *quotaCache
+	quotaHeader          string
+	quotaRemainingHeader string
+
+	channels             *channelCache // nil unless PaymentChannels is set
+	voucherHeader        string
+	channelHeader        string
+	channelBalanceHeader string
+	tabs                 *tabCache // nil unless Tabs is set
+
+	lightning        core.LightningPayer
+	maxLightningSats int64
+	lightningHeader  string
+
+	resumeDownloads bool
+	maxResumes      int
+	expiredTrailer  string
 }
 
+// ErrPaymentNotApproved is returned when ApprovePayment declines a payment.
+var ErrPaymentNotApproved = errors.New("payment was not approved")
+
+// ErrClientClosed is returned by clients used after Close.
+var ErrClientClosed = errors.New("client has been closed")
+
 // NewX402AutoClient creates a new automatic X402 client.
 //
 // Parameters:
@@ -53,10 +108,155 @@ type NewX402AutoClient struct {
 
 // AutoClientOptions contains configuration options for X402AutoClient.
 type AutoClientOptions struct {
-	MaxRetries       int    // Maximum retry attempts (default: 1)
+	MaxRetries       int    // Maximum payment attempts per request, e.g. if a payment arrives after its request expired (default: 1)
 	AutoRetry        bool   // Automatically retry on 402 (default: true)
 	MaxPaymentAmount string // Safety limit for payments (optional)
 	AllowLocal       bool   // Allow localhost URLs for development (default: false)
+
+	AuthorizationHeader string             // Payment authorization header name (default: X-Payment-Authorization)
+	Logger              *slog.Logger       // Logger for payment activity (default: discard)
+	RPCRetry            core.RetryPolicy   // Retries of transient RPC failures (default: none)
+	ComputeBudget       core.ComputeBudget // Priority fee and compute unit limit of payments (default: none)
+
+	// Confirmation is the commitment a payment must reach before the request
+	// is retried with it (default: "", retry as soon as it is sent).
+	// RPCWebSocketURL optionally lets the client subscribe to the payment's
+	// signature instead of polling for its status.
+	Confirmation    core.Commitment
+	RPCWebSocketURL string
+
+	// PaymentHistory stores the payments made by the client (default: in memory).
+	PaymentHistory PaymentHistoryStore
+
+	// Processor optionally replaces the Solana RPC processor payments are
+	// made with, e.g. with a core.MockProcessor in unit tests (see
+	// X402Client.SetProcessor).
+	Processor core.PaymentProcessor
+
+	// Spending budgets, checked against the payment history before each payment.
+	// A payment exceeding one fails with *core.BudgetExceededError.
+	MaxSpendPerHour   string // Limit on payments within the last hour (optional)
+	MaxSpendPerDomain string // Limit on payments to each host (optional)
+	MaxTotalSpend     string // Limit on all payments (optional)
+
+	// Host policy, checked before each payment. AllowedHosts restricts
+	// payments to the listed hosts, and DeniedHosts forbids paying the listed
+	// hosts. Patterns are host names with an optional port, and "*.example.com"
+	// matches any subdomain of example.com. After redirects, the host that
+	// responded 402 must be allowed too. A forbidden payment fails with an
+	// error wrapping ErrHostNotAllowed; requests that need no payment are
+	// unaffected.
+	AllowedHosts []string
+	DeniedHosts  []string
+
+	// ApprovePayment is optionally called before each payment, after the
+	// MaxPaymentAmount check, so that a human or policy engine can approve it.
+	// Returning false fails the request with ErrPaymentNotApproved; an error is
+	// returned as is.
+	ApprovePayment func(ctx context.Context, request *core.PaymentRequest) (bool, error)
+
+	// PreferredTokens are token mints to pay in, most preferred first, when
+	// a server accepts several tokens (see core.PaymentRequest.Accepts).
+	// Payment requests accepting none of them are paid in their AssetAddress.
+	// MaxPaymentAmount and ApprovePayment see the amount in the chosen token.
+	PreferredTokens []string
+
+	// SessionHeader is the session token header name (default: X-Payment-Session).
+	// When a server returns a session token after payment, the client reuses it
+	// for the same resource, and concurrent requests waiting on the payment
+	// share it instead of paying separately.
+	SessionHeader string
+
+	// DeclarePayer declares the payer in PayerHeader on each request, so
+	// that servers pricing by payer, e.g. with volume pricing, quote the
+	// payer's price in the 402 response.
+	DeclarePayer bool
+
+	// DeferredPayment declares the payer in PayerHeader on each request, so
+	// that servers trusting it respond before payment (see
+	// serverx402.Config.DeferredPayers). The payment request they return in
+	// DeferredHeader is paid in the background, subject to the same checks
+	// as other payments, and the authorization is sent back to the request's
+	// URL. Close waits for these payments. Clients paying from a wallet pool
+	// do not defer payment.
+	DeferredPayment bool
+	PayerHeader     string // Payer public key header name (default: X-Payer-Public-Key)
+	DeferredHeader  string // Deferred payment request header name (default: X-Payment-Deferred)
+	// OnDeferredPayment is optionally called when a deferred payment was
+	// settled, with a nil error, or failed.
+	OnDeferredPayment func(request *core.PaymentRequest, authorization *core.PaymentAuthorization, err error)
+
+	// SubscriptionPlan is the ID of a subscription plan to buy from servers
+	// that offer it (see core.SubscriptionPlan), instead of paying per
+	// request. The client sends the subscription token it receives with later
+	// requests to the same server, and buys the plan again once the server
+	// no longer accepts it. Plan payments are subject to the same checks as
+	// other payments, including MaxPaymentAmount.
+	SubscriptionPlan   string
+	PlanHeader         string // Subscription plan header name (default: X-Payment-Plan)
+	SubscriptionHeader string // Subscription token header name (default: X-Payment-Subscription)
+
+	// QuotaHeader is the quota token header name (default: X-Payment-Quota).
+	// When a payment includes further requests to a resource (see
+	// core.PaymentRequest.RequestsIncluded), the client sends the quota
+	// token the server returned with them, until the server reports in
+	// QuotaRemainingHeader that none are left (default:
+	// X-Payment-Quota-Remaining).
+	QuotaHeader          string
+	QuotaRemainingHeader string
+
+	// PaymentChannels opens a payment channel with servers that offer one
+	// (see core.PaymentRequest.Channel), paying the channel deposit instead
+	// of the price, and pays later requests to the same payment address and
+	// token from it with vouchers signed by the payer, without on-chain
+	// transactions. A new channel is opened once the balance runs out or the
+	// server closes the channel. Deposits are subject to MaxPaymentAmount and
+	// the spending budgets; vouchers spend what was deposited. Close closes
+	// the channels, so that servers refund their unspent deposits.
+	PaymentChannels bool
+	// VoucherHeader is the voucher header name (default: X-Payment-Voucher),
+	// ChannelHeader returns the ID of an opened channel (default:
+	// X-Payment-Channel), and ChannelBalanceHeader what is left of its
+	// deposit (default: X-Payment-Channel-Balance).
+	VoucherHeader        string
+	ChannelHeader        string
+	ChannelBalanceHeader string
+
+	// Tabs charges requests to servers that offer a tab (see
+	// core.PaymentRequest.Tab) with vouchers signed by the payer, and settles
+	// what was charged in one on-chain payment every TabSettleRequests
+	// requests (default: 100) or TabSettleInterval (default: 1 minute),
+	// whichever comes first, or when the server's cap on the outstanding
+	// balance is reached. Settlements are subject to MaxPaymentAmount and the
+	// spending budgets. Tabs need a single wallet; they are not used with
+	// wallet pools.
+	Tabs              bool
+	TabSettleRequests int
+	TabSettleInterval time.Duration
+
+	// Lightning pays servers that offer a Lightning invoice (see
+	// core.PaymentRequest.Lightning) with it instead of on-chain, falling
+	// back to an on-chain payment if the invoice cannot be paid.
+	// MaxLightningSats caps the invoices paid (default: 0, no limit);
+	// Lightning payments are not counted in the spending budgets.
+	// LightningHeader carries the proof of payment (default:
+	// X-Payment-Lightning).
+	Lightning        core.LightningPayer
+	MaxLightningSats int64
+	LightningHeader  string
+
+	// ResumeDownloads resumes GET responses that are cut off before their
+	// end with Range requests for the rest, paying again if the server
+	// requires it. Long downloads are cut off when their payment runs out,
+	// by resetting the stream or ending the body early, optionally with the
+	// ExpiredTrailer trailer (default: X-Payment-Expired). If-Range ensures
+	// the rest is from the same resource, else reading fails with
+	// ErrDownloadChanged. MaxResumes caps the resumptions of each response
+	// (default: 3); responses to requests with a Range header are not
+	// resumed.
+	ResumeDownloads bool
+	MaxResumes      int
+	ExpiredTrailer  string
 }
 
 // NewX402AutoClient creates a new automatic X402 client.
@@ -65,6 +265,34 @@ func NewAutoClient(
 	rpcURL string,
 	options *AutoClientOptions,
 ) *X402AutoClient {
+	client := NewX402Client(walletKeypair, rpcURL, nil, options != nil && options.AllowLocal)
+	return newAutoClient(client, options)
+}
+
+// NewAutoClientWithSigner creates an automatic X402 client that signs
+// payments with signer, e.g. a core.RemoteSigner.
+func NewAutoClientWithSigner(
+	signer core.Signer,
+	rpcURL string,
+	options *AutoClientOptions,
+) *X402AutoClient {
+	client := NewX402ClientWithSigner(signer, rpcURL, nil, options != nil && options.AllowLocal)
+	return newAutoClient(client, options)
+}
+
+// NewAutoClientWithWalletPool creates an automatic X402 client that pays
+// from a pool of wallets (see WalletPool).
+func NewAutoClientWithWalletPool(
+	pool *WalletPool,
+	rpcURL string,
+	options *AutoClientOptions,
+) *X402AutoClient {
+	client := NewX402ClientWithWalletPool(pool, rpcURL, nil, options != nil && options.AllowLocal)
+	return newAutoClient(client, options)
+}
+
+// newAutoClient configures client with options.
+func newAutoClient(client *X402Client, options *AutoClientOptions) *X402AutoClient {
 	if options == nil {
 		options = &AutoClientOptions{
 			MaxRetries: 1,
@@ -73,18 +301,132 @@ func NewAutoClient(
 		}
 	}
 
-	client := NewX402Client(walletKeypair, rpcURL, nil, options.AllowLocal)
+	if options.Processor != nil {
+		client.SetProcessor(options.Processor)
+	}
+	client.SetAuthorizationHeader(options.AuthorizationHeader)
+	client.SetLogger(options.Logger)
+	client.SetRetryPolicy(options.RPCRetry)
+	client.SetComputeBudget(options.ComputeBudget)
+	client.SetConfirmation(options.Confirmation, options.RPCWebSocketURL)
+	client.SetPaymentHistory(options.PaymentHistory)
+
+	sessionHeader := options.SessionHeader
+	if sessionHeader == "" {
+		sessionHeader = core.DefaultSessionHeader
+	}
+	payerHeader := options.PayerHeader
+	if payerHeader == "" {
+		payerHeader = core.DefaultPayerHeader
+	}
+	deferredHeader := options.DeferredHeader
+	if deferredHeader == "" {
+		deferredHeader = core.DefaultDeferredHeader
+	}
+	planHeader := options.PlanHeader
+	if planHeader == "" {
+		planHeader = core.DefaultPlanHeader
+	}
+	subscriptionHeader := options.SubscriptionHeader
+	if subscriptionHeader == "" {
+		subscriptionHeader = core.DefaultSubscriptionHeader
+	}
+	quotaHeader := options.QuotaHeader
+	if quotaHeader == "" {
+		quotaHeader = core.DefaultQuotaHeader
+	}
+	quotaRemainingHeader := options.QuotaRemainingHeader
+	if quotaRemainingHeader == "" {
+		quotaRemainingHeader = core.DefaultQuotaRemainingHeader
+	}
+	voucherHeader := options.VoucherHeader
+	if voucherHeader == "" {
+		voucherHeader = core.DefaultVoucherHeader
+	}
+	channelHeader := options.ChannelHeader
+	if channelHeader == "" {
+		channelHeader = core.DefaultChannelHeader
+	}
+	channelBalanceHeader := options.ChannelBalanceHeader
+	if channelBalanceHeader == "" {
+		channelBalanceHeader = core.DefaultChannelBalanceHeader
+	}
+	lightningHeader := options.LightningHeader
+	if lightningHeader == "" {
+		lightningHeader = core.DefaultLightningHeader
+	}
+	expiredTrailer := options.ExpiredTrailer
+	if expiredTrailer == "" {
+		expiredTrailer = core.DefaultExpiredTrailer
+	}
+	var channels *channelCache
+	if options.PaymentChannels {
+		channels = newChannelCache()
+	}
+	var tabs *tabCache
+	if options.Tabs {
+		tabs = newTabCache(options.TabSettleRequests, options.TabSettleInterval)
+	}
 
 	return &X402AutoClient{
 		client:           client,
 		maxRetries:       options.MaxRetries,
 		autoRetry:        options.AutoRetry,
 		maxPaymentAmount: options.MaxPaymentAmount,
+		budget: budget{
+			perHour:   options.MaxSpendPerHour,
+			perDomain: options.MaxSpendPerDomain,
+			total:     options.MaxTotalSpend,
+		},
+		hosts: hostPolicy{
+			allowed: options.AllowedHosts,
+			denied:  options.DeniedHosts,
+		},
+		approvePayment:  options.ApprovePayment,
+		preferredTokens: options.PreferredTokens,
+		sessions:        newSessionCache(),
+		sessionHeader:   sessionHeader,
+
+		declarePayer:      options.DeclarePayer || options.DeferredPayment,
+		deferred:          options.DeferredPayment,
+		payerHeader:       payerHeader,
+		deferredHeader:    deferredHeader,
+		onDeferredPayment: options.OnDeferredPayment,
+
+		plan:               options.SubscriptionPlan,
+		planHeader:         planHeader,
+		subscriptionHeader: subscriptionHeader,
+		subscriptions:      newSubscriptionCache(),
+
+		quotas:               newQuotaCache(),
+		quotaHeader:          quotaHeader,
+		quotaRemainingHeader: quotaRemainingHeader,
+
+		channels:             channels,
+		voucherHeader:        voucherHeader,
+		channelHeader:        channelHeader,
+		channelBalanceHeader: channelBalanceHeader,
+		tabs:                 tabs,
+
+		lightning:        options.Lightning,
+		maxLightningSats: options.MaxLightningSats,
+		lightningHeader:  lightningHeader,
+
+		resumeDownloads: options.ResumeDownloads,
+		maxResumes:      options.MaxResumes,
+		expiredTrailer:  expiredTrailer,
 	}
 }
 
-// Close closes the client and cleans up resources.
+// Close waits for deferred payments in progress and closes the payment
+// channels the client opened (see CloseChannels), then closes the client and
+// cleans up resources.
 func (c *X402AutoClient) Close() error {
+	c.settling.Wait()
+	ctx, cancel := context.WithTimeout(context.Background(), channelCloseTimeout)
+	// Failures are logged, and the servers refund the channels once they expire
+	c.CloseChannels(ctx)
+	cancel()
 	return c.client.Close()
 }
 
@@ -94,99 +436,427 @@ func (c *X402AutoClient) fetch(
 	method string,
 	url string,
 	body []byte,
+	opts []RequestOption,
 ) (*http.Response, error) {
-	var resp *http.Response
-	var err error
-
-	// Make initial request
+	hasBody := false
 	switch method {
-	case "GET":
-		resp, err = c.client.Get(ctx, url, nil)
-	case "POST":
-		resp, err = c.client.Post(ctx, url, body, nil)
-	case "PUT":
-		resp, err = c.client.Put(ctx, url, body, nil)
-	case "DELETE":
-		resp, err = c.client.Delete(ctx, url, nil)
+	case "GET", "DELETE":
+	case "POST", "PUT":
+		hasBody = true
 	default:
 		return nil, fmt.Errorf("unsupported HTTP method: %s", method)
 	}
 
+	newRequest := func() (*http.Request, error) {
+		if !hasBody {
+			return http.NewRequest(method, url, nil)
+		}
+		req, err := http.NewRequest(method, url, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		return req, nil
+	}
+	resp, err := c.send(ctx, opts, newRequest)
+	return c.resumable(ctx, opts, newRequest, resp, err)
+}
+
+// send makes a request with automatic payment handling. newRequest is called
+// for the initial request and again for the retry with payment, so that the
+// request body can be replayed; opts are applied to both.
+func (c *X402AutoClient) send(ctx context.Context, opts []RequestOption, newRequest func() (*http.Request, error)) (*http.Response, error) {
+	if len(opts) > 0 {
+		build := newRequest
+		newRequest = func() (*http.Request, error) {
+			req, err := build()
+			if err != nil {
+				return nil, err
+			}
+			for _, opt := range opts {
+				opt(req)
+			}
+			return req, nil
+		}
+	}
+	if c.plan != "" {
+		newRequest = c.subscriptions.wrap(newRequest, c.plan, c.planHeader, c.subscriptionHeader)
+	}
+
+	// Make initial request, reusing a session token or included request from
+	// an earlier payment
+	req, err := newRequest()
+	if err != nil {
+		return nil, err
+	}
+	key := sessionKey(req.URL)
+	token := c.sessions.token(key)
+	if token != "" {
+		req.Header.Set(c.sessionHeader, token)
+	}
+	quota := c.quotas.token(key)
+	if quota != "" {
+		req.Header.Set(c.quotaHeader, quota)
+	}
+	var channel *paymentChannel
+	var voucherAmount *big.Rat
+	if c.channels != nil && token == "" && quota == "" {
+		channel, voucherAmount = c.attachVoucher(ctx, req)
+	}
+	if c.tabs != nil && channel == nil && token == "" && quota == "" {
+		c.attachTabVoucher(ctx, req)
+	}
+	if c.declarePayer {
+		if payer := c.client.payer(); payer != "" {
+			req.Header.Set(c.payerHeader, payer)
+		}
+	}
+	resp, err := c.client.Do(ctx, req, nil)
 	if err != nil {
 		return nil, err
 	}
+	if subscription := req.Header.Get(c.subscriptionHeader); subscription != "" && c.client.PaymentRequired(resp) {
+		// The subscription expired: request again to renew it
+		c.subscriptions.forget(req.URL, subscription)
+		resp.Body.Close()
+		if req, err = newRequest(); err != nil {
+			return nil, err
+		}
+		if resp, err = c.client.Do(ctx, req, nil); err != nil {
+			return nil, err
+		}
+	}
+	if !c.client.PaymentRequired(resp) {
+		c.quotas.update(key, resp, c.quotaHeader, c.quotaRemainingHeader)
+		if channel != nil {
+			c.channels.accept(channel, voucherAmount, resp, c.channelBalanceHeader)
+		}
+		if deferred := resp.Header.Get(c.deferredHeader); deferred != "" && c.deferred && c.checkRedirectedHost(resp, req.URL.String()) == nil {
+			c.payDeferred(req.Method, req.URL.String(), deferred)
+		}
+		return resp, nil
+	}
+	if token != "" {
+		c.sessions.forget(key, token)
+	}
+	if quota != "" {
+		c.quotas.forget(key, quota)
+	}
+	if c.channels != nil && c.autoRetry {
+		// Pay from an open channel before paying on-chain
+		paid, ok, err := c.payFromChannel(ctx, resp, newRequest)
+		if err != nil || ok {
+			return paid, err
+		}
+		resp = paid
+	}
+	if c.tabs != nil && c.autoRetry {
+		// Charge the tab unless the server asks to settle it
+		charged, ok, err := c.payFromTab(ctx, resp, newRequest)
+		if err != nil || ok {
+			return charged, err
+		}
+		resp = charged
+	}
 
-	// Check if payment required
-	if c.client.PaymentRequired(resp) {
-		if !c.autoRetry {
-			paymentReq, _ := c.client.ParsePaymentRequest(resp)
-			return nil, core.NewPaymentRequiredError(paymentReq, "")
+	// Coalesce concurrent payments for the same resource: one request pays and
+	// the others reuse the session token the server issues for it
+	flight, leader := c.sessions.begin(key)
+	if !leader {
+		select {
+		case <-flight.done:
+		case <-ctx.Done():
+			resp.Body.Close()
+			return nil, ctx.Err()
+		}
+		if quota := c.quotas.token(key); flight.token != "" || quota != "" {
+			retry, err := newRequest()
+			if err != nil {
+				resp.Body.Close()
+				return nil, err
+			}
+			if flight.token != "" {
+				retry.Header.Set(c.sessionHeader, flight.token)
+			}
+			if quota != "" {
+				retry.Header.Set(c.quotaHeader, quota)
+			}
+			sessionResp, err := c.client.Do(ctx, retry, nil)
+			if err != nil {
+				resp.Body.Close()
+				return nil, err
+			}
+			if !c.client.PaymentRequired(sessionResp) {
+				resp.Body.Close()
+				c.quotas.update(key, sessionResp, c.quotaHeader, c.quotaRemainingHeader)
+				return sessionResp, nil
+			}
+			sessionResp.Body.Close()
 		}
+		return c.payAndRetry(ctx, resp, req.URL.String(), newRequest)
+	}
 
-		// Parse payment request
-		paymentReq, err := c.client.ParsePaymentRequest(resp)
-		if err != nil {
+	resp, err = c.payAndRetry(ctx, resp, req.URL.String(), newRequest)
+	issued := ""
+	if err == nil {
+		issued = resp.Header.Get(c.sessionHeader)
+		if subscription := resp.Header.Get(c.subscriptionHeader); subscription != "" {
+			c.subscriptions.store(req.URL, subscription)
+		}
+		c.quotas.update(key, resp, c.quotaHeader, c.quotaRemainingHeader)
+	}
+	c.sessions.finish(key, flight, err == nil, issued)
+	return resp, err
+}
+
+// payAndRetry pays the 402 response and retries the request with the payment.
+//
+// If the server still requires payment, for example because the payment
+// request expired before the payment landed, it pays the new payment request,
+// up to MaxRetries times in all. A payment request that expires before it is
+// paid is requested again instead. Once the attempts are exhausted it returns
+// a *RetriesExhaustedError. The host policy applies to url and to the host
+// that responded 402, which redirects may have led to.
+func (c *X402AutoClient) payAndRetry(ctx context.Context, resp *http.Response, url string, newRequest func() (*http.Request, error)) (*http.Response, error) {
+	if c.lightning != nil && c.autoRetry {
+		// Pay the Lightning invoice the server offers before paying on-chain
+		if err := c.checkRedirectedHost(resp, url); err != nil {
+			resp.Body.Close()
 			return nil, err
 		}
+		paid, ok, err := c.payWithLightning(ctx, resp, url, newRequest)
+		if err != nil || ok {
+			return paid, err
+		}
+		resp = paid
+	}
 
-		// Safety check
-		if c.maxPaymentAmount != "" {
-			reqAmountFloat := 0.0
-			maxAmountFloat := 0.0
-			fmt.Sscanf(paymentReq.MaxAmountRequired, "%f", &reqAmountFloat)
-			fmt.Sscanf(c.maxPaymentAmount, "%f", &maxAmountFloat)
+	maxAttempts := c.maxRetries
+	if maxAttempts <= 0 {
+		maxAttempts = 1
+	}
 
-			if reqAmountFloat > maxAmountFloat {
-				return nil, fmt.Errorf(
-					"payment amount %s exceeds max allowed %s",
-					paymentReq.MaxAmountRequired,
-					c.maxPaymentAmount,
-				)
-			}
+	for attempt := 1; ; attempt++ {
+		// Prepare the retry before paying so a body that cannot be replayed fails first
+		retry, err := newRequest()
+		if err != nil {
+			resp.Body.Close()
+			return nil, err
 		}
 
-		// Create payment
-		authorization, err := c.client.CreatePayment(ctx, paymentReq, "")
+		if err := c.checkRedirectedHost(resp, url); err != nil {
+			resp.Body.Close()
+			if retry.Body != nil {
+				retry.Body.Close()
+			}
+			return nil, err
+		}
+		paymentReq, authorization, err := c.handlePaymentRequired(ctx, resp, url)
+		var expiredErr *core.PaymentExpiredError
+		if errors.As(err, &expiredErr) && attempt < maxAttempts {
+			// Fetch a fresh payment request instead of paying the stale one
+			c.client.log().Info("x402: payment request expired, requesting a new one", "url", url, "attempt", attempt)
+			resp, err = c.client.Do(ctx, retry, nil)
+			if err != nil || !c.client.PaymentRequired(resp) {
+				return resp, err
+			}
+			continue
+		}
 		if err != nil {
+			if retry.Body != nil {
+				retry.Body.Close()
+			}
 			return nil, err
 		}
 
 		// Retry with payment
-		switch method {
-		case "GET":
-			resp, err = c.client.Get(ctx, url, authorization)
-		case "POST":
-			resp, err = c.client.Post(ctx, url, body, authorization)
-		case "PUT":
-			resp, err = c.client.Put(ctx, url, body, authorization)
-		case "DELETE":
-			resp, err = c.client.Delete(ctx, url, authorization)
+		resp, err = c.client.Do(ctx, retry, authorization)
+		if err != nil {
+			return nil, err
+		}
+		if err := rejectionError(resp); err != nil {
+			c.client.log().Warn("x402: payment rejected by server", "url", url, core.LogKeyTxHash, authorization.TransactionHash, "error", err)
+			return nil, err
+		}
+		if !c.client.PaymentRequired(resp) {
+			c.releaseOnDelivery(resp, paymentReq, authorization)
+			if c.channels != nil {
+				c.openChannel(resp, retry.URL, authorization)
+			}
+			if c.tabs != nil && paymentReq.Tab != nil && paymentReq.Tab.Outstanding != "" {
+				c.tabs.settled(retry.URL, paymentReq)
+			}
+			return resp, nil
+		}
+		if attempt >= maxAttempts {
+			paymentReq, _ := c.client.ParsePaymentRequest(resp)
+			resp.Body.Close()
+			c.client.log().Warn("x402: payment still required after retries", "url", url, "attempts", attempt)
+			return nil, &RetriesExhaustedError{Attempts: attempt, PaymentRequest: paymentReq}
 		}
+		c.client.log().Info("x402: payment still required, paying again", "url", url, "attempt", attempt, core.LogKeyTxHash, authorization.TransactionHash)
+	}
+}
+
+// RetriesExhaustedError is returned when a server still requires payment
+// after the auto client made MaxRetries attempts to pay. It unwraps to a
+// *core.PaymentRequiredError for the last payment request.
+type RetriesExhaustedError struct {
+	Attempts       int                  // Attempts made
+	PaymentRequest *core.PaymentRequest // Last payment request (nil if the server sent an invalid one)
+}
+
+func (e *RetriesExhaustedError) Error() string {
+	return fmt.Sprintf("payment still required after %d attempts", e.Attempts)
+}
+
+// Unwrap returns the payment-required error of the last response.
+func (e *RetriesExhaustedError) Unwrap() error {
+	return core.NewPaymentRequiredError(e.PaymentRequest, e.Error())
+}
+
+// handlePaymentRequired parses the payment request of a 402 response and
+// pays it if it passes the client's checks, returning the request and its
+// payment.
+func (c *X402AutoClient) handlePaymentRequired(ctx context.Context, resp *http.Response, url string) (*core.PaymentRequest, *core.PaymentAuthorization, error) {
+	if !c.autoRetry {
+		paymentReq, _ := c.client.ParsePaymentRequest(resp)
+		return nil, nil, core.NewPaymentRequiredError(paymentReq, "")
+	}
+
+	// Parse payment request
+	paymentReq, err := c.client.ParsePaymentRequest(resp)
+	if err != nil {
+		c.client.log().Warn("x402: invalid payment request", "url", url, "error", err)
+		return nil, nil, err
+	}
+	c.client.log().Debug("x402: payment required", "url", url, "request", paymentReq)
+	authorization, err := c.checkAndPay(ctx, paymentReq, url)
+	return paymentReq, authorization, err
+}
+
+// checkAndPay pays a payment request, in the most preferred token it
+// accepts, if it is within MaxPaymentAmount and passes the checks of pay.
+func (c *X402AutoClient) checkAndPay(ctx context.Context, paymentReq *core.PaymentRequest, url string) (*core.PaymentAuthorization, error) {
+	channelMint := paymentReq.AssetAddress
+	for _, mint := range c.preferredTokens {
+		if priced, ok := paymentReq.WithToken(mint); ok {
+			paymentReq = priced
+			break
+		}
+	}
+	if c.channels != nil {
+		// Channels are opened in the token of the payment request only
+		paymentReq = channelDeposit(paymentReq, channelMint)
+	}
+
+	// Safety check
+	if c.maxPaymentAmount != "" {
+		reqAmountFloat := 0.0
+		maxAmountFloat := 0.0
+		fmt.Sscanf(paymentReq.MaxAmountRequired, "%f", &reqAmountFloat)
+		fmt.Sscanf(c.maxPaymentAmount, "%f", &maxAmountFloat)
+
+		if reqAmountFloat > maxAmountFloat {
+			c.client.log().Warn("x402: payment exceeds max allowed", "request", paymentReq, "max_amount", c.maxPaymentAmount)
+			return nil, core.NewBudgetExceededError(core.BudgetPerPayment, c.maxPaymentAmount, "0", paymentReq.MaxAmountRequired)
+		}
+	}
 
+	return c.pay(ctx, paymentReq, url)
+}
+
+// pay creates the payment for a request once approved, enforcing the spending budgets.
+func (c *X402AutoClient) pay(ctx context.Context, paymentReq *core.PaymentRequest, url string) (*core.PaymentAuthorization, error) {
+	if err := c.hosts.check(url); err != nil {
+		c.client.log().Warn("x402: payment to host not allowed", "url", url, "request", paymentReq)
+		return nil, err
+	}
+
+	if c.approvePayment != nil {
+		approved, err := c.approvePayment(ctx, paymentReq)
 		if err != nil {
 			return nil, err
 		}
+		if !approved {
+			c.client.log().Info("x402: payment not approved", "url", url, "request", paymentReq)
+			return nil, ErrPaymentNotApproved
+		}
 	}
 
-	return resp, nil
+	if !c.budget.enabled() {
+		return c.client.createPayment(ctx, paymentReq, "", url)
+	}
+
+	// Serialize budgeted payments so concurrent requests cannot overspend
+	c.budgetMu.Lock()
+	defer c.budgetMu.Unlock()
+
+	records, err := c.client.PaymentHistory()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read payment history: %w", err)
+	}
+	if err := c.budget.check(records, url, paymentReq.MaxAmountRequired); err != nil {
+		c.client.log().Warn("x402: payment exceeds budget", "url", url, "request", paymentReq, "error", err)
+		return nil, err
+	}
+	return c.client.createPayment(ctx, paymentReq, "", url)
 }
 
 // Get executes a GET request with automatic payment handling.
-func (c *X402AutoClient) Get(ctx context.Context, url string) (*http.Response, error) {
-	return c.fetch(ctx, "GET", url, nil)
+func (c *X402AutoClient) Get(ctx context.Context, url string, opts ...RequestOption) (*http.Response, error) {
+	return c.fetch(ctx, "GET", url, nil, opts)
 }
 
 // Post executes a POST request with automatic payment handling.
-func (c *X402AutoClient) Post(ctx context.Context, url string, body []byte) (*http.Response, error) {
-	return c.fetch(ctx, "POST", url, body)
+func (c *X402AutoClient) Post(ctx context.Context, url string, body []byte, opts ...RequestOption) (*http.Response, error) {
+	return c.fetch(ctx, "POST", url, body, opts)
 }
 
 // Put executes a PUT request with automatic payment handling.
-func (c *X402AutoClient) Put(ctx context.Context, url string, body []byte) (*http.Response, error) {
-	return c.fetch(ctx, "PUT", url, body)
+func (c *X402AutoClient) Put(ctx context.Context, url string, body []byte, opts ...RequestOption) (*http.Response, error) {
+	return c.fetch(ctx, "PUT", url, body, opts)
 }
 
 // Delete executes a DELETE request with automatic payment handling.
-func (c *X402AutoClient) Delete(ctx context.Context, url string) (*http.Response, error) {
-	return c.fetch(ctx, "DELETE", url, nil)
+func (c *X402AutoClient) Delete(ctx context.Context, url string, opts ...RequestOption) (*http.Response, error) {
+	return c.fetch(ctx, "DELETE", url, nil, opts)
+}
+
+// rejectionError returns a *core.PaymentVerificationError if resp is the
+// server's rejection of a payment, consuming its body, and nil otherwise.
+// Rejections are 4xx responses other than 402 with an X402 error code.
+func rejectionError(resp *http.Response) error {
+	if resp.StatusCode < 400 || resp.StatusCode >= 500 || resp.StatusCode == http.StatusPaymentRequired {
+		return nil
+	}
+	var body struct {
+		Code    string `json:"code"`
+		Error   string `json:"error"`
+		Message string `json:"message"`
+		Detail  string `json:"detail"` // Problem details (see core.ProblemContentType)
+	}
+	// Put the peeked bytes back for callers of responses that are not rejections
+	original := resp.Body
+	data, err := io.ReadAll(io.LimitReader(original, 64<<10))
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(data), original), original}
+	if err != nil || json.Unmarshal(data, &body) != nil || body.Code == "" {
+		return nil
+	}
+	resp.Body.Close()
+
+	reason := body.Error
+	if reason == "" {
+		reason = body.Detail
+	}
+	if body.Message != "" {
+		reason += ": " + body.Message
+	}
+	verificationErr := core.NewPaymentVerificationError(reason)
+	verificationErr.Details["code"] = body.Code
+	verificationErr.Details["status"] = resp.StatusCode
+	return verificationErr
 }
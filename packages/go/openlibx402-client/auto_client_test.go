@@ -0,0 +1,150 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/openlibx402/go/openlibx402-core"
+)
+
+// paidAPI is a test server charging amount for every request. It answers
+// requests without an authorization with a payment request, and counts the
+// authorizations it accepted.
+type paidAPI struct {
+	*httptest.Server
+	amount string
+	mint   string
+	paid   atomic.Int32
+}
+
+// newPaidAPI starts a paidAPI.
+func newPaidAPI(t testing.TB, amount string) *paidAPI {
+	t.Helper()
+	api := &paidAPI{amount: amount, mint: solana.NewWallet().PublicKey().String()}
+	payTo := solana.NewWallet().PublicKey().String()
+	api.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if header := r.Header.Get(core.DefaultAuthorizationHeader); header != "" {
+			if _, err := core.PaymentAuthorizationFromHeader(header); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			api.paid.Add(1)
+			w.Write([]byte("paid content"))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusPaymentRequired)
+		json.NewEncoder(w).Encode(&core.PaymentRequest{
+			MaxAmountRequired: api.amount,
+			AssetType:         "SPL",
+			AssetAddress:      api.mint,
+			PaymentAddress:    payTo,
+			Network:           "solana-devnet",
+			ExpiresAt:         time.Now().Add(time.Minute),
+			Nonce:             solana.NewWallet().PublicKey().String(),
+			PaymentID:         solana.NewWallet().PublicKey().String(),
+			Resource:          r.URL.Path,
+		})
+	}))
+	t.Cleanup(api.Close)
+	return api
+}
+
+// newTestAutoClient creates an auto client paying from a funded wallet on a
+// mock chain.
+func newTestAutoClient(t testing.TB, mint string, opts *AutoClientOptions) *X402AutoClient {
+	t.Helper()
+	wallet := solana.NewWallet()
+	mock := core.NewMockProcessor()
+	mock.SetBalance(wallet.PublicKey().String(), mint, 100)
+	mock.SetSOLBalance(wallet.PublicKey().String(), 1_000_000_000)
+	if opts == nil {
+		opts = &AutoClientOptions{}
+	}
+	opts.AutoRetry, opts.AllowLocal, opts.Processor = true, true, mock
+	c := NewAutoClient(wallet.PrivateKey, "", opts)
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestAutoClientPays(t *testing.T) {
+	api := newPaidAPI(t, "0.10")
+	c := newTestAutoClient(t, api.mint, nil)
+
+	resp, err := c.Get(context.Background(), api.URL+"/data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || api.paid.Load() != 1 {
+		t.Errorf("got %d after %d payments, want 200 after 1", resp.StatusCode, api.paid.Load())
+	}
+}
+
+func TestAutoClientAppliesHostPolicyAfterRedirect(t *testing.T) {
+	api := newPaidAPI(t, "0.10")
+	redirector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, api.URL+r.URL.Path, http.StatusFound)
+	}))
+	defer redirector.Close()
+	c := newTestAutoClient(t, api.mint, &AutoClientOptions{
+		AllowedHosts: []string{redirector.Listener.Addr().String()},
+	})
+
+	_, err := c.Get(context.Background(), redirector.URL+"/data")
+	if !errors.Is(err, ErrHostNotAllowed) {
+		t.Fatalf("got error %v, want ErrHostNotAllowed", err)
+	}
+	if n := api.paid.Load(); n != 0 {
+		t.Errorf("redirect target was paid %d times", n)
+	}
+}
+
+// slowProcessor is a MockProcessor taking delay to broadcast, so that
+// concurrent payments overlap.
+type slowProcessor struct {
+	*core.MockProcessor
+	delay time.Duration
+}
+
+func (p *slowProcessor) SignAndSendTransactionWithSigner(ctx context.Context, tx *solana.Transaction, signer core.Signer) (string, error) {
+	time.Sleep(p.delay)
+	return p.MockProcessor.SignAndSendTransactionWithSigner(ctx, tx, signer)
+}
+
+func TestAutoClientBudgetUnderConcurrency(t *testing.T) {
+	api := newPaidAPI(t, "0.10")
+	c := newTestAutoClient(t, api.mint, &AutoClientOptions{MaxTotalSpend: "0.50"})
+	c.client.SetProcessor(&slowProcessor{MockProcessor: c.client.processor.(*core.MockProcessor), delay: 5 * time.Millisecond})
+
+	var wg sync.WaitGroup
+	var exceeded atomic.Int32
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := c.Get(context.Background(), api.URL+"/data")
+			var budgetErr *core.BudgetExceededError
+			switch {
+			case errors.As(err, &budgetErr):
+				exceeded.Add(1)
+			case err != nil:
+				t.Errorf("Get() = %v, want success or *core.BudgetExceededError", err)
+			default:
+				resp.Body.Close()
+			}
+		}()
+	}
+	wg.Wait()
+	if paid, rejected := api.paid.Load(), exceeded.Load(); paid != 5 || rejected != 15 {
+		t.Errorf("paid %d and rejected %d requests, want 5 and 15 within a budget of 5 payments", paid, rejected)
+	}
+}
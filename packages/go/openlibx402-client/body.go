@@ -0,0 +1,157 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+)
+
+// PostReader executes a POST request with a streamed body and automatic payment handling.
+//
+// The body is sent without buffering. If payment is required it is replayed
+// for the retry: bodies accepted by http.NewRequest for replay
+// (*bytes.Buffer, *bytes.Reader, *strings.Reader) and io.Seeker bodies (such as
+// *os.File) are supported; other readers fail on a 402 without paying.
+// Use PostBody for bodies that can be reopened instead. The caller closes body.
+func (c *X402AutoClient) PostReader(ctx context.Context, url, contentType string, body io.Reader, opts ...RequestOption) (*http.Response, error) {
+	return c.sendReader(ctx, "POST", url, contentType, body, opts)
+}
+
+// PutReader executes a PUT request with a streamed body; see PostReader.
+func (c *X402AutoClient) PutReader(ctx context.Context, url, contentType string, body io.Reader, opts ...RequestOption) (*http.Response, error) {
+	return c.sendReader(ctx, "PUT", url, contentType, body, opts)
+}
+
+// PostBody executes a POST request whose body is opened by getBody, which is
+// called again to replay the body after payment (e.g. by reopening a file).
+func (c *X402AutoClient) PostBody(ctx context.Context, url, contentType string, getBody func() (io.ReadCloser, error), opts ...RequestOption) (*http.Response, error) {
+	return c.sendBody(ctx, "POST", url, contentType, getBody, opts)
+}
+
+// PutBody executes a PUT request whose body is opened by getBody; see PostBody.
+func (c *X402AutoClient) PutBody(ctx context.Context, url, contentType string, getBody func() (io.ReadCloser, error), opts ...RequestOption) (*http.Response, error) {
+	return c.sendBody(ctx, "PUT", url, contentType, getBody, opts)
+}
+
+// PostMultipart executes a multipart/form-data POST request with automatic payment handling.
+//
+// writeParts writes the form parts and is called once per attempt; the parts are
+// streamed through a pipe, so large files are not buffered in memory.
+//
+// Usage:
+//
+//	resp, err := client.PostMultipart(ctx, "https://api.example.com/transcribe", func(w *multipart.Writer) error {
+//	    part, err := w.CreateFormFile("audio", "meeting.wav")
+//	    if err != nil {
+//	        return err
+//	    }
+//	    f, err := os.Open("meeting.wav")
+//	    if err != nil {
+//	        return err
+//	    }
+//	    defer f.Close()
+//	    _, err = io.Copy(part, f)
+//	    return err
+//	})
+func (c *X402AutoClient) PostMultipart(ctx context.Context, url string, writeParts func(w *multipart.Writer) error, opts ...RequestOption) (*http.Response, error) {
+	return c.send(ctx, opts, func() (*http.Request, error) {
+		pr, pw := io.Pipe()
+		mw := multipart.NewWriter(pw)
+		req, err := http.NewRequest("POST", url, pr)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+
+		// The transport closes the pipe reader when it is done, which unblocks the writer
+		go func() {
+			err := writeParts(mw)
+			if err == nil {
+				err = mw.Close()
+			}
+			pw.CloseWithError(err)
+		}()
+		return req, nil
+	})
+}
+
+// sendReader sends a request with a reader body, replaying it after payment if possible.
+func (c *X402AutoClient) sendReader(ctx context.Context, method, url, contentType string, body io.Reader, opts []RequestOption) (*http.Response, error) {
+	var first *http.Request
+	var offset int64
+	seeker, isSeeker := body.(io.Seeker)
+	if isSeeker {
+		var err error
+		if offset, err = seeker.Seek(0, io.SeekCurrent); err != nil {
+			return nil, fmt.Errorf("failed to read body offset: %w", err)
+		}
+	}
+
+	return c.send(ctx, opts, func() (*http.Request, error) {
+		if first == nil {
+			// Keep the transport from closing seekable files so they can be replayed
+			reqBody := body
+			_, isCloser := body.(io.Closer)
+			keepOpen := isSeeker && isCloser
+			if keepOpen {
+				reqBody = io.NopCloser(body)
+			}
+			req, err := http.NewRequest(method, url, reqBody)
+			if err != nil {
+				return nil, err
+			}
+			if keepOpen {
+				end, err := seeker.Seek(0, io.SeekEnd)
+				if err == nil {
+					_, err = seeker.Seek(offset, io.SeekStart)
+				}
+				if err != nil {
+					return nil, fmt.Errorf("failed to read body length: %w", err)
+				}
+				req.ContentLength = end - offset
+			}
+			req.Header.Set("Content-Type", contentType)
+			first = req
+			return req, nil
+		}
+
+		// Replay the body for the retry with payment
+		req := first.Clone(first.Context())
+		switch {
+		case first.GetBody != nil:
+			replay, err := first.GetBody()
+			if err != nil {
+				return nil, fmt.Errorf("failed to replay request body: %w", err)
+			}
+			req.Body = replay
+		case isSeeker:
+			if _, err := seeker.Seek(offset, io.SeekStart); err != nil {
+				return nil, fmt.Errorf("failed to replay request body: %w", err)
+			}
+			req.Body = io.NopCloser(body)
+		default:
+			return nil, fmt.Errorf("payment required but the request body cannot be replayed: use an io.Seeker or PostBody")
+		}
+		return req, nil
+	})
+}
+
+// sendBody sends a request whose body is opened by getBody for every attempt.
+func (c *X402AutoClient) sendBody(ctx context.Context, method, url, contentType string, getBody func() (io.ReadCloser, error), opts []RequestOption) (*http.Response, error) {
+	return c.send(ctx, opts, func() (*http.Request, error) {
+		body, err := getBody()
+		if err != nil {
+			return nil, err
+		}
+		req, err := http.NewRequest(method, url, body)
+		if err != nil {
+			body.Close()
+			return nil, err
+		}
+		req.Header.Set("Content-Type", contentType)
+		req.GetBody = getBody
+		return req, nil
+	})
+}
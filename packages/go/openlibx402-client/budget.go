@@ -0,0 +1,117 @@
+package client
+
+import (
+	"fmt"
+	"math/big"
+	"net/url"
+	"time"
+
+	"github.com/openlibx402/go/openlibx402-core"
+)
+
+// budget holds the spending limits of an auto client. Empty limits are not enforced.
+type budget struct {
+	perHour   string
+	perDomain string
+	total     string
+}
+
+// enabled reports whether any limit is set.
+func (b budget) enabled() bool {
+	return b.perHour != "" || b.perDomain != "" || b.total != ""
+}
+
+// budgetLimit is a limit of a budget and the payments it counts.
+type budgetLimit struct {
+	name   string
+	limit  string
+	filter func(PaymentRecord) bool
+}
+
+// limits returns the limits that apply to payments to endpoint.
+func (b budget) limits(endpoint string) []budgetLimit {
+	hourAgo := time.Now().Add(-time.Hour)
+	domain := hostOf(endpoint)
+	return []budgetLimit{
+		{core.BudgetPerHour, b.perHour, func(r PaymentRecord) bool { return r.Timestamp.After(hourAgo) }},
+		{core.BudgetPerDomain, b.perDomain, func(r PaymentRecord) bool { return hostOf(r.Endpoint) == domain }},
+		{core.BudgetTotal, b.total, func(PaymentRecord) bool { return true }},
+	}
+}
+
+// check returns a *core.BudgetExceededError if paying amount to endpoint would
+// exceed a limit, given the payments recorded so far.
+func (b budget) check(records []PaymentRecord, endpoint, amount string) error {
+	requested, ok := new(big.Rat).SetString(amount)
+	if !ok {
+		return fmt.Errorf("invalid amount format: %s", amount)
+	}
+
+	for _, l := range b.limits(endpoint) {
+		if l.limit == "" {
+			continue
+		}
+		limit, ok := new(big.Rat).SetString(l.limit)
+		if !ok {
+			return fmt.Errorf("invalid %s budget: %s", l.name, l.limit)
+		}
+		spent := sumAmounts(records, l.filter)
+		total, _ := new(big.Rat).SetString(spent)
+		if total.Add(total, requested).Cmp(limit) > 0 {
+			return core.NewBudgetExceededError(l.name, l.limit, spent, amount)
+		}
+	}
+	return nil
+}
+
+// BudgetUsage is the spending of an auto client within one of its budgets.
+type BudgetUsage struct {
+	Budget    string `json:"budget"`    // core.BudgetPerHour, BudgetPerDomain, or BudgetTotal
+	Limit     string `json:"limit"`     // Configured limit
+	Spent     string `json:"spent"`     // Amount spent within the budget
+	Remaining string `json:"remaining"` // Amount left to spend, never negative
+}
+
+// BudgetStatus reports the spending of the client within the budgets it
+// was configured with (see AutoClientOptions.MaxSpendPerHour), for example
+// so that an agent can check what it can still afford. The per-domain
+// budget is reported for the host of endpoint, and omitted if endpoint is
+// "". Budgets that are not set are omitted.
+func (c *X402AutoClient) BudgetStatus(endpoint string) ([]BudgetUsage, error) {
+	records, err := c.client.PaymentHistory()
+	if err != nil {
+		return nil, err
+	}
+	var usage []BudgetUsage
+	for _, l := range c.budget.limits(endpoint) {
+		if l.limit == "" || (l.name == core.BudgetPerDomain && endpoint == "") {
+			continue
+		}
+		limit, ok := new(big.Rat).SetString(l.limit)
+		if !ok {
+			return nil, fmt.Errorf("invalid %s budget: %s", l.name, l.limit)
+		}
+		spent := sumAmounts(records, l.filter)
+		remaining, _ := new(big.Rat).SetString(spent)
+		remaining.Sub(limit, remaining)
+		if remaining.Sign() < 0 {
+			remaining.SetInt64(0)
+		}
+		usage = append(usage, BudgetUsage{Budget: l.name, Limit: l.limit, Spent: spent, Remaining: formatAmount(remaining)})
+	}
+	return usage, nil
+}
+
+// MaxPaymentAmount returns the limit of a single payment, or "" if the
+// client was configured without one.
+func (c *X402AutoClient) MaxPaymentAmount() string {
+	return c.maxPaymentAmount
+}
+
+// hostOf returns the host of a URL, or the string itself if it is not a URL.
+func hostOf(endpoint string) string {
+	if u, err := url.Parse(endpoint); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return endpoint
+}
@@ -0,0 +1,318 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/openlibx402/go/openlibx402-core"
+)
+
+// channelCloseTimeout bounds the requests closing payment channels.
+const channelCloseTimeout = 30 * time.Second
+
+// channelCache holds the payment channels opened by the auto client, by
+// payee (see channelPayee), and the prices of resources payable from them.
+type channelCache struct {
+	mu       sync.Mutex
+	channels map[string]*paymentChannel
+	prices   map[string]channelPrice // by resource (see sessionKey)
+}
+
+// paymentChannel is a channel opened with a server. spent counts every
+// voucher signed, including ones the server did not accept, so that the next
+// voucher always raises the amount the server recorded; accepted is the
+// highest amount the server accepted.
+type paymentChannel struct {
+	id       string
+	payer    string
+	deposit  *big.Rat
+	spent    *big.Rat
+	accepted *big.Rat
+	url      string // Last resource paid from the channel
+}
+
+// channelPrice is the price of a resource in the token of a channel or tab.
+type channelPrice struct {
+	payee  string
+	amount *big.Rat
+}
+
+func newChannelCache() *channelCache {
+	return &channelCache{
+		channels: make(map[string]*paymentChannel),
+		prices:   make(map[string]channelPrice),
+	}
+}
+
+// channelPayee identifies the channels of a server's payment address and token.
+func channelPayee(u *url.URL, paymentAddress, mint string) string {
+	return u.Scheme + "://" + u.Host + " " + paymentAddress + " " + mint
+}
+
+// learn records the price of a resource from its payment request.
+func (c *channelCache) learn(u *url.URL, paymentReq *core.PaymentRequest) {
+	amount, ok := new(big.Rat).SetString(paymentReq.MaxAmountRequired)
+	if !ok {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.prices[sessionKey(u)] = channelPrice{payee: channelPayee(u, paymentReq.PaymentAddress, paymentReq.AssetAddress), amount: amount}
+}
+
+// reserve adds the price of a resource to the amount spent from the channel
+// it is payable from, and returns the channel and the new amount, or nil if
+// the price is unknown or the balance too low.
+func (c *channelCache) reserve(u *url.URL) (*paymentChannel, *big.Rat) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	price, ok := c.prices[sessionKey(u)]
+	if !ok {
+		return nil, nil
+	}
+	channel := c.channels[price.payee]
+	if channel == nil {
+		return nil, nil
+	}
+	spent := new(big.Rat).Add(channel.spent, price.amount)
+	if spent.Cmp(channel.deposit) > 0 {
+		return nil, nil
+	}
+	channel.spent = spent
+	channel.url = u.String()
+	return channel, spent
+}
+
+// open records a channel opened by a deposit paying a resource, and returns
+// the channel it replaces, if any.
+func (c *channelCache) open(u *url.URL, authorization *core.PaymentAuthorization, id, balance string) *paymentChannel {
+	deposit, ok := new(big.Rat).SetString(authorization.ActualAmount)
+	left, ok2 := new(big.Rat).SetString(balance)
+	if !ok || !ok2 {
+		return nil
+	}
+	spent := new(big.Rat).Sub(deposit, left)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	payee := channelPayee(u, authorization.PaymentAddress, authorization.AssetAddress)
+	replaced := c.channels[payee]
+	c.channels[payee] = &paymentChannel{id: id, payer: authorization.PublicKey, deposit: deposit, spent: spent, accepted: spent, url: u.String()}
+	c.prices[sessionKey(u)] = channelPrice{payee: payee, amount: spent}
+	return replaced
+}
+
+// accept records a voucher the server accepted, dropping the channel once
+// the server reports its deposit spent.
+func (c *channelCache) accept(channel *paymentChannel, amount *big.Rat, resp *http.Response, balanceHeader string) {
+	c.mu.Lock()
+	if amount.Cmp(channel.accepted) > 0 {
+		channel.accepted = amount
+	}
+	c.mu.Unlock()
+	balance, ok := new(big.Rat).SetString(resp.Header.Get(balanceHeader))
+	if ok && balance.Sign() <= 0 {
+		c.forget(channel)
+	}
+}
+
+// forget drops a channel the server no longer accepts vouchers for.
+func (c *channelCache) forget(channel *paymentChannel) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for payee, open := range c.channels {
+		if open == channel {
+			delete(c.channels, payee)
+		}
+	}
+}
+
+// drain removes and returns every channel.
+func (c *channelCache) drain() []*paymentChannel {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	channels := make([]*paymentChannel, 0, len(c.channels))
+	for payee, channel := range c.channels {
+		channels = append(channels, channel)
+		delete(c.channels, payee)
+	}
+	return channels
+}
+
+// signVoucher signs a voucher with the wallet of the client that opened a
+// channel.
+func (c *X402Client) signVoucher(ctx context.Context, payer, channelID, amount string, close bool) (*core.Voucher, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.closed.Load() {
+		return nil, ErrClientClosed
+	}
+	signer := c.walletSigner(payer)
+	if signer == nil {
+		return nil, errors.New("the payer of the payment channel is not a wallet of the client")
+	}
+	return core.NewVoucher(ctx, signer, channelID, amount, close)
+}
+
+// attachVoucher sets a voucher paying for the request from an open channel,
+// if the client knows the resource's price and the channel's balance covers
+// it, and returns the channel and the voucher's amount.
+func (c *X402AutoClient) attachVoucher(ctx context.Context, req *http.Request) (*paymentChannel, *big.Rat) {
+	channel, amount := c.channels.reserve(req.URL)
+	if channel == nil {
+		return nil, nil
+	}
+	voucher, err := c.client.signVoucher(ctx, channel.payer, channel.id, formatAmount(amount), false)
+	if err != nil {
+		c.client.log().Warn("x402: failed to sign voucher", "url", req.URL.String(), "error", err)
+		return nil, nil
+	}
+	header, err := voucher.ToHeaderValue()
+	if err != nil {
+		return nil, nil
+	}
+	req.Header.Set(c.voucherHeader, header)
+	return channel, amount
+}
+
+// payFromChannel pays a 402 response with a voucher if the payment request
+// offers a channel and the client has one open with enough balance. It
+// returns the response to the paid request and true, or the 402 response,
+// with its body intact, and false if the request must be paid on-chain.
+func (c *X402AutoClient) payFromChannel(ctx context.Context, resp *http.Response, newRequest func() (*http.Request, error)) (*http.Response, bool, error) {
+	paymentReq, err := peekPaymentRequest(resp)
+	if err != nil {
+		return nil, false, err
+	}
+	if paymentReq == nil || paymentReq.Channel == nil {
+		return resp, false, nil
+	}
+
+	retry, err := newRequest()
+	if err != nil {
+		return nil, false, err
+	}
+	c.channels.learn(retry.URL, paymentReq)
+	channel, amount := c.attachVoucher(ctx, retry)
+	if channel == nil {
+		if retry.Body != nil {
+			retry.Body.Close()
+		}
+		return resp, false, nil
+	}
+	paid, err := c.client.Do(ctx, retry, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	if c.client.PaymentRequired(paid) {
+		// The channel was closed or expired: open a new one
+		c.channels.forget(channel)
+		return paid, false, nil
+	}
+	c.channels.accept(channel, amount, paid, c.channelBalanceHeader)
+	return paid, true, nil
+}
+
+// peekPaymentRequest parses the payment request of a 402 response, leaving
+// its body to be read again. It returns nil if the payment request is
+// invalid, and an error only if the body cannot be read.
+func peekPaymentRequest(resp *http.Response) (*core.PaymentRequest, error) {
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	parsed := *resp
+	parsed.Body = io.NopCloser(bytes.NewReader(body))
+	paymentReq, err := PaymentRequestFromResponse(&parsed)
+	if err != nil {
+		return nil, nil
+	}
+	return paymentReq, nil
+}
+
+// openChannel records the channel a deposit opened, if the server opened
+// one, and closes the channel it replaces in the background, so that its
+// balance is refunded.
+func (c *X402AutoClient) openChannel(resp *http.Response, u *url.URL, authorization *core.PaymentAuthorization) {
+	id := resp.Header.Get(c.channelHeader)
+	if id == "" {
+		return
+	}
+	replaced := c.channels.open(u, authorization, id, resp.Header.Get(c.channelBalanceHeader))
+	if replaced == nil {
+		return
+	}
+	c.settling.Add(1)
+	go func() {
+		defer c.settling.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), channelCloseTimeout)
+		defer cancel()
+		if err := c.closeChannel(ctx, replaced); err != nil {
+			c.client.log().Warn("x402: failed to close payment channel", "url", replaced.url, "error", err)
+		}
+	}()
+}
+
+// channelDeposit returns the payment request with the channel deposit as
+// its amount, if it offers a channel in its token.
+func channelDeposit(paymentReq *core.PaymentRequest, mint string) *core.PaymentRequest {
+	if paymentReq.Channel == nil || mint != paymentReq.AssetAddress || core.CompareAmounts(paymentReq.Channel.Deposit, paymentReq.MaxAmountRequired) <= 0 {
+		return paymentReq
+	}
+	deposit := *paymentReq
+	deposit.MaxAmountRequired = paymentReq.Channel.Deposit
+	return &deposit
+}
+
+// CloseChannels closes the payment channels the client opened, so that
+// servers refund their unspent deposits without waiting for them to
+// expire. Each channel is closed with a voucher sent to the last resource
+// paid from it, which does not pay for that resource again. It returns the
+// last error, if any.
+//
+// Close closes the channels too.
+func (c *X402AutoClient) CloseChannels(ctx context.Context) error {
+	if c.channels == nil {
+		return nil
+	}
+	var lastErr error
+	for _, channel := range c.channels.drain() {
+		if err := c.closeChannel(ctx, channel); err != nil {
+			c.client.log().Warn("x402: failed to close payment channel", "url", channel.url, "error", err)
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+// closeChannel sends the voucher closing a channel.
+func (c *X402AutoClient) closeChannel(ctx context.Context, channel *paymentChannel) error {
+	voucher, err := c.client.signVoucher(ctx, channel.payer, channel.id, formatAmount(channel.accepted), true)
+	if err != nil {
+		return err
+	}
+	header, err := voucher.ToHeaderValue()
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("GET", channel.url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set(c.voucherHeader, header)
+	resp, err := c.client.Do(ctx, req, nil)
+	if err != nil {
+		return err
+	}
+	// The server answers with a payment request for the resource
+	resp.Body.Close()
+	return nil
+}
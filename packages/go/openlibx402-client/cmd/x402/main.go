@@ -0,0 +1,139 @@
+// Command x402 is a command-line client for X402 APIs, for debugging servers
+// and for paying for APIs from shell scripts.
+//
+// Usage:
+//
+//	x402 call [flags] URL   Request a URL and show what it costs, without paying
+//	x402 pay [flags] URL    Request a URL, paying if it requires payment
+//	x402 wallet balance     Show the SOL and USDC balance of a wallet
+//	x402 wallet fund        Airdrop devnet or testnet SOL to a wallet
+//	x402 wallet new         Create a wallet file, optionally an encrypted keystore
+//
+// The response body is written to stdout and payment details to stderr. The
+// exit status is 0 for a successful response, 1 for an error or an HTTP error
+// status, and 2 if payment is required but was not made.
+//
+// Examples:
+//
+//	x402 call https://api.example.com/premium-data
+//	x402 pay -max 0.50 -yes https://api.example.com/premium-data | jq .
+//	x402 pay -X POST -d @job.json -H "Content-Type: application/json" https://api.example.com/jobs
+//	x402 wallet new -keystore -out payer.keystore.json
+//
+// Payments are signed with the wallet in -wallet, X402_WALLET, or the Solana
+// CLI default ~/.config/solana/id.json (see wallet.LoadFromFile).
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/openlibx402/go/openlibx402-core/wallet"
+)
+
+// walletEnv is the environment variable naming the default wallet file.
+const walletEnv = "X402_WALLET"
+
+// Exit statuses.
+const (
+	exitError           = 1
+	exitPaymentRequired = 2
+)
+
+// errExit carries an exit status out of a command that already reported why.
+type errExit int
+
+func (e errExit) Error() string {
+	return fmt.Sprintf("exit status %d", int(e))
+}
+
+const usage = `x402 is a command-line client for X402 APIs.
+
+Usage:
+
+	x402 call [flags] URL   Request a URL and show what it costs, without paying
+	x402 pay [flags] URL    Request a URL, paying if it requires payment
+	x402 wallet <command>   Show balances, fund, and create wallets
+
+Run "x402 <command> -h" for the flags of a command.
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(exitError)
+	}
+
+	var err error
+	switch command, args := os.Args[1], os.Args[2:]; command {
+	case "call":
+		err = runRequest(command, args, false)
+	case "pay":
+		err = runRequest(command, args, true)
+	case "wallet":
+		err = runWallet(args)
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(os.Stdout, usage)
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "x402: unknown command %q\n\n%s", command, usage)
+		os.Exit(exitError)
+	}
+
+	var exit errExit
+	switch {
+	case errors.As(err, &exit):
+		os.Exit(int(exit))
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "x402: %v\n", err)
+		os.Exit(exitError)
+	}
+}
+
+// walletPath returns the wallet file to use: the flag value, X402_WALLET, or
+// the Solana CLI default keypair.
+func walletPath(flagValue string) string {
+	if flagValue != "" {
+		return flagValue
+	}
+	if path := os.Getenv(walletEnv); path != "" {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".config", "solana", "id.json")
+}
+
+// loadWallet loads the keypair of the wallet file.
+func loadWallet(flagValue string) (solana.PrivateKey, error) {
+	path := walletPath(flagValue)
+	if path == "" {
+		return nil, fmt.Errorf("no wallet: pass -wallet or set %s", walletEnv)
+	}
+	key, err := wallet.LoadFromFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load wallet %s: %w", path, err)
+	}
+	return key, nil
+}
+
+// headerFlags collects repeated -H flags.
+type headerFlags []string
+
+func (h *headerFlags) String() string {
+	return strings.Join(*h, ", ")
+}
+
+func (h *headerFlags) Set(value string) error {
+	if !strings.Contains(value, ":") {
+		return fmt.Errorf("header %q must have the form \"Name: value\"", value)
+	}
+	*h = append(*h, value)
+	return nil
+}
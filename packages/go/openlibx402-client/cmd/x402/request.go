@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/openlibx402/go/openlibx402-client"
+	"github.com/openlibx402/go/openlibx402-core"
+)
+
+// requestFlags are the flags of the call and pay commands.
+type requestFlags struct {
+	method  string
+	data    string
+	headers headerFlags
+	include bool
+	timeout time.Duration
+
+	// pay only
+	wallet string
+	rpcURL string
+	max    string
+	yes    bool
+}
+
+// runRequest runs the call command, or the pay command if pay is set.
+func runRequest(command string, args []string, pay bool) error {
+	var f requestFlags
+	fs := flag.NewFlagSet(command, flag.ContinueOnError)
+	fs.StringVar(&f.method, "X", "", "HTTP method (default: GET, or POST with -d)")
+	fs.StringVar(&f.data, "d", "", "request body; @file reads a file and @- reads stdin")
+	fs.Var(&f.headers, "H", "request header \"Name: value\" (repeatable)")
+	fs.BoolVar(&f.include, "i", false, "write the response status and headers before the body")
+	fs.DurationVar(&f.timeout, "timeout", 2*time.Minute, "timeout of the whole command, including payment")
+	if pay {
+		fs.StringVar(&f.wallet, "wallet", "", "wallet file (default: $"+walletEnv+" or ~/.config/solana/id.json)")
+		fs.StringVar(&f.rpcURL, "rpc", "", "Solana RPC URL (default: the public endpoint of the requested network)")
+		fs.StringVar(&f.max, "max", "", "refuse to pay more than this amount")
+		fs.BoolVar(&f.yes, "yes", false, "pay without asking for confirmation")
+	}
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: x402 %s [flags] URL\n\nFlags:\n", command)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return nil
+		}
+		return errExit(exitError)
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errExit(exitError)
+	}
+	url := fs.Arg(0)
+
+	body, err := readBody(f.data)
+	if err != nil {
+		return err
+	}
+	if f.method == "" {
+		f.method = http.MethodGet
+		if body != nil {
+			f.method = http.MethodPost
+		}
+	}
+	newRequest := func(ctx context.Context) (*http.Request, error) {
+		var reader io.Reader
+		if body != nil {
+			reader = bytes.NewReader(body)
+		}
+		req, err := http.NewRequestWithContext(ctx, f.method, url, reader)
+		if err != nil {
+			return nil, err
+		}
+		for _, header := range f.headers {
+			name, value, _ := strings.Cut(header, ":")
+			req.Header.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+		}
+		return req, nil
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+	ctx, cancel = context.WithTimeout(ctx, f.timeout)
+	defer cancel()
+
+	req, err := newRequest(ctx)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { resp.Body.Close() }()
+
+	if resp.StatusCode == http.StatusPaymentRequired {
+		paymentReq, err := client.PaymentRequestFromResponse(resp)
+		if err != nil {
+			return err
+		}
+		printPaymentRequest(paymentReq)
+		if !pay {
+			return errExit(exitPaymentRequired)
+		}
+
+		paid, err := payAndRetry(ctx, &f, paymentReq, newRequest)
+		if err != nil {
+			return err
+		}
+		resp = paid
+	}
+	return writeResponse(resp, f.include)
+}
+
+// payAndRetry pays a payment request and retries the request with the
+// authorization.
+func payAndRetry(
+	ctx context.Context,
+	f *requestFlags,
+	paymentReq *core.PaymentRequest,
+	newRequest func(ctx context.Context) (*http.Request, error),
+) (*http.Response, error) {
+	if paymentReq.IsExpired() {
+		return nil, core.NewPaymentExpiredError(paymentReq, "")
+	}
+	if f.max != "" && core.CompareAmounts(paymentReq.MaxAmountRequired, f.max) > 0 {
+		return nil, core.NewBudgetExceededError(core.BudgetPerPayment, f.max, "0", paymentReq.MaxAmountRequired)
+	}
+	if !f.yes {
+		approved, err := confirm(fmt.Sprintf("Pay %s to %s? [y/N] ", paymentReq.MaxAmountRequired, paymentReq.PaymentAddress))
+		if err != nil {
+			return nil, err
+		}
+		if !approved {
+			return nil, client.ErrPaymentNotApproved
+		}
+	}
+
+	key, err := loadWallet(f.wallet)
+	if err != nil {
+		return nil, err
+	}
+	rpcURL := f.rpcURL
+	if rpcURL == "" {
+		rpcURL = core.GetDefaultRPCURL(paymentReq.Network)
+	}
+	// The user chose the URL, so local servers are allowed
+	x402Client := client.NewX402Client(key, rpcURL, nil, true)
+	defer x402Client.Close()
+
+	auth, err := x402Client.CreatePayment(ctx, paymentReq, "")
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(os.Stderr, "Paid %s from %s (transaction %s)\n", auth.ActualAmount, auth.PublicKey, auth.TransactionHash)
+
+	req, err := newRequest(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return x402Client.Do(ctx, req, auth)
+}
+
+// printPaymentRequest describes a payment request on stderr.
+func printPaymentRequest(paymentReq *core.PaymentRequest) {
+	fmt.Fprintln(os.Stderr, "Payment required:")
+	fmt.Fprintf(os.Stderr, "  Amount:      %s\n", paymentReq.MaxAmountRequired)
+	if paymentReq.Description != "" {
+		fmt.Fprintf(os.Stderr, "  Description: %s\n", paymentReq.Description)
+	}
+	fmt.Fprintf(os.Stderr, "  Resource:    %s\n", paymentReq.Resource)
+	fmt.Fprintf(os.Stderr, "  Network:     %s\n", paymentReq.Network)
+	fmt.Fprintf(os.Stderr, "  Token:       %s\n", paymentReq.AssetAddress)
+	fmt.Fprintf(os.Stderr, "  Pay to:      %s\n", paymentReq.PaymentAddress)
+	fmt.Fprintf(os.Stderr, "  Payment ID:  %s\n", paymentReq.PaymentID)
+	fmt.Fprintf(os.Stderr, "  Expires:     %s\n", paymentReq.ExpiresAt.Local().Format(time.RFC1123))
+}
+
+// writeResponse writes the response to stdout, returning an error status for
+// HTTP error responses.
+func writeResponse(resp *http.Response, include bool) error {
+	if include {
+		header, err := httputil.DumpResponse(resp, false)
+		if err != nil {
+			return err
+		}
+		os.Stdout.Write(header)
+	}
+	if _, err := io.Copy(os.Stdout, resp.Body); err != nil {
+		return err
+	}
+	switch {
+	case resp.StatusCode == http.StatusPaymentRequired:
+		fmt.Fprintf(os.Stderr, "x402: payment was not accepted (%s)\n", resp.Status)
+		return errExit(exitPaymentRequired)
+	case resp.StatusCode >= 400:
+		fmt.Fprintf(os.Stderr, "x402: %s\n", resp.Status)
+		return errExit(exitError)
+	}
+	return nil
+}
+
+// readBody returns the request body of the -d flag: the value itself, or the
+// contents of a file (@path) or stdin (@-).
+func readBody(data string) ([]byte, error) {
+	switch {
+	case data == "":
+		return nil, nil
+	case data == "@-":
+		return io.ReadAll(os.Stdin)
+	case strings.HasPrefix(data, "@"):
+		return os.ReadFile(data[1:])
+	}
+	return []byte(data), nil
+}
+
+// confirm asks a yes/no question on the terminal.
+func confirm(question string) (bool, error) {
+	tty, err := os.Open("/dev/tty")
+	if err != nil {
+		return false, fmt.Errorf("cannot ask for confirmation without a terminal; pass -yes to pay anyway")
+	}
+	defer tty.Close()
+
+	fmt.Fprint(os.Stderr, question)
+	answer, err := bufio.NewReader(tty).ReadString('\n')
+	if err != nil {
+		return false, err
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
+}
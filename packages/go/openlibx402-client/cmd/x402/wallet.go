@@ -0,0 +1,286 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/openlibx402/go/openlibx402-core"
+	"github.com/openlibx402/go/openlibx402-core/wallet"
+)
+
+// usdcFaucet is where to get devnet USDC, which has no programmatic faucet.
+const usdcFaucet = "https://faucet.circle.com"
+
+const walletUsage = `Usage:
+
+	x402 wallet balance [flags]   Show the SOL and token balance of a wallet
+	x402 wallet fund [flags]      Airdrop devnet or testnet SOL to a wallet
+	x402 wallet new [flags]       Create a wallet file
+
+Run "x402 wallet <command> -h" for the flags of a command.
+`
+
+// runWallet runs a wallet subcommand.
+func runWallet(args []string) error {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, walletUsage)
+		return errExit(exitError)
+	}
+	switch command, args := args[0], args[1:]; command {
+	case "balance":
+		return runWalletBalance(args)
+	case "fund":
+		return runWalletFund(args)
+	case "new":
+		return runWalletNew(args)
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(os.Stdout, walletUsage)
+		return nil
+	default:
+		fmt.Fprintf(os.Stderr, "x402: unknown wallet command %q\n\n%s", command, walletUsage)
+		return errExit(exitError)
+	}
+}
+
+// networkFlags are the flags selecting a wallet and network.
+type networkFlags struct {
+	wallet  string
+	address string
+	network string
+	rpcURL  string
+}
+
+func (f *networkFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.wallet, "wallet", "", "wallet file (default: $"+walletEnv+" or ~/.config/solana/id.json)")
+	fs.StringVar(&f.address, "address", "", "public key to use instead of loading a wallet")
+	fs.StringVar(&f.network, "network", "solana-devnet", "network: solana-devnet, solana-testnet, or solana-mainnet")
+	fs.StringVar(&f.rpcURL, "rpc", "", "Solana RPC URL (default: the public endpoint of the network)")
+}
+
+// publicKey returns -address, or the public key of the wallet.
+func (f *networkFlags) publicKey() (solana.PublicKey, error) {
+	if f.address != "" {
+		return solana.PublicKeyFromBase58(f.address)
+	}
+	key, err := loadWallet(f.wallet)
+	if err != nil {
+		return solana.PublicKey{}, err
+	}
+	defer zeroKey(key)
+	return key.PublicKey(), nil
+}
+
+func (f *networkFlags) endpoint() string {
+	if f.rpcURL != "" {
+		return f.rpcURL
+	}
+	return core.GetDefaultRPCURL(f.network)
+}
+
+// parseWalletFlags parses the flags of a wallet subcommand, which take no
+// arguments.
+func parseWalletFlags(fs *flag.FlagSet, args []string) error {
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: x402 wallet %s [flags]\n\nFlags:\n", fs.Name())
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return errExit(0)
+		}
+		return errExit(exitError)
+	}
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return errExit(exitError)
+	}
+	return nil
+}
+
+// runWalletBalance prints the SOL and token balance of a wallet.
+func runWalletBalance(args []string) error {
+	var f networkFlags
+	var token string
+	fs := flag.NewFlagSet("balance", flag.ContinueOnError)
+	f.register(fs)
+	fs.StringVar(&token, "token", "", "token mint (default: USDC of the network)")
+	if err := parseWalletFlags(fs, args); err != nil {
+		return err
+	}
+	if token == "" {
+		token = core.USDC(f.network)
+	}
+	owner, err := f.publicKey()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	client := rpc.New(f.endpoint())
+	defer client.Close()
+	sol, err := client.GetBalance(ctx, owner, rpc.CommitmentConfirmed)
+	if err != nil {
+		return fmt.Errorf("failed to get SOL balance: %w", err)
+	}
+
+	fmt.Printf("Address: %s\n", owner)
+	fmt.Printf("SOL:     %.9f\n", float64(sol.Value)/float64(solana.LAMPORTS_PER_SOL))
+	if token != "" {
+		processor := core.NewSolanaPaymentProcessor(f.endpoint(), nil)
+		defer processor.Close()
+		balance, err := processor.GetTokenBalance(ctx, owner.String(), token)
+		if err != nil {
+			return fmt.Errorf("failed to get token balance: %w", err)
+		}
+		fmt.Printf("Token:   %f (%s)\n", balance, token)
+	}
+	return nil
+}
+
+// runWalletFund airdrops SOL to a wallet on devnet or testnet.
+func runWalletFund(args []string) error {
+	var f networkFlags
+	var amount float64
+	fs := flag.NewFlagSet("fund", flag.ContinueOnError)
+	f.register(fs)
+	fs.Float64Var(&amount, "sol", 1, "SOL to airdrop")
+	if err := parseWalletFlags(fs, args); err != nil {
+		return err
+	}
+	if f.network == "solana-mainnet" {
+		return errors.New("airdrops are only available on solana-devnet and solana-testnet")
+	}
+	owner, err := f.publicKey()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	client := rpc.New(f.endpoint())
+	defer client.Close()
+	lamports := uint64(amount * float64(solana.LAMPORTS_PER_SOL))
+	signature, err := client.RequestAirdrop(ctx, owner, lamports, rpc.CommitmentConfirmed)
+	if err != nil {
+		return fmt.Errorf("airdrop failed (public faucets are rate limited; try a smaller -sol or later): %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "Requested %g SOL for %s (transaction %s), waiting for confirmation...\n", amount, owner, signature)
+
+	processor := core.NewSolanaPaymentProcessor(f.endpoint(), nil)
+	defer processor.Close()
+	if err := processor.WaitForConfirmation(ctx, signature.String(), core.CommitmentConfirmed); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Airdrop confirmed.\n")
+	if f.network == "solana-devnet" {
+		fmt.Fprintf(os.Stderr, "Get devnet USDC for %s at %s\n", owner, usdcFaucet)
+	}
+	return nil
+}
+
+// runWalletNew creates a wallet file with a new keypair.
+func runWalletNew(args []string) error {
+	var out string
+	var keystore, force bool
+	fs := flag.NewFlagSet("new", flag.ContinueOnError)
+	fs.StringVar(&out, "out", "", "wallet file to create (default: $"+walletEnv+" or ~/.config/solana/id.json)")
+	fs.BoolVar(&keystore, "keystore", false, "encrypt the keypair with a passphrase ($"+wallet.PassphraseEnv+" or prompted)")
+	fs.BoolVar(&force, "force", false, "overwrite an existing file")
+	if err := parseWalletFlags(fs, args); err != nil {
+		return err
+	}
+	path := walletPath(out)
+	if path == "" {
+		return fmt.Errorf("no wallet file: pass -out or set %s", walletEnv)
+	}
+	if _, err := os.Stat(path); err == nil && !force {
+		return fmt.Errorf("%s already exists; pass -force to overwrite it", path)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+
+	key, err := solana.NewRandomPrivateKey()
+	if err != nil {
+		return err
+	}
+	defer zeroKey(key)
+
+	if keystore {
+		passphrase, err := newPassphrase()
+		if err != nil {
+			return err
+		}
+		defer zeroKey(passphrase)
+		if err := wallet.SaveKeystore(path, key, passphrase); err != nil {
+			return err
+		}
+	} else if err := saveKeypairFile(path, key); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Created %s\n", path)
+	fmt.Println(key.PublicKey())
+	return nil
+}
+
+// newPassphrase returns the keystore passphrase from the environment, or
+// prompts for it twice.
+func newPassphrase() ([]byte, error) {
+	if passphrase := os.Getenv(wallet.PassphraseEnv); passphrase != "" {
+		return []byte(passphrase), nil
+	}
+	passphrase, err := wallet.PromptPassphrase("New wallet passphrase: ")
+	if err != nil {
+		return nil, err
+	}
+	again, err := wallet.PromptPassphrase("Repeat passphrase: ")
+	if err != nil {
+		return nil, err
+	}
+	defer zeroKey(again)
+	if len(passphrase) == 0 || !bytes.Equal(passphrase, again) {
+		zeroKey(passphrase)
+		return nil, errors.New("passphrases are empty or do not match")
+	}
+	return passphrase, nil
+}
+
+// saveKeypairFile writes a keypair in the Solana CLI format, a JSON array of
+// the secret key bytes, readable only by the owner.
+func saveKeypairFile(path string, key solana.PrivateKey) error {
+	ints := make([]int, len(key))
+	for i, b := range key {
+		ints[i] = int(b)
+	}
+	data, err := json.Marshal(ints)
+	for i := range ints {
+		ints[i] = 0
+	}
+	if err != nil {
+		return err
+	}
+	defer zeroKey(data)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return err
+	}
+	// WriteFile keeps the mode of a file it overwrites
+	return os.Chmod(path, 0o600)
+}
+
+// zeroKey overwrites key material.
+func zeroKey(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
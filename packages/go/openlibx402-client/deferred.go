@@ -0,0 +1,68 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/openlibx402/go/openlibx402-core"
+)
+
+// payDeferred pays a deferred payment request in the background and sends
+// the authorization to the URL it was served for.
+func (c *X402AutoClient) payDeferred(method, url, header string) {
+	paymentReq, err := core.PaymentRequestFromHeader(header)
+	if err != nil {
+		c.client.log().Warn("x402: invalid deferred payment request", "url", url, "error", err)
+		c.deferredDone(nil, nil, err)
+		return
+	}
+	c.client.log().Info("x402: payment deferred by server", "url", url, "request", paymentReq)
+
+	c.settling.Add(1)
+	go func() {
+		defer c.settling.Done()
+		// The server stops accepting the payment when the request expires
+		ctx, cancel := context.WithDeadline(context.Background(), paymentReq.ExpiresAt)
+		defer cancel()
+		authorization, err := c.settleDeferred(ctx, method, url, paymentReq)
+		if err != nil {
+			c.client.log().Warn("x402: deferred payment failed", "url", url, "request", paymentReq, "error", err)
+		} else {
+			c.client.log().Info("x402: deferred payment settled", "url", url, core.LogKeyTxHash, authorization.TransactionHash)
+		}
+		c.deferredDone(paymentReq, authorization, err)
+	}()
+}
+
+// settleDeferred pays a deferred payment request and sends the authorization
+// to url, which responds 204 once the server accepts it.
+func (c *X402AutoClient) settleDeferred(ctx context.Context, method, url string, paymentReq *core.PaymentRequest) (*core.PaymentAuthorization, error) {
+	authorization, err := c.checkAndPay(ctx, paymentReq, url)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		return authorization, err
+	}
+	resp, err := c.client.Do(ctx, req, authorization)
+	if err != nil {
+		return authorization, err
+	}
+	defer resp.Body.Close()
+	if err := rejectionError(resp); err != nil {
+		return authorization, err
+	}
+	if resp.StatusCode != http.StatusNoContent {
+		return authorization, fmt.Errorf("deferred payment not accepted: unexpected status %s", resp.Status)
+	}
+	return authorization, nil
+}
+
+// deferredDone reports the outcome of a deferred payment to OnDeferredPayment.
+func (c *X402AutoClient) deferredDone(paymentReq *core.PaymentRequest, authorization *core.PaymentAuthorization, err error) {
+	if c.onDeferredPayment != nil {
+		c.onDeferredPayment(paymentReq, authorization, err)
+	}
+}
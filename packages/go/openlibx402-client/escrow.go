@@ -0,0 +1,94 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/openlibx402/go/openlibx402-core"
+)
+
+// escrowReleaseTimeout bounds the release of an escrow deposit after a response.
+const escrowReleaseTimeout = 30 * time.Second
+
+// ReleaseEscrow releases the escrow deposit made by authorization for a
+// payment request with escrow terms to the payment address, once its
+// response was delivered, and returns the transaction hash. The client's
+// processor must be a core.EscrowProcessor, such as that of the
+// openlibx402-escrow module, and its wallet must be the payer.
+//
+// Auto clients release deposits themselves once the body of a successful
+// paid response has been read or closed.
+func (c *X402Client) ReleaseEscrow(ctx context.Context, request *core.PaymentRequest, authorization *core.PaymentAuthorization) (string, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.closed.Load() {
+		return "", ErrClientClosed
+	}
+	processor, ok := c.processor.(core.EscrowProcessor)
+	if !ok {
+		return "", errors.New("escrow payments require a core.EscrowProcessor")
+	}
+	signer := c.walletSigner(authorization.PublicKey)
+	if signer == nil {
+		return "", errors.New("the payer of the escrow deposit is not a wallet of the client")
+	}
+
+	txHash, err := processor.ReleaseEscrow(ctx, request, signer)
+	if err != nil {
+		c.logger.Warn("x402: escrow release failed", "request", request, "error", err)
+		return "", err
+	}
+	c.logger.Info("x402: escrow released", "request", request, core.LogKeyTxHash, txHash)
+	return txHash, nil
+}
+
+// releaseOnDelivery releases the escrow deposit paying a successful
+// response once its body has been read to the end or closed. Failed
+// responses are not released, so that the payer can reclaim the deposit.
+func (c *X402AutoClient) releaseOnDelivery(resp *http.Response, request *core.PaymentRequest, authorization *core.PaymentAuthorization) {
+	if request == nil || request.Escrow == nil || resp.StatusCode >= http.StatusMultipleChoices {
+		return
+	}
+	if _, ok := c.client.processor.(core.EscrowProcessor); !ok {
+		// The payment was a plain transfer
+		return
+	}
+	resp.Body = &escrowBody{ReadCloser: resp.Body, release: func() {
+		// The request context may be done once the body is read
+		ctx, cancel := context.WithTimeout(context.Background(), escrowReleaseTimeout)
+		defer cancel()
+		c.client.ReleaseEscrow(ctx, request, authorization)
+	}}
+}
+
+// escrowBody releases an escrow deposit once the response body has been read
+// to the end or closed, unless reading it failed.
+type escrowBody struct {
+	io.ReadCloser
+	release func()
+	once    sync.Once
+	failed  bool
+}
+
+func (b *escrowBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	switch {
+	case err == io.EOF:
+		b.once.Do(b.release)
+	case err != nil:
+		b.failed = true
+	}
+	return n, err
+}
+
+func (b *escrowBody) Close() error {
+	err := b.ReadCloser.Close()
+	if !b.failed {
+		b.once.Do(b.release)
+	}
+	return err
+}
@@ -8,12 +8,18 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"math"
+	"mime"
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/gagliardetto/solana-go"
 	"github.com/openlibx402/go/openlibx402-core"
@@ -23,12 +29,27 @@ import (
 //
 // With explicit mode, the developer manually checks for 402 responses,
 // creates payments, and retries requests with payment authorization.
+//
+// An X402Client is safe for concurrent use. Payments run concurrently; the
+// setters wait for payments in progress and apply to later ones, and Close
+// waits for payments in progress before clearing the key.
 type X402Client struct {
+	// mu guards the fields below closed. Payments hold it for reading
+	// throughout, so that settings and key material do not change under them.
+	mu sync.RWMutex
+
 	walletKeypair *solana.PrivateKey
+	signer        core.Signer
+	wallets       *WalletPool
 	httpClient    *http.Client
-	processor     *core.SolanaPaymentProcessor
+	processor     core.PaymentProcessor
 	allowLocal    bool
-	closed        bool
+	closed        atomic.Bool
+
+	authorizationHeader string
+	logger              *slog.Logger
+	history             PaymentHistoryStore
+	confirmation        core.Commitment
 }
 
 // NewX402Client creates a new explicit X402 client.
@@ -78,6 +99,20 @@ func NewX402Client(
 	rpcURL string,
 	httpClient *http.Client,
 	allowLocal bool,
+) *X402Client {
+	client := NewX402ClientWithSigner(core.NewKeypairSigner(walletKeypair), rpcURL, httpClient, allowLocal)
+	client.walletKeypair = &walletKeypair
+	return client
+}
+
+// NewX402ClientWithSigner creates an explicit X402 client that signs payments
+// with signer, e.g. a core.RemoteSigner, so the private key does not have to
+// be held by the client.
+func NewX402ClientWithSigner(
+	signer core.Signer,
+	rpcURL string,
+	httpClient *http.Client,
+	allowLocal bool,
 ) *X402Client {
 	if rpcURL == "" {
 		rpcURL = "https://api.devnet.solana.com"
@@ -87,32 +122,173 @@ func NewX402Client(
 		httpClient = &http.Client{}
 	}
 
-	processor := core.NewSolanaPaymentProcessor(rpcURL, &walletKeypair)
+	processor := core.NewSolanaPaymentProcessor(rpcURL, nil)
 
 	return &X402Client{
-		walletKeypair: &walletKeypair,
-		httpClient:    httpClient,
-		processor:     processor,
-		allowLocal:    allowLocal,
-		closed:        false,
+		signer:     signer,
+		httpClient: httpClient,
+		processor:  processor,
+		allowLocal: allowLocal,
+
+		authorizationHeader: core.DefaultAuthorizationHeader,
+		logger:              core.LoggerOrDiscard(nil),
+		history:             NewMemoryPaymentHistory(),
+	}
+}
+
+// SetLogger sets the logger for payment activity (nil disables logging).
+func (c *X402Client) SetLogger(logger *slog.Logger) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.logger = core.LoggerOrDiscard(logger)
+	if sp, ok := c.processor.(*core.SolanaPaymentProcessor); ok {
+		sp.SetLogger(logger)
+	}
+}
+
+// SetRetryPolicy sets the retry policy for transient RPC failures when sending payments.
+func (c *X402Client) SetRetryPolicy(policy core.RetryPolicy) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if sp, ok := c.processor.(*core.SolanaPaymentProcessor); ok {
+		sp.SetRetryPolicy(policy)
+	}
+}
+
+// SetComputeBudget sets the priority fee and compute unit limit of payments.
+// Use core.WithComputeBudget to override it for a single payment.
+func (c *X402Client) SetComputeBudget(budget core.ComputeBudget) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if sp, ok := c.processor.(*core.SolanaPaymentProcessor); ok {
+		sp.SetComputeBudget(budget)
+	}
+}
+
+// SetConfirmation makes CreatePayment wait until the payment transaction
+// reaches commitment before returning the authorization, so the server can
+// verify it on the first attempt (default: "", don't wait). wsURL optionally
+// sets the RPC node's WebSocket endpoint to subscribe to the signature
+// instead of polling.
+func (c *X402Client) SetConfirmation(commitment core.Commitment, wsURL string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.confirmation = commitment
+	if sp, ok := c.processor.(*core.SolanaPaymentProcessor); ok {
+		sp.SetWebSocketURL(wsURL)
+	}
+}
+
+// SetProcessor replaces the processor payments are made with, e.g. with a
+// core.MockProcessor in unit tests, and closes the previous one. The client
+// closes processor on Close. The logger, retry policy, compute budget, and
+// WebSocket URL settings only apply to a *core.SolanaPaymentProcessor, and
+// must be set after replacing it.
+func (c *X402Client) SetProcessor(processor core.PaymentProcessor) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	previous := c.processor
+	c.processor = processor
+	previous.Close()
+}
+
+// SetAuthorizationHeader sets the header used to send payment authorizations
+// (default: X-Payment-Authorization). It must match the server's configured name.
+func (c *X402Client) SetAuthorizationHeader(name string) {
+	if name == "" {
+		name = core.DefaultAuthorizationHeader
 	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.authorizationHeader = name
+}
+
+// authHeader returns the header used to send payment authorizations.
+func (c *X402Client) authHeader() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.authorizationHeader
+}
+
+// log returns the client's logger.
+func (c *X402Client) log() *slog.Logger {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.logger
 }
 
 // Close closes the client and cleans up resources.
 //
 // IMPORTANT: Always call this method when done to properly cleanup
 // connections and attempt to clear sensitive data from memory.
+//
+// The bytes of the keypair passed to NewX402Client are overwritten with
+// zeros, so it must not be used after Close. This is best effort: the Go
+// runtime may have left copies of the key elsewhere in memory. Keys held by
+// signers and wallet pools are left to their owners.
+//
+// Close waits for payments in progress to finish; new ones fail.
 func (c *X402Client) Close() error {
-	if c.closed {
+	if !c.closed.CompareAndSwap(false, true) {
 		return nil
 	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
 	err := c.processor.Close()
+	if c.walletKeypair != nil {
+		zeroKey(*c.walletKeypair)
+	}
 	c.walletKeypair = nil
-	c.closed = true
+	c.signer = nil
+	c.wallets = nil
 	return err
 }
 
+// payer returns the public key payments are made from, or "" if the client
+// pays from a wallet pool or is closed.
+func (c *X402Client) payer() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.signer == nil || c.wallets != nil {
+		return ""
+	}
+	return c.signer.PublicKey().String()
+}
+
+// walletSigner returns the signer of the client's wallet with a public key,
+// or nil if it has none. c.mu must be held.
+func (c *X402Client) walletSigner(publicKey string) core.Signer {
+	signer := c.signer
+	if c.wallets != nil {
+		signer = c.wallets.signer(publicKey)
+	}
+	if signer == nil || signer.PublicKey().String() != publicKey {
+		return nil
+	}
+	return signer
+}
+
+// zeroKey overwrites a private key with zeros.
+func zeroKey(key solana.PrivateKey) {
+	for i := range key {
+		key[i] = 0
+	}
+}
+
+// NewX402ClientWithWalletPool creates an explicit X402 client that pays from
+// a pool of wallets, picking one per payment (see WalletPool).
+func NewX402ClientWithWalletPool(
+	pool *WalletPool,
+	rpcURL string,
+	httpClient *http.Client,
+	allowLocal bool,
+) *X402Client {
+	client := NewX402ClientWithSigner(nil, rpcURL, httpClient, allowLocal)
+	client.wallets = pool
+	return client
+}
+
 // validateURL performs basic URL validation to prevent SSRF attacks.
 func (c *X402Client) validateURL(urlStr string) error {
 	parsedURL, err := url.Parse(urlStr)
@@ -164,8 +340,8 @@ func (c *X402Client) validateURL(urlStr string) error {
 
 // Do executes an HTTP request with optional payment authorization.
 func (c *X402Client) Do(ctx context.Context, req *http.Request, payment *core.PaymentAuthorization) (*http.Response, error) {
-	if c.closed {
-		return nil, fmt.Errorf("client has been closed")
+	if c.closed.Load() {
+		return nil, ErrClientClosed
 	}
 
 	if err := c.validateURL(req.URL.String()); err != nil {
@@ -178,7 +354,7 @@ func (c *X402Client) Do(ctx context.Context, req *http.Request, payment *core.Pa
 		if err != nil {
 			return nil, fmt.Errorf("failed to encode payment authorization: %w", err)
 		}
-		req.Header.Set("X-Payment-Authorization", headerValue)
+		req.Header.Set(c.authHeader(), headerValue)
 	}
 
 	// Execute request
@@ -228,9 +404,18 @@ func (c *X402Client) PaymentRequired(resp *http.Response) bool {
 	return resp.StatusCode == http.StatusPaymentRequired
 }
 
-// ParsePaymentRequest parses a PaymentRequest from a 402 response.
+// ParsePaymentRequest parses a PaymentRequest from a 402 response, whether
+// sent as the JSON body, in its "payment_request" member, or as RFC 9457
+// problem details (see core.ProblemContentType).
 func (c *X402Client) ParsePaymentRequest(resp *http.Response) (*core.PaymentRequest, error) {
-	if !c.PaymentRequired(resp) {
+	return PaymentRequestFromResponse(resp)
+}
+
+// PaymentRequestFromResponse parses a PaymentRequest from a 402 response like
+// X402Client.ParsePaymentRequest, for callers without a client, e.g. to show
+// what a resource costs before loading a wallet.
+func PaymentRequestFromResponse(resp *http.Response) (*core.PaymentRequest, error) {
+	if resp.StatusCode != http.StatusPaymentRequired {
 		return nil, fmt.Errorf("response does not require payment (status != 402)")
 	}
 
@@ -240,6 +425,19 @@ func (c *X402Client) ParsePaymentRequest(resp *http.Response) (*core.PaymentRequ
 	}
 	defer resp.Body.Close()
 
+	// Problem details carry the payment request as an extension member, and
+	// so may JSON bodies enriched with other members, e.g. documentation links
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(body, &members); err != nil && mediaType == core.ProblemContentType {
+		return nil, core.NewInvalidPaymentRequestError("failed to parse problem details: " + err.Error())
+	}
+	if member, ok := members[core.ProblemPaymentRequestMember]; ok {
+		body = member
+	} else if mediaType == core.ProblemContentType {
+		return nil, core.NewInvalidPaymentRequestError("problem details have no " + core.ProblemPaymentRequestMember + " member")
+	}
+
 	var paymentReq core.PaymentRequest
 	if err := json.Unmarshal(body, &paymentReq); err != nil {
 		return nil, core.NewInvalidPaymentRequestError("failed to parse payment request: " + err.Error())
@@ -248,6 +446,17 @@ func (c *X402Client) ParsePaymentRequest(resp *http.Response) (*core.PaymentRequ
 	return &paymentReq, nil
 }
 
+// CapturedAmount returns the amount a server captured of a held payment
+// (see core.PaymentRequest.Capture), from the X-Payment-Captured header of
+// resp, or its trailer once the body was read. It returns "" if the server
+// did not report one, in which case the whole hold was charged.
+func CapturedAmount(resp *http.Response) string {
+	if captured := resp.Header.Get(core.DefaultCapturedHeader); captured != "" {
+		return captured
+	}
+	return resp.Trailer.Get(core.DefaultCapturedHeader)
+}
+
 // CreatePayment creates and broadcasts a payment transaction, returning a PaymentAuthorization.
 //
 // Parameters:
@@ -257,17 +466,64 @@ func (c *X402Client) ParsePaymentRequest(resp *http.Response) (*core.PaymentRequ
 //
 // Returns:
 //   - PaymentAuthorization to include in retry request
+//
+// The payment is added to the client's payment history under the request's resource.
 func (c *X402Client) CreatePayment(
 	ctx context.Context,
 	request *core.PaymentRequest,
 	amount string,
 ) (*core.PaymentAuthorization, error) {
-	if c.closed {
-		return nil, fmt.Errorf("client has been closed")
+	return c.createPayment(ctx, request, amount, request.Resource)
+}
+
+// SimulatePayment simulates the payment CreatePayment would make for request,
+// without broadcasting it, and reports its fees and why it would fail (see
+// core.SolanaPaymentProcessor.SimulatePayment).
+//
+// Usage:
+//
+//	sim, err := client.SimulatePayment(ctx, paymentReq, "")
+//	if err == nil && sim.Err == nil {
+//	    auth, err = client.CreatePayment(ctx, paymentReq, "")
+//	}
+func (c *X402Client) SimulatePayment(
+	ctx context.Context,
+	request *core.PaymentRequest,
+	amount string,
+) (*core.PaymentSimulation, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.closed.Load() {
+		return nil, ErrClientClosed
+	}
+	if c.wallets != nil {
+		// Simulate with the wallet the payment would use
+		payAmount := amount
+		if payAmount == "" {
+			payAmount = request.MaxAmountRequired
+		}
+		wallet, err := c.wallets.acquire(ctx, c.tokenBalance(request), payAmount)
+		if err != nil {
+			return nil, err
+		}
+		defer c.wallets.release(wallet, false, payAmount)
+		return c.processor.SimulatePaymentFor(ctx, request, amount, wallet.signer.PublicKey())
 	}
+	return c.processor.SimulatePaymentFor(ctx, request, amount, c.signer.PublicKey())
+}
 
-	if c.walletKeypair == nil {
-		return nil, fmt.Errorf("client has been closed")
+// createPayment creates a payment and records it in the history under endpoint.
+func (c *X402Client) createPayment(
+	ctx context.Context,
+	request *core.PaymentRequest,
+	amount string,
+	endpoint string,
+) (*core.PaymentAuthorization, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	// Checked under the lock, as Close sets it before taking the lock
+	if c.closed.Load() {
+		return nil, ErrClientClosed
 	}
 
 	// Validate request not expired
@@ -281,53 +537,118 @@ func (c *X402Client) CreatePayment(
 		payAmount = request.MaxAmountRequired
 	}
 
-	// Check sufficient balance
-	balance, err := c.processor.GetTokenBalance(
-		ctx,
-		c.walletKeypair.PublicKey().String(),
-		request.AssetAddress,
-	)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get token balance: %w", err)
+	// Set once the payment is broadcast
+	var txHash string
+	signer := c.signer
+	if c.wallets != nil {
+		// The pool checks the balance of the wallet it picks
+		wallet, err := c.wallets.acquire(ctx, c.tokenBalance(request), payAmount)
+		if err != nil {
+			c.logger.Warn("x402: no wallet in pool can make payment", "request", request, "error", err)
+			return nil, err
+		}
+		defer func() { c.wallets.release(wallet, txHash != "", payAmount) }()
+		signer = wallet.signer
+	} else if err := c.checkBalance(ctx, request, signer.PublicKey(), payAmount); err != nil {
+		return nil, err
 	}
+	payer := signer.PublicKey()
 
-	// Convert to smallest unit (assuming 6 decimals) for precise comparison
-	decimals := 6
-	balanceSmallestUnit := uint64(math.Floor(balance * math.Pow(10, float64(decimals))))
-
-	payAmountFloat := 0.0
-	_, err = fmt.Sscanf(payAmount, "%f", &payAmountFloat)
+	// Create transaction
+	tx, err := c.processor.CreatePaymentTransactionFor(ctx, request, payAmount, payer)
 	if err != nil {
-		return nil, fmt.Errorf("invalid amount format: %w", err)
+		return nil, err
 	}
-	amountSmallestUnit := uint64(math.Floor(payAmountFloat * math.Pow(10, float64(decimals))))
 
-	if balanceSmallestUnit < amountSmallestUnit {
-		return nil, core.NewInsufficientFundsError(payAmount, fmt.Sprintf("%.6f", balance))
+	// Check SOL for the fee and token account rent, which the token balance
+	// check above does not cover
+	if err := c.processor.CheckFeeBalance(ctx, tx, payer); err != nil {
+		var feeErr *core.InsufficientFeeBalanceError
+		if errors.As(err, &feeErr) {
+			return nil, err
+		}
+		c.logger.Warn("x402: failed to check SOL balance for fees", "request", request, "error", err)
 	}
 
-	// Create transaction
-	tx, err := c.processor.CreatePaymentTransaction(ctx, request, payAmount, *c.walletKeypair)
+	// Sign and broadcast
+	txHash, err = c.processor.SignAndSendTransactionWithSigner(ctx, tx, signer)
 	if err != nil {
 		return nil, err
 	}
 
-	// Sign and broadcast
-	txHash, err := c.processor.SignAndSendTransaction(ctx, tx, *c.walletKeypair)
-	if err != nil {
-		return nil, err
+	c.logger.Info("x402: payment sent", "request", request, core.LogKeyTxHash, txHash)
+
+	if err := c.history.Add(PaymentRecord{
+		Endpoint:       endpoint,
+		PaymentID:      request.PaymentID,
+		Amount:         payAmount,
+		AssetAddress:   request.AssetAddress,
+		PaymentAddress: request.PaymentAddress,
+		Network:        request.Network,
+		TxHash:         txHash,
+		Timestamp:      time.Now().UTC(),
+	}); err != nil {
+		c.logger.Error("x402: failed to record payment history", "request", request, core.LogKeyTxHash, txHash, "error", err)
 	}
 
-	// Create authorization
-	return &core.PaymentAuthorization{
+	// Attested after the broadcast, as the attestation covers the
+	// transaction hash. The payment is in the history if the signer fails.
+	authorization := &core.PaymentAuthorization{
 		PaymentID:       request.PaymentID,
 		ActualAmount:    payAmount,
 		PaymentAddress:  request.PaymentAddress,
 		AssetAddress:    request.AssetAddress,
 		Network:         request.Network,
-		Timestamp:       request.ExpiresAt, // Use current time in production
-		Signature:       txHash,
-		PublicKey:       c.walletKeypair.PublicKey().String(),
+		Timestamp:       time.Now().UTC(),
 		TransactionHash: txHash,
-	}, nil
+	}
+	if err := authorization.Attest(ctx, signer); err != nil {
+		c.logger.Error("x402: failed to sign authorization for sent payment", "request", request, core.LogKeyTxHash, txHash, "error", err)
+		return nil, fmt.Errorf("failed to sign payment authorization for transaction %s: %w", txHash, err)
+	}
+
+	if c.confirmation != "" {
+		if err := c.processor.WaitForConfirmation(ctx, txHash, c.confirmation); err != nil {
+			return nil, err
+		}
+	}
+
+	return authorization, nil
+}
+
+// checkBalance returns an *core.InsufficientFundsError if payer holds less
+// than amount of the requested token.
+func (c *X402Client) checkBalance(ctx context.Context, request *core.PaymentRequest, payer solana.PublicKey, amount string) error {
+	balance, err := c.processor.GetTokenBalance(
+		ctx,
+		payer.String(),
+		request.AssetAddress,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to get token balance: %w", err)
+	}
+
+	// Convert to smallest unit (assuming 6 decimals) for precise comparison
+	decimals := 6
+	balanceSmallestUnit := uint64(math.Floor(balance * math.Pow(10, float64(decimals))))
+
+	amountFloat := 0.0
+	_, err = fmt.Sscanf(amount, "%f", &amountFloat)
+	if err != nil {
+		return fmt.Errorf("invalid amount format: %w", err)
+	}
+	amountSmallestUnit := uint64(math.Floor(amountFloat * math.Pow(10, float64(decimals))))
+
+	if balanceSmallestUnit < amountSmallestUnit {
+		c.logger.Warn("x402: insufficient funds for payment", "request", request, "balance", balance)
+		return core.NewInsufficientFundsError(amount, fmt.Sprintf("%.6f", balance))
+	}
+	return nil
+}
+
+// tokenBalance returns a lookup of the requested token's balance by wallet.
+func (c *X402Client) tokenBalance(request *core.PaymentRequest) func(ctx context.Context, address string) (float64, error) {
+	return func(ctx context.Context, address string) (float64, error) {
+		return c.processor.GetTokenBalance(ctx, address, request.AssetAddress)
+	}
 }
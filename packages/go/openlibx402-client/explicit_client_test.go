@@ -0,0 +1,139 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/openlibx402/go/openlibx402-core"
+)
+
+// newTestClient creates an explicit client paying from a wallet funded with
+// 100 of mint on a mock chain.
+func newTestClient(t testing.TB, mint string) (*X402Client, *core.MockProcessor) {
+	t.Helper()
+	wallet := solana.NewWallet()
+	mock := core.NewMockProcessor()
+	mock.SetBalance(wallet.PublicKey().String(), mint, 100)
+	mock.SetSOLBalance(wallet.PublicKey().String(), 1_000_000_000)
+	c := NewX402Client(wallet.PrivateKey, "", nil, true)
+	c.SetProcessor(mock)
+	t.Cleanup(func() { c.Close() })
+	return c, mock
+}
+
+// testPaymentRequest returns a payment request for amount of mint.
+func testPaymentRequest(mint, amount string) *core.PaymentRequest {
+	return &core.PaymentRequest{
+		MaxAmountRequired: amount,
+		AssetType:         "SPL",
+		AssetAddress:      mint,
+		PaymentAddress:    solana.NewWallet().PublicKey().String(),
+		Network:           "solana-devnet",
+		ExpiresAt:         time.Now().Add(time.Minute),
+		Nonce:             solana.NewWallet().PublicKey().String(),
+		PaymentID:         solana.NewWallet().PublicKey().String(),
+		Resource:          "/data",
+	}
+}
+
+func TestCreatePaymentAttestsTransaction(t *testing.T) {
+	mint := solana.NewWallet().PublicKey().String()
+	c, _ := newTestClient(t, mint)
+
+	authorization, err := c.CreatePayment(context.Background(), testPaymentRequest(mint, "0.10"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if authorization.TransactionHash == "" {
+		t.Fatal("authorization has no transaction hash")
+	}
+	if err := authorization.VerifyAttestation(); err != nil {
+		t.Errorf("VerifyAttestation() = %v, want nil", err)
+	}
+}
+
+// blockingProcessor is a MockProcessor whose broadcasts wait for release,
+// reporting on sending when one starts.
+type blockingProcessor struct {
+	*core.MockProcessor
+	sending chan struct{}
+	release chan struct{}
+}
+
+func (p *blockingProcessor) SignAndSendTransactionWithSigner(ctx context.Context, tx *solana.Transaction, signer core.Signer) (string, error) {
+	p.sending <- struct{}{}
+	<-p.release
+	return p.MockProcessor.SignAndSendTransactionWithSigner(ctx, tx, signer)
+}
+
+func TestCloseWaitsForPayment(t *testing.T) {
+	mint := solana.NewWallet().PublicKey().String()
+	c, mock := newTestClient(t, mint)
+	processor := &blockingProcessor{MockProcessor: mock, sending: make(chan struct{}), release: make(chan struct{})}
+	c.SetProcessor(processor)
+
+	type payment struct {
+		authorization *core.PaymentAuthorization
+		err           error
+	}
+	paying := make(chan payment)
+	go func() {
+		authorization, err := c.CreatePayment(context.Background(), testPaymentRequest(mint, "0.10"), "")
+		paying <- payment{authorization, err}
+	}()
+	<-processor.sending
+
+	closed := make(chan struct{})
+	go func() {
+		c.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+		t.Fatal("Close returned while a payment was in progress")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(processor.release)
+	result := <-paying
+	<-closed
+	if result.err != nil {
+		t.Fatalf("payment in progress during Close failed: %v", result.err)
+	}
+	// The payment was attested before the key was zeroed
+	if err := result.authorization.VerifyAttestation(); err != nil {
+		t.Errorf("VerifyAttestation() = %v, want nil", err)
+	}
+	if _, err := c.CreatePayment(context.Background(), testPaymentRequest(mint, "0.10"), ""); !errors.Is(err, ErrClientClosed) {
+		t.Errorf("payment after Close: got %v, want ErrClientClosed", err)
+	}
+}
+
+func TestCloseDuringConcurrentPayments(t *testing.T) {
+	mint := solana.NewWallet().PublicKey().String()
+	c, _ := newTestClient(t, mint)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			authorization, err := c.CreatePayment(context.Background(), testPaymentRequest(mint, "0.01"), "")
+			switch {
+			case errors.Is(err, ErrClientClosed):
+			case err != nil:
+				t.Errorf("CreatePayment() = %v, want success or ErrClientClosed", err)
+			default:
+				if err := authorization.VerifyAttestation(); err != nil {
+					t.Errorf("VerifyAttestation() = %v, want nil", err)
+				}
+			}
+		}()
+	}
+	c.Close()
+	wg.Wait()
+}
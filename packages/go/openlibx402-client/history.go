@@ -0,0 +1,131 @@
+package client
+
+import (
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PaymentRecord is a payment made by the client.
+type PaymentRecord struct {
+	Endpoint       string    `json:"endpoint"` // URL that required the payment (resource for explicit payments)
+	PaymentID      string    `json:"payment_id"`
+	Amount         string    `json:"amount"`
+	AssetAddress   string    `json:"asset_address"`
+	PaymentAddress string    `json:"payment_address"`
+	Network        string    `json:"network"`
+	TxHash         string    `json:"tx_hash"`
+	Timestamp      time.Time `json:"timestamp"`
+}
+
+// PaymentHistoryStore stores the payments made by a client.
+//
+// Implementations must be safe for concurrent use.
+type PaymentHistoryStore interface {
+	// Add stores a payment.
+	Add(record PaymentRecord) error
+	// List returns all stored payments, oldest first.
+	List() ([]PaymentRecord, error)
+}
+
+// MemoryPaymentHistory is an in-memory PaymentHistoryStore. It is the
+// default store of every client and keeps payments until the process exits.
+type MemoryPaymentHistory struct {
+	mu      sync.RWMutex
+	records []PaymentRecord
+}
+
+// NewMemoryPaymentHistory creates an empty in-memory payment history.
+func NewMemoryPaymentHistory() *MemoryPaymentHistory {
+	return &MemoryPaymentHistory{}
+}
+
+// Add implements PaymentHistoryStore.
+func (h *MemoryPaymentHistory) Add(record PaymentRecord) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.records = append(h.records, record)
+	return nil
+}
+
+// List implements PaymentHistoryStore.
+func (h *MemoryPaymentHistory) List() ([]PaymentRecord, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	records := make([]PaymentRecord, len(h.records))
+	copy(records, h.records)
+	return records, nil
+}
+
+// SetPaymentHistory sets the store recording payments made by the client
+// (default: a MemoryPaymentHistory).
+func (c *X402Client) SetPaymentHistory(store PaymentHistoryStore) {
+	if store == nil {
+		store = NewMemoryPaymentHistory()
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.history = store
+}
+
+// historyStore returns the store recording the client's payments.
+func (c *X402Client) historyStore() PaymentHistoryStore {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.history
+}
+
+// PaymentHistory returns the payments made by the client, oldest first.
+func (c *X402Client) PaymentHistory() ([]PaymentRecord, error) {
+	return c.historyStore().List()
+}
+
+// TotalSpent returns the sum of payments made within window of now, or of all
+// payments if window is 0. Amounts are summed exactly as decimals regardless of
+// token; use PaymentHistory to break spending down by token.
+func (c *X402Client) TotalSpent(window time.Duration) (string, error) {
+	records, err := c.historyStore().List()
+	if err != nil {
+		return "", err
+	}
+	var since time.Time
+	if window > 0 {
+		since = time.Now().Add(-window)
+	}
+	return sumAmounts(records, func(r PaymentRecord) bool {
+		return !r.Timestamp.Before(since)
+	}), nil
+}
+
+// sumAmounts sums the amounts of the records matching filter.
+func sumAmounts(records []PaymentRecord, filter func(PaymentRecord) bool) string {
+	total := new(big.Rat)
+	for _, record := range records {
+		if !filter(record) {
+			continue
+		}
+		if amount, ok := new(big.Rat).SetString(record.Amount); ok {
+			total.Add(total, amount)
+		}
+	}
+	return formatAmount(total)
+}
+
+// formatAmount formats a decimal amount without trailing zeros.
+func formatAmount(amount *big.Rat) string {
+	s := amount.FloatString(9)
+	s = strings.TrimRight(s, "0")
+	return strings.TrimSuffix(s, ".")
+}
+
+// PaymentHistory returns the payments made by the client, oldest first.
+func (c *X402AutoClient) PaymentHistory() ([]PaymentRecord, error) {
+	return c.client.PaymentHistory()
+}
+
+// TotalSpent returns the sum of payments made within window of now, or of all
+// payments if window is 0.
+func (c *X402AutoClient) TotalSpent(window time.Duration) (string, error) {
+	return c.client.TotalSpent(window)
+}
@@ -0,0 +1,72 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ErrHostNotAllowed is returned when the host policy forbids paying a host.
+var ErrHostNotAllowed = errors.New("payments to host are not allowed")
+
+// hostPolicy restricts the hosts the auto client pays.
+//
+// Patterns are host names, optionally with a port, matched case-insensitively;
+// a leading "*." matches any subdomain, e.g. "*.example.com" matches
+// "api.example.com" but not "example.com". A pattern without a port matches
+// any port.
+type hostPolicy struct {
+	allowed []string // If set, only these hosts are paid
+	denied  []string // Never paid, even if allowed
+}
+
+// check returns an error wrapping ErrHostNotAllowed if the policy forbids
+// paying for endpoint.
+func (p hostPolicy) check(endpoint string) error {
+	host := strings.ToLower(hostOf(endpoint))
+	for _, pattern := range p.denied {
+		if matchHost(pattern, host) {
+			return fmt.Errorf("%w: %s is denied", ErrHostNotAllowed, host)
+		}
+	}
+	if len(p.allowed) == 0 {
+		return nil
+	}
+	for _, pattern := range p.allowed {
+		if matchHost(pattern, host) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s is not in the allowlist", ErrHostNotAllowed, host)
+}
+
+// matchHost reports whether host (with an optional port) matches pattern.
+func matchHost(pattern, host string) bool {
+	pattern = strings.ToLower(pattern)
+	if _, _, err := net.SplitHostPort(pattern); err != nil {
+		// No port in the pattern: compare host names only
+		if name, _, err := net.SplitHostPort(host); err == nil {
+			host = name
+		}
+	}
+	if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+		return strings.HasSuffix(host, "."+suffix)
+	}
+	return host == pattern
+}
+
+// checkRedirectedHost applies the host policy to the host that responded
+// with resp, if redirects led there from url. Payments to url itself are
+// checked when they are made.
+func (c *X402AutoClient) checkRedirectedHost(resp *http.Response, url string) error {
+	if resp.Request == nil || resp.Request.URL == nil || resp.Request.URL.String() == url {
+		return nil
+	}
+	if err := c.hosts.check(resp.Request.URL.String()); err != nil {
+		c.client.log().Warn("x402: payment to redirected host not allowed", "url", url, "redirected_url", resp.Request.URL.String())
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package client
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/openlibx402/go/openlibx402-core"
+)
+
+// payWithLightning pays the Lightning invoice of a 402 response, if the
+// server offers one, and repeats the request with the proof of payment. It
+// reports whether it paid; if the invoice cannot be paid, the response is
+// returned to be paid on-chain instead. The invoice is subject to the host
+// policy, ApprovePayment, and MaxLightningSats, but not to the spending
+// budgets, which are in tokens.
+func (c *X402AutoClient) payWithLightning(ctx context.Context, resp *http.Response, url string, newRequest func() (*http.Request, error)) (*http.Response, bool, error) {
+	paymentReq, err := peekPaymentRequest(resp)
+	if err != nil {
+		return nil, false, err
+	}
+	if paymentReq == nil || paymentReq.Lightning == nil || paymentReq.Lightning.Invoice == "" {
+		return resp, false, nil
+	}
+	if err := c.hosts.check(url); err != nil {
+		c.client.log().Warn("x402: payment to host not allowed", "url", url, "request", paymentReq)
+		resp.Body.Close()
+		return nil, false, err
+	}
+	if c.approvePayment != nil {
+		approved, err := c.approvePayment(ctx, paymentReq)
+		if err != nil {
+			resp.Body.Close()
+			return nil, false, err
+		}
+		if !approved {
+			c.client.log().Info("x402: payment not approved", "url", url, "request", paymentReq)
+			resp.Body.Close()
+			return nil, false, ErrPaymentNotApproved
+		}
+	}
+
+	retry, err := newRequest()
+	if err != nil {
+		resp.Body.Close()
+		return nil, false, err
+	}
+	preimage, err := c.lightning.PayInvoice(ctx, paymentReq.Lightning.Invoice, c.maxLightningSats*1000)
+	if err != nil {
+		c.client.log().Warn("x402: Lightning payment failed, paying on-chain", "url", url, core.LogKeyPaymentID, paymentReq.PaymentID, "error", err)
+		if retry.Body != nil {
+			retry.Body.Close()
+		}
+		return resp, false, nil
+	}
+	resp.Body.Close()
+	c.client.log().Info("x402: paid Lightning invoice", "url", url, core.LogKeyPaymentID, paymentReq.PaymentID, "amount_msat", paymentReq.Lightning.AmountMsat)
+
+	proof := &core.LightningProof{PaymentID: paymentReq.PaymentID, Preimage: preimage}
+	header, err := proof.ToHeaderValue()
+	if err != nil {
+		return nil, false, err
+	}
+	retry.Header.Set(c.lightningHeader, header)
+	paid, err := c.client.Do(ctx, retry, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := rejectionError(paid); err != nil {
+		c.client.log().Warn("x402: Lightning payment rejected by server", "url", url, core.LogKeyPaymentID, paymentReq.PaymentID, "error", err)
+		return nil, false, err
+	}
+	return paid, !c.client.PaymentRequired(paid), nil
+}
@@ -0,0 +1,52 @@
+package client
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// quotaCache holds the quota tokens of payments that include further
+// requests, by resource (see sessionKey).
+type quotaCache struct {
+	mu     sync.Mutex
+	tokens map[string]string
+}
+
+func newQuotaCache() *quotaCache {
+	return &quotaCache{tokens: make(map[string]string)}
+}
+
+// token returns the quota token for a resource.
+func (q *quotaCache) token(key string) string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.tokens[key]
+}
+
+// update saves the quota token of a response, or drops it once no included
+// requests are left so that the next request pays without a round trip.
+func (q *quotaCache) update(key string, resp *http.Response, tokenHeader, remainingHeader string) {
+	token := resp.Header.Get(tokenHeader)
+	if token == "" {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if remaining, err := strconv.Atoi(resp.Header.Get(remainingHeader)); err == nil && remaining <= 0 {
+		if q.tokens[key] == token {
+			delete(q.tokens, key)
+		}
+		return
+	}
+	q.tokens[key] = token
+}
+
+// forget drops a quota token the server no longer accepts.
+func (q *quotaCache) forget(key, token string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.tokens[key] == token {
+		delete(q.tokens, key)
+	}
+}
@@ -0,0 +1,71 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// RequestOption customizes a request made by X402AutoClient. Options are
+// applied to the initial request and to the retry with payment.
+type RequestOption func(req *http.Request)
+
+// WithHeader sets a request header, e.g. Authorization, Accept, or Idempotency-Key.
+func WithHeader(key, value string) RequestOption {
+	return func(req *http.Request) {
+		req.Header.Set(key, value)
+	}
+}
+
+// WithHeaders sets every header in headers, replacing existing values.
+func WithHeaders(headers http.Header) RequestOption {
+	return func(req *http.Request) {
+		for key, values := range headers {
+			req.Header[http.CanonicalHeaderKey(key)] = append([]string(nil), values...)
+		}
+	}
+}
+
+// WithQuery adds a query parameter to the request URL.
+func WithQuery(key, value string) RequestOption {
+	return func(req *http.Request) {
+		query := req.URL.Query()
+		query.Add(key, value)
+		req.URL.RawQuery = query.Encode()
+	}
+}
+
+// Do executes a request with automatic payment handling, preserving its
+// method, headers, query, and body.
+//
+// The body is replayed for the retry with Request.GetBody, which
+// http.NewRequest sets for in-memory bodies; a 402 for a request whose body
+// cannot be replayed fails without paying. req itself is not modified.
+//
+// Usage:
+//
+//	req, _ := http.NewRequest("POST", "https://api.example.com/jobs", bytes.NewReader(payload))
+//	req.Header.Set("Authorization", "Bearer "+apiToken)
+//	req.Header.Set("Idempotency-Key", jobID)
+//	resp, err := client.Do(ctx, req)
+func (c *X402AutoClient) Do(ctx context.Context, req *http.Request) (*http.Response, error) {
+	attempts := 0
+	newRequest := func() (*http.Request, error) {
+		attempts++
+		next := req.Clone(ctx)
+		if attempts == 1 || req.Body == nil || req.Body == http.NoBody {
+			return next, nil
+		}
+		if req.GetBody == nil {
+			return nil, fmt.Errorf("payment required but the request body cannot be replayed: set Request.GetBody")
+		}
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, fmt.Errorf("failed to replay request body: %w", err)
+		}
+		next.Body = body
+		return next, nil
+	}
+	resp, err := c.send(ctx, nil, newRequest)
+	return c.resumable(ctx, nil, newRequest, resp, err)
+}
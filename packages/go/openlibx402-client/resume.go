@@ -0,0 +1,157 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// defaultMaxResumes is how many times a download is resumed by default.
+const defaultMaxResumes = 3
+
+// ErrDownloadChanged is returned when a download cannot be resumed because
+// the resource changed since it started.
+var ErrDownloadChanged = errors.New("resource changed while it was downloaded")
+
+// resumable returns resp with a body that resumes the download when it is
+// cut off, if ResumeDownloads is set and resp is a complete GET response.
+func (c *X402AutoClient) resumable(ctx context.Context, opts []RequestOption, newRequest func() (*http.Request, error), resp *http.Response, err error) (*http.Response, error) {
+	if err != nil || !c.resumeDownloads || resp.StatusCode != http.StatusOK {
+		return resp, err
+	}
+	if req := resp.Request; req == nil || req.Method != http.MethodGet || req.Header.Get("Range") != "" {
+		return resp, nil
+	}
+	maxResumes := c.maxResumes
+	if maxResumes <= 0 {
+		maxResumes = defaultMaxResumes
+	}
+	resp.Body = &resumableBody{
+		client:     c,
+		ctx:        ctx,
+		opts:       opts,
+		newRequest: newRequest,
+		resp:       resp,
+		body:       resp.Body,
+		length:     resp.ContentLength,
+		etag:       resp.Header.Get("ETag"),
+		modified:   resp.Header.Get("Last-Modified"),
+		remaining:  maxResumes,
+	}
+	return resp, nil
+}
+
+// resumableBody is the body of a download that continues with a Range
+// request, paying again if needed, when the server resets the stream, the
+// body ends early, or the server reports in a trailer that the payment ran
+// out.
+type resumableBody struct {
+	client     *X402AutoClient
+	ctx        context.Context
+	opts       []RequestOption
+	newRequest func() (*http.Request, error)
+
+	resp      *http.Response // Response body is read from, for its trailer
+	body      io.ReadCloser
+	offset    int64 // Bytes read so far
+	length    int64 // Length of the whole body, or -1 if unknown
+	etag      string
+	modified  string
+	remaining int // Resumptions left
+}
+
+func (b *resumableBody) Read(p []byte) (int, error) {
+	for {
+		n, err := b.body.Read(p)
+		b.offset += int64(n)
+		if err == nil || (err == io.EOF && !b.cutOff()) {
+			return n, err
+		}
+		if resumeErr := b.resume(err); resumeErr != nil {
+			return n, resumeErr
+		}
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+func (b *resumableBody) Close() error {
+	return b.body.Close()
+}
+
+// cutOff reports whether a body that reached EOF ended early.
+func (b *resumableBody) cutOff() bool {
+	return (b.length >= 0 && b.offset < b.length) || b.resp.Trailer.Get(b.client.expiredTrailer) != ""
+}
+
+// resume continues the download at the current offset after it was
+// interrupted by cause.
+func (b *resumableBody) resume(cause error) error {
+	if b.ctx.Err() != nil || b.remaining <= 0 {
+		return cause
+	}
+	b.remaining--
+	b.body.Close()
+	b.body = http.NoBody
+	url := b.resp.Request.URL.String()
+	b.client.client.log().Info("x402: download interrupted, resuming", "url", url, "offset", b.offset, "error", cause)
+
+	// If-Range makes the server send the whole resource if it changed
+	opts := append(b.opts[:len(b.opts):len(b.opts)], func(req *http.Request) {
+		req.Header.Set("Range", "bytes="+strconv.FormatInt(b.offset, 10)+"-")
+		if b.etag != "" && !strings.HasPrefix(b.etag, "W/") {
+			req.Header.Set("If-Range", b.etag)
+		} else if b.modified != "" {
+			req.Header.Set("If-Range", b.modified)
+		}
+	})
+	resp, err := b.client.send(b.ctx, opts, b.newRequest)
+	if err != nil {
+		return fmt.Errorf("failed to resume download at byte %d: %w", b.offset, err)
+	}
+	b.resp = resp
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		if start, ok := contentRangeStart(resp.Header.Get("Content-Range")); !ok || start != b.offset {
+			resp.Body.Close()
+			return fmt.Errorf("failed to resume download at byte %d: unexpected Content-Range %q", b.offset, resp.Header.Get("Content-Range"))
+		}
+		b.body = resp.Body
+	case http.StatusOK:
+		// The server ignored the range; skip what was read if it is the same resource
+		if (b.etag == "" && b.modified == "") || resp.Header.Get("ETag") != b.etag || resp.Header.Get("Last-Modified") != b.modified {
+			resp.Body.Close()
+			return ErrDownloadChanged
+		}
+		if _, err := io.CopyN(io.Discard, resp.Body, b.offset); err != nil {
+			resp.Body.Close()
+			return fmt.Errorf("failed to resume download at byte %d: %w", b.offset, err)
+		}
+		b.body = resp.Body
+	default:
+		resp.Body.Close()
+		return fmt.Errorf("failed to resume download at byte %d: unexpected status %s", b.offset, resp.Status)
+	}
+	return nil
+}
+
+// contentRangeStart returns the first byte of a "bytes start-end/length"
+// Content-Range header.
+func contentRangeStart(header string) (int64, bool) {
+	spec, ok := strings.CutPrefix(header, "bytes ")
+	if !ok {
+		return 0, false
+	}
+	start, _, ok := strings.Cut(spec, "-")
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(start, 10, 64)
+	return n, err == nil
+}
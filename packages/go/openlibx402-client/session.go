@@ -0,0 +1,87 @@
+package client
+
+import (
+	"net/url"
+	"sync"
+)
+
+// paymentFlight is a payment in progress for a resource that concurrent
+// requests wait on.
+type paymentFlight struct {
+	done  chan struct{}
+	token string // Session token issued for the payment, if any
+}
+
+// sessionCache holds the session tokens issued by servers and coalesces
+// concurrent payments for the same resource.
+type sessionCache struct {
+	mu          sync.Mutex
+	tokens      map[string]string
+	flights     map[string]*paymentFlight
+	unsupported map[string]bool
+}
+
+func newSessionCache() *sessionCache {
+	return &sessionCache{
+		tokens:      make(map[string]string),
+		flights:     make(map[string]*paymentFlight),
+		unsupported: make(map[string]bool),
+	}
+}
+
+// sessionKey identifies the resource a session token is valid for.
+func sessionKey(u *url.URL) string {
+	return u.Scheme + "://" + u.Host + u.Path
+}
+
+// token returns the cached session token for a resource.
+func (s *sessionCache) token(key string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tokens[key]
+}
+
+// forget drops a session token the server no longer accepts.
+func (s *sessionCache) forget(key, token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.tokens[key] == token {
+		delete(s.tokens, key)
+	}
+}
+
+// begin joins the payment in progress for a resource. The caller leads the
+// payment if leader is true and must then call finish; otherwise it may wait
+// on flight.done. Resources whose server issues no session tokens are never
+// coalesced.
+func (s *sessionCache) begin(key string) (flight *paymentFlight, leader bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.unsupported[key] {
+		return nil, true
+	}
+	if flight, ok := s.flights[key]; ok {
+		return flight, false
+	}
+	flight = &paymentFlight{done: make(chan struct{})}
+	s.flights[key] = flight
+	return flight, true
+}
+
+// finish completes a payment started with begin. paid reports whether the
+// payment went through; token is the session token the server returned.
+func (s *sessionCache) finish(key string, flight *paymentFlight, paid bool, token string) {
+	if flight == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if token != "" {
+		s.tokens[key] = token
+	} else if paid {
+		s.unsupported[key] = true
+	}
+	flight.token = token
+	delete(s.flights, key)
+	close(flight.done)
+}
@@ -0,0 +1,58 @@
+package client
+
+import (
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+// subscriptionCache holds the subscription tokens issued by servers.
+type subscriptionCache struct {
+	mu     sync.Mutex
+	tokens map[string]string
+}
+
+func newSubscriptionCache() *subscriptionCache {
+	return &subscriptionCache{tokens: make(map[string]string)}
+}
+
+// subscriptionKey identifies the server a subscription token is valid for.
+func subscriptionKey(u *url.URL) string {
+	return u.Scheme + "://" + u.Host
+}
+
+// store saves the subscription token a server issued.
+func (s *subscriptionCache) store(u *url.URL, token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens[subscriptionKey(u)] = token
+}
+
+// forget drops a subscription token the server no longer accepts.
+func (s *subscriptionCache) forget(u *url.URL, token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if key := subscriptionKey(u); s.tokens[key] == token {
+		delete(s.tokens, key)
+	}
+}
+
+// wrap returns newRequest adding the subscription token for the request's
+// server, or if there is none, the plan to buy.
+func (s *subscriptionCache) wrap(newRequest func() (*http.Request, error), plan, planHeader, tokenHeader string) func() (*http.Request, error) {
+	return func() (*http.Request, error) {
+		req, err := newRequest()
+		if err != nil {
+			return nil, err
+		}
+		s.mu.Lock()
+		token := s.tokens[subscriptionKey(req.URL)]
+		s.mu.Unlock()
+		if token != "" {
+			req.Header.Set(tokenHeader, token)
+		} else {
+			req.Header.Set(planHeader, plan)
+		}
+		return req, nil
+	}
+}
@@ -0,0 +1,171 @@
+package client
+
+import (
+	"context"
+	"math/big"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/openlibx402/go/openlibx402-core"
+)
+
+// tabCache holds the tabs the auto client runs with servers, by payee (see
+// channelPayee), and the prices of resources chargeable to them.
+type tabCache struct {
+	mu     sync.Mutex
+	tabs   map[string]*paymentTab
+	prices map[string]channelPrice // by resource (see sessionKey)
+
+	settleRequests int
+	settleInterval time.Duration
+}
+
+// paymentTab is a tab with a server. charged counts every voucher signed
+// until the server reports the amount it accepted.
+type paymentTab struct {
+	id       string
+	charged  *big.Rat
+	requests int       // Requests charged since the last settlement
+	since    time.Time // Time of the last settlement
+}
+
+func newTabCache(settleRequests int, settleInterval time.Duration) *tabCache {
+	if settleRequests <= 0 {
+		settleRequests = 100
+	}
+	if settleInterval <= 0 {
+		settleInterval = time.Minute
+	}
+	return &tabCache{
+		tabs:           make(map[string]*paymentTab),
+		prices:         make(map[string]channelPrice),
+		settleRequests: settleRequests,
+		settleInterval: settleInterval,
+	}
+}
+
+// learn records the tab of a payee from a payment request offering one,
+// with the amount the server reports charged to it, and the price of the
+// resource unless the payment request settles the tab.
+func (c *tabCache) learn(u *url.URL, payer string, paymentReq *core.PaymentRequest) {
+	payee := channelPayee(u, paymentReq.PaymentAddress, paymentReq.AssetAddress)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if amount, ok := new(big.Rat).SetString(paymentReq.MaxAmountRequired); ok && paymentReq.Tab.Outstanding == "" {
+		c.prices[sessionKey(u)] = channelPrice{payee: payee, amount: amount}
+	}
+	tab := c.tabs[payee]
+	if tab == nil {
+		tab = &paymentTab{id: core.TabID(payer, paymentReq.PaymentAddress, paymentReq.AssetAddress), charged: new(big.Rat), since: time.Now()}
+		c.tabs[payee] = tab
+	}
+	if charged, ok := new(big.Rat).SetString(paymentReq.Tab.Charged); ok {
+		// Vouchers the server rejected charged nothing
+		tab.charged = charged
+	}
+}
+
+// reserve adds the price of a resource to the amount charged to its payee's
+// tab, and returns the tab and the new amount, or nil if the price is
+// unknown. Once a settlement is due it returns the amount charged so far
+// and settle set instead.
+func (c *tabCache) reserve(u *url.URL) (tab *paymentTab, amount *big.Rat, settle bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	price, ok := c.prices[sessionKey(u)]
+	if !ok {
+		return nil, nil, false
+	}
+	tab = c.tabs[price.payee]
+	if tab == nil {
+		return nil, nil, false
+	}
+	if tab.requests >= c.settleRequests || time.Since(tab.since) >= c.settleInterval {
+		// Counted from the request, so a failed settlement is left to the server's cap
+		tab.requests = 0
+		tab.since = time.Now()
+		return tab, new(big.Rat).Set(tab.charged), true
+	}
+	tab.charged = new(big.Rat).Add(tab.charged, price.amount)
+	tab.requests++
+	return tab, tab.charged, false
+}
+
+// settled restarts the settlement period of a payee's tab after a payment
+// settled it.
+func (c *tabCache) settled(u *url.URL, paymentReq *core.PaymentRequest) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if tab := c.tabs[channelPayee(u, paymentReq.PaymentAddress, paymentReq.AssetAddress)]; tab != nil {
+		tab.requests = 0
+		tab.since = time.Now()
+	}
+}
+
+// attachTabVoucher sets a voucher charging the request to the payee's tab,
+// or asking to settle it once a settlement is due, if the client knows the
+// resource's price. It reports whether it set one.
+func (c *X402AutoClient) attachTabVoucher(ctx context.Context, req *http.Request) bool {
+	payer := c.client.payer()
+	if payer == "" {
+		// Tabs belong to one key, so wallet pools cannot run them
+		return false
+	}
+	tab, amount, settle := c.tabs.reserve(req.URL)
+	if tab == nil {
+		return false
+	}
+	voucher, err := c.client.signVoucher(ctx, payer, tab.id, formatAmount(amount), settle)
+	if err != nil {
+		c.client.log().Warn("x402: failed to sign voucher", "url", req.URL.String(), "error", err)
+		return false
+	}
+	header, err := voucher.ToHeaderValue()
+	if err != nil {
+		return false
+	}
+	req.Header.Set(c.voucherHeader, header)
+	return true
+}
+
+// payFromTab charges a 402 response to the payee's tab if the payment
+// request offers one. A voucher the server reports stale is sent again
+// with the amount the server accepted. It returns the response to the charged
+// request and true, or a 402 response, with its body intact, and false if
+// the request must be paid on-chain, as when the server asks to settle the
+// tab.
+func (c *X402AutoClient) payFromTab(ctx context.Context, resp *http.Response, newRequest func() (*http.Request, error)) (*http.Response, bool, error) {
+	payer := c.client.payer()
+	for attempt := 0; attempt < 2; attempt++ {
+		paymentReq, err := peekPaymentRequest(resp)
+		if err != nil {
+			return nil, false, err
+		}
+		if payer == "" || paymentReq == nil || paymentReq.Tab == nil {
+			return resp, false, nil
+		}
+
+		retry, err := newRequest()
+		if err != nil {
+			return nil, false, err
+		}
+		c.tabs.learn(retry.URL, payer, paymentReq)
+		if paymentReq.Tab.Outstanding != "" || !c.attachTabVoucher(ctx, retry) {
+			if retry.Body != nil {
+				retry.Body.Close()
+			}
+			return resp, false, nil
+		}
+		charged, err := c.client.Do(ctx, retry, nil)
+		if err != nil {
+			return nil, false, err
+		}
+		if !c.client.PaymentRequired(charged) {
+			return charged, true, nil
+		}
+		resp = charged
+	}
+	return resp, false, nil
+}
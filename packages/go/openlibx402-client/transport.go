@@ -0,0 +1,113 @@
+package client
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// TransportOptions configures a Transport.
+type TransportOptions struct {
+	AutoClientOptions // Payment limits, budgets, and approval; AutoRetry is ignored
+
+	RPCURL string            // Solana RPC endpoint URL (optional, defaults to devnet)
+	Base   http.RoundTripper // Transport making the requests (default: http.DefaultTransport)
+}
+
+// Transport is an http.RoundTripper that pays 402 responses and retries the
+// request with the payment authorization, applying the same checks as
+// X402AutoClient.
+//
+// It gives existing http.Client users, generated SDKs, and HTTP libraries X402
+// support without switching to X402AutoClient methods. Requests with a body
+// are retried using Request.GetBody, which http.NewRequest sets for in-memory
+// bodies; a 402 for a request whose body cannot be replayed fails before paying.
+//
+// Usage:
+//
+//	transport := client.NewTransport(walletKeypair, &client.TransportOptions{
+//	    AutoClientOptions: client.AutoClientOptions{MaxPaymentAmount: "1.0"},
+//	})
+//	defer transport.Close()
+//
+//	httpClient := &http.Client{Transport: transport}
+//	resp, err := httpClient.Get("https://api.example.com/premium-data")
+type Transport struct {
+	auto *X402AutoClient
+	base http.RoundTripper
+}
+
+// NewTransport creates a paying transport for the wallet.
+func NewTransport(walletKeypair solana.PrivateKey, opts *TransportOptions) *Transport {
+	if opts == nil {
+		opts = &TransportOptions{}
+	}
+	autoOpts := opts.AutoClientOptions
+	autoOpts.AutoRetry = true
+
+	base := opts.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &Transport{
+		auto: NewAutoClient(walletKeypair, opts.RPCURL, &autoOpts),
+		base: base,
+	}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.auto.client.closed.Load() {
+		return nil, ErrClientClosed
+	}
+	if err := t.auto.client.validateURL(req.URL.String()); err != nil {
+		return nil, err
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || !t.auto.client.PaymentRequired(resp) {
+		return resp, err
+	}
+
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		resp.Body.Close()
+		return nil, fmt.Errorf("payment required but the request body cannot be replayed: set Request.GetBody")
+	}
+
+	ctx := req.Context()
+	paymentReq, authorization, err := t.auto.handlePaymentRequired(ctx, resp, req.URL.String())
+	if err != nil {
+		return nil, err
+	}
+	headerValue, err := authorization.ToHeaderValue()
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode payment authorization: %w", err)
+	}
+
+	// Retry with payment, leaving the caller's request unmodified
+	retry := req.Clone(ctx)
+	if req.GetBody != nil {
+		retry.Body, err = req.GetBody()
+		if err != nil {
+			return nil, fmt.Errorf("failed to replay request body: %w", err)
+		}
+	}
+	retry.Header.Set(t.auto.client.authHeader(), headerValue)
+	resp, err = t.base.RoundTrip(retry)
+	if err == nil && !t.auto.client.PaymentRequired(resp) {
+		t.auto.releaseOnDelivery(resp, paymentReq, authorization)
+	}
+	return resp, err
+}
+
+// Close releases the transport's RPC connections.
+func (t *Transport) Close() error {
+	return t.auto.Close()
+}
+
+// AutoClient returns the auto client backing the transport, e.g. to read its
+// payment history.
+func (t *Transport) AutoClient() *X402AutoClient {
+	return t.auto
+}
@@ -0,0 +1,151 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+
+	"github.com/openlibx402/go/openlibx402-core"
+)
+
+// PoolWallet is a wallet of a WalletPool.
+type PoolWallet struct {
+	Signer   core.Signer // Signs the wallet's payments, e.g. core.NewKeypairSigner(keypair)
+	MaxSpend string      // Limit on the payments made with this wallet (optional)
+}
+
+// WalletPool spreads payments over several funded wallets, for agents that
+// need more throughput than a single payer allows.
+//
+// Each payment uses the wallet with the fewest payments in progress that is
+// within its spend limit and holds enough tokens, taking wallets in turn when
+// several qualify. A WalletPool is safe for concurrent use and may be shared
+// by several clients.
+type WalletPool struct {
+	mu      sync.Mutex
+	wallets []*pooledWallet
+	next    int
+}
+
+type pooledWallet struct {
+	signer   core.Signer
+	limit    *big.Rat // nil: no limit
+	spent    *big.Rat
+	inFlight int
+}
+
+// NewWalletPool creates a pool of wallets.
+//
+// Usage:
+//
+//	pool, err := client.NewWalletPool(
+//	    client.PoolWallet{Signer: core.NewKeypairSigner(wallet1), MaxSpend: "50.00"},
+//	    client.PoolWallet{Signer: core.NewKeypairSigner(wallet2), MaxSpend: "50.00"},
+//	)
+//	autoClient := client.NewAutoClientWithWalletPool(pool, "", nil)
+func NewWalletPool(wallets ...PoolWallet) (*WalletPool, error) {
+	if len(wallets) == 0 {
+		return nil, fmt.Errorf("wallet pool needs at least one wallet")
+	}
+	pool := &WalletPool{}
+	for _, wallet := range wallets {
+		pooled := &pooledWallet{signer: wallet.Signer, spent: new(big.Rat)}
+		if wallet.MaxSpend != "" {
+			limit, ok := new(big.Rat).SetString(wallet.MaxSpend)
+			if !ok {
+				return nil, fmt.Errorf("invalid spend limit for wallet %s: %s", wallet.Signer.PublicKey(), wallet.MaxSpend)
+			}
+			pooled.limit = limit
+		}
+		pool.wallets = append(pool.wallets, pooled)
+	}
+	return pool, nil
+}
+
+// Spent returns the amount paid with the wallet address through the pool.
+func (p *WalletPool) Spent(address string) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, wallet := range p.wallets {
+		if wallet.signer.PublicKey().String() == address {
+			return wallet.spent.FloatString(6)
+		}
+	}
+	return "0.000000"
+}
+
+// acquire picks the wallet for a payment of amount. The caller must release it.
+func (p *WalletPool) acquire(ctx context.Context, balance func(ctx context.Context, address string) (float64, error), amount string) (*pooledWallet, error) {
+	requested, ok := new(big.Rat).SetString(amount)
+	if !ok {
+		return nil, fmt.Errorf("invalid amount format: %s", amount)
+	}
+	required, _ := requested.Float64()
+
+	// Order wallets within their limits by payments in progress, in turn
+	p.mu.Lock()
+	start := p.next
+	p.next = (p.next + 1) % len(p.wallets)
+	var candidates []*pooledWallet
+	var overLimit *pooledWallet
+	for i := range p.wallets {
+		wallet := p.wallets[(start+i)%len(p.wallets)]
+		if wallet.limit != nil && new(big.Rat).Add(wallet.spent, requested).Cmp(wallet.limit) > 0 {
+			overLimit = wallet
+			continue
+		}
+		candidates = append(candidates, wallet)
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].inFlight < candidates[j].inFlight })
+	p.mu.Unlock()
+
+	if len(candidates) == 0 {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		return nil, core.NewBudgetExceededError(core.BudgetPerWallet, overLimit.limit.FloatString(6), overLimit.spent.FloatString(6), amount)
+	}
+
+	highest := 0.0
+	for _, wallet := range candidates {
+		available, err := balance(ctx, wallet.signer.PublicKey().String())
+		if err != nil {
+			return nil, fmt.Errorf("failed to get token balance: %w", err)
+		}
+		if available >= required {
+			p.mu.Lock()
+			wallet.inFlight++
+			p.mu.Unlock()
+			return wallet, nil
+		}
+		if available > highest {
+			highest = available
+		}
+	}
+	return nil, core.NewInsufficientFundsError(amount, fmt.Sprintf("%.6f", highest))
+}
+
+// release returns a wallet after a payment, recording amount if it was paid.
+func (p *WalletPool) release(wallet *pooledWallet, paid bool, amount string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	wallet.inFlight--
+	if paid {
+		if spent, ok := new(big.Rat).SetString(amount); ok {
+			wallet.spent.Add(wallet.spent, spent)
+		}
+	}
+}
+
+// signer returns the signer of the wallet with address, or nil.
+func (p *WalletPool) signer(address string) core.Signer {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, wallet := range p.wallets {
+		if wallet.signer.PublicKey().String() == address {
+			return wallet.signer
+		}
+	}
+	return nil
+}
@@ -0,0 +1,418 @@
+// Package connect provides connect-go interceptors to handle X402 payments
+// for Buf Connect services.
+//
+// Connect has no equivalent of HTTP 402, so the server interceptor reports a
+// missing payment with CodeFailedPrecondition and attaches the base64-encoded
+// JSON PaymentRequest in the X-Payment-Request error metadata header. Rejected
+// payments are reported with CodePermissionDenied and malformed authorizations
+// with CodeInvalidArgument. The client interceptor understands this contract and
+// retries unary calls with an X-Payment-Authorization header after paying.
+package connect
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"connectrpc.com/connect"
+	"github.com/openlibx402/go/openlibx402-core"
+	"github.com/openlibx402/go/openlibx402-server"
+)
+
+// PaymentRequestHeader is the error metadata header carrying the payment request.
+const PaymentRequestHeader = "X-Payment-Request"
+
+// Config holds global configuration for X402 interceptors.
+type Config = serverx402.Config
+
+// ConfigFromEnv reads a Config from X402_* environment variables (see
+// serverx402.ConfigFromEnv).
+func ConfigFromEnv() (*Config, error) {
+	return serverx402.ConfigFromEnv()
+}
+
+// ConfigFromFile reads a Config from a JSON, YAML, or TOML file (see
+// serverx402.ConfigFromFile).
+func ConfigFromFile(path string) (*Config, error) {
+	return serverx402.ConfigFromFile(path)
+}
+
+// PriceOverride adjusts the price of a procedure for a specific payer.
+type PriceOverride = serverx402.PriceOverride
+
+var globalServer *serverx402.Server
+
+// InitX402 initializes the global X402 configuration. It fails, leaving the
+// interceptor uninitialized, if the configuration is invalid (see
+// Config.Validate).
+//
+// This should be called once at application startup before using the interceptors.
+//
+// Example:
+//
+//	if err := connectx402.InitX402(&connectx402.Config{
+//	    PaymentAddress: "YOUR_WALLET_ADDRESS",
+//	    TokenMint:      "USDC_MINT_ADDRESS",
+//	    Network:        "solana-devnet",
+//	    AutoVerify:     true,
+//	}); err != nil {
+//	    log.Fatal(err)
+//	}
+func InitX402(config *Config) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	globalServer = serverx402.New(config)
+	return nil
+}
+
+// Reload atomically replaces the payment address and token mint configured
+// with InitX402 at runtime (see serverx402.Server.Reload).
+func Reload(config *Config) error {
+	if globalServer == nil {
+		return errors.New("X402 not initialized. Call InitX402() first.")
+	}
+	return globalServer.Reload(config)
+}
+
+// Shutdown gracefully stops the server configured with InitX402: it waits
+// for pending settlements, delivers queued webhooks, and persists in-memory
+// stores (see serverx402.Server.Shutdown).
+func Shutdown(ctx context.Context) error {
+	if globalServer == nil {
+		return nil
+	}
+	return globalServer.Shutdown(ctx)
+}
+
+// X402 is an instance of the X402 interceptors bound to its own configuration.
+//
+// Unlike InitX402, which configures the package-level interceptors, several
+// instances can coexist in one process (e.g., two wallets or networks).
+//
+// Example:
+//
+//	mainnet := connectx402.New(&connectx402.Config{
+//	    PaymentAddress: "MAINNET_WALLET_ADDRESS",
+//	    TokenMint:      "USDC_MINT_ADDRESS",
+//	    Network:        "solana-mainnet",
+//	})
+//	connect.WithInterceptors(mainnet.NewPaymentInterceptor(connectx402.PaymentRequiredOptions{Amount: "0.10"}))
+type X402 struct {
+	server *serverx402.Server
+}
+
+// New creates an instance with its own configuration.
+func New(config *Config) *X402 {
+	return &X402{server: serverx402.New(config)}
+}
+
+// Config returns the instance configuration.
+func (x *X402) Config() *Config {
+	return x.server.Config()
+}
+
+// Server returns the shared server core backing the instance.
+func (x *X402) Server() *serverx402.Server {
+	return x.server
+}
+
+// Reload atomically replaces the payment address and token mint of the
+// instance at runtime (see serverx402.Server.Reload).
+func (x *X402) Reload(config *Config) error {
+	return x.server.Reload(config)
+}
+
+// Shutdown gracefully stops the instance (see serverx402.Server.Shutdown).
+func (x *X402) Shutdown(ctx context.Context) error {
+	return x.server.Shutdown(ctx)
+}
+
+// PaymentRequiredOptions configures payment requirements for the procedures an interceptor guards.
+type PaymentRequiredOptions struct {
+	Amount         string // Required payment amount (e.g., "0.10")
+	PaymentAddress string // Optional override of global payment address
+	TokenMint      string // Optional override of global token mint
+	Network        string // Optional override of global network
+	Description    string // Human-readable description
+	ExpiresIn      int    // Expiration time in seconds (default: 300)
+	AutoVerify     bool   // Auto-verify payment on-chain (default: true)
+
+	// PriceFunc optionally computes the amount and description per call,
+	// overriding Amount and Description. Returning an empty amount makes the
+	// procedure free, which allows one interceptor to price a whole service.
+	PriceFunc func(ctx context.Context, spec connect.Spec, header http.Header) (amount string, description string, err error)
+
+	// Authorize optionally applies a per-payer policy. It is called with the payer's
+	// public key (from the authorization header, or the X-Payer-Public-Key header on
+	// the initial call) and may grant free access, apply a discount, or return an
+	// error to block the payer. Public keys are self-declared by the client, so free
+	// access should only be granted to payers authenticated by other means.
+	Authorize func(pubkey string) (PriceOverride, error)
+
+	// VolumePricing optionally prices by the payer's volume of verified
+	// payments, counted in Config.Store, e.g. cheaper calls after the first
+	// 100. The payer's tier is quoted if the call declares the payer in the
+	// X-Payer-Public-Key header.
+	VolumePricing *serverx402.VolumePricing
+
+	// FiatAmount optionally sets the price in fiat, e.g. "0.10" USD, which is
+	// converted to a token amount with Config.PriceOracle when the payment
+	// request is issued. It replaces Amount. Currency overrides
+	// Config.Currency.
+	FiatAmount string
+	Currency   string
+
+	// AcceptedTokens optionally accepts other tokens besides TokenMint, each
+	// at its own price, e.g. USDT and BONK next to USDC. The 402 response
+	// lists them, and payments in any of them are accepted.
+	AcceptedTokens []core.TokenPrice
+
+	// Splits optionally pays percentages of the price to other recipients,
+	// e.g. 80% to a creator; PaymentAddress receives the rest.
+	Splits []core.PaymentSplit
+
+	// Escrow optionally asks payers to deposit the payment into an escrow
+	// program and release it once the response is delivered. Requires a
+	// Config.Processor implementing core.EscrowProcessor.
+	Escrow bool
+}
+
+// paymentInterceptor is the server-side payment interceptor.
+type paymentInterceptor struct {
+	getServer func() *serverx402.Server
+	opts      PaymentRequiredOptions
+}
+
+// NewPaymentInterceptor returns a server interceptor that requires payment for
+// every procedure of the handler it is installed on.
+//
+// Usage:
+//
+//	path, handler := greetv1connect.NewGreetServiceHandler(
+//	    &GreetServer{},
+//	    connect.WithInterceptors(connectx402.NewPaymentInterceptor(connectx402.PaymentRequiredOptions{
+//	        Amount: "0.10",
+//	    })),
+//	)
+func NewPaymentInterceptor(opts PaymentRequiredOptions) connect.Interceptor {
+	return &paymentInterceptor{getServer: func() *serverx402.Server { return globalServer }, opts: opts}
+}
+
+// NewPaymentInterceptor returns a server interceptor that requires payment using the instance configuration.
+func (x *X402) NewPaymentInterceptor(opts PaymentRequiredOptions) connect.Interceptor {
+	return &paymentInterceptor{getServer: func() *serverx402.Server { return x.server }, opts: opts}
+}
+
+// WrapUnary implements connect.Interceptor.
+func (i *paymentInterceptor) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
+	return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		if req.Spec().IsClient {
+			return next(ctx, req)
+		}
+		ctx, err := i.check(ctx, req.Spec(), req.Peer(), req.Header())
+		if err != nil {
+			return nil, err
+		}
+		return next(ctx, req)
+	}
+}
+
+// WrapStreamingClient implements connect.Interceptor.
+func (i *paymentInterceptor) WrapStreamingClient(next connect.StreamingClientFunc) connect.StreamingClientFunc {
+	return next
+}
+
+// WrapStreamingHandler implements connect.Interceptor.
+//
+// Payment is checked once, when the stream is opened.
+func (i *paymentInterceptor) WrapStreamingHandler(next connect.StreamingHandlerFunc) connect.StreamingHandlerFunc {
+	return func(ctx context.Context, conn connect.StreamingHandlerConn) error {
+		ctx, err := i.check(ctx, conn.Spec(), conn.Peer(), conn.RequestHeader())
+		if err != nil {
+			return err
+		}
+		return next(ctx, conn)
+	}
+}
+
+// check verifies the payment for a call and returns a context carrying the authorization.
+func (i *paymentInterceptor) check(ctx context.Context, spec connect.Spec, peer connect.Peer, header http.Header) (context.Context, error) {
+	opts := i.opts
+
+	server := i.getServer()
+	if server == nil {
+		return ctx, connect.NewError(connect.CodeInternal, errors.New("X402 not initialized. Call InitX402() first."))
+	}
+
+	// Determine price (dynamic pricing takes precedence)
+	amount := opts.Amount
+	description := opts.Description
+	if opts.PriceFunc != nil {
+		var err error
+		amount, description, err = opts.PriceFunc(ctx, spec, header)
+		if err != nil {
+			return ctx, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("unable to determine price: %w", err))
+		}
+		if amount == "" {
+			return ctx, nil
+		}
+	}
+
+	result := server.Process(serverx402.Request{
+		Context:  ctx,
+		Resource: spec.Procedure,
+		Header:   header.Get,
+		ClientIP: serverx402.RemoteIP(peer.Addr),
+	}, serverx402.Options{
+		Amount:         amount,
+		PaymentAddress: opts.PaymentAddress,
+		TokenMint:      opts.TokenMint,
+		Network:        opts.Network,
+		Description:    description,
+		ExpiresIn:      opts.ExpiresIn,
+		Authorize:      opts.Authorize,
+		VolumePricing:  opts.VolumePricing,
+		FiatAmount:     opts.FiatAmount,
+		Currency:       opts.Currency,
+		AcceptedTokens: opts.AcceptedTokens,
+		Splits:         opts.Splits,
+		Escrow:         opts.Escrow,
+	})
+	if !result.Allowed() {
+		return ctx, rejectionError(result)
+	}
+
+	// Payment verified, attach to context and continue
+	if result.Payer != "" {
+		ctx = context.WithValue(ctx, payerKey, result.Payer)
+	}
+	if result.Authorization != nil {
+		ctx = context.WithValue(ctx, paymentAuthKey, result.Authorization)
+	}
+	return ctx, nil
+}
+
+// rejectionError maps a rejected pipeline result to a Connect error.
+func rejectionError(result *serverx402.Result) error {
+	switch result.Status {
+	case http.StatusPaymentRequired:
+		return newPaymentRequiredError(result.PaymentRequest)
+	case http.StatusBadRequest:
+		return connect.NewError(connect.CodeInvalidArgument, result.Err())
+	case http.StatusForbidden:
+		return connect.NewError(connect.CodePermissionDenied, result.Err())
+	case http.StatusTooManyRequests:
+		return connect.NewError(connect.CodeResourceExhausted, result.Err())
+	default:
+		return connect.NewError(connect.CodeInternal, result.Err())
+	}
+}
+
+// contextKey is the type of context keys used by this package.
+type contextKey string
+
+// paymentAuthKey is the context key for PaymentAuthorization, and payerKey
+// that of the verified payer.
+const (
+	paymentAuthKey contextKey = "payment_authorization"
+	payerKey       contextKey = "payer"
+)
+
+// GetPaymentAuthorization retrieves the PaymentAuthorization from the handler context.
+func GetPaymentAuthorization(ctx context.Context) *core.PaymentAuthorization {
+	if auth, ok := ctx.Value(paymentAuthKey).(*core.PaymentAuthorization); ok {
+		return auth
+	}
+	return nil
+}
+
+// PayerID returns the public key of the verified payer from a handler
+// context, set when the call proceeds on a payment, or a session,
+// subscription, quota token, or voucher of one (see
+// serverx402.Result.Payer). It returns "" for free access.
+func PayerID(ctx context.Context) string {
+	payer, _ := ctx.Value(payerKey).(string)
+	return payer
+}
+
+// newPaymentRequiredError builds the error returned when a call requires payment.
+func newPaymentRequiredError(paymentReq *core.PaymentRequest) error {
+	err := connect.NewError(connect.CodeFailedPrecondition, core.NewPaymentRequiredError(paymentReq, ""))
+	if data, jsonErr := paymentReq.ToJSON(); jsonErr == nil {
+		err.Meta().Set(PaymentRequestHeader, base64.StdEncoding.EncodeToString([]byte(data)))
+	}
+	return err
+}
+
+// PaymentRequestFromError extracts the PaymentRequest from an error returned by
+// a payment-protected procedure.
+func PaymentRequestFromError(err error) (*core.PaymentRequest, bool) {
+	var connectErr *connect.Error
+	if !errors.As(err, &connectErr) || connectErr.Code() != connect.CodeFailedPrecondition {
+		return nil, false
+	}
+	encoded := connectErr.Meta().Get(PaymentRequestHeader)
+	if encoded == "" {
+		return nil, false
+	}
+	data, decodeErr := base64.StdEncoding.DecodeString(encoded)
+	if decodeErr != nil {
+		return nil, false
+	}
+	paymentReq, parseErr := core.PaymentRequestFromJSON(string(data))
+	if parseErr != nil {
+		return nil, false
+	}
+	return paymentReq, true
+}
+
+// PayFunc creates a payment for a payment request, e.g. X402Client.CreatePayment.
+type PayFunc func(ctx context.Context, request *core.PaymentRequest) (*core.PaymentAuthorization, error)
+
+// NewClientInterceptor returns a client interceptor that pays for unary calls
+// rejected with a payment request and retries them with the X-Payment-Authorization header.
+//
+// Usage:
+//
+//	x402Client := client.NewX402Client(walletKeypair, "", nil, false)
+//	interceptor := connectx402.NewClientInterceptor(func(ctx context.Context, req *core.PaymentRequest) (*core.PaymentAuthorization, error) {
+//	    return x402Client.CreatePayment(ctx, req, "")
+//	})
+//	greetClient := greetv1connect.NewGreetServiceClient(http.DefaultClient, url, connect.WithInterceptors(interceptor))
+func NewClientInterceptor(pay PayFunc) connect.UnaryInterceptorFunc {
+	return NewClientInterceptorWithHeader(pay, core.DefaultAuthorizationHeader)
+}
+
+// NewClientInterceptorWithHeader is like NewClientInterceptor but sends the
+// authorization in the named header, for servers configured with a custom
+// Config.AuthorizationHeader.
+func NewClientInterceptorWithHeader(pay PayFunc, header string) connect.UnaryInterceptorFunc {
+	return func(next connect.UnaryFunc) connect.UnaryFunc {
+		return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+			resp, err := next(ctx, req)
+			if err == nil || !req.Spec().IsClient {
+				return resp, err
+			}
+
+			paymentReq, ok := PaymentRequestFromError(err)
+			if !ok {
+				return resp, err
+			}
+
+			authorization, payErr := pay(ctx, paymentReq)
+			if payErr != nil {
+				return nil, payErr
+			}
+
+			headerValue, encodeErr := authorization.ToHeaderValue()
+			if encodeErr != nil {
+				return nil, fmt.Errorf("failed to encode payment authorization: %w", encodeErr)
+			}
+			req.Header().Set(header, headerValue)
+			return next(ctx, req)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// attestationDomain prefixes signed payloads so that an attestation signature
+// is not valid for any other purpose, such as a transaction.
+const attestationDomain = "x402-authorization-v1:"
+
+// CanonicalPayload returns the message a payer signs to attest to a payment
+// authorization. It covers every field except Signature: the payment ID,
+// amount, recipient, token, network, timestamp, payer, and transaction hash,
+// so the authorization is attested only once the transaction is sent.
+func (pa *PaymentAuthorization) CanonicalPayload() []byte {
+	// A JSON array encodes the fields unambiguously
+	fields, _ := json.Marshal([]string{
+		pa.PaymentID,
+		pa.ActualAmount,
+		pa.PaymentAddress,
+		pa.AssetAddress,
+		pa.Network,
+		pa.Timestamp.UTC().Format(time.RFC3339Nano),
+		pa.PublicKey,
+		pa.TransactionHash,
+	})
+	return append([]byte(attestationDomain), fields...)
+}
+
+// Attest sets PublicKey to the signer's public key and Signature to its
+// signature of the authorization's canonical payload (see CanonicalPayload).
+// Servers check it with VerifyAttestation, so that a header cannot claim a
+// payer, amount, or request the holder of the key did not sign.
+func (pa *PaymentAuthorization) Attest(ctx context.Context, signer Signer) error {
+	pa.PublicKey = signer.PublicKey().String()
+	signature, err := signer.SignMessage(ctx, pa.CanonicalPayload())
+	if err != nil {
+		return err
+	}
+	pa.Signature = signature.String()
+	return nil
+}
+
+// VerifyAttestation returns a *PaymentVerificationError unless Signature is
+// an ed25519 signature of the authorization's canonical payload by
+// PublicKey (see Attest). It makes no RPC calls, so servers can reject
+// spoofed headers before looking up the transaction.
+func (pa *PaymentAuthorization) VerifyAttestation() error {
+	publicKey, err := solana.PublicKeyFromBase58(pa.PublicKey)
+	if err != nil {
+		return NewPaymentVerificationError("invalid payer public key: " + err.Error())
+	}
+	signature, err := solana.SignatureFromBase58(pa.Signature)
+	if err != nil {
+		return NewPaymentVerificationError("invalid attestation signature: " + err.Error())
+	}
+	if !signature.Verify(publicKey, pa.CanonicalPayload()) {
+		return NewPaymentVerificationError("attestation signature does not match the authorization")
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package core
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+func TestAttestationCoversTransactionHash(t *testing.T) {
+	authorization := &PaymentAuthorization{
+		PaymentID:       "payment",
+		ActualAmount:    "0.10",
+		PaymentAddress:  solana.NewWallet().PublicKey().String(),
+		AssetAddress:    solana.NewWallet().PublicKey().String(),
+		Network:         "solana-devnet",
+		Timestamp:       time.Now().UTC(),
+		TransactionHash: "tx1",
+	}
+	if err := authorization.Attest(context.Background(), NewKeypairSigner(solana.NewWallet().PrivateKey)); err != nil {
+		t.Fatal(err)
+	}
+	if err := authorization.VerifyAttestation(); err != nil {
+		t.Fatalf("VerifyAttestation() = %v, want nil", err)
+	}
+
+	// Another transaction claimed under the payer's signature
+	authorization.TransactionHash = "tx2"
+	if err := authorization.VerifyAttestation(); err == nil {
+		t.Error("VerifyAttestation() with a changed transaction hash = nil, want error")
+	}
+}
+
+func TestAttestationRejectsOtherSigner(t *testing.T) {
+	authorization := &PaymentAuthorization{PaymentID: "payment", Timestamp: time.Now().UTC(), TransactionHash: "tx1"}
+	if err := authorization.Attest(context.Background(), NewKeypairSigner(solana.NewWallet().PrivateKey)); err != nil {
+		t.Fatal(err)
+	}
+	authorization.PublicKey = solana.NewWallet().PublicKey().String()
+	if err := authorization.VerifyAttestation(); err == nil {
+		t.Error("VerifyAttestation() claiming another payer = nil, want error")
+	}
+}
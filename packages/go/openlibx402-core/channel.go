@@ -0,0 +1,106 @@
+package core
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// voucherDomain prefixes signed vouchers so that a voucher signature is not
+// valid for any other purpose, such as an attestation or a transaction.
+const voucherDomain = "x402-voucher-v1:"
+
+// ChannelTerms offer a payment channel for a resource (see
+// PaymentRequest.Channel). A payment of at least Deposit opens a channel
+// whose balance pays later requests to the payment address with signed
+// vouchers instead of on-chain transfers. The server refunds what is left of
+// the deposit when the channel is closed or expires.
+type ChannelTerms struct {
+	Deposit   string `json:"deposit"`    // Minimum deposit in token units
+	ExpiresIn int    `json:"expires_in"` // Seconds a channel stays open
+}
+
+// Voucher authorizes a payment from a payment channel, or a charge to a tab
+// (see TabTerms). Amount is cumulative: the total the payer has spent from
+// the channel or charged to the tab including this request, so that a server
+// only needs the latest voucher and a replayed one pays nothing.
+type Voucher struct {
+	ChannelID string `json:"channel_id"`      // Channel ID returned when the channel was opened, or a TabID
+	Amount    string `json:"amount"`          // Total spent from the channel or charged to the tab, in token units
+	Close     bool   `json:"close,omitempty"` // Close the channel after this request, or settle the tab
+	PublicKey string `json:"public_key"`      // Payer's public key
+	Signature string `json:"signature"`       // Payer's signature of CanonicalPayload
+}
+
+// CanonicalPayload returns the message a payer signs for a voucher: the
+// channel ID, amount, close flag, and payer.
+func (v *Voucher) CanonicalPayload() []byte {
+	closing := "open"
+	if v.Close {
+		closing = "close"
+	}
+	// A JSON array encodes the fields unambiguously
+	fields, _ := json.Marshal([]string{v.ChannelID, v.Amount, closing, v.PublicKey})
+	return append([]byte(voucherDomain), fields...)
+}
+
+// NewVoucher returns a voucher for a cumulative amount spent from a channel,
+// signed by signer.
+func NewVoucher(ctx context.Context, signer Signer, channelID, amount string, close bool) (*Voucher, error) {
+	voucher := &Voucher{
+		ChannelID: channelID,
+		Amount:    amount,
+		Close:     close,
+		PublicKey: signer.PublicKey().String(),
+	}
+	signature, err := signer.SignMessage(ctx, voucher.CanonicalPayload())
+	if err != nil {
+		return nil, err
+	}
+	voucher.Signature = signature.String()
+	return voucher, nil
+}
+
+// Verify returns a *PaymentVerificationError unless Signature is an ed25519
+// signature of the voucher's canonical payload by PublicKey. Servers also
+// check that PublicKey opened the channel.
+func (v *Voucher) Verify() error {
+	publicKey, err := solana.PublicKeyFromBase58(v.PublicKey)
+	if err != nil {
+		return NewPaymentVerificationError("invalid payer public key: " + err.Error())
+	}
+	signature, err := solana.SignatureFromBase58(v.Signature)
+	if err != nil {
+		return NewPaymentVerificationError("invalid voucher signature: " + err.Error())
+	}
+	if !signature.Verify(publicKey, v.CanonicalPayload()) {
+		return NewPaymentVerificationError("voucher signature does not match the voucher")
+	}
+	return nil
+}
+
+// ToHeaderValue encodes the voucher as a base64-encoded JSON string for the
+// X-Payment-Voucher header.
+func (v *Voucher) ToHeaderValue() (string, error) {
+	jsonData, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(jsonData), nil
+}
+
+// VoucherFromHeader parses a Voucher from the X-Payment-Voucher header value.
+func VoucherFromHeader(headerValue string) (*Voucher, error) {
+	decoded, err := base64.StdEncoding.DecodeString(headerValue)
+	if err != nil {
+		return nil, NewInvalidPaymentRequestError("failed to decode base64: " + err.Error())
+	}
+
+	var v Voucher
+	if err := json.Unmarshal(decoded, &v); err != nil {
+		return nil, NewInvalidPaymentRequestError("failed to parse voucher: " + err.Error())
+	}
+	return &v, nil
+}
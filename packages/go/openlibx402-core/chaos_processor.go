@@ -0,0 +1,199 @@
+package core
+
+import (
+	"context"
+	"log/slog"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+// ChaosConfig configures the failures a ChaosProcessor injects. Rates are
+// probabilities from 0 (never) to 1 (always); a zero config injects nothing.
+type ChaosConfig struct {
+	// BroadcastLatency delays every SignAndSendTransactionWithSigner call,
+	// plus a random extra delay of up to BroadcastJitter.
+	BroadcastLatency time.Duration
+	BroadcastJitter  time.Duration
+	// BroadcastErrorRate fails broadcasts before the transaction is sent.
+	BroadcastErrorRate float64
+	// BroadcastLossRate sends the transaction but fails the broadcast, as
+	// when the RPC node's response is lost, so the payment settles although
+	// the payer saw an error.
+	BroadcastLossRate float64
+	// BroadcastErrors are the errors of failed broadcasts, picked at random
+	// (default: ErrMockBlockhashExpired and ErrMockRPCTimeout).
+	BroadcastErrors []error
+
+	// VerifyLatency delays every VerifyTransfer call, plus a random extra
+	// delay of up to VerifyJitter.
+	VerifyLatency time.Duration
+	VerifyJitter  time.Duration
+	// VerifyErrorRate fails verifications without looking the transaction
+	// up.
+	VerifyErrorRate float64
+	// VerifyErrors are the errors of failed verifications, picked at random
+	// (default: rpc.ErrNotFound and ErrMockRPCTimeout).
+	VerifyErrors []error
+
+	// Seed seeds the random failures, so that runs with the same seed fail
+	// the same calls (default: random).
+	Seed int64
+
+	Logger *slog.Logger // Logs of injected failures (default: discard)
+}
+
+// ChaosStats counts the calls of a ChaosProcessor and the failures injected
+// into them.
+type ChaosStats struct {
+	Broadcasts           int
+	BroadcastFailures    int // Including lost broadcasts
+	Verifications        int
+	VerificationFailures int
+}
+
+// ChaosProcessor wraps a PaymentProcessor to inject latency and errors into
+// broadcasts and verifications, for testing that agents and servers recover
+// from a slow or unreliable cluster. Other methods are passed through.
+//
+// Errors without an X402 error code are wrapped in the error type
+// SolanaPaymentProcessor returns, as with MockProcessor.FailNext.
+//
+// Example:
+//
+//	processor := core.NewChaosProcessor(core.NewMockProcessor(), core.ChaosConfig{
+//	    BroadcastLatency:   200 * time.Millisecond,
+//	    BroadcastErrorRate: 0.2,
+//	    VerifyErrorRate:    0.1,
+//	})
+type ChaosProcessor struct {
+	PaymentProcessor
+	config ChaosConfig
+	logger *slog.Logger
+
+	mu    sync.Mutex
+	rand  *rand.Rand
+	stats ChaosStats
+}
+
+// NewChaosProcessor wraps processor with the failures of config.
+func NewChaosProcessor(processor PaymentProcessor, config ChaosConfig) *ChaosProcessor {
+	if len(config.BroadcastErrors) == 0 {
+		config.BroadcastErrors = []error{ErrMockBlockhashExpired, ErrMockRPCTimeout}
+	}
+	if len(config.VerifyErrors) == 0 {
+		config.VerifyErrors = []error{rpc.ErrNotFound, ErrMockRPCTimeout}
+	}
+	seed := config.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return &ChaosProcessor{
+		PaymentProcessor: processor,
+		config:           config,
+		logger:           LoggerOrDiscard(config.Logger),
+		rand:             rand.New(rand.NewSource(seed)),
+	}
+}
+
+// Stats returns the calls made and failures injected so far.
+func (c *ChaosProcessor) Stats() ChaosStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
+
+// SignAndSendTransactionWithSigner implements PaymentProcessor.
+func (c *ChaosProcessor) SignAndSendTransactionWithSigner(ctx context.Context, tx *solana.Transaction, signer Signer) (string, error) {
+	c.mu.Lock()
+	c.stats.Broadcasts++
+	delay := c.delay(c.config.BroadcastLatency, c.config.BroadcastJitter)
+	failure := c.pick(c.config.BroadcastErrorRate, c.config.BroadcastErrors)
+	var loss error
+	if failure == nil {
+		loss = c.pick(c.config.BroadcastLossRate, c.config.BroadcastErrors)
+	}
+	if failure != nil || loss != nil {
+		c.stats.BroadcastFailures++
+	}
+	c.mu.Unlock()
+
+	wrap := func(reason string) error {
+		return NewTransactionBroadcastError("failed to send transaction: " + reason)
+	}
+	if err := sleepContext(ctx, delay); err != nil {
+		return "", wrapInjected(err, wrap)
+	}
+	if failure != nil {
+		c.logger.Info("x402: chaos injected broadcast failure", "error", failure)
+		return "", wrapInjected(failure, wrap)
+	}
+	txHash, err := c.PaymentProcessor.SignAndSendTransactionWithSigner(ctx, tx, signer)
+	if err == nil && loss != nil {
+		c.logger.Info("x402: chaos dropped broadcast response", LogKeyTxHash, txHash, "error", loss)
+		return "", wrapInjected(loss, wrap)
+	}
+	return txHash, err
+}
+
+// VerifyTransfer implements PaymentProcessor.
+func (c *ChaosProcessor) VerifyTransfer(ctx context.Context, transactionHash, expectedRecipient, expectedTokenMint, expectedMemo string) (*VerifiedTransfer, error) {
+	c.mu.Lock()
+	c.stats.Verifications++
+	delay := c.delay(c.config.VerifyLatency, c.config.VerifyJitter)
+	failure := c.pick(c.config.VerifyErrorRate, c.config.VerifyErrors)
+	if failure != nil {
+		c.stats.VerificationFailures++
+	}
+	c.mu.Unlock()
+
+	wrap := func(reason string) error {
+		return NewPaymentVerificationError("transaction not found: " + reason)
+	}
+	if err := sleepContext(ctx, delay); err != nil {
+		return nil, wrapInjected(err, wrap)
+	}
+	if failure != nil {
+		c.logger.Info("x402: chaos injected verification failure", LogKeyTxHash, transactionHash, "error", failure)
+		return nil, wrapInjected(failure, wrap)
+	}
+	return c.PaymentProcessor.VerifyTransfer(ctx, transactionHash, expectedRecipient, expectedTokenMint, expectedMemo)
+}
+
+// delay returns latency plus a random jitter. The caller holds c.mu.
+func (c *ChaosProcessor) delay(latency, jitter time.Duration) time.Duration {
+	if jitter > 0 {
+		latency += time.Duration(c.rand.Int63n(int64(jitter) + 1))
+	}
+	return latency
+}
+
+// pick returns one of errs with probability rate, or nil. The caller holds
+// c.mu.
+func (c *ChaosProcessor) pick(rate float64, errs []error) error {
+	if rate <= 0 || c.rand.Float64() >= rate {
+		return nil
+	}
+	return errs[c.rand.Intn(len(errs))]
+}
+
+// sleepContext waits for d, or returns the error of ctx if it is done
+// first.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+var _ PaymentProcessor = (*ChaosProcessor)(nil)
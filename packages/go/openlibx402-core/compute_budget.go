@@ -0,0 +1,55 @@
+package core
+
+import (
+	"context"
+
+	"github.com/gagliardetto/solana-go"
+	computebudget "github.com/gagliardetto/solana-go/programs/compute-budget"
+)
+
+// ComputeBudget sets the compute budget of payment transactions. A priority
+// fee makes payments land reliably while the network is congested.
+//
+// Zero fields are not set, leaving the network defaults.
+type ComputeBudget struct {
+	UnitPrice uint64 // Priority fee in micro-lamports per compute unit
+	UnitLimit uint32 // Maximum compute units the transaction may consume
+}
+
+// computeBudgetKey is the context key for a per-payment ComputeBudget.
+type computeBudgetKey struct{}
+
+// WithComputeBudget returns a context that overrides the processor's compute
+// budget for payments created with it.
+//
+// Example:
+//
+//	// Pay with a higher priority fee for this request only
+//	ctx = core.WithComputeBudget(ctx, core.ComputeBudget{UnitPrice: 50_000})
+//	resp, err := autoClient.Get(ctx, url)
+func WithComputeBudget(ctx context.Context, budget ComputeBudget) context.Context {
+	return context.WithValue(ctx, computeBudgetKey{}, budget)
+}
+
+// SetComputeBudget sets the default compute budget of payment transactions.
+func (sp *SolanaPaymentProcessor) SetComputeBudget(budget ComputeBudget) {
+	sp.computeBudget = budget
+}
+
+// computeBudgetInstructions returns the compute budget instructions for a
+// payment, preferring a budget set on the context.
+func (sp *SolanaPaymentProcessor) computeBudgetInstructions(ctx context.Context) []solana.Instruction {
+	budget := sp.computeBudget
+	if override, ok := ctx.Value(computeBudgetKey{}).(ComputeBudget); ok {
+		budget = override
+	}
+
+	var instructions []solana.Instruction
+	if budget.UnitLimit > 0 {
+		instructions = append(instructions, computebudget.NewSetComputeUnitLimitInstruction(budget.UnitLimit).Build())
+	}
+	if budget.UnitPrice > 0 {
+		instructions = append(instructions, computebudget.NewSetComputeUnitPriceInstruction(budget.UnitPrice).Build())
+	}
+	return instructions
+}
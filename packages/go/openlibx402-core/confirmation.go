@@ -0,0 +1,152 @@
+package core
+
+import (
+	"context"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+// Commitment is the level of confirmation a transaction has reached.
+type Commitment = rpc.CommitmentType
+
+// Commitment levels, from fastest to most final.
+const (
+	CommitmentProcessed = rpc.CommitmentProcessed // Seen by the RPC node; may be rolled back
+	CommitmentConfirmed = rpc.CommitmentConfirmed // Voted on by a supermajority of the cluster
+	CommitmentFinalized = rpc.CommitmentFinalized // Rooted; cannot be rolled back
+)
+
+// DefaultConfirmationTimeout bounds WaitForConfirmation when the context has
+// no deadline. It is about the lifetime of a blockhash, after which a
+// transaction that has not landed never will.
+const DefaultConfirmationTimeout = 90 * time.Second
+
+// SetCommitment sets the commitment transactions must reach to be verified,
+// and the default of WaitForConfirmation.
+func (sp *SolanaPaymentProcessor) SetCommitment(commitment Commitment) {
+	sp.commitment = commitment
+}
+
+// SetWebSocketURL sets the RPC node's WebSocket endpoint (see
+// ProcessorOptions.WSURL). An empty URL disables subscriptions.
+func (sp *SolanaPaymentProcessor) SetWebSocketURL(wsURL string) {
+	sp.closeWebSocket()
+	sp.wsURL = wsURL
+}
+
+// defaultCommitment returns the configured commitment (default: confirmed).
+func (sp *SolanaPaymentProcessor) defaultCommitment() Commitment {
+	if sp.commitment == "" {
+		return CommitmentConfirmed
+	}
+	return sp.commitment
+}
+
+// verifyCommitment returns the commitment used to fetch transactions, which
+// the RPC node requires to be at least confirmed.
+func (sp *SolanaPaymentProcessor) verifyCommitment() Commitment {
+	if sp.defaultCommitment() == CommitmentFinalized {
+		return CommitmentFinalized
+	}
+	return CommitmentConfirmed
+}
+
+// WaitForConfirmation blocks until a transaction reaches commitment (default:
+// the processor's commitment). It subscribes to the signature if a WebSocket
+// endpoint is configured and polls the RPC node otherwise, or if the
+// subscription fails.
+//
+// A transaction that failed on-chain returns a *TransactionBroadcastError, as
+// does one that is not confirmed before ctx ends (or DefaultConfirmationTimeout
+// elapses if ctx has no deadline).
+//
+// Example:
+//
+//	txHash, err := processor.SignAndSendTransaction(ctx, tx, keypair)
+//	if err != nil {
+//	    return err
+//	}
+//	if err := processor.WaitForConfirmation(ctx, txHash, core.CommitmentFinalized); err != nil {
+//	    return err
+//	}
+func (sp *SolanaPaymentProcessor) WaitForConfirmation(ctx context.Context, signature string, commitment Commitment) error {
+	sig, err := solana.SignatureFromBase58(signature)
+	if err != nil {
+		return NewTransactionBroadcastError("invalid transaction signature: " + err.Error())
+	}
+	if commitment == "" {
+		commitment = sp.defaultCommitment()
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, DefaultConfirmationTimeout)
+		defer cancel()
+	}
+
+	if sp.wsURL != "" {
+		if done, err := sp.subscribeConfirmation(ctx, sig, commitment); done {
+			return err
+		}
+	}
+	return sp.pollConfirmation(ctx, sig, commitment)
+}
+
+// pollConfirmation polls the signature status until it reaches commitment.
+func (sp *SolanaPaymentProcessor) pollConfirmation(ctx context.Context, sig solana.Signature, commitment Commitment) error {
+	interval := sp.pollInterval
+	if interval <= 0 {
+		interval = 500 * time.Millisecond
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if confirmed, err := sp.checkConfirmation(ctx, sig, commitment); confirmed || err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return NewTransactionBroadcastError("transaction not confirmed: " + ctx.Err().Error())
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkConfirmation reports whether a signature has reached commitment. It
+// returns an error only if the transaction failed on-chain; RPC errors are
+// logged and reported as not yet confirmed.
+func (sp *SolanaPaymentProcessor) checkConfirmation(ctx context.Context, sig solana.Signature, commitment Commitment) (bool, error) {
+	out, err := sp.client.GetSignatureStatuses(ctx, false, sig)
+	if err != nil {
+		sp.logger.Debug("x402: signature status lookup failed", LogKeyTxHash, sig.String(), "error", err)
+		return false, nil
+	}
+	if len(out.Value) == 0 || out.Value[0] == nil {
+		return false, nil
+	}
+	status := out.Value[0]
+	if status.Err != nil {
+		sp.logger.Warn("x402: transaction failed on-chain", LogKeyTxHash, sig.String(), "error", status.Err)
+		return false, NewTransactionBroadcastError("transaction failed on-chain")
+	}
+	if confirmationLevel(string(status.ConfirmationStatus)) < confirmationLevel(string(commitment)) {
+		return false, nil
+	}
+	sp.logger.Debug("x402: transaction confirmed", LogKeyTxHash, sig.String(), "commitment", commitment)
+	return true, nil
+}
+
+// confirmationLevel orders commitment levels.
+func confirmationLevel(level string) int {
+	switch Commitment(level) {
+	case CommitmentProcessed:
+		return 1
+	case CommitmentConfirmed:
+		return 2
+	case CommitmentFinalized:
+		return 3
+	}
+	return 0
+}
@@ -1,12 +1,22 @@
 package core
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+)
 
 // X402Error is the base error type for all X402 protocol errors.
+//
+// The typed errors below embed it and unwrap to it, so errors.As with an
+// *X402Error matches any of them, and errors.Is matches them against the
+// sentinel of their code (e.g. ErrPaymentExpired).
 type X402Error struct {
 	Message string
 	Code    string
 	Details map[string]interface{}
+
+	// Cause is the underlying error, if any, returned by Unwrap.
+	Cause error
 }
 
 // Error implements the error interface.
@@ -14,6 +24,47 @@ func (e *X402Error) Error() string {
 	return fmt.Sprintf("[%s] %s", e.Code, e.Message)
 }
 
+// Unwrap returns the underlying error.
+func (e *X402Error) Unwrap() error {
+	return e.Cause
+}
+
+// Is reports whether target is an *X402Error with the same code, so that
+// errors.Is matches errors against the sentinels below.
+func (e *X402Error) Is(target error) bool {
+	t, ok := target.(*X402Error)
+	return ok && t.Code == e.Code
+}
+
+// Sentinels for errors.Is, one per error code.
+var (
+	ErrPaymentRequired            = &X402Error{Code: "PAYMENT_REQUIRED", Message: "payment required"}
+	ErrPaymentExpired             = &X402Error{Code: "PAYMENT_EXPIRED", Message: "payment request expired"}
+	ErrInsufficientFunds          = &X402Error{Code: "INSUFFICIENT_FUNDS", Message: "insufficient funds"}
+	ErrInsufficientFeeBalance     = &X402Error{Code: "INSUFFICIENT_FEE_BALANCE", Message: "insufficient SOL for fees"}
+	ErrPaymentVerificationFailed  = &X402Error{Code: "PAYMENT_VERIFICATION_FAILED", Message: "payment verification failed"}
+	ErrTransactionBroadcastFailed = &X402Error{Code: "TRANSACTION_BROADCAST_FAILED", Message: "transaction broadcast failed"}
+	ErrInvalidPaymentRequest      = &X402Error{Code: "INVALID_PAYMENT_REQUEST", Message: "invalid payment request"}
+	ErrBudgetExceeded             = &X402Error{Code: "BUDGET_EXCEEDED", Message: "budget exceeded"}
+	ErrInternal                   = &X402Error{Code: "INTERNAL_ERROR", Message: "internal error"}
+)
+
+// ErrorCodeOf returns the code of the first X402 error in err's chain, or ""
+// if there is none.
+func ErrorCodeOf(err error) string {
+	var x402Err *X402Error
+	if errors.As(err, &x402Err) {
+		return x402Err.Code
+	}
+	return ""
+}
+
+// IsRetryable reports whether err has an error code that ErrorCodes marks as
+// retryable.
+func IsRetryable(err error) bool {
+	return ErrorCodes[ErrorCodeOf(err)].Retry
+}
+
 // NewX402Error creates a new X402Error.
 func NewX402Error(message, code string, details map[string]interface{}) *X402Error {
 	if details == nil {
@@ -46,6 +97,11 @@ func NewPaymentRequiredError(paymentRequest *PaymentRequest, message string) *Pa
 	}
 }
 
+// Unwrap returns the embedded X402Error.
+func (e *PaymentRequiredError) Unwrap() error {
+	return e.X402Error
+}
+
 // PaymentExpiredError indicates that a payment request has expired.
 type PaymentExpiredError struct {
 	*X402Error
@@ -66,6 +122,11 @@ func NewPaymentExpiredError(paymentRequest *PaymentRequest, message string) *Pay
 	}
 }
 
+// Unwrap returns the embedded X402Error.
+func (e *PaymentExpiredError) Unwrap() error {
+	return e.X402Error
+}
+
 // InsufficientFundsError indicates that the wallet has insufficient funds.
 type InsufficientFundsError struct {
 	*X402Error
@@ -87,6 +148,39 @@ func NewInsufficientFundsError(requiredAmount, availableAmount string) *Insuffic
 	}
 }
 
+// Unwrap returns the embedded X402Error.
+func (e *InsufficientFundsError) Unwrap() error {
+	return e.X402Error
+}
+
+// InsufficientFeeBalanceError indicates that the wallet has too little SOL to
+// pay the transaction fee and, if the recipient's token account must be
+// created, its rent.
+type InsufficientFeeBalanceError struct {
+	*X402Error
+	RequiredLamports  uint64 // Fee plus rent
+	AvailableLamports uint64 // SOL balance of the wallet
+}
+
+// NewInsufficientFeeBalanceError creates a new InsufficientFeeBalanceError.
+func NewInsufficientFeeBalanceError(requiredLamports, availableLamports uint64) *InsufficientFeeBalanceError {
+	message := fmt.Sprintf("Insufficient SOL for transaction fees: need %d lamports, have %d", requiredLamports, availableLamports)
+	details := map[string]interface{}{
+		"required_lamports":  requiredLamports,
+		"available_lamports": availableLamports,
+	}
+	return &InsufficientFeeBalanceError{
+		X402Error:         NewX402Error(message, "INSUFFICIENT_FEE_BALANCE", details),
+		RequiredLamports:  requiredLamports,
+		AvailableLamports: availableLamports,
+	}
+}
+
+// Unwrap returns the embedded X402Error.
+func (e *InsufficientFeeBalanceError) Unwrap() error {
+	return e.X402Error
+}
+
 // PaymentVerificationError indicates that payment verification failed.
 type PaymentVerificationError struct {
 	*X402Error
@@ -105,6 +199,11 @@ func NewPaymentVerificationError(reason string) *PaymentVerificationError {
 	}
 }
 
+// Unwrap returns the embedded X402Error.
+func (e *PaymentVerificationError) Unwrap() error {
+	return e.X402Error
+}
+
 // TransactionBroadcastError indicates that broadcasting a transaction failed.
 type TransactionBroadcastError struct {
 	*X402Error
@@ -123,6 +222,11 @@ func NewTransactionBroadcastError(reason string) *TransactionBroadcastError {
 	}
 }
 
+// Unwrap returns the embedded X402Error.
+func (e *TransactionBroadcastError) Unwrap() error {
+	return e.X402Error
+}
+
 // InvalidPaymentRequestError indicates that a payment request format is invalid.
 type InvalidPaymentRequestError struct {
 	*X402Error
@@ -141,6 +245,52 @@ func NewInvalidPaymentRequestError(reason string) *InvalidPaymentRequestError {
 	}
 }
 
+// Unwrap returns the embedded X402Error.
+func (e *InvalidPaymentRequestError) Unwrap() error {
+	return e.X402Error
+}
+
+// Budget names reported by BudgetExceededError.
+const (
+	BudgetPerHour    = "per_hour"
+	BudgetPerDomain  = "per_domain"
+	BudgetTotal      = "total"
+	BudgetPerWallet  = "per_wallet"
+	BudgetPerPayment = "per_payment"
+)
+
+// BudgetExceededError indicates that a payment would exceed a client spending budget.
+type BudgetExceededError struct {
+	*X402Error
+	Budget    string // Budget that would be exceeded (BudgetPerHour, BudgetPerDomain, BudgetTotal, BudgetPerWallet, or BudgetPerPayment)
+	Limit     string // Configured limit
+	Spent     string // Amount already spent within the budget
+	Requested string // Amount of the rejected payment
+}
+
+// NewBudgetExceededError creates a new BudgetExceededError.
+func NewBudgetExceededError(budget, limit, spent, requested string) *BudgetExceededError {
+	message := fmt.Sprintf("Payment of %s exceeds %s budget: spent %s of %s", requested, budget, spent, limit)
+	details := map[string]interface{}{
+		"budget":    budget,
+		"limit":     limit,
+		"spent":     spent,
+		"requested": requested,
+	}
+	return &BudgetExceededError{
+		X402Error: NewX402Error(message, "BUDGET_EXCEEDED", details),
+		Budget:    budget,
+		Limit:     limit,
+		Spent:     spent,
+		Requested: requested,
+	}
+}
+
+// Unwrap returns the embedded X402Error.
+func (e *BudgetExceededError) Unwrap() error {
+	return e.X402Error
+}
+
 // ErrorCode represents metadata about an error code.
 type ErrorCode struct {
 	Code       string
@@ -169,6 +319,12 @@ var ErrorCodes = map[string]ErrorCode{
 		Retry:      false,
 		UserAction: "Add funds to wallet",
 	},
+	"INSUFFICIENT_FEE_BALANCE": {
+		Code:       "INSUFFICIENT_FEE_BALANCE",
+		Message:    "Wallet has insufficient SOL for transaction fees",
+		Retry:      false,
+		UserAction: "Add SOL to wallet to cover fees and token account rent",
+	},
 	"PAYMENT_VERIFICATION_FAILED": {
 		Code:       "PAYMENT_VERIFICATION_FAILED",
 		Message:    "Server could not verify payment",
@@ -187,4 +343,16 @@ var ErrorCodes = map[string]ErrorCode{
 		Retry:      false,
 		UserAction: "Contact API provider",
 	},
+	"BUDGET_EXCEEDED": {
+		Code:       "BUDGET_EXCEEDED",
+		Message:    "Payment would exceed a client spending budget",
+		Retry:      false,
+		UserAction: "Raise the budget or wait for the spending window to pass",
+	},
+	"INTERNAL_ERROR": {
+		Code:       "INTERNAL_ERROR",
+		Message:    "Server failed while processing the payment",
+		Retry:      true,
+		UserAction: "Retry; contact API provider if issue persists",
+	},
 }
@@ -0,0 +1,27 @@
+package core
+
+import (
+	"context"
+	"time"
+)
+
+// EscrowTerms require a payment to be deposited into an escrow program
+// instead of transferred to the payment address (see PaymentRequest.Escrow).
+// The payer releases the deposit to the payment address once the response is
+// delivered, or may reclaim it after ReleaseDeadline.
+type EscrowTerms struct {
+	Program         string    `json:"program"`          // Escrow program ID
+	ReleaseDeadline time.Time `json:"release_deadline"` // End of the release window
+}
+
+// EscrowProcessor is a PaymentProcessor that pays requests with escrow terms
+// into its escrow program, such as the processor of the openlibx402-escrow
+// module. VerifyTransfer verifies deposits held for the recipient.
+type EscrowProcessor interface {
+	PaymentProcessor
+	// EscrowProgram returns the ID of the escrow program.
+	EscrowProgram() string
+	// ReleaseEscrow releases the deposit paying request to its payment
+	// address. signer must be the payer.
+	ReleaseEscrow(ctx context.Context, request *PaymentRequest, signer Signer) (string, error)
+}
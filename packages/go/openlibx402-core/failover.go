@@ -0,0 +1,168 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/gagliardetto/solana-go/rpc/jsonrpc"
+)
+
+// endpointCooldown is how long a failing RPC endpoint is skipped.
+const endpointCooldown = 30 * time.Second
+
+// rpcEndpoint is one RPC node of a failoverRPCClient.
+type rpcEndpoint struct {
+	url    string
+	client rpc.JSONRPCClient
+
+	mu        sync.Mutex
+	downUntil time.Time
+}
+
+func (e *rpcEndpoint) healthy(now time.Time) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return now.After(e.downUntil)
+}
+
+func (e *rpcEndpoint) setHealthy(healthy bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if healthy {
+		e.downUntil = time.Time{}
+	} else {
+		e.downUntil = time.Now().Add(endpointCooldown)
+	}
+}
+
+// failoverRPCClient spreads RPC calls round-robin over several endpoints. A
+// call failing with a transient error is retried on the next endpoint, and
+// the failing endpoint is skipped until its cooldown ends or a health check
+// passes. Endpoints are only skipped while a healthy one remains.
+type failoverRPCClient struct {
+	endpoints []*rpcEndpoint
+	next      atomic.Uint64
+	logger    *slog.Logger
+	stop      chan struct{}
+	stopOnce  sync.Once
+}
+
+// newFailoverRPCClient creates a client for urls, each limited to limit,
+// checking their health every healthCheckInterval if positive.
+func newFailoverRPCClient(urls []string, httpClient *http.Client, limit RateLimit, logger *slog.Logger, healthCheckInterval time.Duration) *failoverRPCClient {
+	f := &failoverRPCClient{
+		logger: logger,
+		stop:   make(chan struct{}),
+	}
+	for _, url := range urls {
+		f.endpoints = append(f.endpoints, &rpcEndpoint{
+			url:    url,
+			client: limitRPCClient(jsonrpc.NewClientWithOpts(url, &jsonrpc.RPCClientOpts{HTTPClient: httpClient}), limit),
+		})
+	}
+	if healthCheckInterval > 0 {
+		go f.checkHealth(healthCheckInterval)
+	}
+	return f
+}
+
+// order returns the endpoints in the order to try for a call: healthy
+// endpoints starting from the next in the rotation, then the others.
+func (f *failoverRPCClient) order() []*rpcEndpoint {
+	n := len(f.endpoints)
+	start := int(f.next.Add(1)-1) % n
+	now := time.Now()
+	healthy := make([]*rpcEndpoint, 0, n)
+	var down []*rpcEndpoint
+	for i := 0; i < n; i++ {
+		endpoint := f.endpoints[(start+i)%n]
+		if endpoint.healthy(now) {
+			healthy = append(healthy, endpoint)
+		} else {
+			down = append(down, endpoint)
+		}
+	}
+	return append(healthy, down...)
+}
+
+// call runs fn on each endpoint in turn until one succeeds or fails with an
+// error that another endpoint would not fix.
+func (f *failoverRPCClient) call(ctx context.Context, method string, fn func(client rpc.JSONRPCClient) error) error {
+	var err error
+	for _, endpoint := range f.order() {
+		err = fn(endpoint.client)
+		if err == nil || !IsTransientRPCError(err) || ctx.Err() != nil {
+			return err
+		}
+		// RPC errors such as an expired blockhash are not the node's fault
+		var rpcErr *jsonrpc.RPCError
+		if !errors.As(err, &rpcErr) {
+			endpoint.setHealthy(false)
+		}
+		f.logger.Warn("x402: RPC endpoint failed, failing over", "endpoint", endpoint.url, "method", method, "error", err)
+	}
+	return err
+}
+
+func (f *failoverRPCClient) CallForInto(ctx context.Context, out interface{}, method string, params []interface{}) error {
+	return f.call(ctx, method, func(client rpc.JSONRPCClient) error {
+		return client.CallForInto(ctx, out, method, params)
+	})
+}
+
+func (f *failoverRPCClient) CallWithCallback(ctx context.Context, method string, params []interface{}, callback func(*http.Request, *http.Response) error) error {
+	return f.call(ctx, method, func(client rpc.JSONRPCClient) error {
+		return client.CallWithCallback(ctx, method, params, callback)
+	})
+}
+
+func (f *failoverRPCClient) CallBatch(ctx context.Context, requests jsonrpc.RPCRequests) (jsonrpc.RPCResponses, error) {
+	var responses jsonrpc.RPCResponses
+	err := f.call(ctx, "batch", func(client rpc.JSONRPCClient) error {
+		var err error
+		responses, err = client.CallBatch(ctx, requests)
+		return err
+	})
+	return responses, err
+}
+
+// checkHealth calls getHealth on every endpoint each interval until closed.
+func (f *failoverRPCClient) checkHealth(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-f.stop:
+			return
+		case <-ticker.C:
+		}
+		for _, endpoint := range f.endpoints {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			var health string
+			err := endpoint.client.CallForInto(ctx, &health, "getHealth", nil)
+			cancel()
+			healthy := err == nil && health == rpc.HealthOk
+			if !healthy && endpoint.healthy(time.Now()) {
+				f.logger.Warn("x402: RPC endpoint unhealthy", "endpoint", endpoint.url, "error", err)
+			}
+			endpoint.setHealthy(healthy)
+		}
+	}
+}
+
+// Close stops health checks and releases idle connections.
+func (f *failoverRPCClient) Close() error {
+	f.stopOnce.Do(func() { close(f.stop) })
+	for _, endpoint := range f.endpoints {
+		if closer, ok := endpoint.client.(interface{ Close() error }); ok {
+			closer.Close()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package core
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// KMSClient is the subset of a cloud KMS client used by KMSSigner: an
+// Ed25519 signature of a raw message with the key keyID.
+//
+// It keeps this package free of cloud SDK dependencies. With the AWS SDK
+// (key spec ECC_NIST_EDWARDS25519):
+//
+//	type awsKMS struct{ *kms.Client }
+//
+//	func (k awsKMS) Sign(ctx context.Context, keyID string, message []byte) ([]byte, error) {
+//	    out, err := k.Client.Sign(ctx, &kms.SignInput{
+//	        KeyId:            &keyID,
+//	        Message:          message,
+//	        MessageType:      types.MessageTypeRaw,
+//	        SigningAlgorithm: types.SigningAlgorithmSpecEd25519Sha512,
+//	    })
+//	    if err != nil {
+//	        return nil, err
+//	    }
+//	    return out.Signature, nil
+//	}
+//
+// With Google Cloud KMS (algorithm EC_SIGN_ED25519), keyID is the key version name:
+//
+//	type gcpKMS struct{ *kms.KeyManagementClient }
+//
+//	func (k gcpKMS) Sign(ctx context.Context, keyID string, message []byte) ([]byte, error) {
+//	    out, err := k.AsymmetricSign(ctx, &kmspb.AsymmetricSignRequest{Name: keyID, Data: message})
+//	    if err != nil {
+//	        return nil, err
+//	    }
+//	    return out.Signature, nil
+//	}
+type KMSClient interface {
+	Sign(ctx context.Context, keyID string, message []byte) ([]byte, error)
+}
+
+// KMSSigner signs payments with an Ed25519 key held in a cloud KMS, so the
+// private key is never exported.
+type KMSSigner struct {
+	client    KMSClient
+	keyID     string
+	publicKey solana.PublicKey
+}
+
+// NewKMSSigner creates a signer for the KMS key keyID whose public key is
+// publicKey (see PublicKeyFromDER and PublicKeyFromPEM to convert the key
+// returned by the KMS).
+//
+// Example:
+//
+//	out, _ := awsClient.GetPublicKey(ctx, &kms.GetPublicKeyInput{KeyId: &keyID})
+//	publicKey, err := core.PublicKeyFromDER(out.PublicKey)
+//	signer := core.NewKMSSigner(awsKMS{awsClient}, keyID, publicKey)
+func NewKMSSigner(client KMSClient, keyID string, publicKey solana.PublicKey) *KMSSigner {
+	return &KMSSigner{client: client, keyID: keyID, publicKey: publicKey}
+}
+
+// PublicKey returns the wallet address.
+func (s *KMSSigner) PublicKey() solana.PublicKey {
+	return s.publicKey
+}
+
+// SignMessage signs message with the KMS key.
+func (s *KMSSigner) SignMessage(ctx context.Context, message []byte) (solana.Signature, error) {
+	raw, err := s.client.Sign(ctx, s.keyID, message)
+	if err != nil {
+		return solana.Signature{}, fmt.Errorf("KMS signing failed: %w", err)
+	}
+	return checkSignature(raw, s.publicKey, message)
+}
+
+// checkSignature converts a raw Ed25519 signature from a key service,
+// verifying it against the public key.
+func checkSignature(raw []byte, publicKey solana.PublicKey, message []byte) (solana.Signature, error) {
+	if len(raw) != ed25519.SignatureSize {
+		return solana.Signature{}, fmt.Errorf("invalid signature length %d, expected an Ed25519 signature", len(raw))
+	}
+	signature := solana.SignatureFromBytes(raw)
+	if !signature.Verify(publicKey, message) {
+		return solana.Signature{}, fmt.Errorf("signature does not match %s", publicKey)
+	}
+	return signature, nil
+}
+
+// PublicKeyFromDER converts a DER-encoded Ed25519 public key (X.509
+// SubjectPublicKeyInfo, as returned by AWS KMS) to a Solana public key.
+func PublicKeyFromDER(der []byte) (solana.PublicKey, error) {
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return solana.PublicKey{}, fmt.Errorf("invalid public key: %w", err)
+	}
+	edKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return solana.PublicKey{}, fmt.Errorf("public key is %T, not Ed25519", key)
+	}
+	return solana.PublicKeyFromBytes(edKey), nil
+}
+
+// PublicKeyFromPEM converts a PEM-encoded Ed25519 public key (as returned by
+// Google Cloud KMS) to a Solana public key.
+func PublicKeyFromPEM(data []byte) (solana.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return solana.PublicKey{}, fmt.Errorf("invalid public key: no PEM block")
+	}
+	return PublicKeyFromDER(block.Bytes)
+}
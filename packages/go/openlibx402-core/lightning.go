@@ -0,0 +1,96 @@
+package core
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// LightningAsset is the AssetAddress of authorizations for payments made
+// with a Lightning invoice, whose amounts are in satoshis.
+const LightningAsset = "lightning:btc"
+
+// LightningTerms offer paying a payment request with a Lightning invoice
+// instead of a token transfer (see PaymentRequest.Lightning).
+type LightningTerms struct {
+	Invoice     string `json:"invoice"`      // BOLT11 payment request
+	PaymentHash string `json:"payment_hash"` // Hex SHA-256 of the invoice's preimage
+	AmountMsat  int64  `json:"amount_msat"`  // Invoice amount in millisatoshis
+}
+
+// LightningProof proves that a Lightning invoice was paid with the preimage
+// the payee revealed to the payer. Clients send it in the
+// X-Payment-Lightning header.
+type LightningProof struct {
+	PaymentID string `json:"payment_id"`
+	Preimage  string `json:"preimage"` // Hex
+}
+
+// Verify reports whether the proof's preimage hashes to paymentHash.
+func (p *LightningProof) Verify(paymentHash string) bool {
+	preimage, err := hex.DecodeString(p.Preimage)
+	if err != nil {
+		return false
+	}
+	sum := sha256.Sum256(preimage)
+	return strings.EqualFold(hex.EncodeToString(sum[:]), paymentHash)
+}
+
+// ToHeaderValue encodes the proof as a base64-encoded JSON string for the
+// X-Payment-Lightning header.
+func (p *LightningProof) ToHeaderValue() (string, error) {
+	jsonData, err := json.Marshal(p)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(jsonData), nil
+}
+
+// LightningProofFromHeader parses a LightningProof from the
+// X-Payment-Lightning header value.
+func LightningProofFromHeader(headerValue string) (*LightningProof, error) {
+	decoded, err := base64.StdEncoding.DecodeString(headerValue)
+	if err != nil {
+		return nil, NewInvalidPaymentRequestError("failed to decode base64: " + err.Error())
+	}
+
+	var p LightningProof
+	if err := json.Unmarshal(decoded, &p); err != nil {
+		return nil, NewInvalidPaymentRequestError("failed to parse Lightning proof: " + err.Error())
+	}
+	return &p, nil
+}
+
+// LightningInvoice is an invoice of a Lightning node.
+type LightningInvoice struct {
+	Invoice        string // BOLT11 payment request
+	PaymentHash    string // Hex
+	AmountMsat     int64
+	Settled        bool
+	AmountPaidMsat int64
+}
+
+// LightningBackend issues invoices and checks their settlement with a
+// Lightning node, for servers accepting Lightning payments (see
+// serverx402.Config.Lightning). The openlibx402-lightning module has
+// backends for LND and Core Lightning.
+type LightningBackend interface {
+	// CreateInvoice creates an invoice for amountMsat millisatoshis that
+	// expires after expiry.
+	CreateInvoice(ctx context.Context, amountMsat int64, description string, expiry time.Duration) (*LightningInvoice, error)
+	// LookupInvoice returns the invoice with a payment hash.
+	LookupInvoice(ctx context.Context, paymentHash string) (*LightningInvoice, error)
+}
+
+// LightningPayer pays Lightning invoices, for clients paying with Lightning
+// (see the AutoClientOptions.Lightning of the client).
+type LightningPayer interface {
+	// PayInvoice pays a BOLT11 invoice and returns the hex preimage. It must
+	// refuse invoices for more than maxAmountMsat millisatoshis, unless
+	// maxAmountMsat is 0.
+	PayInvoice(ctx context.Context, invoice string, maxAmountMsat int64) (string, error)
+}
@@ -0,0 +1,53 @@
+package core
+
+import (
+	"io"
+	"log/slog"
+)
+
+// Log attribute keys shared by the client, processor, and middleware so that
+// operators can correlate payments across components.
+const (
+	LogKeyPaymentID = "payment_id"
+	LogKeyPayer     = "payer"
+	LogKeyAmount    = "amount"
+	LogKeyTxHash    = "tx_hash"
+	LogKeyResource  = "resource"
+	LogKeyNetwork   = "network"
+)
+
+// discardLogger drops all records; it is used when no logger is configured.
+var discardLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// LoggerOrDiscard returns logger, or a logger that drops all records if it is nil.
+//
+// Levels are controlled by the handler passed to slog.New, e.g.
+// slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug}).
+func LoggerOrDiscard(logger *slog.Logger) *slog.Logger {
+	if logger == nil {
+		return discardLogger
+	}
+	return logger
+}
+
+// LogValue implements slog.LogValuer so a PaymentRequest logs its identifying fields.
+func (pr *PaymentRequest) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String(LogKeyPaymentID, pr.PaymentID),
+		slog.String(LogKeyAmount, pr.MaxAmountRequired),
+		slog.String(LogKeyResource, pr.Resource),
+		slog.String(LogKeyNetwork, pr.Network),
+	)
+}
+
+// LogValue implements slog.LogValuer so a PaymentAuthorization logs its
+// identifying fields without the signature.
+func (pa *PaymentAuthorization) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String(LogKeyPaymentID, pa.PaymentID),
+		slog.String(LogKeyPayer, pa.PublicKey),
+		slog.String(LogKeyAmount, pa.ActualAmount),
+		slog.String(LogKeyTxHash, pa.TransactionHash),
+		slog.String(LogKeyNetwork, pa.Network),
+	)
+}
@@ -0,0 +1,36 @@
+package core
+
+import (
+	"github.com/gagliardetto/solana-go"
+)
+
+// memoV1ProgramID is the legacy SPL Memo program, accepted when verifying memos.
+var memoV1ProgramID = solana.MustPublicKeyFromBase58("Memo1UhkJRfHyvLMcVucJwxXeuD728EqVDDwQDxFMNo")
+
+// PaymentMemo returns the SPL Memo attached to the payment for a payment ID.
+//
+// Payment IDs are random per payment request, so the memo links an on-chain
+// transfer to the request it pays and servers can refuse to accept the same
+// transfer for a different request.
+func PaymentMemo(paymentID string) string {
+	return "x402:" + paymentID
+}
+
+// memoInstruction builds an SPL Memo instruction.
+func memoInstruction(memo string) solana.Instruction {
+	return solana.NewInstruction(solana.MemoProgramID, solana.AccountMetaSlice{}, []byte(memo))
+}
+
+// hasMemo reports whether a transaction carries the memo.
+func hasMemo(tx *solana.Transaction, memo string) bool {
+	for _, ix := range tx.Message.Instructions {
+		programID, err := tx.Message.Program(ix.ProgramIDIndex)
+		if err != nil {
+			continue
+		}
+		if (programID.Equals(solana.MemoProgramID) || programID.Equals(memoV1ProgramID)) && string(ix.Data) == memo {
+			return true
+		}
+	}
+	return false
+}
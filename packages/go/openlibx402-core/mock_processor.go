@@ -0,0 +1,478 @@
+package core
+
+import (
+	"context"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"sync"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// mockDecimals are the decimals of every MockProcessor token.
+const mockDecimals = 6
+
+// mockLamportsPerSignature is the transaction fee MockProcessor charges.
+const mockLamportsPerSignature = 5000
+
+// RPC failures to inject into a MockProcessor with FailNext. The mock wraps
+// them in the error a SolanaPaymentProcessor returns for the call.
+var (
+	// ErrMockBlockhashExpired fails a call as if the transaction's blockhash
+	// expired, e.g. after every blockhash refresh of a send.
+	ErrMockBlockhashExpired = errors.New("Blockhash not found")
+	// ErrMockRPCTimeout fails a call as if the RPC node did not respond in
+	// time. It wraps context.DeadlineExceeded.
+	ErrMockRPCTimeout = fmt.Errorf("rpc call timed out: %w", context.DeadlineExceeded)
+)
+
+// MockProcessor is an in-memory PaymentProcessor for deterministic unit
+// tests of clients and servers. Payments move tokens between scriptable
+// balances instead of sending transactions, and transaction hashes are
+// derived from a counter, so they are the same in every run.
+//
+// Wallets have no tokens until SetBalance funds them, and 1 SOL for fees
+// unless SetSOLBalance sets another balance. FailNext injects RPC failures.
+//
+// Example:
+//
+//	processor := core.NewMockProcessor()
+//	processor.SetBalance(payer.String(), usdcMint, 10)
+//	processor.FailNext("SignAndSendTransactionWithSigner", core.ErrMockRPCTimeout)
+//
+//	client.SetProcessor(processor)
+type MockProcessor struct {
+	mu       sync.Mutex
+	tokens   map[mockAccount]uint64 // by wallet and mint, in units of 10^-6
+	lamports map[string]uint64
+	pending  map[*solana.Transaction]mockPayment
+	sent     map[string]mockPayment
+	refs     map[string]string // Transaction hashes by Solana Pay reference
+	failures map[string][]error
+	count    uint64
+}
+
+// mockAccount is a wallet's balance of a token.
+type mockAccount struct {
+	wallet, mint string
+}
+
+// mockPayment is a payment transaction of a MockProcessor.
+type mockPayment struct {
+	payer, recipient, mint, memo string
+	units                        uint64
+	splits                       map[string]uint64 // Units paid to split recipients
+}
+
+// total returns the units the payment debits from the payer.
+func (p mockPayment) total() uint64 {
+	total := p.units
+	for _, units := range p.splits {
+		total += units
+	}
+	return total
+}
+
+// received returns the units the payment transfers to recipient.
+func (p mockPayment) received(recipient string) uint64 {
+	if recipient == p.recipient {
+		return p.units
+	}
+	return p.splits[recipient]
+}
+
+// NewMockProcessor creates a MockProcessor without balances.
+func NewMockProcessor() *MockProcessor {
+	return &MockProcessor{
+		tokens:   make(map[mockAccount]uint64),
+		lamports: make(map[string]uint64),
+		pending:  make(map[*solana.Transaction]mockPayment),
+		sent:     make(map[string]mockPayment),
+		refs:     make(map[string]string),
+		failures: make(map[string][]error),
+	}
+}
+
+// SetBalance sets a wallet's balance of a token, in token units.
+func (m *MockProcessor) SetBalance(wallet, mint string, amount float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	units, _ := mockUnits(strconv.FormatFloat(amount, 'f', -1, 64))
+	m.tokens[mockAccount{wallet, mint}] = units
+}
+
+// SetSOLBalance sets a wallet's SOL balance in lamports.
+func (m *MockProcessor) SetSOLBalance(wallet string, lamports uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lamports[wallet] = lamports
+}
+
+// FailNext makes the next call of method, the name of a PaymentProcessor
+// method such as "VerifyTransfer", fail with err. Errors queue up, so a call
+// can be made to fail several times in a row. Errors without an X402 error
+// code, such as ErrMockBlockhashExpired and ErrMockRPCTimeout, are wrapped in
+// the error type SolanaPaymentProcessor returns from method.
+func (m *MockProcessor) FailNext(method string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.failures[method] = append(m.failures[method], err)
+}
+
+// AddTransfer records a settled payment of amount from payer to recipient,
+// as if made by another client, and returns its transaction hash for
+// VerifyTransfer. Balances are not changed.
+func (m *MockProcessor) AddTransfer(payer, recipient, mint, amount, memo string) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	units, _ := mockUnits(amount)
+	hash := m.nextHash()
+	m.sent[hash] = mockPayment{payer: payer, recipient: recipient, mint: mint, memo: memo, units: units}
+	return hash
+}
+
+// PaySolanaPay pays a Solana Pay transfer request URL from payer, as a
+// mobile wallet scanning it would, and returns the transaction hash. The
+// transfer carries the URL's memo and references, for VerifyTransfer and
+// FindReference.
+func (m *MockProcessor) PaySolanaPay(payer, rawURL string) (string, error) {
+	transfer, err := ParseSolanaPayURL(rawURL)
+	if err != nil {
+		return "", err
+	}
+	units, err := mockUnits(transfer.Amount)
+	if err != nil {
+		return "", NewInvalidPaymentRequestError(err.Error())
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	from := mockAccount{payer, transfer.SPLToken}
+	if m.tokens[from] < units {
+		return "", NewTransactionBroadcastError("failed to send transaction: Transaction simulation failed: Error processing Instruction: custom program error: 0x1")
+	}
+	m.tokens[from] -= units
+	m.tokens[mockAccount{transfer.Recipient, transfer.SPLToken}] += units
+	hash := m.nextHash()
+	m.sent[hash] = mockPayment{payer: payer, recipient: transfer.Recipient, mint: transfer.SPLToken, memo: transfer.Memo, units: units}
+	for _, reference := range transfer.References {
+		if _, ok := m.refs[reference]; !ok {
+			m.refs[reference] = hash
+		}
+	}
+	return hash, nil
+}
+
+// FindReference implements ReferenceFinder for transfers made with
+// PaySolanaPay.
+func (m *MockProcessor) FindReference(ctx context.Context, reference string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.failure("FindReference"); err != nil {
+		return "", err
+	}
+	return m.refs[reference], nil
+}
+
+// failure returns the next error injected into method, if any. The caller
+// holds m.mu.
+func (m *MockProcessor) failure(method string) error {
+	queue := m.failures[method]
+	if len(queue) == 0 {
+		return nil
+	}
+	m.failures[method] = queue[1:]
+	return queue[0]
+}
+
+// fail returns the next error injected into method, wrapping plain errors
+// with wrap.
+func (m *MockProcessor) fail(method string, wrap func(reason string) error) error {
+	m.mu.Lock()
+	err := m.failure(method)
+	m.mu.Unlock()
+	return wrapInjected(err, wrap)
+}
+
+// wrapInjected wraps an injected error without an X402 error code with wrap,
+// keeping it as the cause.
+func wrapInjected(err error, wrap func(reason string) error) error {
+	if err == nil || ErrorCodeOf(err) != "" {
+		return err
+	}
+	wrapped := wrap(err.Error())
+	var x402Err *X402Error
+	if errors.As(wrapped, &x402Err) {
+		x402Err.Cause = err
+	}
+	return wrapped
+}
+
+// nextHash returns the next deterministic transaction hash. The caller
+// holds m.mu.
+func (m *MockProcessor) nextHash() string {
+	m.count++
+	return solana.Signature(sha512.Sum512([]byte(fmt.Sprintf("x402-mock-transaction-%d", m.count)))).String()
+}
+
+// solBalance returns a wallet's SOL balance. The caller holds m.mu.
+func (m *MockProcessor) solBalance(wallet string) uint64 {
+	if lamports, ok := m.lamports[wallet]; ok {
+		return lamports
+	}
+	return solana.LAMPORTS_PER_SOL
+}
+
+// CreatePaymentTransactionFor implements PaymentProcessor. The transaction
+// transfers amount, split among the recipients of the payment request, with
+// its memo, like that of SolanaPaymentProcessor, and has a zero blockhash.
+func (m *MockProcessor) CreatePaymentTransactionFor(
+	ctx context.Context,
+	request *PaymentRequest,
+	amount string,
+	payerPubkey solana.PublicKey,
+) (*solana.Transaction, error) {
+	if err := m.fail("CreatePaymentTransactionFor", func(reason string) error {
+		return NewTransactionBroadcastError("failed to get recent blockhash: " + reason)
+	}); err != nil {
+		return nil, err
+	}
+
+	mint, err := solana.PublicKeyFromBase58(request.AssetAddress)
+	if err != nil {
+		return nil, NewTransactionBroadcastError("invalid token mint address: " + err.Error())
+	}
+	legs, err := paymentLegs(request, amount, mockDecimals)
+	if err != nil {
+		return nil, err
+	}
+	payerAccount, _, err := solana.FindAssociatedTokenAddress(payerPubkey, mint)
+	if err != nil {
+		return nil, NewTransactionBroadcastError("failed to derive payer token account: " + err.Error())
+	}
+
+	var instructions []solana.Instruction
+	payment := mockPayment{payer: payerPubkey.String(), recipient: request.PaymentAddress, mint: request.AssetAddress}
+	for i, leg := range legs {
+		recipientAccount, _, err := solana.FindAssociatedTokenAddress(leg.recipient, mint)
+		if err != nil {
+			return nil, NewTransactionBroadcastError("failed to derive recipient token account: " + err.Error())
+		}
+		instructions = append(instructions, transferCheckedIx(solana.TokenProgramID, payerAccount, mint, recipientAccount, payerPubkey, leg.units, mockDecimals))
+		if i == 0 {
+			payment.units = leg.units
+			continue
+		}
+		if payment.splits == nil {
+			payment.splits = make(map[string]uint64)
+		}
+		payment.splits[leg.recipient.String()] = leg.units
+	}
+	memo := ""
+	if request.PaymentID != "" {
+		memo = PaymentMemo(request.PaymentID)
+		instructions = append(instructions, memoInstruction(memo))
+	}
+	tx, err := solana.NewTransaction(instructions, solana.Hash{}, solana.TransactionPayer(payerPubkey))
+	if err != nil {
+		return nil, NewTransactionBroadcastError("failed to create transaction: " + err.Error())
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	payment.memo = memo
+	m.pending[tx] = payment
+	return tx, nil
+}
+
+// CheckFeeBalance implements PaymentProcessor.
+func (m *MockProcessor) CheckFeeBalance(ctx context.Context, tx *solana.Transaction, payer solana.PublicKey) error {
+	if err := m.fail("CheckFeeBalance", func(reason string) error {
+		return NewTransactionBroadcastError("failed to estimate fee: " + reason)
+	}); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if balance := m.solBalance(payer.String()); balance < mockLamportsPerSignature {
+		return NewInsufficientFeeBalanceError(mockLamportsPerSignature, balance)
+	}
+	return nil
+}
+
+// SignAndSendTransactionWithSigner implements PaymentProcessor. It signs a
+// transaction created by CreatePaymentTransactionFor and moves its amount
+// from the payer's balance to the recipient's.
+func (m *MockProcessor) SignAndSendTransactionWithSigner(
+	ctx context.Context,
+	transaction *solana.Transaction,
+	signer Signer,
+) (string, error) {
+	if err := m.fail("SignAndSendTransactionWithSigner", func(reason string) error {
+		return NewTransactionBroadcastError("failed to send transaction: " + reason)
+	}); err != nil {
+		return "", err
+	}
+	if err := signTransaction(ctx, transaction, signer); err != nil {
+		return "", NewTransactionBroadcastError("failed to sign transaction: " + err.Error())
+	}
+	if err := transaction.VerifySignatures(); err != nil {
+		return "", NewTransactionBroadcastError("failed to send transaction: " + err.Error())
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	payment, ok := m.pending[transaction]
+	if !ok {
+		return "", NewTransactionBroadcastError("failed to send transaction: transaction was not created by the mock processor")
+	}
+	from := mockAccount{payment.payer, payment.mint}
+	lamports := m.solBalance(payment.payer)
+	switch {
+	case lamports < mockLamportsPerSignature:
+		return "", NewTransactionBroadcastError("failed to send transaction: Transaction simulation failed: Attempt to debit an account but found no record of a prior credit.")
+	case m.tokens[from] < payment.total():
+		return "", NewTransactionBroadcastError("failed to send transaction: Transaction simulation failed: Error processing Instruction: custom program error: 0x1")
+	}
+	m.tokens[from] -= payment.total()
+	m.tokens[mockAccount{payment.recipient, payment.mint}] += payment.units
+	for recipient, units := range payment.splits {
+		m.tokens[mockAccount{recipient, payment.mint}] += units
+	}
+	m.lamports[payment.payer] = lamports - mockLamportsPerSignature
+
+	delete(m.pending, transaction)
+	hash := m.nextHash()
+	m.sent[hash] = payment
+	return hash, nil
+}
+
+// SimulatePaymentFor implements PaymentProcessor.
+func (m *MockProcessor) SimulatePaymentFor(
+	ctx context.Context,
+	request *PaymentRequest,
+	amount string,
+	payerPubkey solana.PublicKey,
+) (*PaymentSimulation, error) {
+	if err := m.fail("SimulatePaymentFor", func(reason string) error {
+		return NewTransactionBroadcastError("failed to simulate transaction: " + reason)
+	}); err != nil {
+		return nil, err
+	}
+	if amount == "" {
+		amount = request.MaxAmountRequired
+	}
+	units, err := mockUnits(amount)
+	if err != nil {
+		return nil, NewTransactionBroadcastError("invalid amount format: " + err.Error())
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sim := &PaymentSimulation{
+		Fee:     mockLamportsPerSignature,
+		Balance: m.solBalance(payerPubkey.String()),
+	}
+	balance := m.tokens[mockAccount{payerPubkey.String(), request.AssetAddress}]
+	switch {
+	case balance < units:
+		sim.Err = NewInsufficientFundsError(amount, mockAmount(balance))
+	case sim.Balance < sim.Fee:
+		sim.Err = NewInsufficientFeeBalanceError(sim.Fee, sim.Balance)
+	}
+	return sim, nil
+}
+
+// WaitForConfirmation implements PaymentProcessor. Sent transactions are
+// confirmed at once.
+func (m *MockProcessor) WaitForConfirmation(ctx context.Context, signature string, commitment Commitment) error {
+	if err := m.fail("WaitForConfirmation", func(reason string) error {
+		return NewTransactionBroadcastError("transaction not confirmed: " + reason)
+	}); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.sent[signature]; !ok {
+		return NewTransactionBroadcastError("transaction not confirmed: transaction not found")
+	}
+	return nil
+}
+
+// VerifyTransfer implements PaymentProcessor for transactions sent with
+// SignAndSendTransactionWithSigner or added with AddTransfer.
+func (m *MockProcessor) VerifyTransfer(
+	ctx context.Context,
+	transactionHash string,
+	expectedRecipient string,
+	expectedTokenMint string,
+	expectedMemo string,
+) (*VerifiedTransfer, error) {
+	if err := m.fail("VerifyTransfer", func(reason string) error {
+		return NewPaymentVerificationError("transaction not found: " + reason)
+	}); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	payment, ok := m.sent[transactionHash]
+	switch {
+	case !ok:
+		return nil, NewPaymentVerificationError("transaction not found")
+	case expectedMemo != "" && payment.memo != expectedMemo:
+		return nil, NewPaymentVerificationError("transaction memo does not match the payment request")
+	case payment.mint != expectedTokenMint || payment.received(expectedRecipient) == 0:
+		return nil, NewPaymentVerificationError("transaction does not transfer the token to the payment address")
+	}
+	return &VerifiedTransfer{
+		Amount:   mockAmount(payment.received(expectedRecipient)),
+		Decimals: mockDecimals,
+		Payer:    payment.payer,
+	}, nil
+}
+
+// GetTokenBalance implements PaymentProcessor.
+func (m *MockProcessor) GetTokenBalance(ctx context.Context, walletAddress string, tokenMint string) (float64, error) {
+	m.mu.Lock()
+	err := m.failure("GetTokenBalance")
+	balance := m.tokens[mockAccount{walletAddress, tokenMint}]
+	m.mu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+	amount, _ := strconv.ParseFloat(mockAmount(balance), 64)
+	return amount, nil
+}
+
+// Close implements PaymentProcessor. The mock keeps working after Close, so
+// that a client and a server under test can share it.
+func (m *MockProcessor) Close() error {
+	return nil
+}
+
+// mockUnits converts a token amount to units of 10^-6, rounding down.
+func mockUnits(amount string) (uint64, error) {
+	rat, ok := new(big.Rat).SetString(amount)
+	if !ok || rat.Sign() < 0 {
+		return 0, fmt.Errorf("invalid amount %q", amount)
+	}
+	rat.Mul(rat, new(big.Rat).SetInt64(1_000_000))
+	return new(big.Int).Quo(rat.Num(), rat.Denom()).Uint64(), nil
+}
+
+// mockAmount formats units of 10^-6 as a token amount.
+func mockAmount(units uint64) string {
+	return new(big.Rat).SetFrac64(int64(units), 1_000_000).FloatString(mockDecimals)
+}
+
+// MintDecimals implements MintInspector: every mock token has 6 decimals.
+func (m *MockProcessor) MintDecimals(ctx context.Context, mint string) (uint8, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.failure("MintDecimals"); err != nil {
+		return 0, err
+	}
+	return mockDecimals, nil
+}
@@ -10,6 +10,36 @@ import (
 	"time"
 )
 
+// Default HTTP header names used by the protocol. Clients and middleware accept
+// overrides for gateways that require specific names or strip unknown X- headers.
+const (
+	DefaultAuthorizationHeader  = "X-Payment-Authorization"   // Carries the encoded PaymentAuthorization
+	DefaultPayerHeader          = "X-Payer-Public-Key"        // Declares the payer on the initial request
+	DefaultSessionHeader        = "X-Payment-Session"         // Carries a session token issued after payment
+	DefaultDeferredHeader       = "X-Payment-Deferred"        // Carries the encoded PaymentRequest of a deferred payment
+	DefaultPlanHeader           = "X-Payment-Plan"            // Names the subscription plan a request buys
+	DefaultSubscriptionHeader   = "X-Payment-Subscription"    // Carries a subscription token issued after buying a plan
+	DefaultQuotaHeader          = "X-Payment-Quota"           // Carries a quota token for the requests included with a payment
+	DefaultQuotaRemainingHeader = "X-Payment-Quota-Remaining" // Reports how many included requests are left
+	DefaultVoucherHeader        = "X-Payment-Voucher"         // Carries a signed Voucher paying from a payment channel
+	DefaultChannelHeader        = "X-Payment-Channel"         // Returns the ID of a payment channel opened by a deposit
+	DefaultChannelBalanceHeader = "X-Payment-Channel-Balance" // Reports what is left of a payment channel's deposit
+	DefaultTabHeader            = "X-Payment-Tab-Outstanding" // Reports the unsettled balance of a payer's tab
+	DefaultReferenceHeader      = "X-Payment-Reference"       // Carries the payment ID of a payment request paid with Solana Pay
+	DefaultLightningHeader      = "X-Payment-Lightning"       // Carries a LightningProof of a paid Lightning invoice
+	DefaultExpiredTrailer       = "X-Payment-Expired"         // Trailer of a response cut off because its payment ran out
+	DefaultCapturedHeader       = "X-Payment-Captured"        // Reports the amount captured of a held payment, as a header or trailer
+)
+
+// ProblemContentType is the media type of RFC 9457 problem details, which
+// servers may send 402 and rejection responses as. The PaymentRequest of a 402
+// response is then the ProblemPaymentRequestMember extension member, which
+// plain JSON bodies enriched with other members use too.
+const (
+	ProblemContentType          = "application/problem+json"
+	ProblemPaymentRequestMember = "payment_request"
+)
+
 // PaymentRequest represents an X402 payment request (402 response).
 //
 // When a server requires payment for a resource, it returns a 402 status code
@@ -25,6 +55,66 @@ type PaymentRequest struct {
 	PaymentID         string    `json:"payment_id"`            // Unique payment request ID
 	Resource          string    `json:"resource"`              // API endpoint being accessed
 	Description       string    `json:"description,omitempty"` // Human-readable description (optional)
+
+	// Plans are the subscription plans offered for the resource, which a
+	// client buys by repeating the request with the plan ID in the
+	// X-Payment-Plan header.
+	Plans []SubscriptionPlan `json:"plans,omitempty"`
+	// Plan is the ID of the subscription plan this request buys, if any.
+	Plan string `json:"plan,omitempty"`
+
+	// RequestsIncluded is how many further requests to the resource the
+	// payment grants after the paid one. The server returns a quota token in
+	// the X-Payment-Quota header to send with them.
+	RequestsIncluded int `json:"requests_included,omitempty"`
+
+	// PriceTiers is the volume pricing schedule of the resource, if any.
+	// MaxAmountRequired is the price of the payer's current tier, or of the
+	// first tier if the request did not declare the payer.
+	PriceTiers []PriceTier `json:"price_tiers,omitempty"`
+	// Quote is set when the resource is priced in fiat: MaxAmountRequired
+	// was converted from it, and the request expires with it.
+	Quote *PriceQuote `json:"quote,omitempty"`
+	// Range is set when the resource is priced by byte range:
+	// MaxAmountRequired is the price of the bytes the request asked for.
+	Range *RangePrice `json:"range,omitempty"`
+	// Capture is set when MaxAmountRequired is a hold: the server captures
+	// the actual cost of the request once it is known and refunds the rest,
+	// reporting the amount captured in the X-Payment-Captured header or
+	// trailer of the response.
+	Capture bool `json:"capture,omitempty"`
+	// Units is set when the request is priced by the units it consumes:
+	// MaxAmountRequired is a hold for MaxUnits, and the server captures
+	// the price of the units used.
+	Units *UnitPrice `json:"units,omitempty"`
+	// Accepts lists other tokens the server accepts in place of
+	// AssetAddress, each at its own price (see WithToken).
+	Accepts []TokenPrice `json:"accepts,omitempty"`
+	// Splits pays percentages of the amount to other recipients; the
+	// payment address receives the rest. A payment transfers each share in
+	// the same transaction (see SplitAmounts).
+	Splits []PaymentSplit `json:"splits,omitempty"`
+	// Escrow, if set, asks for the payment to be deposited into an escrow
+	// program and released once the response is delivered.
+	Escrow *EscrowTerms `json:"escrow,omitempty"`
+	// Channel, if set, offers a payment channel: paying the channel deposit
+	// instead of MaxAmountRequired opens a channel that pays later requests
+	// with vouchers in the X-Payment-Voucher header.
+	Channel *ChannelTerms `json:"channel,omitempty"`
+	// Tab, if set, offers a tab: requests may be charged to it with vouchers
+	// in the X-Payment-Voucher header and settled later in one payment. A
+	// payment request settling a tab includes its outstanding balance in
+	// MaxAmountRequired.
+	Tab *TabTerms `json:"tab,omitempty"`
+	// SolanaPayURL, if set, is a Solana Pay transfer request paying the
+	// payment request from a wallet (see SolanaPayURL). After paying it,
+	// the client repeats the request with PaymentID in the
+	// X-Payment-Reference header instead of an authorization.
+	SolanaPayURL string `json:"solana_pay_url,omitempty"`
+	// Lightning, if set, offers paying with a Lightning invoice instead.
+	// After paying it, the client repeats the request with a LightningProof
+	// in the X-Payment-Lightning header instead of an authorization.
+	Lightning *LightningTerms `json:"lightning,omitempty"`
 }
 
 // IsExpired checks if the payment request has expired.
@@ -50,6 +140,26 @@ func PaymentRequestFromJSON(jsonStr string) (*PaymentRequest, error) {
 	return &pr, nil
 }
 
+// ToHeaderValue encodes the payment request as a base64-encoded JSON string,
+// for the X-Payment-Deferred header of a response served before payment.
+func (pr *PaymentRequest) ToHeaderValue() (string, error) {
+	jsonData, err := json.Marshal(pr)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(jsonData), nil
+}
+
+// PaymentRequestFromHeader parses a PaymentRequest from the X-Payment-Deferred
+// header value.
+func PaymentRequestFromHeader(headerValue string) (*PaymentRequest, error) {
+	decoded, err := base64.StdEncoding.DecodeString(headerValue)
+	if err != nil {
+		return nil, NewInvalidPaymentRequestError("failed to decode base64: " + err.Error())
+	}
+	return PaymentRequestFromJSON(string(decoded))
+}
+
 // PaymentAuthorization represents a signed payment authorization sent with retry request.
 //
 // After creating and broadcasting a payment transaction, the client includes this
@@ -100,3 +210,18 @@ func (pa *PaymentAuthorization) ToJSON() (string, error) {
 	}
 	return string(data), nil
 }
+
+// Refund records tokens returned to a payer for a verified payment.
+//
+// Refunds may be partial; several refunds can reference the same payment.
+type Refund struct {
+	RefundID        string    `json:"refund_id"`        // Unique refund ID
+	PaymentID       string    `json:"payment_id"`       // Refunded payment
+	Amount          string    `json:"amount"`           // Amount returned (≤ the payment's actual_amount)
+	Recipient       string    `json:"recipient"`        // Payer's public key
+	AssetAddress    string    `json:"asset_address"`    // Token mint address
+	Network         string    `json:"network"`          // Blockchain network
+	TransactionHash string    `json:"transaction_hash"` // Refund transaction hash
+	Reason          string    `json:"reason,omitempty"` // Human-readable reason (optional)
+	CreatedAt       time.Time `json:"created_at"`       // Refund timestamp
+}
@@ -0,0 +1,76 @@
+package core
+
+import (
+	"context"
+	"fmt"
+)
+
+// genesisHashes are the genesis hashes of the public Solana clusters.
+var genesisHashes = map[string]string{
+	"solana-mainnet": "5eykt4UsFv8P8NJdTREpY1vzqKqZKvdpKuc147dw2N9d",
+	"solana-devnet":  "EtWTRABZaYq6iMfeYKouRu166VU2xqa1wcaWoxPkrZBG",
+	"solana-testnet": "4uhcVJyU9pJkvQyS88uRDiswHXSCkY3zQawwpjk2NsNY",
+}
+
+// GenesisHash returns the genesis hash of a public network, or "" for other
+// networks, such as local validators.
+func GenesisHash(network string) string {
+	return genesisHashes[network]
+}
+
+// NetworkOf returns the public network with a genesis hash, or "".
+func NetworkOf(genesisHash string) string {
+	for network, hash := range genesisHashes {
+		if hash == genesisHash {
+			return network
+		}
+	}
+	return ""
+}
+
+// NetworkMismatchError is returned when an RPC endpoint serves another
+// network than the one configured.
+type NetworkMismatchError struct {
+	Network     string // Configured network
+	GenesisHash string // Genesis hash of the RPC endpoint
+}
+
+func (e *NetworkMismatchError) Error() string {
+	if actual := NetworkOf(e.GenesisHash); actual != "" {
+		return fmt.Sprintf("RPC endpoint serves %s, not %s", actual, e.Network)
+	}
+	return fmt.Sprintf("RPC endpoint has genesis hash %s, not that of %s", e.GenesisHash, e.Network)
+}
+
+// NetworkChecker is a PaymentProcessor that can check the network of its
+// RPC endpoint, as servers verifying payments on-chain do (see
+// serverx402.Config.AutoVerify).
+type NetworkChecker interface {
+	PaymentProcessor
+	// CheckNetwork fails with a *NetworkMismatchError if the RPC endpoint
+	// does not serve network. Networks without a known genesis hash pass.
+	CheckNetwork(ctx context.Context, network string) error
+}
+
+var _ NetworkChecker = (*SolanaPaymentProcessor)(nil)
+
+// CheckNetwork implements NetworkChecker with getGenesisHash.
+func (sp *SolanaPaymentProcessor) CheckNetwork(ctx context.Context, network string) error {
+	expected := GenesisHash(network)
+	if expected == "" {
+		return nil
+	}
+	var actual string
+	err := sp.withRetry(ctx, "getGenesisHash", func() error {
+		hash, getErr := sp.client.GetGenesisHash(ctx)
+		actual = hash.String()
+		return getErr
+	})
+	if err != nil {
+		return err
+	}
+	if actual != expected {
+		return &NetworkMismatchError{Network: network, GenesisHash: actual}
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package core
+
+import "time"
+
+// PriceTier is a price that applies once a payer has made a number of
+// verified payments, for volume discounts such as "the first 100 calls at
+// 0.10, then 0.05" (see PaymentRequest.PriceTiers).
+type PriceTier struct {
+	From   int    `json:"from"`   // Verified payments the payer made before the tier applies
+	Amount string `json:"amount"` // Price per request in token units
+}
+
+// TierPrice returns the amount of the tier that applies after payments
+// verified payments: the tier with the highest From not above it. It returns
+// "" if no tier applies.
+func TierPrice(tiers []PriceTier, payments int) string {
+	amount, from := "", -1
+	for _, tier := range tiers {
+		if tier.From <= payments && tier.From > from {
+			amount, from = tier.Amount, tier.From
+		}
+	}
+	return amount
+}
+
+// PriceQuote is the conversion of a fiat price to the token amount of a
+// PaymentRequest (see PaymentRequest.Quote).
+type PriceQuote struct {
+	Currency   string    `json:"currency"`    // ISO 4217 code, e.g. "USD"
+	Amount     string    `json:"amount"`      // Price in Currency
+	Rate       string    `json:"rate"`        // Price of one token in Currency
+	ValidUntil time.Time `json:"valid_until"` // End of the quote's validity
+}
+
+// RangePrice is the pricing of a resource priced by the bytes a request
+// asks for, such as "0.01 per started 10 MiB" (see PaymentRequest.Range).
+type RangePrice struct {
+	PricePerUnit string `json:"price_per_unit"`  // Price of each started unit in token units
+	Unit         int64  `json:"unit"`            // Bytes per unit
+	Size         int64  `json:"size"`            // Size of the resource in bytes
+	Range        string `json:"range,omitempty"` // Range header the amount is for, if any
+	Bytes        int64  `json:"bytes"`           // Bytes the amount is for
+}
+
+// UnitPrice is the pricing of a request charged by the units it consumes,
+// such as the output tokens of a model (see PaymentRequest.Units).
+type UnitPrice struct {
+	PricePerUnit string `json:"price_per_unit"` // Price of each unit in token units
+	MaxUnits     int64  `json:"max_units"`      // Units the hold covers
+	Unit         string `json:"unit,omitempty"` // Name of the unit, e.g. "token"
+}
+
+// TokenPrice is the price of a resource in one of the tokens a server
+// accepts (see PaymentRequest.Accepts).
+type TokenPrice struct {
+	AssetAddress string `json:"asset_address"` // Token mint address
+	Amount       string `json:"amount"`        // Price in token units
+}
+
+// TokenAmount returns the amount to pay in the token with mint, and whether
+// the payment request accepts it.
+func (pr *PaymentRequest) TokenAmount(mint string) (string, bool) {
+	if mint == pr.AssetAddress {
+		return pr.MaxAmountRequired, true
+	}
+	for _, token := range pr.Accepts {
+		if token.AssetAddress == mint {
+			return token.Amount, true
+		}
+	}
+	return "", false
+}
+
+// WithToken returns a copy of the payment request to pay in the accepted
+// token with mint instead of AssetAddress, and whether it is accepted.
+func (pr *PaymentRequest) WithToken(mint string) (*PaymentRequest, bool) {
+	amount, ok := pr.TokenAmount(mint)
+	if !ok {
+		return nil, false
+	}
+	priced := *pr
+	priced.AssetAddress = mint
+	priced.MaxAmountRequired = amount
+	return &priced, true
+}
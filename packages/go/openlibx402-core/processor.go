@@ -0,0 +1,39 @@
+package core
+
+import (
+	"context"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// PaymentProcessor creates, sends, and verifies payment transactions.
+//
+// SolanaPaymentProcessor implements it against a Solana RPC node. Clients and
+// servers accept other implementations, such as MockProcessor in unit tests
+// (see X402Client.SetProcessor and serverx402.Config.Processor).
+type PaymentProcessor interface {
+	// CreatePaymentTransactionFor builds an unsigned transaction paying
+	// amount of request's token from payer to its payment address.
+	CreatePaymentTransactionFor(ctx context.Context, request *PaymentRequest, amount string, payer solana.PublicKey) (*solana.Transaction, error)
+	// CheckFeeBalance returns an *InsufficientFeeBalanceError if payer has
+	// too little SOL for the fee and rent of tx.
+	CheckFeeBalance(ctx context.Context, tx *solana.Transaction, payer solana.PublicKey) error
+	// SignAndSendTransactionWithSigner signs tx with signer and broadcasts
+	// it, returning its transaction hash.
+	SignAndSendTransactionWithSigner(ctx context.Context, tx *solana.Transaction, signer Signer) (string, error)
+	// SimulatePaymentFor reports what paying request from payer would cost
+	// and why it would fail, without broadcasting anything.
+	SimulatePaymentFor(ctx context.Context, request *PaymentRequest, amount string, payer solana.PublicKey) (*PaymentSimulation, error)
+	// WaitForConfirmation waits until a transaction reaches commitment.
+	WaitForConfirmation(ctx context.Context, signature string, commitment Commitment) error
+	// VerifyTransfer verifies that a transaction transferred tokens of
+	// expectedTokenMint to expectedRecipient, carrying expectedMemo if it is
+	// not empty, and returns the amount received.
+	VerifyTransfer(ctx context.Context, transactionHash, expectedRecipient, expectedTokenMint, expectedMemo string) (*VerifiedTransfer, error)
+	// GetTokenBalance returns a wallet's balance of a token in token units.
+	GetTokenBalance(ctx context.Context, walletAddress, tokenMint string) (float64, error)
+	// Close releases the processor's connections.
+	Close() error
+}
+
+var _ PaymentProcessor = (*SolanaPaymentProcessor)(nil)
@@ -0,0 +1,114 @@
+package core
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/gagliardetto/solana-go/rpc/jsonrpc"
+)
+
+// RateLimit caps the rate of calls to an RPC endpoint, so that busy servers
+// stay within a provider's limits instead of being rejected with 429s.
+//
+// Calls over the limit wait for their turn (or for the context to end). The
+// zero value means no limit.
+type RateLimit struct {
+	RequestsPerSecond float64 // Sustained call rate
+	Burst             int     // Calls allowed at once above the rate (default: RequestsPerSecond, at least 1)
+}
+
+// tokenBucket implements RateLimit.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(limit RateLimit) *tokenBucket {
+	burst := float64(limit.Burst)
+	if burst <= 0 {
+		burst = math.Max(1, math.Ceil(limit.RequestsPerSecond))
+	}
+	return &tokenBucket{
+		rate:   limit.RequestsPerSecond,
+		burst:  burst,
+		tokens: burst,
+		last:   time.Now(),
+	}
+}
+
+// wait takes a token, waiting until one is available or ctx ends.
+func (b *tokenBucket) wait(ctx context.Context) error {
+	b.mu.Lock()
+	now := time.Now()
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	b.tokens--
+	delay := time.Duration(-b.tokens / b.rate * float64(time.Second))
+	b.mu.Unlock()
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		// Give back the token reserved for this call
+		b.mu.Lock()
+		b.tokens++
+		b.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// rateLimitedRPCClient waits for a token before each RPC call.
+type rateLimitedRPCClient struct {
+	client  rpc.JSONRPCClient
+	limiter *tokenBucket
+}
+
+// limitRPCClient wraps client with limit, if any.
+func limitRPCClient(client rpc.JSONRPCClient, limit RateLimit) rpc.JSONRPCClient {
+	if limit.RequestsPerSecond <= 0 {
+		return client
+	}
+	return &rateLimitedRPCClient{client: client, limiter: newTokenBucket(limit)}
+}
+
+func (r *rateLimitedRPCClient) CallForInto(ctx context.Context, out interface{}, method string, params []interface{}) error {
+	if err := r.limiter.wait(ctx); err != nil {
+		return err
+	}
+	return r.client.CallForInto(ctx, out, method, params)
+}
+
+func (r *rateLimitedRPCClient) CallWithCallback(ctx context.Context, method string, params []interface{}, callback func(*http.Request, *http.Response) error) error {
+	if err := r.limiter.wait(ctx); err != nil {
+		return err
+	}
+	return r.client.CallWithCallback(ctx, method, params, callback)
+}
+
+func (r *rateLimitedRPCClient) CallBatch(ctx context.Context, requests jsonrpc.RPCRequests) (jsonrpc.RPCResponses, error) {
+	if err := r.limiter.wait(ctx); err != nil {
+		return nil, err
+	}
+	return r.client.CallBatch(ctx, requests)
+}
+
+// Close releases the wrapped client's idle connections.
+func (r *rateLimitedRPCClient) Close() error {
+	if closer, ok := r.client.(interface{ Close() error }); ok {
+		return closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// RemoteSigner delegates signing to a remote service over HTTP, such as a
+// wallet daemon or a KMS proxy, so the private key never lives in the
+// process that makes payments.
+//
+// Each signature is requested with a POST to the service URL:
+//
+//	{"public_key": "<base58 address>", "message": "<base64 message>"}
+//
+// and the service responds with 200 and:
+//
+//	{"signature": "<base58 signature>"}
+//
+// Returned signatures are verified against the public key before use. A gRPC
+// or other transport can be used by implementing Signer directly.
+type RemoteSigner struct {
+	url        string
+	publicKey  solana.PublicKey
+	httpClient *http.Client
+	header     http.Header
+}
+
+// RemoteSignerOptions configures a RemoteSigner.
+type RemoteSignerOptions struct {
+	// HTTPClient sends signing requests, e.g. with mutual TLS configured
+	// (default: http.DefaultClient).
+	HTTPClient *http.Client
+	// AuthToken is sent as a bearer token with each request (optional).
+	AuthToken string
+	// Header is added to each request, e.g. for API keys (optional).
+	Header http.Header
+}
+
+// NewRemoteSigner creates a RemoteSigner for the wallet publicKey whose key is
+// held by the service at url.
+//
+// Example:
+//
+//	signer := core.NewRemoteSigner("https://signer.internal/sign", walletAddress, &core.RemoteSignerOptions{
+//	    AuthToken: os.Getenv("SIGNER_TOKEN"),
+//	})
+//	autoClient := client.NewAutoClientWithSigner(signer, "", nil)
+func NewRemoteSigner(url string, publicKey solana.PublicKey, opts *RemoteSignerOptions) *RemoteSigner {
+	if opts == nil {
+		opts = &RemoteSignerOptions{}
+	}
+	httpClient := opts.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	header := opts.Header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	if opts.AuthToken != "" {
+		header.Set("Authorization", "Bearer "+opts.AuthToken)
+	}
+	return &RemoteSigner{
+		url:        url,
+		publicKey:  publicKey,
+		httpClient: httpClient,
+		header:     header,
+	}
+}
+
+// PublicKey returns the wallet address.
+func (s *RemoteSigner) PublicKey() solana.PublicKey {
+	return s.publicKey
+}
+
+// SignMessage requests a signature of message from the remote service.
+func (s *RemoteSigner) SignMessage(ctx context.Context, message []byte) (solana.Signature, error) {
+	body, err := json.Marshal(map[string]string{
+		"public_key": s.publicKey.String(),
+		"message":    base64.StdEncoding.EncodeToString(message),
+	})
+	if err != nil {
+		return solana.Signature{}, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return solana.Signature{}, fmt.Errorf("failed to create signing request: %w", err)
+	}
+	for key, values := range s.header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return solana.Signature{}, fmt.Errorf("signing request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return solana.Signature{}, fmt.Errorf("signing service returned %d: %s", resp.StatusCode, bytes.TrimSpace(detail))
+	}
+
+	var result struct {
+		Signature string `json:"signature"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&result); err != nil {
+		return solana.Signature{}, fmt.Errorf("invalid signing response: %w", err)
+	}
+	signature, err := solana.SignatureFromBase58(result.Signature)
+	if err != nil {
+		return solana.Signature{}, fmt.Errorf("invalid signature from signing service: %w", err)
+	}
+	if !signature.Verify(s.publicKey, message) {
+		return solana.Signature{}, fmt.Errorf("signing service returned a signature that does not match %s", s.publicKey)
+	}
+	return signature, nil
+}
@@ -0,0 +1,123 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gagliardetto/solana-go/rpc/jsonrpc"
+)
+
+// RetryPolicy controls how RPC calls are retried after transient failures.
+//
+// The zero value disables retries. Delays grow exponentially from
+// InitialBackoff up to MaxBackoff, with random jitter of up to half the delay.
+type RetryPolicy struct {
+	MaxAttempts    int           // Total attempts including the first (0 or 1: no retries)
+	InitialBackoff time.Duration // Delay before the first retry (default: 200ms)
+	MaxBackoff     time.Duration // Upper bound of a single delay (default: 5s)
+	MaxElapsed     time.Duration // Stop retrying once this much time has passed (0: no cap)
+}
+
+// DefaultRetryPolicy returns a policy suited to public RPC nodes: 4 attempts,
+// backing off from 200ms, for at most 30 seconds.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    4,
+		InitialBackoff: 200 * time.Millisecond,
+		MaxBackoff:     5 * time.Second,
+		MaxElapsed:     30 * time.Second,
+	}
+}
+
+// IsTransientRPCError reports whether an RPC error is likely to succeed on
+// retry: rate limiting (429), server errors, unhealthy or lagging nodes,
+// expired blockhashes, and network timeouts.
+func IsTransientRPCError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var httpErr *jsonrpc.HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.Code == http.StatusTooManyRequests || httpErr.Code >= 500
+	}
+	var rpcErr *jsonrpc.RPCError
+	if errors.As(err, &rpcErr) {
+		switch rpcErr.Code {
+		case -32004, -32005: // block not available, node unhealthy
+			return true
+		}
+		return isTransientMessage(rpcErr.Message)
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return isTransientMessage(err.Error())
+}
+
+// isTransientMessage matches transient failures that are only reported as text.
+func isTransientMessage(message string) bool {
+	message = strings.ToLower(message)
+	for _, fragment := range []string{
+		"blockhash not found",
+		"block height exceeded",
+		"node is behind",
+		"node is unhealthy",
+		"too many requests",
+		"connection reset",
+		"connection refused",
+	} {
+		if strings.Contains(message, fragment) {
+			return true
+		}
+	}
+	return false
+}
+
+// withRetry runs fn, retrying transient failures according to the retry policy.
+func (sp *SolanaPaymentProcessor) withRetry(ctx context.Context, op string, fn func() error) error {
+	policy := sp.retry
+	backoff := policy.InitialBackoff
+	if backoff <= 0 {
+		backoff = 200 * time.Millisecond
+	}
+	maxBackoff := policy.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = 5 * time.Second
+	}
+	start := time.Now()
+
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= policy.MaxAttempts || !IsTransientRPCError(err) {
+			return err
+		}
+
+		delay := backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+		if policy.MaxElapsed > 0 && time.Since(start)+delay > policy.MaxElapsed {
+			return err
+		}
+		sp.logger.Debug("x402: transient RPC error, retrying", "operation", op, "attempt", attempt, "delay", delay, "error", err)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package core
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// Signer signs payment transactions on behalf of a wallet. Implementations
+// may keep the private key out of the process, e.g. in a wallet daemon or a
+// KMS (see RemoteSigner).
+type Signer interface {
+	// PublicKey returns the wallet address.
+	PublicKey() solana.PublicKey
+	// SignMessage returns the ed25519 signature of a serialized transaction message.
+	SignMessage(ctx context.Context, message []byte) (solana.Signature, error)
+}
+
+// KeypairSigner signs with a private key held in memory.
+type KeypairSigner struct {
+	key solana.PrivateKey
+}
+
+// NewKeypairSigner creates a Signer for a private key.
+func NewKeypairSigner(key solana.PrivateKey) *KeypairSigner {
+	return &KeypairSigner{key: key}
+}
+
+// PublicKey returns the public key of the private key.
+func (s *KeypairSigner) PublicKey() solana.PublicKey {
+	return s.key.PublicKey()
+}
+
+// SignMessage signs message with the private key.
+func (s *KeypairSigner) SignMessage(ctx context.Context, message []byte) (solana.Signature, error) {
+	return s.key.Sign(message)
+}
+
+// signTransaction adds the signer's signature to a transaction, keeping any
+// signatures of other signers.
+func signTransaction(ctx context.Context, tx *solana.Transaction, signer Signer) error {
+	message, err := tx.Message.MarshalBinary()
+	if err != nil {
+		return fmt.Errorf("failed to encode message: %w", err)
+	}
+
+	required := int(tx.Message.Header.NumRequiredSignatures)
+	if len(tx.Signatures) != required {
+		tx.Signatures = make([]solana.Signature, required)
+	}
+	publicKey := signer.PublicKey()
+	for i, key := range tx.Message.AccountKeys[:required] {
+		if !key.Equals(publicKey) {
+			continue
+		}
+		signature, err := signer.SignMessage(ctx, message)
+		if err != nil {
+			return err
+		}
+		tx.Signatures[i] = signature
+		return nil
+	}
+	return fmt.Errorf("%s is not a signer of the transaction", publicKey)
+}
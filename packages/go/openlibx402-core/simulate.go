@@ -0,0 +1,207 @@
+package core
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+// tokenAccountSize is the size of an SPL token account, which determines the
+// rent paid to create one.
+const tokenAccountSize = 165
+
+// PaymentSimulation is the outcome of simulating a payment transaction.
+type PaymentSimulation struct {
+	Fee           uint64   // Transaction fee in lamports, including the priority fee
+	Rent          uint64   // Lamports paid to create the recipient's token account, if it does not exist yet
+	Balance       uint64   // Payer's SOL balance in lamports
+	UnitsConsumed uint64   // Compute units consumed
+	Logs          []string // Program logs of the simulation
+
+	// Err explains why the payment would fail, or is nil if it would succeed.
+	Err error
+}
+
+// SimulatePayment builds the payment transaction for request and runs it
+// through simulateTransaction without broadcasting it, reporting the fees it
+// would cost and why it would fail: a missing token account, an insufficient
+// token balance, or too little SOL for the fee and rent.
+//
+// The returned error is only set if the simulation itself could not run.
+//
+// Example:
+//
+//	sim, err := processor.SimulatePayment(ctx, request, "", keypair)
+//	if err != nil {
+//	    return err
+//	}
+//	if sim.Err != nil {
+//	    log.Printf("payment would fail: %v", sim.Err)
+//	}
+func (sp *SolanaPaymentProcessor) SimulatePayment(
+	ctx context.Context,
+	request *PaymentRequest,
+	amount string,
+	payerKeypair solana.PrivateKey,
+) (*PaymentSimulation, error) {
+	return sp.SimulatePaymentFor(ctx, request, amount, payerKeypair.PublicKey())
+}
+
+// SimulatePaymentFor simulates a payment like SimulatePayment for the payer's
+// public key, without needing its private key.
+func (sp *SolanaPaymentProcessor) SimulatePaymentFor(
+	ctx context.Context,
+	request *PaymentRequest,
+	amount string,
+	payerPubkey solana.PublicKey,
+) (*PaymentSimulation, error) {
+	if amount == "" {
+		amount = request.MaxAmountRequired
+	}
+	tokenMint, err := solana.PublicKeyFromBase58(request.AssetAddress)
+	if err != nil {
+		return nil, NewTransactionBroadcastError("invalid token mint address: " + err.Error())
+	}
+
+	tx, err := sp.CreatePaymentTransactionFor(ctx, request, amount, payerPubkey)
+	if err != nil {
+		return nil, err
+	}
+	// Signatures are not verified, but the transaction must carry them
+	tx.Signatures = make([]solana.Signature, tx.Message.Header.NumRequiredSignatures)
+
+	sim := &PaymentSimulation{}
+	sim.Fee, sim.Rent, err = sp.EstimateFees(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	sim.Balance, err = sp.solBalance(ctx, payerPubkey)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := sp.client.SimulateTransactionWithOpts(ctx, tx, &rpc.SimulateTransactionOpts{
+		Commitment:             rpc.CommitmentConfirmed,
+		ReplaceRecentBlockhash: true,
+	})
+	if err != nil {
+		return nil, NewTransactionBroadcastError("failed to simulate transaction: " + err.Error())
+	}
+	if result.Value != nil {
+		sim.Logs = result.Value.Logs
+		if result.Value.UnitsConsumed != nil {
+			sim.UnitsConsumed = *result.Value.UnitsConsumed
+		}
+	}
+
+	// Report the most specific reason first; the simulation error is terse
+	payerTokenAccount, err := associatedTokenAddress(payerPubkey, tokenMint, sp.lookupMint(ctx, tokenMint).program)
+	if err != nil {
+		return nil, NewTransactionBroadcastError("failed to derive payer token account: " + err.Error())
+	}
+	switch {
+	case sim.Balance < sim.Fee+sim.Rent:
+		sim.Err = NewInsufficientFeeBalanceError(sim.Fee+sim.Rent, sim.Balance)
+	case !sp.accountExists(ctx, payerTokenAccount):
+		sim.Err = NewInsufficientFundsError(amount, "0")
+	case result.Value != nil && result.Value.Err != nil:
+		sim.Err = sp.simulationError(ctx, payerPubkey, request.AssetAddress, amount, result.Value.Err)
+	}
+	if sim.Err != nil {
+		sp.logger.Debug("x402: payment simulation failed", LogKeyPayer, payerPubkey.String(), "error", sim.Err)
+	}
+	return sim, nil
+}
+
+// EstimateFees returns the fee of a payment transaction in lamports,
+// including the priority fee, and the rent it pays to create recipients' token
+// accounts (0 if they exist).
+func (sp *SolanaPaymentProcessor) EstimateFees(ctx context.Context, tx *solana.Transaction) (fee, rent uint64, err error) {
+	message, err := tx.Message.MarshalBinary()
+	if err != nil {
+		return 0, 0, NewTransactionBroadcastError("failed to encode transaction: " + err.Error())
+	}
+	result, err := sp.client.GetFeeForMessage(ctx, base64.StdEncoding.EncodeToString(message), rpc.CommitmentConfirmed)
+	if err != nil {
+		return 0, 0, NewTransactionBroadcastError("failed to estimate fee: " + err.Error())
+	}
+	if result.Value != nil {
+		fee = *result.Value
+	}
+
+	if accounts := createdTokenAccounts(tx); accounts > 0 {
+		rent, err = sp.client.GetMinimumBalanceForRentExemption(ctx, tokenAccountSize, rpc.CommitmentConfirmed)
+		if err != nil {
+			return 0, 0, NewTransactionBroadcastError("failed to get rent exemption: " + err.Error())
+		}
+		rent *= uint64(accounts)
+	}
+	return fee, rent, nil
+}
+
+// CheckFeeBalance returns an *InsufficientFeeBalanceError if the payer of a
+// payment transaction has too little SOL for its fee and rent.
+func (sp *SolanaPaymentProcessor) CheckFeeBalance(ctx context.Context, tx *solana.Transaction, payer solana.PublicKey) error {
+	fee, rent, err := sp.EstimateFees(ctx, tx)
+	if err != nil {
+		return err
+	}
+	balance, err := sp.solBalance(ctx, payer)
+	if err != nil {
+		return err
+	}
+	if balance < fee+rent {
+		sp.logger.Warn("x402: insufficient SOL for transaction fees", LogKeyPayer, payer.String(), "required_lamports", fee+rent, "available_lamports", balance)
+		return NewInsufficientFeeBalanceError(fee+rent, balance)
+	}
+	return nil
+}
+
+// solBalance returns the SOL balance of an account in lamports.
+func (sp *SolanaPaymentProcessor) solBalance(ctx context.Context, account solana.PublicKey) (uint64, error) {
+	balance, err := sp.client.GetBalance(ctx, account, rpc.CommitmentConfirmed)
+	if err != nil {
+		return 0, NewTransactionBroadcastError("failed to get SOL balance: " + err.Error())
+	}
+	return balance.Value, nil
+}
+
+// simulationError converts a simulation failure, reporting an insufficient
+// token balance as such.
+func (sp *SolanaPaymentProcessor) simulationError(ctx context.Context, payer solana.PublicKey, mint, amount string, simErr interface{}) error {
+	balance, err := sp.GetTokenBalance(ctx, payer.String(), mint)
+	if err == nil {
+		var required float64
+		if _, scanErr := fmt.Sscanf(amount, "%f", &required); scanErr == nil && balance < required {
+			return NewInsufficientFundsError(amount, fmt.Sprintf("%.6f", balance))
+		}
+	}
+	return NewTransactionBroadcastError(fmt.Sprintf("transaction simulation failed: %v", simErr))
+}
+
+// accountExists reports whether an account exists. Lookup failures count as
+// existing so that the simulation result decides.
+func (sp *SolanaPaymentProcessor) accountExists(ctx context.Context, account solana.PublicKey) bool {
+	info, err := sp.client.GetAccountInfo(ctx, account)
+	if errors.Is(err, rpc.ErrNotFound) {
+		return false
+	}
+	return err != nil || (info != nil && info.Value != nil)
+}
+
+// createdTokenAccounts returns how many recipient associated token accounts
+// a payment transaction creates.
+func createdTokenAccounts(tx *solana.Transaction) int {
+	accounts := 0
+	for _, ix := range tx.Message.Instructions {
+		programID, err := tx.Message.Program(ix.ProgramIDIndex)
+		if err == nil && programID.Equals(solana.SPLAssociatedTokenAccountProgramID) {
+			accounts++
+		}
+	}
+	return accounts
+}
@@ -2,19 +2,37 @@ package core
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"math"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/gagliardetto/solana-go"
-	associatedtokenaccount "github.com/gagliardetto/solana-go/programs/associated-token-account"
-	"github.com/gagliardetto/solana-go/programs/token"
 	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/gagliardetto/solana-go/rpc/jsonrpc"
+	"github.com/gagliardetto/solana-go/rpc/ws"
 )
 
 // SolanaPaymentProcessor handles all Solana blockchain operations for X402 payments.
 type SolanaPaymentProcessor struct {
 	client  *rpc.Client
 	keypair *solana.PrivateKey
+	logger  *slog.Logger
+	retry   RetryPolicy
+
+	blockhashRefreshes int
+	computeBudget      ComputeBudget
+	commitment         Commitment
+	wsURL              string
+	pollInterval       time.Duration
+	signatureWait      time.Duration
+
+	wsMu     sync.Mutex
+	wsClient *ws.Client
 }
 
 // NewSolanaPaymentProcessor creates a new SolanaPaymentProcessor.
@@ -26,14 +44,112 @@ func NewSolanaPaymentProcessor(rpcURL string, keypair *solana.PrivateKey) *Solan
 	return &SolanaPaymentProcessor{
 		client:  rpc.New(rpcURL),
 		keypair: keypair,
+		logger:  LoggerOrDiscard(nil),
 	}
 }
 
+// NewSolanaPaymentProcessorWithHTTPClient creates a SolanaPaymentProcessor that
+// sends RPC requests through httpClient, e.g. to share a tuned, pooled transport.
+//
+// The processor is safe for concurrent use and should be reused across
+// requests so that connections to the RPC node are kept alive.
+func NewSolanaPaymentProcessorWithHTTPClient(rpcURL string, keypair *solana.PrivateKey, httpClient *http.Client) *SolanaPaymentProcessor {
+	return NewSolanaPaymentProcessorWithOptions(rpcURL, keypair, ProcessorOptions{HTTPClient: httpClient})
+}
+
+// ProcessorOptions configures a SolanaPaymentProcessor.
+type ProcessorOptions struct {
+	// HTTPClient optionally sets the HTTP client used for RPC requests, e.g. to
+	// share a tuned, pooled transport.
+	HTTPClient *http.Client
+	// Logger receives logs for RPC operations (default: discard).
+	Logger *slog.Logger
+	// Retry controls retries of transient RPC failures when sending and
+	// verifying transactions (default: no retries).
+	Retry RetryPolicy
+	// BlockhashRefreshes is how many times a transaction rejected for an
+	// expired blockhash is rebuilt with a fresh blockhash, re-signed, and sent
+	// again (default: 2, negative disables).
+	BlockhashRefreshes int
+	// ComputeBudget sets the default priority fee and compute unit limit of
+	// payment transactions (see WithComputeBudget for per-payment overrides).
+	ComputeBudget ComputeBudget
+	// Commitment is the commitment transactions must reach to be verified and
+	// the default of WaitForConfirmation (default: confirmed).
+	Commitment Commitment
+	// WSURL optionally sets the RPC node's WebSocket endpoint, e.g.
+	// "wss://api.devnet.solana.com". WaitForConfirmation then subscribes to
+	// signatures instead of polling, and verification waits for transactions
+	// that have not landed yet instead of rejecting them.
+	WSURL string
+	// PollInterval is the delay between signature status checks when polling
+	// for confirmation (default: 500ms).
+	PollInterval time.Duration
+	// SignatureWait bounds how long verification waits over WSURL for a
+	// transaction that has not landed yet (default: 10s).
+	SignatureWait time.Duration
+	// RPCURLs optionally adds RPC endpoints. Calls are then spread
+	// round-robin over rpcURL and RPCURLs, and a call failing with a transient
+	// error fails over to the next endpoint. Failing endpoints are skipped for
+	// 30 seconds.
+	RPCURLs []string
+	// HealthCheckInterval enables periodic getHealth checks of RPCURLs
+	// endpoints when positive, so that unhealthy ones are skipped until they
+	// recover.
+	HealthCheckInterval time.Duration
+	// RateLimit caps the rate of calls to each RPC endpoint (default: none).
+	RateLimit RateLimit
+}
+
+// NewSolanaPaymentProcessorWithOptions creates a SolanaPaymentProcessor with
+// the given options.
+//
+// Example:
+//
+//	processor := core.NewSolanaPaymentProcessorWithOptions(rpcURL, &keypair, core.ProcessorOptions{
+//	    Retry: core.DefaultRetryPolicy(),
+//	})
+func NewSolanaPaymentProcessorWithOptions(rpcURL string, keypair *solana.PrivateKey, opts ProcessorOptions) *SolanaPaymentProcessor {
+	client := rpc.New(rpcURL)
+	if len(opts.RPCURLs) > 0 {
+		urls := append([]string{rpcURL}, opts.RPCURLs...)
+		client = rpc.NewWithCustomRPCClient(newFailoverRPCClient(urls, opts.HTTPClient, opts.RateLimit, LoggerOrDiscard(opts.Logger), opts.HealthCheckInterval))
+	} else if opts.HTTPClient != nil || opts.RateLimit.RequestsPerSecond > 0 {
+		client = rpc.NewWithCustomRPCClient(limitRPCClient(jsonrpc.NewClientWithOpts(rpcURL, &jsonrpc.RPCClientOpts{HTTPClient: opts.HTTPClient}), opts.RateLimit))
+	}
+	return &SolanaPaymentProcessor{
+		client:  client,
+		keypair: keypair,
+		logger:  LoggerOrDiscard(opts.Logger),
+		retry:   opts.Retry,
+
+		blockhashRefreshes: opts.BlockhashRefreshes,
+		computeBudget:      opts.ComputeBudget,
+		commitment:         opts.Commitment,
+		wsURL:              opts.WSURL,
+		pollInterval:       opts.PollInterval,
+		signatureWait:      opts.SignatureWait,
+	}
+}
+
+// SetLogger sets the logger for RPC operations (nil disables logging).
+func (sp *SolanaPaymentProcessor) SetLogger(logger *slog.Logger) {
+	sp.logger = LoggerOrDiscard(logger)
+}
+
+// SetRetryPolicy sets the retry policy for transient RPC failures.
+func (sp *SolanaPaymentProcessor) SetRetryPolicy(policy RetryPolicy) {
+	sp.retry = policy
+}
+
 // Close closes the processor and cleans up resources.
+//
+// Idle connections to the RPC node and the WebSocket connection, if any,
+// are released.
 func (sp *SolanaPaymentProcessor) Close() error {
-	// The Solana RPC client doesn't require explicit cleanup
 	sp.keypair = nil
-	return nil
+	sp.closeWebSocket()
+	return sp.client.Close()
 }
 
 // CreatePaymentTransaction creates a Solana transaction for an X402 payment.
@@ -55,27 +171,33 @@ func (sp *SolanaPaymentProcessor) CreatePaymentTransaction(
 	amount string,
 	payerKeypair solana.PrivateKey,
 ) (*solana.Transaction, error) {
-	// Parse addresses
-	payerPubkey := payerKeypair.PublicKey()
-	recipientPubkey, err := solana.PublicKeyFromBase58(request.PaymentAddress)
-	if err != nil {
-		return nil, NewTransactionBroadcastError("invalid payment address: " + err.Error())
-	}
+	return sp.CreatePaymentTransactionFor(ctx, request, amount, payerKeypair.PublicKey())
+}
 
+// CreatePaymentTransactionFor creates a payment transaction like
+// CreatePaymentTransaction for the payer's public key, for signing with a Signer.
+func (sp *SolanaPaymentProcessor) CreatePaymentTransactionFor(
+	ctx context.Context,
+	request *PaymentRequest,
+	amount string,
+	payerPubkey solana.PublicKey,
+) (*solana.Transaction, error) {
 	tokenMint, err := solana.PublicKeyFromBase58(request.AssetAddress)
 	if err != nil {
 		return nil, NewTransactionBroadcastError("invalid token mint address: " + err.Error())
 	}
 
-	// Get associated token accounts
-	payerTokenAccount, _, err := solana.FindAssociatedTokenAddress(payerPubkey, tokenMint)
+	// Token-2022 mints have their own token accounts and instructions
+	mint := sp.lookupMint(ctx, tokenMint)
+	legs, err := paymentLegs(request, amount, mint.decimals)
 	if err != nil {
-		return nil, NewTransactionBroadcastError("failed to derive payer token account: " + err.Error())
+		return nil, err
 	}
 
-	recipientTokenAccount, _, err := solana.FindAssociatedTokenAddress(recipientPubkey, tokenMint)
+	// Get associated token accounts
+	payerTokenAccount, err := associatedTokenAddress(payerPubkey, tokenMint, mint.program)
 	if err != nil {
-		return nil, NewTransactionBroadcastError("failed to derive recipient token account: " + err.Error())
+		return nil, NewTransactionBroadcastError("failed to derive payer token account: " + err.Error())
 	}
 
 	// Get recent blockhash
@@ -84,41 +206,43 @@ func (sp *SolanaPaymentProcessor) CreatePaymentTransaction(
 		return nil, NewTransactionBroadcastError("failed to get recent blockhash: " + err.Error())
 	}
 
-	// Build instructions
-	var instructions []solana.Instruction
+	// Build instructions, starting with the compute budget (priority fee)
+	instructions := sp.computeBudgetInstructions(ctx)
+	for _, leg := range legs {
+		recipientTokenAccount, err := associatedTokenAddress(leg.recipient, tokenMint, mint.program)
+		if err != nil {
+			return nil, NewTransactionBroadcastError("failed to derive recipient token account: " + err.Error())
+		}
+
+		// Check if recipient's token account exists
+		recipientAccountInfo, err := sp.client.GetAccountInfo(ctx, recipientTokenAccount)
+		if err != nil || recipientAccountInfo == nil || recipientAccountInfo.Value == nil {
+			// Create recipient's associated token account
+			instructions = append(instructions, createAssociatedTokenAccountInstruction(
+				payerPubkey,           // payer
+				recipientTokenAccount, // account
+				leg.recipient,         // wallet address
+				tokenMint,             // mint
+				mint.program,
+			))
+		}
 
-	// Check if recipient's token account exists
-	recipientAccountInfo, err := sp.client.GetAccountInfo(ctx, recipientTokenAccount)
-	if err != nil || recipientAccountInfo == nil || recipientAccountInfo.Value == nil {
-		// Create recipient's associated token account
-		createAccountIx := associatedtokenaccount.NewCreateInstruction(
-			payerPubkey,     // payer
-			recipientPubkey, // wallet address
-			tokenMint,       // mint
-		).Build()
-		instructions = append(instructions, createAccountIx)
+		// Create transfer instruction
+		instructions = append(instructions, transferCheckedIx(
+			mint.program,
+			payerTokenAccount,
+			tokenMint,
+			recipientTokenAccount,
+			payerPubkey,
+			leg.units,
+			mint.decimals,
+		))
 	}
 
-	// Convert amount to smallest unit (assuming 6 decimals for SPL tokens like USDC)
-	decimals := 6
-	amountFloat := 0.0
-	_, err = fmt.Sscanf(amount, "%f", &amountFloat)
-	if err != nil {
-		return nil, NewTransactionBroadcastError("invalid amount format: " + err.Error())
-	}
-	amountInSmallestUnit := uint64(math.Floor(amountFloat * math.Pow(10, float64(decimals))))
-
-	// Create transfer instruction
-	transferIx := token.NewTransferCheckedInstruction(
-		amountInSmallestUnit,
-		uint8(decimals),
-		payerTokenAccount,
-		tokenMint,
-		recipientTokenAccount,
-		payerPubkey,
-		[]solana.PublicKey{},
-	).Build()
-	instructions = append(instructions, transferIx)
+	// Link the transfer to the payment request
+	if request.PaymentID != "" {
+		instructions = append(instructions, memoInstruction(PaymentMemo(request.PaymentID)))
+	}
 
 	// Create transaction with all instructions
 	tx, err := solana.NewTransaction(
@@ -147,33 +271,79 @@ func (sp *SolanaPaymentProcessor) SignAndSendTransaction(
 	transaction *solana.Transaction,
 	keypair solana.PrivateKey,
 ) (string, error) {
-	// Sign the transaction
-	_, err := transaction.Sign(func(key solana.PublicKey) *solana.PrivateKey {
-		if key.Equals(keypair.PublicKey()) {
-			return &keypair
+	return sp.SignAndSendTransactionWithSigner(ctx, transaction, NewKeypairSigner(keypair))
+}
+
+// SignAndSendTransactionWithSigner signs a transaction with signer and
+// broadcasts it like SignAndSendTransaction.
+func (sp *SolanaPaymentProcessor) SignAndSendTransactionWithSigner(
+	ctx context.Context,
+	transaction *solana.Transaction,
+	signer Signer,
+) (string, error) {
+	payer := signer.PublicKey().String()
+	var sig solana.Signature
+	for refresh := 0; ; refresh++ {
+		// Sign the transaction
+		err := signTransaction(ctx, transaction, signer)
+		if err != nil {
+			return "", NewTransactionBroadcastError("failed to sign transaction: " + err.Error())
 		}
-		return nil
-	})
-	if err != nil {
-		return "", NewTransactionBroadcastError("failed to sign transaction: " + err.Error())
-	}
 
-	// Send the transaction
-	sig, err := sp.client.SendTransactionWithOpts(
-		ctx,
-		transaction,
-		rpc.TransactionOpts{
-			SkipPreflight:       false,
-			PreflightCommitment: rpc.CommitmentFinalized,
-		},
-	)
-	if err != nil {
+		// Send the transaction; resending the same signed transaction is idempotent
+		err = sp.withRetry(ctx, "sendTransaction", func() error {
+			var sendErr error
+			sig, sendErr = sp.client.SendTransactionWithOpts(
+				ctx,
+				transaction,
+				rpc.TransactionOpts{
+					SkipPreflight:       false,
+					PreflightCommitment: rpc.CommitmentFinalized,
+				},
+			)
+			return sendErr
+		})
+		if err == nil {
+			break
+		}
+
+		// Rebuild with a fresh blockhash if the transaction expired before landing
+		if isBlockhashExpired(err) && refresh < sp.maxBlockhashRefreshes() {
+			blockhash, bhErr := sp.client.GetLatestBlockhash(ctx, rpc.CommitmentFinalized)
+			if bhErr == nil {
+				sp.logger.Info("x402: blockhash expired, rebuilding transaction", "attempt", refresh+1, LogKeyPayer, payer)
+				transaction.Message.RecentBlockhash = blockhash.Value.Blockhash
+				continue
+			}
+			sp.logger.Warn("x402: failed to refresh blockhash", "error", bhErr)
+		}
+
+		sp.logger.Error("x402: failed to send transaction", "error", err)
 		return "", NewTransactionBroadcastError("failed to send transaction: " + err.Error())
 	}
 
+	sp.logger.Info("x402: transaction sent", LogKeyTxHash, sig.String(), LogKeyPayer, payer)
 	return sig.String(), nil
 }
 
+// maxTransactionVersion is the highest transaction version fetched for verification.
+var maxTransactionVersion uint64 = 0
+
+// maxBlockhashRefreshes returns how often an expired transaction is rebuilt.
+func (sp *SolanaPaymentProcessor) maxBlockhashRefreshes() int {
+	if sp.blockhashRefreshes == 0 {
+		return 2
+	}
+	return sp.blockhashRefreshes
+}
+
+// isBlockhashExpired reports whether a send failed because the transaction's
+// blockhash is unknown to the node or has expired.
+func isBlockhashExpired(err error) bool {
+	message := strings.ToLower(err.Error())
+	return strings.Contains(message, "blockhash not found") || strings.Contains(message, "block height exceeded")
+}
+
 // VerifyTransaction verifies that a transaction exists on-chain and matches expected parameters.
 //
 // Parameters:
@@ -192,33 +362,187 @@ func (sp *SolanaPaymentProcessor) VerifyTransaction(
 	expectedAmount string,
 	expectedTokenMint string,
 ) (bool, error) {
+	return sp.VerifyTransactionWithMemo(ctx, transactionHash, expectedRecipient, expectedAmount, expectedTokenMint, "")
+}
+
+// VerifyTransactionWithMemo verifies a transaction like VerifyTransaction and,
+// if expectedMemo is not empty, that it carries that memo (see PaymentMemo).
+func (sp *SolanaPaymentProcessor) VerifyTransactionWithMemo(
+	ctx context.Context,
+	transactionHash string,
+	expectedRecipient string,
+	expectedAmount string,
+	expectedTokenMint string,
+	expectedMemo string,
+) (bool, error) {
+	transfer, err := sp.VerifyTransfer(ctx, transactionHash, expectedRecipient, expectedTokenMint, expectedMemo)
+	if err != nil {
+		return false, err
+	}
+	if CompareAmounts(transfer.Amount, expectedAmount) < 0 {
+		sp.logger.Warn("x402: transfer amount too low", LogKeyTxHash, transactionHash, LogKeyAmount, transfer.Amount, "expected_amount", expectedAmount)
+		return false, NewPaymentVerificationError(fmt.Sprintf("transferred %s, expected %s", transfer.Amount, expectedAmount))
+	}
+	return true, nil
+}
+
+// VerifyTransfer verifies that a transaction succeeded on-chain and
+// transferred tokens of expectedTokenMint to expectedRecipient, returning the
+// amount received. If expectedMemo is not empty, the transaction must also
+// carry that memo (see PaymentMemo).
+//
+// The amount is read from the transaction's token balance changes, so it
+// covers transfers made by any instruction or program.
+func (sp *SolanaPaymentProcessor) VerifyTransfer(
+	ctx context.Context,
+	transactionHash string,
+	expectedRecipient string,
+	expectedTokenMint string,
+	expectedMemo string,
+) (*VerifiedTransfer, error) {
 	// Parse the signature
 	sig, err := solana.SignatureFromBase58(transactionHash)
 	if err != nil {
-		return false, NewPaymentVerificationError("invalid transaction signature: " + err.Error())
+		return nil, NewPaymentVerificationError("invalid transaction signature: " + err.Error())
+	}
+	recipient, err := solana.PublicKeyFromBase58(expectedRecipient)
+	if err != nil {
+		return nil, NewPaymentVerificationError("invalid recipient address: " + err.Error())
+	}
+	mint, err := solana.PublicKeyFromBase58(expectedTokenMint)
+	if err != nil {
+		return nil, NewPaymentVerificationError("invalid token mint address: " + err.Error())
 	}
 
 	// Get transaction details
-	tx, err := sp.client.GetTransaction(ctx, sig, &rpc.GetTransactionOpts{
-		Commitment: rpc.CommitmentConfirmed,
-	})
+	var tx *rpc.GetTransactionResult
+	fetch := func() error {
+		return sp.withRetry(ctx, "getTransaction", func() error {
+			var getErr error
+			tx, getErr = sp.client.GetTransaction(ctx, sig, &rpc.GetTransactionOpts{
+				Commitment:                     sp.verifyCommitment(),
+				MaxSupportedTransactionVersion: &maxTransactionVersion,
+			})
+			return getErr
+		})
+	}
+	err = fetch()
+
+	// Wait for a transaction that has not landed yet instead of rejecting it
+	if errors.Is(err, rpc.ErrNotFound) && sp.wsURL != "" && sp.awaitSignature(ctx, sig) {
+		err = fetch()
+	}
 	if err != nil {
-		return false, NewPaymentVerificationError("transaction not found: " + err.Error())
+		sp.logger.Warn("x402: transaction lookup failed", LogKeyTxHash, transactionHash, "error", err)
+		return nil, NewPaymentVerificationError("transaction not found: " + err.Error())
 	}
 
 	if tx == nil {
-		return false, NewPaymentVerificationError("transaction not found")
+		sp.logger.Warn("x402: transaction not found", LogKeyTxHash, transactionHash)
+		return nil, NewPaymentVerificationError("transaction not found")
+	}
+	if tx.Meta == nil {
+		return nil, NewPaymentVerificationError("transaction status unavailable")
 	}
 
 	// Check if transaction was successful
-	if tx.Meta != nil && tx.Meta.Err != nil {
-		return false, NewPaymentVerificationError("transaction failed on-chain")
+	if tx.Meta.Err != nil {
+		sp.logger.Warn("x402: transaction failed on-chain", LogKeyTxHash, transactionHash, "error", tx.Meta.Err)
+		return nil, NewPaymentVerificationError("transaction failed on-chain")
 	}
 
-	// In a production implementation, you would parse the transaction details
-	// and verify the recipient, amount, and token mint match expected values.
-	// For now, we return true if the transaction exists and succeeded.
-	return true, nil
+	// Check the transfer is linked to the expected payment request
+	if expectedMemo != "" {
+		parsed, err := tx.Transaction.GetTransaction()
+		if err != nil {
+			return nil, NewPaymentVerificationError("failed to decode transaction: " + err.Error())
+		}
+		if !hasMemo(parsed, expectedMemo) {
+			sp.logger.Warn("x402: transaction memo mismatch", LogKeyTxHash, transactionHash, "memo", expectedMemo)
+			return nil, NewPaymentVerificationError("transaction memo does not match the payment request")
+		}
+	}
+
+	transfer := tokenTransfer(tx.Meta, recipient, mint)
+	if transfer == nil {
+		sp.logger.Warn("x402: transaction does not pay recipient", LogKeyTxHash, transactionHash, "recipient", expectedRecipient, "mint", expectedTokenMint)
+		return nil, NewPaymentVerificationError("transaction does not transfer the token to the payment address")
+	}
+
+	sp.logger.Debug("x402: transaction verified", LogKeyTxHash, transactionHash, LogKeyAmount, transfer.Amount, LogKeyPayer, transfer.Payer)
+	return transfer, nil
+}
+
+// RefundPayment returns amount of a verified payment to the payer.
+//
+// The processor must have been created with the keypair of the payment address
+// that received the payment. An empty amount refunds the full payment. The
+// payment transaction is looked up again, and the refund goes to the wallet
+// it debited, for no more than it paid; the payer and amount claimed by the
+// authorization are not trusted.
+//
+// Parameters:
+//   - ctx: Context for cancellation
+//   - authorization: The verified payment authorization being refunded
+//   - amount: The amount to refund (in token units, e.g., "0.05")
+//
+// Returns:
+//   - A Refund record with the refund transaction hash
+func (sp *SolanaPaymentProcessor) RefundPayment(
+	ctx context.Context,
+	authorization *PaymentAuthorization,
+	amount string,
+) (*Refund, error) {
+	if sp.keypair == nil {
+		return nil, NewTransactionBroadcastError("refunds require the payment address keypair")
+	}
+	if sp.keypair.PublicKey().String() != authorization.PaymentAddress {
+		return nil, NewTransactionBroadcastError("processor keypair does not own the payment address")
+	}
+
+	payment, err := sp.VerifyTransfer(ctx, authorization.TransactionHash, authorization.PaymentAddress, authorization.AssetAddress, "")
+	if err != nil {
+		return nil, err
+	}
+
+	if amount == "" {
+		amount = payment.Amount
+	}
+	refundAmount, ok := new(big.Rat).SetString(amount)
+	if !ok || refundAmount.Sign() <= 0 {
+		return nil, NewTransactionBroadcastError("invalid refund amount: " + amount)
+	}
+	paidAmount, ok := new(big.Rat).SetString(payment.Amount)
+	if !ok || refundAmount.Cmp(paidAmount) > 0 {
+		return nil, NewTransactionBroadcastError(fmt.Sprintf("refund amount %s exceeds payment amount %s", amount, payment.Amount))
+	}
+
+	// A refund is a payment from the payment address back to the payer
+	tx, err := sp.CreatePaymentTransaction(ctx, &PaymentRequest{
+		PaymentAddress: payment.Payer,
+		AssetAddress:   authorization.AssetAddress,
+		Network:        authorization.Network,
+	}, amount, *sp.keypair)
+	if err != nil {
+		return nil, err
+	}
+
+	txHash, err := sp.SignAndSendTransaction(ctx, tx, *sp.keypair)
+	if err != nil {
+		return nil, err
+	}
+
+	sp.logger.Info("x402: payment refunded", LogKeyPaymentID, authorization.PaymentID, LogKeyPayer, payment.Payer, LogKeyAmount, amount, LogKeyTxHash, txHash)
+	return &Refund{
+		RefundID:        txHash,
+		PaymentID:       authorization.PaymentID,
+		Amount:          amount,
+		Recipient:       payment.Payer,
+		AssetAddress:    authorization.AssetAddress,
+		Network:         authorization.Network,
+		TransactionHash: txHash,
+		CreatedAt:       time.Now().UTC(),
+	}, nil
 }
 
 // GetTokenBalance retrieves the SPL token balance for a wallet.
@@ -246,7 +570,7 @@ func (sp *SolanaPaymentProcessor) GetTokenBalance(
 	}
 
 	// Get associated token account
-	tokenAccount, _, err := solana.FindAssociatedTokenAddress(walletPubkey, mintPubkey)
+	tokenAccount, err := associatedTokenAddress(walletPubkey, mintPubkey, sp.lookupMint(ctx, mintPubkey).program)
 	if err != nil {
 		return 0, fmt.Errorf("failed to derive token account: %w", err)
 	}
@@ -255,6 +579,7 @@ func (sp *SolanaPaymentProcessor) GetTokenBalance(
 	accountInfo, err := sp.client.GetTokenAccountBalance(ctx, tokenAccount, rpc.CommitmentFinalized)
 	if err != nil {
 		// If account doesn't exist, return 0
+		sp.logger.Debug("x402: token balance unavailable, assuming 0", "wallet", walletAddress, "error", err)
 		return 0.0, nil
 	}
 
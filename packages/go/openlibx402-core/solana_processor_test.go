@@ -0,0 +1,163 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// refundRPC is a Solana JSON-RPC server answering getTransaction with one
+// transfer of amount base units of mint from payer to recipient, and
+// recording the transactions sent.
+type refundRPC struct {
+	*httptest.Server
+	sent []*solana.Transaction
+}
+
+func newRefundRPC(t *testing.T, payer, recipient, mint solana.PublicKey, amount uint64) *refundRPC {
+	t.Helper()
+	tx, err := solana.NewTransaction([]solana.Instruction{
+		memoInstruction("x402"),
+	}, solana.Hash{}, solana.TransactionPayer(payer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded, err := tx.ToBase64()
+	if err != nil {
+		t.Fatal(err)
+	}
+	balance := func(index int, owner solana.PublicKey, units uint64) map[string]interface{} {
+		return map[string]interface{}{
+			"accountIndex": index,
+			"mint":         mint.String(),
+			"owner":        owner.String(),
+			"uiTokenAmount": map[string]interface{}{
+				"amount":   strconv.FormatUint(units, 10),
+				"decimals": 6,
+			},
+		}
+	}
+	payment := map[string]interface{}{
+		"slot":        1,
+		"transaction": []string{encoded, "base64"},
+		"meta": map[string]interface{}{
+			"err":               nil,
+			"fee":               5000,
+			"preBalances":       []uint64{},
+			"postBalances":      []uint64{},
+			"preTokenBalances":  []interface{}{balance(1, payer, amount), balance(2, recipient, 0)},
+			"postTokenBalances": []interface{}{balance(1, payer, 0), balance(2, recipient, amount)},
+		},
+	}
+
+	rpc := &refundRPC{}
+	rpc.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var call struct {
+			ID     json.RawMessage   `json:"id"`
+			Method string            `json:"method"`
+			Params []json.RawMessage `json:"params"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&call); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var result interface{}
+		switch call.Method {
+		case "getTransaction":
+			result = payment
+		case "getAccountInfo":
+			result = map[string]interface{}{"context": map[string]int{"slot": 1}, "value": nil}
+		case "getRecentBlockhash":
+			result = map[string]interface{}{
+				"context": map[string]int{"slot": 1},
+				"value": map[string]interface{}{
+					"blockhash":     solana.Hash{1}.String(),
+					"feeCalculator": map[string]int{"lamportsPerSignature": 5000},
+				},
+			}
+		case "sendTransaction":
+			var data string
+			json.Unmarshal(call.Params[0], &data)
+			sent, err := solana.TransactionFromBase64(data)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			rpc.sent = append(rpc.sent, sent)
+			result = sent.Signatures[0].String()
+		default:
+			http.Error(w, "unexpected call "+call.Method, http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": call.ID, "result": result})
+	}))
+	t.Cleanup(rpc.Close)
+	return rpc
+}
+
+// transferDestination returns the destination token account of the
+// transferChecked instruction of tx.
+func transferDestination(t *testing.T, tx *solana.Transaction) solana.PublicKey {
+	t.Helper()
+	for _, ix := range tx.Message.Instructions {
+		program, err := tx.Message.Program(ix.ProgramIDIndex)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if program.Equals(solana.TokenProgramID) && len(ix.Data) > 0 && ix.Data[0] == transferCheckedInstruction {
+			return tx.Message.AccountKeys[ix.Accounts[2]]
+		}
+	}
+	t.Fatal("transaction has no transfer")
+	return solana.PublicKey{}
+}
+
+func TestRefundPaymentPaysOnChainPayer(t *testing.T) {
+	keypair := solana.NewWallet().PrivateKey
+	payer := solana.NewWallet().PublicKey()
+	mint := solana.NewWallet().PublicKey()
+	rpc := newRefundRPC(t, payer, keypair.PublicKey(), mint, 100_000)
+	sp := NewSolanaPaymentProcessor(rpc.URL, &keypair)
+
+	// The authorization claims another payer and more than was paid
+	var hash solana.Signature
+	hash[0] = 1
+	authorization := &PaymentAuthorization{
+		PaymentID:       "payment",
+		ActualAmount:    "5.00",
+		PaymentAddress:  keypair.PublicKey().String(),
+		AssetAddress:    mint.String(),
+		Network:         "solana-devnet",
+		Timestamp:       time.Now().UTC(),
+		PublicKey:       solana.NewWallet().PublicKey().String(),
+		TransactionHash: hash.String(),
+	}
+	if _, err := sp.RefundPayment(context.Background(), authorization, "1.00"); err == nil {
+		t.Fatal("refund beyond the amount paid on-chain was sent")
+	}
+
+	refund, err := sp.RefundPayment(context.Background(), authorization, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refund.Recipient != payer.String() || refund.Amount != "0.100000" {
+		t.Errorf("refunded %s to %s, want 0.100000 to %s", refund.Amount, refund.Recipient, payer)
+	}
+	if len(rpc.sent) != 1 {
+		t.Fatalf("sent %d transactions, want 1", len(rpc.sent))
+	}
+	want, err := associatedTokenAddress(payer, mint, solana.TokenProgramID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := transferDestination(t, rpc.sent[0]); !got.Equals(want) {
+		t.Errorf("refund transferred to %s, want the payer's token account %s", got, want)
+	}
+}
@@ -0,0 +1,142 @@
+package core
+
+import (
+	"context"
+	"crypto/sha256"
+	"net/url"
+	"strings"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/openlibx402/go/openlibx402-core/qrcode"
+)
+
+// referenceDomain prefixes the payment ID a Solana Pay reference is derived
+// from.
+const referenceDomain = "x402-reference-v1:"
+
+// SolanaPayReference returns the Solana Pay reference of a payment request:
+// a public key derived from its payment ID, which wallets add to the
+// transfer as a read-only account so that the transaction can be found by
+// address. It has no private key.
+func SolanaPayReference(paymentID string) solana.PublicKey {
+	sum := sha256.Sum256([]byte(referenceDomain + paymentID))
+	return solana.PublicKeyFromBytes(sum[:])
+}
+
+// SolanaPayURL returns the Solana Pay transfer request URL paying a payment
+// request, for wallets that scan or open solana: URLs:
+//
+//	solana:<payment address>?amount=<amount>&spl-token=<mint>&reference=<reference>&memo=<memo>
+//
+// The transfer carries the payment request's reference (see
+// SolanaPayReference) and memo (see PaymentMemo), so a server can find it
+// and bind it to the payment request. Splits and escrow cannot be expressed
+// in a transfer request.
+func SolanaPayURL(request *PaymentRequest) string {
+	query := url.Values{}
+	query.Set("amount", request.MaxAmountRequired)
+	query.Set("spl-token", request.AssetAddress)
+	query.Set("reference", SolanaPayReference(request.PaymentID).String())
+	if request.Description != "" {
+		query.Set("message", request.Description)
+	}
+	query.Set("memo", PaymentMemo(request.PaymentID))
+	// Solana Pay encodes spaces as %20
+	return "solana:" + request.PaymentAddress + "?" + strings.ReplaceAll(query.Encode(), "+", "%20")
+}
+
+// QRCode encodes the payment request's Solana Pay URL as a QR code, for a
+// payer to scan with a mobile wallet. It fails if the server did not offer
+// Solana Pay (see PaymentRequest.SolanaPayURL).
+//
+// Example:
+//
+//	code, err := paymentReq.QRCode()
+//	if err != nil {
+//	    return err
+//	}
+//	png, err := code.PNG(8)
+func (pr *PaymentRequest) QRCode() (*qrcode.Code, error) {
+	if pr.SolanaPayURL == "" {
+		return nil, NewInvalidPaymentRequestError("payment request has no Solana Pay URL")
+	}
+	return qrcode.Encode(pr.SolanaPayURL, qrcode.Medium)
+}
+
+// SolanaPayTransfer is a parsed Solana Pay transfer request URL.
+type SolanaPayTransfer struct {
+	Recipient  string   // Wallet to pay
+	Amount     string   // Amount in token units, empty if the wallet asks the payer
+	SPLToken   string   // Token mint, empty for SOL
+	References []string // Accounts to add to the transfer
+	Label      string
+	Message    string
+	Memo       string
+}
+
+// ParseSolanaPayURL parses a Solana Pay transfer request URL.
+func ParseSolanaPayURL(rawURL string) (*SolanaPayTransfer, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, NewInvalidPaymentRequestError("invalid Solana Pay URL: " + err.Error())
+	}
+	if parsed.Scheme != "solana" {
+		return nil, NewInvalidPaymentRequestError("not a Solana Pay URL: " + rawURL)
+	}
+	recipient := parsed.Opaque
+	if _, err := solana.PublicKeyFromBase58(recipient); err != nil {
+		return nil, NewInvalidPaymentRequestError("invalid Solana Pay recipient: " + err.Error())
+	}
+	query := parsed.Query()
+	return &SolanaPayTransfer{
+		Recipient:  recipient,
+		Amount:     query.Get("amount"),
+		SPLToken:   query.Get("spl-token"),
+		References: query["reference"],
+		Label:      query.Get("label"),
+		Message:    query.Get("message"),
+		Memo:       query.Get("memo"),
+	}, nil
+}
+
+// ReferenceFinder is a PaymentProcessor that can find transactions by a
+// Solana Pay reference, as servers accepting Solana Pay payments need (see
+// serverx402.Config.SolanaPay).
+type ReferenceFinder interface {
+	PaymentProcessor
+	// FindReference returns the hash of the oldest successful transaction
+	// that includes reference, or "" if none has been confirmed.
+	FindReference(ctx context.Context, reference string) (string, error)
+}
+
+var (
+	_ ReferenceFinder = (*SolanaPaymentProcessor)(nil)
+	_ ReferenceFinder = (*MockProcessor)(nil)
+)
+
+// FindReference implements ReferenceFinder with getSignaturesForAddress.
+func (sp *SolanaPaymentProcessor) FindReference(ctx context.Context, reference string) (string, error) {
+	account, err := solana.PublicKeyFromBase58(reference)
+	if err != nil {
+		return "", NewPaymentVerificationError("invalid reference: " + err.Error())
+	}
+	var signatures []*rpc.TransactionSignature
+	err = sp.withRetry(ctx, "getSignaturesForAddress", func() error {
+		var getErr error
+		signatures, getErr = sp.client.GetSignaturesForAddressWithOpts(ctx, account, &rpc.GetSignaturesForAddressOpts{
+			Commitment: sp.verifyCommitment(),
+		})
+		return getErr
+	})
+	if err != nil {
+		return "", err
+	}
+	// Newest first
+	for i := len(signatures) - 1; i >= 0; i-- {
+		if signatures[i].Err == nil {
+			return signatures[i].Signature.String(), nil
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,105 @@
+package core
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// PaymentSplit pays a percentage of a payment to a recipient besides the
+// payment address, e.g. a creator's payout next to a platform's fee (see
+// PaymentRequest.Splits).
+type PaymentSplit struct {
+	Address    string `json:"address"`    // Recipient's wallet address
+	Percentage string `json:"percentage"` // Share of the amount, e.g. "80" for 80%
+}
+
+// ValidateSplits checks that splits name distinct valid recipients other than
+// paymentAddress with positive percentages that leave a share for it.
+func ValidateSplits(paymentAddress string, splits []PaymentSplit) error {
+	total := new(big.Rat)
+	seen := map[string]bool{paymentAddress: true}
+	for _, split := range splits {
+		if _, err := solana.PublicKeyFromBase58(split.Address); err != nil {
+			return fmt.Errorf("invalid split address %q: %w", split.Address, err)
+		}
+		if seen[split.Address] {
+			return fmt.Errorf("duplicate split recipient %s", split.Address)
+		}
+		seen[split.Address] = true
+		percentage, ok := new(big.Rat).SetString(split.Percentage)
+		if !ok || percentage.Sign() <= 0 {
+			return fmt.Errorf("invalid split percentage %q", split.Percentage)
+		}
+		total.Add(total, percentage)
+	}
+	if total.Cmp(big.NewRat(100, 1)) >= 0 {
+		return fmt.Errorf("split percentages add up to %s%%, leaving nothing for the payment address", total.FloatString(2))
+	}
+	return nil
+}
+
+// SplitAmounts divides amount among splits and returns the shares and the
+// rest, which goes to the payment address. Amounts are rounded down to
+// decimals, like the transfers of a payment.
+func SplitAmounts(amount string, splits []PaymentSplit, decimals uint8) (rest string, shares []string, err error) {
+	total, ok := new(big.Rat).SetString(amount)
+	if !ok || total.Sign() < 0 {
+		return "", nil, fmt.Errorf("invalid amount %q", amount)
+	}
+	scale := new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil))
+	units := func(r *big.Rat) *big.Int {
+		scaled := new(big.Rat).Mul(r, scale)
+		return new(big.Int).Quo(scaled.Num(), scaled.Denom())
+	}
+	format := func(n *big.Int) string {
+		return new(big.Rat).Quo(new(big.Rat).SetInt(n), scale).FloatString(int(decimals))
+	}
+
+	remaining := units(total)
+	for _, split := range splits {
+		percentage, ok := new(big.Rat).SetString(split.Percentage)
+		if !ok {
+			return "", nil, fmt.Errorf("invalid split percentage %q", split.Percentage)
+		}
+		share := units(new(big.Rat).Mul(total, new(big.Rat).Quo(percentage, big.NewRat(100, 1))))
+		remaining.Sub(remaining, share)
+		shares = append(shares, format(share))
+	}
+	return format(remaining), shares, nil
+}
+
+// paymentLeg is a transfer of a payment transaction.
+type paymentLeg struct {
+	recipient solana.PublicKey
+	units     uint64 // In the smallest unit of the mint
+}
+
+// paymentLegs returns the transfers paying amount for request: the payment
+// address's share and one per split.
+func paymentLegs(request *PaymentRequest, amount string, decimals uint8) ([]paymentLeg, error) {
+	recipient, err := solana.PublicKeyFromBase58(request.PaymentAddress)
+	if err != nil {
+		return nil, NewTransactionBroadcastError("invalid payment address: " + err.Error())
+	}
+	if err := ValidateSplits(request.PaymentAddress, request.Splits); err != nil {
+		return nil, NewTransactionBroadcastError(err.Error())
+	}
+	rest, shares, err := SplitAmounts(amount, request.Splits, decimals)
+	if err != nil {
+		return nil, NewTransactionBroadcastError("invalid amount format: " + err.Error())
+	}
+
+	scale := new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil))
+	units := func(amount string) uint64 {
+		scaled, _ := new(big.Rat).SetString(amount)
+		scaled.Mul(scaled, scale)
+		return new(big.Int).Quo(scaled.Num(), scaled.Denom()).Uint64()
+	}
+	legs := []paymentLeg{{recipient: recipient, units: units(rest)}}
+	for i, split := range request.Splits {
+		legs = append(legs, paymentLeg{recipient: solana.MustPublicKeyFromBase58(split.Address), units: units(shares[i])})
+	}
+	return legs, nil
+}
@@ -0,0 +1,35 @@
+package core
+
+import "time"
+
+// Subscription periods of a SubscriptionPlan.
+const (
+	PeriodDaily   = "daily"
+	PeriodWeekly  = "weekly"
+	PeriodMonthly = "monthly"
+)
+
+// SubscriptionPlan is a subscription a server offers in a 402 response in
+// place of paying per request. Paying for it grants access to every resource
+// offering the plan until the period ends; paying again renews it.
+type SubscriptionPlan struct {
+	ID          string `json:"id"`                    // Plan identifier, e.g. "pro-monthly"
+	Amount      string `json:"amount"`                // Price per period in token units
+	Period      string `json:"period"`                // "daily" | "weekly" | "monthly"
+	Description string `json:"description,omitempty"` // Human-readable description (optional)
+}
+
+// Extend returns the end of a period of the plan starting at start. Monthly
+// periods end on the same day of the next month, normalized as by
+// time.Time.AddDate. An unknown period ends at start.
+func (p *SubscriptionPlan) Extend(start time.Time) time.Time {
+	switch p.Period {
+	case PeriodDaily:
+		return start.AddDate(0, 0, 1)
+	case PeriodWeekly:
+		return start.AddDate(0, 0, 7)
+	case PeriodMonthly:
+		return start.AddDate(0, 1, 0)
+	}
+	return start
+}
@@ -0,0 +1,33 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+)
+
+// tabDomain prefixes the hashed fields of a tab ID.
+const tabDomain = "x402-tab-v1:"
+
+// TabTerms offer a tab for a resource (see PaymentRequest.Tab). Requests
+// paid with vouchers for the payer's tab are served without an on-chain
+// payment and charged to the tab, as long as its outstanding balance stays
+// within MaxOutstanding. The payer settles the tab by paying a payment
+// request that includes the outstanding balance.
+type TabTerms struct {
+	MaxOutstanding string `json:"max_outstanding"`       // Cap on unsettled charges, in token units
+	Outstanding    string `json:"outstanding,omitempty"` // Balance settled by this payment request, if any
+	// Charged is the total charged to the payer's tab when the payment
+	// request answers a voucher, so that a client that lost track of it can
+	// sign the next voucher.
+	Charged string `json:"charged,omitempty"`
+}
+
+// TabID returns the ID of a payer's tab with a payment address in a token,
+// which vouchers charging the tab carry as their ChannelID. Clients derive it
+// from the payment request, so a tab needs no round trip to open.
+func TabID(payer, paymentAddress, mint string) string {
+	fields, _ := json.Marshal([]string{payer, paymentAddress, mint})
+	sum := sha256.Sum256(append([]byte(tabDomain), fields...))
+	return hex.EncodeToString(sum[:16])
+}
@@ -0,0 +1,88 @@
+package core
+
+import (
+	"context"
+	"encoding/binary"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// Layout of a mint account shared by the SPL Token and Token-2022 programs:
+// the decimals follow the mint authority option (36 bytes) and the supply.
+const (
+	mintDecimalsOffset = 44
+	mintAccountSize    = 82
+)
+
+// defaultDecimals are assumed for mints that cannot be read, as for USDC.
+const defaultDecimals = 6
+
+// transferCheckedInstruction is the TransferChecked instruction index of the
+// SPL Token and Token-2022 programs.
+const transferCheckedInstruction = 12
+
+// mintInfo is the token program owning a mint and the mint's decimals.
+type mintInfo struct {
+	program  solana.PublicKey
+	decimals uint8
+}
+
+// lookupMint reads a mint account to find its token program and decimals,
+// so that Token-2022 mints and mints without 6 decimals are paid correctly.
+// A mint that cannot be read is assumed to be an SPL Token mint with 6
+// decimals.
+func (sp *SolanaPaymentProcessor) lookupMint(ctx context.Context, mint solana.PublicKey) mintInfo {
+	info := mintInfo{program: solana.TokenProgramID, decimals: defaultDecimals}
+	account, err := sp.client.GetAccountInfo(ctx, mint)
+	if err != nil || account == nil || account.Value == nil {
+		sp.logger.Debug("x402: token mint unavailable, assuming SPL Token with 6 decimals", "mint", mint.String(), "error", err)
+		return info
+	}
+	data := account.Value.Data.GetBinary()
+	if owner := account.Value.Owner; owner.Equals(solana.Token2022ProgramID) {
+		info.program = owner
+	}
+	if len(data) >= mintAccountSize {
+		info.decimals = data[mintDecimalsOffset]
+	}
+	return info
+}
+
+// associatedTokenAddress derives owner's associated token account for a mint
+// of a token program.
+func associatedTokenAddress(owner, mint, program solana.PublicKey) (solana.PublicKey, error) {
+	address, _, err := solana.FindProgramAddress(
+		[][]byte{owner[:], program[:], mint[:]},
+		solana.SPLAssociatedTokenAccountProgramID,
+	)
+	return address, err
+}
+
+// createAssociatedTokenAccountInstruction creates owner's associated token
+// account for a mint of a token program, paid for by payer.
+func createAssociatedTokenAccountInstruction(payer, account, owner, mint, program solana.PublicKey) solana.Instruction {
+	return solana.NewInstruction(solana.SPLAssociatedTokenAccountProgramID, solana.AccountMetaSlice{
+		solana.Meta(payer).WRITE().SIGNER(),
+		solana.Meta(account).WRITE(),
+		solana.Meta(owner),
+		solana.Meta(mint),
+		solana.Meta(solana.SystemProgramID),
+		solana.Meta(program),
+		solana.Meta(solana.SysVarRentPubkey),
+	}, []byte{})
+}
+
+// transferCheckedIx transfers amount from source to destination with a
+// token program's TransferChecked instruction.
+func transferCheckedIx(program, source, mint, destination, owner solana.PublicKey, amount uint64, decimals uint8) solana.Instruction {
+	data := make([]byte, 10)
+	data[0] = transferCheckedInstruction
+	binary.LittleEndian.PutUint64(data[1:9], amount)
+	data[9] = decimals
+	return solana.NewInstruction(program, solana.AccountMetaSlice{
+		solana.Meta(source).WRITE(),
+		solana.Meta(mint),
+		solana.Meta(destination).WRITE(),
+		solana.Meta(owner).SIGNER(),
+	}, data)
+}
@@ -0,0 +1,167 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+// Token is a token of the registry: the mint of a symbol on a network.
+type Token struct {
+	Symbol   string // e.g. "USDC"
+	Network  string // e.g. "solana-mainnet"
+	Mint     string
+	Decimals uint8
+}
+
+// ErrUnknownToken is returned by ValidateTokenMint for mints that are not
+// in the token registry.
+var ErrUnknownToken = errors.New("token mint is not in the token registry")
+
+// tokenRegistry holds the registered tokens, well-known stablecoins first.
+var tokenRegistry = struct {
+	sync.RWMutex
+	tokens []Token
+}{tokens: []Token{
+	{Symbol: "USDC", Network: "solana-mainnet", Mint: "EPjFWdd5AufqSSqeM2qN1xzybapC8G4wEGGkZwyTDt1v", Decimals: 6},
+	{Symbol: "USDC", Network: "solana-devnet", Mint: "4zMMC9srt5Ri5X14GAgXhaHii3GnPAEERYPJgZJDncDU", Decimals: 6},
+	{Symbol: "USDT", Network: "solana-mainnet", Mint: "Es9vMFrzaCERmJfrF4H2FYD4KCoNkY11McCe8BenwNYB", Decimals: 6},
+	{Symbol: "PYUSD", Network: "solana-mainnet", Mint: "2b1kV6DkPAnxd5ixfnxCpjxmKwqjjaYmCZfHsFu24GXo", Decimals: 6},
+	{Symbol: "PYUSD", Network: "solana-devnet", Mint: "CXk2AMBfi3TwaEL2468s6zP8xq9NxTXjp9gjMgzeUynM", Decimals: 6},
+}}
+
+// RegisterToken adds a token to the registry, e.g. a stablecoin of a test
+// validator, or replaces the token with the same symbol on its network.
+func RegisterToken(token Token) {
+	tokenRegistry.Lock()
+	defer tokenRegistry.Unlock()
+	for i, registered := range tokenRegistry.tokens {
+		if registered.Network == token.Network && strings.EqualFold(registered.Symbol, token.Symbol) {
+			tokenRegistry.tokens[i] = token
+			return
+		}
+	}
+	tokenRegistry.tokens = append(tokenRegistry.tokens, token)
+}
+
+// LookupToken returns the registered token with a symbol on a network.
+func LookupToken(network, symbol string) (Token, bool) {
+	tokenRegistry.RLock()
+	defer tokenRegistry.RUnlock()
+	for _, token := range tokenRegistry.tokens {
+		if token.Network == network && strings.EqualFold(token.Symbol, symbol) {
+			return token, true
+		}
+	}
+	return Token{}, false
+}
+
+// LookupMint returns the registered token with a mint on a network.
+func LookupMint(network, mint string) (Token, bool) {
+	tokenRegistry.RLock()
+	defer tokenRegistry.RUnlock()
+	for _, token := range tokenRegistry.tokens {
+		if token.Network == network && token.Mint == mint {
+			return token, true
+		}
+	}
+	return Token{}, false
+}
+
+// USDC returns the USDC mint of a network, or "" if it has none.
+func USDC(network string) string {
+	return tokenMint(network, "USDC")
+}
+
+// USDT returns the USDT mint of a network, or "" if it has none.
+func USDT(network string) string {
+	return tokenMint(network, "USDT")
+}
+
+// PYUSD returns the PYUSD mint of a network, or "" if it has none.
+func PYUSD(network string) string {
+	return tokenMint(network, "PYUSD")
+}
+
+func tokenMint(network, symbol string) string {
+	token, _ := LookupToken(network, symbol)
+	return token.Mint
+}
+
+// ValidateTokenMint checks that a mint is a registered token of a network.
+// A mint registered on other networks only, e.g. mainnet USDC configured on
+// devnet, is always an error; a mint that is not registered at all fails
+// with an error wrapping ErrUnknownToken, which callers may accept.
+func ValidateTokenMint(network, mint string) error {
+	if _, ok := LookupMint(network, mint); ok {
+		return nil
+	}
+	tokenRegistry.RLock()
+	defer tokenRegistry.RUnlock()
+	for _, token := range tokenRegistry.tokens {
+		if token.Mint == mint {
+			message := fmt.Sprintf("token mint %s is %s on %s, not on %s", mint, token.Symbol, token.Network, network)
+			if own := tokenMintLocked(network, token.Symbol); own != "" {
+				message += fmt.Sprintf(" (%s on %s is %s)", token.Symbol, network, own)
+			}
+			return errors.New(message)
+		}
+	}
+	return fmt.Errorf("%w: %s on %s", ErrUnknownToken, mint, network)
+}
+
+// tokenMintLocked is tokenMint for callers holding the registry lock.
+func tokenMintLocked(network, symbol string) string {
+	for _, token := range tokenRegistry.tokens {
+		if token.Network == network && strings.EqualFold(token.Symbol, symbol) {
+			return token.Mint
+		}
+	}
+	return ""
+}
+
+// MintInspector is a PaymentProcessor that can read token mints, as servers
+// checking their tokens against the registry need (see
+// serverx402.Config.StrictTokens).
+type MintInspector interface {
+	PaymentProcessor
+	// MintDecimals returns the decimals of a token mint. It fails if the
+	// account does not exist or is not a mint.
+	MintDecimals(ctx context.Context, mint string) (uint8, error)
+}
+
+var (
+	_ MintInspector = (*SolanaPaymentProcessor)(nil)
+	_ MintInspector = (*MockProcessor)(nil)
+)
+
+// MintDecimals implements MintInspector by reading the mint account.
+func (sp *SolanaPaymentProcessor) MintDecimals(ctx context.Context, mint string) (uint8, error) {
+	account, err := solana.PublicKeyFromBase58(mint)
+	if err != nil {
+		return 0, NewInvalidPaymentRequestError("invalid token mint: " + err.Error())
+	}
+	var decimals uint8
+	err = sp.withRetry(ctx, "getAccountInfo", func() error {
+		info, getErr := sp.client.GetAccountInfo(ctx, account)
+		if errors.Is(getErr, rpc.ErrNotFound) || (getErr == nil && (info == nil || info.Value == nil)) {
+			return NewInvalidPaymentRequestError("token mint " + mint + " does not exist")
+		}
+		if getErr != nil {
+			return getErr
+		}
+		owner := info.Value.Owner
+		data := info.Value.Data.GetBinary()
+		if (!owner.Equals(solana.TokenProgramID) && !owner.Equals(solana.Token2022ProgramID)) || len(data) < mintAccountSize {
+			return NewInvalidPaymentRequestError("account " + mint + " is not a token mint")
+		}
+		decimals = data[mintDecimalsOffset]
+		return nil
+	})
+	return decimals, err
+}
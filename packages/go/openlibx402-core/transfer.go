@@ -0,0 +1,83 @@
+package core
+
+import (
+	"math/big"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+// VerifiedTransfer is a token transfer read from a transaction on-chain.
+type VerifiedTransfer struct {
+	Amount   string // Tokens received by the recipient, in token units (e.g. "0.100000")
+	Decimals uint8  // Decimals of the token mint
+	Payer    string // Owner of the token account debited the most (empty if none)
+}
+
+// tokenTransfer returns the tokens of mint that owner's token accounts
+// received in a transaction, or nil if they received none.
+func tokenTransfer(meta *rpc.TransactionMeta, owner, mint solana.PublicKey) *VerifiedTransfer {
+	// Net change of each token account of the mint, by owner
+	changes := make(map[uint16]*big.Int)
+	owners := make(map[uint16]solana.PublicKey)
+	var decimals uint8
+	apply := func(balances []rpc.TokenBalance, sign int) {
+		for _, balance := range balances {
+			if !balance.Mint.Equals(mint) || balance.Owner == nil || balance.UiTokenAmount == nil {
+				continue
+			}
+			amount, ok := new(big.Int).SetString(balance.UiTokenAmount.Amount, 10)
+			if !ok {
+				continue
+			}
+			if changes[balance.AccountIndex] == nil {
+				changes[balance.AccountIndex] = new(big.Int)
+			}
+			if sign < 0 {
+				amount.Neg(amount)
+			}
+			changes[balance.AccountIndex].Add(changes[balance.AccountIndex], amount)
+			owners[balance.AccountIndex] = *balance.Owner
+			decimals = balance.UiTokenAmount.Decimals
+		}
+	}
+	apply(meta.PreTokenBalances, -1)
+	apply(meta.PostTokenBalances, 1)
+
+	received := new(big.Int)
+	var payer string
+	largestDebit := new(big.Int)
+	for index, change := range changes {
+		if owners[index].Equals(owner) {
+			received.Add(received, change)
+		} else if change.Sign() < 0 && change.CmpAbs(largestDebit) > 0 {
+			largestDebit.Abs(change)
+			payer = owners[index].String()
+		}
+	}
+	if received.Sign() <= 0 {
+		return nil
+	}
+
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil)
+	return &VerifiedTransfer{
+		Amount:   new(big.Rat).SetFrac(received, scale).FloatString(int(decimals)),
+		Decimals: decimals,
+		Payer:    payer,
+	}
+}
+
+// CompareAmounts compares two decimal token amounts exactly, returning -1, 0,
+// or +1 as a is less than, equal to, or greater than b. Invalid amounts
+// count as zero.
+func CompareAmounts(a, b string) int {
+	x, ok := new(big.Rat).SetString(a)
+	if !ok {
+		x = new(big.Rat)
+	}
+	y, ok := new(big.Rat).SetString(b)
+	if !ok {
+		y = new(big.Rat)
+	}
+	return x.Cmp(y)
+}
@@ -0,0 +1,144 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// VaultTransitOptions configures a VaultTransitSigner.
+type VaultTransitOptions struct {
+	Address    string       // Vault address, e.g. "https://vault.internal:8200"
+	Token      string       // Vault token with sign and read permissions on the key
+	Mount      string       // Transit secrets engine mount path (default: "transit")
+	KeyName    string       // Name of an ed25519 transit key
+	Namespace  string       // Vault Enterprise namespace (optional)
+	HTTPClient *http.Client // HTTP client for Vault requests (default: http.DefaultClient)
+}
+
+// VaultTransitSigner signs payments with an ed25519 key held by the
+// HashiCorp Vault Transit secrets engine, so the private key is never exported.
+type VaultTransitSigner struct {
+	opts      VaultTransitOptions
+	publicKey solana.PublicKey
+}
+
+// NewVaultTransitSigner creates a signer for a Vault Transit key, reading the
+// public key of its latest version from Vault.
+//
+// Example:
+//
+//	signer, err := core.NewVaultTransitSigner(ctx, core.VaultTransitOptions{
+//	    Address: os.Getenv("VAULT_ADDR"),
+//	    Token:   os.Getenv("VAULT_TOKEN"),
+//	    KeyName: "x402-payer",
+//	})
+func NewVaultTransitSigner(ctx context.Context, opts VaultTransitOptions) (*VaultTransitSigner, error) {
+	if opts.Mount == "" {
+		opts.Mount = "transit"
+	}
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = http.DefaultClient
+	}
+	s := &VaultTransitSigner{opts: opts}
+
+	var key struct {
+		Data struct {
+			Type          string `json:"type"`
+			LatestVersion int    `json:"latest_version"`
+			Keys          map[string]struct {
+				PublicKey string `json:"public_key"`
+			} `json:"keys"`
+		} `json:"data"`
+	}
+	if err := s.do(ctx, http.MethodGet, "keys", nil, &key); err != nil {
+		return nil, err
+	}
+	if key.Data.Type != "ed25519" {
+		return nil, fmt.Errorf("vault key %q is %s, not ed25519", opts.KeyName, key.Data.Type)
+	}
+	raw, err := base64.StdEncoding.DecodeString(key.Data.Keys[strconv.Itoa(key.Data.LatestVersion)].PublicKey)
+	if err != nil || len(raw) != solana.PublicKeyLength {
+		return nil, fmt.Errorf("vault key %q has an invalid public key", opts.KeyName)
+	}
+	s.publicKey = solana.PublicKeyFromBytes(raw)
+	return s, nil
+}
+
+// PublicKey returns the wallet address.
+func (s *VaultTransitSigner) PublicKey() solana.PublicKey {
+	return s.publicKey
+}
+
+// SignMessage signs message with the Vault key.
+func (s *VaultTransitSigner) SignMessage(ctx context.Context, message []byte) (solana.Signature, error) {
+	var result struct {
+		Data struct {
+			Signature string `json:"signature"`
+		} `json:"data"`
+	}
+	err := s.do(ctx, http.MethodPost, "sign", map[string]string{
+		"input": base64.StdEncoding.EncodeToString(message),
+	}, &result)
+	if err != nil {
+		return solana.Signature{}, err
+	}
+
+	// Signatures have the form vault:v<version>:<base64>
+	parts := strings.SplitN(result.Data.Signature, ":", 3)
+	if len(parts) != 3 {
+		return solana.Signature{}, fmt.Errorf("invalid signature from vault")
+	}
+	raw, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return solana.Signature{}, fmt.Errorf("invalid signature from vault: %w", err)
+	}
+	return checkSignature(raw, s.publicKey, message)
+}
+
+// do calls a Transit endpoint for the key and decodes the response into out.
+func (s *VaultTransitSigner) do(ctx context.Context, method, endpoint string, body interface{}, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	address := strings.TrimSuffix(s.opts.Address, "/") + "/v1/" + strings.Trim(s.opts.Mount, "/") + "/" + endpoint + "/" + url.PathEscape(s.opts.KeyName)
+	req, err := http.NewRequestWithContext(ctx, method, address, reader)
+	if err != nil {
+		return fmt.Errorf("failed to create vault request: %w", err)
+	}
+	req.Header.Set("X-Vault-Token", s.opts.Token)
+	if s.opts.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", s.opts.Namespace)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := s.opts.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("vault request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("vault returned %d: %s", resp.StatusCode, bytes.TrimSpace(detail))
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(out); err != nil {
+		return fmt.Errorf("invalid vault response: %w", err)
+	}
+	return nil
+}
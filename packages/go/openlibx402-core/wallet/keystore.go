@@ -0,0 +1,146 @@
+package wallet
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/gagliardetto/solana-go"
+	"golang.org/x/crypto/scrypt"
+)
+
+// keystore is the encrypted keystore format: the secret key encrypted with
+// AES-256-GCM under a key derived from the passphrase with scrypt.
+type keystore struct {
+	Version    int    `json:"version"`
+	PublicKey  string `json:"public_key"`
+	KDF        string `json:"kdf"`
+	N          int    `json:"n"`
+	R          int    `json:"r"`
+	P          int    `json:"p"`
+	Salt       []byte `json:"salt"`
+	Cipher     string `json:"cipher"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// scrypt parameters of new keystores (about 100ms and 64MB to unlock).
+const (
+	scryptN = 1 << 16
+	scryptR = 8
+	scryptP = 1
+)
+
+// Bounds of the scrypt parameters of keystores read, so that a crafted file
+// cannot make unlocking it take unbounded time or memory.
+const (
+	maxScryptN      = 1 << 20
+	maxScryptRP     = 64
+	maxScryptMemory = 1 << 30 // 128 * N * r bytes
+)
+
+// EncryptKeystore encrypts a keypair with a passphrase. The public key is
+// stored in the clear so the wallet address can be read without unlocking it.
+func EncryptKeystore(key solana.PrivateKey, passphrase []byte) ([]byte, error) {
+	if len(passphrase) == 0 {
+		return nil, errors.New("wallet: empty passphrase")
+	}
+	ks := keystore{
+		Version:   1,
+		PublicKey: key.PublicKey().String(),
+		KDF:       "scrypt",
+		N:         scryptN,
+		R:         scryptR,
+		P:         scryptP,
+		Salt:      make([]byte, 32),
+		Cipher:    "aes-256-gcm",
+	}
+	if _, err := rand.Read(ks.Salt); err != nil {
+		return nil, err
+	}
+	aead, err := keystoreCipher(passphrase, &ks)
+	if err != nil {
+		return nil, err
+	}
+	ks.Nonce = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(ks.Nonce); err != nil {
+		return nil, err
+	}
+	ks.Ciphertext = aead.Seal(nil, ks.Nonce, key, []byte(ks.PublicKey))
+	return json.MarshalIndent(ks, "", "  ")
+}
+
+// SaveKeystore encrypts a keypair with a passphrase and writes it to path,
+// readable only by the current user.
+func SaveKeystore(path string, key solana.PrivateKey, passphrase []byte) error {
+	data, err := EncryptKeystore(key, passphrase)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o600)
+}
+
+// decryptKeystore unlocks an encrypted keystore.
+func decryptKeystore(data []byte, passphrase PassphraseFunc) (solana.PrivateKey, error) {
+	var ks keystore
+	if err := json.Unmarshal(data, &ks); err != nil {
+		return nil, fmt.Errorf("wallet: invalid keystore: %w", err)
+	}
+	if ks.Version != 1 || ks.KDF != "scrypt" || ks.Cipher != "aes-256-gcm" {
+		return nil, fmt.Errorf("wallet: unsupported keystore (version %d, %s, %s)", ks.Version, ks.KDF, ks.Cipher)
+	}
+	if err := checkScryptParams(ks.N, ks.R, ks.P); err != nil {
+		return nil, err
+	}
+
+	secret, err := passphrase()
+	if err != nil {
+		return nil, err
+	}
+	defer zero(secret)
+	aead, err := keystoreCipher(secret, &ks)
+	if err != nil {
+		return nil, err
+	}
+	if len(ks.Nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("wallet: invalid keystore nonce of %d bytes", len(ks.Nonce))
+	}
+	key, err := aead.Open(nil, ks.Nonce, ks.Ciphertext, []byte(ks.PublicKey))
+	if err != nil {
+		return nil, errors.New("wallet: wrong passphrase or corrupt keystore")
+	}
+	return checkKey(key)
+}
+
+// checkScryptParams rejects scrypt parameters out of the keystore bounds: N
+// must be a power of two of at most maxScryptN, and r and p positive with a
+// product of at most maxScryptRP, within maxScryptMemory.
+func checkScryptParams(n, r, p int) error {
+	switch {
+	case n <= 1 || n > maxScryptN || n&(n-1) != 0:
+		return fmt.Errorf("wallet: invalid keystore parameters: n %d is not a power of two up to %d", n, maxScryptN)
+	case r <= 0 || p <= 0 || r > maxScryptRP/p:
+		return fmt.Errorf("wallet: invalid keystore parameters: r %d and p %d must be positive with a product up to %d", r, p, maxScryptRP)
+	case 128*n*r > maxScryptMemory:
+		return fmt.Errorf("wallet: invalid keystore parameters: n %d and r %d need more than %d bytes", n, r, maxScryptMemory)
+	}
+	return nil
+}
+
+// keystoreCipher derives the keystore's AES-256-GCM cipher from a passphrase.
+func keystoreCipher(passphrase []byte, ks *keystore) (cipher.AEAD, error) {
+	derived, err := scrypt.Key(passphrase, ks.Salt, ks.N, ks.R, ks.P, 32)
+	if err != nil {
+		return nil, fmt.Errorf("wallet: invalid keystore parameters: %w", err)
+	}
+	defer zero(derived)
+	block, err := aes.NewCipher(derived)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,86 @@
+package wallet
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// tamper returns a keystore changed by fn.
+func tamper(t *testing.T, data []byte, fn func(ks *keystore)) []byte {
+	t.Helper()
+	var ks keystore
+	if err := json.Unmarshal(data, &ks); err != nil {
+		t.Fatal(err)
+	}
+	fn(&ks)
+	data, err := json.Marshal(ks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestDecryptKeystoreRejectsInvalidNonce(t *testing.T) {
+	encrypted, err := EncryptKeystore(solana.NewWallet().PrivateKey, []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	passphrase := func() ([]byte, error) { return []byte("secret"), nil }
+	for _, nonce := range [][]byte{nil, make([]byte, 4), make([]byte, 64)} {
+		// Cheap parameters: the nonce is checked before decrypting
+		data := tamper(t, encrypted, func(ks *keystore) { ks.N, ks.Nonce = 1<<10, nonce })
+		if _, err := decryptKeystore(data, passphrase); err == nil || !strings.Contains(err.Error(), "nonce") {
+			t.Errorf("nonce of %d bytes: got %v, want an invalid nonce error", len(nonce), err)
+		}
+	}
+}
+
+func TestDecryptKeystoreBoundsScryptParameters(t *testing.T) {
+	encrypted, err := EncryptKeystore(solana.NewWallet().PrivateKey, []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name    string
+		n, r, p int
+	}{
+		{"n not a power of two", 3 << 10, 8, 1},
+		{"n too large", 1 << 30, 8, 1},
+		{"n zero", 0, 8, 1},
+		{"r zero", 1 << 10, 0, 1},
+		{"p negative", 1 << 10, 8, -1},
+		{"r*p too large", 1 << 10, 1 << 20, 1 << 20},
+		{"memory too large", 1 << 20, 64, 1},
+	} {
+		prompted := false
+		passphrase := func() ([]byte, error) {
+			prompted = true
+			return []byte("secret"), nil
+		}
+		data := tamper(t, encrypted, func(ks *keystore) { ks.N, ks.R, ks.P = tc.n, tc.r, tc.p })
+		if _, err := decryptKeystore(data, passphrase); err == nil || !strings.Contains(err.Error(), "invalid keystore parameters") {
+			t.Errorf("%s: got %v, want invalid keystore parameters", tc.name, err)
+		}
+		if prompted {
+			t.Errorf("%s: passphrase prompted for an invalid keystore", tc.name)
+		}
+	}
+}
+
+func TestDecryptKeystoreRoundTrip(t *testing.T) {
+	key := solana.NewWallet().PrivateKey
+	data, err := EncryptKeystore(key, []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := decryptKeystore(data, func() ([]byte, error) { return []byte("secret"), nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.PublicKey().Equals(key.PublicKey()) {
+		t.Errorf("decrypted %s, want %s", got.PublicKey(), key.PublicKey())
+	}
+}
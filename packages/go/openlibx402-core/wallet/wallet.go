@@ -0,0 +1,134 @@
+// Package wallet loads Solana wallet keypairs from files, so that private
+// keys need not be passed around in environment variables.
+//
+// Three formats are supported:
+//   - Solana CLI keypair files: a JSON array of the 64 secret key bytes, as
+//     written by solana-keygen (e.g. ~/.config/solana/id.json)
+//   - Base58 strings: the 64-byte secret key as exported by most wallets
+//   - Encrypted keystores written by SaveKeystore, unlocked with a passphrase
+package wallet
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/gagliardetto/solana-go"
+	"golang.org/x/term"
+)
+
+// PassphraseEnv is the environment variable LoadFromFile reads a keystore
+// passphrase from before prompting for it.
+const PassphraseEnv = "X402_WALLET_PASSPHRASE"
+
+// ErrPassphraseRequired is returned for an encrypted keystore when no
+// passphrase is available.
+var ErrPassphraseRequired = errors.New("wallet: keystore is encrypted and no passphrase is available")
+
+// PassphraseFunc returns the passphrase of an encrypted keystore.
+type PassphraseFunc func() ([]byte, error)
+
+// LoadFromFile loads a keypair from a file in any supported format. The
+// passphrase of an encrypted keystore is read from X402_WALLET_PASSPHRASE or,
+// if unset, prompted for on the terminal.
+//
+// Example:
+//
+//	keypair, err := wallet.LoadFromFile(os.ExpandEnv("$HOME/.config/solana/id.json"))
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	autoClient := client.NewAutoClient(keypair, "", nil)
+func LoadFromFile(path string) (solana.PrivateKey, error) {
+	return LoadFromFileWithPassphrase(path, DefaultPassphrase)
+}
+
+// LoadFromFileWithPassphrase loads a keypair from a file, calling passphrase
+// if it is an encrypted keystore.
+func LoadFromFileWithPassphrase(path string, passphrase PassphraseFunc) (solana.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("wallet: %w", err)
+	}
+	defer zero(data)
+	return Parse(data, passphrase)
+}
+
+// Parse decodes a keypair in any supported format.
+func Parse(data []byte, passphrase PassphraseFunc) (solana.PrivateKey, error) {
+	data = bytes.TrimSpace(data)
+	switch {
+	case len(data) == 0:
+		return nil, errors.New("wallet: empty key")
+	case data[0] == '[':
+		var secret []byte
+		var ints []int
+		if err := json.Unmarshal(data, &ints); err != nil {
+			return nil, fmt.Errorf("wallet: invalid keypair file: %w", err)
+		}
+		secret = make([]byte, len(ints))
+		for i, v := range ints {
+			if v < 0 || v > 255 {
+				return nil, errors.New("wallet: invalid keypair file: byte out of range")
+			}
+			secret[i] = byte(v)
+			ints[i] = 0
+		}
+		return checkKey(secret)
+	case data[0] == '{':
+		if passphrase == nil {
+			return nil, ErrPassphraseRequired
+		}
+		return decryptKeystore(data, passphrase)
+	default:
+		key, err := solana.PrivateKeyFromBase58(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("wallet: invalid base58 key: %w", err)
+		}
+		return checkKey(key)
+	}
+}
+
+// checkKey validates a 64-byte secret key: a seed followed by its public key.
+func checkKey(key solana.PrivateKey) (solana.PrivateKey, error) {
+	if len(key) != 64 {
+		return nil, fmt.Errorf("wallet: key is %d bytes, expected 64", len(key))
+	}
+	if !bytes.Equal(key[32:], solana.PrivateKey(key).PublicKey().Bytes()) {
+		return nil, errors.New("wallet: corrupt key: public key does not match secret")
+	}
+	return key, nil
+}
+
+// DefaultPassphrase reads the passphrase from X402_WALLET_PASSPHRASE, or
+// prompts for it if standard input is a terminal.
+func DefaultPassphrase() ([]byte, error) {
+	if passphrase := os.Getenv(PassphraseEnv); passphrase != "" {
+		return []byte(passphrase), nil
+	}
+	return PromptPassphrase("Wallet passphrase: ")
+}
+
+// PromptPassphrase prompts for a passphrase on the terminal without echoing it.
+func PromptPassphrase(prompt string) ([]byte, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return nil, ErrPassphraseRequired
+	}
+	fmt.Fprint(os.Stderr, prompt)
+	passphrase, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, fmt.Errorf("wallet: failed to read passphrase: %w", err)
+	}
+	return passphrase, nil
+}
+
+// zero overwrites b.
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
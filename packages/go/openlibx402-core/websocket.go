@@ -0,0 +1,98 @@
+package core
+
+import (
+	"context"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc/ws"
+)
+
+// webSocket returns the processor's WebSocket connection to the RPC node,
+// connecting on first use. The connection is shared by all subscriptions.
+func (sp *SolanaPaymentProcessor) webSocket(ctx context.Context) (*ws.Client, error) {
+	sp.wsMu.Lock()
+	defer sp.wsMu.Unlock()
+	if sp.wsClient == nil {
+		client, err := ws.Connect(ctx, sp.wsURL)
+		if err != nil {
+			return nil, err
+		}
+		sp.wsClient = client
+	}
+	return sp.wsClient, nil
+}
+
+// dropWebSocket closes a broken connection so the next subscription reconnects.
+func (sp *SolanaPaymentProcessor) dropWebSocket(client *ws.Client) {
+	sp.wsMu.Lock()
+	defer sp.wsMu.Unlock()
+	if sp.wsClient == client {
+		sp.wsClient = nil
+		client.Close()
+	}
+}
+
+// closeWebSocket closes the WebSocket connection, if any.
+func (sp *SolanaPaymentProcessor) closeWebSocket() {
+	sp.wsMu.Lock()
+	defer sp.wsMu.Unlock()
+	if sp.wsClient != nil {
+		sp.wsClient.Close()
+		sp.wsClient = nil
+	}
+}
+
+// awaitSignature waits up to the signature wait for a transaction to land at
+// the verification commitment. It reports whether it landed, successfully or not.
+func (sp *SolanaPaymentProcessor) awaitSignature(ctx context.Context, sig solana.Signature) bool {
+	wait := sp.signatureWait
+	if wait <= 0 {
+		wait = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, wait)
+	defer cancel()
+
+	sp.logger.Debug("x402: transaction not found, waiting for it to land", LogKeyTxHash, sig.String())
+	done, _ := sp.subscribeConfirmation(ctx, sig, sp.verifyCommitment())
+	return done && ctx.Err() == nil
+}
+
+// subscribeConfirmation waits for a signature notification. It returns false
+// if the subscription could not be used, so that the caller falls back to polling.
+func (sp *SolanaPaymentProcessor) subscribeConfirmation(ctx context.Context, sig solana.Signature, commitment Commitment) (bool, error) {
+	client, err := sp.webSocket(ctx)
+	if err != nil {
+		sp.logger.Warn("x402: WebSocket connection failed", "error", err)
+		return false, nil
+	}
+
+	sub, err := client.SignatureSubscribe(sig, commitment)
+	if err != nil {
+		sp.logger.Warn("x402: signature subscription failed", "error", err)
+		sp.dropWebSocket(client)
+		return false, nil
+	}
+	defer sub.Unsubscribe()
+
+	// The transaction may have been confirmed before the subscription started
+	if confirmed, err := sp.checkConfirmation(ctx, sig, commitment); confirmed || err != nil {
+		return true, err
+	}
+
+	select {
+	case result := <-sub.Response():
+		if result.Value.Err != nil {
+			sp.logger.Warn("x402: transaction failed on-chain", LogKeyTxHash, sig.String(), "error", result.Value.Err)
+			return true, NewTransactionBroadcastError("transaction failed on-chain")
+		}
+		sp.logger.Debug("x402: transaction confirmed", LogKeyTxHash, sig.String(), "commitment", commitment)
+		return true, nil
+	case err := <-sub.Err():
+		sp.logger.Warn("x402: signature subscription closed", "error", err)
+		sp.dropWebSocket(client)
+		return false, nil
+	case <-ctx.Done():
+		return true, NewTransactionBroadcastError("transaction not confirmed: " + ctx.Err().Error())
+	}
+}
@@ -2,47 +2,120 @@
 package echo
 
 import (
-	"crypto/rand"
-	"encoding/hex"
+	"context"
+	"errors"
 	"net/http"
 	"strconv"
-	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/openlibx402/go/openlibx402-core"
+	"github.com/openlibx402/go/openlibx402-server"
 )
 
 // Config holds global configuration for X402 middleware.
-type Config struct {
-	PaymentAddress string
-	TokenMint      string
-	Network        string
-	RPCURL         string
-	AutoVerify     bool
+type Config = serverx402.Config
+
+// ConfigFromEnv reads a Config from X402_* environment variables (see
+// serverx402.ConfigFromEnv).
+func ConfigFromEnv() (*Config, error) {
+	return serverx402.ConfigFromEnv()
+}
+
+// ConfigFromFile reads a Config from a JSON, YAML, or TOML file (see
+// serverx402.ConfigFromFile).
+func ConfigFromFile(path string) (*Config, error) {
+	return serverx402.ConfigFromFile(path)
 }
 
-var globalConfig *Config
+// PriceOverride adjusts the price of an endpoint for a specific payer.
+type PriceOverride = serverx402.PriceOverride
 
-// InitX402 initializes the global X402 configuration.
+var globalServer *serverx402.Server
+
+// InitX402 initializes the global X402 configuration. It fails, leaving the
+// middleware uninitialized, if the configuration is invalid (see
+// Config.Validate).
 //
 // This should be called once at application startup before using the PaymentRequired middleware.
 //
 // Example:
 //
-//	echox402.InitX402(&echox402.Config{
+//	if err := echox402.InitX402(&echox402.Config{
 //	    PaymentAddress: "YOUR_WALLET_ADDRESS",
 //	    TokenMint:      "USDC_MINT_ADDRESS",
 //	    Network:        "solana-devnet",
 //	    AutoVerify:     true,
-//	})
-func InitX402(config *Config) {
-	if config.Network == "" {
-		config.Network = "solana-devnet"
+//	}); err != nil {
+//	    log.Fatal(err)
+//	}
+func InitX402(config *Config) error {
+	if err := config.Validate(); err != nil {
+		return err
 	}
-	if config.RPCURL == "" {
-		config.RPCURL = core.GetDefaultRPCURL(config.Network)
+	globalServer = serverx402.New(config)
+	return nil
+}
+
+// Reload atomically replaces the payment address and token mint configured
+// with InitX402 at runtime (see serverx402.Server.Reload).
+func Reload(config *Config) error {
+	if globalServer == nil {
+		return errors.New("X402 not initialized. Call InitX402() first.")
+	}
+	return globalServer.Reload(config)
+}
+
+// Shutdown gracefully stops the server configured with InitX402: it waits
+// for pending settlements, delivers queued webhooks, and persists in-memory
+// stores (see serverx402.Server.Shutdown).
+func Shutdown(ctx context.Context) error {
+	if globalServer == nil {
+		return nil
 	}
-	globalConfig = config
+	return globalServer.Shutdown(ctx)
+}
+
+// X402 is a middleware instance bound to its own configuration.
+//
+// Unlike InitX402, which configures the package-level middleware, several
+// instances can coexist in one process (e.g., two wallets or networks).
+//
+// Example:
+//
+//	mainnet := echox402.New(&echox402.Config{
+//	    PaymentAddress: "MAINNET_WALLET_ADDRESS",
+//	    TokenMint:      "USDC_MINT_ADDRESS",
+//	    Network:        "solana-mainnet",
+//	})
+//	e.GET("/premium", handler, mainnet.PaymentRequired(echox402.PaymentRequiredOptions{Amount: "0.10"}))
+type X402 struct {
+	server *serverx402.Server
+}
+
+// New creates a middleware instance with its own configuration.
+func New(config *Config) *X402 {
+	return &X402{server: serverx402.New(config)}
+}
+
+// Config returns the instance configuration.
+func (x *X402) Config() *Config {
+	return x.server.Config()
+}
+
+// Server returns the shared server core backing the instance.
+func (x *X402) Server() *serverx402.Server {
+	return x.server
+}
+
+// Reload atomically replaces the payment address and token mint of the
+// instance at runtime (see serverx402.Server.Reload).
+func (x *X402) Reload(config *Config) error {
+	return x.server.Reload(config)
+}
+
+// Shutdown gracefully stops the instance (see serverx402.Server.Shutdown).
+func (x *X402) Shutdown(ctx context.Context) error {
+	return x.server.Shutdown(ctx)
 }
 
 // PaymentRequiredOptions configures payment requirements for a specific endpoint.
@@ -54,6 +127,95 @@ type PaymentRequiredOptions struct {
 	Description    string // Human-readable description
 	ExpiresIn      int    // Expiration time in seconds (default: 300)
 	AutoVerify     bool   // Auto-verify payment on-chain (default: true)
+
+	// PriceFunc optionally computes the amount and description per request,
+	// overriding Amount and Description. It may inspect path params, query, or body;
+	// if it reads the request body it must restore it for the wrapped handler.
+	PriceFunc func(c echo.Context) (amount string, description string, err error)
+
+	// Authorize optionally applies a per-payer policy. It is called with the payer's
+	// public key (from the authorization header, or the X-Payer-Public-Key header on
+	// the initial request) and may grant free access, apply a discount, or return an
+	// error to block the payer. Public keys are self-declared by the client, so free
+	// access should only be granted to payers authenticated by other means.
+	Authorize func(pubkey string) (PriceOverride, error)
+
+	// VolumePricing optionally prices by the payer's volume of verified
+	// payments, counted in Config.Store, e.g. cheaper calls after the first
+	// 100. The payer's tier is quoted if the request declares the payer in the
+	// X-Payer-Public-Key header.
+	VolumePricing *serverx402.VolumePricing
+
+	// RangePricing optionally prices a file by the bytes the request's Range
+	// header asks for, e.g. 0.01 per started 10 MiB, replacing Amount.
+	// Serve the file with c.File or http.ServeContent, which honor Range
+	// and If-Range as priced.
+	RangePricing *serverx402.RangePricing
+
+	// FiatAmount optionally sets the price in fiat, e.g. "0.10" USD, which is
+	// converted to a token amount with Config.PriceOracle when the payment
+	// request is issued. It replaces Amount. Currency overrides
+	// Config.Currency.
+	FiatAmount string
+	Currency   string
+
+	// AcceptedTokens optionally accepts other tokens besides TokenMint, each
+	// at its own price, e.g. USDT and BONK next to USDC. The 402 response
+	// lists them, and payments in any of them are accepted.
+	AcceptedTokens []core.TokenPrice
+
+	// Splits optionally pays percentages of the price to other recipients,
+	// e.g. 80% to a creator; PaymentAddress receives the rest.
+	Splits []core.PaymentSplit
+
+	// Escrow optionally asks payers to deposit the payment into an escrow
+	// program and release it once the response is delivered. Requires a
+	// Config.Processor implementing core.EscrowProcessor.
+	Escrow bool
+
+	// ChannelDeposit optionally offers a payment channel: a payment of this
+	// deposit opens a channel that pays later requests with signed vouchers
+	// instead of on-chain transactions. Requires Config.AutoVerify and
+	// Config.RefundProcessor.
+	ChannelDeposit string
+
+	// MaxOutstanding optionally lets payers charge requests to a tab with
+	// signed vouchers and settle it in one payment, capping the unsettled
+	// balance at this amount. Requires Config.AutoVerify.
+	MaxOutstanding string
+
+	// LightningSats optionally offers paying this many satoshis with a
+	// Lightning invoice instead. Requires Config.Lightning and
+	// Config.NonceStore.
+	LightningSats int64
+
+	// Plans optionally offers subscription plans in the 402 response, which
+	// grant access without paying per request until they expire. Requires a
+	// Config.Store implementing serverx402.SubscriptionStore.
+	Plans []core.SubscriptionPlan
+
+	// RequestsIncluded optionally lets a verified payment grant that many
+	// further requests to the endpoint. The paid response returns a quota
+	// token in the X-Payment-Quota header to send with them, and responses
+	// report the requests left in X-Payment-Quota-Remaining.
+	RequestsIncluded int
+
+	// RefundOnError refunds the payment in full when the wrapped handler responds
+	// with a 5xx status, reporting the refund transaction hash in the
+	// X-Payment-Refund header. Requires Config.RefundProcessor.
+	RefundOnError bool
+
+	// Capture makes Amount a hold for variable-cost endpoints: the handler
+	// calls Capture with the actual cost once it is known, and the rest is
+	// refunded. Requires Config.AutoVerify without AsyncSettlement, and
+	// Config.RefundProcessor.
+	Capture bool
+
+	// UnitPricing optionally prices the request by the units it consumes,
+	// such as output tokens: the payment holds MaxUnits, the handler reports
+	// the units it used with ReportUnits, and their price is captured once
+	// it returns. Requires the same configuration as Capture.
+	UnitPricing *serverx402.UnitPricing
 }
 
 // PaymentRequired returns Echo middleware that requires payment for the wrapped handler.
@@ -65,121 +227,145 @@ type PaymentRequiredOptions struct {
 //	    Description: "Premium market data",
 //	}))
 func PaymentRequired(opts PaymentRequiredOptions) echo.MiddlewareFunc {
+	return paymentRequired(func() *serverx402.Server { return globalServer }, opts)
+}
+
+// PaymentRequired returns middleware that requires payment using the instance configuration.
+func (x *X402) PaymentRequired(opts PaymentRequiredOptions) echo.MiddlewareFunc {
+	return paymentRequired(func() *serverx402.Server { return x.server }, opts)
+}
+
+// paymentRequired builds the payment middleware for the server returned by getServer.
+func paymentRequired(getServer func() *serverx402.Server, opts PaymentRequiredOptions) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
-			// Get configuration
-			config := globalConfig
-			if config == nil {
+			server := getServer()
+			if server == nil {
 				return echo.NewHTTPError(http.StatusInternalServerError, "X402 not initialized. Call InitX402() first.")
 			}
 
-			// Determine parameters (use provided values or config)
-			paymentAddress := opts.PaymentAddress
-			if paymentAddress == "" {
-				paymentAddress = config.PaymentAddress
+			// Determine price (dynamic pricing takes precedence)
+			amount := opts.Amount
+			description := opts.Description
+			if opts.PriceFunc != nil {
+				var err error
+				amount, description, err = opts.PriceFunc(c)
+				if err != nil {
+					return respond(c, server, server.PriceError(c.Request().URL.Path, err))
+				}
 			}
 
-			tokenMint := opts.TokenMint
-			if tokenMint == "" {
-				tokenMint = config.TokenMint
-			}
+			req := c.Request()
+			result := server.Process(serverx402.Request{
+				Context:  req.Context(),
+				Resource: req.URL.Path,
+				Header:   req.Header.Get,
+				ClientIP: c.RealIP(),
 
-			network := opts.Network
-			if network == "" {
-				network = config.Network
-			}
+				Deferrable: true,
+			}, serverx402.Options{
+				Amount:         amount,
+				PaymentAddress: opts.PaymentAddress,
+				TokenMint:      opts.TokenMint,
+				Network:        opts.Network,
+				Description:    description,
+				ExpiresIn:      opts.ExpiresIn,
+				Authorize:      opts.Authorize,
+				VolumePricing:  opts.VolumePricing,
+				RangePricing:   opts.RangePricing,
+				Capture:        opts.Capture,
+				UnitPricing:    opts.UnitPricing,
+				FiatAmount:     opts.FiatAmount,
+				Currency:       opts.Currency,
+				AcceptedTokens: opts.AcceptedTokens,
+				Splits:         opts.Splits,
+				Escrow:         opts.Escrow,
+				ChannelDeposit: opts.ChannelDeposit,
+				MaxOutstanding: opts.MaxOutstanding,
+				LightningSats:  opts.LightningSats,
+				Plans:          opts.Plans,
 
-			autoVerify := config.AutoVerify
-			if opts.ExpiresIn == 0 {
-				opts.ExpiresIn = 300
+				RequestsIncluded: opts.RequestsIncluded,
+			})
+			if result.Status == http.StatusNoContent {
+				// A deferred payment was settled
+				return c.NoContent(result.Status)
 			}
-
-			if paymentAddress == "" || tokenMint == "" {
-				return echo.NewHTTPError(http.StatusInternalServerError, "paymentAddress and tokenMint must be configured")
+			if !result.Allowed() {
+				return respond(c, server, result)
 			}
 
-			// Check for payment authorization header
-			authHeader := c.Request().Header.Get("X-Payment-Authorization")
-
-			if authHeader == "" {
-				// No payment provided, return 402
-				return build402Response(c, payment402Options{
-					Amount:         opts.Amount,
-					PaymentAddress: paymentAddress,
-					TokenMint:      tokenMint,
-					Network:        network,
-					Resource:       c.Request().URL.Path,
-					Description:    opts.Description,
-					ExpiresIn:      opts.ExpiresIn,
-				})
+			if result.SessionToken != "" {
+				c.Response().Header().Set(server.Config().SessionHeader, result.SessionToken)
 			}
-
-			// Payment authorization provided, verify it
-			authorization, err := core.PaymentAuthorizationFromHeader(authHeader)
-			if err != nil {
-				return c.JSON(http.StatusBadRequest, map[string]interface{}{
-					"error":   "Invalid payment authorization",
-					"message": err.Error(),
-				})
+			if result.SubscriptionToken != "" {
+				c.Response().Header().Set(server.Config().SubscriptionHeader, result.SubscriptionToken)
 			}
-
-			// Verify payment amount is sufficient
-			requiredAmount, _ := strconv.ParseFloat(opts.Amount, 64)
-			actualAmount, _ := strconv.ParseFloat(authorization.ActualAmount, 64)
-			if actualAmount < requiredAmount {
-				return c.JSON(http.StatusForbidden, map[string]interface{}{
-					"error":    "Insufficient payment",
-					"required": opts.Amount,
-					"provided": authorization.ActualAmount,
-				})
+			if result.QuotaToken != "" {
+				c.Response().Header().Set(server.Config().QuotaHeader, result.QuotaToken)
+				c.Response().Header().Set(server.Config().QuotaRemainingHeader, strconv.Itoa(result.QuotaRemaining))
 			}
-
-			// Verify payment addresses match
-			if authorization.PaymentAddress != paymentAddress {
-				return c.JSON(http.StatusForbidden, map[string]interface{}{
-					"error":    "Payment address mismatch",
-					"expected": paymentAddress,
-					"provided": authorization.PaymentAddress,
-				})
+			if result.ChannelID != "" {
+				c.Response().Header().Set(server.Config().ChannelHeader, result.ChannelID)
+				c.Response().Header().Set(server.Config().ChannelBalanceHeader, result.ChannelBalance)
 			}
-
-			// Verify token mint matches
-			if authorization.AssetAddress != tokenMint {
-				return c.JSON(http.StatusForbidden, map[string]interface{}{
-					"error":    "Token mint mismatch",
-					"expected": tokenMint,
-					"provided": authorization.AssetAddress,
-				})
+			if result.TabOutstanding != "" {
+				c.Response().Header().Set(server.Config().TabHeader, result.TabOutstanding)
+			}
+			if result.Deferred != nil {
+				deferred, _ := result.Deferred.ToHeaderValue()
+				c.Response().Header().Set(server.Config().DeferredHeader, deferred)
 			}
 
-			// Verify on-chain if auto_verify is enabled
-			if autoVerify && authorization.TransactionHash != "" {
-				processor := core.NewSolanaPaymentProcessor(config.RPCURL, nil)
-				defer processor.Close()
-
-				verified, err := processor.VerifyTransaction(
-					c.Request().Context(),
-					authorization.TransactionHash,
-					paymentAddress,
-					authorization.ActualAmount,
-					tokenMint,
-				)
-
-				if err != nil || !verified {
-					return c.JSON(http.StatusForbidden, map[string]interface{}{
-						"error":   "Payment verification failed",
-						"message": err.Error(),
+			// Payment verified, attach to context and continue
+			if result.Payer != "" {
+				c.Set(payerKey, result.Payer)
+			}
+			if result.Authorization != nil {
+				c.Set("payment_authorization", result.Authorization)
+				if opts.Capture || opts.UnitPricing != nil {
+					c.Set(holdKey, hold{server, result})
+				}
+				if opts.RefundOnError {
+					res := c.Response()
+					res.Before(func() {
+						if refund := server.RefundOnError(req.Context(), result, res.Status); refund != nil {
+							res.Header().Set(serverx402.RefundHeader, refund.TransactionHash)
+						}
 					})
 				}
+				if opts.UnitPricing != nil && result.Requirement.Units != nil {
+					// The units are only known once the response was written
+					c.Response().Header().Add("Trailer", serverx402.CapturedHeader)
+					c.Response().Header().Add("Trailer", serverx402.RefundHeader)
+					err := next(c)
+					if result.Captured == "" {
+						// Refund failures are logged by the server
+						if refund, captureErr := server.CaptureUnits(req.Context(), result); captureErr == nil {
+							reportCapture(c, result, refund)
+						}
+					}
+					return err
+				}
 			}
-
-			// Payment verified, attach to context and continue
-			c.Set("payment_authorization", authorization)
 			return next(c)
 		}
 	}
 }
 
+// respond writes the response of a rejected request.
+func respond(c echo.Context, server *serverx402.Server, result *serverx402.Result) error {
+	status, contentType, body, err := server.HTTPResponse(c.Request(), result)
+	if err != nil {
+		return err
+	}
+	c.Response().Header().Add(echo.HeaderVary, echo.HeaderAccept)
+	if retryAfter := result.RetryAfterHeader(); retryAfter != "" {
+		c.Response().Header().Set(echo.HeaderRetryAfter, retryAfter)
+	}
+	return c.Blob(status, contentType, body)
+}
+
 // GetPaymentAuthorization retrieves the PaymentAuthorization from the Echo context.
 //
 // This is useful if you want to access payment details in your handler.
@@ -200,46 +386,104 @@ func GetPaymentAuthorization(c echo.Context) *core.PaymentAuthorization {
 	return nil
 }
 
-// payment402Options contains options for building a 402 response.
-type payment402Options struct {
-	Amount         string
-	PaymentAddress string
-	TokenMint      string
-	Network        string
-	Resource       string
-	Description    string
-	ExpiresIn      int
-}
-
-// build402Response builds and sends a 402 Payment Required response.
-func build402Response(c echo.Context, opts payment402Options) error {
-	// Generate unique payment ID and nonce
-	paymentID := generateID()
-	nonce := generateID()
-
-	// Calculate expiration
-	expiresAt := time.Now().UTC().Add(time.Duration(opts.ExpiresIn) * time.Second)
-
-	// Create payment request
-	paymentReq := &core.PaymentRequest{
-		MaxAmountRequired: opts.Amount,
-		AssetType:         "SPL",
-		AssetAddress:      opts.TokenMint,
-		PaymentAddress:    opts.PaymentAddress,
-		Network:           opts.Network,
-		ExpiresAt:         expiresAt,
-		Nonce:             nonce,
-		PaymentID:         paymentID,
-		Resource:          opts.Resource,
-		Description:       opts.Description,
+// payerKey is the context key of the verified payer.
+const payerKey = "x402_payer"
+
+// holdKey is the context key of a held payment, for Capture.
+const holdKey = "x402_hold"
+
+// hold is a held payment to capture.
+type hold struct {
+	server *serverx402.Server
+	result *serverx402.Result
+}
+
+// Capture charges amount of the held payment of a request to an endpoint
+// with Capture set, refunding the rest of the hold to the payer (see
+// serverx402.Server.Capture). Handlers call it once the cost is known:
+// before writing the response, the amount captured and the refund
+// transaction hash are sent in the X-Payment-Captured and X-Payment-Refund
+// headers; after, as trailers.
+//
+// Example:
+//
+//	func completeHandler(c echo.Context) error {
+//	    completion, tokens := complete(c)
+//	    if err := echox402.Capture(c, fmt.Sprintf("%.6f", float64(tokens)*0.00002)); err != nil {
+//	        c.Logger().Errorf("capture failed: %v", err)
+//	    }
+//	    return c.JSON(http.StatusOK, completion)
+//	}
+func Capture(c echo.Context, amount string) error {
+	held, ok := c.Get(holdKey).(hold)
+	if !ok {
+		return serverx402.ErrNotHeld
 	}
+	refund, err := held.server.Capture(c.Request().Context(), held.result, amount)
+	if err != nil {
+		return err
+	}
+	reportCapture(c, held.result, refund)
+	return nil
+}
 
-	return c.JSON(http.StatusPaymentRequired, paymentReq)
+// ReportUnits records n units consumed by a request to an endpoint with
+// UnitPricing, such as output tokens; it may be called repeatedly, e.g.
+// while streaming. PaymentRequired captures the price of the units once
+// the handler returns, reporting it in the X-Payment-Captured trailer.
+//
+// Example:
+//
+//	func completeHandler(c echo.Context) error {
+//	    completion := complete(c)
+//	    echox402.ReportUnits(c, int64(completion.OutputTokens))
+//	    return c.JSON(http.StatusOK, completion)
+//	}
+func ReportUnits(c echo.Context, n int64) {
+	if held, ok := c.Get(holdKey).(hold); ok {
+		held.result.AddUnits(n)
+	}
+}
+
+// reportCapture sets the amount captured of a held payment and the
+// transaction hash of the refund, if any, as headers, or as trailers if the
+// response was committed.
+func reportCapture(c echo.Context, result *serverx402.Result, refund *core.Refund) {
+	header, prefix := c.Response().Header(), ""
+	if c.Response().Committed {
+		prefix = http.TrailerPrefix
+	}
+	header.Set(prefix+serverx402.CapturedHeader, result.Captured)
+	if refund != nil {
+		header.Set(prefix+serverx402.RefundHeader, refund.TransactionHash)
+	}
 }
 
-// generateID generates a random hexadecimal ID.
-func generateID() string {
-	bytes := make([]byte, 16)
-	rand.Read(bytes)
-	return hex.EncodeToString(bytes)
+// PayerID returns the public key of the verified payer of the request, set
+// by PaymentRequired when the request proceeds on a payment, or a session,
+// subscription, quota token, or voucher of one (see
+// serverx402.Result.Payer). It returns "" for free access.
+//
+// Middlewares after PaymentRequired can key on it, e.g. to rate limit or
+// log per paying wallet.
+func PayerID(c echo.Context) string {
+	payer, _ := c.Get(payerKey).(string)
+	return payer
+}
+
+// PayerIdentifier identifies requests by their verified payer, and by the
+// client IP otherwise, for Echo's rate limiter:
+//
+//	e.GET("/api/data", handler,
+//	    echox402.PaymentRequired(echox402.PaymentRequiredOptions{Amount: "0.01"}),
+//	    middleware.RateLimiterWithConfig(middleware.RateLimiterConfig{
+//	        Store:              middleware.NewRateLimiterMemoryStore(10),
+//	        IdentifierExtractor: echox402.PayerIdentifier,
+//	    }),
+//	)
+func PayerIdentifier(c echo.Context) (string, error) {
+	if payer := PayerID(c); payer != "" {
+		return "payer:" + payer, nil
+	}
+	return c.RealIP(), nil
 }
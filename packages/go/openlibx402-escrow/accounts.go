@@ -0,0 +1,46 @@
+package escrow
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// escrowAccountSize is the size of an Escrow account: the discriminator,
+// three public keys, the payment ID seed, amount, deadline, and bump.
+const escrowAccountSize = 8 + 32 + 32 + 32 + 32 + 8 + 8 + 1
+
+// Account is the state of an escrow account, which holds a deposit until it
+// is released or reclaimed. Both close the account.
+type Account struct {
+	Payer           solana.PublicKey
+	Recipient       solana.PublicKey
+	Mint            solana.PublicKey
+	PaymentIDSeed   [32]byte // See PaymentIDSeed
+	Amount          uint64   // Deposit in the smallest unit of the mint
+	ReleaseDeadline time.Time
+	Bump            uint8
+}
+
+// DecodeAccount decodes the data of an escrow account.
+func DecodeAccount(data []byte) (*Account, error) {
+	if len(data) < escrowAccountSize {
+		return nil, errors.New("escrow account data too short")
+	}
+	if !bytes.Equal(data[:8], escrowDiscriminator[:]) {
+		return nil, errors.New("not an escrow account")
+	}
+	data = data[8:]
+	account := &Account{}
+	copy(account.Payer[:], data[0:32])
+	copy(account.Recipient[:], data[32:64])
+	copy(account.Mint[:], data[64:96])
+	copy(account.PaymentIDSeed[:], data[96:128])
+	account.Amount = binary.LittleEndian.Uint64(data[128:136])
+	account.ReleaseDeadline = time.Unix(int64(binary.LittleEndian.Uint64(data[136:144])), 0).UTC()
+	account.Bump = data[144]
+	return account, nil
+}
@@ -0,0 +1,64 @@
+// Package escrow pays X402 payment requests through an escrow program: the
+// payer deposits the payment into an escrow account derived from the payment
+// ID, and releases it to the payment address once the response is delivered.
+// A deposit that is not released by its deadline can be reclaimed by the
+// payer.
+//
+// The package contains Go bindings for the x402_escrow Anchor program, whose
+// interface is described by idl/x402_escrow.json, and a Processor that makes
+// and verifies escrow payments for clients and servers.
+package escrow
+
+import (
+	"crypto/sha256"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// escrowSeed is the constant seed of escrow accounts.
+const escrowSeed = "escrow"
+
+// Anchor discriminators: the first 8 bytes of the SHA-256 of
+// "global:<instruction>" and "account:<Account>".
+var (
+	depositDiscriminator = discriminator("global:deposit")
+	releaseDiscriminator = discriminator("global:release")
+	reclaimDiscriminator = discriminator("global:reclaim")
+	escrowDiscriminator  = discriminator("account:Escrow")
+)
+
+func discriminator(name string) [8]byte {
+	var d [8]byte
+	sum := sha256.Sum256([]byte(name))
+	copy(d[:], sum[:8])
+	return d
+}
+
+// PaymentIDSeed returns the 32-byte seed of an escrow for a payment ID: its
+// SHA-256, so that payment IDs of any length fit.
+func PaymentIDSeed(paymentID string) [32]byte {
+	return sha256.Sum256([]byte(paymentID))
+}
+
+// FindEscrowAddress returns the escrow account of a payer's deposit for a
+// payment ID, and its bump seed.
+func FindEscrowAddress(program, payer solana.PublicKey, paymentID string) (solana.PublicKey, uint8, error) {
+	seed := PaymentIDSeed(paymentID)
+	return solana.FindProgramAddress([][]byte{[]byte(escrowSeed), payer[:], seed[:]}, program)
+}
+
+// FindVaultAddress returns the token account holding the deposit of an
+// escrow: the escrow's associated token account for the mint.
+func FindVaultAddress(escrow, mint, tokenProgram solana.PublicKey) (solana.PublicKey, error) {
+	return associatedTokenAddress(escrow, mint, tokenProgram)
+}
+
+// associatedTokenAddress derives the associated token account of an owner for
+// a mint of the SPL Token or Token-2022 program.
+func associatedTokenAddress(owner, mint, tokenProgram solana.PublicKey) (solana.PublicKey, error) {
+	address, _, err := solana.FindProgramAddress(
+		[][]byte{owner[:], tokenProgram[:], mint[:]},
+		solana.SPLAssociatedTokenAccountProgramID,
+	)
+	return address, err
+}
@@ -0,0 +1,112 @@
+package escrow
+
+import (
+	"encoding/binary"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// DepositAccounts are the accounts of a deposit instruction. The escrow,
+// vault, and token accounts are derived from them.
+type DepositAccounts struct {
+	Payer        solana.PublicKey
+	Recipient    solana.PublicKey
+	Mint         solana.PublicKey
+	TokenProgram solana.PublicKey // SPL Token or Token-2022 program of the mint
+}
+
+// NewDepositInstruction builds a deposit instruction, moving amount (in the
+// smallest unit of the mint) from the payer into a new escrow for the payment
+// ID, releasable to the recipient until releaseDeadline.
+func NewDepositInstruction(program solana.PublicKey, accounts DepositAccounts, paymentID string, amount uint64, releaseDeadline time.Time) (solana.Instruction, error) {
+	escrow, _, err := FindEscrowAddress(program, accounts.Payer, paymentID)
+	if err != nil {
+		return nil, err
+	}
+	vault, err := FindVaultAddress(escrow, accounts.Mint, accounts.TokenProgram)
+	if err != nil {
+		return nil, err
+	}
+	payerTokenAccount, err := associatedTokenAddress(accounts.Payer, accounts.Mint, accounts.TokenProgram)
+	if err != nil {
+		return nil, err
+	}
+
+	// Borsh: discriminator, payment_id [u8; 32], amount u64, release_deadline i64
+	seed := PaymentIDSeed(paymentID)
+	data := make([]byte, 0, 8+32+8+8)
+	data = append(data, depositDiscriminator[:]...)
+	data = append(data, seed[:]...)
+	data = binary.LittleEndian.AppendUint64(data, amount)
+	data = binary.LittleEndian.AppendUint64(data, uint64(releaseDeadline.Unix()))
+
+	return solana.NewInstruction(program, solana.AccountMetaSlice{
+		solana.Meta(accounts.Payer).WRITE().SIGNER(),
+		solana.Meta(accounts.Recipient),
+		solana.Meta(accounts.Mint),
+		solana.Meta(escrow).WRITE(),
+		solana.Meta(vault).WRITE(),
+		solana.Meta(payerTokenAccount).WRITE(),
+		solana.Meta(accounts.TokenProgram),
+		solana.Meta(solana.SPLAssociatedTokenAccountProgramID),
+		solana.Meta(solana.SystemProgramID),
+	}, data), nil
+}
+
+// NewReleaseInstruction builds a release instruction, paying the deposit of
+// the payer for the payment ID to the recipient. The recipient's token
+// account is created if needed, at the payer's expense.
+func NewReleaseInstruction(program solana.PublicKey, accounts DepositAccounts, paymentID string) (solana.Instruction, error) {
+	escrow, _, err := FindEscrowAddress(program, accounts.Payer, paymentID)
+	if err != nil {
+		return nil, err
+	}
+	vault, err := FindVaultAddress(escrow, accounts.Mint, accounts.TokenProgram)
+	if err != nil {
+		return nil, err
+	}
+	recipientTokenAccount, err := associatedTokenAddress(accounts.Recipient, accounts.Mint, accounts.TokenProgram)
+	if err != nil {
+		return nil, err
+	}
+
+	return solana.NewInstruction(program, solana.AccountMetaSlice{
+		solana.Meta(accounts.Payer).WRITE().SIGNER(),
+		solana.Meta(accounts.Recipient),
+		solana.Meta(accounts.Mint),
+		solana.Meta(escrow).WRITE(),
+		solana.Meta(vault).WRITE(),
+		solana.Meta(recipientTokenAccount).WRITE(),
+		solana.Meta(accounts.TokenProgram),
+		solana.Meta(solana.SPLAssociatedTokenAccountProgramID),
+		solana.Meta(solana.SystemProgramID),
+	}, releaseDiscriminator[:]), nil
+}
+
+// NewReclaimInstruction builds a reclaim instruction, returning the deposit
+// of the payer for the payment ID once its release deadline passed. The
+// recipient is not needed.
+func NewReclaimInstruction(program solana.PublicKey, accounts DepositAccounts, paymentID string) (solana.Instruction, error) {
+	escrow, _, err := FindEscrowAddress(program, accounts.Payer, paymentID)
+	if err != nil {
+		return nil, err
+	}
+	vault, err := FindVaultAddress(escrow, accounts.Mint, accounts.TokenProgram)
+	if err != nil {
+		return nil, err
+	}
+	payerTokenAccount, err := associatedTokenAddress(accounts.Payer, accounts.Mint, accounts.TokenProgram)
+	if err != nil {
+		return nil, err
+	}
+
+	return solana.NewInstruction(program, solana.AccountMetaSlice{
+		solana.Meta(accounts.Payer).WRITE().SIGNER(),
+		solana.Meta(accounts.Mint),
+		solana.Meta(escrow).WRITE(),
+		solana.Meta(vault).WRITE(),
+		solana.Meta(payerTokenAccount).WRITE(),
+		solana.Meta(accounts.TokenProgram),
+	}, reclaimDiscriminator[:]), nil
+}
@@ -0,0 +1,306 @@
+package escrow
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/openlibx402/go/openlibx402-core"
+)
+
+// mintAccountSize is the size of an SPL Token mint; decimals are at offset 44.
+const mintAccountSize = 82
+
+// maxTransactionVersion lets transaction lookups return versioned transactions.
+var maxTransactionVersion uint64 = 0
+
+// Processor is a core.EscrowProcessor for an escrow program. It pays payment
+// requests whose escrow terms name the program by depositing into an escrow
+// account, verifies such deposits, and delegates everything else to the
+// processor it wraps.
+//
+// Servers set it as their Config.Processor to accept escrow payments, and
+// clients as their processor to make them; auto clients release the deposit
+// once the response is delivered.
+type Processor struct {
+	core.PaymentProcessor
+	program solana.PublicKey
+	client  *rpc.Client
+
+	// MinReleaseWindow rejects deposits whose release deadline is sooner,
+	// leaving the payer time to release them after the response (default:
+	// 1 minute).
+	MinReleaseWindow time.Duration
+}
+
+var _ core.EscrowProcessor = (*Processor)(nil)
+
+// NewProcessor creates a Processor for the escrow program with the given ID,
+// reading accounts from rpcURL. processor makes other payments and sends
+// transactions (default: a core.SolanaPaymentProcessor for rpcURL).
+func NewProcessor(rpcURL, program string, processor core.PaymentProcessor) (*Processor, error) {
+	programID, err := solana.PublicKeyFromBase58(program)
+	if err != nil {
+		return nil, fmt.Errorf("invalid escrow program ID: %w", err)
+	}
+	if processor == nil {
+		processor = core.NewSolanaPaymentProcessor(rpcURL, nil)
+	}
+	return &Processor{
+		PaymentProcessor: processor,
+		program:          programID,
+		client:           rpc.New(rpcURL),
+		MinReleaseWindow: time.Minute,
+	}, nil
+}
+
+// EscrowProgram implements core.EscrowProcessor.
+func (p *Processor) EscrowProgram() string {
+	return p.program.String()
+}
+
+// escrowed reports whether a payment request asks for a deposit into the
+// processor's program.
+func (p *Processor) escrowed(request *core.PaymentRequest) bool {
+	return request.Escrow != nil && request.Escrow.Program == p.program.String()
+}
+
+// CreatePaymentTransactionFor implements core.PaymentProcessor. Requests
+// with escrow terms for the program are paid with a deposit carrying the
+// payment memo.
+func (p *Processor) CreatePaymentTransactionFor(ctx context.Context, request *core.PaymentRequest, amount string, payer solana.PublicKey) (*solana.Transaction, error) {
+	if !p.escrowed(request) {
+		return p.PaymentProcessor.CreatePaymentTransactionFor(ctx, request, amount, payer)
+	}
+	if len(request.Splits) > 0 {
+		return nil, core.NewTransactionBroadcastError("escrow payments cannot be split")
+	}
+	accounts, decimals, err := p.depositAccounts(ctx, request, payer)
+	if err != nil {
+		return nil, err
+	}
+	units, err := tokenUnits(amount, decimals)
+	if err != nil {
+		return nil, core.NewTransactionBroadcastError("invalid amount format: " + err.Error())
+	}
+
+	deposit, err := NewDepositInstruction(p.program, accounts, request.PaymentID, units, request.Escrow.ReleaseDeadline)
+	if err != nil {
+		return nil, core.NewTransactionBroadcastError("failed to derive escrow accounts: " + err.Error())
+	}
+	instructions := []solana.Instruction{deposit}
+	if request.PaymentID != "" {
+		instructions = append(instructions, solana.NewInstruction(solana.MemoProgramID, solana.AccountMetaSlice{}, []byte(core.PaymentMemo(request.PaymentID))))
+	}
+	return p.newTransaction(ctx, instructions, payer)
+}
+
+// ReleaseEscrow implements core.EscrowProcessor.
+func (p *Processor) ReleaseEscrow(ctx context.Context, request *core.PaymentRequest, signer core.Signer) (string, error) {
+	return p.settle(ctx, request, signer, NewReleaseInstruction)
+}
+
+// ReclaimEscrow returns the deposit paying request to the payer once its
+// release deadline passed. signer must be the payer.
+func (p *Processor) ReclaimEscrow(ctx context.Context, request *core.PaymentRequest, signer core.Signer) (string, error) {
+	return p.settle(ctx, request, signer, NewReclaimInstruction)
+}
+
+// settle sends a release or reclaim instruction for the payer's deposit.
+func (p *Processor) settle(
+	ctx context.Context,
+	request *core.PaymentRequest,
+	signer core.Signer,
+	build func(program solana.PublicKey, accounts DepositAccounts, paymentID string) (solana.Instruction, error),
+) (string, error) {
+	if !p.escrowed(request) {
+		return "", core.NewTransactionBroadcastError("payment request has no escrow terms for program " + p.program.String())
+	}
+	accounts, _, err := p.depositAccounts(ctx, request, signer.PublicKey())
+	if err != nil {
+		return "", err
+	}
+	ix, err := build(p.program, accounts, request.PaymentID)
+	if err != nil {
+		return "", core.NewTransactionBroadcastError("failed to derive escrow accounts: " + err.Error())
+	}
+	tx, err := p.newTransaction(ctx, []solana.Instruction{ix}, signer.PublicKey())
+	if err != nil {
+		return "", err
+	}
+	return p.PaymentProcessor.SignAndSendTransactionWithSigner(ctx, tx, signer)
+}
+
+// VerifyTransfer implements core.PaymentProcessor. Deposits into the program
+// are verified by the escrow account they created: it must hold the deposit
+// for expectedRecipient in expectedTokenMint, and be releasable for at least
+// MinReleaseWindow. The amount is the vault's balance. Other transactions are
+// verified by the wrapped processor.
+func (p *Processor) VerifyTransfer(ctx context.Context, transactionHash, expectedRecipient, expectedTokenMint, expectedMemo string) (*core.VerifiedTransfer, error) {
+	sig, err := solana.SignatureFromBase58(transactionHash)
+	if err != nil {
+		return nil, core.NewPaymentVerificationError("invalid transaction signature: " + err.Error())
+	}
+	result, err := p.client.GetTransaction(ctx, sig, &rpc.GetTransactionOpts{
+		Commitment:                     rpc.CommitmentConfirmed,
+		MaxSupportedTransactionVersion: &maxTransactionVersion,
+	})
+	if err != nil || result == nil || result.Meta == nil {
+		// Let the wrapped processor report it, e.g. after waiting for it to land
+		return p.PaymentProcessor.VerifyTransfer(ctx, transactionHash, expectedRecipient, expectedTokenMint, expectedMemo)
+	}
+	tx, err := result.Transaction.GetTransaction()
+	if err != nil {
+		return nil, core.NewPaymentVerificationError("failed to decode transaction: " + err.Error())
+	}
+	escrowAddress, ok := p.depositEscrow(tx)
+	if !ok {
+		return p.PaymentProcessor.VerifyTransfer(ctx, transactionHash, expectedRecipient, expectedTokenMint, expectedMemo)
+	}
+
+	if result.Meta.Err != nil {
+		return nil, core.NewPaymentVerificationError("transaction failed on-chain")
+	}
+	if expectedMemo != "" && !hasMemo(tx, expectedMemo) {
+		return nil, core.NewPaymentVerificationError("transaction memo does not match the payment request")
+	}
+
+	info, err := p.client.GetAccountInfo(ctx, escrowAddress)
+	if err != nil || info == nil || info.Value == nil {
+		return nil, core.NewPaymentVerificationError("escrow not found; it may have been released or reclaimed")
+	}
+	if !info.Value.Owner.Equals(p.program) {
+		return nil, core.NewPaymentVerificationError("escrow account is not owned by the escrow program")
+	}
+	account, err := DecodeAccount(info.Value.Data.GetBinary())
+	if err != nil {
+		return nil, core.NewPaymentVerificationError("invalid escrow account: " + err.Error())
+	}
+	switch {
+	case account.Recipient.String() != expectedRecipient || account.Mint.String() != expectedTokenMint:
+		return nil, core.NewPaymentVerificationError("escrow does not hold the token for the payment address")
+	case expectedMemo != "" && account.PaymentIDSeed != PaymentIDSeed(strings.TrimPrefix(expectedMemo, core.PaymentMemo(""))):
+		return nil, core.NewPaymentVerificationError("escrow was created for a different payment")
+	case time.Until(account.ReleaseDeadline) < p.MinReleaseWindow:
+		return nil, core.NewPaymentVerificationError(fmt.Sprintf("escrow release deadline %s is too soon", account.ReleaseDeadline.Format(time.RFC3339)))
+	}
+
+	tokenProgram, _, err := p.mintInfo(ctx, account.Mint)
+	if err != nil {
+		return nil, core.NewPaymentVerificationError("failed to read token mint: " + err.Error())
+	}
+	vault, err := FindVaultAddress(escrowAddress, account.Mint, tokenProgram)
+	if err != nil {
+		return nil, core.NewPaymentVerificationError("failed to derive escrow vault: " + err.Error())
+	}
+	balance, err := p.client.GetTokenAccountBalance(ctx, vault, rpc.CommitmentConfirmed)
+	if err != nil || balance == nil || balance.Value == nil {
+		return nil, core.NewPaymentVerificationError("escrow vault not found")
+	}
+	units, ok := new(big.Int).SetString(balance.Value.Amount, 10)
+	if !ok || units.Sign() <= 0 {
+		return nil, core.NewPaymentVerificationError("escrow vault is empty")
+	}
+	decimals := balance.Value.Decimals
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil)
+	return &core.VerifiedTransfer{
+		Amount:   new(big.Rat).SetFrac(units, scale).FloatString(int(decimals)),
+		Decimals: decimals,
+		Payer:    account.Payer.String(),
+	}, nil
+}
+
+// Close implements core.PaymentProcessor.
+func (p *Processor) Close() error {
+	p.client.Close()
+	return p.PaymentProcessor.Close()
+}
+
+// depositEscrow returns the escrow account created by a deposit instruction
+// of the program in tx, if any.
+func (p *Processor) depositEscrow(tx *solana.Transaction) (solana.PublicKey, bool) {
+	for _, ix := range tx.Message.Instructions {
+		programID, err := tx.Message.Program(ix.ProgramIDIndex)
+		if err != nil || !programID.Equals(p.program) || !bytes.HasPrefix(ix.Data, depositDiscriminator[:]) || len(ix.Accounts) < 4 {
+			continue
+		}
+		if index := int(ix.Accounts[3]); index < len(tx.Message.AccountKeys) {
+			return tx.Message.AccountKeys[index], true
+		}
+	}
+	return solana.PublicKey{}, false
+}
+
+// depositAccounts returns the accounts of the payer's deposit for a request,
+// and the decimals of its mint.
+func (p *Processor) depositAccounts(ctx context.Context, request *core.PaymentRequest, payer solana.PublicKey) (DepositAccounts, uint8, error) {
+	recipient, err := solana.PublicKeyFromBase58(request.PaymentAddress)
+	if err != nil {
+		return DepositAccounts{}, 0, core.NewTransactionBroadcastError("invalid payment address: " + err.Error())
+	}
+	mint, err := solana.PublicKeyFromBase58(request.AssetAddress)
+	if err != nil {
+		return DepositAccounts{}, 0, core.NewTransactionBroadcastError("invalid token mint address: " + err.Error())
+	}
+	tokenProgram, decimals, err := p.mintInfo(ctx, mint)
+	if err != nil {
+		return DepositAccounts{}, 0, core.NewTransactionBroadcastError("failed to read token mint: " + err.Error())
+	}
+	return DepositAccounts{Payer: payer, Recipient: recipient, Mint: mint, TokenProgram: tokenProgram}, decimals, nil
+}
+
+// mintInfo returns the token program and decimals of a mint.
+func (p *Processor) mintInfo(ctx context.Context, mint solana.PublicKey) (solana.PublicKey, uint8, error) {
+	info, err := p.client.GetAccountInfo(ctx, mint)
+	if err != nil {
+		return solana.PublicKey{}, 0, err
+	}
+	if info == nil || info.Value == nil {
+		return solana.PublicKey{}, 0, fmt.Errorf("mint %s not found", mint)
+	}
+	data := info.Value.Data.GetBinary()
+	if len(data) < mintAccountSize {
+		return solana.PublicKey{}, 0, fmt.Errorf("%s is not a token mint", mint)
+	}
+	return info.Value.Owner, data[44], nil
+}
+
+// newTransaction builds a transaction paid by payer with a recent blockhash.
+func (p *Processor) newTransaction(ctx context.Context, instructions []solana.Instruction, payer solana.PublicKey) (*solana.Transaction, error) {
+	blockhash, err := p.client.GetLatestBlockhash(ctx, rpc.CommitmentFinalized)
+	if err != nil {
+		return nil, core.NewTransactionBroadcastError("failed to get recent blockhash: " + err.Error())
+	}
+	tx, err := solana.NewTransaction(instructions, blockhash.Value.Blockhash, solana.TransactionPayer(payer))
+	if err != nil {
+		return nil, core.NewTransactionBroadcastError("failed to create transaction: " + err.Error())
+	}
+	return tx, nil
+}
+
+// hasMemo reports whether a transaction carries the memo.
+func hasMemo(tx *solana.Transaction, memo string) bool {
+	for _, ix := range tx.Message.Instructions {
+		programID, err := tx.Message.Program(ix.ProgramIDIndex)
+		if err == nil && programID.Equals(solana.MemoProgramID) && string(ix.Data) == memo {
+			return true
+		}
+	}
+	return false
+}
+
+// tokenUnits converts a token amount to the smallest unit of a mint,
+// rounding down.
+func tokenUnits(amount string, decimals uint8) (uint64, error) {
+	r, ok := new(big.Rat).SetString(amount)
+	if !ok || r.Sign() <= 0 {
+		return 0, fmt.Errorf("invalid amount %q", amount)
+	}
+	r.Mul(r, new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil)))
+	return new(big.Int).Quo(r.Num(), r.Denom()).Uint64(), nil
+}
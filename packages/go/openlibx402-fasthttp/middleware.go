@@ -0,0 +1,467 @@
+// Package fasthttp provides middleware for the fasthttp web server to handle X402 payments.
+package fasthttp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/openlibx402/go/openlibx402-core"
+	"github.com/openlibx402/go/openlibx402-server"
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttpadaptor"
+)
+
+// Config holds global configuration for X402 middleware.
+type Config = serverx402.Config
+
+// ConfigFromEnv reads a Config from X402_* environment variables (see
+// serverx402.ConfigFromEnv).
+func ConfigFromEnv() (*Config, error) {
+	return serverx402.ConfigFromEnv()
+}
+
+// ConfigFromFile reads a Config from a JSON, YAML, or TOML file (see
+// serverx402.ConfigFromFile).
+func ConfigFromFile(path string) (*Config, error) {
+	return serverx402.ConfigFromFile(path)
+}
+
+// PriceOverride adjusts the price of an endpoint for a specific payer.
+type PriceOverride = serverx402.PriceOverride
+
+var globalServer *serverx402.Server
+
+// InitX402 initializes the global X402 configuration. It fails, leaving the
+// middleware uninitialized, if the configuration is invalid (see
+// Config.Validate).
+//
+// This should be called once at application startup before using the PaymentRequired middleware.
+//
+// Example:
+//
+//	if err := fasthttpx402.InitX402(&fasthttpx402.Config{
+//	    PaymentAddress: "YOUR_WALLET_ADDRESS",
+//	    TokenMint:      "USDC_MINT_ADDRESS",
+//	    Network:        "solana-devnet",
+//	    AutoVerify:     true,
+//	}); err != nil {
+//	    log.Fatal(err)
+//	}
+func InitX402(config *Config) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	globalServer = serverx402.New(config)
+	return nil
+}
+
+// Reload atomically replaces the payment address and token mint configured
+// with InitX402 at runtime (see serverx402.Server.Reload).
+func Reload(config *Config) error {
+	if globalServer == nil {
+		return errors.New("X402 not initialized. Call InitX402() first.")
+	}
+	return globalServer.Reload(config)
+}
+
+// Shutdown gracefully stops the server configured with InitX402: it waits
+// for pending settlements, delivers queued webhooks, and persists in-memory
+// stores (see serverx402.Server.Shutdown).
+func Shutdown(ctx context.Context) error {
+	if globalServer == nil {
+		return nil
+	}
+	return globalServer.Shutdown(ctx)
+}
+
+// X402 is a middleware instance bound to its own configuration.
+//
+// Unlike InitX402, which configures the package-level middleware, several
+// instances can coexist in one process (e.g., two wallets or networks).
+//
+// Example:
+//
+//	mainnet := fasthttpx402.New(&fasthttpx402.Config{
+//	    PaymentAddress: "MAINNET_WALLET_ADDRESS",
+//	    TokenMint:      "USDC_MINT_ADDRESS",
+//	    Network:        "solana-mainnet",
+//	})
+//	premium := mainnet.PaymentRequired(fasthttpx402.PaymentRequiredOptions{Amount: "0.10"})(handler)
+type X402 struct {
+	server *serverx402.Server
+}
+
+// New creates a middleware instance with its own configuration.
+func New(config *Config) *X402 {
+	return &X402{server: serverx402.New(config)}
+}
+
+// Config returns the instance configuration.
+func (x *X402) Config() *Config {
+	return x.server.Config()
+}
+
+// Server returns the shared server core backing the instance.
+func (x *X402) Server() *serverx402.Server {
+	return x.server
+}
+
+// Reload atomically replaces the payment address and token mint of the
+// instance at runtime (see serverx402.Server.Reload).
+func (x *X402) Reload(config *Config) error {
+	return x.server.Reload(config)
+}
+
+// Shutdown gracefully stops the instance (see serverx402.Server.Shutdown).
+func (x *X402) Shutdown(ctx context.Context) error {
+	return x.server.Shutdown(ctx)
+}
+
+// PaymentRequiredOptions configures payment requirements for a specific endpoint.
+type PaymentRequiredOptions struct {
+	Amount         string // Required payment amount (e.g., "0.10")
+	PaymentAddress string // Optional override of global payment address
+	TokenMint      string // Optional override of global token mint
+	Network        string // Optional override of global network
+	Description    string // Human-readable description
+	ExpiresIn      int    // Expiration time in seconds (default: 300)
+	AutoVerify     bool   // Auto-verify payment on-chain (default: true)
+
+	// PriceFunc optionally computes the amount and description per request,
+	// overriding Amount and Description.
+	PriceFunc func(ctx *fasthttp.RequestCtx) (amount string, description string, err error)
+
+	// Authorize optionally applies a per-payer policy. It is called with the payer's
+	// public key (from the authorization header, or the X-Payer-Public-Key header on
+	// the initial request) and may grant free access, apply a discount, or return an
+	// error to block the payer. Public keys are self-declared by the client, so free
+	// access should only be granted to payers authenticated by other means.
+	Authorize func(pubkey string) (PriceOverride, error)
+
+	// VolumePricing optionally prices by the payer's volume of verified
+	// payments, counted in Config.Store, e.g. cheaper calls after the first
+	// 100. The payer's tier is quoted if the request declares the payer in the
+	// X-Payer-Public-Key header.
+	VolumePricing *serverx402.VolumePricing
+
+	// RangePricing optionally prices a file by the bytes the request's Range
+	// header asks for, e.g. 0.01 per started 10 MiB, replacing Amount.
+	// Serve the file with a fasthttp.FS with AcceptByteRange set.
+	RangePricing *serverx402.RangePricing
+
+	// FiatAmount optionally sets the price in fiat, e.g. "0.10" USD, which is
+	// converted to a token amount with Config.PriceOracle when the payment
+	// request is issued. It replaces Amount. Currency overrides
+	// Config.Currency.
+	FiatAmount string
+	Currency   string
+
+	// AcceptedTokens optionally accepts other tokens besides TokenMint, each
+	// at its own price, e.g. USDT and BONK next to USDC. The 402 response
+	// lists them, and payments in any of them are accepted.
+	AcceptedTokens []core.TokenPrice
+
+	// Splits optionally pays percentages of the price to other recipients,
+	// e.g. 80% to a creator; PaymentAddress receives the rest.
+	Splits []core.PaymentSplit
+
+	// Escrow optionally asks payers to deposit the payment into an escrow
+	// program and release it once the response is delivered. Requires a
+	// Config.Processor implementing core.EscrowProcessor.
+	Escrow bool
+
+	// ChannelDeposit optionally offers a payment channel: a payment of this
+	// deposit opens a channel that pays later requests with signed vouchers
+	// instead of on-chain transactions. Requires Config.AutoVerify and
+	// Config.RefundProcessor.
+	ChannelDeposit string
+
+	// MaxOutstanding optionally lets payers charge requests to a tab with
+	// signed vouchers and settle it in one payment, capping the unsettled
+	// balance at this amount. Requires Config.AutoVerify.
+	MaxOutstanding string
+
+	// LightningSats optionally offers paying this many satoshis with a
+	// Lightning invoice instead. Requires Config.Lightning and
+	// Config.NonceStore.
+	LightningSats int64
+
+	// Plans optionally offers subscription plans in the 402 response, which
+	// grant access without paying per request until they expire. Requires a
+	// Config.Store implementing serverx402.SubscriptionStore.
+	Plans []core.SubscriptionPlan
+
+	// RequestsIncluded optionally lets a verified payment grant that many
+	// further requests to the endpoint. The paid response returns a quota
+	// token in the X-Payment-Quota header to send with them, and responses
+	// report the requests left in X-Payment-Quota-Remaining.
+	RequestsIncluded int
+
+	// RefundOnError refunds the payment in full when the wrapped handler responds
+	// with a 5xx status, reporting the refund transaction hash in the
+	// X-Payment-Refund header. Requires Config.RefundProcessor.
+	RefundOnError bool
+
+	// Capture makes Amount a hold for variable-cost endpoints: the handler
+	// calls Capture with the actual cost once it is known, and the rest is
+	// refunded. Requires Config.AutoVerify without AsyncSettlement, and
+	// Config.RefundProcessor.
+	Capture bool
+
+	// UnitPricing optionally prices the request by the units it consumes,
+	// such as output tokens: the payment holds MaxUnits, the handler reports
+	// the units it used with ReportUnits, and their price is captured once
+	// it returns. Requires the same configuration as Capture.
+	UnitPricing *serverx402.UnitPricing
+}
+
+// PaymentRequired returns fasthttp middleware that requires payment for the wrapped handler.
+//
+// Usage:
+//
+//	handler := fasthttpx402.PaymentRequired(fasthttpx402.PaymentRequiredOptions{
+//	    Amount:      "0.10",
+//	    Description: "Premium market data",
+//	})(premiumDataHandler)
+//	fasthttp.ListenAndServe(":8080", handler)
+func PaymentRequired(opts PaymentRequiredOptions) func(fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return paymentRequired(func() *serverx402.Server { return globalServer }, opts)
+}
+
+// PaymentRequired returns middleware that requires payment using the instance configuration.
+func (x *X402) PaymentRequired(opts PaymentRequiredOptions) func(fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return paymentRequired(func() *serverx402.Server { return x.server }, opts)
+}
+
+// paymentRequired builds the payment middleware for the server returned by getServer.
+func paymentRequired(getServer func() *serverx402.Server, opts PaymentRequiredOptions) func(fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(next fasthttp.RequestHandler) fasthttp.RequestHandler {
+		return func(ctx *fasthttp.RequestCtx) {
+			server := getServer()
+			if server == nil {
+				ctx.Error("X402 not initialized. Call InitX402() first.", http.StatusInternalServerError)
+				return
+			}
+
+			// Determine price (dynamic pricing takes precedence)
+			amount := opts.Amount
+			description := opts.Description
+			if opts.PriceFunc != nil {
+				var err error
+				amount, description, err = opts.PriceFunc(ctx)
+				if err != nil {
+					respond(ctx, server, server.PriceError(string(ctx.Path()), err))
+					return
+				}
+			}
+
+			result := server.Process(serverx402.Request{
+				Context:  ctx,
+				Resource: string(ctx.Path()),
+				Header: func(name string) string {
+					return string(ctx.Request.Header.Peek(name))
+				},
+				ClientIP: ctx.RemoteIP().String(),
+
+				Deferrable: true,
+			}, serverx402.Options{
+				Amount:         amount,
+				PaymentAddress: opts.PaymentAddress,
+				TokenMint:      opts.TokenMint,
+				Network:        opts.Network,
+				Description:    description,
+				ExpiresIn:      opts.ExpiresIn,
+				Authorize:      opts.Authorize,
+				VolumePricing:  opts.VolumePricing,
+				RangePricing:   opts.RangePricing,
+				Capture:        opts.Capture,
+				UnitPricing:    opts.UnitPricing,
+				FiatAmount:     opts.FiatAmount,
+				Currency:       opts.Currency,
+				AcceptedTokens: opts.AcceptedTokens,
+				Splits:         opts.Splits,
+				Escrow:         opts.Escrow,
+				ChannelDeposit: opts.ChannelDeposit,
+				MaxOutstanding: opts.MaxOutstanding,
+				LightningSats:  opts.LightningSats,
+				Plans:          opts.Plans,
+
+				RequestsIncluded: opts.RequestsIncluded,
+			})
+			if !result.Allowed() {
+				respond(ctx, server, result)
+				return
+			}
+
+			if result.SessionToken != "" {
+				ctx.Response.Header.Set(server.Config().SessionHeader, result.SessionToken)
+			}
+			if result.SubscriptionToken != "" {
+				ctx.Response.Header.Set(server.Config().SubscriptionHeader, result.SubscriptionToken)
+			}
+			if result.QuotaToken != "" {
+				ctx.Response.Header.Set(server.Config().QuotaHeader, result.QuotaToken)
+				ctx.Response.Header.Set(server.Config().QuotaRemainingHeader, strconv.Itoa(result.QuotaRemaining))
+			}
+			if result.ChannelID != "" {
+				ctx.Response.Header.Set(server.Config().ChannelHeader, result.ChannelID)
+				ctx.Response.Header.Set(server.Config().ChannelBalanceHeader, result.ChannelBalance)
+			}
+			if result.TabOutstanding != "" {
+				ctx.Response.Header.Set(server.Config().TabHeader, result.TabOutstanding)
+			}
+			if result.Deferred != nil {
+				deferred, _ := result.Deferred.ToHeaderValue()
+				ctx.Response.Header.Set(server.Config().DeferredHeader, deferred)
+			}
+
+			// Payment verified, attach to context and continue
+			if result.Payer != "" {
+				ctx.SetUserValue(payerKey, result.Payer)
+			}
+			if result.Authorization != nil {
+				ctx.SetUserValue(paymentAuthKey, result.Authorization)
+				if opts.Capture || opts.UnitPricing != nil {
+					ctx.SetUserValue(holdKey, hold{server, result})
+				}
+			}
+			next(ctx)
+
+			// The response is buffered, so the refund header can be added afterwards
+			if opts.RefundOnError {
+				if refund := server.RefundOnError(ctx, result, ctx.Response.StatusCode()); refund != nil {
+					ctx.Response.Header.Set(serverx402.RefundHeader, refund.TransactionHash)
+				}
+			}
+			if opts.UnitPricing != nil && result.Requirement.Units != nil && result.Authorization != nil && result.Captured == "" {
+				// Refund failures are logged by the server
+				if refund, err := server.CaptureUnits(ctx, result); err == nil {
+					reportCapture(ctx, result, refund)
+				}
+			}
+		}
+	}
+}
+
+// paymentAuthKey is the user value key for PaymentAuthorization, and
+// payerKey that of the verified payer.
+const (
+	paymentAuthKey = "payment_authorization"
+	payerKey       = "x402_payer"
+	holdKey        = "x402_hold"
+)
+
+// hold is a held payment to capture.
+type hold struct {
+	server *serverx402.Server
+	result *serverx402.Result
+}
+
+// Capture charges amount of the held payment of a request to an endpoint
+// with Capture set, refunding the rest of the hold to the payer (see
+// serverx402.Server.Capture). Handlers call it once the cost is known; the
+// amount captured and the refund transaction hash are sent in the
+// X-Payment-Captured and X-Payment-Refund headers.
+func Capture(ctx *fasthttp.RequestCtx, amount string) error {
+	held, ok := ctx.UserValue(holdKey).(hold)
+	if !ok {
+		return serverx402.ErrNotHeld
+	}
+	refund, err := held.server.Capture(ctx, held.result, amount)
+	if err != nil {
+		return err
+	}
+	reportCapture(ctx, held.result, refund)
+	return nil
+}
+
+// ReportUnits records n units consumed by a request to an endpoint with
+// UnitPricing, such as output tokens. PaymentRequired captures the price of
+// the units once the handler returns, reporting it in the
+// X-Payment-Captured header.
+func ReportUnits(ctx *fasthttp.RequestCtx, n int64) {
+	if held, ok := ctx.UserValue(holdKey).(hold); ok {
+		held.result.AddUnits(n)
+	}
+}
+
+// reportCapture sets the amount captured of a held payment and the
+// transaction hash of the refund, if any, as headers.
+func reportCapture(ctx *fasthttp.RequestCtx, result *serverx402.Result, refund *core.Refund) {
+	ctx.Response.Header.Set(serverx402.CapturedHeader, result.Captured)
+	if refund != nil {
+		ctx.Response.Header.Set(serverx402.RefundHeader, refund.TransactionHash)
+	}
+}
+
+// GetPaymentAuthorization retrieves the PaymentAuthorization from the request context.
+//
+// This is useful if you want to access payment details in your handler.
+func GetPaymentAuthorization(ctx *fasthttp.RequestCtx) *core.PaymentAuthorization {
+	if auth, ok := ctx.UserValue(paymentAuthKey).(*core.PaymentAuthorization); ok {
+		return auth
+	}
+	return nil
+}
+
+// PayerID returns the public key of the verified payer of the request, set
+// by PaymentRequired when the request proceeds on a payment, or a session,
+// subscription, quota token, or voucher of one (see
+// serverx402.Result.Payer). It returns "" for free access.
+//
+// Middlewares after PaymentRequired can key on it, e.g. to rate limit or
+// log per paying wallet.
+func PayerID(ctx *fasthttp.RequestCtx) string {
+	payer, _ := ctx.UserValue(payerKey).(string)
+	return payer
+}
+
+// Chain composes middlewares into one, applied in the order given, so that
+// the first sees the request first. Middlewares keying on PayerID go after
+// PaymentRequired.
+func Chain(middlewares ...func(fasthttp.RequestHandler) fasthttp.RequestHandler) func(fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(next fasthttp.RequestHandler) fasthttp.RequestHandler {
+		for i := len(middlewares) - 1; i >= 0; i-- {
+			next = middlewares[i](next)
+		}
+		return next
+	}
+}
+
+// respond sends the response for a result that is not allowed, in the format
+// the Accept header asks for.
+func respond(ctx *fasthttp.RequestCtx, server *serverx402.Server, result *serverx402.Result) {
+	if result.Status == http.StatusNoContent {
+		// A deferred payment was settled
+		ctx.SetStatusCode(result.Status)
+		return
+	}
+	var (
+		status      = result.Status
+		contentType string
+		body        []byte
+		err         error
+	)
+	if config := server.Config(); config.Build402 != nil || config.BuildRejection != nil {
+		// The hooks take a net/http request
+		var r http.Request
+		if err = fasthttpadaptor.ConvertRequest(ctx, &r, true); err == nil {
+			status, contentType, body, err = server.HTTPResponse(&r, result)
+		}
+	} else {
+		contentType, body, err = server.Response(result, string(ctx.Request.Header.Peek("Accept")))
+	}
+	if err != nil {
+		ctx.Error("Failed to render response: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	ctx.SetContentType(contentType)
+	ctx.Response.Header.Add("Vary", "Accept")
+	if retryAfter := result.RetryAfterHeader(); retryAfter != "" {
+		ctx.Response.Header.Set("Retry-After", retryAfter)
+	}
+	ctx.SetStatusCode(status)
+	ctx.SetBody(body)
+}
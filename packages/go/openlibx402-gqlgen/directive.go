@@ -0,0 +1,316 @@
+// Package gqlgen provides a gqlgen directive to require X402 payments for
+// GraphQL queries, mutations, and individual fields.
+//
+// Declare the directive in your schema:
+//
+//	directive @payment(amount: String!, description: String) on FIELD_DEFINITION
+//
+//	type Query {
+//	    freeData: String!
+//	    premiumData: String! @payment(amount: "0.10", description: "Premium data")
+//	}
+//
+// and wire it into the generated config:
+//
+//	cfg := generated.Config{Resolvers: &Resolver{}}
+//	cfg.Directives.Payment = gqlgenx402.PaymentDirective(gqlgenx402.PaymentRequiredOptions{})
+//
+// The payment authorization is read from the X-Payment-Authorization header
+// (or Config.AuthorizationHeader) of the GraphQL HTTP request. When it is
+// missing, the field resolves to a GraphQL error with extensions.code "PAYMENT_REQUIRED" and the PaymentRequest under
+// extensions.payment_request. One authorization unlocks every paid field whose
+// price it covers, so clients should pay the highest price in the operation.
+package gqlgen
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/openlibx402/go/openlibx402-core"
+	"github.com/openlibx402/go/openlibx402-server"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// Config holds global configuration for the X402 directive.
+type Config = serverx402.Config
+
+// ConfigFromEnv reads a Config from X402_* environment variables (see
+// serverx402.ConfigFromEnv).
+func ConfigFromEnv() (*Config, error) {
+	return serverx402.ConfigFromEnv()
+}
+
+// ConfigFromFile reads a Config from a JSON, YAML, or TOML file (see
+// serverx402.ConfigFromFile).
+func ConfigFromFile(path string) (*Config, error) {
+	return serverx402.ConfigFromFile(path)
+}
+
+// PriceOverride adjusts the price of a field for a specific payer.
+type PriceOverride = serverx402.PriceOverride
+
+var globalServer *serverx402.Server
+
+// InitX402 initializes the global X402 configuration. It fails, leaving the
+// directive uninitialized, if the configuration is invalid (see
+// Config.Validate).
+//
+// This should be called once at application startup before serving GraphQL requests.
+//
+// Example:
+//
+//	if err := gqlgenx402.InitX402(&gqlgenx402.Config{
+//	    PaymentAddress: "YOUR_WALLET_ADDRESS",
+//	    TokenMint:      "USDC_MINT_ADDRESS",
+//	    Network:        "solana-devnet",
+//	    AutoVerify:     true,
+//	}); err != nil {
+//	    log.Fatal(err)
+//	}
+func InitX402(config *Config) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	globalServer = serverx402.New(config)
+	return nil
+}
+
+// Reload atomically replaces the payment address and token mint configured
+// with InitX402 at runtime (see serverx402.Server.Reload).
+func Reload(config *Config) error {
+	if globalServer == nil {
+		return errors.New("X402 not initialized. Call InitX402() first.")
+	}
+	return globalServer.Reload(config)
+}
+
+// Shutdown gracefully stops the server configured with InitX402: it waits
+// for pending settlements, delivers queued webhooks, and persists in-memory
+// stores (see serverx402.Server.Shutdown).
+func Shutdown(ctx context.Context) error {
+	if globalServer == nil {
+		return nil
+	}
+	return globalServer.Shutdown(ctx)
+}
+
+// X402 is an instance of the X402 directive bound to its own configuration.
+//
+// Unlike InitX402, which configures the package-level directive, several
+// instances can coexist in one process (e.g., two wallets or networks).
+//
+// Example:
+//
+//	mainnet := gqlgenx402.New(&gqlgenx402.Config{
+//	    PaymentAddress: "MAINNET_WALLET_ADDRESS",
+//	    TokenMint:      "USDC_MINT_ADDRESS",
+//	    Network:        "solana-mainnet",
+//	})
+//	cfg.Directives.Payment = mainnet.PaymentDirective(gqlgenx402.PaymentRequiredOptions{})
+type X402 struct {
+	server *serverx402.Server
+}
+
+// New creates an instance with its own configuration.
+func New(config *Config) *X402 {
+	return &X402{server: serverx402.New(config)}
+}
+
+// Config returns the instance configuration.
+func (x *X402) Config() *Config {
+	return x.server.Config()
+}
+
+// Server returns the shared server core backing the instance.
+func (x *X402) Server() *serverx402.Server {
+	return x.server
+}
+
+// Reload atomically replaces the payment address and token mint of the
+// instance at runtime (see serverx402.Server.Reload).
+func (x *X402) Reload(config *Config) error {
+	return x.server.Reload(config)
+}
+
+// Shutdown gracefully stops the instance (see serverx402.Server.Shutdown).
+func (x *X402) Shutdown(ctx context.Context) error {
+	return x.server.Shutdown(ctx)
+}
+
+// PaymentRequiredOptions configures defaults shared by every @payment field.
+type PaymentRequiredOptions struct {
+	PaymentAddress string // Optional override of global payment address
+	TokenMint      string // Optional override of global token mint
+	Network        string // Optional override of global network
+	ExpiresIn      int    // Expiration time in seconds (default: 300)
+
+	// Authorize optionally applies a per-payer policy. It is called with the payer's
+	// public key (from the authorization header, or the X-Payer-Public-Key header on
+	// the initial request) and may grant free access, apply a discount, or return an
+	// error to block the payer. Public keys are self-declared by the client, so free
+	// access should only be granted to payers authenticated by other means.
+	Authorize func(pubkey string) (PriceOverride, error)
+
+	// VolumePricing optionally prices by the payer's volume of verified
+	// payments, counted in Config.Store, e.g. cheaper calls after the first
+	// 100. The payer's tier is quoted if the request declares the payer in the
+	// X-Payer-Public-Key header.
+	VolumePricing *serverx402.VolumePricing
+
+	// FiatAmount optionally sets the price in fiat, e.g. "0.10" USD, which is
+	// converted to a token amount with Config.PriceOracle when the payment
+	// request is issued. It replaces Amount. Currency overrides
+	// Config.Currency.
+	FiatAmount string
+	Currency   string
+
+	// AcceptedTokens optionally accepts other tokens besides TokenMint, each
+	// at its own price, e.g. USDT and BONK next to USDC. The 402 response
+	// lists them, and payments in any of them are accepted.
+	AcceptedTokens []core.TokenPrice
+
+	// Splits optionally pays percentages of the price to other recipients,
+	// e.g. 80% to a creator; PaymentAddress receives the rest.
+	Splits []core.PaymentSplit
+
+	// Escrow optionally asks payers to deposit the payment into an escrow
+	// program and release it once the response is delivered. Requires a
+	// Config.Processor implementing core.EscrowProcessor.
+	Escrow bool
+}
+
+// DirectiveFunc is the signature gqlgen generates for the @payment directive.
+type DirectiveFunc func(ctx context.Context, obj interface{}, next graphql.Resolver, amount string, description *string) (interface{}, error)
+
+// PaymentDirective returns the implementation of the @payment directive.
+func PaymentDirective(opts PaymentRequiredOptions) DirectiveFunc {
+	return paymentDirective(func() *serverx402.Server { return globalServer }, opts)
+}
+
+// PaymentDirective returns the implementation of the @payment directive using the instance configuration.
+func (x *X402) PaymentDirective(opts PaymentRequiredOptions) DirectiveFunc {
+	return paymentDirective(func() *serverx402.Server { return x.server }, opts)
+}
+
+// paymentDirective builds the directive for the server returned by getServer.
+func paymentDirective(getServer func() *serverx402.Server, opts PaymentRequiredOptions) DirectiveFunc {
+	return func(ctx context.Context, obj interface{}, next graphql.Resolver, amount string, description *string) (interface{}, error) {
+		server := getServer()
+		if server == nil {
+			return nil, gqlError(ctx, "X402 not initialized. Call InitX402() first.", "INTERNAL", nil)
+		}
+
+		desc := ""
+		if description != nil {
+			desc = *description
+		}
+
+		header := requestHeader(ctx)
+		result := server.Process(serverx402.Request{
+			Context:  ctx,
+			Resource: graphql.GetPath(ctx).String(),
+			Header:   header.Get,
+		}, serverx402.Options{
+			Amount:         amount,
+			PaymentAddress: opts.PaymentAddress,
+			TokenMint:      opts.TokenMint,
+			Network:        opts.Network,
+			Description:    desc,
+			ExpiresIn:      opts.ExpiresIn,
+			Authorize:      opts.Authorize,
+			VolumePricing:  opts.VolumePricing,
+			FiatAmount:     opts.FiatAmount,
+			Currency:       opts.Currency,
+			AcceptedTokens: opts.AcceptedTokens,
+			Splits:         opts.Splits,
+			Escrow:         opts.Escrow,
+		})
+		if !result.Allowed() {
+			return nil, rejectionError(ctx, result)
+		}
+
+		// Payment verified, attach to context and continue
+		if result.Payer != "" {
+			ctx = context.WithValue(ctx, payerKey, result.Payer)
+		}
+		if result.Authorization != nil {
+			ctx = context.WithValue(ctx, paymentAuthKey, result.Authorization)
+		}
+		return next(ctx)
+	}
+}
+
+// rejectionError maps a rejected pipeline result to a GraphQL error.
+func rejectionError(ctx context.Context, result *serverx402.Result) *gqlerror.Error {
+	if result.PaymentRequest != nil {
+		return gqlError(ctx, "Payment is required to access this field", result.Code, map[string]interface{}{
+			"payment_request": result.PaymentRequest,
+		})
+	}
+
+	code := result.Code
+	if result.Status == http.StatusInternalServerError {
+		code = "INTERNAL"
+	}
+	extensions := map[string]interface{}{}
+	for k, v := range result.Details {
+		if k == "message" {
+			k = "reason"
+		}
+		extensions[k] = v
+	}
+	return gqlError(ctx, result.Message, code, extensions)
+}
+
+// contextKey is the type of context keys used by this package.
+type contextKey string
+
+// paymentAuthKey is the context key for PaymentAuthorization, and payerKey
+// that of the verified payer.
+const (
+	paymentAuthKey contextKey = "payment_authorization"
+	payerKey       contextKey = "payer"
+)
+
+// GetPaymentAuthorization retrieves the PaymentAuthorization from a resolver context.
+func GetPaymentAuthorization(ctx context.Context) *core.PaymentAuthorization {
+	if auth, ok := ctx.Value(paymentAuthKey).(*core.PaymentAuthorization); ok {
+		return auth
+	}
+	return nil
+}
+
+// PayerID returns the public key of the verified payer from a resolver
+// context, set when the field proceeds on a payment, or a session,
+// subscription, quota token, or voucher of one (see
+// serverx402.Result.Payer). It returns "" for free access.
+func PayerID(ctx context.Context) string {
+	payer, _ := ctx.Value(payerKey).(string)
+	return payer
+}
+
+// requestHeader returns the HTTP headers of the current GraphQL operation.
+func requestHeader(ctx context.Context) http.Header {
+	if !graphql.HasOperationContext(ctx) {
+		return http.Header{}
+	}
+	if headers := graphql.GetOperationContext(ctx).Headers; headers != nil {
+		return headers
+	}
+	return http.Header{}
+}
+
+// gqlError builds a GraphQL error for the current field with an X402 error code.
+func gqlError(ctx context.Context, message, code string, extensions map[string]interface{}) *gqlerror.Error {
+	if extensions == nil {
+		extensions = map[string]interface{}{}
+	}
+	extensions["code"] = code
+	return &gqlerror.Error{
+		Message:    message,
+		Path:       graphql.GetPath(ctx),
+		Extensions: extensions,
+	}
+}
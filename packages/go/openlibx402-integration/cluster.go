@@ -0,0 +1,145 @@
+package integration
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"math"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/programs/system"
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/openlibx402/go/openlibx402-core"
+)
+
+// SPL Token and Token-2022 instructions used to set up mints.
+const (
+	mintToCheckedInstruction   = 14
+	initializeMint2Instruction = 20
+	mintAccountSize            = 82
+)
+
+// cluster sets up accounts on the cluster under test.
+type cluster struct {
+	client    *rpc.Client
+	processor *core.SolanaPaymentProcessor
+	logger    *slog.Logger
+}
+
+func newCluster(rpcURL string, logger *slog.Logger) *cluster {
+	processor := core.NewSolanaPaymentProcessor(rpcURL, nil)
+	processor.SetLogger(logger)
+	return &cluster{client: rpc.New(rpcURL), processor: processor, logger: logger}
+}
+
+func (c *cluster) close() {
+	c.client.Close()
+	c.processor.Close()
+}
+
+// fund airdrops 2 SOL to account if it holds less than MinPayerBalance.
+func (c *cluster) fund(ctx context.Context, account solana.PublicKey) error {
+	balance, err := c.client.GetBalance(ctx, account, rpc.CommitmentConfirmed)
+	if err != nil {
+		return fmt.Errorf("failed to get payer balance: %w", err)
+	}
+	if balance.Value >= MinPayerBalance {
+		return nil
+	}
+	c.logger.Info("x402: requesting airdrop for integration payer", core.LogKeyPayer, account.String())
+	sig, err := c.client.RequestAirdrop(ctx, account, 2*solana.LAMPORTS_PER_SOL, rpc.CommitmentConfirmed)
+	if err != nil {
+		return fmt.Errorf("failed to airdrop SOL to payer %s (fund it manually on public clusters): %w", account, err)
+	}
+	if err := c.processor.WaitForConfirmation(ctx, sig.String(), core.CommitmentConfirmed); err != nil {
+		return fmt.Errorf("airdrop to payer %s was not confirmed: %w", account, err)
+	}
+	return nil
+}
+
+// createMint creates a mint of the scenario's token program with payer as
+// mint authority, and mints supply tokens to payer's associated token
+// account.
+func (c *cluster) createMint(ctx context.Context, payer solana.PrivateKey, scenario Scenario, supply uint64) (solana.PublicKey, error) {
+	mintKey := solana.NewWallet().PrivateKey
+	mint := mintKey.PublicKey()
+	program := scenario.TokenProgram
+	owner := payer.PublicKey()
+
+	rent, err := c.client.GetMinimumBalanceForRentExemption(ctx, mintAccountSize, rpc.CommitmentConfirmed)
+	if err != nil {
+		return mint, fmt.Errorf("failed to get rent exemption: %w", err)
+	}
+	account, _, err := solana.FindProgramAddress([][]byte{owner[:], program[:], mint[:]}, solana.SPLAssociatedTokenAccountProgramID)
+	if err != nil {
+		return mint, err
+	}
+
+	initialize := make([]byte, 35)
+	initialize[0] = initializeMint2Instruction
+	initialize[1] = scenario.Decimals
+	copy(initialize[2:34], owner[:]) // mint authority, no freeze authority
+
+	mintTo := make([]byte, 10)
+	mintTo[0] = mintToCheckedInstruction
+	binary.LittleEndian.PutUint64(mintTo[1:9], supply*uint64(math.Pow10(int(scenario.Decimals))))
+	mintTo[9] = scenario.Decimals
+
+	instructions := []solana.Instruction{
+		system.NewCreateAccountInstruction(rent, mintAccountSize, program, owner, mint).Build(),
+		solana.NewInstruction(program, solana.AccountMetaSlice{solana.Meta(mint).WRITE()}, initialize),
+		solana.NewInstruction(solana.SPLAssociatedTokenAccountProgramID, solana.AccountMetaSlice{
+			solana.Meta(owner).WRITE().SIGNER(),
+			solana.Meta(account).WRITE(),
+			solana.Meta(owner),
+			solana.Meta(mint),
+			solana.Meta(solana.SystemProgramID),
+			solana.Meta(program),
+		}, []byte{}),
+		solana.NewInstruction(program, solana.AccountMetaSlice{
+			solana.Meta(mint).WRITE(),
+			solana.Meta(account).WRITE(),
+			solana.Meta(owner).SIGNER(),
+		}, mintTo),
+	}
+	if err := c.send(ctx, instructions, payer, mintKey); err != nil {
+		return mint, err
+	}
+	c.logger.Info("x402: created integration mint", "mint", mint.String(), "program", program.String(), "decimals", scenario.Decimals)
+	return mint, nil
+}
+
+// send sends a transaction paid by the first signer and waits for it to be
+// confirmed.
+func (c *cluster) send(ctx context.Context, instructions []solana.Instruction, signers ...solana.PrivateKey) error {
+	blockhash, err := c.client.GetLatestBlockhash(ctx, rpc.CommitmentConfirmed)
+	if err != nil {
+		return fmt.Errorf("failed to get blockhash: %w", err)
+	}
+	tx, err := solana.NewTransaction(instructions, blockhash.Value.Blockhash, solana.TransactionPayer(signers[0].PublicKey()))
+	if err != nil {
+		return err
+	}
+	_, err = tx.Sign(func(key solana.PublicKey) *solana.PrivateKey {
+		for i := range signers {
+			if signers[i].PublicKey().Equals(key) {
+				return &signers[i]
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to sign transaction: %w", err)
+	}
+	sig, err := c.client.SendTransactionWithOpts(ctx, tx, rpc.TransactionOpts{PreflightCommitment: rpc.CommitmentConfirmed})
+	if err != nil {
+		return fmt.Errorf("failed to send transaction: %w", err)
+	}
+	return c.processor.WaitForConfirmation(ctx, sig.String(), core.CommitmentConfirmed)
+}
+
+// tokenBalance returns owner's balance of mint in token units.
+func (c *cluster) tokenBalance(ctx context.Context, owner, mint solana.PublicKey) (float64, error) {
+	return c.processor.GetTokenBalance(ctx, owner.String(), mint.String())
+}
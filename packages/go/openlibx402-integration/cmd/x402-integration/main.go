@@ -0,0 +1,93 @@
+// Command x402-integration runs the X402 payment loop against a Solana
+// cluster (see package integration) and reports each scenario, exiting with
+// status 1 if any failed.
+//
+// Usage:
+//
+//	solana-test-validator --reset &
+//	x402-integration
+//
+//	x402-integration -rpc https://api.devnet.solana.com -wallet funded-devnet-payer.json
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/openlibx402/go/openlibx402-core/wallet"
+	"github.com/openlibx402/go/openlibx402-integration"
+)
+
+func main() {
+	rpcURL := flag.String("rpc", integration.LocalRPCURL, "cluster RPC endpoint")
+	network := flag.String("network", "solana-devnet", "network of the payment requests")
+	walletPath := flag.String("wallet", "", "payer wallet file (default: a new keypair funded by airdrop)")
+	amount := flag.String("amount", "0.01", "price of the paid endpoint")
+	scenarios := flag.String("scenarios", "", "comma-separated scenarios to run: spl-token, token-2022 (default: all)")
+	verbose := flag.Bool("v", false, "log client, server, and setup activity")
+	flag.Parse()
+
+	if err := run(*rpcURL, *network, *walletPath, *amount, *scenarios, *verbose); err != nil {
+		fmt.Fprintf(os.Stderr, "x402-integration: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(rpcURL, network, walletPath, amount, scenarios string, verbose bool) error {
+	cfg := integration.Config{RPCURL: rpcURL, Network: network, Amount: amount}
+	if verbose {
+		cfg.Logger = slog.New(slog.NewTextHandler(os.Stderr, nil))
+	}
+	if walletPath != "" {
+		key, err := wallet.LoadFromFile(walletPath)
+		if err != nil {
+			return fmt.Errorf("failed to load wallet %s: %w", walletPath, err)
+		}
+		cfg.Payer = key
+	}
+	if scenarios != "" {
+		for _, name := range strings.Split(scenarios, ",") {
+			scenario, err := findScenario(strings.TrimSpace(name))
+			if err != nil {
+				return err
+			}
+			cfg.Scenarios = append(cfg.Scenarios, scenario)
+		}
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+	report, err := integration.Run(ctx, cfg)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Payer: %s\n", report.Payer)
+	for _, result := range report.Results {
+		if result.Err != nil {
+			fmt.Printf("FAIL  %-12s %v\n", result.Scenario, result.Err)
+			continue
+		}
+		fmt.Printf("PASS  %-12s %d payments in %s (mint %s)\n", result.Scenario, len(result.Transactions), result.Duration.Round(time.Millisecond), result.Mint)
+	}
+	if report.Failed() {
+		return fmt.Errorf("integration scenarios failed")
+	}
+	return nil
+}
+
+// findScenario returns the default scenario with a name.
+func findScenario(name string) (integration.Scenario, error) {
+	for _, scenario := range integration.DefaultScenarios {
+		if scenario.Name == name {
+			return scenario, nil
+		}
+	}
+	return integration.Scenario{}, fmt.Errorf("unknown scenario %q", name)
+}
@@ -0,0 +1,237 @@
+// Package integration runs the full X402 payment loop against a real Solana
+// cluster, to validate the SDK and a deployment's setup end to end.
+//
+// Run creates token mints, funds a payer, and for each scenario serves a paid
+// endpoint with the net/http middleware and pays for it twice with the
+// automatic client: the first payment creates the recipient's associated token
+// account, the second pays into the existing one. Payments are verified
+// on-chain with memos and attestations required.
+//
+// It is meant for solana-test-validator, whose airdrops are unlimited, or for
+// devnet with a funded payer. Nothing here runs against a cluster by
+// default: TestIntegration runs when X402_INTEGRATION_RPC is set, and Run can
+// be called from a test gated the same way or from the x402-integration
+// command.
+//
+// Example:
+//
+//	func TestX402Integration(t *testing.T) {
+//	    rpcURL := os.Getenv("X402_INTEGRATION_RPC")
+//	    if rpcURL == "" {
+//	        t.Skip("set X402_INTEGRATION_RPC to run against a validator")
+//	    }
+//	    report, err := integration.Run(context.Background(), integration.Config{RPCURL: rpcURL})
+//	    if err != nil {
+//	        t.Fatal(err)
+//	    }
+//	    for _, result := range report.Results {
+//	        if result.Err != nil {
+//	            t.Errorf("%s: %v", result.Scenario, result.Err)
+//	        }
+//	    }
+//	}
+package integration
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/openlibx402/go/openlibx402-client"
+	"github.com/openlibx402/go/openlibx402-core"
+	"github.com/openlibx402/go/openlibx402-nethttp"
+	"github.com/openlibx402/go/openlibx402-server"
+)
+
+// LocalRPCURL is the RPC endpoint of solana-test-validator.
+const LocalRPCURL = "http://127.0.0.1:8899"
+
+// Scenario is a token setup the payment loop is run with.
+type Scenario struct {
+	Name         string
+	TokenProgram solana.PublicKey // SPL Token or Token-2022
+	Decimals     uint8
+}
+
+// DefaultScenarios pay with an SPL Token mint and a Token-2022 mint, whose
+// decimals differ from USDC's.
+var DefaultScenarios = []Scenario{
+	{Name: "spl-token", TokenProgram: solana.TokenProgramID, Decimals: 6},
+	{Name: "token-2022", TokenProgram: solana.Token2022ProgramID, Decimals: 9},
+}
+
+// Config configures a run.
+type Config struct {
+	RPCURL  string // Cluster RPC endpoint (default: LocalRPCURL)
+	Network string // Network of the payment requests (default: solana-devnet)
+
+	// Payer pays for the mints and the payments. By default a new keypair is
+	// created and funded by airdrop, which only works reliably on a local
+	// validator; on devnet, pass a wallet holding at least MinPayerBalance.
+	Payer solana.PrivateKey
+
+	Amount    string        // Price of the paid endpoint (default: "0.01")
+	Scenarios []Scenario    // Token setups to run (default: DefaultScenarios)
+	Timeout   time.Duration // Time limit of each scenario (default: 2 minutes)
+	Logger    *slog.Logger  // Logs of the client, server, and setup (default: discard)
+}
+
+// MinPayerBalance is the SOL balance in lamports below which Run requests an
+// airdrop for the payer.
+const MinPayerBalance = solana.LAMPORTS_PER_SOL / 2
+
+// Report is the outcome of a run.
+type Report struct {
+	Payer   string
+	Results []Result
+}
+
+// Failed reports whether any scenario failed.
+func (r *Report) Failed() bool {
+	for _, result := range r.Results {
+		if result.Err != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Result is the outcome of a scenario.
+type Result struct {
+	Scenario  string
+	Mint      string
+	Recipient string
+	// Transactions are the hashes of the payments made, in order.
+	Transactions []string
+	Duration     time.Duration
+	// Err is the step that failed, or nil if the scenario passed.
+	Err error
+}
+
+// Run runs the scenarios of cfg. It returns an error only if the payer could
+// not be funded; scenario failures are reported in the Report.
+func Run(ctx context.Context, cfg Config) (*Report, error) {
+	if cfg.RPCURL == "" {
+		cfg.RPCURL = LocalRPCURL
+	}
+	if cfg.Network == "" {
+		cfg.Network = "solana-devnet"
+	}
+	if cfg.Amount == "" {
+		cfg.Amount = "0.01"
+	}
+	if cfg.Scenarios == nil {
+		cfg.Scenarios = DefaultScenarios
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = 2 * time.Minute
+	}
+	logger := core.LoggerOrDiscard(cfg.Logger)
+
+	c := newCluster(cfg.RPCURL, logger)
+	defer c.close()
+	payer := cfg.Payer
+	if payer == nil {
+		payer = solana.NewWallet().PrivateKey
+	}
+	if err := c.fund(ctx, payer.PublicKey()); err != nil {
+		return nil, err
+	}
+
+	report := &Report{Payer: payer.PublicKey().String()}
+	for _, scenario := range cfg.Scenarios {
+		scenarioCtx, cancel := context.WithTimeout(ctx, cfg.Timeout)
+		report.Results = append(report.Results, runScenario(scenarioCtx, c, cfg, payer, scenario, logger))
+		cancel()
+	}
+	return report, nil
+}
+
+// runScenario mints a token, serves a paid endpoint priced in it, and pays
+// for the endpoint twice.
+func runScenario(ctx context.Context, c *cluster, cfg Config, payer solana.PrivateKey, scenario Scenario, logger *slog.Logger) Result {
+	start := time.Now()
+	recipient := solana.NewWallet().PublicKey()
+	result := Result{Scenario: scenario.Name, Recipient: recipient.String()}
+	fail := func(step string, err error) Result {
+		result.Duration = time.Since(start)
+		result.Err = fmt.Errorf("%s: %w", step, err)
+		logger.Warn("x402: integration scenario failed", "scenario", scenario.Name, "step", step, "error", err)
+		return result
+	}
+
+	mint, err := c.createMint(ctx, payer, scenario, 1000)
+	if err != nil {
+		return fail("create mint", err)
+	}
+	result.Mint = mint.String()
+
+	x402 := nethttp.New(&nethttp.Config{
+		PaymentAddress:     recipient.String(),
+		TokenMint:          mint.String(),
+		Network:            cfg.Network,
+		RPCURL:             cfg.RPCURL,
+		AutoVerify:         true,
+		Commitment:         core.CommitmentConfirmed,
+		RequirePaymentMemo: true,
+		RequireAttestation: true,
+		NonceStore:         serverx402.NewMemoryNonceStore(0),
+		Logger:             logger,
+	})
+	defer x402.Server().Close()
+	paid := x402.PaymentRequired(nethttp.PaymentRequiredOptions{
+		Amount:      cfg.Amount,
+		Description: "x402 integration test (" + scenario.Name + ")",
+	})
+	srv := httptest.NewServer(paid(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, nethttp.GetPaymentAuthorization(r).TransactionHash)
+	})))
+	defer srv.Close()
+
+	// A signer leaves the payer key intact when the client is closed
+	payerClient := client.NewAutoClientWithSigner(core.NewKeypairSigner(payer), cfg.RPCURL, &client.AutoClientOptions{
+		MaxRetries:       1,
+		AutoRetry:        true,
+		MaxPaymentAmount: cfg.Amount,
+		AllowLocal:       true,
+		Logger:           logger,
+		Confirmation:     core.CommitmentConfirmed,
+	})
+	defer payerClient.Close()
+
+	steps := []string{"first payment (creates the recipient token account)", "second payment (existing token account)"}
+	for _, step := range steps {
+		resp, err := payerClient.Get(ctx, srv.URL+"/paid")
+		if err != nil {
+			return fail(step, err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return fail(step, err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			return fail(step, fmt.Errorf("unexpected status %s: %s", resp.Status, body))
+		}
+		result.Transactions = append(result.Transactions, string(body))
+	}
+
+	received, err := c.tokenBalance(ctx, recipient, mint)
+	if err != nil {
+		return fail("check recipient balance", err)
+	}
+	want, _ := strconv.ParseFloat(cfg.Amount, 64)
+	if want *= float64(len(steps)); received < want-1e-9 {
+		return fail("check recipient balance", fmt.Errorf("recipient received %g, want %g", received, want))
+	}
+
+	result.Duration = time.Since(start)
+	logger.Info("x402: integration scenario passed", "scenario", scenario.Name, "mint", mint.String(), "duration", result.Duration)
+	return result
+}
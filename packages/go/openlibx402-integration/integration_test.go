@@ -0,0 +1,125 @@
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestIntegration runs the payment loop against the cluster at
+// X402_INTEGRATION_RPC, e.g. a solana-test-validator at LocalRPCURL.
+func TestIntegration(t *testing.T) {
+	rpcURL := os.Getenv("X402_INTEGRATION_RPC")
+	if rpcURL == "" {
+		t.Skip("set X402_INTEGRATION_RPC to run against a validator")
+	}
+	report, err := Run(context.Background(), Config{RPCURL: rpcURL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, result := range report.Results {
+		if result.Err != nil {
+			t.Errorf("%s: %v", result.Scenario, result.Err)
+		} else {
+			t.Logf("%s: paid %v in %v", result.Scenario, result.Transactions, result.Duration)
+		}
+	}
+}
+
+// stubRPC is a JSON-RPC server answering the methods in results, and every
+// other method with an error. It records the methods called.
+type stubRPC struct {
+	*httptest.Server
+	mu     sync.Mutex
+	called []string
+}
+
+func newStubRPC(t *testing.T, results map[string]interface{}) *stubRPC {
+	t.Helper()
+	stub := &stubRPC{}
+	stub.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var call struct {
+			ID     json.RawMessage `json:"id"`
+			Method string          `json:"method"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&call); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		stub.mu.Lock()
+		stub.called = append(stub.called, call.Method)
+		stub.mu.Unlock()
+
+		response := map[string]interface{}{"jsonrpc": "2.0", "id": call.ID}
+		if result, ok := results[call.Method]; ok {
+			response["result"] = result
+		} else {
+			response["error"] = map[string]interface{}{"code": -32601, "message": "method not found"}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}))
+	t.Cleanup(stub.Close)
+	return stub
+}
+
+func (s *stubRPC) calls(method string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, called := range s.called {
+		if called == method {
+			n++
+		}
+	}
+	return n
+}
+
+func TestRunFailsWithoutPayerBalance(t *testing.T) {
+	stub := newStubRPC(t, nil)
+
+	_, err := Run(context.Background(), Config{RPCURL: stub.URL, Timeout: 5 * time.Second})
+	if err == nil || !strings.Contains(err.Error(), "failed to get payer balance") {
+		t.Errorf("Run() = %v, want payer balance error", err)
+	}
+}
+
+func TestRunReportsScenarioFailures(t *testing.T) {
+	stub := newStubRPC(t, map[string]interface{}{
+		"getBalance": map[string]interface{}{"context": map[string]interface{}{"slot": 1}, "value": 2 * MinPayerBalance},
+	})
+
+	report, err := Run(context.Background(), Config{RPCURL: stub.URL, Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := stub.calls("requestAirdrop"); n != 0 {
+		t.Errorf("funded payer got %d airdrops, want 0", n)
+	}
+	if !report.Failed() || len(report.Results) != len(DefaultScenarios) {
+		t.Fatalf("got %d results, failed=%v; want %d failed", len(report.Results), report.Failed(), len(DefaultScenarios))
+	}
+	for i, result := range report.Results {
+		if result.Scenario != DefaultScenarios[i].Name || result.Err == nil || !strings.HasPrefix(result.Err.Error(), "create mint:") {
+			t.Errorf("result %d: %s %v, want %s to fail creating the mint", i, result.Scenario, result.Err, DefaultScenarios[i].Name)
+		}
+	}
+}
+
+func TestReportFailed(t *testing.T) {
+	report := &Report{Results: []Result{{Scenario: "a"}, {Scenario: "b"}}}
+	if report.Failed() {
+		t.Error("Failed() = true for passing scenarios")
+	}
+	report.Results[1].Err = errors.New("second payment: unexpected status")
+	if !report.Failed() {
+		t.Error("Failed() = false with a failed scenario")
+	}
+}
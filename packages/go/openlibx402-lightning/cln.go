@@ -0,0 +1,135 @@
+package lightning
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/openlibx402/go/openlibx402-core"
+)
+
+// CLN is a core.LightningBackend and core.LightningPayer for a Core
+// Lightning node, using the REST API of its clnrest plugin.
+type CLN struct {
+	url    string
+	rune   string
+	client *http.Client
+
+	// MaxFeeMsat caps the routing fee of payments (default: 0, the node's
+	// default limit).
+	MaxFeeMsat int64
+}
+
+var (
+	_ core.LightningBackend = (*CLN)(nil)
+	_ core.LightningPayer   = (*CLN)(nil)
+)
+
+// NewCLN creates a backend for the clnrest API at restURL (e.g.
+// "https://localhost:3010"), authenticated with a rune allowing the invoice
+// and listinvoices methods for servers, and decode and pay for payers.
+// httpClient must trust the node's TLS certificate (default: a client with
+// a 30 second timeout).
+func NewCLN(restURL, rune string, httpClient *http.Client) *CLN {
+	return &CLN{
+		url:    strings.TrimRight(restURL, "/"),
+		rune:   rune,
+		client: defaultHTTPClient(httpClient),
+	}
+}
+
+// call invokes a node method with POST /v1/{method}.
+func (c *CLN) call(ctx context.Context, method string, in, out interface{}) error {
+	header := http.Header{}
+	header.Set("Rune", c.rune)
+	return call(ctx, c.client, http.MethodPost, c.url+"/v1/"+method, header, in, out)
+}
+
+// CreateInvoice implements core.LightningBackend with the invoice method.
+// Invoices are labeled with a random "x402-" label, as labels must be unique.
+func (c *CLN) CreateInvoice(ctx context.Context, amountMsat int64, description string, expiry time.Duration) (*core.LightningInvoice, error) {
+	label := make([]byte, 16)
+	if _, err := rand.Read(label); err != nil {
+		return nil, err
+	}
+	in := map[string]interface{}{
+		"amount_msat": amountMsat,
+		"label":       "x402-" + hex.EncodeToString(label),
+		"description": description,
+		"expiry":      int64(expiry.Seconds()),
+	}
+	var out struct {
+		Bolt11      string `json:"bolt11"`
+		PaymentHash string `json:"payment_hash"`
+	}
+	if err := c.call(ctx, "invoice", in, &out); err != nil {
+		return nil, err
+	}
+	return &core.LightningInvoice{
+		Invoice:     out.Bolt11,
+		PaymentHash: out.PaymentHash,
+		AmountMsat:  amountMsat,
+	}, nil
+}
+
+// LookupInvoice implements core.LightningBackend with the listinvoices
+// method.
+func (c *CLN) LookupInvoice(ctx context.Context, paymentHash string) (*core.LightningInvoice, error) {
+	var out struct {
+		Invoices []struct {
+			Bolt11             string `json:"bolt11"`
+			PaymentHash        string `json:"payment_hash"`
+			Status             string `json:"status"`
+			AmountMsat         int64  `json:"amount_msat"`
+			AmountReceivedMsat int64  `json:"amount_received_msat"`
+		} `json:"invoices"`
+	}
+	if err := c.call(ctx, "listinvoices", map[string]string{"payment_hash": paymentHash}, &out); err != nil {
+		return nil, err
+	}
+	if len(out.Invoices) == 0 {
+		return nil, fmt.Errorf("no invoice with payment hash %s", paymentHash)
+	}
+	invoice := out.Invoices[0]
+	return &core.LightningInvoice{
+		Invoice:        invoice.Bolt11,
+		PaymentHash:    invoice.PaymentHash,
+		AmountMsat:     invoice.AmountMsat,
+		Settled:        invoice.Status == "paid",
+		AmountPaidMsat: invoice.AmountReceivedMsat,
+	}, nil
+}
+
+// PayInvoice implements core.LightningPayer: it decodes the invoice with the
+// decode method to check its amount, then pays it with the pay method.
+func (c *CLN) PayInvoice(ctx context.Context, invoice string, maxAmountMsat int64) (string, error) {
+	var decoded struct {
+		AmountMsat int64 `json:"amount_msat"`
+	}
+	if err := c.call(ctx, "decode", map[string]string{"string": invoice}, &decoded); err != nil {
+		return "", err
+	}
+	if err := checkAmount(decoded.AmountMsat, maxAmountMsat); err != nil {
+		return "", err
+	}
+
+	in := map[string]interface{}{"bolt11": invoice}
+	if c.MaxFeeMsat > 0 {
+		in["maxfee"] = c.MaxFeeMsat
+	}
+	var out struct {
+		PaymentPreimage string `json:"payment_preimage"` // Hex
+		Status          string `json:"status"`
+	}
+	if err := c.call(ctx, "pay", in, &out); err != nil {
+		return "", err
+	}
+	if out.Status != "complete" || out.PaymentPreimage == "" {
+		return "", fmt.Errorf("lightning payment %s", out.Status)
+	}
+	return out.PaymentPreimage, nil
+}
@@ -0,0 +1,88 @@
+// Package lightning lets X402 servers accept, and clients make, payments with
+// Lightning Network invoices. It has backends for the REST APIs of LND and
+// Core Lightning (CLN) that implement core.LightningBackend, to create and
+// look up the invoices servers offer in payment requests (see
+// serverx402.Config.Lightning), and core.LightningPayer, to pay them from
+// auto clients.
+//
+// Example:
+//
+//	node := lightning.NewLND("https://localhost:8080", macaroonHex, httpClient)
+//	server := serverx402.New(serverx402.Config{
+//	    // ...
+//	    Lightning:  node,
+//	    NonceStore: serverx402.NewMemoryNonceStore(0),
+//	})
+package lightning
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// defaultTimeout bounds requests to the node when no HTTP client is given.
+const defaultTimeout = 30 * time.Second
+
+// defaultHTTPClient returns httpClient, or a client with defaultTimeout.
+func defaultHTTPClient(httpClient *http.Client) *http.Client {
+	if httpClient != nil {
+		return httpClient
+	}
+	return &http.Client{Timeout: defaultTimeout}
+}
+
+// NodeError is returned when a Lightning node answers a request with an
+// error.
+type NodeError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *NodeError) Error() string {
+	return fmt.Sprintf("lightning node returned %d: %s", e.StatusCode, e.Message)
+}
+
+// call sends a JSON request to a node and decodes its JSON response into out.
+// in is sent as the body unless it is nil.
+func call(ctx context.Context, client *http.Client, method, url string, header http.Header, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		encoded, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(encoded)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return &NodeError{StatusCode: resp.StatusCode, Message: string(bytes.TrimSpace(data))}
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("invalid response from lightning node: %w", err)
+	}
+	return nil
+}
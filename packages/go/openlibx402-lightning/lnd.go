@@ -0,0 +1,148 @@
+package lightning
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/openlibx402/go/openlibx402-core"
+)
+
+// LND is a core.LightningBackend and core.LightningPayer for an LND node,
+// using its REST API.
+type LND struct {
+	url      string
+	macaroon string
+	client   *http.Client
+
+	// MaxFeeMsat caps the routing fee of payments (default: 0, the node's
+	// default limit).
+	MaxFeeMsat int64
+}
+
+var (
+	_ core.LightningBackend = (*LND)(nil)
+	_ core.LightningPayer   = (*LND)(nil)
+)
+
+// NewLND creates a backend for the LND REST API at restURL (e.g.
+// "https://localhost:8080"), authenticated with a hex-encoded macaroon: an
+// invoice macaroon suffices for servers, payers need an admin macaroon.
+// httpClient must trust the node's TLS certificate (default: a client with
+// a 30 second timeout).
+func NewLND(restURL, macaroonHex string, httpClient *http.Client) *LND {
+	return &LND{
+		url:      strings.TrimRight(restURL, "/"),
+		macaroon: macaroonHex,
+		client:   defaultHTTPClient(httpClient),
+	}
+}
+
+// call sends a request to the LND REST API.
+func (l *LND) call(ctx context.Context, method, path string, in, out interface{}) error {
+	header := http.Header{}
+	header.Set("Grpc-Metadata-macaroon", l.macaroon)
+	return call(ctx, l.client, method, l.url+path, header, in, out)
+}
+
+// lndInvoice is an invoice in LND responses; 64-bit integers are strings.
+type lndInvoice struct {
+	RHash          string `json:"r_hash"` // Base64
+	PaymentRequest string `json:"payment_request"`
+	ValueMsat      int64  `json:"value_msat,string"`
+	AmtPaidMsat    int64  `json:"amt_paid_msat,string"`
+	State          string `json:"state"`
+}
+
+// CreateInvoice implements core.LightningBackend with POST /v1/invoices.
+func (l *LND) CreateInvoice(ctx context.Context, amountMsat int64, description string, expiry time.Duration) (*core.LightningInvoice, error) {
+	in := map[string]string{
+		"value_msat": fmt.Sprint(amountMsat),
+		"memo":       description,
+		"expiry":     fmt.Sprint(int64(expiry.Seconds())),
+	}
+	var out lndInvoice
+	if err := l.call(ctx, http.MethodPost, "/v1/invoices", in, &out); err != nil {
+		return nil, err
+	}
+	hash, err := base64.StdEncoding.DecodeString(out.RHash)
+	if err != nil {
+		return nil, fmt.Errorf("invalid payment hash from LND: %w", err)
+	}
+	return &core.LightningInvoice{
+		Invoice:     out.PaymentRequest,
+		PaymentHash: hex.EncodeToString(hash),
+		AmountMsat:  amountMsat,
+	}, nil
+}
+
+// LookupInvoice implements core.LightningBackend with GET
+// /v1/invoice/{r_hash_str}.
+func (l *LND) LookupInvoice(ctx context.Context, paymentHash string) (*core.LightningInvoice, error) {
+	if _, err := hex.DecodeString(paymentHash); err != nil {
+		return nil, fmt.Errorf("invalid payment hash: %w", err)
+	}
+	var out lndInvoice
+	if err := l.call(ctx, http.MethodGet, "/v1/invoice/"+paymentHash, nil, &out); err != nil {
+		return nil, err
+	}
+	return &core.LightningInvoice{
+		Invoice:        out.PaymentRequest,
+		PaymentHash:    paymentHash,
+		AmountMsat:     out.ValueMsat,
+		Settled:        out.State == "SETTLED",
+		AmountPaidMsat: out.AmtPaidMsat,
+	}, nil
+}
+
+// PayInvoice implements core.LightningPayer: it decodes the invoice with GET
+// /v1/payreq/{pay_req} to check its amount, then pays it with POST
+// /v1/channels/transactions.
+func (l *LND) PayInvoice(ctx context.Context, invoice string, maxAmountMsat int64) (string, error) {
+	var decoded struct {
+		NumMsat int64 `json:"num_msat,string"`
+	}
+	if err := l.call(ctx, http.MethodGet, "/v1/payreq/"+url.PathEscape(invoice), nil, &decoded); err != nil {
+		return "", err
+	}
+	if err := checkAmount(decoded.NumMsat, maxAmountMsat); err != nil {
+		return "", err
+	}
+
+	in := map[string]interface{}{"payment_request": invoice}
+	if l.MaxFeeMsat > 0 {
+		in["fee_limit"] = map[string]string{"fixed_msat": fmt.Sprint(l.MaxFeeMsat)}
+	}
+	var out struct {
+		PaymentError    string `json:"payment_error"`
+		PaymentPreimage string `json:"payment_preimage"` // Base64
+	}
+	if err := l.call(ctx, http.MethodPost, "/v1/channels/transactions", in, &out); err != nil {
+		return "", err
+	}
+	if out.PaymentError != "" {
+		return "", fmt.Errorf("lightning payment failed: %s", out.PaymentError)
+	}
+	preimage, err := base64.StdEncoding.DecodeString(out.PaymentPreimage)
+	if err != nil || len(preimage) == 0 {
+		return "", fmt.Errorf("invalid payment preimage from LND")
+	}
+	return hex.EncodeToString(preimage), nil
+}
+
+// checkAmount refuses invoices without an amount, which would let the payer
+// choose it, and invoices for more than maxAmountMsat, unless it is 0.
+func checkAmount(amountMsat, maxAmountMsat int64) error {
+	if amountMsat <= 0 {
+		return fmt.Errorf("invoice has no amount")
+	}
+	if maxAmountMsat > 0 && amountMsat > maxAmountMsat {
+		return fmt.Errorf("invoice amount %d msat exceeds the maximum of %d msat", amountMsat, maxAmountMsat)
+	}
+	return nil
+}
@@ -0,0 +1,208 @@
+// Command x402-proxy puts an X402 paywall in front of an upstream HTTP service
+// or a static directory, so backends in any language can charge for requests
+// without code changes.
+//
+// Prices come from the pricing rules of a JSON or YAML config file (see
+// nethttp.PricingTable); requests matching no rule are served for free. The
+// rules are reloaded when the process receives SIGHUP.
+//
+// Usage:
+//
+//	x402-proxy -config proxy.yaml
+//
+// Example config:
+//
+//	listen: ":8080"
+//	upstream: "http://localhost:3000"   # or: static: "./public"
+//	payment_address: "YOUR_WALLET_ADDRESS"
+//	token_mint: "USDC_MINT_ADDRESS"
+//	network: "solana-devnet"
+//	rules:
+//	  - pattern: "GET /api/reports/{id}"
+//	    amount: "0.25"
+//	  - pattern: "/downloads/**"
+//	    amount: "1.00"
+//
+// Paid requests reach the upstream with the payer, amount, and transaction in
+// the X-Payment-Payer, X-Payment-Amount, and X-Payment-Transaction headers.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/openlibx402/go/openlibx402-nethttp"
+	"gopkg.in/yaml.v3"
+)
+
+// Headers carrying the verified payment to the upstream.
+const (
+	payerHeader       = "X-Payment-Payer"
+	amountHeader      = "X-Payment-Amount"
+	transactionHeader = "X-Payment-Transaction"
+)
+
+// config is the proxy config file. Pricing rules are read from the same file
+// by nethttp.PricingTable.
+type config struct {
+	Listen   string `json:"listen" yaml:"listen"`
+	Upstream string `json:"upstream" yaml:"upstream"`
+	Static   string `json:"static" yaml:"static"`
+
+	PaymentAddress string `json:"payment_address" yaml:"payment_address"`
+	TokenMint      string `json:"token_mint" yaml:"token_mint"`
+	Network        string `json:"network" yaml:"network"`
+	RPCURL         string `json:"rpc_url" yaml:"rpc_url"`
+	AutoVerify     *bool  `json:"auto_verify" yaml:"auto_verify"` // default: true
+	ExpiresIn      int    `json:"expires_in" yaml:"expires_in"`
+}
+
+func main() {
+	configPath := flag.String("config", "x402-proxy.yaml", "JSON or YAML config file")
+	listen := flag.String("listen", "", "listen address (overrides the config file)")
+	flag.Parse()
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+	if err := run(*configPath, *listen, logger); err != nil {
+		logger.Error("x402-proxy: " + err.Error())
+		os.Exit(1)
+	}
+}
+
+func run(configPath, listen string, logger *slog.Logger) error {
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		return err
+	}
+	if listen != "" {
+		cfg.Listen = listen
+	}
+
+	backend, err := newBackend(cfg)
+	if err != nil {
+		return err
+	}
+	table, err := nethttp.LoadPricingTable(configPath)
+	if err != nil {
+		return err
+	}
+	defer table.WatchSIGHUP(configPath, func(err error) {
+		logger.Error("x402-proxy: failed to reload pricing rules", "error", err)
+	})()
+
+	autoVerify := cfg.AutoVerify == nil || *cfg.AutoVerify
+	x402 := nethttp.New(&nethttp.Config{
+		PaymentAddress: cfg.PaymentAddress,
+		TokenMint:      cfg.TokenMint,
+		Network:        cfg.Network,
+		RPCURL:         cfg.RPCURL,
+		AutoVerify:     autoVerify,
+		Logger:         logger,
+	})
+	defer x402.Server().Close()
+
+	paid := x402.PricingTableMiddleware(table, nethttp.PaymentRequiredOptions{ExpiresIn: cfg.ExpiresIn})
+	server := &http.Server{
+		Addr:              cfg.Listen,
+		Handler:           paid(withPaymentHeaders(backend)),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	errs := make(chan error, 1)
+	go func() {
+		logger.Info("x402-proxy: listening", "addr", cfg.Listen, "upstream", cfg.Upstream, "static", cfg.Static)
+		errs <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	return server.Shutdown(shutdownCtx)
+}
+
+// loadConfig reads and validates the config file.
+func loadConfig(path string) (*config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+	var cfg config
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = json.Unmarshal(data, &cfg)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &cfg)
+	default:
+		return nil, fmt.Errorf("unsupported config format: %s", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+
+	switch {
+	case (cfg.Upstream == "") == (cfg.Static == ""):
+		return nil, errors.New("config must set exactly one of upstream and static")
+	case cfg.PaymentAddress == "" || cfg.TokenMint == "":
+		return nil, errors.New("config must set payment_address and token_mint")
+	}
+	if cfg.Listen == "" {
+		cfg.Listen = ":8080"
+	}
+	return &cfg, nil
+}
+
+// newBackend returns the handler serving paid and free requests: a reverse
+// proxy to the upstream or a file server for the static directory.
+func newBackend(cfg *config) (http.Handler, error) {
+	if cfg.Static != "" {
+		info, err := os.Stat(cfg.Static)
+		if err != nil {
+			return nil, fmt.Errorf("invalid static directory: %w", err)
+		}
+		if !info.IsDir() {
+			return nil, fmt.Errorf("invalid static directory: %s is not a directory", cfg.Static)
+		}
+		return http.FileServer(http.Dir(cfg.Static)), nil
+	}
+
+	upstream, err := url.Parse(cfg.Upstream)
+	if err != nil || upstream.Scheme == "" || upstream.Host == "" {
+		return nil, fmt.Errorf("invalid upstream URL %q", cfg.Upstream)
+	}
+	return httputil.NewSingleHostReverseProxy(upstream), nil
+}
+
+// withPaymentHeaders passes the verified payment to the backend in headers,
+// removing any the client sent so they cannot be spoofed.
+func withPaymentHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Header.Del(payerHeader)
+		r.Header.Del(amountHeader)
+		r.Header.Del(transactionHeader)
+		if auth := nethttp.GetPaymentAuthorization(r); auth != nil {
+			r.Header.Set(payerHeader, auth.PublicKey)
+			r.Header.Set(amountHeader, auth.ActualAmount)
+			r.Header.Set(transactionHeader, auth.TransactionHash)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
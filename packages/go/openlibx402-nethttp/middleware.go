@@ -2,49 +2,122 @@
 package nethttp
 
 import (
+	"bufio"
 	"context"
-	"crypto/rand"
-	"encoding/hex"
-	"encoding/json"
-	"fmt"
+	"errors"
+	"io"
+	"net"
 	"net/http"
 	"strconv"
-	"time"
 
 	"github.com/openlibx402/go/openlibx402-core"
+	"github.com/openlibx402/go/openlibx402-server"
 )
 
 // Config holds global configuration for X402 middleware.
-type Config struct {
-	PaymentAddress string
-	TokenMint      string
-	Network        string
-	RPCURL         string
-	AutoVerify     bool
+type Config = serverx402.Config
+
+// ConfigFromEnv reads a Config from X402_* environment variables (see
+// serverx402.ConfigFromEnv).
+func ConfigFromEnv() (*Config, error) {
+	return serverx402.ConfigFromEnv()
+}
+
+// ConfigFromFile reads a Config from a JSON, YAML, or TOML file (see
+// serverx402.ConfigFromFile).
+func ConfigFromFile(path string) (*Config, error) {
+	return serverx402.ConfigFromFile(path)
 }
 
-var globalConfig *Config
+// PriceOverride adjusts the price of an endpoint for a specific payer.
+type PriceOverride = serverx402.PriceOverride
+
+var globalServer *serverx402.Server
 
-// InitX402 initializes the global X402 configuration.
+// InitX402 initializes the global X402 configuration. It fails, leaving the
+// middleware uninitialized, if the configuration is invalid (see
+// Config.Validate).
 //
 // This should be called once at application startup before using the PaymentRequired middleware.
 //
 // Example:
 //
-//	nethttp.InitX402(&nethttp.Config{
+//	if err := nethttp.InitX402(&nethttp.Config{
 //	    PaymentAddress: "YOUR_WALLET_ADDRESS",
 //	    TokenMint:      "USDC_MINT_ADDRESS",
 //	    Network:        "solana-devnet",
 //	    AutoVerify:     true,
-//	})
-func InitX402(config *Config) {
-	if config.Network == "" {
-		config.Network = "solana-devnet"
+//	}); err != nil {
+//	    log.Fatal(err)
+//	}
+func InitX402(config *Config) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	globalServer = serverx402.New(config)
+	return nil
+}
+
+// Reload atomically replaces the payment address and token mint configured
+// with InitX402 at runtime (see serverx402.Server.Reload).
+func Reload(config *Config) error {
+	if globalServer == nil {
+		return errors.New("X402 not initialized. Call InitX402() first.")
 	}
-	if config.RPCURL == "" {
-		config.RPCURL = core.GetDefaultRPCURL(config.Network)
+	return globalServer.Reload(config)
+}
+
+// Shutdown gracefully stops the server configured with InitX402: it waits
+// for pending settlements, delivers queued webhooks, and persists in-memory
+// stores (see serverx402.Server.Shutdown).
+func Shutdown(ctx context.Context) error {
+	if globalServer == nil {
+		return nil
 	}
-	globalConfig = config
+	return globalServer.Shutdown(ctx)
+}
+
+// X402 is a middleware instance bound to its own configuration.
+//
+// Unlike InitX402, which configures the package-level middleware, several
+// instances can coexist in one process (e.g., two wallets or networks).
+//
+// Example:
+//
+//	mainnet := nethttp.New(&nethttp.Config{
+//	    PaymentAddress: "MAINNET_WALLET_ADDRESS",
+//	    TokenMint:      "USDC_MINT_ADDRESS",
+//	    Network:        "solana-mainnet",
+//	})
+//	http.Handle("/premium", mainnet.PaymentRequired(nethttp.PaymentRequiredOptions{Amount: "0.10"})(handler))
+type X402 struct {
+	server *serverx402.Server
+}
+
+// New creates a middleware instance with its own configuration.
+func New(config *Config) *X402 {
+	return &X402{server: serverx402.New(config)}
+}
+
+// Config returns the instance configuration.
+func (x *X402) Config() *Config {
+	return x.server.Config()
+}
+
+// Server returns the shared server core backing the instance.
+func (x *X402) Server() *serverx402.Server {
+	return x.server
+}
+
+// Reload atomically replaces the payment address and token mint of the
+// instance at runtime (see serverx402.Server.Reload).
+func (x *X402) Reload(config *Config) error {
+	return x.server.Reload(config)
+}
+
+// Shutdown gracefully stops the instance (see serverx402.Server.Shutdown).
+func (x *X402) Shutdown(ctx context.Context) error {
+	return x.server.Shutdown(ctx)
 }
 
 // PaymentRequiredOptions configures payment requirements for a specific endpoint.
@@ -56,6 +129,95 @@ type PaymentRequiredOptions struct {
 	Description    string // Human-readable description
 	ExpiresIn      int    // Expiration time in seconds (default: 300)
 	AutoVerify     bool   // Auto-verify payment on-chain (default: true)
+
+	// PriceFunc optionally computes the amount and description per request,
+	// overriding Amount and Description. It may inspect path, query, or body;
+	// if it reads r.Body it must restore it for the wrapped handler.
+	PriceFunc func(r *http.Request) (amount string, description string, err error)
+
+	// Authorize optionally applies a per-payer policy. It is called with the payer's
+	// public key (from the authorization header, or the X-Payer-Public-Key header on
+	// the initial request) and may grant free access, apply a discount, or return an
+	// error to block the payer. Public keys are self-declared by the client, so free
+	// access should only be granted to payers authenticated by other means.
+	Authorize func(pubkey string) (PriceOverride, error)
+
+	// VolumePricing optionally prices by the payer's volume of verified
+	// payments, counted in Config.Store, e.g. cheaper calls after the first
+	// 100. The payer's tier is quoted if the request declares the payer in the
+	// X-Payer-Public-Key header.
+	VolumePricing *serverx402.VolumePricing
+
+	// RangePricing optionally prices a file by the bytes the request's Range
+	// header asks for, e.g. 0.01 per started 10 MiB, replacing Amount.
+	// Serve the file with http.ServeContent, or another handler that honors
+	// Range and If-Range the same way.
+	RangePricing *serverx402.RangePricing
+
+	// FiatAmount optionally sets the price in fiat, e.g. "0.10" USD, which is
+	// converted to a token amount with Config.PriceOracle when the payment
+	// request is issued. It replaces Amount. Currency overrides
+	// Config.Currency.
+	FiatAmount string
+	Currency   string
+
+	// AcceptedTokens optionally accepts other tokens besides TokenMint, each
+	// at its own price, e.g. USDT and BONK next to USDC. The 402 response
+	// lists them, and payments in any of them are accepted.
+	AcceptedTokens []core.TokenPrice
+
+	// Splits optionally pays percentages of the price to other recipients,
+	// e.g. 80% to a creator; PaymentAddress receives the rest.
+	Splits []core.PaymentSplit
+
+	// Escrow optionally asks payers to deposit the payment into an escrow
+	// program and release it once the response is delivered. Requires a
+	// Config.Processor implementing core.EscrowProcessor.
+	Escrow bool
+
+	// ChannelDeposit optionally offers a payment channel: a payment of this
+	// deposit opens a channel that pays later requests with signed vouchers
+	// instead of on-chain transactions. Requires Config.AutoVerify and
+	// Config.RefundProcessor.
+	ChannelDeposit string
+
+	// MaxOutstanding optionally lets payers charge requests to a tab with
+	// signed vouchers and settle it in one payment, capping the unsettled
+	// balance at this amount. Requires Config.AutoVerify.
+	MaxOutstanding string
+
+	// LightningSats optionally offers paying this many satoshis with a
+	// Lightning invoice instead. Requires Config.Lightning and
+	// Config.NonceStore.
+	LightningSats int64
+
+	// Plans optionally offers subscription plans in the 402 response, which
+	// grant access without paying per request until they expire. Requires a
+	// Config.Store implementing serverx402.SubscriptionStore.
+	Plans []core.SubscriptionPlan
+
+	// RequestsIncluded optionally lets a verified payment grant that many
+	// further requests to the endpoint. The paid response returns a quota
+	// token in the X-Payment-Quota header to send with them, and responses
+	// report the requests left in X-Payment-Quota-Remaining.
+	RequestsIncluded int
+
+	// RefundOnError refunds the payment in full when the wrapped handler responds
+	// with a 5xx status, reporting the refund transaction hash in the
+	// X-Payment-Refund header. Requires Config.RefundProcessor.
+	RefundOnError bool
+
+	// Capture makes Amount a hold for variable-cost endpoints: the handler
+	// calls Capture with the actual cost once it is known, and the rest is
+	// refunded. Requires Config.AutoVerify without AsyncSettlement, and
+	// Config.RefundProcessor.
+	Capture bool
+
+	// UnitPricing optionally prices the request by the units it consumes,
+	// such as output tokens: the payment holds MaxUnits, the handler reports
+	// the units it used with ReportUnits, and their price is captured once
+	// it returns. Requires the same configuration as Capture.
+	UnitPricing *serverx402.UnitPricing
 }
 
 // PaymentRequired returns middleware that requires payment for the wrapped handler.
@@ -67,121 +229,121 @@ type PaymentRequiredOptions struct {
 //	    Description: "Premium market data",
 //	})(premiumDataHandler))
 func PaymentRequired(opts PaymentRequiredOptions) func(http.Handler) http.Handler {
+	return paymentRequired(func() *serverx402.Server { return globalServer }, opts)
+}
+
+// PaymentRequired returns middleware that requires payment using the instance configuration.
+func (x *X402) PaymentRequired(opts PaymentRequiredOptions) func(http.Handler) http.Handler {
+	return paymentRequired(func() *serverx402.Server { return x.server }, opts)
+}
+
+// paymentRequired builds the payment middleware for the server returned by getServer.
+func paymentRequired(getServer func() *serverx402.Server, opts PaymentRequiredOptions) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// Get configuration
-			config := globalConfig
-			if config == nil {
+			server := getServer()
+			if server == nil {
 				http.Error(w, "X402 not initialized. Call InitX402() first.", http.StatusInternalServerError)
 				return
 			}
 
-			// Determine parameters (use provided values or config)
-			paymentAddress := opts.PaymentAddress
-			if paymentAddress == "" {
-				paymentAddress = config.PaymentAddress
-			}
-
-			tokenMint := opts.TokenMint
-			if tokenMint == "" {
-				tokenMint = config.TokenMint
+			// Determine price (dynamic pricing takes precedence)
+			amount := opts.Amount
+			description := opts.Description
+			if opts.PriceFunc != nil {
+				var err error
+				amount, description, err = opts.PriceFunc(r)
+				if err != nil {
+					respond(w, r, server, server.PriceError(r.URL.Path, err))
+					return
+				}
 			}
 
-			network := opts.Network
-			if network == "" {
-				network = config.Network
+			result := server.Process(serverx402.Request{
+				Context:  r.Context(),
+				Resource: r.URL.Path,
+				Header:   r.Header.Get,
+				ClientIP: serverx402.RemoteIP(r.RemoteAddr),
+
+				Deferrable: true,
+			}, serverx402.Options{
+				Amount:         amount,
+				PaymentAddress: opts.PaymentAddress,
+				TokenMint:      opts.TokenMint,
+				Network:        opts.Network,
+				Description:    description,
+				ExpiresIn:      opts.ExpiresIn,
+				Authorize:      opts.Authorize,
+				VolumePricing:  opts.VolumePricing,
+				RangePricing:   opts.RangePricing,
+				Capture:        opts.Capture,
+				UnitPricing:    opts.UnitPricing,
+				FiatAmount:     opts.FiatAmount,
+				Currency:       opts.Currency,
+				AcceptedTokens: opts.AcceptedTokens,
+				Splits:         opts.Splits,
+				Escrow:         opts.Escrow,
+				ChannelDeposit: opts.ChannelDeposit,
+				MaxOutstanding: opts.MaxOutstanding,
+				LightningSats:  opts.LightningSats,
+				Plans:          opts.Plans,
+
+				RequestsIncluded: opts.RequestsIncluded,
+			})
+			if !result.Allowed() {
+				respond(w, r, server, result)
+				return
 			}
 
-			autoVerify := config.AutoVerify
-			if opts.ExpiresIn == 0 {
-				opts.ExpiresIn = 300
+			if result.SessionToken != "" {
+				w.Header().Set(server.Config().SessionHeader, result.SessionToken)
 			}
-
-			if paymentAddress == "" || tokenMint == "" {
-				http.Error(w, "paymentAddress and tokenMint must be configured", http.StatusInternalServerError)
-				return
+			if result.SubscriptionToken != "" {
+				w.Header().Set(server.Config().SubscriptionHeader, result.SubscriptionToken)
 			}
-
-			// Check for payment authorization header
-			authHeader := r.Header.Get("X-Payment-Authorization")
-
-			if authHeader == "" {
-				// No payment provided, return 402
-				build402Response(w, r, payment402Options{
-					Amount:         opts.Amount,
-					PaymentAddress: paymentAddress,
-					TokenMint:      tokenMint,
-					Network:        network,
-					Resource:       r.URL.Path,
-					Description:    opts.Description,
-					ExpiresIn:      opts.ExpiresIn,
-				})
-				return
+			if result.QuotaToken != "" {
+				w.Header().Set(server.Config().QuotaHeader, result.QuotaToken)
+				w.Header().Set(server.Config().QuotaRemainingHeader, strconv.Itoa(result.QuotaRemaining))
 			}
-
-			// Payment authorization provided, verify it
-			authorization, err := core.PaymentAuthorizationFromHeader(authHeader)
-			if err != nil {
-				http.Error(w, fmt.Sprintf("Invalid payment authorization: %s", err.Error()), http.StatusBadRequest)
-				return
+			if result.ChannelID != "" {
+				w.Header().Set(server.Config().ChannelHeader, result.ChannelID)
+				w.Header().Set(server.Config().ChannelBalanceHeader, result.ChannelBalance)
 			}
-
-			// Verify payment amount is sufficient
-			requiredAmount, _ := strconv.ParseFloat(opts.Amount, 64)
-			actualAmount, _ := strconv.ParseFloat(authorization.ActualAmount, 64)
-			if actualAmount < requiredAmount {
-				respondJSON(w, http.StatusForbidden, map[string]interface{}{
-					"error":    "Insufficient payment",
-					"required": opts.Amount,
-					"provided": authorization.ActualAmount,
-				})
-				return
+			if result.TabOutstanding != "" {
+				w.Header().Set(server.Config().TabHeader, result.TabOutstanding)
 			}
-
-			// Verify payment addresses match
-			if authorization.PaymentAddress != paymentAddress {
-				respondJSON(w, http.StatusForbidden, map[string]interface{}{
-					"error":    "Payment address mismatch",
-					"expected": paymentAddress,
-					"provided": authorization.PaymentAddress,
-				})
-				return
+			if result.Deferred != nil {
+				deferred, _ := result.Deferred.ToHeaderValue()
+				w.Header().Set(server.Config().DeferredHeader, deferred)
 			}
 
-			// Verify token mint matches
-			if authorization.AssetAddress != tokenMint {
-				respondJSON(w, http.StatusForbidden, map[string]interface{}{
-					"error":    "Token mint mismatch",
-					"expected": tokenMint,
-					"provided": authorization.AssetAddress,
-				})
-				return
+			// Payment verified, attach to request context and continue
+			ctx := r.Context()
+			if result.Payer != "" {
+				ctx = context.WithValue(ctx, payerKey, result.Payer)
 			}
-
-			// Verify on-chain if auto_verify is enabled
-			if autoVerify && authorization.TransactionHash != "" {
-				processor := core.NewSolanaPaymentProcessor(config.RPCURL, nil)
-				defer processor.Close()
-
-				verified, err := processor.VerifyTransaction(
-					r.Context(),
-					authorization.TransactionHash,
-					paymentAddress,
-					authorization.ActualAmount,
-					tokenMint,
-				)
-
-				if err != nil || !verified {
-					respondJSON(w, http.StatusForbidden, map[string]interface{}{
-						"error":   "Payment verification failed",
-						"message": err.Error(),
-					})
+			if result.Authorization != nil {
+				var writer *refundWriter
+				if opts.RefundOnError || opts.Capture || opts.UnitPricing != nil {
+					writer = &refundWriter{ResponseWriter: w, ctx: ctx, server: server, result: result, refundOnError: opts.RefundOnError}
+					w = writer
+				}
+				ctx = context.WithValue(ctx, paymentAuthKey, authorization{server, result, writer})
+				if opts.UnitPricing != nil && result.Requirement.Units != nil {
+					// The units are only known once the response was written
+					w.Header().Add("Trailer", serverx402.CapturedHeader)
+					w.Header().Add("Trailer", serverx402.RefundHeader)
+					next.ServeHTTP(w, r.WithContext(ctx))
+					if result.Captured == "" {
+						// Refund failures are logged by the server
+						refund, err := server.CaptureUnits(ctx, result)
+						if err == nil {
+							writer.reportCapture(refund)
+						}
+					}
 					return
 				}
 			}
-
-			// Payment verified, attach to request context and continue
-			ctx := context.WithValue(r.Context(), paymentAuthKey, authorization)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
@@ -190,67 +352,243 @@ func PaymentRequired(opts PaymentRequiredOptions) func(http.Handler) http.Handle
 // paymentAuthKey is the context key for PaymentAuthorization.
 type contextKey string
 
-const paymentAuthKey contextKey = "payment_authorization"
+const (
+	paymentAuthKey contextKey = "payment_authorization"
+	payerKey       contextKey = "payer"
+	pricingRuleKey contextKey = "pricing_rule"
+)
+
+// authorization is the verified payment attached to the request context.
+type authorization struct {
+	server *serverx402.Server
+	result *serverx402.Result
+	writer *refundWriter // Set with RefundOnError or Capture
+}
 
 // GetPaymentAuthorization retrieves the PaymentAuthorization from the request context.
 //
 // This is useful if you want to access payment details in your handler.
 func GetPaymentAuthorization(r *http.Request) *core.PaymentAuthorization {
-	if auth, ok := r.Context().Value(paymentAuthKey).(*core.PaymentAuthorization); ok {
-		return auth
+	if auth, ok := r.Context().Value(paymentAuthKey).(authorization); ok {
+		return auth.result.Authorization
+	}
+	return nil
+}
+
+// Capture charges amount of the held payment of a request to an endpoint
+// with Capture set, refunding the rest of the hold to the payer (see
+// serverx402.Server.Capture). Handlers call it once the cost is known:
+// before writing the response, the amount captured and the refund
+// transaction hash are sent in the X-Payment-Captured and X-Payment-Refund
+// headers; after, as trailers.
+//
+// Usage:
+//
+//	http.Handle("/api/complete", nethttp.PaymentRequired(nethttp.PaymentRequiredOptions{
+//	    Amount:  "0.50", // Hold
+//	    Capture: true,
+//	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+//	    completion, tokens := complete(r)
+//	    if err := nethttp.Capture(r, fmt.Sprintf("%.6f", float64(tokens)*0.00002)); err != nil {
+//	        log.Printf("capture failed: %v", err)
+//	    }
+//	    json.NewEncoder(w).Encode(completion)
+//	})))
+func Capture(r *http.Request, amount string) error {
+	auth, ok := r.Context().Value(paymentAuthKey).(authorization)
+	if !ok || auth.writer == nil {
+		return serverx402.ErrNotHeld
 	}
+	refund, err := auth.server.Capture(r.Context(), auth.result, amount)
+	if err != nil {
+		return err
+	}
+	auth.writer.reportCapture(refund)
 	return nil
 }
 
-// payment402Options contains options for building a 402 response.
-type payment402Options struct {
-	Amount         string
-	PaymentAddress string
-	TokenMint      string
-	Network        string
-	Resource       string
-	Description    string
-	ExpiresIn      int
-}
-
-// build402Response builds and sends a 402 Payment Required response.
-func build402Response(w http.ResponseWriter, r *http.Request, opts payment402Options) {
-	// Generate unique payment ID and nonce
-	paymentID := generateID()
-	nonce := generateID()
-
-	// Calculate expiration
-	expiresAt := time.Now().UTC().Add(time.Duration(opts.ExpiresIn) * time.Second)
-
-	// Create payment request
-	paymentReq := &core.PaymentRequest{
-		MaxAmountRequired: opts.Amount,
-		AssetType:         "SPL",
-		AssetAddress:      opts.TokenMint,
-		PaymentAddress:    opts.PaymentAddress,
-		Network:           opts.Network,
-		ExpiresAt:         expiresAt,
-		Nonce:             nonce,
-		PaymentID:         paymentID,
-		Resource:          opts.Resource,
-		Description:       opts.Description,
+// ReportUnits records n units consumed by a request to an endpoint with
+// UnitPricing, such as output tokens; it may be called repeatedly, e.g.
+// while streaming. PaymentRequired captures the price of the units once
+// the handler returns, reporting it in the X-Payment-Captured trailer.
+//
+// Usage:
+//
+//	http.Handle("/api/complete", nethttp.PaymentRequired(nethttp.PaymentRequiredOptions{
+//	    UnitPricing: &serverx402.UnitPricing{PricePerUnit: "0.00002", MaxUnits: 4096, Unit: "token"},
+//	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+//	    completion := complete(r)
+//	    nethttp.ReportUnits(r, int64(completion.OutputTokens))
+//	    json.NewEncoder(w).Encode(completion)
+//	})))
+func ReportUnits(r *http.Request, n int64) {
+	if auth, ok := r.Context().Value(paymentAuthKey).(authorization); ok {
+		auth.result.AddUnits(n)
+	}
+}
+
+// PayerID returns the public key of the verified payer of the request, set
+// by PaymentRequired when the request proceeds on a payment, or a session,
+// subscription, quota token, or voucher of one (see
+// serverx402.Result.Payer). It returns "" for free access.
+//
+// Middlewares after PaymentRequired can key on it, e.g. to rate limit or
+// log per paying wallet.
+func PayerID(r *http.Request) string {
+	payer, _ := r.Context().Value(payerKey).(string)
+	return payer
+}
+
+// KeyByPayer returns a request key function for middlewares such as rate
+// limiters: it returns the PayerID of requests with a verified payer, and
+// fallback(r) otherwise, e.g. the client IP. Payer keys are prefixed with
+// "payer:" so that they cannot collide with fallback keys.
+func KeyByPayer(fallback func(r *http.Request) string) func(r *http.Request) string {
+	return func(r *http.Request) string {
+		if payer := PayerID(r); payer != "" {
+			return "payer:" + payer
+		}
+		if fallback == nil {
+			return ""
+		}
+		return fallback(r)
+	}
+}
+
+// Chain composes middlewares into one, applied in the order given, so that
+// the first sees the request first. Middlewares keying on PayerID go after
+// PaymentRequired:
+//
+//	paid := nethttp.Chain(
+//	    nethttp.PaymentRequired(nethttp.PaymentRequiredOptions{Amount: "0.01"}),
+//	    perPayerLogger,
+//	)
+//	http.Handle("/api/data", paid(handler))
+func Chain(middlewares ...func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		for i := len(middlewares) - 1; i >= 0; i-- {
+			next = middlewares[i](next)
+		}
+		return next
+	}
+}
+
+// refundWriter refunds the payment before a 5xx response is written, with
+// RefundOnError, and tracks whether the header was written for Capture. It
+// keeps the optional interfaces of the ResponseWriter streaming handlers use.
+type refundWriter struct {
+	http.ResponseWriter
+	ctx           context.Context
+	server        *serverx402.Server
+	result        *serverx402.Result
+	refundOnError bool
+	wroteHeader   bool
+}
+
+var (
+	_ http.Flusher  = (*refundWriter)(nil)
+	_ http.Hijacker = (*refundWriter)(nil)
+	_ io.ReaderFrom = (*refundWriter)(nil)
+)
+
+func (w *refundWriter) WriteHeader(statusCode int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		if w.refundOnError {
+			if refund := w.server.RefundOnError(w.ctx, w.result, statusCode); refund != nil {
+				w.Header().Set(serverx402.RefundHeader, refund.TransactionHash)
+			}
+		}
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *refundWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush implements http.Flusher for streaming handlers, such as server-sent
+// events, writing the header first.
+func (w *refundWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker for WebSocket upgrades. A hijacked
+// connection is not refunded.
+func (w *refundWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
 	}
+	w.wroteHeader = true
+	return hijacker.Hijack()
+}
+
+// ReadFrom implements io.ReaderFrom, so that io.Copy keeps using the
+// underlying writer's ReadFrom, e.g. sendfile for files.
+func (w *refundWriter) ReadFrom(r io.Reader) (int64, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if readerFrom, ok := w.ResponseWriter.(io.ReaderFrom); ok {
+		return readerFrom.ReadFrom(r)
+	}
+	return io.Copy(writerOnly{w.ResponseWriter}, r)
+}
+
+// reportCapture sets the amount captured of the payment and the
+// transaction hash of the refund, if any, as headers, or as trailers if the
+// header was written.
+func (w *refundWriter) reportCapture(refund *core.Refund) {
+	header, prefix := w.Header(), ""
+	if w.wroteHeader {
+		prefix = http.TrailerPrefix
+	}
+	header.Set(prefix+serverx402.CapturedHeader, w.result.Captured)
+	if refund != nil {
+		header.Set(prefix+serverx402.RefundHeader, refund.TransactionHash)
+	}
+}
 
-	respondJSON(w, http.StatusPaymentRequired, paymentReq)
+// Unwrap returns the underlying ResponseWriter for http.ResponseController.
+func (w *refundWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
 }
 
-// respondJSON sends a JSON response.
-func respondJSON(w http.ResponseWriter, statusCode int, data interface{}) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(statusCode)
-	json.NewEncoder(w).Encode(data)
+// writerOnly hides the methods of a writer other than Write, so that io.Copy
+// does not call its ReadFrom.
+type writerOnly struct {
+	io.Writer
 }
 
-// generateID generates a random hexadecimal ID.
-func generateID() string {
-	bytes := make([]byte, 16)
-	rand.Read(bytes)
-	return hex.EncodeToString(bytes)
+// respond sends the response for a result that is not allowed, in the format
+// the Accept header asks for.
+func respond(w http.ResponseWriter, r *http.Request, server *serverx402.Server, result *serverx402.Result) {
+	if result.Status == http.StatusNoContent {
+		// A deferred payment was settled
+		w.WriteHeader(result.Status)
+		return
+	}
+	status, contentType, body, err := server.HTTPResponse(r, result)
+	if err != nil {
+		http.Error(w, "Failed to render response: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Add("Vary", "Accept")
+	if retryAfter := result.RetryAfterHeader(); retryAfter != "" {
+		w.Header().Set("Retry-After", retryAfter)
+	}
+	w.WriteHeader(status)
+	w.Write(body)
 }
 
 // PaymentRequiredFunc is a wrapper that converts a HandlerFunc to use PaymentRequired middleware.
@@ -267,3 +605,8 @@ func PaymentRequiredFunc(opts PaymentRequiredOptions, handler http.HandlerFunc)
 	wrappedHandler := middleware(handler)
 	return wrappedHandler.ServeHTTP
 }
+
+// PaymentRequiredFunc wraps a HandlerFunc with PaymentRequired middleware using the instance configuration.
+func (x *X402) PaymentRequiredFunc(opts PaymentRequiredOptions, handler http.HandlerFunc) http.HandlerFunc {
+	return x.PaymentRequired(opts)(handler).ServeHTTP
+}
@@ -0,0 +1,66 @@
+package nethttp
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/openlibx402/go/openlibx402-core"
+)
+
+func TestNewRejectsRequestsWithInvalidConfig(t *testing.T) {
+	// Asynchronous settlement without attestations is refused by Validate
+	x402 := New(&Config{
+		PaymentAddress:  solana.NewWallet().PublicKey().String(),
+		TokenMint:       solana.NewWallet().PublicKey().String(),
+		Processor:       core.NewMockProcessor(),
+		AutoVerify:      true,
+		AsyncSettlement: true,
+	})
+	defer x402.Server().Close()
+	handler := x402.PaymentRequired(PaymentRequiredOptions{Amount: "0.10"})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "data")
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/data", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("got %d, want 500", rec.Code)
+	}
+}
+
+func TestPriceFuncErrorIsNotSent(t *testing.T) {
+	x402 := New(&Config{
+		PaymentAddress: solana.NewWallet().PublicKey().String(),
+		TokenMint:      solana.NewWallet().PublicKey().String(),
+		Processor:      core.NewMockProcessor(),
+	})
+	defer x402.Server().Close()
+	handler := x402.PaymentRequired(PaymentRequiredOptions{
+		PriceFunc: func(r *http.Request) (string, string, error) {
+			return "", "", errors.New("pricing database at 10.0.0.7 unreachable")
+		},
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "data")
+	}))
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/data", nil)
+	req.Header.Set("Accept", "application/problem+json")
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("got %d, want 400", rec.Code)
+	}
+	var problem map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &problem); err != nil {
+		t.Fatalf("body %q: %v", rec.Body, err)
+	}
+	if problem["code"] != "INVALID_PAYMENT_REQUEST" || strings.Contains(rec.Body.String(), "10.0.0.7") {
+		t.Errorf("got %s, want INVALID_PAYMENT_REQUEST without the pricing error", rec.Body)
+	}
+}
@@ -0,0 +1,284 @@
+package nethttp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+
+	"gopkg.in/yaml.v3"
+)
+
+// PricingRule maps a URL pattern to a price.
+//
+// Patterns have the form "[METHOD ]/path", where path segments may be literal,
+// "*" or "{name}" to match exactly one segment, or a final "**" or "{name...}"
+// to match any remaining segments. As with http.ServeMux, a GET pattern also
+// matches HEAD requests, so they cannot fetch a paid resource's headers for
+// free. Examples:
+//
+//	"GET /api/reports/{id}"
+//	"/api/files/**"
+//	"POST /api/*/process"
+type PricingRule struct {
+	Pattern     string `json:"pattern" yaml:"pattern"`
+	Amount      string `json:"amount" yaml:"amount"`
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+}
+
+// pricingTableFile is the on-disk format of a pricing table.
+type pricingTableFile struct {
+	Rules []PricingRule `json:"rules" yaml:"rules"`
+}
+
+// compiledRule is a parsed PricingRule ready for matching.
+type compiledRule struct {
+	rule     PricingRule
+	method   string
+	segments []string
+	prefix   bool
+}
+
+// PricingTable maps URL patterns to prices and can be used as a single middleware
+// in front of a ServeMux or gorilla/mux router instead of wrapping each handler.
+//
+// Rules are evaluated in order and the first match wins. Requests that match no
+// rule are passed through without payment. The table is safe for concurrent use
+// and can be reloaded at runtime.
+type PricingTable struct {
+	mu    sync.RWMutex
+	rules []compiledRule
+}
+
+// NewPricingTable creates a PricingTable from a list of rules.
+func NewPricingTable(rules []PricingRule) (*PricingTable, error) {
+	t := &PricingTable{}
+	if err := t.SetRules(rules); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// LoadPricingTable creates a PricingTable from a JSON or YAML file.
+//
+// The file format is:
+//
+//	rules:
+//	  - pattern: "GET /api/premium/**"
+//	    amount: "0.10"
+//	    description: "Premium API"
+func LoadPricingTable(path string) (*PricingTable, error) {
+	t := &PricingTable{}
+	if err := t.Load(path); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Load replaces the table's rules with those read from a JSON or YAML file.
+//
+// The file type is determined by its extension (.json, .yaml, .yml).
+func (t *PricingTable) Load(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read pricing table: %w", err)
+	}
+
+	var file pricingTableFile
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = json.Unmarshal(data, &file)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &file)
+	default:
+		return fmt.Errorf("unsupported pricing table format: %s", path)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse pricing table: %w", err)
+	}
+
+	return t.SetRules(file.Rules)
+}
+
+// SetRules atomically replaces the table's rules.
+func (t *PricingTable) SetRules(rules []PricingRule) error {
+	compiled := make([]compiledRule, 0, len(rules))
+	for _, rule := range rules {
+		c, err := compileRule(rule)
+		if err != nil {
+			return err
+		}
+		compiled = append(compiled, c)
+	}
+
+	t.mu.Lock()
+	t.rules = compiled
+	t.mu.Unlock()
+	return nil
+}
+
+// Match returns the first rule matching the request.
+func (t *PricingTable) Match(r *http.Request) (PricingRule, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	path := splitPath(r.URL.Path)
+	for _, c := range t.rules {
+		if c.matches(r.Method, path) {
+			return c.rule, true
+		}
+	}
+	return PricingRule{}, false
+}
+
+// Middleware returns middleware that requires payment for requests matching a rule.
+//
+// The amount and description come from the matched rule; all other options
+// (address overrides, expiry, Authorize hook) are taken from opts.
+//
+// Usage:
+//
+//	table, err := nethttp.LoadPricingTable("pricing.yaml")
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	http.ListenAndServe(":8080", table.Middleware(nethttp.PaymentRequiredOptions{})(mux))
+func (t *PricingTable) Middleware(opts PaymentRequiredOptions) func(http.Handler) http.Handler {
+	return t.middleware(PaymentRequired, opts)
+}
+
+// PricingTableMiddleware returns middleware that prices requests with t using the instance configuration.
+func (x *X402) PricingTableMiddleware(t *PricingTable, opts PaymentRequiredOptions) func(http.Handler) http.Handler {
+	return t.middleware(x.PaymentRequired, opts)
+}
+
+// middleware builds the pricing table middleware on top of a PaymentRequired constructor.
+//
+// Each request is matched once: the matched rule is passed to PriceFunc in the
+// request context, so that a reload between the two cannot price the request
+// with a rule it did not match.
+func (t *PricingTable) middleware(
+	newPaymentRequired func(PaymentRequiredOptions) func(http.Handler) http.Handler,
+	opts PaymentRequiredOptions,
+) func(http.Handler) http.Handler {
+	opts.PriceFunc = func(r *http.Request) (string, string, error) {
+		rule, ok := r.Context().Value(pricingRuleKey).(PricingRule)
+		if !ok {
+			return "", "", fmt.Errorf("no pricing rule matches %s %s", r.Method, r.URL.Path)
+		}
+		return rule.Amount, rule.Description, nil
+	}
+	paymentRequired := newPaymentRequired(opts)
+
+	return func(next http.Handler) http.Handler {
+		paid := paymentRequired(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rule, ok := t.Match(r)
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+			paid.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), pricingRuleKey, rule)))
+		})
+	}
+}
+
+// WatchSIGHUP reloads the table from path whenever the process receives SIGHUP.
+//
+// Reload errors are passed to onError (if non-nil) and the previous rules are kept.
+// Call the returned function to stop watching.
+func (t *PricingTable) WatchSIGHUP(path string, onError func(error)) (stop func()) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-signals:
+				if err := t.Load(path); err != nil && onError != nil {
+					onError(err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(signals)
+			close(done)
+		})
+	}
+}
+
+// compileRule parses a rule pattern.
+func compileRule(rule PricingRule) (compiledRule, error) {
+	pattern := strings.TrimSpace(rule.Pattern)
+	c := compiledRule{rule: rule}
+
+	if method, path, ok := strings.Cut(pattern, " "); ok {
+		c.method = strings.ToUpper(method)
+		pattern = strings.TrimSpace(path)
+	}
+
+	if !strings.HasPrefix(pattern, "/") {
+		return compiledRule{}, fmt.Errorf("invalid pricing pattern %q: path must start with /", rule.Pattern)
+	}
+	if rule.Amount == "" {
+		return compiledRule{}, fmt.Errorf("invalid pricing rule %q: amount is required", rule.Pattern)
+	}
+
+	segments := splitPath(pattern)
+	for i, seg := range segments {
+		if seg == "**" || (strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "...}")) {
+			if i != len(segments)-1 {
+				return compiledRule{}, fmt.Errorf("invalid pricing pattern %q: %s must be the last segment", rule.Pattern, seg)
+			}
+			c.prefix = true
+			segments = segments[:i]
+			break
+		}
+	}
+	c.segments = segments
+	return c, nil
+}
+
+// matches reports whether the rule matches the method and path segments.
+// GET rules match HEAD requests too.
+func (c compiledRule) matches(method string, path []string) bool {
+	if c.method != "" && c.method != method && !(c.method == http.MethodGet && method == http.MethodHead) {
+		return false
+	}
+	if len(path) < len(c.segments) || (!c.prefix && len(path) != len(c.segments)) {
+		return false
+	}
+	for i, seg := range c.segments {
+		if seg == "*" || (strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}")) {
+			continue
+		}
+		if seg != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// splitPath splits a URL path into its non-empty segments.
+func splitPath(path string) []string {
+	var segments []string
+	for _, seg := range strings.Split(path, "/") {
+		if seg != "" {
+			segments = append(segments, seg)
+		}
+	}
+	return segments
+}
@@ -0,0 +1,85 @@
+package nethttp
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/openlibx402/go/openlibx402-core"
+)
+
+func TestPricingTableMatchesHeadAsGet(t *testing.T) {
+	table, err := NewPricingTable([]PricingRule{
+		{Pattern: "GET /reports/{id}", Amount: "0.25"},
+		{Pattern: "POST /jobs", Amount: "1.00"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		method, path string
+		want         bool
+	}{
+		{http.MethodGet, "/reports/1", true},
+		{http.MethodHead, "/reports/1", true},
+		{http.MethodPost, "/reports/1", false},
+		{http.MethodPost, "/jobs", true},
+		{http.MethodHead, "/jobs", false},
+	} {
+		if _, ok := table.Match(httptest.NewRequest(tc.method, tc.path, nil)); ok != tc.want {
+			t.Errorf("Match(%s %s) = %v, want %v", tc.method, tc.path, ok, tc.want)
+		}
+	}
+}
+
+func TestPricingTableChargesHead(t *testing.T) {
+	table, err := NewPricingTable([]PricingRule{{Pattern: "GET /reports/{id}", Amount: "0.25"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	x402 := New(&Config{
+		PaymentAddress: solana.NewWallet().PublicKey().String(),
+		TokenMint:      solana.NewWallet().PublicKey().String(),
+		Processor:      core.NewMockProcessor(),
+	})
+	defer x402.Server().Close()
+	handler := x402.PricingTableMiddleware(table, PaymentRequiredOptions{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "report")
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodHead, "/reports/1", nil))
+	if rec.Code != http.StatusPaymentRequired {
+		t.Errorf("HEAD of a GET-priced resource: got %d, want 402", rec.Code)
+	}
+}
+
+func TestPricingTablePricesMatchedRule(t *testing.T) {
+	table, err := NewPricingTable([]PricingRule{{Pattern: "/reports/**", Amount: "0.25"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Reloads the table between matching and pricing the request
+	var priced string
+	reloading := func(opts PaymentRequiredOptions) func(http.Handler) http.Handler {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if err := table.SetRules([]PricingRule{{Pattern: "/reports/**", Amount: "9.99"}}); err != nil {
+					t.Fatal(err)
+				}
+				amount, _, err := opts.PriceFunc(r)
+				if err != nil {
+					t.Fatal(err)
+				}
+				priced = amount
+			})
+		}
+	}
+
+	table.middleware(reloading, PaymentRequiredOptions{})(http.NotFoundHandler()).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/reports/1", nil))
+	if priced != "0.25" {
+		t.Errorf("priced %q, want the matched rule's 0.25", priced)
+	}
+}
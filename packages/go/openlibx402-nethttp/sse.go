@@ -0,0 +1,349 @@
+package nethttp
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/openlibx402/go/openlibx402-core"
+	"github.com/openlibx402/go/openlibx402-server"
+)
+
+// StreamTopUpPath is the path StreamTopUpHandler is usually mounted at.
+const StreamTopUpPath = "/x402/streams/"
+
+// Events a PaidStream sends about its payment, next to the handler's own.
+const (
+	EventPaymentSession  = "payment_session"  // The stream started; carries its top-up URL
+	EventPaymentExpiring = "payment_expiring" // The window ends soon; carries a payment request for the next
+	EventPaymentExtended = "payment_extended" // A top-up extended the window
+	EventPaymentExpired  = "payment_expired"  // The window ended; the stream closes
+)
+
+// StreamOptions configures a PaidStream.
+type StreamOptions struct {
+	// Window is how long each payment keeps the stream open (required).
+	Window time.Duration
+	// Warning is how long before the end of a window the payment_expiring
+	// event is sent (default: 30 seconds, or a quarter of Window if shorter).
+	Warning time.Duration
+	// TopUpPath is where StreamTopUpHandler is mounted (default:
+	// StreamTopUpPath). The top-up URL of a stream is TopUpPath followed by
+	// its ID.
+	TopUpPath string
+}
+
+// StreamEvent is the data of the payment events of a PaidStream, sent as
+// JSON.
+type StreamEvent struct {
+	StreamID       string               `json:"stream_id"`
+	ExpiresAt      time.Time            `json:"expires_at"`
+	TopUpURL       string               `json:"top_up_url"`
+	PaymentRequest *core.PaymentRequest `json:"payment_request,omitempty"`
+}
+
+// PaidStream is a server-sent events stream paid for in windows of time: a
+// payment buys one window, and the stream closes when the last window ends.
+// Before that, the stream sends a payment_expiring event carrying a payment
+// request for the next window; the client pays it on the stream's top-up URL
+// (see StreamTopUpHandler), which extends the window without reconnecting.
+//
+// Usage:
+//
+//	http.Handle("/prices", nethttp.PaymentRequired(nethttp.PaymentRequiredOptions{
+//	    Amount: "0.05",
+//	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+//	    stream, err := nethttp.StartPaidStream(w, r, nethttp.StreamOptions{Window: 5 * time.Minute})
+//	    if err != nil {
+//	        http.Error(w, err.Error(), http.StatusInternalServerError)
+//	        return
+//	    }
+//	    defer stream.Close()
+//	    ticker := time.NewTicker(time.Second)
+//	    defer ticker.Stop()
+//	    for {
+//	        select {
+//	        case <-stream.Done():
+//	            return
+//	        case <-r.Context().Done():
+//	            return
+//	        case <-ticker.C:
+//	            stream.Send("price", currentPrice())
+//	        }
+//	    }
+//	})))
+//	http.Handle(nethttp.StreamTopUpPath, nethttp.StreamTopUpHandler())
+type PaidStream struct {
+	session  *PaidSession
+	id       string
+	topUpURL string
+	warning  time.Duration
+	ctx      context.Context
+
+	mu        sync.Mutex // Serializes writes; taken after session.mu
+	w         http.ResponseWriter
+	rc        *http.ResponseController
+	timer     *time.Timer
+	expiresAt time.Time
+	warnedAt  time.Time // Expiry of the window a warning was sent for
+	closing   bool
+	closed    bool
+	done      chan struct{} // Closed once the last event is sent
+}
+
+// activeStreams maps the IDs of open streams to them, for top-ups.
+var activeStreams sync.Map
+
+// StartPaidStream starts a server-sent events stream on w for a request that
+// passed the PaymentRequired middleware, and sends its payment_session
+// event. The handler must return once the stream is Done, and Close it.
+func StartPaidStream(w http.ResponseWriter, r *http.Request, opts StreamOptions) (*PaidStream, error) {
+	id := make([]byte, 16)
+	rand.Read(id)
+	s := &PaidStream{
+		id:      hex.EncodeToString(id),
+		warning: opts.Warning,
+		ctx:     r.Context(),
+		w:       w,
+		rc:      http.NewResponseController(w),
+		done:    make(chan struct{}),
+	}
+	topUpPath := opts.TopUpPath
+	if topUpPath == "" {
+		topUpPath = StreamTopUpPath
+	}
+	s.topUpURL = strings.TrimSuffix(topUpPath, "/") + "/" + s.id
+	if s.warning <= 0 {
+		s.warning = 30 * time.Second
+		if quarter := opts.Window / 4; quarter < s.warning {
+			s.warning = quarter
+		}
+	}
+
+	session, err := StartPaidSession(r, closerFunc(s.end), opts.Window)
+	if err != nil {
+		return nil, err
+	}
+	s.session = session
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // Disable proxy buffering
+	w.WriteHeader(http.StatusOK)
+	if err := s.rc.Flush(); err != nil {
+		s.Close()
+		return nil, fmt.Errorf("response writer does not support streaming: %w", err)
+	}
+	// Streams outlive the server's write timeout
+	s.rc.SetWriteDeadline(time.Time{})
+
+	expiresAt := session.ExpiresAt()
+	s.mu.Lock()
+	s.expiresAt = expiresAt
+	s.timer = time.AfterFunc(time.Until(expiresAt)-s.warning, s.warn)
+	s.mu.Unlock()
+	activeStreams.Store(s.id, s)
+	s.Send(EventPaymentSession, s.event(expiresAt, nil))
+	return s, nil
+}
+
+// ID returns the ID of the stream in its top-up URL.
+func (s *PaidStream) ID() string {
+	return s.id
+}
+
+// Send sends an event to the client. Strings are sent as they are, and other
+// data as JSON.
+func (s *PaidStream) Send(event string, data interface{}) error {
+	text, ok := data.(string)
+	if !ok {
+		encoded, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		text = string(encoded)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sendLocked(event, text)
+}
+
+// sendLocked writes an event. s.mu must be held.
+func (s *PaidStream) sendLocked(event, data string) error {
+	if s.closed {
+		return fmt.Errorf("stream has been closed")
+	}
+	var b strings.Builder
+	if event != "" {
+		b.WriteString("event: " + event + "\n")
+	}
+	for _, line := range strings.Split(data, "\n") {
+		b.WriteString("data: " + line + "\n")
+	}
+	b.WriteString("\n")
+	if _, err := s.w.Write([]byte(b.String())); err != nil {
+		return err
+	}
+	return s.rc.Flush()
+}
+
+// PaymentRequest issues a payment request for the next window.
+func (s *PaidStream) PaymentRequest(ctx context.Context) (*core.PaymentRequest, error) {
+	return s.session.PaymentRequest(ctx)
+}
+
+// TopUp verifies a payment authorization header value and extends the
+// stream by one window (see PaidSession.TopUp), sending a payment_extended
+// event.
+func (s *PaidStream) TopUp(ctx context.Context, authHeader string) (*core.PaymentAuthorization, error) {
+	authorization, err := s.session.TopUp(ctx, authHeader)
+	if err != nil {
+		return nil, err
+	}
+	expiresAt := s.session.ExpiresAt()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closed {
+		s.expiresAt = expiresAt
+		s.timer.Reset(time.Until(expiresAt) - s.warning)
+		data, _ := json.Marshal(s.event(expiresAt, nil))
+		s.sendLocked(EventPaymentExtended, string(data))
+	}
+	return authorization, nil
+}
+
+// ExpiresAt returns the end of the current paid window.
+func (s *PaidStream) ExpiresAt() time.Time {
+	return s.session.ExpiresAt()
+}
+
+// Done returns a channel that is closed when the stream ends.
+func (s *PaidStream) Done() <-chan struct{} {
+	return s.done
+}
+
+// Close ends the stream. Events can no longer be sent.
+func (s *PaidStream) Close() error {
+	s.mu.Lock()
+	s.closing = true
+	s.mu.Unlock()
+	return s.session.Close()
+}
+
+// warn sends the payment_expiring event once per window.
+func (s *PaidStream) warn() {
+	expiresAt := s.session.ExpiresAt()
+	if remaining := time.Until(expiresAt) - s.warning; remaining > 0 {
+		// Extended since the timer was set
+		s.mu.Lock()
+		if !s.closed {
+			s.timer.Reset(remaining)
+		}
+		s.mu.Unlock()
+		return
+	}
+	// Without a payment request, clients fetch one from the top-up URL
+	paymentReq, _ := s.session.PaymentRequest(s.ctx)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed || s.warnedAt.Equal(expiresAt) {
+		return
+	}
+	s.warnedAt = expiresAt
+	data, _ := json.Marshal(s.event(expiresAt, paymentReq))
+	s.sendLocked(EventPaymentExpiring, string(data))
+}
+
+// end closes the stream when its session ends, sending payment_expired if
+// the window ran out. It is called with the session's lock held.
+func (s *PaidStream) end() error {
+	activeStreams.Delete(s.id)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	if !s.closing {
+		data, _ := json.Marshal(s.event(s.expiresAt, nil))
+		s.sendLocked(EventPaymentExpired, string(data))
+	}
+	s.closed = true
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	close(s.done)
+	return nil
+}
+
+// event returns the data of a payment event.
+func (s *PaidStream) event(expiresAt time.Time, paymentReq *core.PaymentRequest) StreamEvent {
+	return StreamEvent{StreamID: s.id, ExpiresAt: expiresAt, TopUpURL: s.topUpURL, PaymentRequest: paymentReq}
+}
+
+// StreamTopUpHandler returns a handler extending paid streams, at
+// <prefix>/{stream_id}. A request with a payment authorization header tops
+// up the stream and gets its new expiry as a StreamEvent; one without gets
+// a 402 response with a payment request for the next window, so that
+// clients paying 402 responses automatically can top up with a plain GET or
+// POST.
+func StreamTopUpHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			w.Header().Set("Allow", "GET, POST")
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		value, ok := activeStreams.Load(r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:])
+		if !ok {
+			http.Error(w, "Stream not found or closed", http.StatusNotFound)
+			return
+		}
+		s := value.(*PaidStream)
+		server := s.session.server
+
+		authHeader := r.Header.Get(server.Config().AuthorizationHeader)
+		if authHeader == "" {
+			paymentReq, err := s.PaymentRequest(r.Context())
+			if err != nil {
+				respond(w, r, server, &serverx402.Result{
+					Status:  http.StatusServiceUnavailable,
+					Code:    "SERVICE_UNAVAILABLE",
+					Message: "Payment requests are temporarily unavailable",
+				})
+				return
+			}
+			respond(w, r, server, &serverx402.Result{
+				Status:         http.StatusPaymentRequired,
+				Code:           "PAYMENT_REQUIRED",
+				Message:        "Payment is required to extend this stream",
+				PaymentRequest: paymentReq,
+				Requirement:    s.session.requirement,
+			})
+			return
+		}
+		if _, err := s.TopUp(r.Context(), authHeader); err != nil {
+			code := core.ErrorCodeOf(err)
+			if code == "" {
+				code = core.ErrPaymentVerificationFailed.Code
+			}
+			respond(w, r, server, &serverx402.Result{Status: http.StatusForbidden, Code: code, Message: err.Error()})
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(s.event(s.ExpiresAt(), nil))
+	})
+}
+
+// closerFunc adapts a function to io.Closer.
+type closerFunc func() error
+
+func (f closerFunc) Close() error {
+	return f()
+}
@@ -0,0 +1,218 @@
+package nethttp
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/openlibx402/go/openlibx402-core"
+	"github.com/openlibx402/go/openlibx402-server"
+)
+
+// PaidSession tracks the paid window of a long-lived connection such as a WebSocket.
+//
+// Wrap the upgrade handler with PaymentRequired so the connection can only be
+// opened with a valid payment, then start a session after upgrading. Each payment
+// buys one window; the client extends the session by sending a new authorization
+// (e.g. as a WebSocket message) which the handler passes to TopUp. When the window
+// ends without a top-up, the connection is closed.
+//
+// Usage:
+//
+//	http.Handle("/ws", nethttp.PaymentRequired(nethttp.PaymentRequiredOptions{
+//	    Amount: "0.05",
+//	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+//	    conn, err := upgrader.Upgrade(w, r, nil)
+//	    if err != nil {
+//	        return
+//	    }
+//	    session, err := nethttp.StartPaidSession(r, conn, 10*time.Minute)
+//	    if err != nil {
+//	        conn.Close()
+//	        return
+//	    }
+//	    defer session.Close()
+//	    // On a top-up message: session.TopUp(r.Context(), headerValue)
+//	})))
+type PaidSession struct {
+	mu          sync.Mutex
+	conn        io.Closer
+	window      time.Duration
+	expiresAt   time.Time
+	timer       *time.Timer
+	server      *serverx402.Server
+	requirement *serverx402.Requirement
+	seen        map[string]bool
+	done        chan struct{}
+	closed      bool
+	payer       string
+	startedAt   time.Time
+}
+
+// activeSessions holds the sessions that have not been closed.
+var activeSessions sync.Map
+
+// ActiveSessions lists the paid sessions that are currently open, e.g. for
+// serverx402.AdminOptions.Sessions.
+func ActiveSessions() []serverx402.SessionInfo {
+	var sessions []serverx402.SessionInfo
+	activeSessions.Range(func(key, _ interface{}) bool {
+		s := key.(*PaidSession)
+		sessions = append(sessions, serverx402.SessionInfo{
+			Payer:     s.payer,
+			Resource:  s.requirement.Resource,
+			StartedAt: s.startedAt,
+			ExpiresAt: s.ExpiresAt(),
+		})
+		return true
+	})
+	return sessions
+}
+
+// StartPaidSession starts the paid window for a connection upgraded from r.
+//
+// r must have passed the PaymentRequired middleware. The connection is closed
+// when the window elapses unless it is extended with TopUp.
+func StartPaidSession(r *http.Request, conn io.Closer, window time.Duration) (*PaidSession, error) {
+	auth, ok := r.Context().Value(paymentAuthKey).(authorization)
+	if !ok {
+		return nil, fmt.Errorf("request has no verified payment; wrap the handler with PaymentRequired")
+	}
+	if window <= 0 {
+		return nil, fmt.Errorf("session window must be positive")
+	}
+
+	now := time.Now()
+	s := &PaidSession{
+		conn:        conn,
+		window:      window,
+		expiresAt:   now.Add(window),
+		server:      auth.server,
+		requirement: auth.result.Requirement,
+		seen:        map[string]bool{paymentKey(auth.result.Authorization): true},
+		done:        make(chan struct{}),
+		payer:       auth.result.Authorization.PublicKey,
+		startedAt:   now,
+	}
+	s.timer = time.AfterFunc(window, s.expire)
+	activeSessions.Store(s, struct{}{})
+	return s, nil
+}
+
+// PaymentRequest issues a payment request for a top-up, to send to the
+// client. Clients may also pay any other payment request for the session's
+// resource, unless the server binds authorizations to issued requests (see
+// Config.NonceStore), in which case each top-up needs its own.
+func (s *PaidSession) PaymentRequest(ctx context.Context) (*core.PaymentRequest, error) {
+	return s.server.IssuePaymentRequest(ctx, s.requirement)
+}
+
+// TopUp verifies a new payment authorization header value and extends the
+// session by one window.
+//
+// The authorization must satisfy the same requirements as the payment used to
+// open the connection and must not have been used before in this session.
+func (s *PaidSession) TopUp(ctx context.Context, authHeader string) (*core.PaymentAuthorization, error) {
+	authorization, err := core.PaymentAuthorizationFromHeader(authHeader)
+	if err != nil {
+		return nil, err
+	}
+
+	key := paymentKey(authorization)
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil, fmt.Errorf("session has been closed")
+	}
+	if s.seen[key] {
+		s.mu.Unlock()
+		return nil, core.NewPaymentVerificationError("authorization already used in this session")
+	}
+	s.mu.Unlock()
+
+	if result := s.server.Verify(ctx, s.requirement, authorization); !result.Allowed() {
+		return nil, core.NewPaymentVerificationError(result.Message)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil, fmt.Errorf("session has been closed")
+	}
+	s.seen[key] = true
+
+	// Extend from the current expiry so early top-ups are not lost
+	base := s.expiresAt
+	if now := time.Now(); base.Before(now) {
+		base = now
+	}
+	s.expiresAt = base.Add(s.window)
+	s.timer.Reset(time.Until(s.expiresAt))
+	return authorization, nil
+}
+
+// ExpiresAt returns the end of the current paid window.
+func (s *PaidSession) ExpiresAt() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.expiresAt
+}
+
+// Remaining returns the time left in the current paid window.
+func (s *PaidSession) Remaining() time.Duration {
+	remaining := time.Until(s.ExpiresAt())
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
+// Done returns a channel that is closed when the session ends.
+func (s *PaidSession) Done() <-chan struct{} {
+	return s.done
+}
+
+// Close ends the session and closes the connection.
+func (s *PaidSession) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closeLocked()
+}
+
+// expire closes the connection if the paid window has elapsed.
+func (s *PaidSession) expire() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	if remaining := time.Until(s.expiresAt); remaining > 0 {
+		// Extended concurrently with the timer firing
+		s.timer.Reset(remaining)
+		return
+	}
+	s.closeLocked()
+}
+
+// closeLocked closes the session. s.mu must be held.
+func (s *PaidSession) closeLocked() error {
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	activeSessions.Delete(s)
+	s.timer.Stop()
+	close(s.done)
+	return s.conn.Close()
+}
+
+// paymentKey identifies an authorization for replay detection within a session.
+func paymentKey(authorization *core.PaymentAuthorization) string {
+	if authorization.TransactionHash != "" {
+		return authorization.TransactionHash
+	}
+	return authorization.PaymentID + ":" + authorization.Signature
+}
@@ -0,0 +1,358 @@
+package x402test
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/openlibx402/go/openlibx402-core"
+)
+
+// Token amounts are in units of 10^-decimals, which core assumes for mints it
+// cannot read, and the ledger does not serve mint accounts.
+const decimals = 6
+
+// Fees the fake RPC reports, in lamports.
+const (
+	lamportsPerSignature = 5000
+	tokenAccountRent     = 2039280
+)
+
+// transferChecked is the SPL token instruction payments transfer with.
+const transferChecked = 12
+
+// ledger is the fake Solana RPC endpoint. It keeps the token balances of the
+// server's mint and the transactions sent to it, which are never broadcast.
+type ledger struct {
+	mint      solana.PublicKey
+	blockhash solana.Hash
+
+	mu       sync.Mutex
+	tokens   map[solana.PublicKey]uint64 // by token account
+	lamports map[solana.PublicKey]uint64 // by wallet
+	sent     map[solana.Signature]*solana.Transaction
+}
+
+func newLedger(mint solana.PublicKey) *ledger {
+	return &ledger{
+		mint:      mint,
+		blockhash: solana.Hash(solana.NewWallet().PublicKey()),
+		tokens:    make(map[solana.PublicKey]uint64),
+		lamports:  make(map[solana.PublicKey]uint64),
+		sent:      make(map[solana.Signature]*solana.Transaction),
+	}
+}
+
+func (l *ledger) tokenAccount(owner solana.PublicKey) solana.PublicKey {
+	account, _, _ := solana.FindAssociatedTokenAddress(owner, l.mint)
+	return account
+}
+
+func (l *ledger) setTokenBalance(owner solana.PublicKey, amount float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.tokens[l.tokenAccount(owner)] = toUnits(amount)
+}
+
+func (l *ledger) tokenBalance(owner solana.PublicKey) float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return fromUnits(l.tokenUnits(l.tokenAccount(owner)))
+}
+
+func (l *ledger) setSOLBalance(owner solana.PublicKey, lamports uint64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lamports[owner] = lamports
+}
+
+// tokenUnits returns the balance of a token account. The caller holds l.mu.
+func (l *ledger) tokenUnits(account solana.PublicKey) uint64 {
+	if units, ok := l.tokens[account]; ok {
+		return units
+	}
+	return toUnits(DefaultTokenBalance)
+}
+
+// send checks the signatures of a transaction and applies its transfers.
+func (l *ledger) send(tx *solana.Transaction) (solana.Signature, error) {
+	if err := tx.VerifySignatures(); err != nil {
+		return solana.Signature{}, fmt.Errorf("invalid transaction signatures: %w", err)
+	}
+	if !tx.Message.RecentBlockhash.Equals(l.blockhash) {
+		return solana.Signature{}, errors.New("Blockhash not found")
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	sig := tx.Signatures[0]
+	if _, ok := l.sent[sig]; ok {
+		// Resending a transaction is idempotent
+		return sig, nil
+	}
+	transfers, err := l.transfers(tx)
+	if err != nil {
+		return solana.Signature{}, err
+	}
+	debits := make(map[solana.PublicKey]uint64)
+	for _, t := range transfers {
+		debits[t.source] += t.amount
+	}
+	for source, amount := range debits {
+		if l.tokenUnits(source) < amount {
+			return solana.Signature{}, errors.New("Transaction simulation failed: Error processing Instruction: custom program error: 0x1 (insufficient funds)")
+		}
+	}
+	for _, t := range transfers {
+		l.tokens[t.source] = l.tokenUnits(t.source) - t.amount
+		l.tokens[t.destination] = l.tokenUnits(t.destination) + t.amount
+	}
+	l.sent[sig] = tx
+	return sig, nil
+}
+
+// transfer is a token transfer of a transaction.
+type transfer struct {
+	source, destination solana.PublicKey
+	amount              uint64
+}
+
+// transfers returns the TransferChecked instructions of a transaction for
+// the ledger's mint.
+func (l *ledger) transfers(tx *solana.Transaction) ([]transfer, error) {
+	var transfers []transfer
+	for _, ix := range tx.Message.Instructions {
+		programID, err := tx.Message.Program(ix.ProgramIDIndex)
+		if err != nil {
+			return nil, err
+		}
+		if !programID.Equals(solana.TokenProgramID) || len(ix.Data) < 10 || ix.Data[0] != transferChecked || len(ix.Accounts) < 4 {
+			continue
+		}
+		accounts, err := ix.ResolveInstructionAccounts(&tx.Message)
+		if err != nil {
+			return nil, err
+		}
+		if !accounts[1].PublicKey.Equals(l.mint) {
+			return nil, fmt.Errorf("unknown token mint %s", accounts[1].PublicKey)
+		}
+		if !accounts[3].IsSigner {
+			return nil, errors.New("token transfer is not signed by the owner")
+		}
+		transfers = append(transfers, transfer{
+			source:      accounts[0].PublicKey,
+			destination: accounts[2].PublicKey,
+			amount:      binary.LittleEndian.Uint64(ix.Data[1:9]),
+		})
+	}
+	return transfers, nil
+}
+
+// verify checks that the transaction of an authorization was sent by the
+// payer and transferred at least the paid amount to recipient.
+func (l *ledger) verify(auth *core.PaymentAuthorization, recipient solana.PublicKey) error {
+	sig, err := solana.SignatureFromBase58(auth.TransactionHash)
+	if err != nil {
+		return fmt.Errorf("invalid transaction hash: %w", err)
+	}
+	l.mu.Lock()
+	tx, ok := l.sent[sig]
+	l.mu.Unlock()
+	if !ok {
+		return errors.New("transaction was not sent to the test RPC endpoint")
+	}
+	if tx.Message.AccountKeys[0].String() != auth.PublicKey {
+		return errors.New("transaction was not paid by the payer")
+	}
+
+	transfers, err := l.transfers(tx)
+	if err != nil {
+		return err
+	}
+	destination := l.tokenAccount(recipient)
+	var paid uint64
+	for _, t := range transfers {
+		if t.destination.Equals(destination) {
+			paid += t.amount
+		}
+	}
+	amount, err := strconv.ParseFloat(auth.ActualAmount, 64)
+	if err != nil {
+		return fmt.Errorf("invalid amount: %w", err)
+	}
+	if paid < toUnits(amount) {
+		return fmt.Errorf("transaction transferred %s, not %s", strconv.FormatFloat(fromUnits(paid), 'f', -1, 64), auth.ActualAmount)
+	}
+	return nil
+}
+
+// rpcRequest is a JSON-RPC 2.0 request.
+type rpcRequest struct {
+	ID     json.RawMessage   `json:"id"`
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+}
+
+// rpcError is a JSON-RPC 2.0 error.
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// ServeHTTP serves the Solana RPC methods payment clients call.
+func (l *ledger) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req rpcRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON-RPC request", http.StatusBadRequest)
+		return
+	}
+	result, rpcErr := l.call(req.Method, req.Params)
+	response := map[string]interface{}{"jsonrpc": "2.0", "id": req.ID}
+	if rpcErr != nil {
+		response["error"] = rpcErr
+	} else {
+		response["result"] = result
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// call runs an RPC method.
+func (l *ledger) call(method string, params []json.RawMessage) (interface{}, *rpcError) {
+	withContext := func(value interface{}) interface{} {
+		return map[string]interface{}{"context": map[string]interface{}{"slot": 1}, "value": value}
+	}
+	invalidParams := &rpcError{Code: -32602, Message: "Invalid params"}
+
+	switch method {
+	case "getLatestBlockhash":
+		return withContext(map[string]interface{}{"blockhash": l.blockhash, "lastValidBlockHeight": math.MaxInt32}), nil
+	case "getRecentBlockhash":
+		return withContext(map[string]interface{}{
+			"blockhash":     l.blockhash,
+			"feeCalculator": map[string]interface{}{"lamportsPerSignature": lamportsPerSignature},
+		}), nil
+	case "getFeeForMessage":
+		return withContext(lamportsPerSignature), nil
+	case "getMinimumBalanceForRentExemption":
+		return tokenAccountRent, nil
+	case "getRecentPrioritizationFees":
+		return []interface{}{}, nil
+	case "getHealth":
+		return "ok", nil
+	case "getGenesisHash":
+		return core.GenesisHash(Network), nil
+	}
+
+	if len(params) == 0 {
+		return nil, invalidParams
+	}
+	switch method {
+	case "getBalance":
+		var owner solana.PublicKey
+		if json.Unmarshal(params[0], &owner) != nil {
+			return nil, invalidParams
+		}
+		l.mu.Lock()
+		lamports, ok := l.lamports[owner]
+		l.mu.Unlock()
+		if !ok {
+			lamports = DefaultSOLBalance
+		}
+		return withContext(lamports), nil
+
+	case "getAccountInfo":
+		var account solana.PublicKey
+		if json.Unmarshal(params[0], &account) != nil {
+			return nil, invalidParams
+		}
+		l.mu.Lock()
+		_, exists := l.tokens[account]
+		l.mu.Unlock()
+		if !exists {
+			return withContext(nil), nil
+		}
+		return withContext(map[string]interface{}{
+			"data":       []string{"", "base64"},
+			"executable": false,
+			"lamports":   tokenAccountRent,
+			"owner":      solana.TokenProgramID,
+			"rentEpoch":  0,
+		}), nil
+
+	case "getTokenAccountBalance":
+		var account solana.PublicKey
+		if json.Unmarshal(params[0], &account) != nil {
+			return nil, invalidParams
+		}
+		l.mu.Lock()
+		units := l.tokenUnits(account)
+		l.mu.Unlock()
+		amount := fromUnits(units)
+		return withContext(map[string]interface{}{
+			"amount":         strconv.FormatUint(units, 10),
+			"decimals":       decimals,
+			"uiAmount":       amount,
+			"uiAmountString": strconv.FormatFloat(amount, 'f', -1, 64),
+		}), nil
+
+	case "sendTransaction", "simulateTransaction":
+		tx, err := decodeTransaction(params[0])
+		if err != nil {
+			return nil, invalidParams
+		}
+		if method == "simulateTransaction" {
+			return withContext(map[string]interface{}{"err": nil, "logs": []string{}, "unitsConsumed": 0}), nil
+		}
+		sig, err := l.send(tx)
+		if err != nil {
+			return nil, &rpcError{Code: -32002, Message: err.Error()}
+		}
+		return sig, nil
+
+	case "getSignatureStatuses":
+		var sigs []solana.Signature
+		if json.Unmarshal(params[0], &sigs) != nil {
+			return nil, invalidParams
+		}
+		statuses := make([]interface{}, len(sigs))
+		l.mu.Lock()
+		for i, sig := range sigs {
+			if _, ok := l.sent[sig]; ok {
+				statuses[i] = map[string]interface{}{"slot": 1, "confirmations": nil, "err": nil, "confirmationStatus": "finalized"}
+			}
+		}
+		l.mu.Unlock()
+		return withContext(statuses), nil
+	}
+	return nil, &rpcError{Code: -32601, Message: "Method not found: " + method}
+}
+
+// decodeTransaction decodes a base64 transaction parameter.
+func decodeTransaction(param json.RawMessage) (*solana.Transaction, error) {
+	var encoded string
+	if err := json.Unmarshal(param, &encoded); err != nil {
+		return nil, err
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	return solana.TransactionFromBytes(data)
+}
+
+// toUnits converts a token amount to units, rounding down as core does.
+func toUnits(amount float64) uint64 {
+	return uint64(math.Floor(amount * math.Pow10(decimals)))
+}
+
+func fromUnits(units uint64) float64 {
+	return float64(units) / math.Pow10(decimals)
+}
@@ -0,0 +1,193 @@
+// Package x402test provides a local X402 server for developing and testing
+// client code without devnet access.
+//
+// NewServer starts an httptest.Server serving paid endpoints through the
+// nethttp middleware, together with a fake Solana RPC endpoint that clients
+// pay through. The fake RPC checks the signatures of the transactions it
+// receives and applies their token transfers to an in-memory ledger instead
+// of broadcasting them, and the endpoints accept a payment only if its
+// transaction reached the ledger.
+//
+// Example:
+//
+//	srv := x402test.NewServer(x402test.Endpoint{Pattern: "/premium-data", Amount: "0.10"})
+//	defer srv.Close()
+//
+//	c := client.NewAutoClient(payerKey, srv.RPCURL(), &client.AutoClientOptions{AutoRetry: true, AllowLocal: true})
+//	resp, err := c.Get(ctx, srv.URL+"/premium-data")
+package x402test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/openlibx402/go/openlibx402-core"
+	"github.com/openlibx402/go/openlibx402-nethttp"
+	"github.com/openlibx402/go/openlibx402-server"
+)
+
+// Network is the network of the payment requests the server issues.
+const Network = "solana-devnet"
+
+// RPCPath is the path of the fake Solana RPC endpoint.
+const RPCPath = "/rpc"
+
+// Balances of accounts the ledger has not been told about, so that any
+// wallet can pay without funding it first.
+const (
+	DefaultTokenBalance = 1000.0
+	DefaultSOLBalance   = solana.LAMPORTS_PER_SOL
+)
+
+// Endpoint is a paid endpoint of the server.
+type Endpoint struct {
+	Pattern     string       // http.ServeMux pattern, e.g. "/premium-data"
+	Amount      string       // Required payment amount (e.g., "0.10")
+	Description string       // Human-readable description
+	Handler     http.Handler // Serves paid requests (default: a JSON body describing the payment)
+}
+
+// Server is a local X402 server with a fake Solana RPC endpoint.
+type Server struct {
+	*httptest.Server
+
+	// PaymentAddress and TokenMint are random keys generated for the server.
+	PaymentAddress solana.PublicKey
+	TokenMint      solana.PublicKey
+
+	x402   *nethttp.X402
+	mux    *http.ServeMux
+	ledger *ledger
+
+	mu       sync.Mutex
+	payments []core.PaymentAuthorization
+}
+
+// NewServer starts a server serving endpoints. Without endpoints it serves
+// "/paid" for 0.01. Close the server when done.
+func NewServer(endpoints ...Endpoint) *Server {
+	s := &Server{
+		PaymentAddress: solana.NewWallet().PublicKey(),
+		TokenMint:      solana.NewWallet().PublicKey(),
+		mux:            http.NewServeMux(),
+	}
+	s.ledger = newLedger(s.TokenMint)
+	s.ledger.setTokenBalance(s.PaymentAddress, 0)
+	s.Server = httptest.NewServer(s.mux)
+
+	s.x402 = nethttp.New(&nethttp.Config{
+		PaymentAddress:     s.PaymentAddress.String(),
+		TokenMint:          s.TokenMint.String(),
+		Network:            Network,
+		RPCURL:             s.RPCURL(),
+		RequireAttestation: true,
+		NonceStore:         serverx402.NewMemoryNonceStore(0),
+	})
+	s.mux.Handle(RPCPath, s.ledger)
+
+	if len(endpoints) == 0 {
+		endpoints = []Endpoint{{Pattern: "/paid", Amount: "0.01"}}
+	}
+	for _, endpoint := range endpoints {
+		s.Handle(endpoint)
+	}
+	return s
+}
+
+// Handle adds a paid endpoint.
+func (s *Server) Handle(endpoint Endpoint) {
+	handler := endpoint.Handler
+	if handler == nil {
+		handler = http.HandlerFunc(paidContent)
+	}
+	paid := s.x402.PaymentRequired(nethttp.PaymentRequiredOptions{
+		Amount:      endpoint.Amount,
+		Description: endpoint.Description,
+	})
+	s.mux.Handle(endpoint.Pattern, paid(s.settled(handler)))
+}
+
+// RPCURL returns the URL of the fake Solana RPC endpoint, for the rpcURL of
+// clients paying the server.
+func (s *Server) RPCURL() string {
+	return s.URL + RPCPath
+}
+
+// X402 returns the middleware instance serving the endpoints, e.g. to wrap
+// handlers of another mux.
+func (s *Server) X402() *nethttp.X402 {
+	return s.x402
+}
+
+// SetTokenBalance sets the token balance of a wallet.
+func (s *Server) SetTokenBalance(owner solana.PublicKey, amount float64) {
+	s.ledger.setTokenBalance(owner, amount)
+}
+
+// TokenBalance returns the token balance of a wallet.
+func (s *Server) TokenBalance(owner solana.PublicKey) float64 {
+	return s.ledger.tokenBalance(owner)
+}
+
+// SetSOLBalance sets the SOL balance of a wallet in lamports, which pays
+// transaction fees.
+func (s *Server) SetSOLBalance(owner solana.PublicKey, lamports uint64) {
+	s.ledger.setSOLBalance(owner, lamports)
+}
+
+// Payments returns the payments the endpoints accepted, oldest first.
+func (s *Server) Payments() []core.PaymentAuthorization {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]core.PaymentAuthorization(nil), s.payments...)
+}
+
+// Close shuts down the server.
+func (s *Server) Close() {
+	s.Server.Close()
+	s.x402.Server().Close()
+}
+
+// settled stands in for on-chain verification: it serves the request only
+// if the payment's transaction reached the ledger and transferred at least
+// the paid amount to the payment address.
+func (s *Server) settled(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := nethttp.GetPaymentAuthorization(r)
+		if auth == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if err := s.ledger.verify(auth, s.PaymentAddress); err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"error":            "Payment verification failed",
+				"code":             "PAYMENT_VERIFICATION_FAILED",
+				"reason":           err.Error(),
+				"transaction_hash": auth.TransactionHash,
+			})
+			return
+		}
+		s.mu.Lock()
+		s.payments = append(s.payments, *auth)
+		s.mu.Unlock()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// paidContent is the default endpoint handler.
+func paidContent(w http.ResponseWriter, r *http.Request) {
+	auth := nethttp.GetPaymentAuthorization(r)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"data":             fmt.Sprintf("paid content of %s", r.URL.Path),
+		"payer":            auth.PublicKey,
+		"amount":           auth.ActualAmount,
+		"transaction_hash": auth.TransactionHash,
+	})
+}
@@ -0,0 +1,181 @@
+package serverx402
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// SessionInfo describes an active paid session (e.g. a WebSocket).
+type SessionInfo struct {
+	Payer     string    `json:"payer"`
+	Resource  string    `json:"resource"`
+	StartedAt time.Time `json:"started_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// AdminOptions configures the admin handler.
+type AdminOptions struct {
+	Store  PaymentStore // Ledger backing the payment and revenue endpoints (required)
+	Server *Server      // Optional; adds asynchronous settlement failures and sweeps
+
+	// Sessions optionally lists active paid sessions, e.g. nethttp.ActiveSessions.
+	Sessions func() []SessionInfo
+
+	// Token, if set, is required as "Authorization: Bearer <token>". Without a
+	// token the handler must be protected by other means.
+	Token string
+}
+
+// NewAdminHandler returns a handler exposing payment reports as JSON:
+//
+//	GET /payments   recent payments (query: limit, payment_id, payer, resource, status, since, until)
+//	GET /revenue    verified revenue per resource and token (query: since, until)
+//	GET /failures   failed verifications and settlements (query: limit, since)
+//	GET /sessions   active paid sessions
+//	GET /sweeps     recent transfers to the treasury (requires Server)
+//
+// Times are RFC 3339. Mount it under a prefix with http.StripPrefix:
+//
+//	mux.Handle("/admin/x402/", http.StripPrefix("/admin/x402", serverx402.NewAdminHandler(serverx402.AdminOptions{
+//	    Store: store,
+//	    Token: os.Getenv("X402_ADMIN_TOKEN"),
+//	})))
+func NewAdminHandler(opts AdminOptions) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/payments", func(w http.ResponseWriter, r *http.Request) {
+		query, err := paymentQueryFromRequest(r)
+		if err != nil {
+			writeAdminError(w, http.StatusBadRequest, err)
+			return
+		}
+		records, err := opts.Store.ListPayments(r.Context(), query)
+		if err != nil {
+			writeAdminError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeAdminJSON(w, map[string]interface{}{"payments": emptyIfNil(records)})
+	})
+	mux.HandleFunc("/revenue", func(w http.ResponseWriter, r *http.Request) {
+		query, err := paymentQueryFromRequest(r)
+		if err != nil {
+			writeAdminError(w, http.StatusBadRequest, err)
+			return
+		}
+		revenue, err := Revenue(r.Context(), opts.Store, query.Since, query.Until)
+		if err != nil {
+			writeAdminError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeAdminJSON(w, map[string]interface{}{"revenue": revenue})
+	})
+	mux.HandleFunc("/failures", func(w http.ResponseWriter, r *http.Request) {
+		query, err := paymentQueryFromRequest(r)
+		if err != nil {
+			writeAdminError(w, http.StatusBadRequest, err)
+			return
+		}
+		query.Status = PaymentStatusFailed
+		records, err := opts.Store.ListPayments(r.Context(), query)
+		if err != nil {
+			writeAdminError(w, http.StatusInternalServerError, err)
+			return
+		}
+		body := map[string]interface{}{"payments": emptyIfNil(records)}
+		if opts.Server != nil {
+			body["settlements"] = emptyIfNil(opts.Server.SettlementFailures())
+		}
+		writeAdminJSON(w, body)
+	})
+	mux.HandleFunc("/sessions", func(w http.ResponseWriter, r *http.Request) {
+		var sessions []SessionInfo
+		if opts.Sessions != nil {
+			sessions = opts.Sessions()
+		}
+		writeAdminJSON(w, map[string]interface{}{"sessions": emptyIfNil(sessions)})
+	})
+	mux.HandleFunc("/sweeps", func(w http.ResponseWriter, r *http.Request) {
+		var sweeps []Sweep
+		if opts.Server != nil {
+			sweeps = opts.Server.Sweeps()
+		}
+		writeAdminJSON(w, map[string]interface{}{"sweeps": emptyIfNil(sweeps)})
+	})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			writeAdminError(w, http.StatusMethodNotAllowed, errMethodNotAllowed)
+			return
+		}
+		if opts.Token != "" {
+			expected := "Bearer " + opts.Token
+			if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte(expected)) != 1 {
+				writeAdminError(w, http.StatusUnauthorized, errUnauthorized)
+				return
+			}
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// adminError is a static admin API error.
+type adminError string
+
+func (e adminError) Error() string { return string(e) }
+
+const (
+	errMethodNotAllowed adminError = "method not allowed"
+	errUnauthorized     adminError = "unauthorized"
+)
+
+// paymentQueryFromRequest parses ledger filters from the query string.
+func paymentQueryFromRequest(r *http.Request) (PaymentQuery, error) {
+	values := r.URL.Query()
+	query := PaymentQuery{
+		PaymentID: values.Get("payment_id"),
+		Resource:  values.Get("resource"),
+		Payer:     values.Get("payer"),
+		Status:    values.Get("status"),
+	}
+	if v := values.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			return query, adminError("invalid limit: " + v)
+		}
+		query.Limit = limit
+	}
+	for name, target := range map[string]*time.Time{"since": &query.Since, "until": &query.Until} {
+		if v := values.Get(name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return query, adminError("invalid " + name + ": " + v)
+			}
+			*target = t
+		}
+	}
+	return query, nil
+}
+
+// emptyIfNil makes nil slices encode as [] instead of null.
+func emptyIfNil[T any](items []T) []T {
+	if items == nil {
+		return []T{}
+	}
+	return items
+}
+
+// writeAdminJSON sends a 200 JSON response.
+func writeAdminJSON(w http.ResponseWriter, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(data)
+}
+
+// writeAdminError sends a JSON error response.
+func writeAdminError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,219 @@
+package serverx402
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/openlibx402/go/openlibx402-core"
+)
+
+// Audit log decisions.
+const (
+	AuditIssued   = "issued"   // A 402 response issued a payment request
+	AuditAccepted = "accepted" // A payment was accepted
+	AuditRejected = "rejected" // A request was rejected
+)
+
+// AuditEntry is a payment decision recorded in an AuditLog.
+//
+// Hash is the SHA-256 of the entry's JSON encoding without it, which
+// includes PrevHash, the Hash of the entry before it: changing, removing, or
+// reordering entries breaks the chain (see VerifyAuditLog).
+type AuditEntry struct {
+	Seq       uint64    `json:"seq"`
+	Time      time.Time `json:"time"`
+	Decision  string    `json:"decision"`
+	Resource  string    `json:"resource"`
+	Payer     string    `json:"payer,omitempty"`
+	PaymentID string    `json:"payment_id,omitempty"`
+	Amount    string    `json:"amount,omitempty"`
+	TokenMint string    `json:"token_mint,omitempty"`
+	TxHash    string    `json:"tx_hash,omitempty"`
+	Status    int       `json:"status,omitempty"` // HTTP status of a rejection
+	Code      string    `json:"code,omitempty"`   // Error code of a rejection
+	Reason    string    `json:"reason,omitempty"` // Why the request was rejected
+	PrevHash  string    `json:"prev_hash"`
+	Hash      string    `json:"hash"`
+}
+
+// hash returns the hash of the entry.
+func (e AuditEntry) hash() string {
+	e.Hash = ""
+	data, _ := json.Marshal(e)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// AuditLog is an append-only, hash-chained log of payment decisions, kept
+// as JSON lines in a file (see Config.AuditLog). Anchor the Hash of the
+// latest entry elsewhere now and then, e.g. in another system's logs, to
+// also detect a log that was rewritten as a whole.
+type AuditLog struct {
+	mu   sync.Mutex
+	file *os.File
+	last AuditEntry
+}
+
+// OpenAuditLog opens the audit log at path, creating it if needed. New
+// entries continue the chain of the existing ones.
+func OpenAuditLog(path string) (*AuditLog, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	log := &AuditLog{file: file}
+	err = readAuditLog(file, func(entry AuditEntry) error {
+		log.last = entry
+		return nil
+	})
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to read audit log %s: %w", path, err)
+	}
+	return log, nil
+}
+
+// Record appends an entry to the log, setting its Seq, Time, and hashes.
+func (l *AuditLog) Record(entry AuditEntry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	entry.Seq = l.last.Seq + 1
+	entry.Time = time.Now().UTC()
+	entry.PrevHash = l.last.Hash
+	entry.Hash = entry.hash()
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if _, err := l.file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	l.last = entry
+	return nil
+}
+
+// Verify checks the hash chain of the whole log (see VerifyAuditLog).
+func (l *AuditLog) Verify() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return VerifyAuditLog(l.file)
+}
+
+// Export writes the entries recorded between since and until (zero values
+// are unbounded) to w as JSON lines, unchanged, so that the export can be
+// checked with VerifyAuditLog.
+func (l *AuditLog) Export(w io.Writer, since, until time.Time) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return readAuditLog(l.file, func(entry AuditEntry) error {
+		if (!since.IsZero() && entry.Time.Before(since)) || (!until.IsZero() && !entry.Time.Before(until)) {
+			return nil
+		}
+		data, _ := json.Marshal(entry)
+		_, err := w.Write(append(data, '\n'))
+		return err
+	})
+}
+
+// Close closes the log file.
+func (l *AuditLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file.Close()
+}
+
+// VerifyAuditLog checks the hash chain of an audit log, or of an export of
+// consecutive entries from one: each entry must hash to its Hash and follow
+// the one before it. The error names the first entry that does not.
+func VerifyAuditLog(r io.Reader) error {
+	var prev *AuditEntry
+	return readAuditLog(r, func(entry AuditEntry) error {
+		if entry.hash() != entry.Hash {
+			return fmt.Errorf("audit entry %d was modified: its hash does not match", entry.Seq)
+		}
+		if prev != nil && (entry.Seq != prev.Seq+1 || entry.PrevHash != prev.Hash) {
+			return fmt.Errorf("audit entry %d does not follow entry %d: entries were removed or reordered", entry.Seq, prev.Seq)
+		}
+		prev = &entry
+		return nil
+	})
+}
+
+// readAuditLog decodes the entries of an audit log in order.
+func readAuditLog(r io.Reader, fn func(entry AuditEntry) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var entry AuditEntry
+		decoder := json.NewDecoder(bytes.NewReader(scanner.Bytes()))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&entry); err != nil {
+			return fmt.Errorf("invalid audit entry on line %d: %w", line, err)
+		}
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// audit records the decision of the pipeline on a request in
+// Config.AuditLog: a payment request issued, a payment accepted, or a
+// rejection. Requests proceeding without a new payment are not recorded.
+func (s *Server) audit(req Request, result *Result) {
+	log := s.config().AuditLog
+	if log == nil {
+		return
+	}
+	entry := AuditEntry{Resource: req.Resource, Payer: result.Payer}
+	switch {
+	case result.PaymentRequest != nil:
+		entry.Decision = AuditIssued
+		entry.PaymentID = result.PaymentRequest.PaymentID
+		entry.Amount = result.PaymentRequest.MaxAmountRequired
+		entry.TokenMint = result.PaymentRequest.AssetAddress
+	case !result.Allowed():
+		entry.Decision = AuditRejected
+		entry.Status, entry.Code, entry.Reason = result.Status, result.Code, result.Message
+		if detail, ok := result.Details["message"].(string); ok {
+			entry.Reason += ": " + detail
+		}
+	case result.Authorization != nil:
+		entry.Decision = AuditAccepted
+	default:
+		return
+	}
+	authorization := result.Authorization
+	if authorization == nil && entry.Decision == AuditRejected {
+		// Rejections name the payment they were for, if any
+		authorization, _ = core.PaymentAuthorizationFromHeader(req.Header(s.config().AuthorizationHeader))
+	}
+	if authorization != nil {
+		entry.Payer = authorization.PublicKey
+		entry.PaymentID = authorization.PaymentID
+		entry.Amount = authorization.ActualAmount
+		entry.TokenMint = authorization.AssetAddress
+		entry.TxHash = authorization.TransactionHash
+	}
+	if err := log.Record(entry); err != nil && !errors.Is(err, os.ErrClosed) {
+		s.logger.Error("x402: failed to record audit entry", "decision", entry.Decision, core.LogKeyResource, req.Resource, "error", err)
+	}
+}
@@ -0,0 +1,151 @@
+package serverx402
+
+import (
+	"container/list"
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/openlibx402/go/openlibx402-core"
+)
+
+// VerificationCache remembers transactions that were verified on-chain so that
+// repeated requests carrying the same authorization do not hit the RPC node.
+// An authorization pays for one request, so repeats are rejected as used
+// after verification (see Config.NonceStore).
+//
+// Implementations must be safe for concurrent use. Errors are treated as cache
+// misses; verification falls back to the RPC node.
+type VerificationCache interface {
+	// Verified reports whether key was marked verified and has not expired.
+	Verified(ctx context.Context, key string) (bool, error)
+	// MarkVerified records key as verified for ttl.
+	MarkVerified(ctx context.Context, key string, ttl time.Duration) error
+}
+
+// verificationKey identifies a verified transfer. It covers every field checked
+// on-chain so a cached hash cannot satisfy a different requirement, payer or,
+// with memo checks, a different payment request.
+func verificationKey(requirement *Requirement, authorization *core.PaymentAuthorization) string {
+	return strings.Join([]string{
+		authorization.TransactionHash,
+		authorization.PaymentID,
+		authorization.PublicKey,
+		requirement.PaymentAddress,
+		requirement.TokenMint,
+		authorization.ActualAmount,
+	}, "|")
+}
+
+// MemoryVerificationCache is an in-process LRU cache with per-entry expiry.
+type MemoryVerificationCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	order      *list.List
+	entries    map[string]*list.Element
+}
+
+// memoryEntry is an element of the MemoryVerificationCache LRU list.
+type memoryEntry struct {
+	key       string
+	expiresAt time.Time
+}
+
+// NewMemoryVerificationCache creates an in-memory cache holding at most
+// maxEntries transactions (default: 10000). The least recently used entry is
+// evicted when the cache is full.
+func NewMemoryVerificationCache(maxEntries int) *MemoryVerificationCache {
+	if maxEntries <= 0 {
+		maxEntries = 10000
+	}
+	return &MemoryVerificationCache{
+		maxEntries: maxEntries,
+		order:      list.New(),
+		entries:    make(map[string]*list.Element),
+	}
+}
+
+// Verified implements VerificationCache.
+func (c *MemoryVerificationCache) Verified(ctx context.Context, key string) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return false, nil
+	}
+	if time.Now().After(elem.Value.(*memoryEntry).expiresAt) {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+		return false, nil
+	}
+	c.order.MoveToFront(elem)
+	return true, nil
+}
+
+// MarkVerified implements VerificationCache.
+func (c *MemoryVerificationCache) MarkVerified(ctx context.Context, key string, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expiresAt := time.Now().Add(ttl)
+	if elem, ok := c.entries[key]; ok {
+		elem.Value.(*memoryEntry).expiresAt = expiresAt
+		c.order.MoveToFront(elem)
+		return nil
+	}
+
+	c.entries[key] = c.order.PushFront(&memoryEntry{key: key, expiresAt: expiresAt})
+	for c.order.Len() > c.maxEntries {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*memoryEntry).key)
+	}
+	return nil
+}
+
+// RedisClient is the subset of a Redis client used by RedisVerificationCache.
+//
+// It keeps this package free of a Redis dependency. With go-redis:
+//
+//	type goRedis struct{ *redis.Client }
+//
+//	func (r goRedis) Exists(ctx context.Context, key string) (bool, error) {
+//	    n, err := r.Client.Exists(ctx, key).Result()
+//	    return n > 0, err
+//	}
+//
+//	func (r goRedis) SetEx(ctx context.Context, key, value string, ttl time.Duration) error {
+//	    return r.Client.SetEx(ctx, key, value, ttl).Err()
+//	}
+type RedisClient interface {
+	Exists(ctx context.Context, key string) (bool, error)
+	SetEx(ctx context.Context, key, value string, ttl time.Duration) error
+}
+
+// RedisVerificationCache stores verified transactions in Redis so the cache is
+// shared by every server instance.
+type RedisVerificationCache struct {
+	client RedisClient
+	prefix string
+}
+
+// NewRedisVerificationCache creates a Redis-backed cache. Keys are stored
+// under prefix (default: "x402:verified:").
+func NewRedisVerificationCache(client RedisClient, prefix string) *RedisVerificationCache {
+	if prefix == "" {
+		prefix = "x402:verified:"
+	}
+	return &RedisVerificationCache{client: client, prefix: prefix}
+}
+
+// Verified implements VerificationCache.
+func (c *RedisVerificationCache) Verified(ctx context.Context, key string) (bool, error) {
+	return c.client.Exists(ctx, c.prefix+key)
+}
+
+// MarkVerified implements VerificationCache.
+func (c *RedisVerificationCache) MarkVerified(ctx context.Context, key string, ttl time.Duration) error {
+	return c.client.SetEx(ctx, c.prefix+key, "1", ttl)
+}
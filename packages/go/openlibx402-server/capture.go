@@ -0,0 +1,96 @@
+package serverx402
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/openlibx402/go/openlibx402-core"
+)
+
+// CapturedHeader carries the amount captured of a held payment (see
+// Options.Capture). Adapters send it as a trailer if the handler captures
+// after the response header was written.
+const CapturedHeader = core.DefaultCapturedHeader
+
+// Errors returned by Server.Capture.
+var (
+	ErrNotHeld         = errors.New("request was not paid with a held payment")
+	ErrAlreadyCaptured = errors.New("payment was already captured")
+)
+
+// Capture charges amount of a held payment (see Options.Capture) once the
+// cost of the request is known, and refunds the rest of the hold to the
+// payer. It returns the refund, or nil if the whole hold was captured. A
+// payment that is never captured is charged in full.
+//
+// Each payment is captured once; amount must not exceed the hold. The
+// refund is sent by Config.RefundProcessor and bounded by
+// Config.SettlementTimeout.
+func (s *Server) Capture(ctx context.Context, result *Result, amount string) (*core.Refund, error) {
+	if result == nil || result.Authorization == nil || result.VerifiedAmount == "" || result.Requirement == nil || !result.Requirement.Capture {
+		return nil, ErrNotHeld
+	}
+	if result.Captured != "" {
+		return nil, ErrAlreadyCaptured
+	}
+	captured, ok := new(big.Rat).SetString(amount)
+	if !ok || captured.Sign() < 0 {
+		return nil, fmt.Errorf("invalid capture amount: %q", amount)
+	}
+	held := parseAmount(result.VerifiedAmount)
+	if captured.Cmp(held) > 0 {
+		return nil, fmt.Errorf("capture of %s exceeds the hold of %s", amount, formatAmount(held))
+	}
+
+	rest := new(big.Rat).Sub(held, captured)
+	if rest.Sign() == 0 {
+		result.Captured = formatAmount(captured)
+		s.logger.Info("x402: captured held payment", "authorization", result.Authorization, core.LogKeyAmount, result.Captured)
+		return nil, nil
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), s.config().SettlementTimeout)
+	defer cancel()
+	refund, err := s.Refund(ctx, result.Authorization, formatAmount(rest), "captured "+formatAmount(captured)+" of the hold")
+	if err != nil {
+		return nil, err
+	}
+	result.Captured = formatAmount(captured)
+	s.logger.Info("x402: captured held payment", "authorization", result.Authorization, core.LogKeyAmount, result.Captured, core.LogKeyTxHash, refund.TransactionHash)
+	return refund, nil
+}
+
+// AddUnits records n units consumed by the request, for requests priced
+// with Options.UnitPricing. It is safe for concurrent use, e.g. by a
+// handler streaming tokens.
+func (r *Result) AddUnits(n int64) {
+	r.units.Add(n)
+}
+
+// Units returns the units recorded with AddUnits.
+func (r *Result) Units() int64 {
+	return r.units.Load()
+}
+
+// CaptureUnits captures the price of the units the handler reported with
+// Result.AddUnits, for requests priced with Options.UnitPricing, and
+// refunds the rest of the hold (see Capture). Units beyond MaxUnits are not
+// charged, as the payer did not authorize them. Adapters call it once the
+// handler returns.
+func (s *Server) CaptureUnits(ctx context.Context, result *Result) (*core.Refund, error) {
+	if result == nil || result.Requirement == nil || result.Requirement.Units == nil {
+		return nil, ErrNotHeld
+	}
+	pricing := result.Requirement.Units
+	units := result.Units()
+	if units < 0 {
+		units = 0
+	}
+	if units > pricing.MaxUnits {
+		s.logger.Warn("x402: request used more units than its hold covers", core.LogKeyResource, result.Requirement.Resource, "units", units, "max_units", pricing.MaxUnits)
+		units = pricing.MaxUnits
+	}
+	cost := new(big.Rat).Mul(parseAmount(pricing.PricePerUnit), new(big.Rat).SetInt64(units))
+	return s.Capture(ctx, result, formatAmount(cost))
+}
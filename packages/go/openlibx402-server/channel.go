@@ -0,0 +1,308 @@
+package serverx402
+
+import (
+	"context"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/openlibx402/go/openlibx402-core"
+)
+
+// Channel is a payment channel: a deposit paid on-chain whose balance pays
+// later requests to the same payment address with signed vouchers (see
+// Options.ChannelDeposit).
+type Channel struct {
+	ID             string    `json:"id"` // Payment ID of the deposit
+	Payer          string    `json:"payer"`
+	PaymentAddress string    `json:"payment_address"`
+	TokenMint      string    `json:"token_mint"`
+	Deposit        string    `json:"deposit"`
+	Spent          string    `json:"spent"` // Amount of the latest accepted voucher
+	OpenedAt       time.Time `json:"opened_at"`
+	ExpiresAt      time.Time `json:"expires_at"`
+	// Authorization is the deposit payment, which the unspent balance is
+	// refunded against.
+	Authorization *core.PaymentAuthorization `json:"authorization"`
+}
+
+// ChannelStore tracks open payment channels.
+//
+// Implementations must be safe for concurrent use.
+type ChannelStore interface {
+	// Open records a new channel.
+	Open(ctx context.Context, channel *Channel) error
+	// Channel returns an open channel, or nil if it is unknown or closed.
+	Channel(ctx context.Context, id string) (*Channel, error)
+	// Spend raises the amount spent from a channel from spent to amount. It
+	// returns false if the channel is closed or no longer at spent, as when
+	// a concurrent voucher was accepted first.
+	Spend(ctx context.Context, id, spent, amount string) (bool, error)
+	// Close removes a channel and returns it, or nil if it was already
+	// closed, so that only one caller settles it.
+	Close(ctx context.Context, id string) (*Channel, error)
+	// Expired returns the open channels that expired before t.
+	Expired(ctx context.Context, t time.Time) ([]*Channel, error)
+}
+
+// MemoryChannelStore is an in-process ChannelStore. Channels are never
+// evicted, since they hold deposits, only closed. Server instances sharing a
+// load balancer need a shared store, or clients must be routed to the
+// instance that opened their channel.
+type MemoryChannelStore struct {
+	mu       sync.Mutex
+	channels map[string]*Channel
+	path     string // State file set by PersistTo
+}
+
+// NewMemoryChannelStore creates an empty in-memory channel store.
+func NewMemoryChannelStore() *MemoryChannelStore {
+	return &MemoryChannelStore{channels: make(map[string]*Channel)}
+}
+
+// Open implements ChannelStore.
+func (s *MemoryChannelStore) Open(ctx context.Context, channel *Channel) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored := *channel
+	s.channels[channel.ID] = &stored
+	return nil
+}
+
+// Channel implements ChannelStore.
+func (s *MemoryChannelStore) Channel(ctx context.Context, id string) (*Channel, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	channel, ok := s.channels[id]
+	if !ok {
+		return nil, nil
+	}
+	found := *channel
+	return &found, nil
+}
+
+// Spend implements ChannelStore.
+func (s *MemoryChannelStore) Spend(ctx context.Context, id, spent, amount string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	channel, ok := s.channels[id]
+	if !ok || channel.Spent != spent {
+		return false, nil
+	}
+	channel.Spent = amount
+	return true, nil
+}
+
+// Close implements ChannelStore.
+func (s *MemoryChannelStore) Close(ctx context.Context, id string) (*Channel, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	channel, ok := s.channels[id]
+	if !ok {
+		return nil, nil
+	}
+	delete(s.channels, id)
+	return channel, nil
+}
+
+// Expired implements ChannelStore.
+func (s *MemoryChannelStore) Expired(ctx context.Context, t time.Time) ([]*Channel, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var expired []*Channel
+	for _, channel := range s.channels {
+		if channel.ExpiresAt.Before(t) {
+			found := *channel
+			expired = append(expired, &found)
+		}
+	}
+	return expired, nil
+}
+
+// channelSettler closes expired channels in the background.
+type channelSettler struct {
+	once sync.Once
+	stop chan struct{}
+	done chan struct{}
+}
+
+// channelResult returns an allowed result if the request carries a voucher
+// that pays the requirement from an open channel, or nil. An invalid voucher
+// is rejected; one that does not pay enough, e.g. because the channel is
+// exhausted, falls back to requiring payment, which may open a new channel.
+// A voucher with Close set closes the channel after it is applied.
+func (s *Server) channelResult(req Request, requirement *Requirement) *Result {
+	if requirement.ChannelDeposit == "" {
+		return nil
+	}
+	header := req.Header(s.config().VoucherHeader)
+	if header == "" {
+		return nil
+	}
+	voucher, err := core.VoucherFromHeader(header)
+	if err != nil {
+		return reject(http.StatusBadRequest, "INVALID_PAYMENT_REQUEST", "Invalid payment voucher", map[string]interface{}{
+			"message": err.Error(),
+		})
+	}
+	if err := voucher.Verify(); err != nil {
+		return reject(http.StatusForbidden, "PAYMENT_VERIFICATION_FAILED", "Invalid payment voucher", map[string]interface{}{
+			"message": err.Error(),
+		})
+	}
+
+	channel, err := s.config().ChannelStore.Channel(req.Context, voucher.ChannelID)
+	if err != nil {
+		// Fall back to requiring payment
+		s.logger.Error("x402: channel lookup failed", "channel", voucher.ChannelID, "error", err)
+		return nil
+	}
+	if channel == nil || time.Now().After(channel.ExpiresAt) || s.IsFlagged(channel.Payer) {
+		return nil
+	}
+	if voucher.PublicKey != channel.Payer {
+		return reject(http.StatusForbidden, "PAYMENT_VERIFICATION_FAILED", "Voucher not signed by the channel payer", map[string]interface{}{
+			"channel_id": channel.ID,
+		})
+	}
+	priced := *requirement
+	selectToken(&priced, channel.TokenMint)
+	if channel.PaymentAddress != priced.PaymentAddress || channel.TokenMint != priced.TokenMint {
+		return nil
+	}
+
+	// The voucher must raise the amount spent by at least the price, within
+	// the deposit. A closing voucher may pay nothing: it only closes the
+	// channel, and the request must be paid otherwise.
+	amount := parseAmount(voucher.Amount)
+	charge := new(big.Rat).Sub(amount, parseAmount(channel.Spent))
+	balance := new(big.Rat).Sub(parseAmount(channel.Deposit), amount)
+	paid := charge.Cmp(parseAmount(priced.Amount)) >= 0
+	if charge.Sign() < 0 || balance.Sign() < 0 || (!paid && !voucher.Close) {
+		return nil
+	}
+	if result := s.checkPayer(req.Context, channel.Payer); result != nil {
+		return result
+	}
+	spent, err := s.config().ChannelStore.Spend(req.Context, channel.ID, channel.Spent, voucher.Amount)
+	if err != nil {
+		s.logger.Error("x402: failed to record voucher", "channel", channel.ID, core.LogKeyAmount, voucher.Amount, "error", err)
+		return nil
+	}
+	if !spent {
+		return nil
+	}
+	s.logger.Debug("x402: voucher accepted", core.LogKeyPayer, channel.Payer, core.LogKeyResource, priced.Resource, "channel", channel.ID, core.LogKeyAmount, formatAmount(charge))
+
+	if voucher.Close || balance.Sign() == 0 {
+		s.settleChannel(req.Context, channel.ID)
+	}
+	if !paid {
+		return nil
+	}
+	return &Result{Requirement: &priced, Payer: channel.Payer, ChannelID: channel.ID, ChannelBalance: formatAmount(balance)}
+}
+
+// openChannel opens a channel with the deposit of a result verified
+// on-chain, the paid request being its first charge, and returns it. The
+// channel belongs to the payer the deposit debited.
+func (s *Server) openChannel(ctx context.Context, requirement *Requirement, result *Result) (*Channel, error) {
+	now := time.Now().UTC()
+	channel := &Channel{
+		ID:             result.Authorization.PaymentID,
+		Payer:          result.Payer,
+		PaymentAddress: requirement.PaymentAddress,
+		TokenMint:      requirement.TokenMint,
+		Deposit:        result.VerifiedAmount,
+		Spent:          requirement.Amount,
+		OpenedAt:       now,
+		ExpiresAt:      now.Add(s.config().ChannelTTL),
+		Authorization:  result.Authorization,
+	}
+	if err := s.config().ChannelStore.Open(ctx, channel); err != nil {
+		return nil, err
+	}
+	s.settler.once.Do(s.startChannelSettler)
+	s.logger.Info("x402: payment channel opened", core.LogKeyPayer, channel.Payer, "channel", channel.ID, "deposit", channel.Deposit)
+	return channel, nil
+}
+
+// CloseChannel closes a payment channel and refunds the unspent deposit to
+// the payer with Config.RefundProcessor. Vouchers for the channel are no
+// longer accepted. It returns nil and no error if the channel was already
+// closed.
+//
+// Channels are closed by a voucher with Close set, once their deposit is
+// spent, and when they expire after Config.ChannelTTL.
+func (s *Server) CloseChannel(ctx context.Context, id string) (*core.Refund, error) {
+	channel, err := s.config().ChannelStore.Close(ctx, id)
+	if err != nil || channel == nil {
+		return nil, err
+	}
+	unspent := new(big.Rat).Sub(parseAmount(channel.Deposit), parseAmount(channel.Spent))
+	s.logger.Info("x402: payment channel closed", core.LogKeyPayer, channel.Payer, "channel", channel.ID, "spent", channel.Spent, "unspent", formatAmount(unspent))
+	if unspent.Sign() <= 0 {
+		return nil, nil
+	}
+	// The unspent balance goes back to the payer the deposit debited
+	deposit := *channel.Authorization
+	deposit.PublicKey = channel.Payer
+	refund, err := s.Refund(ctx, &deposit, formatAmount(unspent), "payment channel closed")
+	if err != nil {
+		// The channel is gone from the store: keep what is owed in the log
+		s.logger.Error("x402: failed to refund payment channel", "channel", channel.ID, core.LogKeyPayer, channel.Payer, core.LogKeyAmount, formatAmount(unspent), "error", err)
+		return nil, err
+	}
+	return refund, nil
+}
+
+// settleChannel closes a channel in the course of a request, bounded by
+// Config.SettlementTimeout. Failures are logged.
+func (s *Server) settleChannel(ctx context.Context, id string) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), s.config().SettlementTimeout)
+	defer cancel()
+	s.CloseChannel(ctx, id)
+}
+
+// startChannelSettler starts closing expired channels every minute.
+func (s *Server) startChannelSettler() {
+	s.settler.stop = make(chan struct{})
+	s.settler.done = make(chan struct{})
+	go func() {
+		defer close(s.settler.done)
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.settler.stop:
+				return
+			case <-ticker.C:
+				s.settleExpiredChannels()
+			}
+		}
+	}()
+}
+
+// settleExpiredChannels closes the channels that expired.
+func (s *Server) settleExpiredChannels() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	expired, err := s.config().ChannelStore.Expired(ctx, time.Now())
+	if err != nil {
+		s.logger.Error("x402: expired channel lookup failed", "error", err)
+		return
+	}
+	for _, channel := range expired {
+		s.settleChannel(ctx, channel.ID)
+	}
+}
+
+// stopChannelSettler stops closing expired channels, if it was started.
+func (s *Server) stopChannelSettler() {
+	s.settler.once.Do(func() {})
+	if s.settler.stop != nil {
+		close(s.settler.stop)
+		<-s.settler.done
+	}
+}
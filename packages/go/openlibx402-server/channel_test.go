@@ -0,0 +1,36 @@
+package serverx402
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/openlibx402/go/openlibx402-core"
+)
+
+func TestChannelBelongsToOnChainPayer(t *testing.T) {
+	s, mock := newTestServer(t, &Config{
+		AutoVerify:      true,
+		RefundProcessor: core.NewSolanaPaymentProcessor("http://127.0.0.1:0", nil),
+	})
+	opts := Options{Amount: "0.01", ChannelDeposit: "1.00"}
+	payer := solana.NewWallet().PublicKey().String()
+
+	// The deposit is paid in place of the price
+	paymentReq := issue(t, s, "/data", opts)
+	paymentReq.MaxAmountRequired = opts.ChannelDeposit
+	result := paid(s, "/data", pay(t, mock, paymentReq, payer), opts)
+	if !result.Allowed() || result.ChannelID == "" {
+		t.Fatalf("got %d %s %v, want a channel", result.Status, result.Code, result.Details)
+	}
+	channel, err := s.config().ChannelStore.Channel(context.Background(), result.ChannelID)
+	if err != nil || channel == nil {
+		t.Fatalf("channel lookup: %v, %v", channel, err)
+	}
+	if channel.Payer != payer || channel.Authorization.PublicKey != payer {
+		t.Errorf("channel payer = %s, want %s", channel.Payer, payer)
+	}
+	if core.CompareAmounts(channel.Deposit, opts.ChannelDeposit) != 0 {
+		t.Errorf("channel deposit = %s, want %s", channel.Deposit, opts.ChannelDeposit)
+	}
+}
@@ -0,0 +1,275 @@
+package serverx402
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/openlibx402/go/openlibx402-core"
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix prefixes the environment variables read by ConfigFromEnv.
+const EnvPrefix = "X402_"
+
+// configFile holds the settings ConfigFromFile and ConfigFromEnv read. Each
+// is the file key of its tags, and the environment variable EnvPrefix
+// followed by the key in upper case.
+type configFile struct {
+	PaymentAddress  string   `json:"payment_address" yaml:"payment_address"`
+	TokenMint       string   `json:"token_mint" yaml:"token_mint"`
+	Network         string   `json:"network" yaml:"network"`
+	RPCURL          string   `json:"rpc_url" yaml:"rpc_url"`
+	RPCURLs         []string `json:"rpc_urls" yaml:"rpc_urls"`
+	RPCWebSocketURL string   `json:"rpc_websocket_url" yaml:"rpc_websocket_url"`
+	AutoVerify      *bool    `json:"auto_verify" yaml:"auto_verify"`
+	Commitment      string   `json:"commitment" yaml:"commitment"`
+
+	NonceStore          string   `json:"nonce_store" yaml:"nonce_store"`
+	NonceTTL            duration `json:"nonce_ttl" yaml:"nonce_ttl"`
+	SessionTTL          duration `json:"session_ttl" yaml:"session_ttl"`
+	MaxAuthorizationAge duration `json:"max_authorization_age" yaml:"max_authorization_age"`
+	RequirePaymentMemo  bool     `json:"require_payment_memo" yaml:"require_payment_memo"`
+	RequireAttestation  bool     `json:"require_attestation" yaml:"require_attestation"`
+	StrictTokens        bool     `json:"strict_tokens" yaml:"strict_tokens"`
+	BlockedPayers       []string `json:"blocked_payers" yaml:"blocked_payers"`
+	AllowedPayers       []string `json:"allowed_payers" yaml:"allowed_payers"`
+
+	SolanaPay      bool   `json:"solana_pay" yaml:"solana_pay"`
+	ProblemDetails bool   `json:"problem_details" yaml:"problem_details"`
+	HTMLPaywall    bool   `json:"html_paywall" yaml:"html_paywall"`
+	WalletPaywall  bool   `json:"wallet_paywall" yaml:"wallet_paywall"`
+	PaywallRPCURL  string `json:"paywall_rpc_url" yaml:"paywall_rpc_url"`
+	PaywallQRCode  bool   `json:"paywall_qr_code" yaml:"paywall_qr_code"`
+}
+
+// duration is a time.Duration written as a string such as "10m".
+type duration time.Duration
+
+func (d *duration) set(s string) error {
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q (use e.g. \"30s\" or \"10m\")", s)
+	}
+	*d = duration(parsed)
+	return nil
+}
+
+func (d *duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("invalid duration %s (use e.g. \"30s\" or \"10m\")", data)
+	}
+	return d.set(s)
+}
+
+func (d *duration) UnmarshalYAML(value *yaml.Node) error {
+	return d.set(value.Value)
+}
+
+// ConfigFromFile reads a Config from a JSON, YAML, or TOML file, by its
+// extension (.json, .yaml, .yml, .toml). For example:
+//
+//	payment_address: "YOUR_WALLET_ADDRESS"
+//	network: "solana-mainnet"
+//	rpc_url: "https://my-rpc.example.com"
+//	nonce_store: "memory"
+//	session_ttl: "10m"
+//
+// The keys are those of ConfigFromEnv in lower case, without the prefix;
+// unknown keys are an error. payment_address is required. token_mint
+// defaults to USDC of the network (see core.USDC), auto_verify to true, and
+// nonce_store "memory" sets a MemoryNonceStore. TOML files may hold
+// top-level keys only. The Config is checked with Config.Validate.
+func ConfigFromFile(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	var file configFile
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = decodeJSONConfig(data, &file)
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err = decoder.Decode(&file); errors.Is(err, io.EOF) {
+			err = nil // An empty file
+		}
+	case ".toml":
+		var values map[string]interface{}
+		if values, err = parseTOML(string(data)); err == nil {
+			encoded, _ := json.Marshal(values)
+			err = decodeJSONConfig(encoded, &file)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported config format: %s (use .json, .yaml, .yml, or .toml)", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config %s: %w", path, err)
+	}
+	config, err := file.config()
+	if err != nil {
+		return nil, fmt.Errorf("config %s: %w", path, err)
+	}
+	return config, nil
+}
+
+// decodeJSONConfig decodes a JSON config, rejecting unknown keys.
+func decodeJSONConfig(data []byte, file *configFile) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(file)
+}
+
+// ConfigFromEnv reads a Config from environment variables:
+//
+//	X402_PAYMENT_ADDRESS      Wallet receiving payments (required)
+//	X402_TOKEN_MINT           Token mint (default: USDC of the network)
+//	X402_NETWORK              e.g. solana-mainnet (default: solana-devnet)
+//	X402_RPC_URL              RPC endpoint (default: the network's public one)
+//	X402_RPC_URLS             Further RPC endpoints, comma-separated
+//	X402_RPC_WEBSOCKET_URL    RPC WebSocket endpoint
+//	X402_AUTO_VERIFY          Verify payments on-chain (default: true)
+//	X402_COMMITMENT           processed, confirmed, or finalized
+//	X402_NONCE_STORE          "memory" to bind payments to issued requests
+//	X402_NONCE_TTL            e.g. 24h
+//	X402_SESSION_TTL          e.g. 10m
+//	X402_MAX_AUTHORIZATION_AGE
+//	X402_REQUIRE_PAYMENT_MEMO, X402_REQUIRE_ATTESTATION, X402_STRICT_TOKENS
+//	X402_BLOCKED_PAYERS       Payer public keys to reject, comma-separated
+//	X402_ALLOWED_PAYERS       The only payer public keys to accept
+//	X402_SOLANA_PAY, X402_PROBLEM_DETAILS, X402_HTML_PAYWALL,
+//	X402_WALLET_PAYWALL, X402_PAYWALL_RPC_URL, X402_PAYWALL_QR_CODE
+//
+// Booleans are parsed with strconv.ParseBool, durations with
+// time.ParseDuration. Unset variables keep the defaults of ConfigFromFile.
+func ConfigFromEnv() (*Config, error) {
+	var file configFile
+	value := reflect.ValueOf(&file).Elem()
+	for i := 0; i < value.NumField(); i++ {
+		key := strings.Split(value.Type().Field(i).Tag.Get("json"), ",")[0]
+		name := EnvPrefix + strings.ToUpper(key)
+		env, ok := os.LookupEnv(name)
+		if !ok || env == "" {
+			continue
+		}
+		if err := setEnvField(value.Field(i), env); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	config, err := file.config()
+	if err != nil {
+		return nil, fmt.Errorf("environment: %w", err)
+	}
+	return config, nil
+}
+
+// setEnvField sets a configFile field from an environment variable.
+func setEnvField(field reflect.Value, env string) error {
+	switch target := field.Addr().Interface().(type) {
+	case *string:
+		*target = env
+	case *[]string:
+		for _, item := range strings.Split(env, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				*target = append(*target, item)
+			}
+		}
+	case *bool:
+		b, err := strconv.ParseBool(env)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q (use true or false)", env)
+		}
+		*target = b
+	case **bool:
+		b, err := strconv.ParseBool(env)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q (use true or false)", env)
+		}
+		*target = &b
+	case *duration:
+		return target.set(env)
+	default:
+		panic("serverx402: unsupported config field type " + field.Type().String())
+	}
+	return nil
+}
+
+// config converts the settings to a validated Config, applying their
+// defaults.
+func (f *configFile) config() (*Config, error) {
+	if f.PaymentAddress == "" {
+		return nil, fmt.Errorf("payment_address is required (set payment_address in a config file, or %sPAYMENT_ADDRESS)", EnvPrefix)
+	}
+	network := f.Network
+	if network == "" {
+		network = "solana-devnet"
+	}
+	tokenMint := f.TokenMint
+	if tokenMint == "" {
+		if tokenMint = core.USDC(network); tokenMint == "" {
+			return nil, fmt.Errorf("token_mint is required: %s has no USDC mint in the token registry", network)
+		}
+	}
+	config := &Config{
+		PaymentAddress:      f.PaymentAddress,
+		TokenMint:           tokenMint,
+		Network:             network,
+		RPCURL:              f.RPCURL,
+		RPCURLs:             f.RPCURLs,
+		RPCWebSocketURL:     f.RPCWebSocketURL,
+		AutoVerify:          f.AutoVerify == nil || *f.AutoVerify,
+		NonceTTL:            time.Duration(f.NonceTTL),
+		SessionTTL:          time.Duration(f.SessionTTL),
+		MaxAuthorizationAge: time.Duration(f.MaxAuthorizationAge),
+		RequirePaymentMemo:  f.RequirePaymentMemo,
+		RequireAttestation:  f.RequireAttestation,
+		StrictTokens:        f.StrictTokens,
+		SolanaPay:           f.SolanaPay,
+		ProblemDetails:      f.ProblemDetails,
+		HTMLPaywall:         f.HTMLPaywall,
+		WalletPaywall:       f.WalletPaywall,
+		PaywallRPCURL:       f.PaywallRPCURL,
+		PaywallQRCode:       f.PaywallQRCode,
+		Commitment:          core.Commitment(f.Commitment),
+	}
+	for _, list := range []struct {
+		key    string
+		payers []string
+		field  *PayerList
+	}{
+		{"blocked_payers", f.BlockedPayers, &config.BlockedPayers},
+		{"allowed_payers", f.AllowedPayers, &config.AllowedPayers},
+	} {
+		for _, payer := range list.payers {
+			if _, err := solana.PublicKeyFromBase58(payer); err != nil {
+				return nil, fmt.Errorf("%s: %q is not a base58 Solana address: %v", list.key, payer, err)
+			}
+		}
+		if len(list.payers) > 0 {
+			*list.field = NewMemoryPayerList(list.payers...)
+		}
+	}
+	switch f.NonceStore {
+	case "":
+	case "memory":
+		config.NonceStore = NewMemoryNonceStore(0)
+	default:
+		return nil, fmt.Errorf("invalid nonce_store %q (use memory, or set a NonceStore in code)", f.NonceStore)
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
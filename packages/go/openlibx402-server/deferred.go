@@ -0,0 +1,213 @@
+package serverx402
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/openlibx402/go/openlibx402-core"
+)
+
+// Debt is a payment a deferred payer owes for a response it was served
+// before paying (see Config.DeferredPayers).
+type Debt struct {
+	Payer          string
+	PaymentRequest *core.PaymentRequest
+	DueAt          time.Time
+	// Defaulted is set once DueAt passed without payment. The payer is
+	// then downgraded until reinstated.
+	Defaulted bool
+}
+
+// debt is an unpaid deferred payment and its default timer.
+type debt struct {
+	Debt
+	requirement *Requirement
+	timer       *time.Timer
+}
+
+// deferral tracks the debts of deferred payers.
+type deferral struct {
+	mu          sync.Mutex
+	trusted     map[string]bool
+	debts       map[string]*debt // by payment ID
+	outstanding map[string]int   // debts within their window, by payer
+	downgraded  map[string]bool
+}
+
+func newDeferral(payers []string) *deferral {
+	d := &deferral{
+		trusted:     make(map[string]bool),
+		debts:       make(map[string]*debt),
+		outstanding: make(map[string]int),
+		downgraded:  make(map[string]bool),
+	}
+	for _, payer := range payers {
+		d.trusted[payer] = true
+	}
+	return d
+}
+
+// deferPayment serves a request of a trusted payer without payment and
+// records the debt, or returns nil if the payer must pay upfront.
+func (s *Server) deferPayment(req Request, requirement *Requirement) *Result {
+	d := s.deferral
+	if d == nil || !req.Deferrable {
+		return nil
+	}
+	payer := req.Header(s.config().PayerHeader)
+	d.mu.Lock()
+	allowed := d.trusted[payer] && !d.downgraded[payer] && d.outstanding[payer] < s.config().MaxDeferredDebts
+	if allowed {
+		// Reserved before the payment request is issued, so concurrent
+		// requests cannot exceed MaxDeferredDebts
+		d.outstanding[payer]++
+	}
+	d.mu.Unlock()
+	if !allowed {
+		return nil
+	}
+
+	// The payment request must stay payable for the whole window
+	owed := *requirement
+	owed.ExpiresIn = int(math.Ceil(s.config().DeferredWindow.Seconds()))
+	paymentReq, err := s.IssuePaymentRequest(req.Context, &owed)
+	if err != nil {
+		d.mu.Lock()
+		d.outstanding[payer]--
+		d.mu.Unlock()
+		return nil
+	}
+
+	entry := &debt{
+		Debt:        Debt{Payer: payer, PaymentRequest: paymentReq, DueAt: time.Now().UTC().Add(s.config().DeferredWindow)},
+		requirement: &owed,
+	}
+	d.mu.Lock()
+	d.debts[paymentReq.PaymentID] = entry
+	entry.timer = time.AfterFunc(s.config().DeferredWindow, func() { s.defaultDebt(paymentReq.PaymentID) })
+	d.mu.Unlock()
+
+	s.logger.Info("x402: payment deferred", core.LogKeyPayer, payer, core.LogKeyResource, requirement.Resource, "request", paymentReq)
+	s.emit(Event{Type: EventPaymentDeferred, Resource: requirement.Resource, PaymentRequest: paymentReq})
+	return &Result{Requirement: requirement, Deferred: paymentReq}
+}
+
+// settleDebt verifies an authorization paying a deferred payment. It returns
+// nil if the authorization is not for a debt, and otherwise a 204 result if
+// the debt was paid or the rejection.
+func (s *Server) settleDebt(ctx context.Context, authorization *core.PaymentAuthorization) *Result {
+	d := s.deferral
+	if d == nil {
+		return nil
+	}
+	d.mu.Lock()
+	entry, ok := d.debts[authorization.PaymentID]
+	d.mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	owed := *entry.requirement
+	selectToken(&owed, authorization.AssetAddress)
+	result := s.verifyAndReport(ctx, &owed, authorization)
+	result.Requirement = &owed
+	if !result.Allowed() {
+		return result
+	}
+
+	d.mu.Lock()
+	if _, ok := d.debts[authorization.PaymentID]; ok {
+		delete(d.debts, authorization.PaymentID)
+		entry.timer.Stop()
+		if !entry.Defaulted {
+			d.outstanding[entry.Payer]--
+		}
+	}
+	d.mu.Unlock()
+	s.logger.Info("x402: deferred payment settled", core.LogKeyPayer, entry.Payer, "authorization", authorization)
+
+	// The response was served already
+	result.Status = http.StatusNoContent
+	return result
+}
+
+// defaultDebt downgrades the payer of a debt that was not paid in time.
+func (s *Server) defaultDebt(paymentID string) {
+	d := s.deferral
+	d.mu.Lock()
+	entry, ok := d.debts[paymentID]
+	if !ok || entry.Defaulted {
+		d.mu.Unlock()
+		return
+	}
+	entry.Defaulted = true
+	d.outstanding[entry.Payer]--
+	d.downgraded[entry.Payer] = true
+	defaulted := entry.Debt
+	d.mu.Unlock()
+
+	s.logger.Warn("x402: deferred payment defaulted, payer downgraded to prepay", core.LogKeyPayer, defaulted.Payer, "request", defaulted.PaymentRequest)
+	s.emit(Event{Type: EventPaymentDefaulted, Resource: defaulted.PaymentRequest.Resource, PaymentRequest: defaulted.PaymentRequest})
+	if s.config().OnDeferredDefault != nil {
+		s.config().OnDeferredDefault(defaulted)
+	}
+}
+
+// Debts returns the unpaid deferred payments, oldest first, including
+// defaulted ones.
+func (s *Server) Debts() []Debt {
+	if s.deferral == nil {
+		return nil
+	}
+	s.deferral.mu.Lock()
+	defer s.deferral.mu.Unlock()
+	debts := make([]Debt, 0, len(s.deferral.debts))
+	for _, entry := range s.deferral.debts {
+		debts = append(debts, entry.Debt)
+	}
+	sort.Slice(debts, func(i, j int) bool { return debts[i].DueAt.Before(debts[j].DueAt) })
+	return debts
+}
+
+// IsDowngraded reports whether a deferred payer must pay upfront after
+// defaulting.
+func (s *Server) IsDowngraded(pubkey string) bool {
+	if s.deferral == nil {
+		return false
+	}
+	s.deferral.mu.Lock()
+	defer s.deferral.mu.Unlock()
+	return s.deferral.downgraded[pubkey]
+}
+
+// Reinstate lets a downgraded payer defer payment again and forgets its
+// defaulted debts, e.g. after they were paid out of band.
+func (s *Server) Reinstate(pubkey string) {
+	if s.deferral == nil {
+		return
+	}
+	s.deferral.mu.Lock()
+	defer s.deferral.mu.Unlock()
+	delete(s.deferral.downgraded, pubkey)
+	for paymentID, entry := range s.deferral.debts {
+		if entry.Payer == pubkey && entry.Defaulted {
+			delete(s.deferral.debts, paymentID)
+		}
+	}
+}
+
+// stopDeferral stops the default timers of unpaid debts.
+func (s *Server) stopDeferral() {
+	if s.deferral == nil {
+		return
+	}
+	s.deferral.mu.Lock()
+	defer s.deferral.mu.Unlock()
+	for _, entry := range s.deferral.debts {
+		entry.timer.Stop()
+	}
+}
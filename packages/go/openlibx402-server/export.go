@@ -0,0 +1,153 @@
+package serverx402
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"strconv"
+	"time"
+)
+
+// ExportOptions selects the payments exported by ExportPaymentsCSV and
+// ExportPaymentsParquet, and how they are valued in fiat.
+type ExportOptions struct {
+	// Since and Until bound the time the payments were verified (zero
+	// values are unbounded).
+	Since time.Time
+	Until time.Time
+
+	// Oracle optionally values each payment in Currency at the time it was
+	// verified, adding the currency, rate, and fiat_amount columns. It must
+	// implement HistoricalPriceOracle. Currency defaults to USD.
+	Oracle   PriceOracle
+	Currency string
+	// RateInterval is the precision of the valuation: the rate of a token
+	// is looked up once per interval, at its start (default: 1 hour).
+	RateInterval time.Duration
+}
+
+// exportColumns are the columns of payment exports, followed by
+// exportFiatColumns with an oracle.
+var (
+	exportColumns     = []string{"payment_id", "verified_at", "payer", "resource", "amount", "token_mint", "payment_address", "network", "tx_hash"}
+	exportFiatColumns = []string{"currency", "rate", "fiat_amount"}
+)
+
+// ExportPaymentsCSV writes the verified payments recorded in store to w as
+// CSV, oldest first, with a header row. Times are in RFC 3339 and amounts
+// are exact decimals; fiat amounts are rounded to 2 decimals. For example:
+//
+//	file, err := os.Create("payments-2025-01.csv")
+//	if err != nil {
+//	    return err
+//	}
+//	defer file.Close()
+//	err = serverx402.ExportPaymentsCSV(ctx, store, file, serverx402.ExportOptions{
+//	    Since:  time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+//	    Until:  time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC),
+//	    Oracle: &serverx402.CoinGeckoOracle{APIKey: os.Getenv("COINGECKO_API_KEY")},
+//	})
+func ExportPaymentsCSV(ctx context.Context, store PaymentStore, w io.Writer, opts ExportOptions) error {
+	header, records, rows, err := exportPayments(ctx, store, opts)
+	if err != nil {
+		return err
+	}
+	writer := csv.NewWriter(w)
+	writer.Write(header)
+	for i, row := range rows {
+		row[1] = records[i].CreatedAt.UTC().Format(time.RFC3339)
+		writer.Write(row)
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// ExportPaymentsParquet writes the verified payments recorded in store to w
+// as a Parquet file with the columns of ExportPaymentsCSV. verified_at is a
+// timestamp in milliseconds; the other columns are UTF-8 strings, so that
+// amounts stay exact.
+func ExportPaymentsParquet(ctx context.Context, store PaymentStore, w io.Writer, opts ExportOptions) error {
+	header, records, rows, err := exportPayments(ctx, store, opts)
+	if err != nil {
+		return err
+	}
+	columns := make([]parquetColumn, len(header))
+	for i, name := range header {
+		columns[i].name = name
+		if i == 1 {
+			columns[i].millis = make([]int64, len(records))
+			for j, record := range records {
+				columns[i].millis[j] = record.CreatedAt.UnixMilli()
+			}
+			continue
+		}
+		columns[i].strings = make([]string, len(rows))
+		for j, row := range rows {
+			columns[i].strings[j] = row[i]
+		}
+	}
+	return writeParquet(w, columns, len(rows))
+}
+
+// exportPayments lists the payments to export, oldest first, and returns
+// the columns and the rows of their values. The second column, the time,
+// is left for the caller to format.
+func exportPayments(ctx context.Context, store PaymentStore, opts ExportOptions) ([]string, []PaymentRecord, [][]string, error) {
+	var oracle HistoricalPriceOracle
+	if opts.Oracle != nil {
+		var ok bool
+		if oracle, ok = opts.Oracle.(HistoricalPriceOracle); !ok {
+			return nil, nil, nil, fmt.Errorf("oracle %T cannot value past payments: it does not implement HistoricalPriceOracle", opts.Oracle)
+		}
+	}
+	currency := opts.Currency
+	if currency == "" {
+		currency = "USD"
+	}
+	interval := opts.RateInterval
+	if interval <= 0 {
+		interval = time.Hour
+	}
+
+	records, err := store.ListPayments(ctx, PaymentQuery{Since: opts.Since, Until: opts.Until, Status: PaymentStatusVerified, Limit: -1})
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to list payments: %w", err)
+	}
+	for i, j := 0, len(records)-1; i < j; i, j = i+1, j-1 {
+		records[i], records[j] = records[j], records[i]
+	}
+
+	header := exportColumns
+	if oracle != nil {
+		header = append(append([]string{}, exportColumns...), exportFiatColumns...)
+	}
+	type rateKey struct {
+		mint string
+		at   time.Time
+	}
+	rates := make(map[rateKey]float64)
+	rows := make([][]string, len(records))
+	for i, record := range records {
+		row := []string{record.PaymentID, "", record.Payer, record.Resource, record.Amount, record.TokenMint, record.PaymentAddress, record.Network, record.TxHash}
+		if oracle != nil {
+			key := rateKey{record.TokenMint, record.CreatedAt.Truncate(interval)}
+			rate, ok := rates[key]
+			if !ok {
+				if rate, err = oracle.RateAt(ctx, key.mint, currency, key.at); err != nil {
+					return nil, nil, nil, fmt.Errorf("failed to value payment %s: %w", record.PaymentID, err)
+				}
+				if math.IsNaN(rate) || math.IsInf(rate, 0) {
+					return nil, nil, nil, fmt.Errorf("failed to value payment %s: invalid rate %v", record.PaymentID, rate)
+				}
+				rates[key] = rate
+			}
+			fiat := new(big.Rat).Mul(parseAmount(record.Amount), new(big.Rat).SetFloat64(rate))
+			row = append(row, currency, strconv.FormatFloat(rate, 'f', -1, 64), fiat.FloatString(2))
+		}
+		rows[i] = row
+	}
+	return header, records, rows, nil
+}
@@ -0,0 +1,105 @@
+package serverx402
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/openlibx402/go/openlibx402-core"
+)
+
+// addInvoice adds a Lightning invoice for the requirement's price in
+// satoshis to a payment request, if Config.Lightning is set. The payment
+// request is issued without one if the node cannot create it, so that it can
+// still be paid on-chain.
+func (s *Server) addInvoice(ctx context.Context, requirement *Requirement, paymentReq *core.PaymentRequest) {
+	if s.config().Lightning == nil || requirement.LightningSats <= 0 {
+		return
+	}
+	description := core.PaymentMemo(paymentReq.PaymentID)
+	if paymentReq.Description != "" {
+		description = paymentReq.Description + " (" + description + ")"
+	}
+	invoice, err := s.config().Lightning.CreateInvoice(ctx, requirement.LightningSats*1000, description, time.Until(paymentReq.ExpiresAt))
+	if err != nil {
+		s.logger.Error("x402: failed to create Lightning invoice", core.LogKeyPaymentID, paymentReq.PaymentID, "error", err)
+		return
+	}
+	paymentReq.Lightning = &core.LightningTerms{
+		Invoice:     invoice.Invoice,
+		PaymentHash: invoice.PaymentHash,
+		AmountMsat:  invoice.AmountMsat,
+	}
+}
+
+// lightningResult returns the result of a request carrying a proof of payment
+// of a Lightning invoice in the Lightning header, or nil if it carries none.
+// The preimage must match the invoice of a payment request issued for the
+// resource, and the node must report the invoice as settled for at least the
+// current price.
+func (s *Server) lightningResult(req Request, requirement *Requirement) *Result {
+	header := req.Header(s.config().LightningHeader)
+	if header == "" || s.config().Lightning == nil {
+		return nil
+	}
+	proof, err := core.LightningProofFromHeader(header)
+	if err != nil {
+		return reject(http.StatusBadRequest, "INVALID_PAYMENT_REQUEST", "Invalid Lightning payment proof", map[string]interface{}{
+			"message": err.Error(),
+		})
+	}
+	issued, err := s.config().NonceStore.Issued(req.Context, proof.PaymentID)
+	if err != nil {
+		s.logger.Error("x402: issued payment request lookup failed", core.LogKeyPaymentID, proof.PaymentID, "error", err)
+		return reject(http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "Payment verification is temporarily unavailable", nil)
+	}
+	if issued == nil || issued.Lightning == nil {
+		return reject(http.StatusForbidden, "PAYMENT_VERIFICATION_FAILED", "Unknown payment ID", map[string]interface{}{
+			"payment_id": proof.PaymentID,
+		})
+	}
+	if issued.Resource != requirement.Resource {
+		return reject(http.StatusForbidden, "PAYMENT_VERIFICATION_FAILED", "Payment ID was issued for a different resource", nil)
+	}
+	if issued.Lightning.AmountMsat < requirement.LightningSats*1000 {
+		return reject(http.StatusForbidden, "PAYMENT_VERIFICATION_FAILED", "Invoice amount is below the current price", nil)
+	}
+	if !proof.Verify(issued.Lightning.PaymentHash) {
+		return reject(http.StatusForbidden, "PAYMENT_VERIFICATION_FAILED", "Invalid payment preimage", nil)
+	}
+
+	invoice, err := s.config().Lightning.LookupInvoice(req.Context, issued.Lightning.PaymentHash)
+	if err != nil {
+		s.logger.Error("x402: Lightning invoice lookup failed", core.LogKeyPaymentID, proof.PaymentID, "payment_hash", issued.Lightning.PaymentHash, "error", err)
+		return reject(http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "Payment verification is temporarily unavailable", nil)
+	}
+	authorization := &core.PaymentAuthorization{
+		PaymentID:       proof.PaymentID,
+		ActualAmount:    strconv.FormatInt(invoice.AmountPaidMsat/1000, 10),
+		PaymentAddress:  issued.PaymentAddress,
+		AssetAddress:    core.LightningAsset,
+		Network:         issued.Network,
+		Timestamp:       time.Now().UTC(),
+		TransactionHash: issued.Lightning.PaymentHash,
+	}
+	result := &Result{Authorization: authorization, Requirement: requirement, VerifiedAmount: authorization.ActualAmount}
+	switch {
+	case !invoice.Settled:
+		result = reject(http.StatusForbidden, "PAYMENT_VERIFICATION_FAILED", "Lightning invoice is not settled", nil)
+	case invoice.AmountPaidMsat < issued.Lightning.AmountMsat:
+		result = reject(http.StatusForbidden, "PAYMENT_VERIFICATION_FAILED", "Insufficient payment amount", map[string]interface{}{
+			"required_msat": issued.Lightning.AmountMsat,
+			"paid_msat":     invoice.AmountPaidMsat,
+		})
+	default:
+		if rejection := s.consume(req.Context, authorization); rejection != nil {
+			result = rejection
+		}
+	}
+	s.report(requirement, authorization, result)
+	if result.Allowed() && s.config().SessionTTL > 0 {
+		result.SessionToken = s.issueSession(requirement.Resource, "")
+	}
+	return result
+}
@@ -0,0 +1,158 @@
+package serverx402
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/openlibx402/go/openlibx402-core"
+)
+
+// Media types a result that is not allowed can be rendered as.
+const (
+	ContentTypeJSON = "application/json"
+	ContentTypeCBOR = "application/cbor"
+	ContentTypeHTML = "text/html; charset=utf-8"
+)
+
+// Response renders a result that is not allowed for a request's Accept
+// header, returning the content type and body to send with result.Status.
+//
+// The body is JSON by default: the Result.Body, or RFC 9457 problem details if
+// Config.ProblemDetails is set. Clients accepting application/cbor, such as
+// constrained devices, get the same body as CBOR. Browsers, whose Accept
+// header prefers text/html, get an HTML paywall page for 402 responses if
+// Config.HTMLPaywall, Config.WalletPaywall, or Config.PaywallQRCode is set. Adapters should send
+// "Vary: Accept" with it.
+//
+// Example:
+//
+//	contentType, body, err := server.Response(result, r.Header.Get("Accept"))
+//	if err != nil {
+//	    http.Error(w, err.Error(), http.StatusInternalServerError)
+//	    return
+//	}
+//	w.Header().Set("Content-Type", contentType)
+//	w.Header().Add("Vary", "Accept")
+//	w.WriteHeader(result.Status)
+//	w.Write(body)
+func (s *Server) Response(result *Result, accept string) (contentType string, body []byte, err error) {
+	jsonType := ContentTypeJSON
+	var value interface{} = result.Body()
+	if s.config().ProblemDetails {
+		jsonType = core.ProblemContentType
+		value = result.Problem(s.config().ProblemTypeBase)
+	}
+
+	switch negotiate(accept, s.responseOffers(result, jsonType)) {
+	case ContentTypeCBOR:
+		body, err = encodeCBOR(value)
+		return ContentTypeCBOR, body, err
+	case ContentTypeHTML:
+		var buf bytes.Buffer
+		err = s.paywallTemplate().Execute(&buf, s.paywallData(result))
+		return ContentTypeHTML, buf.Bytes(), err
+	}
+	body, err = json.Marshal(value)
+	return jsonType, body, err
+}
+
+// HTTPResponse renders a result that is not allowed for an HTTP request,
+// returning the status, content type, and body to send. It is Response with
+// Config.Build402 and Config.BuildRejection applied: the result is rendered
+// as the status and body the hook returns, in JSON or CBOR, except as an
+// HTML paywall page.
+func (s *Server) HTTPResponse(r *http.Request, result *Result) (status int, contentType string, body []byte, err error) {
+	accept := r.Header.Get("Accept")
+	contentType = negotiate(accept, s.responseOffers(result, ContentTypeJSON))
+	var value interface{}
+	switch config := s.config(); {
+	case contentType == ContentTypeHTML:
+		contentType, body, err = s.Response(result, accept)
+		return result.Status, contentType, body, err
+	case result.PaymentRequest != nil && config.Build402 != nil:
+		status, value = config.Build402(r, result.PaymentRequest)
+	case result.PaymentRequest == nil && config.BuildRejection != nil:
+		status, value = config.BuildRejection(r, result)
+	default:
+		contentType, body, err = s.Response(result, accept)
+		return result.Status, contentType, body, err
+	}
+
+	if status == 0 {
+		status = result.Status
+	}
+	if contentType == ContentTypeCBOR {
+		body, err = encodeCBOR(value)
+	} else {
+		body, err = json.Marshal(value)
+	}
+	return status, contentType, body, err
+}
+
+// responseOffers returns the media types a result can be rendered as, with
+// JSON as jsonType.
+func (s *Server) responseOffers(result *Result, jsonType string) []string {
+	offers := []string{jsonType, ContentTypeCBOR}
+	if (s.config().HTMLPaywall || s.config().WalletPaywall || s.config().PaywallQRCode) && result.PaymentRequest != nil {
+		offers = append(offers, ContentTypeHTML)
+	}
+	return offers
+}
+
+// negotiate returns the offer an Accept header ranks highest, preferring
+// earlier offers on ties. Without an acceptable offer it returns the first,
+// as most APIs do rather than responding 406.
+func negotiate(accept string, offers []string) string {
+	best, bestQ := offers[0], 0.0
+	for _, offer := range offers {
+		if q := acceptQuality(accept, offer); q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best
+}
+
+// acceptQuality returns the quality an Accept header gives a media type: that
+// of the most specific matching range, 1 if the header is empty, or 0 if no
+// range matches.
+func acceptQuality(accept, offer string) float64 {
+	if strings.TrimSpace(accept) == "" {
+		return 1
+	}
+	offerType, _, _ := mime.ParseMediaType(offer)
+	offerMain, _, _ := strings.Cut(offerType, "/")
+
+	q, specificity := 0.0, -1
+	for _, part := range strings.Split(accept, ",") {
+		mediaRange, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		main, sub, _ := strings.Cut(mediaRange, "/")
+		var rank int
+		switch {
+		case mediaRange == offerType:
+			rank = 2
+		case sub == "*" && main == offerMain:
+			rank = 1
+		case mediaRange == "*/*":
+			rank = 0
+		default:
+			continue
+		}
+		if rank <= specificity {
+			continue
+		}
+		specificity, q = rank, 1
+		if value, ok := params["q"]; ok {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				q = parsed
+			}
+		}
+	}
+	return q
+}
@@ -0,0 +1,53 @@
+package serverx402
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+
+	"github.com/openlibx402/go/openlibx402-core"
+)
+
+// networkCheck remembers the outcome of checking that the RPC endpoint serves
+// the configured network.
+type networkCheck struct {
+	mu   sync.Mutex
+	done bool
+	err  error
+}
+
+// checkNetwork checks that payments of a requirement can be verified on the
+// RPC endpoint: the requirement must be on the configured network, and the
+// endpoint must serve it, which is checked once by its genesis hash if the
+// processor implements core.NetworkChecker. An endpoint that cannot be
+// reached is checked again on the next request.
+func (s *Server) checkNetwork(ctx context.Context, requirement *Requirement) *Result {
+	if requirement.Network != s.config().Network {
+		return reject(http.StatusInternalServerError, "CONFIGURATION_ERROR", "Network "+requirement.Network+" differs from the network of the RPC endpoint, "+s.config().Network, nil)
+	}
+	checker, ok := s.processor.(core.NetworkChecker)
+	if !ok {
+		return nil
+	}
+
+	s.network.mu.Lock()
+	defer s.network.mu.Unlock()
+	if !s.network.done {
+		err := checker.CheckNetwork(ctx, s.config().Network)
+		var mismatch *core.NetworkMismatchError
+		switch {
+		case errors.As(err, &mismatch):
+			s.logger.Error("x402: RPC endpoint serves another network", core.LogKeyNetwork, s.config().Network, "genesis_hash", mismatch.GenesisHash)
+			s.network.done, s.network.err = true, err
+		case err != nil:
+			s.logger.Warn("x402: RPC network check failed", core.LogKeyNetwork, s.config().Network, "error", err)
+		default:
+			s.network.done = true
+		}
+	}
+	if s.network.err != nil {
+		return reject(http.StatusInternalServerError, "CONFIGURATION_ERROR", s.network.err.Error(), nil)
+	}
+	return nil
+}
@@ -0,0 +1,237 @@
+package serverx402
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/openlibx402/go/openlibx402-core"
+)
+
+// NonceStore remembers the payment requests the server issued, so that
+// authorizations can be bound to them (see Config.NonceStore).
+//
+// Implementations must be safe for concurrent use.
+type NonceStore interface {
+	// Issue records an issued payment request for ttl.
+	Issue(ctx context.Context, request *core.PaymentRequest, ttl time.Duration) error
+	// Issued returns the issued payment request with paymentID, or nil if it
+	// was never issued or has expired.
+	Issued(ctx context.Context, paymentID string) (*core.PaymentRequest, error)
+	// Consume marks the payment of paymentID, made with the transaction
+	// txHash unless it is empty, as used for ttl, and reports whether both
+	// were unused; otherwise it marks neither. It must be atomic, so that of
+	// concurrent requests with the same authorization only one is served.
+	Consume(ctx context.Context, paymentID, txHash string, ttl time.Duration) (bool, error)
+}
+
+// MemoryNonceStore is an in-process NonceStore with per-entry expiry.
+type MemoryNonceStore struct {
+	mu         sync.Mutex
+	maxEntries int
+	order      *list.List
+	entries    map[string]*list.Element
+	usedOrder  *list.List // Consumed payments, apart so that issuing cannot evict them
+	used       map[string]*list.Element
+	path       string // State file set by PersistTo
+}
+
+// nonceEntry is an element of the MemoryNonceStore list, oldest last.
+type nonceEntry struct {
+	request   *core.PaymentRequest
+	expiresAt time.Time
+}
+
+// usedEntry is an element of the consumed payment list, oldest last. Its key
+// is a payment ID or transaction hash, prefixed by usedKeys.
+type usedEntry struct {
+	key       string
+	expiresAt time.Time
+}
+
+// usedKeys returns the keys a payment is consumed under: its payment ID and
+// its transaction hash, in separate namespaces so that a payment ID cannot
+// consume a transaction.
+func usedKeys(paymentID, txHash string) []string {
+	keys := []string{"used:" + paymentID}
+	if txHash != "" {
+		keys = append(keys, "tx:"+txHash)
+	}
+	return keys
+}
+
+// NewMemoryNonceStore creates an in-memory store holding at most maxEntries
+// payment requests and as many consumed payments (default: 100000). The
+// oldest entry is evicted when the store is full. Use a shared store such as
+// RedisNonceStore when several server instances issue payment requests.
+func NewMemoryNonceStore(maxEntries int) *MemoryNonceStore {
+	if maxEntries <= 0 {
+		maxEntries = 100000
+	}
+	return &MemoryNonceStore{
+		maxEntries: maxEntries,
+		order:      list.New(),
+		entries:    make(map[string]*list.Element),
+		usedOrder:  list.New(),
+		used:       make(map[string]*list.Element),
+	}
+}
+
+// Issue implements NonceStore.
+func (s *MemoryNonceStore) Issue(ctx context.Context, request *core.PaymentRequest, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if elem, ok := s.entries[request.PaymentID]; ok {
+		s.order.Remove(elem)
+	}
+	s.entries[request.PaymentID] = s.order.PushFront(&nonceEntry{request: request, expiresAt: time.Now().Add(ttl)})
+	for s.order.Len() > s.maxEntries {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.entries, oldest.Value.(*nonceEntry).request.PaymentID)
+	}
+	return nil
+}
+
+// Issued implements NonceStore.
+func (s *MemoryNonceStore) Issued(ctx context.Context, paymentID string) (*core.PaymentRequest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	elem, ok := s.entries[paymentID]
+	if !ok {
+		return nil, nil
+	}
+	entry := elem.Value.(*nonceEntry)
+	if time.Now().After(entry.expiresAt) {
+		s.order.Remove(elem)
+		delete(s.entries, paymentID)
+		return nil, nil
+	}
+	return entry.request, nil
+}
+
+// Consume implements NonceStore.
+func (s *MemoryNonceStore) Consume(ctx context.Context, paymentID, txHash string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	keys := usedKeys(paymentID, txHash)
+	for _, key := range keys {
+		if elem, ok := s.used[key]; ok && now.Before(elem.Value.(*usedEntry).expiresAt) {
+			return false, nil
+		}
+	}
+	for _, key := range keys {
+		if elem, ok := s.used[key]; ok {
+			s.usedOrder.Remove(elem)
+		}
+		s.used[key] = s.usedOrder.PushFront(&usedEntry{key: key, expiresAt: now.Add(ttl)})
+	}
+	for s.usedOrder.Len() > s.maxEntries {
+		oldest := s.usedOrder.Back()
+		s.usedOrder.Remove(oldest)
+		delete(s.used, oldest.Value.(*usedEntry).key)
+	}
+	return true, nil
+}
+
+// RedisNonceClient is the subset of a Redis client used by RedisNonceStore.
+// Get must return "" and a nil error for a missing key; with go-redis:
+//
+//	func (r goRedis) Get(ctx context.Context, key string) (string, error) {
+//	    value, err := r.Client.Get(ctx, key).Result()
+//	    if errors.Is(err, redis.Nil) {
+//	        return "", nil
+//	    }
+//	    return value, err
+//	}
+//
+// Eval runs the script consuming payments, as for RedisRateLimitClient.
+type RedisNonceClient interface {
+	RedisClient
+	Get(ctx context.Context, key string) (string, error)
+	Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error)
+}
+
+// consumeScript sets the keys KEYS for ARGV[1] milliseconds unless one of
+// them exists, and returns 1 if it set them, in one step so that concurrent
+// requests cannot both consume a payment.
+const consumeScript = `
+for _, key in ipairs(KEYS) do
+  if redis.call('EXISTS', key) == 1 then
+    return 0
+  end
+end
+for _, key in ipairs(KEYS) do
+  redis.call('SET', key, '1', 'PX', ARGV[1])
+end
+return 1
+`
+
+// RedisNonceStore stores issued payment requests in Redis so that every
+// server instance accepts authorizations for requests issued by the others.
+type RedisNonceStore struct {
+	client RedisNonceClient
+	prefix string
+}
+
+// NewRedisNonceStore creates a Redis-backed store. Requests are stored under
+// prefix (default: "x402:issued:"), and consumed payment IDs and transaction
+// hashes under prefix followed by "used:" and "tx:". With Redis Cluster, put
+// a hash tag in the prefix, e.g. "{x402}:issued:", so that a payment's keys
+// are consumed together.
+func NewRedisNonceStore(client RedisNonceClient, prefix string) *RedisNonceStore {
+	if prefix == "" {
+		prefix = "x402:issued:"
+	}
+	return &RedisNonceStore{client: client, prefix: prefix}
+}
+
+// Issue implements NonceStore.
+func (s *RedisNonceStore) Issue(ctx context.Context, request *core.PaymentRequest, ttl time.Duration) error {
+	data, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	return s.client.SetEx(ctx, s.prefix+request.PaymentID, string(data), ttl)
+}
+
+// Issued implements NonceStore.
+func (s *RedisNonceStore) Issued(ctx context.Context, paymentID string) (*core.PaymentRequest, error) {
+	value, err := s.client.Get(ctx, s.prefix+paymentID)
+	if err != nil || value == "" {
+		return nil, err
+	}
+	var request core.PaymentRequest
+	if err := json.Unmarshal([]byte(value), &request); err != nil {
+		return nil, err
+	}
+	return &request, nil
+}
+
+// Consume implements NonceStore.
+func (s *RedisNonceStore) Consume(ctx context.Context, paymentID, txHash string, ttl time.Duration) (bool, error) {
+	keys := usedKeys(paymentID, txHash)
+	for i := range keys {
+		keys[i] = s.prefix + keys[i]
+	}
+	reply, err := s.client.Eval(ctx, consumeScript, keys, strconv.FormatInt(ttl.Milliseconds(), 10))
+	if err != nil {
+		return false, err
+	}
+	switch set := reply.(type) {
+	case int64:
+		return set == 1, nil
+	case int:
+		return set == 1, nil
+	default:
+		return false, fmt.Errorf("unexpected consume reply %T", reply)
+	}
+}
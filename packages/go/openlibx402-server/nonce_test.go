@@ -0,0 +1,274 @@
+package serverx402
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/openlibx402/go/openlibx402-core"
+)
+
+func TestMemoryNonceStoreConsume(t *testing.T) {
+	store := NewMemoryNonceStore(0)
+	ctx := context.Background()
+
+	if unused, err := store.Consume(ctx, "a", "", time.Minute); err != nil || !unused {
+		t.Fatalf("first Consume = %v, %v; want true", unused, err)
+	}
+	if unused, _ := store.Consume(ctx, "a", "", time.Minute); unused {
+		t.Error("second Consume of the same payment ID = true, want false")
+	}
+	if unused, _ := store.Consume(ctx, "b", "", time.Minute); !unused {
+		t.Error("Consume of another payment ID = false, want true")
+	}
+}
+
+func TestMemoryNonceStoreConsumeTransaction(t *testing.T) {
+	store := NewMemoryNonceStore(0)
+	ctx := context.Background()
+
+	if unused, _ := store.Consume(ctx, "a", "tx1", time.Minute); !unused {
+		t.Fatal("first Consume = false, want true")
+	}
+	if unused, _ := store.Consume(ctx, "b", "tx1", time.Minute); unused {
+		t.Error("Consume of a used transaction with another payment ID = true, want false")
+	}
+	// The rejected payment ID was not consumed
+	if unused, _ := store.Consume(ctx, "b", "tx2", time.Minute); !unused {
+		t.Error("Consume of a payment ID rejected before = false, want true")
+	}
+	// Payment IDs and transaction hashes do not collide
+	if unused, _ := store.Consume(ctx, "tx3", "a", time.Minute); !unused {
+		t.Error("Consume of a payment ID named like a used transaction = false, want true")
+	}
+}
+
+func TestMemoryNonceStoreConsumeExpires(t *testing.T) {
+	store := NewMemoryNonceStore(0)
+	ctx := context.Background()
+
+	store.Consume(ctx, "a", "", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	if unused, _ := store.Consume(ctx, "a", "", time.Minute); !unused {
+		t.Error("Consume after expiry = false, want true")
+	}
+}
+
+func TestMemoryNonceStoreConsumeConcurrent(t *testing.T) {
+	store := NewMemoryNonceStore(0)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	var consumed atomic.Int32
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if unused, _ := store.Consume(ctx, "a", "", time.Minute); unused {
+				consumed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := consumed.Load(); n != 1 {
+		t.Errorf("%d concurrent Consume calls succeeded, want 1", n)
+	}
+}
+
+func TestMemoryNonceStorePersistsConsumed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nonces.json")
+	ctx := context.Background()
+
+	store := NewMemoryNonceStore(0)
+	if err := store.PersistTo(path); err != nil {
+		t.Fatal(err)
+	}
+	store.Consume(ctx, "a", "tx1", time.Minute)
+	if err := store.Persist(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	restarted := NewMemoryNonceStore(0)
+	if err := restarted.PersistTo(path); err != nil {
+		t.Fatal(err)
+	}
+	if unused, _ := restarted.Consume(ctx, "b", "tx1", time.Minute); unused {
+		t.Error("transaction consumed before the restart was unused after it")
+	}
+}
+
+func TestProcessRejectsReplayedAuthorization(t *testing.T) {
+	for _, nonces := range []NonceStore{nil, NewMemoryNonceStore(0)} {
+		s, mock := newTestServer(t, &Config{AutoVerify: true, NonceStore: nonces})
+		opts := Options{Amount: "0.10"}
+
+		paymentReq := issue(t, s, "/data", opts)
+		header := pay(t, mock, paymentReq, solana.NewWallet().PublicKey().String())
+		if result := paid(s, "/data", header, opts); !result.Allowed() {
+			t.Fatalf("paid request: got %d %s, want allowed", result.Status, result.Code)
+		}
+		result := paid(s, "/data", header, opts)
+		if result.Allowed() || result.Status != http.StatusForbidden || result.Code != "PAYMENT_ALREADY_USED" {
+			t.Errorf("NonceStore %T: replay got %d %s, want 403 PAYMENT_ALREADY_USED", nonces, result.Status, result.Code)
+		}
+	}
+}
+
+func TestProcessRejectsReplayedAuthorizationFromCache(t *testing.T) {
+	s, mock := newTestServer(t, &Config{AutoVerify: true, VerificationCache: NewMemoryVerificationCache(0)})
+	opts := Options{Amount: "0.10"}
+
+	paymentReq := issue(t, s, "/data", opts)
+	header := pay(t, mock, paymentReq, solana.NewWallet().PublicKey().String())
+	if result := paid(s, "/data", header, opts); !result.Allowed() {
+		t.Fatalf("paid request: got %d %s, want allowed", result.Status, result.Code)
+	}
+	// The transaction is verified from the cache, and still consumed
+	if result := paid(s, "/data", header, opts); result.Code != "PAYMENT_ALREADY_USED" {
+		t.Errorf("replay got %d %s, want PAYMENT_ALREADY_USED", result.Status, result.Code)
+	}
+}
+
+func TestProcessRejectsReusedTransaction(t *testing.T) {
+	s, mock := newTestServer(t, &Config{AutoVerify: true, NonceStore: NewMemoryNonceStore(0)})
+	opts := Options{Amount: "0.10"}
+
+	first := issue(t, s, "/data", opts)
+	header := pay(t, mock, first, solana.NewWallet().PublicKey().String())
+	if result := paid(s, "/data", header, opts); !result.Allowed() {
+		t.Fatalf("paid request: got %d %s, want allowed", result.Status, result.Code)
+	}
+
+	// The same transaction claimed for a second payment request
+	authorization, err := core.PaymentAuthorizationFromHeader(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authorization.PaymentID = issue(t, s, "/data", opts).PaymentID
+	if result := paid(s, "/data", authorize(t, authorization), opts); result.Code != "PAYMENT_ALREADY_USED" {
+		t.Errorf("reused transaction got %d %s, want PAYMENT_ALREADY_USED", result.Status, result.Code)
+	}
+}
+
+func TestProcessServesConcurrentReplayOnce(t *testing.T) {
+	s, mock := newTestServer(t, &Config{AutoVerify: true, NonceStore: NewMemoryNonceStore(0)})
+	opts := Options{Amount: "0.10"}
+
+	paymentReq := issue(t, s, "/data", opts)
+	header := pay(t, mock, paymentReq, solana.NewWallet().PublicKey().String())
+	var wg sync.WaitGroup
+	var served atomic.Int32
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if paid(s, "/data", header, opts).Allowed() {
+				served.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := served.Load(); n != 1 {
+		t.Errorf("one payment served %d requests, want 1", n)
+	}
+}
+
+func TestProcessAsksPaywallCookieToPayAgain(t *testing.T) {
+	s, mock := newTestServer(t, &Config{AutoVerify: true, WalletPaywall: true})
+	opts := Options{Amount: "0.10"}
+
+	paymentReq := issue(t, s, "/data", opts)
+	cookie := PaywallCookie + "=" + pay(t, mock, paymentReq, solana.NewWallet().PublicKey().String())
+	request := testRequest("/data", map[string]string{"Cookie": cookie})
+	if result := s.Process(request, opts); !result.Allowed() {
+		t.Fatalf("paid request: got %d %s, want allowed", result.Status, result.Code)
+	}
+	// The browser still sends the cookie
+	result := s.Process(request, opts)
+	if result.Status != http.StatusPaymentRequired || result.PaymentRequest == nil || result.PaymentRequest.PaymentID == paymentReq.PaymentID {
+		t.Errorf("got %d %s, want 402 with a new payment request", result.Status, result.Code)
+	}
+}
+
+// fakeRedis implements RedisNonceClient in memory, running consumeScript
+// for Eval.
+type fakeRedis struct {
+	mu   sync.Mutex
+	keys map[string]string
+}
+
+func (r *fakeRedis) Exists(ctx context.Context, key string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.keys[key]
+	return ok, nil
+}
+
+func (r *fakeRedis) SetEx(ctx context.Context, key, value string, ttl time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.keys[key] = value
+	return nil
+}
+
+func (r *fakeRedis) Get(ctx context.Context, key string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.keys[key], nil
+}
+
+func (r *fakeRedis) Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error) {
+	if script != consumeScript {
+		return nil, fmt.Errorf("unexpected script")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, key := range keys {
+		if _, ok := r.keys[key]; ok {
+			return int64(0), nil
+		}
+	}
+	for _, key := range keys {
+		r.keys[key] = "1"
+	}
+	return int64(1), nil
+}
+
+func TestRedisNonceStoreConsume(t *testing.T) {
+	redis := &fakeRedis{keys: make(map[string]string)}
+	store := NewRedisNonceStore(redis, "")
+	ctx := context.Background()
+
+	if unused, err := store.Consume(ctx, "a", "tx1", time.Minute); err != nil || !unused {
+		t.Fatalf("first Consume = %v, %v; want true", unused, err)
+	}
+	if unused, _ := store.Consume(ctx, "b", "tx1", time.Minute); unused {
+		t.Error("Consume of a used transaction = true, want false")
+	}
+	for _, key := range []string{"x402:issued:used:a", "x402:issued:tx:tx1"} {
+		if _, ok := redis.keys[key]; !ok {
+			t.Errorf("key %s not set", key)
+		}
+	}
+	if _, ok := redis.keys["x402:issued:used:b"]; ok {
+		t.Error("rejected payment ID was consumed")
+	}
+}
+
+func TestProcessRejectsPaymentIssuedForLowerPrice(t *testing.T) {
+	s, mock := newTestServer(t, &Config{AutoVerify: true, NonceStore: NewMemoryNonceStore(0)})
+
+	// Prices apart by less than a float64 can tell
+	paymentReq := issue(t, s, "/data", Options{Amount: "0.100000000000000001"})
+	header := pay(t, mock, paymentReq, solana.NewWallet().PublicKey().String())
+	result := paid(s, "/data", header, Options{Amount: "0.100000000000000002"})
+	if result.Allowed() || result.Details["mismatch"] != "amount" {
+		t.Errorf("got %d %s %v, want an amount mismatch", result.Status, result.Code, result.Details)
+	}
+}
@@ -0,0 +1,343 @@
+package serverx402
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/openlibx402/go/openlibx402-core"
+)
+
+// PriceOracle converts fiat prices to token amounts (see Options.FiatAmount).
+//
+// Implementations must be safe for concurrent use.
+type PriceOracle interface {
+	// Rate returns the price of one token of mint in currency, an ISO 4217
+	// code such as "USD".
+	Rate(ctx context.Context, mint, currency string) (float64, error)
+}
+
+// HistoricalPriceOracle is a PriceOracle that also returns past prices,
+// which payment exports value payments at (see ExportOptions.Oracle).
+type HistoricalPriceOracle interface {
+	PriceOracle
+	// RateAt returns the price of one token of mint in currency at a past
+	// time.
+	RateAt(ctx context.Context, mint, currency string, at time.Time) (float64, error)
+}
+
+var (
+	_ HistoricalPriceOracle = StaticOracle(nil)
+	_ HistoricalPriceOracle = (*CoinGeckoOracle)(nil)
+	_ HistoricalPriceOracle = (*PythOracle)(nil)
+)
+
+// StaticOracle is a PriceOracle with fixed rates by token mint, in any
+// currency, e.g. for stablecoins or tests.
+type StaticOracle map[string]float64
+
+// Rate implements PriceOracle.
+func (o StaticOracle) Rate(ctx context.Context, mint, currency string) (float64, error) {
+	rate, ok := o[mint]
+	if !ok {
+		return 0, fmt.Errorf("no rate for token %s", mint)
+	}
+	return rate, nil
+}
+
+// RateAt implements HistoricalPriceOracle: rates do not change.
+func (o StaticOracle) RateAt(ctx context.Context, mint, currency string, at time.Time) (float64, error) {
+	return o.Rate(ctx, mint, currency)
+}
+
+// CoinGeckoOracle reads token prices from the CoinGecko API.
+type CoinGeckoOracle struct {
+	// BaseURL is the API endpoint (default: https://api.coingecko.com/api/v3;
+	// paid plans use https://pro-api.coingecko.com/api/v3).
+	BaseURL string
+	// APIKey is sent as the demo or, with the pro endpoint, the pro API key.
+	APIKey     string
+	HTTPClient *http.Client // HTTP client for API requests (default: 10 second timeout)
+}
+
+// Rate implements PriceOracle.
+func (o *CoinGeckoOracle) Rate(ctx context.Context, mint, currency string) (float64, error) {
+	currency = strings.ToLower(currency)
+	query := url.Values{"contract_addresses": {mint}, "vs_currencies": {currency}}
+	req, err := o.newRequest(ctx, "/simple/token_price/solana?"+query.Encode())
+	if err != nil {
+		return 0, err
+	}
+
+	var prices map[string]map[string]float64
+	if err := getOracleJSON(o.HTTPClient, req, &prices); err != nil {
+		return 0, fmt.Errorf("coingecko: %w", err)
+	}
+	for address, price := range prices {
+		// Addresses may be returned lowercased
+		if rate, ok := price[currency]; ok && strings.EqualFold(address, mint) {
+			return rate, nil
+		}
+	}
+	return 0, fmt.Errorf("coingecko: no %s price for token %s", strings.ToUpper(currency), mint)
+}
+
+// RateAt implements HistoricalPriceOracle with the price closest to at
+// within an hour of it.
+func (o *CoinGeckoOracle) RateAt(ctx context.Context, mint, currency string, at time.Time) (float64, error) {
+	query := url.Values{
+		"vs_currency": {strings.ToLower(currency)},
+		"from":        {strconv.FormatInt(at.Add(-time.Hour).Unix(), 10)},
+		"to":          {strconv.FormatInt(at.Add(time.Hour).Unix(), 10)},
+	}
+	req, err := o.newRequest(ctx, "/coins/solana/contract/"+url.PathEscape(mint)+"/market_chart/range?"+query.Encode())
+	if err != nil {
+		return 0, err
+	}
+
+	var chart struct {
+		Prices [][2]float64 `json:"prices"` // Unix milliseconds and price
+	}
+	if err := getOracleJSON(o.HTTPClient, req, &chart); err != nil {
+		return 0, fmt.Errorf("coingecko: %w", err)
+	}
+	if len(chart.Prices) == 0 {
+		return 0, fmt.Errorf("coingecko: no %s price for token %s at %s", strings.ToUpper(currency), mint, at.UTC().Format(time.RFC3339))
+	}
+	closest := chart.Prices[0]
+	for _, price := range chart.Prices {
+		if math.Abs(price[0]-float64(at.UnixMilli())) < math.Abs(closest[0]-float64(at.UnixMilli())) {
+			closest = price
+		}
+	}
+	return closest[1], nil
+}
+
+// newRequest creates a GET request for an API path.
+func (o *CoinGeckoOracle) newRequest(ctx context.Context, path string) (*http.Request, error) {
+	base := o.BaseURL
+	if base == "" {
+		base = "https://api.coingecko.com/api/v3"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(base, "/")+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if o.APIKey != "" {
+		header := "x-cg-demo-api-key"
+		if strings.Contains(base, "pro-api") {
+			header = "x-cg-pro-api-key"
+		}
+		req.Header.Set(header, o.APIKey)
+	}
+	return req, nil
+}
+
+// PythOracle reads token prices from Pyth price feeds through the Hermes
+// API. Pyth feeds are quoted in USD, so it only converts USD prices.
+type PythOracle struct {
+	// Feeds maps token mints to the IDs of their Crypto.<TOKEN>/USD price
+	// feeds, e.g. "0xeaa020c61cc479712813461ce153894a96a6c00b21ed0cfc2798d1f9a9e9c94a"
+	// for USDC.
+	Feeds map[string]string
+	// MaxAge rejects prices published longer ago (default: 1 minute).
+	MaxAge     time.Duration
+	BaseURL    string       // Hermes endpoint (default: https://hermes.pyth.network)
+	HTTPClient *http.Client // HTTP client for API requests (default: 10 second timeout)
+}
+
+// Rate implements PriceOracle.
+func (o *PythOracle) Rate(ctx context.Context, mint, currency string) (float64, error) {
+	rate, published, err := o.price(ctx, mint, currency, "latest")
+	if err != nil {
+		return 0, err
+	}
+	maxAge := o.MaxAge
+	if maxAge == 0 {
+		maxAge = time.Minute
+	}
+	if time.Since(published) > maxAge {
+		return 0, fmt.Errorf("pyth: price of feed %s is stale (published %s)", o.Feeds[mint], published.UTC().Format(time.RFC3339))
+	}
+	return rate, nil
+}
+
+// RateAt implements HistoricalPriceOracle with the price published at at.
+func (o *PythOracle) RateAt(ctx context.Context, mint, currency string, at time.Time) (float64, error) {
+	rate, _, err := o.price(ctx, mint, currency, strconv.FormatInt(at.Unix(), 10))
+	return rate, err
+}
+
+// price fetches the price of the feed of mint at a publish time, or the
+// latest one, and returns it with the time it was published.
+func (o *PythOracle) price(ctx context.Context, mint, currency, publishTime string) (float64, time.Time, error) {
+	if !strings.EqualFold(currency, "USD") {
+		return 0, time.Time{}, fmt.Errorf("pyth: unsupported currency %s", currency)
+	}
+	feed, ok := o.Feeds[mint]
+	if !ok {
+		return 0, time.Time{}, fmt.Errorf("pyth: no price feed for token %s", mint)
+	}
+	base := o.BaseURL
+	if base == "" {
+		base = "https://hermes.pyth.network"
+	}
+	query := url.Values{"ids[]": {feed}, "parsed": {"true"}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(base, "/")+"/v2/updates/price/"+publishTime+"?"+query.Encode(), nil)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+
+	var updates struct {
+		Parsed []struct {
+			Price struct {
+				Price       string `json:"price"`
+				Expo        int    `json:"expo"`
+				PublishTime int64  `json:"publish_time"`
+			} `json:"price"`
+		} `json:"parsed"`
+	}
+	if err := getOracleJSON(o.HTTPClient, req, &updates); err != nil {
+		return 0, time.Time{}, fmt.Errorf("pyth: %w", err)
+	}
+	if len(updates.Parsed) == 0 {
+		return 0, time.Time{}, fmt.Errorf("pyth: no price for feed %s", feed)
+	}
+	price := updates.Parsed[0].Price
+	mantissa, err := strconv.ParseInt(price.Price, 10, 64)
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf("pyth: invalid price %q", price.Price)
+	}
+	return float64(mantissa) * math.Pow10(price.Expo), time.Unix(price.PublishTime, 0), nil
+}
+
+// getOracleJSON sends an oracle API request and decodes the JSON response.
+func getOracleJSON(client *http.Client, req *http.Request, v interface{}) error {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// rateCache caches oracle rates for Config.QuoteTTL.
+type rateCache struct {
+	mu    sync.Mutex
+	rates map[string]cachedRate // by mint and currency
+}
+
+type cachedRate struct {
+	rate      float64
+	fetchedAt time.Time
+}
+
+// quote converts a fiat amount to a token amount of the requirement's mint,
+// rounded up to Config.QuoteDecimals.
+func (s *Server) quote(ctx context.Context, requirement *Requirement, fiatAmount, currency string) (*core.PriceQuote, string, error) {
+	price, ok := new(big.Rat).SetString(fiatAmount)
+	if !ok {
+		return nil, "", fmt.Errorf("invalid fiat amount %q", fiatAmount)
+	}
+	rate, err := s.rate(ctx, requirement.TokenMint, currency)
+	if err != nil {
+		return nil, "", err
+	}
+	if rate <= 0 || math.IsInf(rate, 0) || math.IsNaN(rate) {
+		return nil, "", fmt.Errorf("invalid rate %v for token %s", rate, requirement.TokenMint)
+	}
+	exactRate := new(big.Rat).SetFloat64(rate)
+
+	// Round up, so that the payment covers the price
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(s.config().QuoteDecimals)), nil)
+	units := new(big.Rat).Mul(new(big.Rat).Quo(price, exactRate), new(big.Rat).SetInt(scale))
+	rounded := new(big.Int).Quo(units.Num(), units.Denom())
+	if !units.IsInt() {
+		rounded.Add(rounded, big.NewInt(1))
+	}
+	amount := formatAmount(new(big.Rat).SetFrac(rounded, scale))
+
+	return &core.PriceQuote{
+		Currency:   currency,
+		Amount:     fiatAmount,
+		Rate:       strconv.FormatFloat(rate, 'f', -1, 64),
+		ValidUntil: time.Now().UTC().Add(s.config().QuoteTTL),
+	}, amount, nil
+}
+
+// rate returns the oracle rate of a token, fetching it at most once per
+// QuoteTTL.
+func (s *Server) rate(ctx context.Context, mint, currency string) (float64, error) {
+	key := mint + "|" + currency
+	s.rates.mu.Lock()
+	cached, ok := s.rates.rates[key]
+	s.rates.mu.Unlock()
+	if ok && time.Since(cached.fetchedAt) < s.config().QuoteTTL {
+		return cached.rate, nil
+	}
+
+	rate, err := s.config().PriceOracle.Rate(ctx, mint, currency)
+	if err != nil {
+		return 0, err
+	}
+	s.rates.mu.Lock()
+	if s.rates.rates == nil {
+		s.rates.rates = make(map[string]cachedRate)
+	}
+	s.rates.rates[key] = cachedRate{rate: rate, fetchedAt: time.Now()}
+	s.rates.mu.Unlock()
+	return rate, nil
+}
+
+// applyQuote prices a requirement in fiat. Authorizations for a payment
+// request the server issued with a quote of the same price are held to its
+// amount while it is valid, if a NonceStore is configured; otherwise the
+// current rate applies.
+func (s *Server) applyQuote(ctx context.Context, requirement *Requirement, opts Options, authorization *core.PaymentAuthorization) *Result {
+	if s.config().PriceOracle == nil {
+		return reject(http.StatusInternalServerError, "CONFIGURATION_ERROR", "FiatAmount requires a price oracle", nil)
+	}
+	currency := opts.Currency
+	if currency == "" {
+		currency = s.config().Currency
+	}
+
+	if authorization != nil && s.config().NonceStore != nil {
+		issued, err := s.config().NonceStore.Issued(ctx, authorization.PaymentID)
+		if err == nil && issued != nil && issued.Quote != nil && issued.Quote.Currency == currency &&
+			core.CompareAmounts(issued.Quote.Amount, opts.FiatAmount) == 0 {
+			// checkIssued rejects payments made after the quote expired
+			requirement.Amount = issued.MaxAmountRequired
+			requirement.Quote = issued.Quote
+			return nil
+		}
+	}
+
+	quote, amount, err := s.quote(ctx, requirement, opts.FiatAmount, currency)
+	if err != nil {
+		s.logger.Error("x402: price quote failed", core.LogKeyResource, requirement.Resource, "currency", currency, "error", err)
+		return reject(http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "Price quotes are temporarily unavailable", nil)
+	}
+	requirement.Amount = amount
+	requirement.Quote = quote
+	// The payment request expires with its quote
+	if ttl := int(math.Ceil(s.config().QuoteTTL.Seconds())); ttl < requirement.ExpiresIn {
+		requirement.ExpiresIn = ttl
+	}
+	return nil
+}
@@ -0,0 +1,212 @@
+package serverx402
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+)
+
+// parquetColumn is a required column of a Parquet file: UTF-8 strings, or
+// timestamps in Unix milliseconds if millis is set.
+type parquetColumn struct {
+	name    string
+	strings []string
+	millis  []int64
+}
+
+// Parquet enum values used by writeParquet.
+const (
+	parquetInt64          = 2
+	parquetByteArray      = 6
+	parquetRequired       = 0
+	parquetUTF8           = 0
+	parquetTimestampMilli = 9
+	parquetPlain          = 0
+	parquetRLE            = 3
+	parquetDataPage       = 0
+	parquetUncompressed   = 0
+)
+
+// writeParquet writes a Parquet file of rows in a single row group, with one
+// uncompressed, PLAIN-encoded data page per column. It covers what payment
+// exports need, no more.
+func writeParquet(w io.Writer, columns []parquetColumn, rows int) error {
+	var file bytes.Buffer
+	file.WriteString("PAR1")
+
+	var chunks thriftWriter // The ColumnChunks of the row group
+	total := 0
+	for _, column := range columns {
+		var data bytes.Buffer
+		kind := int32(parquetByteArray)
+		if column.millis != nil {
+			kind = parquetInt64
+			for _, value := range column.millis {
+				binary.Write(&data, binary.LittleEndian, value)
+			}
+		} else {
+			for _, value := range column.strings {
+				binary.Write(&data, binary.LittleEndian, uint32(len(value)))
+				data.WriteString(value)
+			}
+		}
+
+		var page thriftWriter
+		page.begin()
+		page.i32(1, parquetDataPage)
+		page.i32(2, int32(data.Len()))
+		page.i32(3, int32(data.Len()))
+		page.structField(5)
+		page.i32(1, int32(rows))
+		page.i32(2, parquetPlain)
+		page.i32(3, parquetRLE)
+		page.i32(4, parquetRLE)
+		page.end()
+		page.end()
+
+		offset := int64(file.Len())
+		size := int64(page.Len() + data.Len())
+		file.Write(page.Bytes())
+		file.Write(data.Bytes())
+		total += int(size)
+
+		chunks.begin() // ColumnChunk
+		chunks.i64(2, offset)
+		chunks.structField(3)
+		chunks.i32(1, kind)
+		chunks.list(2, thriftI32, 1)
+		chunks.varint(parquetPlain)
+		chunks.list(3, thriftBinary, 1)
+		chunks.binaryValue(column.name)
+		chunks.i32(4, parquetUncompressed)
+		chunks.i64(5, int64(rows))
+		chunks.i64(6, size)
+		chunks.i64(7, size)
+		chunks.i64(9, offset)
+		chunks.end()
+		chunks.end()
+	}
+
+	var meta thriftWriter
+	meta.begin()
+	meta.i32(1, 1)
+	meta.list(2, thriftStruct, len(columns)+1)
+	meta.begin()
+	meta.binary(4, "schema")
+	meta.i32(5, int32(len(columns)))
+	meta.end()
+	for _, column := range columns {
+		meta.begin()
+		if column.millis != nil {
+			meta.i32(1, parquetInt64)
+		} else {
+			meta.i32(1, parquetByteArray)
+		}
+		meta.i32(3, parquetRequired)
+		meta.binary(4, column.name)
+		if column.millis != nil {
+			meta.i32(6, parquetTimestampMilli)
+		} else {
+			meta.i32(6, parquetUTF8)
+		}
+		meta.end()
+	}
+	meta.i64(3, int64(rows))
+	meta.list(4, thriftStruct, 1)
+	meta.begin() // RowGroup
+	meta.list(1, thriftStruct, len(columns))
+	meta.Write(chunks.Bytes())
+	meta.i64(2, int64(total))
+	meta.i64(3, int64(rows))
+	meta.end()
+	meta.binary(6, "openlibx402")
+	meta.end()
+
+	file.Write(meta.Bytes())
+	binary.Write(&file, binary.LittleEndian, uint32(meta.Len()))
+	file.WriteString("PAR1")
+	_, err := w.Write(file.Bytes())
+	return err
+}
+
+// Thrift compact protocol types.
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftWriter encodes structs with the Thrift compact protocol, in which
+// Parquet metadata is written. Fields must be written in increasing order.
+type thriftWriter struct {
+	bytes.Buffer
+	lastIDs []int16 // Last field ID written in each open struct
+}
+
+// begin opens a struct, and end closes it.
+func (t *thriftWriter) begin() {
+	t.lastIDs = append(t.lastIDs, 0)
+}
+
+func (t *thriftWriter) end() {
+	t.WriteByte(0)
+	t.lastIDs = t.lastIDs[:len(t.lastIDs)-1]
+}
+
+func (t *thriftWriter) field(id int16, kind byte) {
+	last := &t.lastIDs[len(t.lastIDs)-1]
+	if delta := id - *last; delta > 0 && delta <= 15 {
+		t.WriteByte(byte(delta)<<4 | kind)
+	} else {
+		t.WriteByte(kind)
+		t.varint(int64(id))
+	}
+	*last = id
+}
+
+// varint writes a zigzag-encoded integer.
+func (t *thriftWriter) varint(v int64) {
+	var buf [binary.MaxVarintLen64]byte
+	t.Write(buf[:binary.PutUvarint(buf[:], uint64(v<<1^v>>63))])
+}
+
+func (t *thriftWriter) i32(id int16, v int32) {
+	t.field(id, thriftI32)
+	t.varint(int64(v))
+}
+
+func (t *thriftWriter) i64(id int16, v int64) {
+	t.field(id, thriftI64)
+	t.varint(v)
+}
+
+func (t *thriftWriter) binary(id int16, s string) {
+	t.field(id, thriftBinary)
+	t.binaryValue(s)
+}
+
+func (t *thriftWriter) binaryValue(s string) {
+	var buf [binary.MaxVarintLen64]byte
+	t.Write(buf[:binary.PutUvarint(buf[:], uint64(len(s)))])
+	t.WriteString(s)
+}
+
+// list writes the header of a list field of n elements, which follow.
+func (t *thriftWriter) list(id int16, elem byte, n int) {
+	t.field(id, thriftList)
+	if n < 15 {
+		t.WriteByte(byte(n)<<4 | elem)
+		return
+	}
+	t.WriteByte(0xf0 | elem)
+	var buf [binary.MaxVarintLen64]byte
+	t.Write(buf[:binary.PutUvarint(buf[:], uint64(n))])
+}
+
+// structField opens a struct field, closed with end.
+func (t *thriftWriter) structField(id int16) {
+	t.field(id, thriftStruct)
+	t.begin()
+}
@@ -0,0 +1,162 @@
+package serverx402
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/openlibx402/go/openlibx402-core"
+)
+
+// PayerList is a list of payer public keys, such as Config.BlockedPayers.
+// Lists can be updated while the server runs: changes apply to the next
+// request.
+//
+// Implementations must be safe for concurrent use.
+type PayerList interface {
+	// Contains reports whether pubkey is on the list.
+	Contains(ctx context.Context, pubkey string) (bool, error)
+	// Add adds public keys to the list.
+	Add(ctx context.Context, pubkeys ...string) error
+	// Remove removes public keys from the list.
+	Remove(ctx context.Context, pubkeys ...string) error
+}
+
+var (
+	_ PayerList = (*MemoryPayerList)(nil)
+	_ PayerList = (*RedisPayerList)(nil)
+)
+
+// MemoryPayerList is an in-process PayerList. Server instances sharing a
+// load balancer each hold their own copy; use a shared list such as
+// RedisPayerList to update them all at once.
+type MemoryPayerList struct {
+	mu      sync.RWMutex
+	pubkeys map[string]struct{}
+}
+
+// NewMemoryPayerList creates an in-memory list holding pubkeys.
+func NewMemoryPayerList(pubkeys ...string) *MemoryPayerList {
+	list := &MemoryPayerList{pubkeys: make(map[string]struct{}, len(pubkeys))}
+	for _, pubkey := range pubkeys {
+		list.pubkeys[pubkey] = struct{}{}
+	}
+	return list
+}
+
+// Contains implements PayerList.
+func (l *MemoryPayerList) Contains(ctx context.Context, pubkey string) (bool, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	_, ok := l.pubkeys[pubkey]
+	return ok, nil
+}
+
+// Add implements PayerList.
+func (l *MemoryPayerList) Add(ctx context.Context, pubkeys ...string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, pubkey := range pubkeys {
+		l.pubkeys[pubkey] = struct{}{}
+	}
+	return nil
+}
+
+// Remove implements PayerList.
+func (l *MemoryPayerList) Remove(ctx context.Context, pubkeys ...string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, pubkey := range pubkeys {
+		delete(l.pubkeys, pubkey)
+	}
+	return nil
+}
+
+// RedisPayerListClient is the subset of a Redis client used by
+// RedisPayerList. With go-redis:
+//
+//	func (r goRedis) SIsMember(ctx context.Context, key, member string) (bool, error) {
+//	    return r.Client.SIsMember(ctx, key, member).Result()
+//	}
+type RedisPayerListClient interface {
+	SIsMember(ctx context.Context, key, member string) (bool, error)
+	SAdd(ctx context.Context, key string, members ...string) error
+	SRem(ctx context.Context, key string, members ...string) error
+}
+
+// RedisPayerList keeps a list in a Redis set, so that every server instance
+// sees its updates.
+type RedisPayerList struct {
+	client RedisPayerListClient
+	key    string
+}
+
+// NewRedisPayerList creates a list stored in the Redis set key, e.g.
+// "x402:blocked-payers".
+func NewRedisPayerList(client RedisPayerListClient, key string) *RedisPayerList {
+	return &RedisPayerList{client: client, key: key}
+}
+
+// Contains implements PayerList.
+func (l *RedisPayerList) Contains(ctx context.Context, pubkey string) (bool, error) {
+	return l.client.SIsMember(ctx, l.key, pubkey)
+}
+
+// Add implements PayerList.
+func (l *RedisPayerList) Add(ctx context.Context, pubkeys ...string) error {
+	if len(pubkeys) == 0 {
+		return nil
+	}
+	return l.client.SAdd(ctx, l.key, pubkeys...)
+}
+
+// Remove implements PayerList.
+func (l *RedisPayerList) Remove(ctx context.Context, pubkeys ...string) error {
+	if len(pubkeys) == 0 {
+		return nil
+	}
+	return l.client.SRem(ctx, l.key, pubkeys...)
+}
+
+// checkPayer applies the payer lists and Config.PayerRateLimit to the payer
+// a request proceeds for, and returns a result rejecting it, or nil.
+func (s *Server) checkPayer(ctx context.Context, payer string) *Result {
+	if payer == "" {
+		return nil
+	}
+	if result := s.checkPayerLists(ctx, payer); result != nil {
+		return result
+	}
+	return s.limitPayer(ctx, payer)
+}
+
+// checkPayerLists rejects a payer that is on Config.BlockedPayers, or not
+// on Config.AllowedPayers if it is set, and returns nil otherwise. A list
+// that cannot be read rejects the request, rather than let a blocked payer
+// through.
+func (s *Server) checkPayerLists(ctx context.Context, payer string) *Result {
+	blocked, allowed := s.config().BlockedPayers, s.config().AllowedPayers
+	if blocked != nil {
+		listed, err := blocked.Contains(ctx, payer)
+		if err != nil {
+			s.logger.Error("x402: blocked payer lookup failed", core.LogKeyPayer, payer, "error", err)
+			return reject(http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "Payment verification is temporarily unavailable", nil)
+		}
+		if listed {
+			s.logger.Warn("x402: rejected blocked payer", core.LogKeyPayer, payer)
+			return reject(http.StatusForbidden, "PAYER_BLOCKED", "Payer is blocked", nil)
+		}
+	}
+	if allowed != nil {
+		listed, err := allowed.Contains(ctx, payer)
+		if err != nil {
+			s.logger.Error("x402: allowed payer lookup failed", core.LogKeyPayer, payer, "error", err)
+			return reject(http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "Payment verification is temporarily unavailable", nil)
+		}
+		if !listed {
+			s.logger.Info("x402: rejected payer not on the allowlist", core.LogKeyPayer, payer)
+			return reject(http.StatusForbidden, "PAYER_NOT_ALLOWED", "Payer is not allowed", nil)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,314 @@
+package serverx402
+
+import (
+	"html/template"
+	"net/http"
+
+	"github.com/openlibx402/go/openlibx402-core"
+)
+
+// PaywallCookie is the cookie the wallet paywall page returns the payment
+// authorization in, since browsers cannot add headers to a navigation.
+const PaywallCookie = "x402_authorization"
+
+// PaywallReferenceCookie is the cookie a paywall page showing a QR code
+// returns the payment ID of its payment request in, in place of the
+// reference header (see Config.PaywallQRCode).
+const PaywallReferenceCookie = "x402_reference"
+
+// PaywallData is the data a paywall template is executed with.
+type PaywallData struct {
+	Status         int                  // HTTP status of the response (402)
+	Message        string               // Why payment is required
+	PaymentRequest *core.PaymentRequest // The payment request to pay
+
+	// Fields used by the wallet paywall page (see Config.WalletPaywall)
+	RPCURL     string // RPC endpoint the browser builds the transaction with
+	Memo       string // Memo binding the transfer to the payment ID
+	CookieName string // Cookie to return the authorization in
+
+	// Fields used to show a QR code (see Config.PaywallQRCode)
+	QRCode          template.HTML // SVG of the Solana Pay URL
+	SolanaPayURL    template.URL  // The Solana Pay URL, for wallets on the same device
+	ReferenceCookie string        // Cookie to return the payment ID in
+}
+
+// paywallQRCode shows the QR code of a Solana Pay URL on the paywall pages.
+// The page returns the payment ID in a cookie and polls the resource until
+// the payment is confirmed, then loads it.
+const paywallQRCode = `{{if .QRCode}}
+<figure class="qr">{{.QRCode}}
+<figcaption>Scan with a Solana Pay wallet, or <a href="{{.SolanaPayURL}}">open a wallet on this device</a>.</figcaption>
+</figure>
+<script>
+(function () {
+  const paymentID = {{.PaymentRequest.PaymentID}};
+  const expiresAt = Date.parse({{.PaymentRequest.ExpiresAt}});
+  const maxAge = Math.max(60, Math.floor((expiresAt - Date.now()) / 1000));
+  const secure = location.protocol === "https:" ? "; Secure" : "";
+  document.cookie = {{.ReferenceCookie}} + "=" + paymentID +
+    "; Path=" + location.pathname + "; Max-Age=" + maxAge + "; SameSite=Lax" + secure;
+
+  async function poll() {
+    try {
+      const resp = await fetch(location.href, { headers: { Accept: "application/json" }, credentials: "same-origin" });
+      if (resp.status !== 402) {
+        location.replace(location.href);
+        return;
+      }
+    } catch (err) {
+      // Keep polling through network errors
+    }
+    if (Date.now() < expiresAt) {
+      setTimeout(poll, 3000);
+    }
+  }
+  setTimeout(poll, 3000);
+})();
+</script>
+{{end}}`
+
+// DefaultPaywallTemplate renders the HTML page sent to browsers hitting a paid
+// endpoint, if Config.HTMLPaywall is set and no PaywallTemplate is configured.
+var DefaultPaywallTemplate = template.Must(template.New("paywall").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Payment Required</title>
+<style>
+body { font-family: system-ui, sans-serif; max-width: 36rem; margin: 4rem auto; padding: 0 1rem; color: #1a1a1a; }
+h1 { font-size: 1.5rem; }
+dl { display: grid; grid-template-columns: max-content 1fr; gap: 0.5rem 1rem; }
+dt { color: #666; }
+dd { margin: 0; word-break: break-all; }
+.amount { font-size: 2rem; font-weight: 600; }
+.qr { margin: 2rem 0; text-align: center; }
+.qr svg { width: 16rem; height: 16rem; }
+</style>
+</head>
+<body>
+<h1>Payment Required</h1>
+<p>{{.Message}}</p>
+{{with .PaymentRequest}}
+<p class="amount">{{.MaxAmountRequired}}</p>
+{{if .Description}}<p>{{.Description}}</p>{{end}}
+<dl>
+<dt>Resource</dt><dd>{{.Resource}}</dd>
+<dt>Network</dt><dd>{{.Network}}</dd>
+<dt>Token</dt><dd>{{.AssetAddress}}</dd>
+<dt>Pay to</dt><dd>{{.PaymentAddress}}</dd>
+<dt>Payment ID</dt><dd>{{.PaymentID}}</dd>
+<dt>Expires</dt><dd>{{.ExpiresAt.Format "2006-01-02 15:04:05 MST"}}</dd>
+</dl>
+{{end}}
+<p>Pay with an X402 client, which retries the request with the payment authorization.</p>
+` + paywallQRCode + `
+</body>
+</html>
+`))
+
+// WalletPaywallTemplate renders the page sent to browsers if
+// Config.WalletPaywall is set and no PaywallTemplate is configured. It pays
+// with the Phantom wallet: the payer approves the transfer, with the payment
+// memo, then signs the authorization's attestation, which covers the
+// transaction hash (see core.PaymentAuthorization.Attest). The page then
+// stores the authorization in PaywallCookie and reloads the resource, which
+// the server accepts in place of the authorization header.
+var WalletPaywallTemplate = template.Must(template.New("wallet-paywall").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Payment Required</title>
+<style>
+body { font-family: system-ui, sans-serif; max-width: 36rem; margin: 4rem auto; padding: 0 1rem; color: #1a1a1a; }
+h1 { font-size: 1.5rem; }
+dl { display: grid; grid-template-columns: max-content 1fr; gap: 0.5rem 1rem; }
+dt { color: #666; }
+dd { margin: 0; word-break: break-all; }
+.amount { font-size: 2rem; font-weight: 600; }
+.qr { margin: 2rem 0; text-align: center; }
+.qr svg { width: 16rem; height: 16rem; }
+button { font-size: 1rem; padding: 0.75rem 1.5rem; border: 0; border-radius: 0.5rem; background: #ab9ff2; color: #fff; cursor: pointer; }
+button:disabled { opacity: 0.5; cursor: default; }
+#status { color: #666; }
+#status.error { color: #c62828; }
+</style>
+</head>
+<body>
+<h1>Payment Required</h1>
+<p>{{.Message}}</p>
+{{with .PaymentRequest}}
+<p class="amount">{{.MaxAmountRequired}}</p>
+{{if .Description}}<p>{{.Description}}</p>{{end}}
+<dl>
+<dt>Network</dt><dd>{{.Network}}</dd>
+<dt>Token</dt><dd>{{.AssetAddress}}</dd>
+<dt>Pay to</dt><dd>{{.PaymentAddress}}</dd>
+<dt>Expires</dt><dd>{{.ExpiresAt.Format "2006-01-02 15:04:05 MST"}}</dd>
+</dl>
+{{end}}
+<p><button id="pay" type="button">Pay with Phantom</button></p>
+<p id="status"></p>
+` + paywallQRCode + `
+<script type="module">
+import { Connection, PublicKey, Transaction, TransactionInstruction } from "https://esm.sh/@solana/web3.js@1.95.3";
+import { getAssociatedTokenAddressSync, createAssociatedTokenAccountIdempotentInstruction, createTransferCheckedInstruction, getMint } from "https://esm.sh/@solana/spl-token@0.4.8";
+import bs58 from "https://esm.sh/bs58@6.0.0";
+
+const request = {{.PaymentRequest}};
+const rpcURL = {{.RPCURL}};
+const memo = {{.Memo}};
+const cookieName = {{.CookieName}};
+const memoProgram = new PublicKey("MemoSq4gqABAXKb96qnH8TysNcWxMyWCqXgDLGmfcHr");
+
+const button = document.getElementById("pay");
+const status = document.getElementById("status");
+function report(message, error) {
+  status.textContent = message;
+  status.className = error ? "error" : "";
+}
+
+// toBaseUnits converts a decimal amount to token base units without rounding
+function toBaseUnits(amount, decimals) {
+  const [whole, fraction = ""] = amount.split(".");
+  return BigInt(whole + fraction.padEnd(decimals, "0").slice(0, decimals));
+}
+
+async function pay() {
+  const provider = window.phantom?.solana ?? window.solana;
+  if (!provider?.isPhantom) {
+    report("Install the Phantom wallet (https://phantom.app) to pay in the browser.", true);
+    return;
+  }
+  button.disabled = true;
+  try {
+    report("Connecting to wallet...");
+    await provider.connect();
+    const payer = provider.publicKey;
+
+    const connection = new Connection(rpcURL, "confirmed");
+    const mint = new PublicKey(request.asset_address);
+    const recipient = new PublicKey(request.payment_address);
+    const { decimals } = await getMint(connection, mint);
+    const source = getAssociatedTokenAddressSync(mint, payer);
+    const destination = getAssociatedTokenAddressSync(mint, recipient);
+
+    // Whole seconds format the same as Go's RFC3339Nano in CanonicalPayload
+    const timestamp = new Date(Math.floor(Date.now() / 1000) * 1000).toISOString().replace(".000Z", "Z");
+    const authorization = {
+      payment_id: request.payment_id,
+      actual_amount: request.max_amount_required,
+      payment_address: request.payment_address,
+      asset_address: request.asset_address,
+      network: request.network,
+      timestamp: timestamp,
+      signature: "",
+      public_key: payer.toBase58(),
+    };
+    report("Approve the payment in your wallet...");
+    const tx = new Transaction().add(
+      createAssociatedTokenAccountIdempotentInstruction(payer, destination, recipient, mint),
+      createTransferCheckedInstruction(source, mint, destination, payer, toBaseUnits(request.max_amount_required, decimals), decimals),
+      new TransactionInstruction({ programId: memoProgram, keys: [], data: new TextEncoder().encode(memo) }),
+    );
+    tx.feePayer = payer;
+    const { blockhash, lastValidBlockHeight } = await connection.getLatestBlockhash();
+    tx.recentBlockhash = blockhash;
+    const { signature } = await provider.signAndSendTransaction(tx);
+
+    report("Waiting for confirmation...");
+    await connection.confirmTransaction({ signature, blockhash, lastValidBlockHeight }, "confirmed");
+    authorization.transaction_hash = signature;
+    if (provider.signMessage) {
+      report("Sign the payment authorization in your wallet...");
+      const payload = "x402-authorization-v1:" + JSON.stringify([
+        authorization.payment_id,
+        authorization.actual_amount,
+        authorization.payment_address,
+        authorization.asset_address,
+        authorization.network,
+        authorization.timestamp,
+        authorization.public_key,
+        authorization.transaction_hash,
+      ]);
+      const attestation = await provider.signMessage(new TextEncoder().encode(payload), "utf8");
+      authorization.signature = bs58.encode(attestation.signature);
+    } else {
+      authorization.signature = signature;
+    }
+
+    const maxAge = Math.max(60, Math.floor((Date.parse(request.expires_at) - Date.now()) / 1000));
+    const secure = location.protocol === "https:" ? "; Secure" : "";
+    document.cookie = cookieName + "=" + btoa(JSON.stringify(authorization)) +
+      "; Path=" + location.pathname + "; Max-Age=" + maxAge + "; SameSite=Lax" + secure;
+    report("Payment confirmed, loading...");
+    location.replace(location.href);
+  } catch (err) {
+    report("Payment failed: " + (err?.message ?? err), true);
+    button.disabled = false;
+  }
+}
+
+button.addEventListener("click", pay);
+</script>
+</body>
+</html>
+`))
+
+// paywallTemplate returns the configured paywall template.
+func (s *Server) paywallTemplate() *template.Template {
+	switch {
+	case s.config().PaywallTemplate != nil:
+		return s.config().PaywallTemplate
+	case s.config().WalletPaywall:
+		return WalletPaywallTemplate
+	}
+	return DefaultPaywallTemplate
+}
+
+// paywallData returns the data to execute the paywall template with for a
+// result requiring payment.
+func (s *Server) paywallData(result *Result) *PaywallData {
+	data := &PaywallData{
+		Status:         result.Status,
+		Message:        result.Message,
+		PaymentRequest: result.PaymentRequest,
+	}
+	if s.config().WalletPaywall {
+		data.RPCURL = s.config().PaywallRPCURL
+		if data.RPCURL == "" {
+			data.RPCURL = core.GetDefaultRPCURL(result.PaymentRequest.Network)
+		}
+		data.Memo = core.PaymentMemo(result.PaymentRequest.PaymentID)
+		data.CookieName = PaywallCookie
+	}
+	if s.config().PaywallQRCode && result.PaymentRequest.SolanaPayURL != "" {
+		if code, err := result.PaymentRequest.QRCode(); err == nil {
+			// Generated markup, and a URL with a scheme html/template would reject
+			data.QRCode = template.HTML(code.SVG(4))
+			data.SolanaPayURL = template.URL(result.PaymentRequest.SolanaPayURL)
+			data.ReferenceCookie = PaywallReferenceCookie
+		}
+	}
+	return data
+}
+
+// paywallAuthorization returns the authorization the wallet paywall page
+// stored in PaywallCookie, if any.
+func paywallAuthorization(cookieHeader string) string {
+	return paywallCookie(cookieHeader, PaywallCookie)
+}
+
+// paywallCookie returns the value of a cookie set by a paywall page, if any.
+func paywallCookie(cookieHeader, name string) string {
+	if cookieHeader == "" {
+		return ""
+	}
+	cookie, err := (&http.Request{Header: http.Header{"Cookie": {cookieHeader}}}).Cookie(name)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
@@ -0,0 +1,232 @@
+package serverx402
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/openlibx402/go/openlibx402-core"
+)
+
+// Persister is a store holding its state in memory that can save it, so that
+// it survives a restart. Server.Shutdown persists the stores of the
+// configuration implementing it.
+type Persister interface {
+	Persist(ctx context.Context) error
+}
+
+var (
+	_ Persister = (*MemoryNonceStore)(nil)
+	_ Persister = (*MemoryQuotaStore)(nil)
+	_ Persister = (*MemoryChannelStore)(nil)
+	_ Persister = (*MemoryTabStore)(nil)
+)
+
+// loadState decodes the JSON state saved at path into v. A missing file
+// leaves v unchanged.
+func loadState(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("invalid state file %s: %w", path, err)
+	}
+	return nil
+}
+
+// saveState writes v as JSON to path, replacing the file atomically so that
+// a crash does not leave it truncated.
+func saveState(path string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// persistedNonce is a MemoryNonceStore entry as saved: an issued payment
+// request, or the key of a consumed payment.
+type persistedNonce struct {
+	Request   *core.PaymentRequest `json:"request,omitempty"`
+	Used      string               `json:"used,omitempty"`
+	ExpiresAt time.Time            `json:"expires_at"`
+}
+
+// PersistTo loads the issued payment requests and consumed payments saved
+// at path, if the file exists, and makes Persist save them there.
+func (s *MemoryNonceStore) PersistTo(path string) error {
+	var saved []persistedNonce
+	if err := loadState(path, &saved); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.path = path
+	for _, entry := range saved {
+		if !time.Now().Before(entry.ExpiresAt) {
+			continue
+		}
+		switch {
+		case entry.Request != nil:
+			s.entries[entry.Request.PaymentID] = s.order.PushFront(&nonceEntry{request: entry.Request, expiresAt: entry.ExpiresAt})
+		case entry.Used != "":
+			s.used[entry.Used] = s.usedOrder.PushFront(&usedEntry{key: entry.Used, expiresAt: entry.ExpiresAt})
+		}
+	}
+	return nil
+}
+
+// Persist implements Persister. It saves the unexpired requests and
+// consumed payments to the file set with PersistTo, if any.
+func (s *MemoryNonceStore) Persist(ctx context.Context) error {
+	s.mu.Lock()
+	path := s.path
+	var saved []persistedNonce
+	for elem := s.order.Back(); elem != nil; elem = elem.Prev() {
+		entry := elem.Value.(*nonceEntry)
+		if time.Now().Before(entry.expiresAt) {
+			saved = append(saved, persistedNonce{Request: entry.request, ExpiresAt: entry.expiresAt})
+		}
+	}
+	for elem := s.usedOrder.Back(); elem != nil; elem = elem.Prev() {
+		entry := elem.Value.(*usedEntry)
+		if time.Now().Before(entry.expiresAt) {
+			saved = append(saved, persistedNonce{Used: entry.key, ExpiresAt: entry.expiresAt})
+		}
+	}
+	s.mu.Unlock()
+	if path == "" {
+		return nil
+	}
+	return saveState(path, saved)
+}
+
+// persistedQuota is a MemoryQuotaStore entry as saved.
+type persistedQuota struct {
+	PaymentID string    `json:"payment_id"`
+	Remaining int       `json:"remaining"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// PersistTo loads the quotas saved at path, if the file exists, and makes
+// Persist save them there.
+func (s *MemoryQuotaStore) PersistTo(path string) error {
+	var saved []persistedQuota
+	if err := loadState(path, &saved); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.path = path
+	for _, entry := range saved {
+		if entry.Remaining > 0 && time.Now().Before(entry.ExpiresAt) {
+			s.entries[entry.PaymentID] = s.order.PushFront(&quotaEntry{paymentID: entry.PaymentID, remaining: entry.Remaining, expiresAt: entry.ExpiresAt})
+		}
+	}
+	return nil
+}
+
+// Persist implements Persister. It saves the unexpired quotas to the file
+// set with PersistTo, if any.
+func (s *MemoryQuotaStore) Persist(ctx context.Context) error {
+	s.mu.Lock()
+	path := s.path
+	var saved []persistedQuota
+	for elem := s.order.Back(); elem != nil; elem = elem.Prev() {
+		entry := elem.Value.(*quotaEntry)
+		if entry.remaining > 0 && time.Now().Before(entry.expiresAt) {
+			saved = append(saved, persistedQuota{PaymentID: entry.paymentID, Remaining: entry.remaining, ExpiresAt: entry.expiresAt})
+		}
+	}
+	s.mu.Unlock()
+	if path == "" {
+		return nil
+	}
+	return saveState(path, saved)
+}
+
+// PersistTo loads the channels saved at path, if the file exists, and makes
+// Persist save them there. Channels that expired in the meantime are
+// refunded by the server as usual.
+func (s *MemoryChannelStore) PersistTo(path string) error {
+	var saved []*Channel
+	if err := loadState(path, &saved); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.path = path
+	for _, channel := range saved {
+		s.channels[channel.ID] = channel
+	}
+	return nil
+}
+
+// Persist implements Persister. It saves the open channels to the file set
+// with PersistTo, if any.
+func (s *MemoryChannelStore) Persist(ctx context.Context) error {
+	s.mu.Lock()
+	path := s.path
+	saved := make([]Channel, 0, len(s.channels))
+	for _, channel := range s.channels {
+		saved = append(saved, *channel)
+	}
+	s.mu.Unlock()
+	if path == "" {
+		return nil
+	}
+	return saveState(path, saved)
+}
+
+// PersistTo loads the tabs saved at path, if the file exists, and makes
+// Persist save them there.
+func (s *MemoryTabStore) PersistTo(path string) error {
+	var saved []*Tab
+	if err := loadState(path, &saved); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.path = path
+	for _, tab := range saved {
+		s.tabs[tab.ID] = tab
+	}
+	return nil
+}
+
+// Persist implements Persister. It saves the tabs to the file set with
+// PersistTo, if any.
+func (s *MemoryTabStore) Persist(ctx context.Context) error {
+	s.mu.Lock()
+	path := s.path
+	saved := make([]Tab, 0, len(s.tabs))
+	for _, tab := range s.tabs {
+		saved = append(saved, *tab)
+	}
+	s.mu.Unlock()
+	if path == "" {
+		return nil
+	}
+	return saveState(path, saved)
+}
@@ -0,0 +1,275 @@
+package serverx402
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/openlibx402/go/openlibx402-core"
+)
+
+// VolumePricing prices a resource by the payer's volume of verified
+// payments in Config.Store (see Options.VolumePricing). Volume is the number
+// of distinct transactions settled, so a transaction recorded more than once
+// counts once.
+//
+// Example:
+//
+//	pricing := &serverx402.VolumePricing{Tiers: []core.PriceTier{
+//	    {From: 0, Amount: "0.10"},   // First 100 calls
+//	    {From: 100, Amount: "0.05"}, // Then
+//	}}
+type VolumePricing struct {
+	Tiers []core.PriceTier
+	// Window counts only the payments made within it, e.g. 30 days for
+	// monthly volume (default: all payments).
+	Window time.Duration
+	// AllResources counts the payer's payments to every resource instead of
+	// only to the one being priced.
+	AllResources bool
+}
+
+// volumePrice returns the price of the payer's tier. Requests that do not
+// declare the payer, and servers without a store, get the first tier.
+func (s *Server) volumePrice(ctx context.Context, pricing *VolumePricing, payer, resource string) string {
+	payments := 0
+	if payer != "" && s.config().Store != nil {
+		query := PaymentQuery{Payer: payer, Status: PaymentStatusVerified, Limit: -1}
+		if !pricing.AllResources {
+			query.Resource = resource
+		}
+		if pricing.Window > 0 {
+			query.Since = time.Now().Add(-pricing.Window)
+		}
+		var err error
+		payments, err = countTransactions(ctx, s.config().Store, query)
+		if err != nil {
+			// Charge the first tier rather than fail the request
+			s.logger.Error("x402: payment volume lookup failed", core.LogKeyPayer, payer, core.LogKeyResource, resource, "error", err)
+			payments = 0
+		}
+	}
+	return core.TierPrice(pricing.Tiers, payments)
+}
+
+// countTransactions counts the distinct transactions of the payments
+// matching query, listing them if the store cannot count.
+func countTransactions(ctx context.Context, store PaymentStore, query PaymentQuery) (int, error) {
+	if counter, ok := store.(PaymentCounter); ok {
+		return counter.CountTransactions(ctx, query)
+	}
+	records, err := store.ListPayments(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	transactions := make(map[string]bool)
+	for _, record := range records {
+		if record.TxHash != "" {
+			transactions[record.TxHash] = true
+		}
+	}
+	return len(transactions), nil
+}
+
+// DefaultRangeUnit is the unit of RangePricing, 10 MiB.
+const DefaultRangeUnit = 10 << 20
+
+// RangePricing prices downloads of large files by the bytes they request
+// (see Options.RangePricing): each started Unit costs PricePerUnit. A
+// request without a Range header pays for the whole file, and one for
+// "bytes=0-1048575" for the units of that range, so that clients can pay
+// for a download in parts, or resume it.
+//
+// Example:
+//
+//	pricing := &serverx402.RangePricing{
+//	    PricePerUnit: "0.01", // Per started 10 MiB
+//	    Stat: func(ctx context.Context, resource string) (fs.FileInfo, error) {
+//	        return os.Stat(filepath.Join("files", filepath.FromSlash(path.Clean(resource))))
+//	    },
+//	}
+type RangePricing struct {
+	PricePerUnit string
+	Unit         int64 // Bytes per unit (default: DefaultRangeUnit)
+	// Stat describes the file served for a resource. Files that do not exist
+	// (errors wrapping fs.ErrNotExist) are not priced, so that the handler
+	// can respond 404.
+	Stat func(ctx context.Context, resource string) (fs.FileInfo, error)
+}
+
+// UnitPricing prices a request by the units it consumes, such as the output
+// tokens of a model (see Options.UnitPricing). The payment is a hold for
+// MaxUnits; the handler reports the units it used, and only their price is
+// captured.
+//
+// Example:
+//
+//	pricing := &serverx402.UnitPricing{
+//	    PricePerUnit: "0.00002", // Per output token
+//	    MaxUnits:     4096,
+//	    Unit:         "token",
+//	}
+type UnitPricing struct {
+	PricePerUnit string
+	MaxUnits     int64  // Units the hold covers; more are not charged
+	Unit         string // Name of the unit shown to clients (optional)
+}
+
+// apply makes requirement a hold for the MaxUnits of pricing.
+func (pricing *UnitPricing) apply(requirement *Requirement) error {
+	price, ok := new(big.Rat).SetString(pricing.PricePerUnit)
+	if !ok || price.Sign() <= 0 || pricing.MaxUnits <= 0 {
+		return errors.New("UnitPricing requires a positive PricePerUnit and MaxUnits")
+	}
+	requirement.Amount = formatAmount(price.Mul(price, new(big.Rat).SetInt64(pricing.MaxUnits)))
+	requirement.Capture = true
+	requirement.Units = &core.UnitPrice{
+		PricePerUnit: pricing.PricePerUnit,
+		MaxUnits:     pricing.MaxUnits,
+		Unit:         pricing.Unit,
+	}
+	return nil
+}
+
+// applyRangePricing prices requirement by the bytes the request asks for.
+// It returns a result for requests that are not priced or cannot be served.
+func (s *Server) applyRangePricing(req Request, requirement *Requirement, pricing *RangePricing) *Result {
+	info, err := pricing.Stat(req.Context, requirement.Resource)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &Result{Requirement: requirement}
+	}
+	if err != nil {
+		s.logger.Error("x402: failed to stat ranged resource", core.LogKeyResource, requirement.Resource, "error", err)
+		return reject(http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "Unable to determine price", nil)
+	}
+	size := info.Size()
+	unit := pricing.Unit
+	if unit <= 0 {
+		unit = DefaultRangeUnit
+	}
+
+	bytes := size
+	header := req.Header("Range")
+	if header != "" && ifRangeMatches(req.Header("If-Range"), info.ModTime()) {
+		var ok bool
+		if bytes, ok = rangeLength(header, size); !ok {
+			return reject(http.StatusRequestedRangeNotSatisfiable, "RANGE_NOT_SATISFIABLE", "Requested range not satisfiable", map[string]interface{}{
+				"range": header,
+				"size":  size,
+			})
+		}
+	} else {
+		header = ""
+	}
+
+	// Every request pays for at least one unit
+	units := (bytes + unit - 1) / unit
+	if units < 1 {
+		units = 1
+	}
+	amount := new(big.Rat).Mul(parseAmount(pricing.PricePerUnit), new(big.Rat).SetInt64(units))
+	requirement.Amount = formatAmount(amount)
+	requirement.Range = &core.RangePrice{
+		PricePerUnit: pricing.PricePerUnit,
+		Unit:         unit,
+		Size:         size,
+		Range:        header,
+		Bytes:        bytes,
+	}
+	return nil
+}
+
+// ifRangeMatches reports whether a request's Range applies given its
+// If-Range header, as http.ServeContent decides it. Entity tags cannot be
+// checked against a file's modification time, so they never match and the
+// whole file is priced.
+func ifRangeMatches(ifRange string, modTime time.Time) bool {
+	if ifRange == "" {
+		return true
+	}
+	if strings.HasPrefix(ifRange, `"`) || strings.HasPrefix(ifRange, "W/") {
+		return false
+	}
+	t, err := http.ParseTime(ifRange)
+	return err == nil && !modTime.IsZero() && modTime.Truncate(time.Second).Equal(t)
+}
+
+// rangeLength returns the number of bytes a Range header asks for out of
+// size: the sum of its ranges, up to size, as http.ServeContent serves the
+// whole file when they add up to more. It reports false for headers
+// ServeContent rejects with 416 Range Not Satisfiable.
+func rangeLength(header string, size int64) (int64, bool) {
+	specs, ok := strings.CutPrefix(header, "bytes=")
+	if !ok {
+		return 0, false
+	}
+	var total int64
+	satisfiable := false
+	for _, spec := range strings.Split(specs, ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		first, last, ok := strings.Cut(spec, "-")
+		if !ok {
+			return 0, false
+		}
+		first, last = strings.TrimSpace(first), strings.TrimSpace(last)
+		var start, length int64
+		if first == "" {
+			// Suffix range: the last bytes of the file
+			n, err := strconv.ParseInt(last, 10, 64)
+			if err != nil || n < 0 {
+				return 0, false
+			}
+			if n > size {
+				n = size
+			}
+			start, length = size-n, n
+		} else {
+			i, err := strconv.ParseInt(first, 10, 64)
+			if err != nil || i < 0 {
+				return 0, false
+			}
+			if i >= size {
+				// Ranges past the end are skipped, unless none is left
+				continue
+			}
+			start = i
+			if last == "" {
+				length = size - start
+			} else {
+				j, err := strconv.ParseInt(last, 10, 64)
+				if err != nil || j < i {
+					return 0, false
+				}
+				if j >= size {
+					j = size - 1
+				}
+				length = j - start + 1
+			}
+		}
+		satisfiable = true
+		total += length
+	}
+	if !satisfiable {
+		return 0, false
+	}
+	if total > size {
+		total = size
+	}
+	return total, true
+}
+
+// PriceError returns the 400 rejection of a request to resource whose price
+// could not be determined, e.g. when an adapter's PriceFunc fails. The error
+// is logged, not sent, as it may describe internals of the pricing.
+func (s *Server) PriceError(resource string, err error) *Result {
+	s.logger.Warn("x402: unable to determine price", core.LogKeyResource, resource, "error", err)
+	return reject(http.StatusBadRequest, core.ErrInvalidPaymentRequest.Code, "Unable to determine price", nil)
+}
@@ -0,0 +1,98 @@
+package serverx402
+
+import (
+	"context"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/openlibx402/go/openlibx402-core"
+)
+
+// rangeOptions prices a 4 KiB file at 0.01 per started KiB.
+func rangeOptions() Options {
+	files := fstest.MapFS{"data.bin": &fstest.MapFile{Data: make([]byte, 4096)}}
+	return Options{RangePricing: &RangePricing{
+		PricePerUnit: "0.01",
+		Unit:         1024,
+		Stat: func(ctx context.Context, resource string) (fs.FileInfo, error) {
+			return fs.Stat(files, resource)
+		},
+	}}
+}
+
+func TestRangePricingPricesRequestedBytes(t *testing.T) {
+	s, _ := newTestServer(t, &Config{AutoVerify: true})
+	opts := rangeOptions()
+
+	for header, want := range map[string]string{"": "0.04", "bytes=0-0": "0.01", "bytes=0-2047": "0.02"} {
+		result := s.Process(testRequest("data.bin", map[string]string{"Range": header}), opts)
+		if result.PaymentRequest == nil || result.PaymentRequest.MaxAmountRequired != want {
+			t.Errorf("Range %q: got %+v, want a payment request for %s", header, result.PaymentRequest, want)
+		}
+	}
+}
+
+func TestRangePaymentBoundToRange(t *testing.T) {
+	s, mock := newTestServer(t, &Config{AutoVerify: true, NonceStore: NewMemoryNonceStore(0)})
+	opts := rangeOptions()
+	payer := solana.NewWallet().PublicKey().String()
+
+	first := map[string]string{"Range": "bytes=0-0"}
+	result := s.Process(testRequest("data.bin", first), opts)
+	header := pay(t, mock, result.PaymentRequest, payer)
+
+	// A payment for one unit does not pay for other bytes of the same price
+	other := map[string]string{"Range": "bytes=1024-1024", "X-Payment-Authorization": header}
+	result = s.Process(testRequest("data.bin", other), opts)
+	if result.Allowed() || result.Details["mismatch"] != "range" {
+		t.Fatalf("payment for another range: got %d %s %v, want range mismatch", result.Status, result.Code, result.Details)
+	}
+
+	first["X-Payment-Authorization"] = header
+	if result := s.Process(testRequest("data.bin", first), opts); !result.Allowed() {
+		t.Fatalf("payment for its range: got %d %s %v, want allowed", result.Status, result.Code, result.Details)
+	}
+	if result := s.Process(testRequest("data.bin", first), opts); result.Code != "PAYMENT_ALREADY_USED" {
+		t.Errorf("replayed range payment: got %d %s, want PAYMENT_ALREADY_USED", result.Status, result.Code)
+	}
+}
+
+func TestVolumePricingCountsDistinctTransactions(t *testing.T) {
+	store := &memStore{}
+	s, mock := newTestServer(t, &Config{AutoVerify: true, Store: store})
+	opts := Options{Amount: "0.10", VolumePricing: &VolumePricing{Tiers: []core.PriceTier{
+		{From: 0, Amount: "0.10"},
+		{From: 2, Amount: "0.05"},
+	}}}
+	payer := solana.NewWallet().PublicKey().String()
+	quote := func() string {
+		t.Helper()
+		result := s.Process(testRequest("/data", map[string]string{core.DefaultPayerHeader: payer}), opts)
+		if result.PaymentRequest == nil {
+			t.Fatalf("got %d %s, want 402", result.Status, result.Code)
+		}
+		return result.PaymentRequest.MaxAmountRequired
+	}
+
+	paymentReq := issue(t, s, "/data", opts)
+	if result := paid(s, "/data", pay(t, mock, paymentReq, payer), opts); !result.Allowed() {
+		t.Fatalf("paid request: got %d %s, want allowed", result.Status, result.Code)
+	}
+	// The same transaction recorded again, and a record without one
+	ctx := context.Background()
+	store.RecordPayment(ctx, &store.records[0])
+	store.RecordPayment(ctx, &PaymentRecord{Payer: payer, Resource: "/data", Status: PaymentStatusVerified})
+	if got := quote(); got != "0.10" {
+		t.Errorf("after one transaction: quoted %s, want 0.10", got)
+	}
+
+	paymentReq = issue(t, s, "/data", opts)
+	if result := paid(s, "/data", pay(t, mock, paymentReq, payer), opts); !result.Allowed() {
+		t.Fatalf("paid request: got %d %s, want allowed", result.Status, result.Code)
+	}
+	if got := quote(); got != "0.05" {
+		t.Errorf("after two transactions: quoted %s, want 0.05", got)
+	}
+}
@@ -0,0 +1,54 @@
+package serverx402
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/openlibx402/go/openlibx402-core"
+)
+
+// problemMembers are the members defined by RFC 9457, which rejection details
+// may not override.
+var problemMembers = map[string]bool{
+	"type":     true,
+	"title":    true,
+	"status":   true,
+	"detail":   true,
+	"instance": true,
+	"code":     true,
+}
+
+// Problem returns the rejection as RFC 9457 problem details.
+//
+// The "type" member is typeBase followed by the error code in lower case with
+// hyphens (e.g. "payment-required"), or "about:blank" if typeBase is empty.
+// The X402 error code is the "code" extension member, the payment request of
+// a 402 response the "payment_request" member, and rejection details are
+// further extension members.
+func (r *Result) Problem(typeBase string) map[string]interface{} {
+	problemType := "about:blank"
+	if typeBase != "" && r.Code != "" {
+		problemType = typeBase + strings.ToLower(strings.ReplaceAll(r.Code, "_", "-"))
+	}
+	problem := map[string]interface{}{
+		"type":   problemType,
+		"title":  http.StatusText(r.Status),
+		"status": r.Status,
+		"code":   r.Code,
+	}
+	if r.Message != "" {
+		problem["detail"] = r.Message
+	}
+	if r.Requirement != nil && r.Requirement.Resource != "" {
+		problem["instance"] = r.Requirement.Resource
+	}
+	if r.PaymentRequest != nil {
+		problem[core.ProblemPaymentRequestMember] = r.PaymentRequest
+	}
+	for k, v := range r.Details {
+		if !problemMembers[k] {
+			problem[k] = v
+		}
+	}
+	return problem
+}
@@ -0,0 +1,167 @@
+package serverx402
+
+import (
+	"container/list"
+	"context"
+	"crypto/hmac"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/openlibx402/go/openlibx402-core"
+)
+
+// QuotaStore tracks the requests included with payments (see
+// Options.RequestsIncluded).
+//
+// Implementations must be safe for concurrent use.
+type QuotaStore interface {
+	// Grant records requests included with the payment paymentID for ttl.
+	Grant(ctx context.Context, paymentID string, requests int, ttl time.Duration) error
+	// Consume uses one included request of the payment paymentID. It
+	// returns the requests left after it, or -1 if none were left or the
+	// quota expired.
+	Consume(ctx context.Context, paymentID string) (int, error)
+}
+
+// MemoryQuotaStore is an in-process QuotaStore with per-entry expiry.
+type MemoryQuotaStore struct {
+	mu         sync.Mutex
+	maxEntries int
+	order      *list.List
+	entries    map[string]*list.Element
+	path       string // State file set by PersistTo
+}
+
+// quotaEntry is an element of the MemoryQuotaStore list, oldest last.
+type quotaEntry struct {
+	paymentID string
+	remaining int
+	expiresAt time.Time
+}
+
+// NewMemoryQuotaStore creates an in-memory store holding at most maxEntries
+// quotas (default: 100000). The oldest quota is evicted when the store is
+// full. Server instances sharing a load balancer need a shared store, or
+// clients must be routed to the instance that granted their quota.
+func NewMemoryQuotaStore(maxEntries int) *MemoryQuotaStore {
+	if maxEntries <= 0 {
+		maxEntries = 100000
+	}
+	return &MemoryQuotaStore{
+		maxEntries: maxEntries,
+		order:      list.New(),
+		entries:    make(map[string]*list.Element),
+	}
+}
+
+// Grant implements QuotaStore.
+func (s *MemoryQuotaStore) Grant(ctx context.Context, paymentID string, requests int, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if elem, ok := s.entries[paymentID]; ok {
+		s.order.Remove(elem)
+	}
+	s.entries[paymentID] = s.order.PushFront(&quotaEntry{paymentID: paymentID, remaining: requests, expiresAt: time.Now().Add(ttl)})
+	for s.order.Len() > s.maxEntries {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.entries, oldest.Value.(*quotaEntry).paymentID)
+	}
+	return nil
+}
+
+// Consume implements QuotaStore.
+func (s *MemoryQuotaStore) Consume(ctx context.Context, paymentID string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	elem, ok := s.entries[paymentID]
+	if !ok {
+		return -1, nil
+	}
+	entry := elem.Value.(*quotaEntry)
+	if time.Now().After(entry.expiresAt) || entry.remaining <= 0 {
+		s.order.Remove(elem)
+		delete(s.entries, paymentID)
+		return -1, nil
+	}
+	entry.remaining--
+	if entry.remaining == 0 {
+		s.order.Remove(elem)
+		delete(s.entries, paymentID)
+	}
+	return entry.remaining, nil
+}
+
+// quotaClaims is the signed payload of a quota token.
+type quotaClaims struct {
+	Resource  string `json:"r"`
+	Payer     string `json:"p"`
+	PaymentID string `json:"q"`
+}
+
+// issueQuotaToken returns a token for the requests included with a payment.
+// It does not expire: the quota is looked up on each use.
+func (s *Server) issueQuotaToken(resource string, authorization *core.PaymentAuthorization) string {
+	payload, _ := json.Marshal(quotaClaims{Resource: resource, Payer: authorization.PublicKey, PaymentID: authorization.PaymentID})
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + s.signSession(encoded)
+}
+
+// checkQuotaToken returns the claims of a validly signed quota token for
+// resource.
+func (s *Server) checkQuotaToken(token, resource string) (quotaClaims, bool) {
+	var claims quotaClaims
+	encoded, sig, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(s.signSession(encoded))) {
+		return claims, false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || json.Unmarshal(payload, &claims) != nil || claims.Resource != resource {
+		return claims, false
+	}
+	return claims, true
+}
+
+// quotaResult returns an allowed result if the request carries the token of
+// a payment with included requests left, using one of them, or nil.
+func (s *Server) quotaResult(req Request, requirement *Requirement) *Result {
+	if requirement.RequestsIncluded <= 0 {
+		return nil
+	}
+	token := req.Header(s.config().QuotaHeader)
+	if token == "" {
+		return nil
+	}
+	claims, ok := s.checkQuotaToken(token, requirement.Resource)
+	if !ok || s.IsFlagged(claims.Payer) {
+		return nil
+	}
+	if result := s.checkPayer(req.Context, claims.Payer); result != nil {
+		return result
+	}
+	remaining, err := s.config().QuotaStore.Consume(req.Context, claims.PaymentID)
+	if err != nil {
+		// Fall back to requiring payment
+		s.logger.Error("x402: quota lookup failed", core.LogKeyPayer, claims.Payer, "payment_id", claims.PaymentID, "error", err)
+		return nil
+	}
+	if remaining < 0 {
+		return nil
+	}
+	s.logger.Debug("x402: included request used", core.LogKeyPayer, claims.Payer, core.LogKeyResource, requirement.Resource, "remaining", remaining)
+	return &Result{Requirement: requirement, Payer: claims.Payer, QuotaToken: token, QuotaRemaining: remaining}
+}
+
+// grantQuota records the requests included with a verified payment and
+// returns its quota token.
+func (s *Server) grantQuota(ctx context.Context, requirement *Requirement, authorization *core.PaymentAuthorization) (string, error) {
+	if err := s.config().QuotaStore.Grant(ctx, authorization.PaymentID, requirement.RequestsIncluded, s.config().QuotaTTL); err != nil {
+		return "", err
+	}
+	return s.issueQuotaToken(requirement.Resource, authorization), nil
+}
@@ -0,0 +1,190 @@
+package serverx402
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/openlibx402/go/openlibx402-core"
+)
+
+// RateLimitStore holds the token buckets of payers limited with
+// Config.PayerRateLimit.
+//
+// Implementations must be safe for concurrent use.
+type RateLimitStore interface {
+	// Take takes a token from the bucket of key, which holds up to
+	// limit.Burst tokens and refills at limit.RequestsPerSecond. It returns
+	// 0 if a token was taken, or else how long until one is available.
+	Take(ctx context.Context, key string, limit core.RateLimit) (time.Duration, error)
+}
+
+// burstOf returns the bucket size of a limit: its Burst, or by default
+// RequestsPerSecond, at least 1.
+func burstOf(limit core.RateLimit) float64 {
+	if limit.Burst > 0 {
+		return float64(limit.Burst)
+	}
+	return math.Max(1, math.Ceil(limit.RequestsPerSecond))
+}
+
+// MemoryRateLimitStore is an in-process RateLimitStore. Each server instance
+// sharing a load balancer then limits payers on its own; use a shared store
+// such as RedisRateLimitStore to enforce one limit across instances.
+type MemoryRateLimitStore struct {
+	mu         sync.Mutex
+	maxEntries int
+	buckets    map[string]*rateBucket
+}
+
+// rateBucket is a token bucket of a MemoryRateLimitStore.
+type rateBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewMemoryRateLimitStore creates an in-memory store holding the buckets of
+// at most maxEntries payers (default: 100000). When it is full, buckets that
+// refilled are dropped, as they are the same as new ones; if none did, the
+// payers without a bucket are not limited until some do.
+func NewMemoryRateLimitStore(maxEntries int) *MemoryRateLimitStore {
+	if maxEntries <= 0 {
+		maxEntries = 100000
+	}
+	return &MemoryRateLimitStore{maxEntries: maxEntries, buckets: make(map[string]*rateBucket)}
+}
+
+// Take implements RateLimitStore.
+func (s *MemoryRateLimitStore) Take(ctx context.Context, key string, limit core.RateLimit) (time.Duration, error) {
+	burst := burstOf(limit)
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	bucket, ok := s.buckets[key]
+	if !ok {
+		if len(s.buckets) >= s.maxEntries {
+			for k, b := range s.buckets {
+				if b.tokens+now.Sub(b.last).Seconds()*limit.RequestsPerSecond >= burst {
+					delete(s.buckets, k)
+				}
+			}
+			if len(s.buckets) >= s.maxEntries {
+				return 0, nil
+			}
+		}
+		bucket = &rateBucket{tokens: burst, last: now}
+		s.buckets[key] = bucket
+	}
+	bucket.tokens = math.Min(burst, bucket.tokens+now.Sub(bucket.last).Seconds()*limit.RequestsPerSecond)
+	bucket.last = now
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return 0, nil
+	}
+	return time.Duration((1 - bucket.tokens) / limit.RequestsPerSecond * float64(time.Second)), nil
+}
+
+// RedisRateLimitClient is the subset of a Redis client used by
+// RedisRateLimitStore. With go-redis:
+//
+//	func (r goRedis) Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error) {
+//	    return r.Client.Eval(ctx, script, keys, args...).Result()
+//	}
+type RedisRateLimitClient interface {
+	Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error)
+}
+
+// takeScript takes a token from the bucket in the hash KEYS[1], refilled at
+// ARGV[1] tokens per second up to ARGV[2], by the clock of Redis so that
+// instances agree. It returns 0, or the milliseconds until a token is
+// available. Buckets expire once refilled.
+const takeScript = `
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'last')
+local tokens = tonumber(state[1]) or burst
+local last = tonumber(state[2]) or now
+tokens = math.min(burst, tokens + (now - last) / 1000 * rate)
+local wait = 0
+if tokens >= 1 then
+  tokens = tokens - 1
+else
+  wait = math.ceil((1 - tokens) / rate * 1000)
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'last', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil(burst / rate * 1000))
+return wait
+`
+
+// RedisRateLimitStore keeps the buckets of payers in Redis, so that every
+// server instance enforces the same limit.
+type RedisRateLimitStore struct {
+	client RedisRateLimitClient
+	prefix string
+}
+
+// NewRedisRateLimitStore creates a Redis-backed store. Buckets are stored
+// under prefix (default: "x402:ratelimit:").
+func NewRedisRateLimitStore(client RedisRateLimitClient, prefix string) *RedisRateLimitStore {
+	if prefix == "" {
+		prefix = "x402:ratelimit:"
+	}
+	return &RedisRateLimitStore{client: client, prefix: prefix}
+}
+
+// Take implements RateLimitStore.
+func (s *RedisRateLimitStore) Take(ctx context.Context, key string, limit core.RateLimit) (time.Duration, error) {
+	reply, err := s.client.Eval(ctx, takeScript, []string{s.prefix + key},
+		strconv.FormatFloat(limit.RequestsPerSecond, 'f', -1, 64), strconv.FormatFloat(burstOf(limit), 'f', -1, 64))
+	if err != nil {
+		return 0, err
+	}
+	switch wait := reply.(type) {
+	case int64:
+		return time.Duration(wait) * time.Millisecond, nil
+	case int:
+		return time.Duration(wait) * time.Millisecond, nil
+	default:
+		return 0, fmt.Errorf("unexpected rate limit reply %T", reply)
+	}
+}
+
+// limitPayer takes a token from the bucket of a payer if Config.PayerRateLimit
+// is set, and returns a 429 result if none was left, or nil. The store
+// failing lets the request through.
+func (s *Server) limitPayer(ctx context.Context, payer string) *Result {
+	limit := s.config().PayerRateLimit
+	if limit.RequestsPerSecond <= 0 || payer == "" {
+		return nil
+	}
+	wait, err := s.config().RateLimitStore.Take(ctx, payer, limit)
+	if err != nil {
+		s.logger.Error("x402: rate limit store failed", core.LogKeyPayer, payer, "error", err)
+		return nil
+	}
+	if wait <= 0 {
+		return nil
+	}
+	s.logger.Info("x402: payer rate limited", core.LogKeyPayer, payer, "retry_after", wait)
+	result := reject(http.StatusTooManyRequests, "RATE_LIMITED", "Too many requests from this payer", map[string]interface{}{
+		"retry_after": math.Ceil(wait.Seconds()),
+	})
+	result.RetryAfter = wait
+	return result
+}
+
+// RetryAfterHeader returns the Retry-After header value of a rejection in
+// whole seconds, or "" if it has none.
+func (r *Result) RetryAfterHeader() string {
+	if r.RetryAfter <= 0 {
+		return ""
+	}
+	return strconv.Itoa(int(math.Ceil(r.RetryAfter.Seconds())))
+}
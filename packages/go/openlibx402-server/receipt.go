@@ -0,0 +1,200 @@
+package serverx402
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/openlibx402/go/openlibx402-core"
+)
+
+// ReceiptsPath is the path NewReceiptHandler is usually mounted at.
+const ReceiptsPath = "/x402/receipts/"
+
+const contentTypePDF = "application/pdf"
+
+// ErrReceiptNotFound is returned for payments that were not verified.
+var ErrReceiptNotFound = errors.New("no verified payment with this ID")
+
+// Receipt documents a verified payment, e.g. for expense reports.
+type Receipt struct {
+	PaymentID string    `json:"payment_id"`
+	Issuer    string    `json:"issuer,omitempty"`
+	IssuedAt  time.Time `json:"issued_at"`
+	PaidAt    time.Time `json:"paid_at"`
+	Payer     string    `json:"payer"`
+	Payee     string    `json:"payee"`
+	Resource  string    `json:"resource"`
+	Amount    string    `json:"amount"`
+	Token     string    `json:"token"` // Symbol of a known token, or its mint
+	TokenMint string    `json:"token_mint"`
+	Network   string    `json:"network"`
+	TxHash    string    `json:"tx_hash"`
+
+	// The value of the payment in fiat when it was verified, if
+	// ReceiptOptions.Oracle is set. FiatAmount is rounded to 2 decimals.
+	Currency   string  `json:"currency,omitempty"`
+	Rate       float64 `json:"rate,omitempty"`
+	FiatAmount string  `json:"fiat_amount,omitempty"`
+}
+
+// ReceiptOptions configures receipts.
+type ReceiptOptions struct {
+	Store  PaymentStore // Ledger the payments are looked up in (required)
+	Issuer string       // Name of the merchant printed on receipts
+
+	// Oracle optionally values payments in Currency (default: USD) at the
+	// time they were verified.
+	Oracle   HistoricalPriceOracle
+	Currency string
+}
+
+// Receipt returns the receipt of the verified payment paymentID, or
+// ErrReceiptNotFound.
+func (o ReceiptOptions) Receipt(ctx context.Context, paymentID string) (*Receipt, error) {
+	records, err := o.Store.ListPayments(ctx, PaymentQuery{PaymentID: paymentID, Status: PaymentStatusVerified, Limit: 1})
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up payment: %w", err)
+	}
+	if len(records) == 0 {
+		return nil, ErrReceiptNotFound
+	}
+	record := records[0]
+	receipt := &Receipt{
+		PaymentID: record.PaymentID,
+		Issuer:    o.Issuer,
+		IssuedAt:  time.Now().UTC(),
+		PaidAt:    record.CreatedAt.UTC(),
+		Payer:     record.Payer,
+		Payee:     record.PaymentAddress,
+		Resource:  record.Resource,
+		Amount:    record.Amount,
+		Token:     record.TokenMint,
+		TokenMint: record.TokenMint,
+		Network:   record.Network,
+		TxHash:    record.TxHash,
+	}
+	if token, ok := core.LookupMint(record.Network, record.TokenMint); ok {
+		receipt.Token = token.Symbol
+	}
+	if o.Oracle != nil {
+		currency := o.Currency
+		if currency == "" {
+			currency = "USD"
+		}
+		rate, err := o.Oracle.RateAt(ctx, record.TokenMint, currency, record.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to value payment: %w", err)
+		}
+		if math.IsNaN(rate) || math.IsInf(rate, 0) {
+			return nil, fmt.Errorf("failed to value payment: invalid rate %v", rate)
+		}
+		fiat := new(big.Rat).Mul(parseAmount(record.Amount), new(big.Rat).SetFloat64(rate))
+		receipt.Currency, receipt.Rate, receipt.FiatAmount = currency, rate, fiat.FloatString(2)
+	}
+	return receipt, nil
+}
+
+// WritePDF renders the receipt as a one-page PDF document.
+func (r *Receipt) WritePDF(w io.Writer) error {
+	const left, valueX, top, lineHeight = 56, 176, 780, 16
+
+	texts := []pdfText{{x: left, y: top, font: pdfBold, size: 20, text: "Receipt"}}
+	y := float64(top - 28)
+	if r.Issuer != "" {
+		texts = append(texts, pdfText{x: left, y: y, font: pdfBold, size: 12, text: r.Issuer})
+		y -= 28
+	}
+
+	amount := r.Amount + " " + r.Token
+	rows := [][2]string{
+		{"Payment ID", r.PaymentID},
+		{"Date", r.PaidAt.Format("2006-01-02 15:04:05 UTC")},
+		{"Resource", r.Resource},
+		{"Amount", amount},
+	}
+	if r.FiatAmount != "" {
+		rows = append(rows, [2]string{"Value", fmt.Sprintf("%s %s (1 %s = %s %s)",
+			r.FiatAmount, r.Currency, r.Token, strconv.FormatFloat(r.Rate, 'f', -1, 64), r.Currency)})
+	}
+	rows = append(rows,
+		[2]string{"Paid by", r.Payer},
+		[2]string{"Paid to", r.Payee},
+		[2]string{"Network", r.Network},
+		[2]string{"Transaction", r.TxHash},
+	)
+	for _, row := range rows {
+		texts = append(texts, pdfText{x: left, y: y, font: pdfBold, size: 10, text: row[0]})
+		// Monospaced values wrap at the right margin
+		for value := []rune(row[1]); ; {
+			line := value
+			if len(line) > 64 {
+				line = line[:64]
+			}
+			texts = append(texts, pdfText{x: valueX, y: y, font: pdfMono, size: 9, text: string(line)})
+			y -= lineHeight
+			if value = value[len(line):]; len(value) == 0 {
+				break
+			}
+		}
+		y -= 4
+	}
+
+	texts = append(texts, pdfText{x: left, y: y - 24, font: pdfRegular, size: 8,
+		text: "Issued " + r.IssuedAt.Format("2006-01-02 15:04:05 UTC") + ". The transaction can be verified on the " + r.Network + " ledger."})
+	_, err := w.Write(renderPDF(texts))
+	return err
+}
+
+// NewReceiptHandler returns a handler serving the receipts of verified
+// payments at <prefix>/{payment_id}, as JSON by default, or as a PDF document
+// with "?format=pdf" or an Accept header preferring application/pdf:
+//
+//	mux.Handle(serverx402.ReceiptsPath, serverx402.NewReceiptHandler(serverx402.ReceiptOptions{
+//	    Store:  store,
+//	    Issuer: "Example Inc.",
+//	}))
+//
+// Payment IDs are random, so only the payer and the merchant know them;
+// receipts hold nothing that is not public on the ledger.
+func NewReceiptHandler(opts ReceiptOptions) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			writeAdminError(w, http.StatusMethodNotAllowed, errMethodNotAllowed)
+			return
+		}
+		paymentID := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+		if paymentID == "" {
+			writeAdminError(w, http.StatusNotFound, ErrReceiptNotFound)
+			return
+		}
+		receipt, err := opts.Receipt(r.Context(), paymentID)
+		if errors.Is(err, ErrReceiptNotFound) {
+			writeAdminError(w, http.StatusNotFound, err)
+			return
+		}
+		if err != nil {
+			writeAdminError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		w.Header().Add("Vary", "Accept")
+		format := r.URL.Query().Get("format")
+		if format == "pdf" || (format == "" && negotiate(r.Header.Get("Accept"), []string{ContentTypeJSON, contentTypePDF}) == contentTypePDF) {
+			w.Header().Set("Content-Type", contentTypePDF)
+			w.Header().Set("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": "receipt-" + receipt.PaymentID + ".pdf"}))
+			receipt.WritePDF(w)
+			return
+		}
+		writeAdminJSON(w, receipt)
+	})
+}
@@ -0,0 +1,76 @@
+package serverx402
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/openlibx402/go/openlibx402-core"
+)
+
+// RefundHeader carries the refund transaction hash on error responses of
+// endpoints that refund on handler errors.
+const RefundHeader = "X-Payment-Refund"
+
+// RefundStore is implemented by payment stores that also record refunds.
+type RefundStore interface {
+	RecordRefund(ctx context.Context, refund *core.Refund) error
+}
+
+// Refund returns amount of a verified payment to the payer, e.g. when the
+// handler failed after the payment was accepted. An empty amount refunds the
+// full payment. The refund goes to the wallet the payment transaction
+// debited on-chain, whatever payer the authorization names.
+//
+// Refunds are sent by Config.RefundProcessor, which must hold the keypair of
+// the payment address. The refund is logged, recorded if the store implements
+// RefundStore, and sent to webhooks as payment_refunded.
+func (s *Server) Refund(ctx context.Context, authorization *core.PaymentAuthorization, amount, reason string) (*core.Refund, error) {
+	if s.config().RefundProcessor == nil {
+		return nil, fmt.Errorf("refunds are not configured: set Config.RefundProcessor")
+	}
+
+	refund, err := s.config().RefundProcessor.RefundPayment(ctx, authorization, amount)
+	if err != nil {
+		s.logger.Error("x402: refund failed", "authorization", authorization, core.LogKeyAmount, amount, "error", err)
+		return nil, err
+	}
+	refund.Reason = reason
+
+	if store, ok := s.config().Store.(RefundStore); ok {
+		if err := store.RecordRefund(ctx, refund); err != nil {
+			s.logger.Error("x402: failed to record refund", core.LogKeyPaymentID, refund.PaymentID, core.LogKeyTxHash, refund.TransactionHash, "error", err)
+		}
+	}
+	s.emit(Event{Type: EventPaymentRefunded, Authorization: authorization, Refund: refund, Message: reason})
+	return refund, nil
+}
+
+// RefundOnError issues a full refund for a paid request whose handler responded
+// with a 5xx status. It returns nil if no refund was sent: for other statuses,
+// free access, held payments that were captured, payments not verified
+// on-chain (AutoVerify disabled, settlement still pending, or Lightning
+// payments), or when the refund fails, which is logged.
+//
+// The refund is sent before the error response so adapters can report its
+// transaction hash in RefundHeader; it is bounded by Config.SettlementTimeout.
+func (s *Server) RefundOnError(ctx context.Context, result *Result, status int) *core.Refund {
+	if status < 500 || result == nil || result.Authorization == nil || result.Captured != "" {
+		return nil
+	}
+	if result.VerifiedAmount == "" || result.Payer == "" {
+		s.logger.Warn("x402: refund skipped for payment not verified on-chain", "authorization", result.Authorization, "status", status)
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), s.config().SettlementTimeout)
+	defer cancel()
+	refund, err := s.Refund(ctx, result.Authorization, "", fmt.Sprintf("handler failed with status %d", status))
+	if err != nil {
+		return nil
+	}
+	if result.Requirement != nil && result.Requirement.Capture {
+		// Nothing is left to capture
+		result.Captured = "0"
+	}
+	return refund
+}
@@ -0,0 +1,80 @@
+package serverx402
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/openlibx402/go/openlibx402-core"
+)
+
+// reload remembers the payee replaced by the last Reload.
+type reload struct {
+	mu             sync.Mutex // Serializes Reload calls
+	paymentAddress string
+	tokenMint      string
+	at             time.Time
+}
+
+// Reload atomically replaces the payee of the server at runtime, e.g. to
+// rotate the payment address to a new key, without restarting it: requests
+// that start after it resolve to the PaymentAddress and TokenMint of
+// config, where set. RefundProcessor and SweepSigner are replaced with them
+// if set, as they must hold the key of the payment address. Other fields of
+// config are ignored: they take effect on a restart. config may not change
+// the network, and the resulting configuration is checked with Validate.
+//
+// Payments in flight are not dropped: a payment to the previous address or
+// mint is still verified as long as payment requests issued before Reload
+// are valid (see Options.ExpiresIn). Prices set in a pricing table are
+// replaced with the table's SetRules or Load instead.
+func (s *Server) Reload(config *Config) error {
+	s.reload.mu.Lock()
+	defer s.reload.mu.Unlock()
+
+	current := s.config()
+	if config.Network != "" && config.Network != current.Network {
+		return fmt.Errorf("cannot reload network %s: the server verifies payments on %s", config.Network, current.Network)
+	}
+	next := *current
+	if config.PaymentAddress != "" {
+		next.PaymentAddress = config.PaymentAddress
+	}
+	if config.TokenMint != "" {
+		next.TokenMint = config.TokenMint
+	}
+	if config.RefundProcessor != nil {
+		next.RefundProcessor = config.RefundProcessor
+	}
+	if config.SweepSigner != nil {
+		next.SweepSigner = config.SweepSigner
+	}
+	if err := next.Validate(); err != nil {
+		return err
+	}
+
+	s.reload.paymentAddress, s.reload.tokenMint = current.PaymentAddress, current.TokenMint
+	s.reload.at = time.Now()
+	s.current.Store(&next)
+	s.invalid.Store(nil)
+	s.logger.Info("x402: configuration reloaded", "payment_address", next.PaymentAddress, "mint", next.TokenMint, core.LogKeyNetwork, next.Network)
+	return nil
+}
+
+// acceptPreviousPayee lets an authorization paying the payee replaced by
+// Reload be verified against it, if payment requests issued before the
+// reload may still be valid and the resource does not set its own payee.
+func (s *Server) acceptPreviousPayee(requirement *Requirement, opts Options, authorization *core.PaymentAuthorization) {
+	s.reload.mu.Lock()
+	previousAddress, previousMint, at := s.reload.paymentAddress, s.reload.tokenMint, s.reload.at
+	s.reload.mu.Unlock()
+	if at.IsZero() || time.Since(at) > time.Duration(requirement.ExpiresIn)*time.Second+s.config().MaxClockSkew {
+		return
+	}
+	if opts.PaymentAddress == "" && authorization.PaymentAddress == previousAddress {
+		requirement.PaymentAddress = previousAddress
+	}
+	if opts.TokenMint == "" && authorization.AssetAddress == previousMint {
+		requirement.TokenMint = previousMint
+	}
+}
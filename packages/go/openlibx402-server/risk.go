@@ -0,0 +1,220 @@
+package serverx402
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/openlibx402/go/openlibx402-core"
+)
+
+// RiskAssessor scores payments before they are verified (see
+// Config.RiskAssessor), e.g. with a fraud detection service.
+//
+// Implementations must be safe for concurrent use.
+type RiskAssessor interface {
+	// Assess decides whether a payment may proceed to verification. An
+	// error lets it proceed as if no assessor were configured.
+	Assess(ctx context.Context, payment *RiskPayment) (RiskDecision, error)
+}
+
+// RiskPayment describes a payment being assessed.
+type RiskPayment struct {
+	Payer     string // Public key of the payer
+	Amount    string // Price the payment must pay
+	TokenMint string
+	Resource  string
+	// ClientIP is the IP address of the client, if the adapter reports it
+	// (see Request.ClientIP).
+	ClientIP string
+	// History holds the payer's latest payment attempts, verified and
+	// failed, newest first, from Config.Store (nil without one).
+	History       []PaymentRecord
+	Authorization *core.PaymentAuthorization
+}
+
+// RiskDecision is the outcome of a risk assessment. The zero value lets the
+// payment proceed.
+type RiskDecision struct {
+	// Reject rejects the payment with 403 PAYMENT_REJECTED.
+	Reject bool
+	// Commitment steps up verification, when it is above Config.Commitment:
+	// the payment is only accepted once its transaction reached it, e.g.
+	// finalized for large payments. Step-up requires Config.AutoVerify; the
+	// payment is rejected without it.
+	Commitment core.Commitment
+	// Reason explains the decision to the client and in logs.
+	Reason string
+}
+
+// riskHistory is how many payment attempts of the payer RiskPayment.History
+// holds at most.
+const riskHistory = 100
+
+// assessRisk runs the configured RiskAssessor for a payment, and returns a
+// result rejecting it, or nil. A step-up decision sets requirement.Commitment.
+func (s *Server) assessRisk(req Request, requirement *Requirement, authorization *core.PaymentAuthorization) *Result {
+	assessor := s.config().RiskAssessor
+	if assessor == nil {
+		return nil
+	}
+	payment := &RiskPayment{
+		Payer:         authorization.PublicKey,
+		Amount:        requirement.Amount,
+		TokenMint:     requirement.TokenMint,
+		Resource:      requirement.Resource,
+		ClientIP:      req.ClientIP,
+		Authorization: authorization,
+	}
+	if store := s.config().Store; store != nil {
+		history, err := store.ListPayments(req.Context, PaymentQuery{Payer: authorization.PublicKey, Limit: riskHistory})
+		if err != nil {
+			s.logger.Error("x402: payment history lookup failed", core.LogKeyPayer, authorization.PublicKey, "error", err)
+		}
+		payment.History = history
+	}
+	decision, err := assessor.Assess(req.Context, payment)
+	if err != nil {
+		s.logger.Error("x402: risk assessment failed", core.LogKeyPayer, authorization.PublicKey, core.LogKeyResource, requirement.Resource, "error", err)
+		return nil
+	}
+	switch {
+	case decision.Reject:
+		s.logger.Warn("x402: payment rejected by risk assessment", core.LogKeyPayer, authorization.PublicKey, core.LogKeyResource, requirement.Resource, "reason", decision.Reason)
+		return reject(http.StatusForbidden, "PAYMENT_REJECTED", "Payment rejected by risk assessment", map[string]interface{}{
+			"message": decision.Reason,
+		})
+	case commitmentRank(decision.Commitment) > commitmentRank(s.config().Commitment):
+		if !s.config().AutoVerify {
+			return reject(http.StatusForbidden, "PAYMENT_REJECTED", "Payment requires on-chain verification", map[string]interface{}{
+				"message": decision.Reason,
+			})
+		}
+		s.logger.Info("x402: payment verification stepped up", core.LogKeyPayer, authorization.PublicKey, "commitment", decision.Commitment, "reason", decision.Reason)
+		requirement.Commitment = decision.Commitment
+	}
+	return nil
+}
+
+// RemoteIP returns the IP address of a remote address such as
+// http.Request.RemoteAddr, without its port. Behind a proxy, it is the
+// proxy's address.
+func RemoteIP(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// commitmentRank orders commitments from the least to the most final. The
+// empty commitment is the default, confirmed.
+func commitmentRank(commitment core.Commitment) int {
+	switch commitment {
+	case core.CommitmentProcessed:
+		return 1
+	case core.CommitmentFinalized:
+		return 3
+	default:
+		return 2
+	}
+}
+
+// HeuristicRiskAssessor is a RiskAssessor applying simple rules to the
+// payer's history and IP address. Its zero value only rejects payers with
+// many failed payments; set the other fields to enable more rules.
+type HeuristicRiskAssessor struct {
+	// Window is how far back the rules look (default: 1 hour).
+	Window time.Duration
+	// MaxFailures rejects payers with this many failed payment attempts
+	// within Window (default: 5). Failures are recorded in Config.Store.
+	MaxFailures int
+	// LargeAmount steps up payments of at least this amount to finalized.
+	LargeAmount string
+	// NewPayerAmount steps up payments of at least this amount by payers
+	// without a verified payment in their history to finalized.
+	NewPayerAmount string
+	// MaxPayersPerIP steps up payments from an IP address that more payers
+	// paid from within Window to finalized, as when one client cycles
+	// through fresh wallets.
+	MaxPayersPerIP int
+
+	mu     sync.Mutex
+	payers map[string]map[string]time.Time // Payers by IP address, with the time they were last seen
+	pruned time.Time
+}
+
+var _ RiskAssessor = (*HeuristicRiskAssessor)(nil)
+
+// Assess implements RiskAssessor.
+func (h *HeuristicRiskAssessor) Assess(ctx context.Context, payment *RiskPayment) (RiskDecision, error) {
+	window := h.Window
+	if window <= 0 {
+		window = time.Hour
+	}
+	maxFailures := h.MaxFailures
+	if maxFailures <= 0 {
+		maxFailures = 5
+	}
+	since := time.Now().Add(-window)
+
+	failures, verified := 0, false
+	for _, record := range payment.History {
+		switch {
+		case record.Status == PaymentStatusVerified:
+			verified = true
+		case record.CreatedAt.After(since):
+			failures++
+		}
+	}
+	if failures >= maxFailures {
+		return RiskDecision{Reject: true, Reason: "too many failed payments"}, nil
+	}
+	if h.LargeAmount != "" && core.CompareAmounts(payment.Amount, h.LargeAmount) >= 0 {
+		return RiskDecision{Commitment: core.CommitmentFinalized, Reason: "large payment"}, nil
+	}
+	if h.NewPayerAmount != "" && !verified && core.CompareAmounts(payment.Amount, h.NewPayerAmount) >= 0 {
+		return RiskDecision{Commitment: core.CommitmentFinalized, Reason: "payment by a new payer"}, nil
+	}
+	if h.MaxPayersPerIP > 0 && payment.ClientIP != "" && h.payersFrom(payment.ClientIP, payment.Payer, since) > h.MaxPayersPerIP {
+		return RiskDecision{Commitment: core.CommitmentFinalized, Reason: "many payers from one IP address"}, nil
+	}
+	return RiskDecision{}, nil
+}
+
+// payersFrom records that payer paid from ip, and returns how many payers
+// did since then.
+func (h *HeuristicRiskAssessor) payersFrom(ip, payer string, since time.Time) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.payers == nil {
+		h.payers = make(map[string]map[string]time.Time)
+	}
+	// Drop what the window no longer covers now and then, so that memory
+	// stays bounded
+	if time.Since(h.pruned) > time.Minute {
+		for addr, seen := range h.payers {
+			for key, at := range seen {
+				if at.Before(since) {
+					delete(seen, key)
+				}
+			}
+			if len(seen) == 0 {
+				delete(h.payers, addr)
+			}
+		}
+		h.pruned = time.Now()
+	}
+	if h.payers[ip] == nil {
+		h.payers[ip] = make(map[string]time.Time)
+	}
+	h.payers[ip][payer] = time.Now()
+	count := 0
+	for _, at := range h.payers[ip] {
+		if at.After(since) {
+			count++
+		}
+	}
+	return count
+}
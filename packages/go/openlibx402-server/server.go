@@ -0,0 +1,1674 @@
+// Package serverx402 implements the framework-agnostic X402 server pipeline.
+//
+// The middleware packages (net/http, Echo, fasthttp, Connect, gqlgen) are thin
+// adapters around this package: they extract headers and the resource from the
+// framework's request type, call Server.Process, and render the Result. Header
+// parsing, payer policies, amount/address/mint checks, on-chain verification,
+// and error shaping all live here so fixes land once.
+package serverx402
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/openlibx402/go/openlibx402-core"
+)
+
+// Config holds server configuration for X402 middleware.
+type Config struct {
+	PaymentAddress string
+	TokenMint      string
+	Network        string
+	RPCURL         string
+	AutoVerify     bool
+
+	AuthorizationHeader string // Payment authorization header name (default: X-Payment-Authorization)
+	PayerHeader         string // Payer public key header name (default: X-Payer-Public-Key)
+
+	// StrictTokens accepts only token mints of the core token registry for
+	// the network (see core.RegisterToken), and checks once that their
+	// decimals on-chain match the registry's, if the processor implements
+	// core.MintInspector. Without it, only mints registered on another
+	// network are rejected, e.g. mainnet USDC configured for devnet.
+	StrictTokens bool
+
+	// HTTPClient optionally sets the HTTP client used for RPC requests, e.g. to
+	// tune the connection pool. By default a pooled transport is created.
+	HTTPClient *http.Client
+	// RPCURLs optionally adds RPC endpoints that verification is load balanced
+	// and fails over across together with RPCURL (see core.ProcessorOptions).
+	RPCURLs []string
+	// RPCHealthCheckInterval enables periodic health checks of the endpoints
+	// when positive.
+	RPCHealthCheckInterval time.Duration
+	// RPCRateLimit caps the rate of calls to each RPC endpoint, so that
+	// verification under load stays within the provider's limits instead of
+	// being rejected with 429s (default: none).
+	RPCRateLimit core.RateLimit
+	// RPCRetry retries transient RPC failures during on-chain verification
+	// (default: no retries; see core.DefaultRetryPolicy).
+	RPCRetry core.RetryPolicy
+	// Commitment is the commitment a payment transaction must reach to be
+	// verified (default: confirmed). Finalized rules out rolled-back payments
+	// at the cost of several seconds of latency.
+	Commitment core.Commitment
+	// RPCWebSocketURL optionally sets the RPC node's WebSocket endpoint, e.g.
+	// "wss://api.mainnet-beta.solana.com". Verification then subscribes to
+	// transactions that have not landed yet and accepts them as soon as they
+	// do, instead of rejecting them.
+	RPCWebSocketURL string
+	// Processor optionally replaces the processor payments are verified with,
+	// e.g. with a core.MockProcessor in unit tests. The RPC settings above
+	// are then unused. The server closes it on Close.
+	Processor core.PaymentProcessor
+
+	// Verifiers are the stages payment authorizations are verified by, in
+	// order (default: DefaultVerifiers). Extend or reorder them to add
+	// checks, e.g. against an internal ledger before the RPC node is called.
+	// Without ChainVerifier, transactions are not verified on-chain.
+	Verifiers []Verifier
+
+	// VerificationCache optionally caches on-chain verification results so that
+	// repeated requests with the same authorization, such as replays rejected
+	// as used, skip the RPC node.
+	VerificationCache VerificationCache
+	// VerificationCacheTTL is how long a verified transaction is cached (default: 10 minutes).
+	VerificationCacheTTL time.Duration
+
+	// AsyncSettlement serves requests as soon as the authorization passes the
+	// other Verifiers, such as the amount, address, and mint checks, and
+	// verifies the transaction on-chain in a background worker pool. Payers whose settlement fails are flagged and
+	// rejected on later requests. Requires AutoVerify and RequireAttestation,
+	// so that the payer flagged is the one who signed the authorization.
+	AsyncSettlement bool
+	// SettlementWorkers is the number of settlement workers (default: 4).
+	SettlementWorkers int
+	// SettlementTimeout bounds each background verification (default: 30 seconds).
+	SettlementTimeout time.Duration
+	// OnSettlementFailure is called from a worker when a settlement fails.
+	OnSettlementFailure func(failure SettlementFailure)
+
+	// SweepTreasury enables sweeping: a background worker periodically
+	// transfers the tokens received at the payment address to this treasury
+	// address, e.g. a cold wallet. SweepSigner must hold the key of the
+	// payment address.
+	SweepTreasury string
+	SweepSigner   core.Signer
+	// SweepInterval is the delay between sweeps (default: 1 hour).
+	SweepInterval time.Duration
+	// SweepThreshold is the minimum balance of a token to sweep (default:
+	// any), and SweepReserve the balance left at the payment address, e.g.
+	// for refunds (default: none).
+	SweepThreshold string
+	SweepReserve   string
+	// SweepTokens are the mints of the swept tokens (default: TokenMint).
+	SweepTokens []string
+	// OnSweep is called after each sweep transfer, including failed ones.
+	OnSweep func(sweep Sweep)
+
+	// DeferredPayers are the public keys of payers trusted to pay after the
+	// response. Their requests, declaring the payer in PayerHeader, are
+	// served without payment and answered with a payment request in
+	// DeferredHeader, which they must pay within DeferredWindow by sending the
+	// authorization back to the resource. Payers that default are downgraded
+	// to paying upfront (see Server.Reinstate). Public keys in PayerHeader are
+	// self-declared, so deferred payers should also be authenticated by other
+	// means, such as API keys.
+	DeferredPayers []string
+	// DeferredWindow is how long a deferred payer has to pay (default: 1 minute).
+	DeferredWindow time.Duration
+	// MaxDeferredDebts is how many unpaid deferred payments a payer may owe
+	// before it must pay upfront (default: 1).
+	MaxDeferredDebts int
+	// DeferredHeader is the deferred payment request header name (default: X-Payment-Deferred).
+	DeferredHeader string
+	// OnDeferredDefault is called when a deferred payer misses its window.
+	OnDeferredDefault func(debt Debt)
+
+	// EscrowWindow is how long after a payment request expires the payer
+	// has to release an escrow deposit (see Options.Escrow) before it may
+	// reclaim it instead (default: 10 minutes).
+	EscrowWindow time.Duration
+
+	// PriceOracle converts prices set in fiat with Options.FiatAmount to token
+	// amounts (see CoinGeckoOracle and PythOracle). Currency is the fiat
+	// currency of those prices (default: USD).
+	PriceOracle PriceOracle
+	Currency    string
+	// QuoteTTL is how long a quoted rate is valid (default: 1 minute).
+	// Payment requests priced in fiat expire with their quote, and rates are
+	// fetched from the oracle at most once per QuoteTTL.
+	QuoteTTL time.Duration
+	// QuoteDecimals is the precision quoted token amounts are rounded up to
+	// (default: 6). It must not exceed the decimals of the token mint.
+	QuoteDecimals int
+
+	// Webhooks optionally receives payment events (see WebhookDispatcher).
+	Webhooks *WebhookDispatcher
+
+	// Logger receives structured logs for payment events (default: discard).
+	Logger *slog.Logger
+
+	// Store optionally records issued payment requests and payment attempts
+	// (see PaymentStore). Writes happen on the request path.
+	Store PaymentStore
+
+	// RefundProcessor sends refunds issued with Server.Refund. It must be
+	// created with the keypair of the payment address.
+	RefundProcessor *core.SolanaPaymentProcessor
+
+	// SessionTTL enables session tokens when positive: a verified payment
+	// returns a token in SessionHeader that grants access to the same resource
+	// without further payment until the TTL elapses. Clients use it to share one
+	// payment between concurrent requests. Tokens are bearer credentials.
+	SessionTTL time.Duration
+	// SessionSecret is the HMAC key signing session tokens. Set it to share
+	// tokens between instances (default: random per process).
+	SessionSecret []byte
+	// SessionHeader is the session token header name (default: X-Payment-Session).
+	SessionHeader string
+
+	// PlanHeader names the subscription plan a request buys (default:
+	// X-Payment-Plan), and SubscriptionHeader carries the subscription token
+	// issued for it (default: X-Payment-Subscription). Subscriptions are
+	// offered with Options.Plans and signed with SessionSecret.
+	PlanHeader         string
+	SubscriptionHeader string
+
+	// QuotaStore tracks the requests included with payments (see
+	// Options.RequestsIncluded) (default: a MemoryQuotaStore).
+	QuotaStore QuotaStore
+	// QuotaTTL is how long included requests stay usable after the payment
+	// (default: 24 hours).
+	QuotaTTL time.Duration
+	// QuotaHeader is the quota token header name (default: X-Payment-Quota),
+	// and QuotaRemainingHeader reports the included requests left (default:
+	// X-Payment-Quota-Remaining). Quota tokens are signed with SessionSecret.
+	QuotaHeader          string
+	QuotaRemainingHeader string
+
+	// ChannelStore tracks the payment channels opened by deposits (see
+	// Options.ChannelDeposit) (default: a MemoryChannelStore).
+	ChannelStore ChannelStore
+	// ChannelTTL is how long a channel stays open before the unspent deposit
+	// is refunded (default: 1 hour).
+	ChannelTTL time.Duration
+	// VoucherHeader is the voucher header name (default: X-Payment-Voucher).
+	// ChannelHeader returns the ID of an opened channel (default:
+	// X-Payment-Channel), and ChannelBalanceHeader what is left of its
+	// deposit (default: X-Payment-Channel-Balance).
+	VoucherHeader        string
+	ChannelHeader        string
+	ChannelBalanceHeader string
+
+	// TabStore tracks the tabs of payers charging requests with vouchers
+	// (see Options.MaxOutstanding) (default: a MemoryTabStore).
+	TabStore TabStore
+	// TabHeader reports the outstanding balance of the payer's tab
+	// (default: X-Payment-Tab-Outstanding).
+	TabHeader string
+
+	// SolanaPay adds a Solana Pay transfer request to payment requests (see
+	// core.PaymentRequest.SolanaPayURL), so that they can be paid from a
+	// mobile wallet, e.g. by scanning a QR code. The client then repeats the
+	// request with the payment ID in ReferenceHeader (default:
+	// X-Payment-Reference), and the server finds the transfer by its
+	// reference. Requires AutoVerify, a NonceStore, and a processor
+	// implementing core.ReferenceFinder.
+	SolanaPay       bool
+	ReferenceHeader string
+
+	// Lightning offers payment requests for resources with
+	// Options.LightningSats as a Lightning invoice too, created with this
+	// backend, e.g. an LND or Core Lightning node of the openlibx402-lightning
+	// module. A client paying it repeats the request with a
+	// core.LightningProof in LightningHeader (default: X-Payment-Lightning),
+	// and the server checks the preimage and that the node settled the
+	// invoice. Requires a NonceStore.
+	Lightning       core.LightningBackend
+	LightningHeader string
+
+	// RequirePaymentMemo rejects payments whose transaction lacks the memo
+	// binding it to the payment_id (see core.PaymentMemo), so one transfer
+	// cannot pay for another request. Clients of this SDK always attach it;
+	// leave it off to accept payments from clients that do not.
+	RequirePaymentMemo bool
+
+	// PayerRateLimit bounds the rate of requests of each payer, identified
+	// as for Result.Payer, to bound abuse even from paying clients (default:
+	// none). Requests over it are rejected with 429 and a Retry-After header
+	// before their payment is verified or their token or voucher is used, so
+	// that they can be repeated with it later. RateLimitStore holds the
+	// buckets of payers (default: a MemoryRateLimitStore); share one, such as
+	// a RedisRateLimitStore, between server instances. Payments should be
+	// attested (see RequireAttestation), or a client could use up the limit
+	// of another payer by claiming its public key.
+	PayerRateLimit core.RateLimit
+	RateLimitStore RateLimitStore
+
+	// BlockedPayers rejects the requests of payers on it with 403
+	// PAYER_BLOCKED, and AllowedPayers, if set, those of payers not on it
+	// with 403 PAYER_NOT_ALLOWED (see MemoryPayerList and RedisPayerList).
+	// They are checked where PayerRateLimit is, on every request, so that
+	// updates apply at once, including to sessions and tokens issued before.
+	// A list that cannot be read rejects the request with 503.
+	BlockedPayers PayerList
+	AllowedPayers PayerList
+
+	// AuditLog optionally records every payment decision of Server.Process
+	// in a tamper-evident log: payment requests issued, payments accepted,
+	// and rejections with their reason (see OpenAuditLog). Server.Shutdown
+	// closes it.
+	AuditLog *AuditLog
+
+	// MaxAuthorizationAge rejects authorizations whose timestamp is older than
+	// it, bounding how long a captured authorization header can be replayed
+	// (default: 0, no limit). MaxClockSkew is how far a timestamp may lie in
+	// the future, to tolerate clients with fast clocks (default: 30 seconds).
+	MaxAuthorizationAge time.Duration
+	MaxClockSkew        time.Duration
+
+	// RequireAttestation rejects authorizations that are not signed by the
+	// payer's key (see core.PaymentAuthorization.Attest), so a header cannot
+	// claim a payer it does not hold the key of. The signature is checked
+	// before payer policies and RPC calls. Clients of this SDK always attest;
+	// leave it off to accept payments from clients that do not.
+	RequireAttestation bool
+
+	// RiskAssessor optionally scores payments before they are verified, with
+	// the payer's history in Store and the client's IP address, and may
+	// reject them or step up the commitment their transaction must reach
+	// (see HeuristicRiskAssessor). Sessions, tokens, and vouchers issued for
+	// accepted payments are not assessed again.
+	RiskAssessor RiskAssessor
+
+	// NonceStore binds authorizations to the payment requests this server
+	// issued. Authorizations are rejected if their payment_id was never
+	// issued, was issued for a different resource, recipient, or token or a
+	// lower amount, or if they were created after the request expired.
+	// Without it, a client can craft an authorization for any transfer to the
+	// payment address of the right token and amount.
+	//
+	// Each payment pays for one request: its payment_id and transaction hash
+	// are consumed in NonceStore once its authorization is verified, and
+	// replays or other authorizations with the same transaction are rejected
+	// with 403 PAYMENT_ALREADY_USED. Without a NonceStore, payments are
+	// consumed in memory, which other instances do not share and a restart
+	// forgets. Sessions (see SessionTTL) share one payment between requests
+	// instead.
+	NonceStore NonceStore
+	// NonceTTL is how long issued payment requests and consumed payments are
+	// remembered, and so how long authorizations for them are accepted
+	// (default: 24 hours). Set RequirePaymentMemo so that a transaction
+	// forgotten after it cannot pay for another payment request either.
+	NonceTTL time.Duration
+
+	// ProblemDetails sends 402 and rejection responses as RFC 9457
+	// application/problem+json, with the payment request in the
+	// "payment_request" extension member (see Server.Response), for gateways
+	// and clients standardized on problem details. ProblemTypeBase prefixes
+	// the error code to form the "type" URI, e.g.
+	// "https://api.example.com/problems/" (default: "about:blank").
+	ProblemDetails  bool
+	ProblemTypeBase string
+
+	// Build402 optionally builds the 402 responses of the net/http, Echo,
+	// and fasthttp middlewares from the payment request, e.g. to add links
+	// to documentation, trial offers, or free alternatives. The body is sent
+	// as JSON (or CBOR if the client asks for it); a zero status keeps 402.
+	// Clients find the payment request in its "payment_request" member.
+	// HTML paywall pages are not affected. See Server.HTTPResponse.
+	Build402 func(r *http.Request, req *core.PaymentRequest) (status int, body interface{})
+	// BuildRejection optionally builds the other error responses of those
+	// middlewares, such as 400, 403, and 429 rejections, from the result,
+	// e.g. to wrap Result.Code and Result.Message in the error envelope used
+	// across an API. The body is sent like that of Build402.
+	BuildRejection func(r *http.Request, result *Result) (status int, body interface{})
+
+	// HTMLPaywall sends browsers, whose Accept header prefers text/html, an
+	// HTML page describing the payment instead of the JSON payment request
+	// (see Server.Response). PaywallTemplate optionally replaces the page; it
+	// is executed with a *PaywallData (default: DefaultPaywallTemplate).
+	HTMLPaywall     bool
+	PaywallTemplate *template.Template
+
+	// WalletPaywall lets browser users pay: browsers get a page that pays
+	// with the Phantom wallet and returns the authorization in PaywallCookie,
+	// which is then accepted in place of the authorization header (see
+	// WalletPaywallTemplate). It implies HTMLPaywall. PaywallRPCURL is the RPC
+	// endpoint the browser uses, which is public, so it should not be an RPC
+	// URL with credentials (default: the network's public endpoint).
+	WalletPaywall bool
+	PaywallRPCURL string
+	// PaywallQRCode shows the Solana Pay URL of payment requests on the
+	// paywall page as a QR code, so that people can pay from a mobile
+	// wallet. The page then polls the resource until the payment is
+	// confirmed, with the payment ID in PaywallReferenceCookie, which is
+	// accepted in place of the reference header. Requires SolanaPay; it
+	// implies HTMLPaywall.
+	PaywallQRCode bool
+}
+
+// Options configures payment requirements for a resource.
+//
+// Empty fields fall back to the server configuration.
+type Options struct {
+	Amount         string // Required payment amount (e.g., "0.10")
+	PaymentAddress string // Optional override of configured payment address
+	TokenMint      string // Optional override of configured token mint
+	Network        string // Optional override of configured network (must match it with AutoVerify)
+	Description    string // Human-readable description
+	ExpiresIn      int    // Expiration time in seconds (default: 300)
+
+	// Plans optionally offers subscription plans in the 402 response. A
+	// request naming one in the plan header is priced at the plan's amount,
+	// and its payment starts or renews the payer's subscription, which is
+	// recorded in Config.Store and grants access without further payment.
+	// Requires a Config.Store implementing SubscriptionStore.
+	Plans []core.SubscriptionPlan
+
+	// RequestsIncluded optionally lets a verified payment grant that many
+	// further requests to the resource, tracked in Config.QuotaStore. The
+	// paid response carries a quota token that the client sends with them.
+	RequestsIncluded int
+
+	// AcceptedTokens optionally accepts payment in other tokens besides
+	// TokenMint, each at its own price. The 402 response lists them, and a
+	// payment is verified against the price of the token it was made with.
+	// Volume and fiat pricing, per-payer discounts, and subscription plans
+	// apply to TokenMint only.
+	AcceptedTokens []core.TokenPrice
+
+	// Splits optionally pays percentages of the price to other recipients,
+	// e.g. a creator's payout next to the platform's fee at PaymentAddress,
+	// which receives the rest. Payments transfer every share in one
+	// transaction, and each is verified on-chain.
+	Splits []core.PaymentSplit
+
+	// Escrow optionally asks payers to deposit the payment into an escrow
+	// program and release it to PaymentAddress once the response is
+	// delivered; deposits that are not released return to the payer after
+	// Config.EscrowWindow. The server verifies the deposit before serving
+	// the request. Requires a Config.Processor implementing
+	// core.EscrowProcessor, such as that of the openlibx402-escrow module.
+	Escrow bool
+
+	// ChannelDeposit optionally offers a payment channel: a payment of at
+	// least this amount instead of the price opens a channel whose balance
+	// pays later requests to PaymentAddress with vouchers signed by the
+	// payer, without on-chain transactions. The deposit must be verified
+	// on-chain before the request proceeds, and the unspent balance is
+	// refunded when the channel closes. Requires Config.AutoVerify without
+	// AsyncSettlement, and Config.RefundProcessor.
+	ChannelDeposit string
+
+	// MaxOutstanding optionally lets payers run a tab, settling requests in
+	// batches: requests carrying a voucher signed by the payer are served
+	// without an on-chain payment and charged to the payer's tab, as long as
+	// its outstanding balance stays within MaxOutstanding. Beyond it, or when
+	// the payer asks to settle, the 402 payment request includes the
+	// outstanding balance, and paying it settles the tab. Settlements must be
+	// verified on-chain: requires Config.AutoVerify without AsyncSettlement.
+	MaxOutstanding string
+
+	// LightningSats optionally prices the resource in satoshis for payments
+	// with a Lightning invoice, offered next to the token price when
+	// Config.Lightning is set. A Lightning payment pays for the request (and
+	// a session, with Config.SessionTTL) only: it does not buy plans,
+	// included requests, channels, or tab settlements.
+	LightningSats int64
+
+	// FiatAmount optionally prices the resource in fiat, e.g. "0.10" USD,
+	// converted to a token amount when the request is priced with
+	// Config.PriceOracle. It replaces Amount. Currency overrides
+	// Config.Currency.
+	FiatAmount string
+	Currency   string
+
+	// VolumePricing optionally prices the resource by the payer's volume of
+	// verified payments, replacing Amount once a tier applies. The 402
+	// response reflects the payer's tier if the request declares the payer
+	// in the payer header. Payments are counted in Config.Store.
+	VolumePricing *VolumePricing
+
+	// Capture optionally makes Amount a hold for variable-cost requests,
+	// such as LLM completions: the payment pre-authorizes up to Amount, and
+	// once the cost of the request is known the handler captures it with
+	// Server.Capture, which refunds the rest to the payer. Requires
+	// Config.AutoVerify without AsyncSettlement, and Config.RefundProcessor.
+	Capture bool
+
+	// RangePricing optionally prices a file by the bytes the request's
+	// Range header asks for, replacing Amount. Session tokens are not
+	// issued for these payments, as they would grant the whole file, and
+	// with Config.NonceStore a payment is accepted for the range its payment
+	// request was issued for only.
+	RangePricing *RangePricing
+
+	// UnitPricing optionally prices the request by the units it consumes,
+	// such as output tokens, replacing Amount with a hold for its MaxUnits
+	// and implying Capture. The handler reports the units it used with
+	// Result.AddUnits, and the adapter captures their price once it
+	// returns (see Server.CaptureUnits).
+	UnitPricing *UnitPricing
+
+	// Authorize optionally applies a per-payer policy. It is called with the payer's
+	// public key (from the authorization header, or the payer header on the
+	// initial request) and may grant free access, apply a discount, or return an
+	// error to block the payer. Public keys are self-declared by the client, so free
+	// access should only be granted to payers authenticated by other means.
+	Authorize func(pubkey string) (PriceOverride, error)
+}
+
+// PriceOverride adjusts the price of a resource for a specific payer.
+type PriceOverride struct {
+	Free   bool   // Grant access without payment
+	Amount string // Discounted amount (empty keeps the resource price)
+}
+
+// Request is the framework-agnostic view of an incoming request.
+type Request struct {
+	Context  context.Context
+	Resource string                   // Resource being accessed (path, procedure, or field)
+	Header   func(name string) string // Returns the value of a request header
+	ClientIP string                   // IP address of the client, if known (see Config.RiskAssessor)
+
+	// Deferrable reports that the adapter returns Result.Deferred to the
+	// client, so that trusted payers may pay after the response (see
+	// Config.DeferredPayers).
+	Deferrable bool
+}
+
+// Requirement contains the resolved payment requirements for a request.
+type Requirement struct {
+	Amount         string
+	PaymentAddress string
+	TokenMint      string
+	Network        string
+	Description    string
+	Resource       string
+	ExpiresIn      int
+	Plans          []core.SubscriptionPlan
+	Plan           string // Subscription plan the request buys, if any
+	// RequestsIncluded is how many further requests the payment grants
+	RequestsIncluded int
+	PriceTiers       []core.PriceTier // Volume pricing schedule, if any
+	Quote            *core.PriceQuote // Conversion of a fiat price, if any
+	Range            *core.RangePrice // Byte range pricing, if any
+	AcceptedTokens   []core.TokenPrice
+	Splits           []core.PaymentSplit // Shares paid to other recipients, if any
+	EscrowProgram    string              // Program payments are deposited into, if any
+	ChannelDeposit   string              // Deposit that opens a payment channel, if any
+	MaxOutstanding   string              // Cap on the outstanding balance of tabs, if any
+	TabOutstanding   string              // Outstanding balance the payment settles, if any
+	TabCharged       string              // Amount charged to the payer's tab, if known
+	LightningSats    int64               // Price of a Lightning payment, if offered
+	Capture          bool                // Amount is a hold captured after the request
+	Units            *core.UnitPrice     // Unit pricing of the hold, if any
+	Commitment       core.Commitment     // Commitment the payment must reach, if stepped up by Config.RiskAssessor
+}
+
+// Result is the outcome of running the pipeline for a request.
+type Result struct {
+	// Status is the HTTP status to respond with, or 0 if the request may proceed.
+	Status int
+	// Code is the X402 error code when the request is not allowed.
+	Code string
+	// Message describes why the request was not allowed.
+	Message string
+	// Details holds additional fields describing a rejection.
+	Details map[string]interface{}
+	// PaymentRequest is set when payment is required (Status 402).
+	PaymentRequest *core.PaymentRequest
+	// Authorization is the verified payment authorization when the request
+	// proceeds with payment (nil for free access).
+	Authorization *core.PaymentAuthorization
+	// Payer is the public key of the wallet the request proceeds for, when
+	// it was verified: by the payment, a session, subscription, or quota
+	// token issued for one, or a signed voucher. It is empty for free access,
+	// deferred payers, and Lightning payments.
+	Payer string
+	// Requirement holds the resolved requirements the request was checked against.
+	Requirement *Requirement
+	// SessionToken is set when a verified payment opened a session (see
+	// Config.SessionTTL). Adapters return it in the session header.
+	SessionToken string
+	// SubscriptionToken and Subscription are set when a verified payment
+	// bought a subscription plan (see Options.Plans). Adapters return the
+	// token in the subscription header. Subscription is also set when the
+	// request proceeds on an active subscription.
+	SubscriptionToken string
+	Subscription      *Subscription
+	// QuotaToken is set when a verified payment included further requests
+	// (see Options.RequestsIncluded) or the request used one of them, and
+	// QuotaRemaining is how many are left. Adapters return them in the quota
+	// headers.
+	QuotaToken     string
+	QuotaRemaining int
+	// ChannelID is set when a deposit opened a payment channel (see
+	// Options.ChannelDeposit) or a voucher paid from one, and ChannelBalance
+	// is what is left of its deposit. Adapters return them in the channel
+	// headers.
+	ChannelID      string
+	ChannelBalance string
+	// TabOutstanding is set when the request was charged to the payer's tab
+	// (see Options.MaxOutstanding) or a payment settled it, and is the
+	// balance left unsettled. Adapters return it in the tab header.
+	TabOutstanding string
+	// RetryAfter is set when the request was rejected for exceeding
+	// Config.PayerRateLimit, and is how long until the payer may retry.
+	// Adapters return it in the Retry-After header.
+	RetryAfter time.Duration
+	// Pending is set when on-chain verification was queued for asynchronous
+	// settlement and has not completed yet.
+	Pending bool
+	// Deferred is set when the request proceeds before payment (see
+	// Config.DeferredPayers). Adapters return it in the deferred header.
+	Deferred *core.PaymentRequest
+	// Captured is the amount captured of a held payment, once the handler
+	// captured it (see Server.Capture).
+	Captured string
+	// units counts the units reported by the handler (see AddUnits).
+	units atomic.Int64
+	// VerifiedAmount is the amount the payment transaction transferred to the
+	// payment address, set when it was verified on-chain before the request
+	// proceeds. Authorization.ActualAmount then holds it too, replacing the
+	// amount claimed by the client.
+	VerifiedAmount string
+}
+
+// Allowed reports whether the request may proceed to the handler.
+func (r *Result) Allowed() bool {
+	return r.Status == 0
+}
+
+// Body returns the response body to send when the request is not allowed.
+//
+// For 402 responses this is the PaymentRequest; otherwise a JSON object with
+// "error" and "code" members and the rejection details.
+// Adapters should send Server.Response instead, which honors
+// Config.ProblemDetails and the request's Accept header.
+func (r *Result) Body() interface{} {
+	if r.PaymentRequest != nil {
+		return r.PaymentRequest
+	}
+	body := map[string]interface{}{"error": r.Message, "code": r.Code}
+	for k, v := range r.Details {
+		body[k] = v
+	}
+	return body
+}
+
+// Err returns the rejection as an error, or nil if the request is allowed.
+//
+// It is intended for adapters whose protocols have no JSON error body, such as RPC
+// frameworks. Payment-required results return a *core.PaymentRequiredError.
+func (r *Result) Err() error {
+	if r.Allowed() {
+		return nil
+	}
+	if r.PaymentRequest != nil {
+		return core.NewPaymentRequiredError(r.PaymentRequest, r.Message)
+	}
+	if len(r.Details) == 0 {
+		return errors.New(r.Message)
+	}
+
+	keys := make([]string, 0, len(r.Details))
+	for k := range r.Details {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, fmt.Sprintf("%s=%v", k, r.Details[k]))
+	}
+	return fmt.Errorf("%s (%s)", r.Message, strings.Join(parts, ", "))
+}
+
+// Server runs the X402 pipeline for a configuration.
+//
+// The Solana RPC connection is created once and reused by all requests.
+type Server struct {
+	current    atomic.Pointer[Config] // Replaced by Reload
+	invalid    atomic.Pointer[error]  // Config.Validate error of the configuration passed to New, cleared by Reload
+	processor  core.PaymentProcessor
+	logger     *slog.Logger
+	settlement *settlement
+	closeOnce  sync.Once
+
+	pendingMu     sync.Mutex
+	pending       map[string]*time.Timer // Expiry timers of issued requests
+	pendingClosed bool                   // Set by Close
+
+	sessionOnce   sync.Once
+	sessionSecret []byte
+
+	deferral *deferral
+	used     *MemoryNonceStore // Consumed payments without Config.NonceStore
+	rates    rateCache
+	sweeper  *sweeper
+	settler  channelSettler
+
+	checkedTokens sync.Map // Network and mint of tokens checked by checkTokens
+	network       networkCheck
+	reload        reload
+	shutdown      atomic.Bool // Set by Shutdown
+}
+
+// New creates a Server, applying configuration defaults. If the
+// configuration fails Config.Validate, the error is logged and requests are
+// rejected with 500 CONFIGURATION_ERROR until Reload fixes it.
+func New(config *Config) *Server {
+	if config.Network == "" {
+		config.Network = "solana-devnet"
+	}
+	if config.RPCURL == "" {
+		config.RPCURL = core.GetDefaultRPCURL(config.Network)
+	}
+	if config.AuthorizationHeader == "" {
+		config.AuthorizationHeader = core.DefaultAuthorizationHeader
+	}
+	if config.PayerHeader == "" {
+		config.PayerHeader = core.DefaultPayerHeader
+	}
+	if config.SessionHeader == "" {
+		config.SessionHeader = core.DefaultSessionHeader
+	}
+	if config.PlanHeader == "" {
+		config.PlanHeader = core.DefaultPlanHeader
+	}
+	if config.SubscriptionHeader == "" {
+		config.SubscriptionHeader = core.DefaultSubscriptionHeader
+	}
+	if config.QuotaStore == nil {
+		config.QuotaStore = NewMemoryQuotaStore(0)
+	}
+	if config.RateLimitStore == nil {
+		config.RateLimitStore = NewMemoryRateLimitStore(0)
+	}
+	if config.QuotaTTL == 0 {
+		config.QuotaTTL = 24 * time.Hour
+	}
+	if config.QuotaHeader == "" {
+		config.QuotaHeader = core.DefaultQuotaHeader
+	}
+	if config.QuotaRemainingHeader == "" {
+		config.QuotaRemainingHeader = core.DefaultQuotaRemainingHeader
+	}
+	if config.ChannelStore == nil {
+		config.ChannelStore = NewMemoryChannelStore()
+	}
+	if config.ChannelTTL == 0 {
+		config.ChannelTTL = time.Hour
+	}
+	if config.VoucherHeader == "" {
+		config.VoucherHeader = core.DefaultVoucherHeader
+	}
+	if config.ChannelHeader == "" {
+		config.ChannelHeader = core.DefaultChannelHeader
+	}
+	if config.ChannelBalanceHeader == "" {
+		config.ChannelBalanceHeader = core.DefaultChannelBalanceHeader
+	}
+	if config.TabStore == nil {
+		config.TabStore = NewMemoryTabStore()
+	}
+	if config.TabHeader == "" {
+		config.TabHeader = core.DefaultTabHeader
+	}
+	if config.ReferenceHeader == "" {
+		config.ReferenceHeader = core.DefaultReferenceHeader
+	}
+	if config.LightningHeader == "" {
+		config.LightningHeader = core.DefaultLightningHeader
+	}
+	if config.VerificationCacheTTL == 0 {
+		config.VerificationCacheTTL = 10 * time.Minute
+	}
+	if config.SettlementTimeout == 0 {
+		config.SettlementTimeout = 30 * time.Second
+	}
+	if config.MaxClockSkew == 0 {
+		config.MaxClockSkew = 30 * time.Second
+	}
+	if config.NonceTTL == 0 {
+		config.NonceTTL = 24 * time.Hour
+	}
+	if config.Currency == "" {
+		config.Currency = "USD"
+	}
+	if config.QuoteTTL == 0 {
+		config.QuoteTTL = time.Minute
+	}
+	if config.QuoteDecimals == 0 {
+		config.QuoteDecimals = 6
+	}
+	if config.DeferredWindow == 0 {
+		config.DeferredWindow = time.Minute
+	}
+	if config.MaxDeferredDebts == 0 {
+		config.MaxDeferredDebts = 1
+	}
+	if config.EscrowWindow == 0 {
+		config.EscrowWindow = 10 * time.Minute
+	}
+	if config.DeferredHeader == "" {
+		config.DeferredHeader = core.DefaultDeferredHeader
+	}
+
+	processor := config.Processor
+	if processor == nil {
+		processor = core.NewSolanaPaymentProcessorWithOptions(config.RPCURL, nil, core.ProcessorOptions{
+			HTTPClient: config.HTTPClient,
+			Logger:     config.Logger,
+			Retry:      config.RPCRetry,
+			Commitment: config.Commitment,
+			WSURL:      config.RPCWebSocketURL,
+
+			RPCURLs:             config.RPCURLs,
+			HealthCheckInterval: config.RPCHealthCheckInterval,
+			RateLimit:           config.RPCRateLimit,
+		})
+	}
+	s := &Server{
+		processor: processor,
+		logger:    core.LoggerOrDiscard(config.Logger),
+		used:      NewMemoryNonceStore(0),
+	}
+	s.current.Store(config)
+	if err := config.Validate(); err != nil {
+		s.logger.Error("x402: invalid configuration, rejecting requests", "error", err)
+		s.invalid.Store(&err)
+	}
+	if len(config.DeferredPayers) > 0 {
+		s.deferral = newDeferral(config.DeferredPayers)
+	}
+	if config.AsyncSettlement && config.AutoVerify {
+		s.startSettlement()
+	}
+	if config.SweepTreasury != "" && config.SweepSigner != nil {
+		s.startSweeper()
+	}
+	return s
+}
+
+// Close waits for pending settlements, sweeps, and channel refunds and releases the server's RPC connections.
+func (s *Server) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		s.stopSettlement()
+		s.pendingMu.Lock()
+		for _, timer := range s.pending {
+			timer.Stop()
+		}
+		s.pending = nil
+		s.pendingClosed = true
+		s.pendingMu.Unlock()
+		s.stopDeferral()
+		s.stopSweeper()
+		s.stopChannelSettler()
+		err = s.processor.Close()
+	})
+	return err
+}
+
+// Shutdown gracefully stops the server, as Close does, and then delivers
+// the webhooks queued in Config.Webhooks and saves the stores of the
+// configuration implementing Persister, so that no payment records are lost.
+// Requests that arrive after it starts are answered with 503; call it after
+// the HTTP server stopped accepting them, e.g. after http.Server.Shutdown.
+// If ctx is done first, Shutdown returns its error while stopping continues
+// in the background.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.shutdown.Store(true)
+	done := make(chan error, 1)
+	go func() {
+		errs := []error{s.Close()}
+		config := s.config()
+		if config.Webhooks != nil {
+			errs = append(errs, config.Webhooks.Close())
+		}
+		if config.AuditLog != nil {
+			errs = append(errs, config.AuditLog.Close())
+		}
+		for _, store := range []interface{}{config.NonceStore, config.QuotaStore, config.ChannelStore, config.TabStore, config.Store, config.VerificationCache} {
+			if persister, ok := store.(Persister); ok {
+				if err := persister.Persist(ctx); err != nil {
+					errs = append(errs, fmt.Errorf("failed to persist %T: %w", store, err))
+				}
+			}
+		}
+		done <- errors.Join(errs...)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Config returns the server configuration.
+func (s *Server) Config() *Config {
+	return s.config()
+}
+
+// config returns the current configuration.
+func (s *Server) config() *Config {
+	return s.current.Load()
+}
+
+// Process runs the full pipeline for a request: it resolves the requirements,
+// parses the authorization header, applies the payer policy, and either builds
+// a payment request or verifies the provided payment.
+func (s *Server) Process(req Request, opts Options) (result *Result) {
+	defer func() {
+		if v := recover(); v != nil {
+			result = s.recovered(v, req.Resource)
+		}
+		s.audit(req, result)
+	}()
+	return s.process(req, opts)
+}
+
+// process runs the pipeline for Process.
+func (s *Server) process(req Request, opts Options) *Result {
+	if s.shutdown.Load() {
+		return reject(http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "Server is shutting down", nil)
+	}
+	requirement, result := s.resolve(req, opts)
+	if result != nil {
+		return result
+	}
+
+	// A session token from an earlier payment grants access without paying again
+	if result := s.sessionResult(req, requirement); result != nil {
+		return result
+	}
+	// So does an active subscription to one of the resource's plans
+	if result := s.subscriptionResult(req, requirement); result != nil {
+		return result
+	}
+	// And an included request left on an earlier payment
+	if result := s.quotaResult(req, requirement); result != nil {
+		return result
+	}
+	// Or a voucher paying from a payment channel, or charging the payer's tab
+	if result := s.channelResult(req, requirement); result != nil {
+		return result
+	}
+	if result := s.tabResult(req, requirement); result != nil {
+		return result
+	}
+	// Or a paid Lightning invoice
+	if result := s.lightningResult(req, requirement); result != nil {
+		return result
+	}
+
+	// Check for payment authorization header
+	authHeader := req.Header(s.config().AuthorizationHeader)
+	if authHeader == "" && s.config().WalletPaywall {
+		authHeader = paywallAuthorization(req.Header("Cookie"))
+	}
+
+	var authorization *core.PaymentAuthorization
+	if authHeader != "" {
+		var err error
+		authorization, err = core.PaymentAuthorizationFromHeader(authHeader)
+		if err != nil {
+			return reject(http.StatusBadRequest, "INVALID_PAYMENT_REQUEST", "Invalid payment authorization", map[string]interface{}{
+				"message": err.Error(),
+			})
+		}
+		// Reject spoofed headers before the payer is trusted or RPC calls are made
+		if result := s.checkAttestation(authorization); result != nil {
+			s.logger.Warn("x402: invalid payment attestation", "authorization", authorization, core.LogKeyResource, req.Resource)
+			return result
+		}
+	} else {
+		// A payment request paid from a wallet with Solana Pay
+		authorization, result = s.solanaPayAuthorization(req, requirement)
+		if result != nil {
+			return result
+		}
+	}
+
+	// Apply the payer lists and rate limit before RPC calls are made
+	if authorization != nil {
+		if result := s.checkPayer(req.Context, authorization.PublicKey); result != nil {
+			return result
+		}
+	}
+
+	// Reject payers flagged by a failed asynchronous settlement
+	if authorization != nil && s.IsFlagged(authorization.PublicKey) {
+		s.logger.Warn("x402: rejected flagged payer", core.LogKeyPayer, authorization.PublicKey, core.LogKeyResource, req.Resource)
+		return reject(http.StatusForbidden, "PAYER_FLAGGED", "Payer flagged for failed settlement", nil)
+	}
+
+	// An authorization for a deferred payment settles the debt
+	if authorization != nil {
+		if result := s.settleDebt(req.Context, authorization); result != nil {
+			return result
+		}
+	}
+
+	// Convert a fiat price at the current rate, or the quoted one
+	if opts.FiatAmount != "" {
+		if result := s.applyQuote(req.Context, requirement, opts, authorization); result != nil {
+			return result
+		}
+	}
+
+	// Price by the bytes requested
+	if opts.RangePricing != nil {
+		if result := s.applyRangePricing(req, requirement, opts.RangePricing); result != nil {
+			return result
+		}
+	}
+
+	payer := req.Header(s.config().PayerHeader)
+	if authorization != nil {
+		payer = authorization.PublicKey
+	}
+
+	// Price by the payer's volume of earlier payments
+	if opts.VolumePricing != nil {
+		if amount := s.volumePrice(req.Context, opts.VolumePricing, payer, requirement.Resource); amount != "" {
+			requirement.Amount = amount
+		}
+		requirement.PriceTiers = opts.VolumePricing.Tiers
+	}
+
+	// Apply per-payer policy (allowlist, discounts, blocks)
+	if opts.Authorize != nil {
+		if payer != "" {
+			override, err := opts.Authorize(payer)
+			if err != nil {
+				s.logger.Info("x402: payer not authorized", core.LogKeyPayer, payer, core.LogKeyResource, req.Resource, "error", err)
+				return reject(http.StatusForbidden, "PAYER_NOT_AUTHORIZED", "Payer not authorized", map[string]interface{}{
+					"message": err.Error(),
+				})
+			}
+			if override.Free {
+				s.logger.Debug("x402: free access granted", core.LogKeyPayer, payer, core.LogKeyResource, req.Resource)
+				return &Result{Requirement: requirement}
+			}
+			if override.Amount != "" {
+				requirement.Amount = override.Amount
+			}
+		}
+	}
+
+	buysPlan := s.applyPlan(req, requirement)
+	if authorization == nil {
+		// Serve trusted payers first and let them pay afterwards
+		if !buysPlan {
+			if result := s.deferPayment(req, requirement); result != nil {
+				return result
+			}
+		}
+
+		// No payment provided, return 402
+		return s.paymentRequired(req.Context, requirement)
+	}
+
+	// Payment authorization provided, verify it in the token it was made with
+	unpaid := *requirement
+	s.acceptPreviousPayee(requirement, opts, authorization)
+	if !buysPlan {
+		selectToken(requirement, authorization.AssetAddress)
+	}
+	if result := s.assessRisk(req, requirement, authorization); result != nil {
+		result.Requirement = requirement
+		s.report(requirement, authorization, result)
+		return result
+	}
+	result = s.verifyAndReport(req.Context, requirement, authorization)
+	if result.Code == "PAYMENT_ALREADY_USED" && req.Header(s.config().AuthorizationHeader) == "" && req.Header(s.config().ReferenceHeader) == "" {
+		// A browser sends the paywall cookie of a paid request until it pays again
+		return s.paymentRequired(req.Context, &unpaid)
+	}
+	result.Requirement = requirement
+	if result.Allowed() && s.config().SessionTTL > 0 && requirement.Range == nil && !requirement.Capture {
+		result.SessionToken = s.issueSession(requirement.Resource, authorization.PublicKey)
+	}
+	if result.Allowed() && buysPlan {
+		// The payment was valid, so the request proceeds without a token
+		subscription, token, err := s.subscribe(req.Context, requirement, result.Authorization)
+		if err != nil {
+			s.logger.Error("x402: failed to record subscription", "authorization", result.Authorization, "plan", requirement.Plan, "error", err)
+		} else {
+			result.Subscription, result.SubscriptionToken = subscription, token
+		}
+	}
+	if result.Allowed() && requirement.RequestsIncluded > 0 {
+		// The paid request is served either way
+		token, err := s.grantQuota(req.Context, requirement, result.Authorization)
+		if err != nil {
+			s.logger.Error("x402: failed to grant included requests", "authorization", result.Authorization, "error", err)
+		} else {
+			result.QuotaToken, result.QuotaRemaining = token, requirement.RequestsIncluded
+		}
+	}
+	if result.Allowed() && requirement.ChannelDeposit != "" && result.VerifiedAmount != "" && core.CompareAmounts(result.VerifiedAmount, requirement.ChannelDeposit) >= 0 {
+		// A payment of the deposit opens a channel; the paid request is served either way
+		channel, err := s.openChannel(req.Context, requirement, result)
+		if err != nil {
+			s.logger.Error("x402: failed to open payment channel", "authorization", result.Authorization, "error", err)
+		} else {
+			result.ChannelID = channel.ID
+			result.ChannelBalance = formatAmount(new(big.Rat).Sub(parseAmount(channel.Deposit), parseAmount(channel.Spent)))
+		}
+	}
+	if result.Allowed() && requirement.MaxOutstanding != "" && result.VerifiedAmount != "" {
+		// A payment beyond the price settles the payer's tab
+		outstanding, err := s.creditTab(req.Context, requirement, result.Authorization)
+		if err != nil {
+			s.logger.Error("x402: failed to settle tab", "authorization", result.Authorization, "error", err)
+		} else {
+			result.TabOutstanding = outstanding
+		}
+	}
+	return result
+}
+
+// paymentRequired issues a payment request for the requirement and returns
+// the 402 result carrying it.
+func (s *Server) paymentRequired(ctx context.Context, requirement *Requirement) *Result {
+	paymentReq, err := s.IssuePaymentRequest(ctx, requirement)
+	if err != nil {
+		return reject(http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "Payment requests are temporarily unavailable", nil)
+	}
+	return &Result{
+		Status:         http.StatusPaymentRequired,
+		Code:           "PAYMENT_REQUIRED",
+		Message:        "Payment is required to access this resource",
+		PaymentRequest: paymentReq,
+		Requirement:    requirement,
+	}
+}
+
+// resolve merges the options with the server configuration.
+func (s *Server) resolve(req Request, opts Options) (*Requirement, *Result) {
+	if s.invalid.Load() != nil {
+		return nil, reject(http.StatusInternalServerError, "CONFIGURATION_ERROR", "Server configuration is invalid", nil)
+	}
+	requirement := &Requirement{
+		Amount:         opts.Amount,
+		PaymentAddress: opts.PaymentAddress,
+		TokenMint:      opts.TokenMint,
+		Network:        opts.Network,
+		Description:    opts.Description,
+		Resource:       req.Resource,
+		ExpiresIn:      opts.ExpiresIn,
+
+		RequestsIncluded: opts.RequestsIncluded,
+		AcceptedTokens:   opts.AcceptedTokens,
+		Splits:           opts.Splits,
+		ChannelDeposit:   opts.ChannelDeposit,
+		MaxOutstanding:   opts.MaxOutstanding,
+		LightningSats:    opts.LightningSats,
+		Capture:          opts.Capture,
+	}
+	if opts.UnitPricing != nil {
+		if err := opts.UnitPricing.apply(requirement); err != nil {
+			return nil, reject(http.StatusInternalServerError, "CONFIGURATION_ERROR", err.Error(), nil)
+		}
+		if opts.FiatAmount != "" || opts.RangePricing != nil || opts.VolumePricing != nil {
+			return nil, reject(http.StatusInternalServerError, "CONFIGURATION_ERROR", "UnitPricing cannot be combined with FiatAmount, RangePricing, or VolumePricing", nil)
+		}
+	}
+	if s.subscriptionStore() != nil {
+		// Plans cannot be bought without a store to record them in
+		requirement.Plans = opts.Plans
+	}
+
+	// Determine parameters (use provided values or config)
+	if requirement.PaymentAddress == "" {
+		requirement.PaymentAddress = s.config().PaymentAddress
+	}
+	if requirement.TokenMint == "" {
+		requirement.TokenMint = s.config().TokenMint
+	}
+	if requirement.Network == "" {
+		requirement.Network = s.config().Network
+	}
+	if requirement.ExpiresIn == 0 {
+		requirement.ExpiresIn = 300
+	}
+
+	if requirement.PaymentAddress == "" || requirement.TokenMint == "" {
+		return nil, reject(http.StatusInternalServerError, "CONFIGURATION_ERROR", "paymentAddress and tokenMint must be configured", nil)
+	}
+	if err := core.ValidateSplits(requirement.PaymentAddress, requirement.Splits); err != nil {
+		return nil, reject(http.StatusInternalServerError, "CONFIGURATION_ERROR", err.Error(), nil)
+	}
+	if opts.Escrow {
+		processor, ok := s.processor.(core.EscrowProcessor)
+		switch {
+		case !ok:
+			return nil, reject(http.StatusInternalServerError, "CONFIGURATION_ERROR", "Escrow requires a processor implementing core.EscrowProcessor", nil)
+		case len(requirement.Splits) > 0:
+			return nil, reject(http.StatusInternalServerError, "CONFIGURATION_ERROR", "escrow payments cannot be split", nil)
+		}
+		requirement.EscrowProgram = processor.EscrowProgram()
+	}
+	if requirement.ChannelDeposit != "" {
+		switch {
+		case !s.config().AutoVerify || s.config().AsyncSettlement:
+			return nil, reject(http.StatusInternalServerError, "CONFIGURATION_ERROR", "ChannelDeposit requires AutoVerify without AsyncSettlement", nil)
+		case s.config().RefundProcessor == nil:
+			return nil, reject(http.StatusInternalServerError, "CONFIGURATION_ERROR", "ChannelDeposit requires a RefundProcessor", nil)
+		case len(requirement.Splits) > 0 || opts.Escrow:
+			return nil, reject(http.StatusInternalServerError, "CONFIGURATION_ERROR", "channel deposits cannot be split or escrowed", nil)
+		}
+	}
+	if requirement.MaxOutstanding != "" {
+		switch {
+		case !s.config().AutoVerify || s.config().AsyncSettlement:
+			return nil, reject(http.StatusInternalServerError, "CONFIGURATION_ERROR", "MaxOutstanding requires AutoVerify without AsyncSettlement", nil)
+		case len(requirement.Splits) > 0 || opts.Escrow:
+			return nil, reject(http.StatusInternalServerError, "CONFIGURATION_ERROR", "tab settlements cannot be split or escrowed", nil)
+		case requirement.ChannelDeposit != "":
+			return nil, reject(http.StatusInternalServerError, "CONFIGURATION_ERROR", "MaxOutstanding and ChannelDeposit cannot be combined", nil)
+		}
+	}
+	if requirement.Capture {
+		switch {
+		case !s.config().AutoVerify || s.config().AsyncSettlement:
+			return nil, reject(http.StatusInternalServerError, "CONFIGURATION_ERROR", "Capture requires AutoVerify without AsyncSettlement", nil)
+		case s.config().RefundProcessor == nil:
+			return nil, reject(http.StatusInternalServerError, "CONFIGURATION_ERROR", "Capture requires a RefundProcessor", nil)
+		case len(requirement.Splits) > 0 || opts.Escrow:
+			return nil, reject(http.StatusInternalServerError, "CONFIGURATION_ERROR", "held payments cannot be split or escrowed", nil)
+		case requirement.ChannelDeposit != "" || requirement.MaxOutstanding != "":
+			return nil, reject(http.StatusInternalServerError, "CONFIGURATION_ERROR", "Capture cannot be combined with ChannelDeposit or MaxOutstanding", nil)
+		}
+	}
+	if s.config().SolanaPay {
+		_, ok := s.processor.(core.ReferenceFinder)
+		switch {
+		case !s.config().AutoVerify:
+			return nil, reject(http.StatusInternalServerError, "CONFIGURATION_ERROR", "SolanaPay requires AutoVerify", nil)
+		case s.config().NonceStore == nil:
+			return nil, reject(http.StatusInternalServerError, "CONFIGURATION_ERROR", "SolanaPay requires a NonceStore", nil)
+		case !ok:
+			return nil, reject(http.StatusInternalServerError, "CONFIGURATION_ERROR", "SolanaPay requires a processor implementing core.ReferenceFinder", nil)
+		}
+	}
+	if result := s.checkTokens(req.Context, requirement); result != nil {
+		return nil, result
+	}
+	if s.config().AutoVerify {
+		if result := s.checkNetwork(req.Context, requirement); result != nil {
+			return nil, result
+		}
+	}
+	if requirement.LightningSats > 0 {
+		switch {
+		case s.config().Lightning == nil:
+			return nil, reject(http.StatusInternalServerError, "CONFIGURATION_ERROR", "LightningSats requires a Lightning backend", nil)
+		case s.config().NonceStore == nil:
+			return nil, reject(http.StatusInternalServerError, "CONFIGURATION_ERROR", "LightningSats requires a NonceStore", nil)
+		}
+	}
+	return requirement, nil
+}
+
+// NewPaymentRequest builds a new payment request for a requirement.
+func (s *Server) NewPaymentRequest(requirement *Requirement) *core.PaymentRequest {
+	expiresAt := time.Now().UTC().Add(time.Duration(requirement.ExpiresIn) * time.Second)
+	var escrow *core.EscrowTerms
+	if requirement.EscrowProgram != "" {
+		escrow = &core.EscrowTerms{Program: requirement.EscrowProgram, ReleaseDeadline: expiresAt.Add(s.config().EscrowWindow)}
+	}
+	var channel *core.ChannelTerms
+	if requirement.ChannelDeposit != "" {
+		channel = &core.ChannelTerms{Deposit: requirement.ChannelDeposit, ExpiresIn: int(s.config().ChannelTTL.Seconds())}
+	}
+	var tab *core.TabTerms
+	if requirement.MaxOutstanding != "" {
+		tab = &core.TabTerms{MaxOutstanding: requirement.MaxOutstanding, Outstanding: requirement.TabOutstanding, Charged: requirement.TabCharged}
+	}
+	paymentReq := &core.PaymentRequest{
+		MaxAmountRequired: requirement.Amount,
+		AssetType:         "SPL",
+		AssetAddress:      requirement.TokenMint,
+		PaymentAddress:    requirement.PaymentAddress,
+		Network:           requirement.Network,
+		ExpiresAt:         expiresAt,
+		Nonce:             generateID(),
+		PaymentID:         generateID(),
+		Resource:          requirement.Resource,
+		Description:       requirement.Description,
+		Plans:             requirement.Plans,
+		Plan:              requirement.Plan,
+		RequestsIncluded:  requirement.RequestsIncluded,
+		PriceTiers:        requirement.PriceTiers,
+		Quote:             requirement.Quote,
+		Range:             requirement.Range,
+		Capture:           requirement.Capture,
+		Units:             requirement.Units,
+		Accepts:           requirement.AcceptedTokens,
+		Splits:            requirement.Splits,
+		Escrow:            escrow,
+		Channel:           channel,
+		Tab:               tab,
+	}
+	paymentReq.SolanaPayURL = s.solanaPayURL(paymentReq)
+	return paymentReq
+}
+
+// IssuePaymentRequest builds a payment request for a requirement and records
+// it: in the NonceStore, so that it can be paid, and in the PaymentStore and
+// webhooks. With Config.Lightning, it also creates the Lightning invoice. It
+// fails only if the NonceStore cannot record it.
+func (s *Server) IssuePaymentRequest(ctx context.Context, requirement *Requirement) (*core.PaymentRequest, error) {
+	paymentReq := s.NewPaymentRequest(requirement)
+	s.addInvoice(ctx, requirement, paymentReq)
+	if s.config().NonceStore != nil {
+		// Payments for a request that was not recorded would be rejected
+		if err := s.config().NonceStore.Issue(ctx, paymentReq, s.config().NonceTTL); err != nil {
+			s.logger.Error("x402: failed to record issued payment request", "request", paymentReq, "error", err)
+			return nil, err
+		}
+	}
+	s.emit(Event{Type: EventPaymentRequiredIssued, Resource: requirement.Resource, PaymentRequest: paymentReq})
+	s.trackExpiry(paymentReq)
+	s.logger.Debug("x402: payment required", "request", paymentReq)
+	if s.config().Store != nil {
+		if err := s.config().Store.RecordRequest(ctx, paymentReq); err != nil {
+			s.logger.Error("x402: failed to record payment request", "request", paymentReq, "error", err)
+		}
+	}
+	return paymentReq, nil
+}
+
+// Verify checks a payment authorization against a requirement.
+//
+// The returned Result is allowed if the payment is valid.
+func (s *Server) Verify(ctx context.Context, requirement *Requirement, authorization *core.PaymentAuthorization) (result *Result) {
+	defer func() {
+		if v := recover(); v != nil {
+			result = s.recovered(v, requirement.Resource)
+		}
+	}()
+	if result := s.checkAttestation(authorization); result != nil {
+		s.report(requirement, authorization, result)
+		return result
+	}
+	return s.verifyAndReport(ctx, requirement, authorization)
+}
+
+// verifyAndReport verifies an authorization whose attestation was checked and
+// reports the result.
+func (s *Server) verifyAndReport(ctx context.Context, requirement *Requirement, authorization *core.PaymentAuthorization) *Result {
+	result, queued := s.verify(ctx, requirement, authorization)
+	if !queued {
+		if result.Authorization != nil {
+			authorization = result.Authorization
+		}
+		s.report(requirement, authorization, result)
+	}
+	return result
+}
+
+// verify runs the Verifier stages. It reports queued if on-chain
+// verification was handed to the settlement workers.
+func (s *Server) verify(ctx context.Context, requirement *Requirement, authorization *core.PaymentAuthorization) (*Result, bool) {
+	v := &Verification{Requirement: requirement, Authorization: authorization, server: s}
+	for _, verifier := range s.verifiers() {
+		if result := verifier.Verify(ctx, v); result != nil {
+			return result, false
+		}
+	}
+	// Served payments are consumed, including those settled in the background
+	if result := s.consume(ctx, v.Authorization); result != nil {
+		return result, false
+	}
+	if v.settle {
+		if s.enqueueSettlement(requirement, v.Authorization) {
+			return &Result{Authorization: v.Authorization, Payer: v.Authorization.PublicKey, Pending: true}, true
+		}
+		if result := s.verifyChain(ctx, v); result != nil {
+			return result, false
+		}
+	}
+	if v.Verified {
+		return &Result{Authorization: v.Authorization, Payer: v.Authorization.PublicKey, VerifiedAmount: v.Authorization.ActualAmount}, false
+	}
+	return &Result{Authorization: v.Authorization, Payer: v.Authorization.PublicKey}, false
+}
+
+// consume marks the payment ID and transaction of an authorization as used,
+// in Config.NonceStore or else in memory, so that they pay for one request.
+// It returns a rejection if either was used before, or nil.
+func (s *Server) consume(ctx context.Context, authorization *core.PaymentAuthorization) *Result {
+	var store NonceStore = s.used
+	if s.config().NonceStore != nil {
+		store = s.config().NonceStore
+	}
+	unused, err := store.Consume(ctx, authorization.PaymentID, authorization.TransactionHash, s.config().NonceTTL)
+	if err != nil {
+		s.logger.Error("x402: failed to consume payment", core.LogKeyPaymentID, authorization.PaymentID, core.LogKeyTxHash, authorization.TransactionHash, "error", err)
+		return reject(http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "Payment verification is temporarily unavailable", nil)
+	}
+	if !unused {
+		return reject(http.StatusForbidden, "PAYMENT_ALREADY_USED", "Payment was already used", map[string]interface{}{
+			"payment_id":       authorization.PaymentID,
+			"transaction_hash": authorization.TransactionHash,
+		})
+	}
+	return nil
+}
+
+// checkAttestation rejects authorizations whose payer signature is invalid,
+// if attestations are required. It returns nil if the authorization passes.
+func (s *Server) checkAttestation(authorization *core.PaymentAuthorization) *Result {
+	if !s.config().RequireAttestation {
+		return nil
+	}
+	if err := authorization.VerifyAttestation(); err != nil {
+		return reject(http.StatusForbidden, "PAYMENT_VERIFICATION_FAILED", "Invalid payment attestation", map[string]interface{}{
+			"message": err.Error(),
+		})
+	}
+	return nil
+}
+
+// checkTimestamp rejects authorizations that are too old or dated too far in
+// the future. It returns nil if the timestamp is acceptable.
+func (s *Server) checkTimestamp(authorization *core.PaymentAuthorization) *Result {
+	if s.config().MaxAuthorizationAge <= 0 {
+		return nil
+	}
+	now := time.Now()
+	age := now.Sub(authorization.Timestamp)
+	switch {
+	case age > s.config().MaxAuthorizationAge:
+		return reject(http.StatusForbidden, "PAYMENT_EXPIRED", "Payment authorization expired", map[string]interface{}{
+			"timestamp": authorization.Timestamp,
+			"max_age":   s.config().MaxAuthorizationAge.String(),
+		})
+	case -age > s.config().MaxClockSkew:
+		return reject(http.StatusForbidden, "PAYMENT_VERIFICATION_FAILED", "Payment authorization timestamp is in the future", map[string]interface{}{
+			"timestamp":   authorization.Timestamp,
+			"server_time": now.UTC(),
+		})
+	}
+	return nil
+}
+
+// checkIssued rejects authorizations that do not match a payment request
+// issued by the server, if a NonceStore is configured. It returns nil if the
+// authorization matches.
+func (s *Server) checkIssued(ctx context.Context, requirement *Requirement, authorization *core.PaymentAuthorization) *Result {
+	if s.config().NonceStore == nil {
+		return nil
+	}
+	issued, err := s.config().NonceStore.Issued(ctx, authorization.PaymentID)
+	if err != nil {
+		s.logger.Error("x402: issued payment request lookup failed", "authorization", authorization, "error", err)
+		return reject(http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "Payment verification is temporarily unavailable", nil)
+	}
+	if issued == nil {
+		return reject(http.StatusForbidden, "PAYMENT_VERIFICATION_FAILED", "Unknown payment ID", map[string]interface{}{
+			"payment_id": authorization.PaymentID,
+		})
+	}
+
+	issuedPrice, accepted := issued.TokenAmount(requirement.TokenMint)
+	var mismatch string
+	switch {
+	case issued.Resource != requirement.Resource:
+		mismatch = "resource"
+	case issued.PaymentAddress != requirement.PaymentAddress:
+		mismatch = "payment_address"
+	case !accepted:
+		mismatch = "asset_address"
+	case !validAmount(issuedPrice) || !validAmount(requirement.Amount) || core.CompareAmounts(issuedPrice, requirement.Amount) < 0:
+		// A price that dropped since the request was issued, e.g. when the
+		// payer reached a volume tier, is still paid in full
+		mismatch = "amount"
+	case !sameRange(issued.Range, requirement.Range):
+		// A payment for some bytes of a file does not pay for others
+		mismatch = "range"
+	}
+	if mismatch != "" {
+		return reject(http.StatusForbidden, "PAYMENT_VERIFICATION_FAILED", "Payment ID was issued for a different request", map[string]interface{}{
+			"payment_id": authorization.PaymentID,
+			"mismatch":   mismatch,
+		})
+	}
+
+	if authorization.Timestamp.After(issued.ExpiresAt.Add(s.config().MaxClockSkew)) {
+		return reject(http.StatusForbidden, "PAYMENT_EXPIRED", "Payment request expired before it was paid", map[string]interface{}{
+			"payment_id": authorization.PaymentID,
+			"expires_at": issued.ExpiresAt,
+		})
+	}
+	return nil
+}
+
+// sameRange reports whether a payment request priced by byte range was
+// issued for the bytes a request asks for.
+func sameRange(issued, requested *core.RangePrice) bool {
+	if issued == nil || requested == nil {
+		return issued == requested
+	}
+	return issued.Range == requested.Range && issued.Size == requested.Size
+}
+
+// report logs, records, and emits the webhook event for a verification result.
+func (s *Server) report(requirement *Requirement, authorization *core.PaymentAuthorization, result *Result) {
+	if result.Allowed() {
+		s.logger.Info("x402: payment verified", "authorization", authorization, core.LogKeyResource, requirement.Resource)
+		s.settleExpiry(authorization.PaymentID)
+		s.record(requirement, authorization, PaymentStatusVerified, "")
+		s.emit(Event{Type: EventPaymentVerified, Resource: requirement.Resource, Authorization: authorization})
+		return
+	}
+	message := result.Message
+	if detail, ok := result.Details["message"].(string); ok {
+		message += ": " + detail
+	}
+	s.logger.Warn("x402: payment verification failed", "authorization", authorization, core.LogKeyResource, requirement.Resource, "reason", message)
+	s.record(requirement, authorization, PaymentStatusFailed, message)
+	s.emit(Event{Type: EventPaymentFailed, Resource: requirement.Resource, Authorization: authorization, Message: message})
+}
+
+// record writes a payment attempt to the configured store, if any.
+func (s *Server) record(requirement *Requirement, authorization *core.PaymentAuthorization, status, message string) {
+	if s.config().Store == nil {
+		return
+	}
+	record := &PaymentRecord{
+		PaymentID:      authorization.PaymentID,
+		Payer:          authorization.PublicKey,
+		Amount:         authorization.ActualAmount,
+		TokenMint:      authorization.AssetAddress,
+		PaymentAddress: authorization.PaymentAddress,
+		Network:        authorization.Network,
+		TxHash:         authorization.TransactionHash,
+		Resource:       requirement.Resource,
+		Status:         status,
+		Message:        message,
+		CreatedAt:      time.Now().UTC(),
+	}
+	// Settlement may run after the request context is gone
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.config().Store.RecordPayment(ctx, record); err != nil {
+		s.logger.Error("x402: failed to record payment", "authorization", authorization, "error", err)
+	}
+}
+
+// verifyOnChain verifies the transaction with the RPC node, consulting the
+// verification cache first. If the transaction pays the requirement, it
+// returns the authorization with the amount transferred on-chain.
+func (s *Server) verifyOnChain(ctx context.Context, requirement *Requirement, authorization *core.PaymentAuthorization) (*core.PaymentAuthorization, *Result) {
+	cache := s.config().VerificationCache
+	key := verificationKey(requirement, authorization)
+	if cache != nil {
+		verified, err := cache.Verified(ctx, key)
+		if err != nil {
+			s.logger.Warn("x402: verification cache lookup failed", core.LogKeyTxHash, authorization.TransactionHash, "error", err)
+		} else if verified {
+			// Only authorizations claiming the amount found on-chain are cached
+			return authorization, nil
+		}
+	}
+
+	memo := ""
+	if s.config().RequirePaymentMemo {
+		memo = core.PaymentMemo(authorization.PaymentID)
+	}
+	transfer, err := s.verifyTransfer(
+		ctx,
+		authorization.TransactionHash,
+		requirement.PaymentAddress,
+		requirement.TokenMint,
+		memo,
+	)
+	if err != nil {
+		return nil, reject(http.StatusForbidden, "PAYMENT_VERIFICATION_FAILED", "Payment verification failed", map[string]interface{}{
+			"message": err.Error(),
+		})
+	}
+	// Confirmed transactions are public, so the header's payer must be the
+	// wallet the transaction debited
+	if transfer.Payer != authorization.PublicKey {
+		return nil, reject(http.StatusForbidden, "PAYMENT_VERIFICATION_FAILED", "Payment verification failed", map[string]interface{}{
+			"message": "transaction was not paid by the authorization's payer",
+		})
+	}
+
+	// The amount claimed in the header is not trusted
+	if len(requirement.Splits) > 0 {
+		paid, result := s.verifySplits(ctx, requirement, authorization, transfer, memo)
+		if result != nil {
+			return nil, result
+		}
+		transfer.Amount = paid
+	} else if core.CompareAmounts(transfer.Amount, requirement.Amount) < 0 {
+		return nil, reject(http.StatusForbidden, "PAYMENT_VERIFICATION_FAILED", "Insufficient payment", map[string]interface{}{
+			"required": requirement.Amount,
+			"provided": transfer.Amount,
+		})
+	}
+	claimed := core.CompareAmounts(transfer.Amount, authorization.ActualAmount) == 0
+	verified := *authorization
+	verified.ActualAmount = transfer.Amount
+	verified.PublicKey = transfer.Payer
+
+	if cache != nil && claimed {
+		// A failed write only costs a future RPC call
+		if err := cache.MarkVerified(ctx, key, s.config().VerificationCacheTTL); err != nil {
+			s.logger.Warn("x402: verification cache write failed", core.LogKeyTxHash, authorization.TransactionHash, "error", err)
+		}
+	}
+	return &verified, nil
+}
+
+// verifySplits checks that a transaction paid the payment address and each
+// split recipient their share of the requirement, given the transfer to the
+// payment address, and returns the total paid.
+func (s *Server) verifySplits(ctx context.Context, requirement *Requirement, authorization *core.PaymentAuthorization, transfer *core.VerifiedTransfer, memo string) (string, *Result) {
+	rest, shares, err := core.SplitAmounts(requirement.Amount, requirement.Splits, transfer.Decimals)
+	if err != nil {
+		return "", reject(http.StatusInternalServerError, "CONFIGURATION_ERROR", err.Error(), nil)
+	}
+	if core.CompareAmounts(transfer.Amount, rest) < 0 {
+		return "", reject(http.StatusForbidden, "PAYMENT_VERIFICATION_FAILED", "Insufficient payment", map[string]interface{}{
+			"recipient": requirement.PaymentAddress,
+			"required":  rest,
+			"provided":  transfer.Amount,
+		})
+	}
+
+	total, _ := new(big.Rat).SetString(transfer.Amount)
+	for i, split := range requirement.Splits {
+		leg, err := s.verifyTransfer(ctx, authorization.TransactionHash, split.Address, requirement.TokenMint, memo)
+		if err != nil {
+			return "", reject(http.StatusForbidden, "PAYMENT_VERIFICATION_FAILED", "Payment verification failed", map[string]interface{}{
+				"recipient": split.Address,
+				"message":   err.Error(),
+			})
+		}
+		if core.CompareAmounts(leg.Amount, shares[i]) < 0 {
+			return "", reject(http.StatusForbidden, "PAYMENT_VERIFICATION_FAILED", "Insufficient payment", map[string]interface{}{
+				"recipient": split.Address,
+				"required":  shares[i],
+				"provided":  leg.Amount,
+			})
+		}
+		amount, _ := new(big.Rat).SetString(leg.Amount)
+		total.Add(total, amount)
+	}
+	return total.FloatString(int(transfer.Decimals)), nil
+}
+
+// verifyTransfer verifies a transfer with the processor, failing if a
+// processor returns neither a transfer nor an error.
+func (s *Server) verifyTransfer(ctx context.Context, txHash, recipient, mint, memo string) (*core.VerifiedTransfer, error) {
+	transfer, err := s.processor.VerifyTransfer(ctx, txHash, recipient, mint, memo)
+	if err == nil && transfer == nil {
+		err = errors.New("processor returned no transfer")
+	}
+	return transfer, err
+}
+
+// recovered logs a panic raised while processing a request, e.g. by a
+// processor or a hook, and returns a result failing the request with
+// INTERNAL_ERROR instead of crashing the server.
+func (s *Server) recovered(v interface{}, resource string) *Result {
+	s.logger.Error("x402: panic while processing payment", core.LogKeyResource, resource, "panic", v, "stack", string(debug.Stack()))
+	return reject(http.StatusInternalServerError, core.ErrInternal.Code, "Internal error while processing the payment", nil)
+}
+
+// selectToken prices a requirement in the accepted token with mint, if it
+// is one. Payments in other tokens fail the token mint check.
+func selectToken(requirement *Requirement, mint string) {
+	if mint == requirement.TokenMint {
+		return
+	}
+	for _, token := range requirement.AcceptedTokens {
+		if token.AssetAddress == mint {
+			requirement.TokenMint = token.AssetAddress
+			requirement.Amount = token.Amount
+			return
+		}
+	}
+}
+
+// reject builds a Result for a rejected request.
+func reject(status int, code, message string, details map[string]interface{}) *Result {
+	return &Result{
+		Status:  status,
+		Code:    code,
+		Message: message,
+		Details: details,
+	}
+}
+
+// generateID generates a random hexadecimal ID.
+func generateID() string {
+	bytes := make([]byte, 16)
+	rand.Read(bytes)
+	return hex.EncodeToString(bytes)
+}
@@ -0,0 +1,281 @@
+package serverx402
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/openlibx402/go/openlibx402-core"
+)
+
+// newTestServer creates a server verifying payments with a mock processor,
+// filling in the payment address and token mint of config.
+func newTestServer(t testing.TB, config *Config) (*Server, *core.MockProcessor) {
+	t.Helper()
+	mock := core.NewMockProcessor()
+	if config.PaymentAddress == "" {
+		config.PaymentAddress = solana.NewWallet().PublicKey().String()
+	}
+	if config.TokenMint == "" {
+		config.TokenMint = solana.NewWallet().PublicKey().String()
+	}
+	config.Processor = mock
+	s := New(config)
+	t.Cleanup(func() { s.Close() })
+	return s, mock
+}
+
+// testRequest returns a request for resource with headers.
+func testRequest(resource string, headers map[string]string) Request {
+	return Request{
+		Context:  context.Background(),
+		Resource: resource,
+		Header:   func(name string) string { return headers[name] },
+	}
+}
+
+// issue returns the payment request the server answers an unpaid request
+// for resource with.
+func issue(t testing.TB, s *Server, resource string, opts Options) *core.PaymentRequest {
+	t.Helper()
+	result := s.Process(testRequest(resource, nil), opts)
+	if result.Status != http.StatusPaymentRequired || result.PaymentRequest == nil {
+		t.Fatalf("unpaid request: got %d %s, want 402", result.Status, result.Code)
+	}
+	return result.PaymentRequest
+}
+
+// pay transfers the amount of paymentReq from payer on the mock chain and
+// returns the authorization header value for it.
+func pay(t testing.TB, mock *core.MockProcessor, paymentReq *core.PaymentRequest, payer string) string {
+	t.Helper()
+	hash := mock.AddTransfer(payer, paymentReq.PaymentAddress, paymentReq.AssetAddress, paymentReq.MaxAmountRequired, core.PaymentMemo(paymentReq.PaymentID))
+	return authorize(t, &core.PaymentAuthorization{
+		PaymentID:       paymentReq.PaymentID,
+		ActualAmount:    paymentReq.MaxAmountRequired,
+		PaymentAddress:  paymentReq.PaymentAddress,
+		AssetAddress:    paymentReq.AssetAddress,
+		Network:         paymentReq.Network,
+		Timestamp:       time.Now().UTC(),
+		PublicKey:       payer,
+		TransactionHash: hash,
+	})
+}
+
+// authorize encodes authorization as a header value.
+func authorize(t testing.TB, authorization *core.PaymentAuthorization) string {
+	t.Helper()
+	header, err := authorization.ToHeaderValue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return header
+}
+
+// paid processes a request for resource with the authorization header.
+func paid(s *Server, resource, header string, opts Options) *Result {
+	return s.Process(testRequest(resource, map[string]string{core.DefaultAuthorizationHeader: header}), opts)
+}
+
+func TestProcessVerifiesPayment(t *testing.T) {
+	s, mock := newTestServer(t, &Config{AutoVerify: true, NonceStore: NewMemoryNonceStore(0)})
+	opts := Options{Amount: "0.10"}
+	payer := solana.NewWallet().PublicKey().String()
+
+	paymentReq := issue(t, s, "/data", opts)
+	result := paid(s, "/data", pay(t, mock, paymentReq, payer), opts)
+	if !result.Allowed() {
+		t.Fatalf("paid request: got %d %s %v, want allowed", result.Status, result.Code, result.Details)
+	}
+	if result.Payer != payer || result.VerifiedAmount != "0.100000" {
+		t.Errorf("got payer %s amount %s, want %s 0.100000", result.Payer, result.VerifiedAmount, payer)
+	}
+}
+
+func TestProcessRejectsUnderpayment(t *testing.T) {
+	s, mock := newTestServer(t, &Config{AutoVerify: true})
+	opts := Options{Amount: "0.10"}
+	payer := solana.NewWallet().PublicKey().String()
+
+	paymentReq := issue(t, s, "/data", opts)
+	hash := mock.AddTransfer(payer, paymentReq.PaymentAddress, paymentReq.AssetAddress, "0.01", "")
+	header := authorize(t, &core.PaymentAuthorization{
+		PaymentID:       paymentReq.PaymentID,
+		ActualAmount:    "0.10", // Claims more than the transfer paid
+		PaymentAddress:  paymentReq.PaymentAddress,
+		AssetAddress:    paymentReq.AssetAddress,
+		Network:         paymentReq.Network,
+		Timestamp:       time.Now().UTC(),
+		PublicKey:       payer,
+		TransactionHash: hash,
+	})
+	if result := paid(s, "/data", header, opts); result.Allowed() {
+		t.Fatal("underpaid request was allowed")
+	}
+}
+
+// fakeRPC is a Solana JSON-RPC server answering getTransaction with one
+// transfer of amount base units of mint from payer to recipient, counting
+// the connections it accepts.
+type fakeRPC struct {
+	*httptest.Server
+	conns atomic.Int32
+}
+
+func newFakeRPC(t testing.TB, payer, recipient, mint solana.PublicKey, amount uint64) *fakeRPC {
+	t.Helper()
+	tx, err := solana.NewTransaction([]solana.Instruction{
+		solana.NewInstruction(solana.MemoProgramID, nil, []byte("x402")),
+	}, solana.Hash{}, solana.TransactionPayer(payer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded, err := tx.ToBase64()
+	if err != nil {
+		t.Fatal(err)
+	}
+	balance := func(index int, owner solana.PublicKey, units uint64) map[string]interface{} {
+		return map[string]interface{}{
+			"accountIndex": index,
+			"mint":         mint.String(),
+			"owner":        owner.String(),
+			"uiTokenAmount": map[string]interface{}{
+				"amount":   strconv.FormatUint(units, 10),
+				"decimals": 6,
+			},
+		}
+	}
+	result := map[string]interface{}{
+		"slot":        1,
+		"transaction": []string{encoded, "base64"},
+		"meta": map[string]interface{}{
+			"err":               nil,
+			"fee":               5000,
+			"preBalances":       []uint64{},
+			"postBalances":      []uint64{},
+			"preTokenBalances":  []interface{}{balance(1, payer, amount), balance(2, recipient, 0)},
+			"postTokenBalances": []interface{}{balance(1, payer, 0), balance(2, recipient, amount)},
+		},
+	}
+
+	rpc := &fakeRPC{}
+	rpc.Server = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var call struct {
+			ID     json.RawMessage `json:"id"`
+			Method string          `json:"method"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&call); err != nil || call.Method != "getTransaction" {
+			http.Error(w, "unexpected call", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": call.ID, "result": result})
+	}))
+	rpc.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			rpc.conns.Add(1)
+		}
+	}
+	rpc.Start()
+	t.Cleanup(rpc.Close)
+	return rpc
+}
+
+// rpcPayment returns the header of an authorization for a new payment
+// request, claiming a random transaction hash from payer, which fakeRPC
+// answers for any hash.
+func rpcPayment(t testing.TB, s *Server, payer solana.PublicKey, opts Options) string {
+	t.Helper()
+	paymentReq := issue(t, s, "/data", opts)
+	var hash solana.Signature
+	if _, err := rand.Read(hash[:]); err != nil {
+		t.Fatal(err)
+	}
+	return authorize(t, &core.PaymentAuthorization{
+		PaymentID:       paymentReq.PaymentID,
+		ActualAmount:    paymentReq.MaxAmountRequired,
+		PaymentAddress:  paymentReq.PaymentAddress,
+		AssetAddress:    paymentReq.AssetAddress,
+		Network:         paymentReq.Network,
+		Timestamp:       time.Now().UTC(),
+		PublicKey:       payer.String(),
+		TransactionHash: hash.String(),
+	})
+}
+
+// newRPCServer creates a server verifying payments with a fakeRPC.
+func newRPCServer(t testing.TB) (*Server, *fakeRPC, solana.PublicKey) {
+	t.Helper()
+	payer := solana.NewWallet().PublicKey()
+	recipient := solana.NewWallet().PublicKey()
+	mint := solana.NewWallet().PublicKey()
+	rpc := newFakeRPC(t, payer, recipient, mint, 100_000)
+	s := New(&Config{
+		PaymentAddress: recipient.String(),
+		TokenMint:      mint.String(),
+		RPCURL:         rpc.URL,
+		AutoVerify:     true,
+	})
+	t.Cleanup(func() { s.Close() })
+	return s, rpc, payer
+}
+
+func TestProcessReusesRPCConnection(t *testing.T) {
+	s, rpc, payer := newRPCServer(t)
+	opts := Options{Amount: "0.10"}
+
+	for i := 0; i < 10; i++ {
+		if result := paid(s, "/data", rpcPayment(t, s, payer, opts), opts); !result.Allowed() {
+			t.Fatalf("got %d %s %v, want allowed", result.Status, result.Code, result.Details)
+		}
+	}
+	if n := rpc.conns.Load(); n != 1 {
+		t.Errorf("10 verifications opened %d RPC connections, want 1", n)
+	}
+}
+
+// BenchmarkProcess measures verifying payments against an RPC node with the
+// server's pooled processor, reporting the connections opened per request.
+func BenchmarkProcess(b *testing.B) {
+	s, rpc, payer := newRPCServer(b)
+	opts := Options{Amount: "0.10"}
+
+	headers := make([]string, b.N)
+	for i := range headers {
+		headers[i] = rpcPayment(b, s, payer, opts)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for _, header := range headers {
+		if result := paid(s, "/data", header, opts); !result.Allowed() {
+			b.Fatalf("got %d %s %v, want allowed", result.Status, result.Code, result.Details)
+		}
+	}
+	b.StopTimer()
+	b.ReportMetric(float64(rpc.conns.Load())/float64(b.N), "conns/op")
+}
+
+func TestProcessRejectsOtherPayersTransaction(t *testing.T) {
+	s, mock := newTestServer(t, &Config{AutoVerify: true})
+	opts := Options{Amount: "0.10"}
+
+	// A confirmed transaction of the victim claimed by another payer
+	paymentReq := issue(t, s, "/data", opts)
+	authorization, err := core.PaymentAuthorizationFromHeader(pay(t, mock, paymentReq, solana.NewWallet().PublicKey().String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	authorization.PublicKey = solana.NewWallet().PublicKey().String()
+	result := paid(s, "/data", authorize(t, authorization), opts)
+	if result.Allowed() || result.Code != "PAYMENT_VERIFICATION_FAILED" {
+		t.Errorf("got %d %s, want PAYMENT_VERIFICATION_FAILED", result.Status, result.Code)
+	}
+}
@@ -0,0 +1,93 @@
+package serverx402
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/openlibx402/go/openlibx402-core"
+)
+
+// sessionClaims is the signed payload of a session token.
+type sessionClaims struct {
+	Resource  string `json:"r"`
+	Payer     string `json:"p"`
+	ExpiresAt int64  `json:"e"`
+}
+
+// sessionKey returns the HMAC key for session tokens, generating a per-process
+// key if none is configured.
+func (s *Server) sessionKey() []byte {
+	s.sessionOnce.Do(func() {
+		s.sessionSecret = s.config().SessionSecret
+		if len(s.sessionSecret) == 0 {
+			s.sessionSecret = make([]byte, 32)
+			rand.Read(s.sessionSecret)
+		}
+	})
+	return s.sessionSecret
+}
+
+// issueSession returns a session token granting access to resource until the
+// session TTL elapses.
+func (s *Server) issueSession(resource, payer string) string {
+	payload, _ := json.Marshal(sessionClaims{
+		Resource:  resource,
+		Payer:     payer,
+		ExpiresAt: time.Now().Add(s.config().SessionTTL).Unix(),
+	})
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + s.signSession(encoded)
+}
+
+// checkSession returns the payer of a valid, unexpired session token for resource.
+func (s *Server) checkSession(token, resource string) (string, bool) {
+	encoded, sig, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(s.signSession(encoded))) {
+		return "", false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", false
+	}
+	var claims sessionClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return "", false
+	}
+	if claims.Resource != resource || time.Now().Unix() >= claims.ExpiresAt {
+		return "", false
+	}
+	return claims.Payer, true
+}
+
+// signSession computes the signature of an encoded session payload.
+func (s *Server) signSession(encoded string) string {
+	mac := hmac.New(sha256.New, s.sessionKey())
+	mac.Write([]byte(encoded))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// sessionResult returns an allowed result if the request carries a valid
+// session token, or nil.
+func (s *Server) sessionResult(req Request, requirement *Requirement) *Result {
+	if s.config().SessionTTL <= 0 {
+		return nil
+	}
+	token := req.Header(s.config().SessionHeader)
+	if token == "" {
+		return nil
+	}
+	payer, ok := s.checkSession(token, requirement.Resource)
+	if !ok || s.IsFlagged(payer) {
+		return nil
+	}
+	if result := s.checkPayer(req.Context, payer); result != nil {
+		return result
+	}
+	s.logger.Debug("x402: session token accepted", core.LogKeyPayer, payer, core.LogKeyResource, requirement.Resource)
+	return &Result{Requirement: requirement, Payer: payer}
+}
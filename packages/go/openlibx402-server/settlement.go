@@ -0,0 +1,163 @@
+package serverx402
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/openlibx402/go/openlibx402-core"
+)
+
+// maxSettlementFailures bounds the failures kept by Server.SettlementFailures.
+const maxSettlementFailures = 1000
+
+// SettlementFailure records a payment that was accepted in async settlement mode
+// but failed on-chain verification.
+type SettlementFailure struct {
+	Authorization *core.PaymentAuthorization
+	Requirement   *Requirement
+	Message       string
+	FailedAt      time.Time
+}
+
+// settlementJob is a payment queued for asynchronous verification.
+type settlementJob struct {
+	requirement   *Requirement
+	authorization *core.PaymentAuthorization
+}
+
+// settlement runs asynchronous on-chain verification in a worker pool.
+type settlement struct {
+	jobs    chan settlementJob
+	wg      sync.WaitGroup
+	queueMu sync.RWMutex
+	stopped bool
+
+	mu       sync.Mutex
+	failures []SettlementFailure
+	flagged  map[string]bool
+}
+
+// startSettlement starts the settlement workers for the server.
+func (s *Server) startSettlement() {
+	workers := s.config().SettlementWorkers
+	if workers <= 0 {
+		workers = 4
+	}
+	s.settlement = &settlement{
+		jobs:    make(chan settlementJob, workers*64),
+		flagged: make(map[string]bool),
+	}
+	for i := 0; i < workers; i++ {
+		s.settlement.wg.Add(1)
+		go func() {
+			defer s.settlement.wg.Done()
+			for job := range s.settlement.jobs {
+				s.settle(job)
+			}
+		}()
+	}
+}
+
+// enqueueSettlement queues a payment for asynchronous verification. It
+// reports false if the queue is full or the server is closed.
+func (s *Server) enqueueSettlement(requirement *Requirement, authorization *core.PaymentAuthorization) bool {
+	s.settlement.queueMu.RLock()
+	defer s.settlement.queueMu.RUnlock()
+	if s.settlement.stopped {
+		return false
+	}
+	select {
+	case s.settlement.jobs <- settlementJob{requirement: requirement, authorization: authorization}:
+		return true
+	default:
+		s.logger.Warn("x402: settlement queue full, verifying synchronously", core.LogKeyTxHash, authorization.TransactionHash)
+		return false
+	}
+}
+
+// settle verifies a queued payment and records it if verification fails.
+func (s *Server) settle(job settlementJob) {
+	defer func() {
+		// Keep the worker running; the payer is left unflagged
+		if v := recover(); v != nil {
+			s.recovered(v, job.requirement.Resource)
+		}
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), s.config().SettlementTimeout)
+	defer cancel()
+
+	verified, result := s.verifyOnChain(ctx, job.requirement, job.authorization)
+	if result == nil {
+		s.report(job.requirement, verified, &Result{Authorization: verified, VerifiedAmount: verified.ActualAmount})
+		return
+	}
+	s.report(job.requirement, job.authorization, result)
+
+	message, _ := result.Details["message"].(string)
+	failure := SettlementFailure{
+		Authorization: job.authorization,
+		Requirement:   job.requirement,
+		Message:       message,
+		FailedAt:      time.Now().UTC(),
+	}
+
+	s.logger.Error("x402: settlement failed, payer flagged", "authorization", job.authorization, "reason", message)
+
+	st := s.settlement
+	st.mu.Lock()
+	st.flagged[job.authorization.PublicKey] = true
+	st.failures = append(st.failures, failure)
+	if len(st.failures) > maxSettlementFailures {
+		st.failures = st.failures[len(st.failures)-maxSettlementFailures:]
+	}
+	st.mu.Unlock()
+
+	if s.config().OnSettlementFailure != nil {
+		s.config().OnSettlementFailure(failure)
+	}
+}
+
+// IsFlagged reports whether a payer has been flagged after a failed asynchronous settlement.
+func (s *Server) IsFlagged(pubkey string) bool {
+	if s.settlement == nil {
+		return false
+	}
+	s.settlement.mu.Lock()
+	defer s.settlement.mu.Unlock()
+	return s.settlement.flagged[pubkey]
+}
+
+// Unflag clears the flag on a payer, e.g. after the payment was resolved out of band.
+func (s *Server) Unflag(pubkey string) {
+	if s.settlement == nil {
+		return
+	}
+	s.settlement.mu.Lock()
+	defer s.settlement.mu.Unlock()
+	delete(s.settlement.flagged, pubkey)
+}
+
+// SettlementFailures returns the most recent failed asynchronous settlements.
+func (s *Server) SettlementFailures() []SettlementFailure {
+	if s.settlement == nil {
+		return nil
+	}
+	s.settlement.mu.Lock()
+	defer s.settlement.mu.Unlock()
+	failures := make([]SettlementFailure, len(s.settlement.failures))
+	copy(failures, s.settlement.failures)
+	return failures
+}
+
+// stopSettlement drains the settlement queue and waits for the workers.
+func (s *Server) stopSettlement() {
+	if s.settlement == nil {
+		return
+	}
+	s.settlement.queueMu.Lock()
+	s.settlement.stopped = true
+	close(s.settlement.jobs)
+	s.settlement.queueMu.Unlock()
+	s.settlement.wg.Wait()
+}
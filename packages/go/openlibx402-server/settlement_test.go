@@ -0,0 +1,88 @@
+package serverx402
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/openlibx402/go/openlibx402-core"
+)
+
+// attested returns the header of an authorization for paymentReq with the
+// transaction txHash, attested by payer.
+func attested(t testing.TB, paymentReq *core.PaymentRequest, payer solana.PrivateKey, txHash string) string {
+	t.Helper()
+	authorization := &core.PaymentAuthorization{
+		PaymentID:      paymentReq.PaymentID,
+		ActualAmount:   paymentReq.MaxAmountRequired,
+		PaymentAddress: paymentReq.PaymentAddress,
+		AssetAddress:   paymentReq.AssetAddress,
+		Network:        paymentReq.Network,
+		Timestamp:      time.Now().UTC(),
+	}
+	authorization.TransactionHash = txHash
+	if err := authorization.Attest(context.Background(), core.NewKeypairSigner(payer)); err != nil {
+		t.Fatal(err)
+	}
+	return authorize(t, authorization)
+}
+
+func TestAsyncSettlementFlagsSigner(t *testing.T) {
+	s, _ := newTestServer(t, &Config{AutoVerify: true, AsyncSettlement: true, RequireAttestation: true})
+	opts := Options{Amount: "0.10"}
+	payer := solana.NewWallet().PrivateKey
+
+	// Served before the transaction, which does not exist, is verified
+	paymentReq := issue(t, s, "/data", opts)
+	result := paid(s, "/data", attested(t, paymentReq, payer, "missing-transaction"), opts)
+	if !result.Allowed() || !result.Pending {
+		t.Fatalf("got %d %s pending=%v, want allowed and pending", result.Status, result.Code, result.Pending)
+	}
+	s.Close() // Waits for the settlement
+	if !s.IsFlagged(payer.PublicKey().String()) {
+		t.Error("payer of a failed settlement not flagged")
+	}
+}
+
+func TestAsyncSettlementRejectsClaimedPayer(t *testing.T) {
+	s, _ := newTestServer(t, &Config{AutoVerify: true, AsyncSettlement: true, RequireAttestation: true})
+	opts := Options{Amount: "0.10"}
+	victim := solana.NewWallet().PublicKey().String()
+
+	// An authorization claiming another payer without its signature
+	paymentReq := issue(t, s, "/data", opts)
+	authorization, err := core.PaymentAuthorizationFromHeader(attested(t, paymentReq, solana.NewWallet().PrivateKey, "missing-transaction"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	authorization.PublicKey = victim
+	if result := paid(s, "/data", authorize(t, authorization), opts); result.Allowed() {
+		t.Fatal("authorization with a claimed payer was allowed")
+	}
+	s.Close()
+	if s.IsFlagged(victim) {
+		t.Error("claimed payer was flagged")
+	}
+}
+
+func TestRequireAttestationRejectsSwappedTransaction(t *testing.T) {
+	s, mock := newTestServer(t, &Config{AutoVerify: true, RequireAttestation: true})
+	opts := Options{Amount: "0.10"}
+	payer := solana.NewWallet().PrivateKey
+
+	paymentReq := issue(t, s, "/data", opts)
+	hash := mock.AddTransfer(payer.PublicKey().String(), paymentReq.PaymentAddress, paymentReq.AssetAddress, "0.10", core.PaymentMemo(paymentReq.PaymentID))
+	authorization, err := core.PaymentAuthorizationFromHeader(attested(t, paymentReq, payer, hash))
+	if err != nil {
+		t.Fatal(err)
+	}
+	authorization.TransactionHash = mock.AddTransfer(solana.NewWallet().PublicKey().String(), paymentReq.PaymentAddress, paymentReq.AssetAddress, "0.10", core.PaymentMemo(paymentReq.PaymentID))
+	if result := paid(s, "/data", authorize(t, authorization), opts); result.Allowed() {
+		t.Error("authorization with a transaction its payer did not attest to was allowed")
+	}
+	authorization.TransactionHash = hash
+	if result := paid(s, "/data", authorize(t, authorization), opts); !result.Allowed() {
+		t.Errorf("attested authorization: got %d %s, want allowed", result.Status, result.Code)
+	}
+}
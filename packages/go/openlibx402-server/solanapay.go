@@ -0,0 +1,79 @@
+package serverx402
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/openlibx402/go/openlibx402-core"
+)
+
+// solanaPayURL returns the Solana Pay URL of a payment request, or "" if
+// Config.SolanaPay is off or the payment request cannot be paid with a
+// transfer request.
+func (s *Server) solanaPayURL(paymentReq *core.PaymentRequest) string {
+	if !s.config().SolanaPay || len(paymentReq.Splits) > 0 || paymentReq.Escrow != nil {
+		return ""
+	}
+	return core.SolanaPayURL(paymentReq)
+}
+
+// solanaPayAuthorization returns the authorization of a Solana Pay transfer
+// paying the payment request named in the reference header, found by its
+// reference, or nil if the request names none. The transfer must carry the
+// payment memo. Until the transfer is confirmed it returns a 402 result with
+// the same payment request, so the client can keep polling while the payer
+// pays from a wallet.
+func (s *Server) solanaPayAuthorization(req Request, requirement *Requirement) (*core.PaymentAuthorization, *Result) {
+	paymentID := req.Header(s.config().ReferenceHeader)
+	if paymentID == "" && s.config().PaywallQRCode {
+		paymentID = paywallCookie(req.Header("Cookie"), PaywallReferenceCookie)
+	}
+	if !s.config().SolanaPay || paymentID == "" {
+		return nil, nil
+	}
+	issued, err := s.config().NonceStore.Issued(req.Context, paymentID)
+	if err != nil {
+		s.logger.Error("x402: issued payment request lookup failed", core.LogKeyPaymentID, paymentID, "error", err)
+		return nil, reject(http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "Payment verification is temporarily unavailable", nil)
+	}
+	if issued == nil {
+		return nil, reject(http.StatusForbidden, "PAYMENT_VERIFICATION_FAILED", "Unknown payment ID", map[string]interface{}{
+			"payment_id": paymentID,
+		})
+	}
+
+	reference := core.SolanaPayReference(paymentID).String()
+	hash, err := s.processor.(core.ReferenceFinder).FindReference(req.Context, reference)
+	if err != nil {
+		s.logger.Error("x402: Solana Pay reference lookup failed", core.LogKeyPaymentID, paymentID, "reference", reference, "error", err)
+		return nil, reject(http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "Payment verification is temporarily unavailable", nil)
+	}
+	if hash == "" {
+		return nil, &Result{
+			Status:         http.StatusPaymentRequired,
+			Code:           "PAYMENT_REQUIRED",
+			Message:        "The Solana Pay transfer has not been confirmed yet",
+			PaymentRequest: issued,
+			Requirement:    requirement,
+		}
+	}
+
+	// The payer is whoever the transfer debited
+	transfer, err := s.verifyTransfer(req.Context, hash, issued.PaymentAddress, issued.AssetAddress, core.PaymentMemo(paymentID))
+	if err != nil {
+		return nil, reject(http.StatusForbidden, "PAYMENT_VERIFICATION_FAILED", "Payment verification failed", map[string]interface{}{
+			"message": err.Error(),
+		})
+	}
+	s.logger.Debug("x402: found Solana Pay transfer", core.LogKeyPaymentID, paymentID, core.LogKeyTxHash, hash, core.LogKeyPayer, transfer.Payer)
+	return &core.PaymentAuthorization{
+		PaymentID:       paymentID,
+		ActualAmount:    transfer.Amount,
+		PaymentAddress:  issued.PaymentAddress,
+		AssetAddress:    issued.AssetAddress,
+		Network:         issued.Network,
+		Timestamp:       time.Now().UTC(),
+		PublicKey:       transfer.Payer,
+		TransactionHash: hash,
+	}, nil
+}
@@ -0,0 +1,421 @@
+package serverx402
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/openlibx402/go/openlibx402-core"
+)
+
+// Payment record statuses.
+const (
+	PaymentStatusVerified = "verified"
+	PaymentStatusFailed   = "failed"
+)
+
+// PaymentRecord is a payment attempt recorded in the ledger.
+type PaymentRecord struct {
+	PaymentID      string    `json:"payment_id"`
+	Payer          string    `json:"payer"`
+	Amount         string    `json:"amount"`
+	TokenMint      string    `json:"token_mint"`
+	PaymentAddress string    `json:"payment_address"`
+	Network        string    `json:"network"`
+	TxHash         string    `json:"tx_hash,omitempty"`
+	Resource       string    `json:"resource"`
+	Status         string    `json:"status"`
+	Message        string    `json:"message,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// PaymentQuery filters ledger queries. Zero fields are not filtered on.
+type PaymentQuery struct {
+	Since     time.Time
+	Until     time.Time
+	PaymentID string
+	Resource  string
+	Payer     string
+	Status    string
+	Limit     int // Maximum records, newest first (default: 100, negative for all)
+}
+
+// ResourceRevenue is the verified revenue of one resource in one token.
+type ResourceRevenue struct {
+	Resource  string `json:"resource"`
+	TokenMint string `json:"token_mint"`
+	Payments  int    `json:"payments"`
+	Total     string `json:"total"`
+}
+
+// PaymentStore persists issued payment requests and payment attempts.
+//
+// Implementations must be safe for concurrent use.
+type PaymentStore interface {
+	// RecordRequest stores a payment request issued in a 402 response.
+	RecordRequest(ctx context.Context, request *core.PaymentRequest) error
+	// RecordPayment stores a verified or failed payment attempt.
+	RecordPayment(ctx context.Context, record *PaymentRecord) error
+	// ListPayments returns payment attempts matching the query, newest first.
+	ListPayments(ctx context.Context, query PaymentQuery) ([]PaymentRecord, error)
+}
+
+// PaymentCounter is implemented by payment stores that count transactions
+// without listing payment attempts, which volume pricing uses when available
+// (see VolumePricing).
+type PaymentCounter interface {
+	// CountTransactions returns the number of distinct transaction hashes of
+	// the payment attempts matching the query, ignoring attempts without one.
+	// Limit is ignored.
+	CountTransactions(ctx context.Context, query PaymentQuery) (int, error)
+}
+
+// Revenue sums verified payments per resource and token mint between since
+// and until (zero values are unbounded), by token mint and then highest total
+// first. Amounts are summed exactly as decimals, and a transaction recorded
+// more than once is counted once.
+func Revenue(ctx context.Context, store PaymentStore, since, until time.Time) ([]ResourceRevenue, error) {
+	records, err := store.ListPayments(ctx, PaymentQuery{
+		Since:  since,
+		Until:  until,
+		Status: PaymentStatusVerified,
+		Limit:  -1,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	type key struct{ resource, mint string }
+	totals := make(map[key]*big.Rat)
+	counts := make(map[key]int)
+	counted := make(map[string]bool)
+	for _, record := range records {
+		amount, ok := new(big.Rat).SetString(record.Amount)
+		if !ok {
+			continue
+		}
+		if record.TxHash != "" {
+			if counted[record.TxHash] {
+				continue
+			}
+			counted[record.TxHash] = true
+		}
+		k := key{record.Resource, record.TokenMint}
+		if totals[k] == nil {
+			totals[k] = new(big.Rat)
+		}
+		totals[k].Add(totals[k], amount)
+		counts[k]++
+	}
+
+	revenue := make([]ResourceRevenue, 0, len(totals))
+	for k, total := range totals {
+		revenue = append(revenue, ResourceRevenue{
+			Resource:  k.resource,
+			TokenMint: k.mint,
+			Payments:  counts[k],
+			Total:     formatAmount(total),
+		})
+	}
+	// Totals in different tokens are not comparable
+	sort.Slice(revenue, func(i, j int) bool {
+		if revenue[i].TokenMint != revenue[j].TokenMint {
+			return revenue[i].TokenMint < revenue[j].TokenMint
+		}
+		ti, _ := new(big.Rat).SetString(revenue[i].Total)
+		tj, _ := new(big.Rat).SetString(revenue[j].Total)
+		if c := ti.Cmp(tj); c != 0 {
+			return c > 0
+		}
+		return revenue[i].Resource < revenue[j].Resource
+	})
+	return revenue, nil
+}
+
+// parseAmount parses a decimal amount, treating empty and invalid amounts as
+// zero.
+func parseAmount(amount string) *big.Rat {
+	r, ok := new(big.Rat).SetString(amount)
+	if !ok {
+		return new(big.Rat)
+	}
+	return r
+}
+
+// validAmount reports whether amount is a decimal number.
+func validAmount(amount string) bool {
+	_, ok := new(big.Rat).SetString(amount)
+	return ok
+}
+
+// formatAmount formats a decimal amount without trailing zeros.
+func formatAmount(amount *big.Rat) string {
+	s := amount.FloatString(9)
+	s = strings.TrimRight(s, "0")
+	return strings.TrimSuffix(s, ".")
+}
+
+// SQLStore is a PaymentStore backed by database/sql.
+//
+// The caller opens the database with the driver of their choice (e.g.
+// github.com/jackc/pgx/v5/stdlib or modernc.org/sqlite); this package does not
+// import any driver.
+type SQLStore struct {
+	db       *sql.DB
+	postgres bool
+}
+
+// NewPostgresStore creates a PaymentStore using a PostgreSQL database.
+func NewPostgresStore(db *sql.DB) *SQLStore {
+	return &SQLStore{db: db, postgres: true}
+}
+
+// NewSQLiteStore creates a PaymentStore using a SQLite database.
+func NewSQLiteStore(db *sql.DB) *SQLStore {
+	return &SQLStore{db: db}
+}
+
+// Migrate creates the ledger tables if they do not exist.
+//
+// A transaction hash is recorded as verified at most once. Migrating a
+// ledger created before this was enforced fails if it already has
+// duplicates; delete them and migrate again.
+func (s *SQLStore) Migrate(ctx context.Context) error {
+	id := "INTEGER PRIMARY KEY AUTOINCREMENT"
+	timestamp := "TIMESTAMP"
+	if s.postgres {
+		id = "BIGSERIAL PRIMARY KEY"
+		timestamp = "TIMESTAMPTZ"
+	}
+
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS x402_payment_requests (
+			payment_id TEXT PRIMARY KEY,
+			amount TEXT NOT NULL,
+			token_mint TEXT NOT NULL,
+			payment_address TEXT NOT NULL,
+			network TEXT NOT NULL,
+			resource TEXT NOT NULL,
+			description TEXT NOT NULL,
+			nonce TEXT NOT NULL,
+			expires_at ` + timestamp + ` NOT NULL,
+			created_at ` + timestamp + ` NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS x402_payments (
+			id ` + id + `,
+			payment_id TEXT NOT NULL,
+			payer TEXT NOT NULL,
+			amount TEXT NOT NULL,
+			token_mint TEXT NOT NULL,
+			payment_address TEXT NOT NULL,
+			network TEXT NOT NULL,
+			tx_hash TEXT NOT NULL,
+			resource TEXT NOT NULL,
+			status TEXT NOT NULL,
+			message TEXT NOT NULL,
+			created_at ` + timestamp + ` NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS x402_refunds (
+			refund_id TEXT PRIMARY KEY,
+			payment_id TEXT NOT NULL,
+			amount TEXT NOT NULL,
+			recipient TEXT NOT NULL,
+			asset_address TEXT NOT NULL,
+			network TEXT NOT NULL,
+			transaction_hash TEXT NOT NULL,
+			reason TEXT NOT NULL,
+			created_at ` + timestamp + ` NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS x402_subscriptions (
+			payment_id TEXT PRIMARY KEY,
+			payer TEXT NOT NULL,
+			plan TEXT NOT NULL,
+			amount TEXT NOT NULL,
+			tx_hash TEXT NOT NULL,
+			starts_at ` + timestamp + ` NOT NULL,
+			expires_at ` + timestamp + ` NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS x402_payments_created_at ON x402_payments (created_at)`,
+		`CREATE INDEX IF NOT EXISTS x402_payments_payer ON x402_payments (payer)`,
+		`CREATE INDEX IF NOT EXISTS x402_payments_payment_id ON x402_payments (payment_id)`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS x402_payments_verified_tx_hash ON x402_payments (tx_hash) WHERE status = 'verified' AND tx_hash <> ''`,
+		`CREATE INDEX IF NOT EXISTS x402_subscriptions_payer_plan ON x402_subscriptions (payer, plan, expires_at)`,
+	}
+	for _, stmt := range statements {
+		if _, err := s.db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to migrate payment store: %w", err)
+		}
+	}
+	return nil
+}
+
+// RecordRequest implements PaymentStore.
+func (s *SQLStore) RecordRequest(ctx context.Context, request *core.PaymentRequest) error {
+	_, err := s.db.ExecContext(ctx, s.rebind(`INSERT INTO x402_payment_requests
+		(payment_id, amount, token_mint, payment_address, network, resource, description, nonce, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`),
+		request.PaymentID, request.MaxAmountRequired, request.AssetAddress, request.PaymentAddress,
+		request.Network, request.Resource, request.Description, request.Nonce,
+		request.ExpiresAt.UTC(), time.Now().UTC(),
+	)
+	return err
+}
+
+// RecordPayment implements PaymentStore. A verified payment whose
+// transaction is already recorded as verified is ignored.
+func (s *SQLStore) RecordPayment(ctx context.Context, record *PaymentRecord) error {
+	createdAt := record.CreatedAt
+	if createdAt.IsZero() {
+		createdAt = time.Now().UTC()
+	}
+	_, err := s.db.ExecContext(ctx, s.rebind(`INSERT INTO x402_payments
+		(payment_id, payer, amount, token_mint, payment_address, network, tx_hash, resource, status, message, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT DO NOTHING`),
+		record.PaymentID, record.Payer, record.Amount, record.TokenMint, record.PaymentAddress,
+		record.Network, record.TxHash, record.Resource, record.Status, record.Message, createdAt.UTC(),
+	)
+	return err
+}
+
+// RecordRefund implements RefundStore.
+func (s *SQLStore) RecordRefund(ctx context.Context, refund *core.Refund) error {
+	_, err := s.db.ExecContext(ctx, s.rebind(`INSERT INTO x402_refunds
+		(refund_id, payment_id, amount, recipient, asset_address, network, transaction_hash, reason, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`),
+		refund.RefundID, refund.PaymentID, refund.Amount, refund.Recipient, refund.AssetAddress,
+		refund.Network, refund.TransactionHash, refund.Reason, refund.CreatedAt.UTC(),
+	)
+	return err
+}
+
+// RecordSubscription implements SubscriptionStore.
+func (s *SQLStore) RecordSubscription(ctx context.Context, subscription *Subscription) error {
+	_, err := s.db.ExecContext(ctx, s.rebind(`INSERT INTO x402_subscriptions
+		(payment_id, payer, plan, amount, tx_hash, starts_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`),
+		subscription.PaymentID, subscription.Payer, subscription.Plan, subscription.Amount,
+		subscription.TxHash, subscription.StartsAt.UTC(), subscription.ExpiresAt.UTC(),
+	)
+	return err
+}
+
+// LatestSubscription implements SubscriptionStore.
+func (s *SQLStore) LatestSubscription(ctx context.Context, payer, plan string) (*Subscription, error) {
+	var sub Subscription
+	err := s.db.QueryRowContext(ctx, s.rebind(`SELECT payment_id, payer, plan, amount, tx_hash, starts_at, expires_at
+		FROM x402_subscriptions WHERE payer = ? AND plan = ?
+		ORDER BY expires_at DESC LIMIT 1`), payer, plan,
+	).Scan(&sub.PaymentID, &sub.Payer, &sub.Plan, &sub.Amount, &sub.TxHash, &sub.StartsAt, &sub.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &sub, nil
+}
+
+// ListPayments implements PaymentStore. A negative Limit returns all matches.
+func (s *SQLStore) ListPayments(ctx context.Context, query PaymentQuery) ([]PaymentRecord, error) {
+	where, args := paymentFilter(query)
+
+	stmt := `SELECT payment_id, payer, amount, token_mint, payment_address, network, tx_hash, resource, status, message, created_at
+		FROM x402_payments` + where
+	stmt += " ORDER BY created_at DESC, id DESC"
+	limit := query.Limit
+	if limit == 0 {
+		limit = 100
+	}
+	if limit > 0 {
+		stmt += " LIMIT " + strconv.Itoa(limit)
+	}
+
+	rows, err := s.db.QueryContext(ctx, s.rebind(stmt), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []PaymentRecord
+	for rows.Next() {
+		var r PaymentRecord
+		if err := rows.Scan(&r.PaymentID, &r.Payer, &r.Amount, &r.TokenMint, &r.PaymentAddress,
+			&r.Network, &r.TxHash, &r.Resource, &r.Status, &r.Message, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		records = append(records, r)
+	}
+	return records, rows.Err()
+}
+
+// CountTransactions implements PaymentCounter.
+func (s *SQLStore) CountTransactions(ctx context.Context, query PaymentQuery) (int, error) {
+	where, args := paymentFilter(query)
+	if where == "" {
+		where = " WHERE tx_hash <> ''"
+	} else {
+		where += " AND tx_hash <> ''"
+	}
+	var count int
+	err := s.db.QueryRowContext(ctx, s.rebind(`SELECT COUNT(DISTINCT tx_hash) FROM x402_payments`+where), args...).Scan(&count)
+	return count, err
+}
+
+// paymentFilter returns the WHERE clause of a payment query, or "" if it
+// filters on nothing, and its arguments.
+func paymentFilter(query PaymentQuery) (string, []interface{}) {
+	var where []string
+	var args []interface{}
+	if !query.Since.IsZero() {
+		where = append(where, "created_at >= ?")
+		args = append(args, query.Since.UTC())
+	}
+	if !query.Until.IsZero() {
+		where = append(where, "created_at < ?")
+		args = append(args, query.Until.UTC())
+	}
+	if query.PaymentID != "" {
+		where = append(where, "payment_id = ?")
+		args = append(args, query.PaymentID)
+	}
+	if query.Resource != "" {
+		where = append(where, "resource = ?")
+		args = append(args, query.Resource)
+	}
+	if query.Payer != "" {
+		where = append(where, "payer = ?")
+		args = append(args, query.Payer)
+	}
+	if query.Status != "" {
+		where = append(where, "status = ?")
+		args = append(args, query.Status)
+	}
+	if len(where) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(where, " AND "), args
+}
+
+// rebind converts ? placeholders to the $n form used by PostgreSQL.
+func (s *SQLStore) rebind(query string) string {
+	if !s.postgres {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
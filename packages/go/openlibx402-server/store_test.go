@@ -0,0 +1,183 @@
+package serverx402
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/openlibx402/go/openlibx402-core"
+)
+
+// memStore is a PaymentStore keeping records in memory, filtering on
+// Status, Payer, and Resource only.
+type memStore struct {
+	mu      sync.Mutex
+	records []PaymentRecord
+}
+
+func (m *memStore) RecordRequest(ctx context.Context, request *core.PaymentRequest) error {
+	return nil
+}
+
+func (m *memStore) RecordPayment(ctx context.Context, record *PaymentRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.records = append(m.records, *record)
+	return nil
+}
+
+func (m *memStore) ListPayments(ctx context.Context, query PaymentQuery) ([]PaymentRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var records []PaymentRecord
+	for i := len(m.records) - 1; i >= 0; i-- {
+		record := m.records[i]
+		if (query.Status == "" || record.Status == query.Status) &&
+			(query.Payer == "" || record.Payer == query.Payer) &&
+			(query.Resource == "" || record.Resource == query.Resource) {
+			records = append(records, record)
+		}
+	}
+	return records, nil
+}
+
+func TestRevenueGroupsByTokenMint(t *testing.T) {
+	store := &memStore{}
+	ctx := context.Background()
+	for _, record := range []PaymentRecord{
+		{Resource: "/a", TokenMint: "usdc", Amount: "0.10", TxHash: "tx1", Status: PaymentStatusVerified},
+		{Resource: "/a", TokenMint: "usdc", Amount: "0.20", TxHash: "tx2", Status: PaymentStatusVerified},
+		{Resource: "/a", TokenMint: "bonk", Amount: "1000", TxHash: "tx3", Status: PaymentStatusVerified},
+		{Resource: "/b", TokenMint: "usdc", Amount: "0.05", TxHash: "tx4", Status: PaymentStatusVerified},
+		{Resource: "/b", TokenMint: "usdc", Amount: "5", TxHash: "tx5", Status: PaymentStatusFailed},
+	} {
+		store.RecordPayment(ctx, &record)
+	}
+
+	revenue, err := Revenue(ctx, store, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ResourceRevenue{
+		{Resource: "/a", TokenMint: "bonk", Payments: 1, Total: "1000"},
+		{Resource: "/a", TokenMint: "usdc", Payments: 2, Total: "0.3"},
+		{Resource: "/b", TokenMint: "usdc", Payments: 1, Total: "0.05"},
+	}
+	if !reflect.DeepEqual(revenue, want) {
+		t.Errorf("Revenue() = %+v, want %+v", revenue, want)
+	}
+}
+
+func TestRevenueCountsTransactionOnce(t *testing.T) {
+	store := &memStore{}
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		store.RecordPayment(ctx, &PaymentRecord{Resource: "/a", TokenMint: "usdc", Amount: "0.10", TxHash: "tx1", Status: PaymentStatusVerified})
+	}
+
+	revenue, err := Revenue(ctx, store, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revenue) != 1 || revenue[0].Payments != 1 || revenue[0].Total != "0.1" {
+		t.Errorf("Revenue() = %+v, want one payment of 0.1", revenue)
+	}
+}
+
+// recordingDriver is a database/sql driver recording the statements it is
+// asked to execute, failing queries.
+type recordingDriver struct {
+	mu         sync.Mutex
+	statements []string
+}
+
+func (d *recordingDriver) Open(name string) (driver.Conn, error) { return recordingConn{d}, nil }
+
+func (d *recordingDriver) executed() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string(nil), d.statements...)
+}
+
+type recordingConn struct{ driver *recordingDriver }
+
+func (c recordingConn) Prepare(query string) (driver.Stmt, error) {
+	return recordingStmt{c.driver, query}, nil
+}
+
+func (c recordingConn) Close() error { return nil }
+
+func (c recordingConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("transactions not supported")
+}
+
+type recordingStmt struct {
+	driver *recordingDriver
+	query  string
+}
+
+func (s recordingStmt) Close() error { return nil }
+
+func (s recordingStmt) NumInput() int { return -1 }
+
+func (s recordingStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.driver.mu.Lock()
+	defer s.driver.mu.Unlock()
+	s.driver.statements = append(s.driver.statements, s.query)
+	return driver.RowsAffected(1), nil
+}
+
+func (s recordingStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return nil, errors.New("queries not supported")
+}
+
+var recordingDrivers atomic.Int32
+
+// newRecordingStore returns a SQLite SQLStore recording its statements.
+func newRecordingStore(t *testing.T) (*SQLStore, *recordingDriver) {
+	t.Helper()
+	d := &recordingDriver{}
+	name := "x402-recording-" + strconv.Itoa(int(recordingDrivers.Add(1)))
+	sql.Register(name, d)
+	db, err := sql.Open(name, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return NewSQLiteStore(db), d
+}
+
+func TestSQLStoreRecordsVerifiedTransactionOnce(t *testing.T) {
+	store, d := newRecordingStore(t)
+	ctx := context.Background()
+	if err := store.Migrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.RecordPayment(ctx, &PaymentRecord{TxHash: "tx1", Status: PaymentStatusVerified}); err != nil {
+		t.Fatal(err)
+	}
+
+	var index, insert string
+	for _, statement := range d.executed() {
+		switch {
+		case strings.Contains(statement, "x402_payments_verified_tx_hash"):
+			index = statement
+		case strings.HasPrefix(statement, "INSERT INTO x402_payments"):
+			insert = statement
+		}
+	}
+	if !strings.HasPrefix(index, "CREATE UNIQUE INDEX") || !strings.Contains(index, "(tx_hash) WHERE status = 'verified'") {
+		t.Errorf("Migrate() did not create a unique index on verified transaction hashes: %q", index)
+	}
+	if !strings.Contains(insert, "ON CONFLICT DO NOTHING") {
+		t.Errorf("RecordPayment() does not skip recorded transactions: %q", insert)
+	}
+}
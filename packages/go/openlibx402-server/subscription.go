@@ -0,0 +1,159 @@
+package serverx402
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/openlibx402/go/openlibx402-core"
+)
+
+// Subscription is a paid period of a subscription plan.
+type Subscription struct {
+	PaymentID string    `json:"payment_id"`
+	Payer     string    `json:"payer"`
+	Plan      string    `json:"plan"`
+	Amount    string    `json:"amount"`
+	TxHash    string    `json:"tx_hash,omitempty"`
+	StartsAt  time.Time `json:"starts_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// SubscriptionStore is implemented by payment stores that also record
+// subscriptions, which Options.Plans requires.
+type SubscriptionStore interface {
+	// RecordSubscription stores a paid subscription period.
+	RecordSubscription(ctx context.Context, subscription *Subscription) error
+	// LatestSubscription returns the subscription of payer to plan that
+	// expires last, or nil if there is none.
+	LatestSubscription(ctx context.Context, payer, plan string) (*Subscription, error)
+}
+
+// subscriptionClaims is the signed payload of a subscription token.
+type subscriptionClaims struct {
+	Plan  string `json:"s"`
+	Payer string `json:"p"`
+}
+
+// subscriptionStore returns the configured store if it records subscriptions.
+func (s *Server) subscriptionStore() SubscriptionStore {
+	store, _ := s.config().Store.(SubscriptionStore)
+	return store
+}
+
+// issueSubscriptionToken returns a token identifying payer as a subscriber
+// of plan. It does not expire: the subscription is looked up on each use.
+func (s *Server) issueSubscriptionToken(plan, payer string) string {
+	payload, _ := json.Marshal(subscriptionClaims{Plan: plan, Payer: payer})
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + s.signSession(encoded)
+}
+
+// checkSubscriptionToken returns the claims of a validly signed subscription
+// token.
+func (s *Server) checkSubscriptionToken(token string) (subscriptionClaims, bool) {
+	var claims subscriptionClaims
+	encoded, sig, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(s.signSession(encoded))) {
+		return claims, false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || json.Unmarshal(payload, &claims) != nil || claims.Plan == "" {
+		return claims, false
+	}
+	return claims, true
+}
+
+// subscriptionResult returns an allowed result if the request carries the
+// token of an active subscription to one of the resource's plans, or nil.
+func (s *Server) subscriptionResult(req Request, requirement *Requirement) *Result {
+	store := s.subscriptionStore()
+	if len(requirement.Plans) == 0 || store == nil {
+		return nil
+	}
+	token := req.Header(s.config().SubscriptionHeader)
+	if token == "" {
+		return nil
+	}
+	claims, ok := s.checkSubscriptionToken(token)
+	if !ok || findPlan(requirement.Plans, claims.Plan) == nil || s.IsFlagged(claims.Payer) {
+		return nil
+	}
+	subscription, err := store.LatestSubscription(req.Context, claims.Payer, claims.Plan)
+	if err != nil {
+		// Fall back to per-request pricing
+		s.logger.Error("x402: subscription lookup failed", core.LogKeyPayer, claims.Payer, "plan", claims.Plan, "error", err)
+		return nil
+	}
+	// Renewals start when the previous period ends, so the latest period
+	// covers every moment until it expires
+	if subscription == nil || !time.Now().Before(subscription.ExpiresAt) {
+		return nil
+	}
+	if result := s.checkPayer(req.Context, claims.Payer); result != nil {
+		return result
+	}
+	s.logger.Debug("x402: subscription accepted", core.LogKeyPayer, claims.Payer, "plan", claims.Plan, core.LogKeyResource, requirement.Resource)
+	return &Result{Requirement: requirement, Payer: claims.Payer, Subscription: subscription}
+}
+
+// applyPlan prices a request buying one of the resource's plans, named in
+// the plan header, at the plan's amount. It reports whether the request buys
+// a plan.
+func (s *Server) applyPlan(req Request, requirement *Requirement) bool {
+	plan := findPlan(requirement.Plans, req.Header(s.config().PlanHeader))
+	if plan == nil {
+		return false
+	}
+	requirement.Amount = plan.Amount
+	requirement.Plan = plan.ID
+	// The subscription replaces included requests
+	requirement.RequestsIncluded = 0
+	return true
+}
+
+// subscribe records the subscription period bought by a verified payment,
+// renewing the payer's subscription if it is still active, and returns its
+// token.
+func (s *Server) subscribe(ctx context.Context, requirement *Requirement, authorization *core.PaymentAuthorization) (*Subscription, string, error) {
+	store := s.subscriptionStore()
+	plan := findPlan(requirement.Plans, requirement.Plan)
+	start := time.Now().UTC()
+	latest, err := store.LatestSubscription(ctx, authorization.PublicKey, plan.ID)
+	if err != nil {
+		return nil, "", err
+	}
+	if latest != nil && latest.ExpiresAt.After(start) {
+		start = latest.ExpiresAt
+	}
+	subscription := &Subscription{
+		PaymentID: authorization.PaymentID,
+		Payer:     authorization.PublicKey,
+		Plan:      plan.ID,
+		Amount:    authorization.ActualAmount,
+		TxHash:    authorization.TransactionHash,
+		StartsAt:  start,
+		ExpiresAt: plan.Extend(start),
+	}
+	if err := store.RecordSubscription(ctx, subscription); err != nil {
+		return nil, "", err
+	}
+	s.logger.Info("x402: subscription purchased", core.LogKeyPayer, subscription.Payer, "plan", subscription.Plan, "expires_at", subscription.ExpiresAt)
+	return subscription, s.issueSubscriptionToken(plan.ID, subscription.Payer), nil
+}
+
+// findPlan returns the plan with an ID, or nil.
+func findPlan(plans []core.SubscriptionPlan, id string) *core.SubscriptionPlan {
+	if id == "" {
+		return nil
+	}
+	for i := range plans {
+		if plans[i].ID == id {
+			return &plans[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package serverx402
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/openlibx402/go/openlibx402-core"
+)
+
+// maxSweeps bounds the sweeps kept by Server.Sweeps.
+const maxSweeps = 1000
+
+// Sweep is a transfer of received tokens from the payment address to the
+// treasury (see Config.SweepTreasury).
+type Sweep struct {
+	Token           string    `json:"token"`
+	Amount          string    `json:"amount"`
+	From            string    `json:"from"`
+	To              string    `json:"to"`
+	TransactionHash string    `json:"transaction_hash,omitempty"`
+	Error           string    `json:"error,omitempty"` // Set if the transfer failed
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// sweeper periodically sweeps the payment address.
+type sweeper struct {
+	run  sync.Mutex // Serializes sweeps
+	stop chan struct{}
+	done chan struct{}
+
+	mu     sync.Mutex
+	sweeps []Sweep
+}
+
+// startSweeper starts sweeping every SweepInterval.
+func (s *Server) startSweeper() {
+	interval := s.config().SweepInterval
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	s.sweeper = &sweeper{stop: make(chan struct{}), done: make(chan struct{})}
+	go func() {
+		defer close(s.sweeper.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.sweeper.stop:
+				return
+			case <-ticker.C:
+				ctx, cancel := context.WithTimeout(context.Background(), interval)
+				// Failures are logged and reported
+				s.Sweep(ctx)
+				cancel()
+			}
+		}
+	}()
+}
+
+// stopSweeper stops the sweeper and waits for a sweep in progress.
+func (s *Server) stopSweeper() {
+	if s.sweeper == nil {
+		return
+	}
+	close(s.sweeper.stop)
+	<-s.sweeper.done
+}
+
+// Sweep transfers the balance of each swept token above SweepReserve from
+// the payment address to SweepTreasury, if it reaches SweepThreshold, and
+// returns the transfers it attempted. It runs on SweepInterval when
+// sweeping is configured, and may be called to sweep immediately.
+//
+// Each transfer is logged, kept for Server.Sweeps, sent to webhooks as
+// funds_swept, and passed to OnSweep. The returned error is that of the last
+// failed transfer.
+func (s *Server) Sweep(ctx context.Context) ([]Sweep, error) {
+	if s.sweeper == nil {
+		return nil, errors.New("sweeping is not configured: set Config.SweepTreasury and Config.SweepSigner")
+	}
+	s.sweeper.run.Lock()
+	defer s.sweeper.run.Unlock()
+
+	from := s.config().SweepSigner.PublicKey().String()
+	tokens := s.config().SweepTokens
+	if len(tokens) == 0 {
+		tokens = []string{s.config().TokenMint}
+	}
+	threshold := parseAmount(s.config().SweepThreshold)
+	reserve := parseAmount(s.config().SweepReserve)
+
+	var sweeps []Sweep
+	var lastErr error
+	for _, token := range tokens {
+		balance, err := s.processor.GetTokenBalance(ctx, from, token)
+		if err != nil {
+			s.logger.Error("x402: sweep balance lookup failed", "token", token, "error", err)
+			lastErr = err
+			continue
+		}
+		held := parseAmount(strconv.FormatFloat(balance, 'f', -1, 64))
+		amount := new(big.Rat).Sub(held, reserve)
+		if held.Sign() <= 0 || held.Cmp(threshold) < 0 || amount.Sign() <= 0 {
+			continue
+		}
+
+		sweep := Sweep{Token: token, Amount: formatAmount(amount), From: from, To: s.config().SweepTreasury}
+		sweep.TransactionHash, err = s.sendSweep(ctx, sweep)
+		sweep.CreatedAt = time.Now().UTC()
+		if err != nil {
+			sweep.Error = err.Error()
+			lastErr = err
+			s.logger.Error("x402: sweep failed", "token", token, core.LogKeyAmount, sweep.Amount, "error", err)
+		} else {
+			s.logger.Info("x402: swept payments to treasury", "token", token, core.LogKeyAmount, sweep.Amount, core.LogKeyTxHash, sweep.TransactionHash)
+		}
+		s.recordSweep(sweep)
+		sweeps = append(sweeps, sweep)
+	}
+	return sweeps, lastErr
+}
+
+// sendSweep builds, signs, and sends a sweep transfer.
+func (s *Server) sendSweep(ctx context.Context, sweep Sweep) (string, error) {
+	signer := s.config().SweepSigner
+	tx, err := s.processor.CreatePaymentTransactionFor(ctx, &core.PaymentRequest{
+		PaymentAddress: sweep.To,
+		AssetAddress:   sweep.Token,
+		Network:        s.config().Network,
+	}, sweep.Amount, signer.PublicKey())
+	if err != nil {
+		return "", err
+	}
+	return s.processor.SignAndSendTransactionWithSigner(ctx, tx, signer)
+}
+
+// recordSweep keeps a sweep for Sweeps and reports it.
+func (s *Server) recordSweep(sweep Sweep) {
+	s.sweeper.mu.Lock()
+	s.sweeper.sweeps = append(s.sweeper.sweeps, sweep)
+	if len(s.sweeper.sweeps) > maxSweeps {
+		s.sweeper.sweeps = s.sweeper.sweeps[len(s.sweeper.sweeps)-maxSweeps:]
+	}
+	s.sweeper.mu.Unlock()
+
+	s.emit(Event{Type: EventFundsSwept, Sweep: &sweep, Message: sweep.Error})
+	if s.config().OnSweep != nil {
+		s.config().OnSweep(sweep)
+	}
+}
+
+// Sweeps returns the most recent sweep transfers, oldest first, including
+// failed ones.
+func (s *Server) Sweeps() []Sweep {
+	if s.sweeper == nil {
+		return nil
+	}
+	s.sweeper.mu.Lock()
+	defer s.sweeper.mu.Unlock()
+	sweeps := make([]Sweep, len(s.sweeper.sweeps))
+	copy(sweeps, s.sweeper.sweeps)
+	return sweeps
+}
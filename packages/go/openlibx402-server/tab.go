@@ -0,0 +1,241 @@
+package serverx402
+
+import (
+	"context"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/openlibx402/go/openlibx402-core"
+)
+
+// Tab is a payer's running balance with a payment address in a token:
+// requests charged with vouchers, and payments settling them (see
+// Options.MaxOutstanding).
+type Tab struct {
+	ID             string    `json:"id"` // See core.TabID
+	Payer          string    `json:"payer"`
+	PaymentAddress string    `json:"payment_address"`
+	TokenMint      string    `json:"token_mint"`
+	Charged        string    `json:"charged"` // Amount of the latest accepted voucher
+	Settled        string    `json:"settled"` // Total of the settlement payments
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// Outstanding returns the unsettled balance of the tab.
+func (t *Tab) Outstanding() string {
+	return formatAmount(t.outstanding())
+}
+
+func (t *Tab) outstanding() *big.Rat {
+	return new(big.Rat).Sub(parseAmount(t.Charged), parseAmount(t.Settled))
+}
+
+// TabStore tracks the tabs of payers.
+//
+// Implementations must be safe for concurrent use.
+type TabStore interface {
+	// Tab returns a tab, or nil if the payer has not used it.
+	Tab(ctx context.Context, id string) (*Tab, error)
+	// Charge raises the amount charged to tab from tab.Charged to amount,
+	// creating the tab if it does not exist and tab.Charged is "0". It
+	// returns false if the amount charged changed, as when a concurrent
+	// voucher was accepted first.
+	Charge(ctx context.Context, tab *Tab, amount string) (bool, error)
+	// Settle adds a payment of amount to the tab, creating it if needed.
+	Settle(ctx context.Context, tab *Tab, amount string) error
+}
+
+// MemoryTabStore is an in-process TabStore. Tabs are never evicted, since
+// they hold what payers owe. Server instances sharing a load balancer need a
+// shared store, or a payer's outstanding balance is capped per instance.
+type MemoryTabStore struct {
+	mu   sync.Mutex
+	tabs map[string]*Tab
+	path string // State file set by PersistTo
+}
+
+// NewMemoryTabStore creates an empty in-memory tab store.
+func NewMemoryTabStore() *MemoryTabStore {
+	return &MemoryTabStore{tabs: make(map[string]*Tab)}
+}
+
+// Tab implements TabStore.
+func (s *MemoryTabStore) Tab(ctx context.Context, id string) (*Tab, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tab, ok := s.tabs[id]
+	if !ok {
+		return nil, nil
+	}
+	found := *tab
+	return &found, nil
+}
+
+// Charge implements TabStore.
+func (s *MemoryTabStore) Charge(ctx context.Context, tab *Tab, amount string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored := s.stored(tab)
+	if stored.Charged != tab.Charged {
+		return false, nil
+	}
+	stored.Charged = amount
+	stored.UpdatedAt = time.Now().UTC()
+	return true, nil
+}
+
+// Settle implements TabStore.
+func (s *MemoryTabStore) Settle(ctx context.Context, tab *Tab, amount string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored := s.stored(tab)
+	stored.Settled = formatAmount(new(big.Rat).Add(parseAmount(stored.Settled), parseAmount(amount)))
+	stored.UpdatedAt = time.Now().UTC()
+	return nil
+}
+
+// stored returns the stored tab, creating it from tab if needed. s.mu must
+// be held.
+func (s *MemoryTabStore) stored(tab *Tab) *Tab {
+	stored, ok := s.tabs[tab.ID]
+	if !ok {
+		stored = &Tab{ID: tab.ID, Payer: tab.Payer, PaymentAddress: tab.PaymentAddress, TokenMint: tab.TokenMint, Charged: "0", Settled: "0"}
+		s.tabs[tab.ID] = stored
+	}
+	return stored
+}
+
+// newTab returns the tab of a payer for a requirement, as the store will
+// create it.
+func newTab(payer string, requirement *Requirement) *Tab {
+	return &Tab{
+		ID:             core.TabID(payer, requirement.PaymentAddress, requirement.TokenMint),
+		Payer:          payer,
+		PaymentAddress: requirement.PaymentAddress,
+		TokenMint:      requirement.TokenMint,
+		Charged:        "0",
+		Settled:        "0",
+	}
+}
+
+// lookupTab returns the stored tab of a payer for a requirement, or a new one.
+func (s *Server) lookupTab(ctx context.Context, payer string, requirement *Requirement) (*Tab, error) {
+	tab := newTab(payer, requirement)
+	stored, err := s.config().TabStore.Tab(ctx, tab.ID)
+	if err != nil || stored == nil {
+		return tab, err
+	}
+	return stored, nil
+}
+
+// tabResult returns an allowed result if the request carries a voucher that
+// charges the price to the payer's tab within Options.MaxOutstanding, or
+// nil. If the charge would exceed the cap, or the voucher asks to settle
+// with Close, it returns a 402 result whose payment request settles the
+// outstanding balance along with the price. Stale vouchers get a 402 result
+// reporting the amount charged to the tab.
+func (s *Server) tabResult(req Request, requirement *Requirement) *Result {
+	if requirement.MaxOutstanding == "" {
+		return nil
+	}
+	header := req.Header(s.config().VoucherHeader)
+	if header == "" {
+		return nil
+	}
+	voucher, err := core.VoucherFromHeader(header)
+	if err != nil {
+		return reject(http.StatusBadRequest, "INVALID_PAYMENT_REQUEST", "Invalid payment voucher", map[string]interface{}{
+			"message": err.Error(),
+		})
+	}
+	if voucher.ChannelID != core.TabID(voucher.PublicKey, requirement.PaymentAddress, requirement.TokenMint) {
+		// A voucher for another tab or a payment channel
+		return nil
+	}
+	if err := voucher.Verify(); err != nil {
+		return reject(http.StatusForbidden, "PAYMENT_VERIFICATION_FAILED", "Invalid payment voucher", map[string]interface{}{
+			"message": err.Error(),
+		})
+	}
+	if s.IsFlagged(voucher.PublicKey) {
+		return nil
+	}
+
+	tab, err := s.lookupTab(req.Context, voucher.PublicKey, requirement)
+	if err != nil {
+		// Fall back to requiring payment
+		s.logger.Error("x402: tab lookup failed", core.LogKeyPayer, voucher.PublicKey, "error", err)
+		return nil
+	}
+	amount := parseAmount(voucher.Amount)
+	charge := new(big.Rat).Sub(amount, parseAmount(tab.Charged))
+	outstanding := new(big.Rat).Sub(amount, parseAmount(tab.Settled))
+	if (voucher.Close || outstanding.Cmp(parseAmount(requirement.MaxOutstanding)) > 0) && tab.outstanding().Sign() > 0 {
+		return s.tabPaymentRequired(req, requirement, tab, true)
+	}
+	if charge.Cmp(parseAmount(requirement.Amount)) < 0 || outstanding.Cmp(parseAmount(requirement.MaxOutstanding)) > 0 {
+		// A stale voucher, or a price beyond the cap
+		return s.tabPaymentRequired(req, requirement, tab, false)
+	}
+	if result := s.checkPayer(req.Context, tab.Payer); result != nil {
+		return result
+	}
+	charged, err := s.config().TabStore.Charge(req.Context, tab, voucher.Amount)
+	if err != nil {
+		s.logger.Error("x402: failed to charge tab", core.LogKeyPayer, tab.Payer, core.LogKeyAmount, voucher.Amount, "error", err)
+		return nil
+	}
+	if !charged {
+		// A concurrent voucher was accepted first
+		if tab, err = s.lookupTab(req.Context, voucher.PublicKey, requirement); err != nil {
+			return nil
+		}
+		return s.tabPaymentRequired(req, requirement, tab, false)
+	}
+	s.logger.Debug("x402: charged to tab", core.LogKeyPayer, tab.Payer, core.LogKeyResource, requirement.Resource, core.LogKeyAmount, formatAmount(charge), "outstanding", formatAmount(outstanding))
+	return &Result{Requirement: requirement, Payer: tab.Payer, TabOutstanding: formatAmount(outstanding)}
+}
+
+// tabPaymentRequired returns a 402 result answering a voucher, whose
+// payment request reports the amount charged to the tab. If settle is set,
+// it also includes the outstanding balance of the tab.
+func (s *Server) tabPaymentRequired(req Request, requirement *Requirement, tab *Tab, settle bool) *Result {
+	priced := *requirement
+	priced.TabCharged = tab.Charged
+	message := "Payment is required to access this resource"
+	if settle {
+		outstanding := tab.outstanding()
+		priced.Amount = formatAmount(new(big.Rat).Add(parseAmount(requirement.Amount), outstanding))
+		priced.TabOutstanding = formatAmount(outstanding)
+		message = "Payment of the outstanding tab is required to access this resource"
+	}
+	paymentReq, err := s.IssuePaymentRequest(req.Context, &priced)
+	if err != nil {
+		return reject(http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", "Payment requests are temporarily unavailable", nil)
+	}
+	return &Result{
+		Status:         http.StatusPaymentRequired,
+		Code:           "PAYMENT_REQUIRED",
+		Message:        message,
+		PaymentRequest: paymentReq,
+		Requirement:    &priced,
+	}
+}
+
+// creditTab settles a payer's tab with what a verified payment paid beyond
+// the price of the request, and returns the outstanding balance.
+func (s *Server) creditTab(ctx context.Context, requirement *Requirement, authorization *core.PaymentAuthorization) (string, error) {
+	credit := new(big.Rat).Sub(parseAmount(authorization.ActualAmount), parseAmount(requirement.Amount))
+	tab, err := s.lookupTab(ctx, authorization.PublicKey, requirement)
+	if err != nil || credit.Sign() <= 0 {
+		return "", err
+	}
+	if err := s.config().TabStore.Settle(ctx, tab, formatAmount(credit)); err != nil {
+		return "", err
+	}
+	outstanding := new(big.Rat).Sub(tab.outstanding(), credit)
+	s.logger.Info("x402: tab settled", core.LogKeyPayer, tab.Payer, core.LogKeyAmount, formatAmount(credit), "outstanding", formatAmount(outstanding))
+	return formatAmount(outstanding), nil
+}
@@ -0,0 +1,72 @@
+package serverx402
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/openlibx402/go/openlibx402-core"
+)
+
+// checkTokens checks the token mints of a requirement against the core token
+// registry (see core.ValidateTokenMint). A mint registered on another
+// network only is a configuration error; so is, with Config.StrictTokens, a
+// mint that is not registered, or whose on-chain decimals differ from the
+// registry's. Checked mints are remembered, so mints are read once.
+func (s *Server) checkTokens(ctx context.Context, requirement *Requirement) *Result {
+	mints := []string{requirement.TokenMint}
+	for _, price := range requirement.AcceptedTokens {
+		mints = append(mints, price.AssetAddress)
+	}
+	for _, mint := range mints {
+		key := requirement.Network + "/" + mint
+		if _, ok := s.checkedTokens.Load(key); ok {
+			continue
+		}
+		err := s.checkToken(ctx, requirement.Network, mint)
+		if errors.Is(err, errTokenUnchecked) {
+			continue
+		}
+		if err != nil {
+			s.logger.Error("x402: invalid token mint", "mint", mint, core.LogKeyNetwork, requirement.Network, "error", err)
+			return reject(http.StatusInternalServerError, "CONFIGURATION_ERROR", err.Error(), nil)
+		}
+		s.checkedTokens.Store(key, struct{}{})
+	}
+	return nil
+}
+
+// errTokenUnchecked reports that a mint could not be read and should be
+// checked again later.
+var errTokenUnchecked = errors.New("token mint unchecked")
+
+// checkToken checks a mint of a network.
+func (s *Server) checkToken(ctx context.Context, network, mint string) error {
+	err := core.ValidateTokenMint(network, mint)
+	if errors.Is(err, core.ErrUnknownToken) && !s.config().StrictTokens {
+		return nil
+	}
+	if err != nil || !s.config().StrictTokens {
+		return err
+	}
+
+	inspector, ok := s.processor.(core.MintInspector)
+	if !ok {
+		return nil
+	}
+	token, _ := core.LookupMint(network, mint)
+	decimals, err := inspector.MintDecimals(ctx, mint)
+	if err != nil {
+		if core.IsTransientRPCError(err) {
+			// Serve the request rather than fail it on an RPC outage
+			s.logger.Warn("x402: token mint unavailable", "mint", mint, core.LogKeyNetwork, network, "error", err)
+			return errTokenUnchecked
+		}
+		return err
+	}
+	if decimals != token.Decimals {
+		return fmt.Errorf("token mint %s has %d decimals, but %s on %s has %d", mint, decimals, token.Symbol, network, token.Decimals)
+	}
+	return nil
+}
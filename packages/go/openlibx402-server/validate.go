@@ -0,0 +1,131 @@
+package serverx402
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/openlibx402/go/openlibx402-core"
+)
+
+// LocalNetwork is the network name of local test validators, which have no
+// well-known genesis hash.
+const LocalNetwork = "solana-localnet"
+
+// Validate checks a Config for mistakes that would otherwise only surface
+// on the first paid request: malformed addresses and mints, unknown
+// networks, RPC URLs of the wrong scheme, and options that require or
+// exclude each other. It reports every problem found, each naming its field.
+// Empty fields pass, as New applies their defaults, and PaymentAddress and
+// TokenMint may be set per resource instead (see Options).
+func (c *Config) Validate() error {
+	var errs []error
+	fail := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	checkAddress := func(field, address string) {
+		if address == "" {
+			return
+		}
+		if _, err := solana.PublicKeyFromBase58(address); err != nil {
+			fail("%s %q is not a base58 Solana address: %v", field, address, err)
+		}
+	}
+	checkAddress("PaymentAddress", c.PaymentAddress)
+	checkAddress("TokenMint", c.TokenMint)
+	checkAddress("SweepTreasury", c.SweepTreasury)
+	for _, mint := range c.SweepTokens {
+		checkAddress("SweepTokens", mint)
+	}
+	for _, payer := range c.DeferredPayers {
+		checkAddress("DeferredPayers", payer)
+	}
+
+	if c.Network != "" && c.Network != LocalNetwork && core.GenesisHash(c.Network) == "" {
+		fail("Network %q is unknown (use solana-mainnet, solana-devnet, solana-testnet, or %s)", c.Network, LocalNetwork)
+	}
+	if c.Network != "" && c.TokenMint != "" {
+		if err := core.ValidateTokenMint(c.Network, c.TokenMint); err != nil && !errors.Is(err, core.ErrUnknownToken) {
+			fail("TokenMint: %v", err)
+		}
+	}
+
+	checkURL := func(field, rawURL string, schemes ...string) {
+		if rawURL == "" {
+			return
+		}
+		parsed, err := url.Parse(rawURL)
+		if err != nil {
+			fail("%s %q is not a URL: %v", field, rawURL, err)
+			return
+		}
+		for _, scheme := range schemes {
+			if parsed.Scheme == scheme && parsed.Host != "" {
+				return
+			}
+		}
+		fail("%s %q must be a URL with scheme %s and a host", field, rawURL, strings.Join(schemes, " or "))
+	}
+	checkURL("RPCURL", c.RPCURL, "https", "http")
+	for _, rpcURL := range c.RPCURLs {
+		checkURL("RPCURLs", rpcURL, "https", "http")
+	}
+	checkURL("RPCWebSocketURL", c.RPCWebSocketURL, "wss", "ws")
+	checkURL("PaywallRPCURL", c.PaywallRPCURL, "https", "http")
+
+	switch c.Commitment {
+	case "", core.CommitmentProcessed, core.CommitmentConfirmed, core.CommitmentFinalized:
+	default:
+		fail("Commitment %q is invalid (use processed, confirmed, or finalized)", c.Commitment)
+	}
+
+	if c.AsyncSettlement && !c.AutoVerify {
+		fail("AsyncSettlement requires AutoVerify")
+	}
+	if c.AsyncSettlement && !c.RequireAttestation {
+		// Otherwise a failed settlement flags whichever payer the header claims
+		fail("AsyncSettlement requires RequireAttestation")
+	}
+	if c.SolanaPay && !c.AutoVerify {
+		fail("SolanaPay requires AutoVerify")
+	}
+	if c.SolanaPay && c.NonceStore == nil {
+		fail("SolanaPay requires a NonceStore")
+	}
+	if c.PaywallQRCode && !c.SolanaPay {
+		fail("PaywallQRCode requires SolanaPay")
+	}
+	if c.Lightning != nil && c.NonceStore == nil {
+		fail("Lightning requires a NonceStore")
+	}
+	if (c.SweepTreasury == "") != (c.SweepSigner == nil) {
+		fail("SweepTreasury and SweepSigner must be set together")
+	}
+	if c.PayerRateLimit.RequestsPerSecond < 0 || c.PayerRateLimit.Burst < 0 {
+		fail("PayerRateLimit must not be negative")
+	}
+	for _, setting := range []struct {
+		field string
+		value int64
+	}{
+		{"SettlementWorkers", int64(c.SettlementWorkers)},
+		{"MaxDeferredDebts", int64(c.MaxDeferredDebts)},
+		{"QuoteDecimals", int64(c.QuoteDecimals)},
+		{"SessionTTL", int64(c.SessionTTL)},
+		{"NonceTTL", int64(c.NonceTTL)},
+		{"MaxAuthorizationAge", int64(c.MaxAuthorizationAge)},
+		{"MaxClockSkew", int64(c.MaxClockSkew)},
+	} {
+		if setting.value < 0 {
+			fail("%s must not be negative", setting.field)
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("invalid x402 config: %w", errors.Join(errs...))
+}
@@ -0,0 +1,58 @@
+package serverx402
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+func TestValidateAsyncSettlementRequiresAttestation(t *testing.T) {
+	config := &Config{AutoVerify: true, AsyncSettlement: true}
+	err := config.Validate()
+	if err == nil || !strings.Contains(err.Error(), "AsyncSettlement requires RequireAttestation") {
+		t.Fatalf("Validate() = %v, want AsyncSettlement requires RequireAttestation", err)
+	}
+
+	config.RequireAttestation = true
+	if err := config.Validate(); err != nil {
+		t.Errorf("Validate() with RequireAttestation = %v, want nil", err)
+	}
+}
+
+func TestValidateReportsEveryProblem(t *testing.T) {
+	config := &Config{PaymentAddress: "not-base58!", SolanaPay: true, NonceTTL: -1}
+	err := config.Validate()
+	if err == nil {
+		t.Fatal("Validate() = nil, want errors")
+	}
+	for _, want := range []string{"PaymentAddress", "SolanaPay requires AutoVerify", "SolanaPay requires a NonceStore", "NonceTTL must not be negative"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Validate() = %v, want it to report %q", err, want)
+		}
+	}
+}
+
+func TestNewRejectsRequestsWithInvalidConfig(t *testing.T) {
+	s, _ := newTestServer(t, &Config{AutoVerify: true, AsyncSettlement: true})
+	opts := Options{Amount: "0.10"}
+
+	if result := s.Process(testRequest("/data", nil), opts); result.Code != "CONFIGURATION_ERROR" {
+		t.Fatalf("got %d %s, want CONFIGURATION_ERROR", result.Status, result.Code)
+	}
+}
+
+func TestReloadClearsInvalidConfig(t *testing.T) {
+	s, _ := newTestServer(t, &Config{PaymentAddress: "not-base58!"})
+	opts := Options{Amount: "0.10"}
+
+	if result := s.Process(testRequest("/data", nil), opts); result.Code != "CONFIGURATION_ERROR" {
+		t.Fatalf("got %d %s, want CONFIGURATION_ERROR", result.Status, result.Code)
+	}
+	if err := s.Reload(&Config{PaymentAddress: solana.NewWallet().PublicKey().String()}); err != nil {
+		t.Fatal(err)
+	}
+	if result := s.Process(testRequest("/data", nil), opts); result.Code != "PAYMENT_REQUIRED" {
+		t.Errorf("after Reload: got %d %s, want PAYMENT_REQUIRED", result.Status, result.Code)
+	}
+}
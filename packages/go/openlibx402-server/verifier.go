@@ -0,0 +1,199 @@
+package serverx402
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/openlibx402/go/openlibx402-core"
+)
+
+// Verifier is a stage of payment verification. Once the payment
+// authorization header is decoded, the stages of Config.Verifiers run in
+// order; the first to reject the payment stops the chain.
+//
+// Implementations must be safe for concurrent use.
+type Verifier interface {
+	// Verify returns a result rejecting the payment, or nil to pass it to
+	// the next stage.
+	Verify(ctx context.Context, v *Verification) *Result
+}
+
+// VerifierFunc adapts a function to a Verifier. For example, a stage
+// checking an internal ledger before the RPC node is called:
+//
+//	ledgerCheck := serverx402.VerifierFunc(func(ctx context.Context, v *serverx402.Verification) *serverx402.Result {
+//	    if ledger.Refunded(ctx, v.Authorization.TransactionHash) {
+//	        return &serverx402.Result{Status: http.StatusForbidden, Code: "PAYMENT_REFUNDED", Message: "Payment was refunded"}
+//	    }
+//	    return nil
+//	})
+//	config.Verifiers = []serverx402.Verifier{
+//	    serverx402.SchemaVerifier,
+//	    serverx402.TimestampVerifier,
+//	    serverx402.IssuedVerifier,
+//	    serverx402.AmountVerifier,
+//	    serverx402.AddressVerifier,
+//	    ledgerCheck,
+//	    serverx402.ChainVerifier,
+//	}
+type VerifierFunc func(ctx context.Context, v *Verification) *Result
+
+// Verify implements Verifier.
+func (f VerifierFunc) Verify(ctx context.Context, v *Verification) *Result {
+	return f(ctx, v)
+}
+
+// Verification is a payment going through the Verifier stages.
+type Verification struct {
+	Requirement *Requirement
+	// Authorization is the payment authorization. ChainVerifier replaces it
+	// with one holding the amount transferred on-chain.
+	Authorization *core.PaymentAuthorization
+	// Verified reports whether the transaction was verified on-chain.
+	Verified bool
+
+	server *Server
+	settle bool // Verify on-chain in a settlement worker once the chain passes
+}
+
+// The built-in Verifier stages, in the order of DefaultVerifiers.
+var (
+	// SchemaVerifier rejects authorizations missing the payment ID or payer,
+	// or the transaction hash if Config.AutoVerify is set, or whose amount
+	// is not a decimal number.
+	SchemaVerifier Verifier = VerifierFunc(verifySchema)
+	// TimestampVerifier rejects authorizations older than
+	// Config.MaxAuthorizationAge or dated in the future.
+	TimestampVerifier Verifier = VerifierFunc(func(ctx context.Context, v *Verification) *Result {
+		return v.server.checkTimestamp(v.Authorization)
+	})
+	// IssuedVerifier rejects authorizations that do not match a payment
+	// request issued by the server, if Config.NonceStore is set.
+	IssuedVerifier Verifier = VerifierFunc(func(ctx context.Context, v *Verification) *Result {
+		return v.server.checkIssued(ctx, v.Requirement, v.Authorization)
+	})
+	// AmountVerifier rejects authorizations claiming less than the price,
+	// compared exactly, or an amount that is not a decimal number.
+	AmountVerifier Verifier = VerifierFunc(verifyAmount)
+	// AddressVerifier rejects payments to another address, in another
+	// token, or on another network than required.
+	AddressVerifier Verifier = VerifierFunc(verifyAddress)
+	// ChainVerifier verifies the transaction on-chain if Config.AutoVerify
+	// is set. With Config.AsyncSettlement it is verified in the background
+	// once the other stages pass.
+	ChainVerifier Verifier = VerifierFunc(func(ctx context.Context, v *Verification) *Result {
+		return v.server.verifyChain(ctx, v)
+	})
+)
+
+// DefaultVerifiers returns the stages Config.Verifiers defaults to, as a new
+// slice that can be extended or reordered.
+func DefaultVerifiers() []Verifier {
+	return []Verifier{SchemaVerifier, TimestampVerifier, IssuedVerifier, AmountVerifier, AddressVerifier, ChainVerifier}
+}
+
+func verifySchema(ctx context.Context, v *Verification) *Result {
+	var missing string
+	switch {
+	case v.Authorization.PaymentID == "":
+		missing = "payment_id"
+	case v.Authorization.PublicKey == "":
+		missing = "public_key"
+	}
+	if missing != "" {
+		return reject(http.StatusBadRequest, "INVALID_PAYMENT_REQUEST", "Invalid payment authorization", map[string]interface{}{
+			"message": "missing " + missing,
+		})
+	}
+	// Without a transaction there is nothing to verify on-chain, so nothing
+	// was paid
+	if v.Authorization.TransactionHash == "" && v.server.config().AutoVerify {
+		return reject(http.StatusPaymentRequired, "PAYMENT_REQUIRED", "Invalid payment authorization", map[string]interface{}{
+			"message": "missing transaction_hash",
+		})
+	}
+	if !validAmount(v.Authorization.ActualAmount) {
+		return reject(http.StatusBadRequest, "INVALID_PAYMENT_REQUEST", "Invalid payment authorization", map[string]interface{}{
+			"message": "invalid actual_amount: " + v.Authorization.ActualAmount,
+		})
+	}
+	return nil
+}
+
+func verifyAmount(ctx context.Context, v *Verification) *Result {
+	// Custom chains may run without SchemaVerifier
+	if !validAmount(v.Authorization.ActualAmount) {
+		return reject(http.StatusBadRequest, "INVALID_PAYMENT_REQUEST", "Invalid payment authorization", map[string]interface{}{
+			"message": "invalid actual_amount: " + v.Authorization.ActualAmount,
+		})
+	}
+	if !validAmount(v.Requirement.Amount) {
+		return reject(http.StatusInternalServerError, "CONFIGURATION_ERROR", "invalid amount: "+v.Requirement.Amount, nil)
+	}
+	if core.CompareAmounts(v.Authorization.ActualAmount, v.Requirement.Amount) < 0 {
+		return reject(http.StatusForbidden, "PAYMENT_VERIFICATION_FAILED", "Insufficient payment", map[string]interface{}{
+			"required": v.Requirement.Amount,
+			"provided": v.Authorization.ActualAmount,
+		})
+	}
+	return nil
+}
+
+func verifyAddress(ctx context.Context, v *Verification) *Result {
+	requirement, authorization := v.Requirement, v.Authorization
+	if authorization.PaymentAddress != requirement.PaymentAddress {
+		return reject(http.StatusForbidden, "PAYMENT_VERIFICATION_FAILED", "Payment address mismatch", map[string]interface{}{
+			"expected": requirement.PaymentAddress,
+			"provided": authorization.PaymentAddress,
+		})
+	}
+	if authorization.AssetAddress != requirement.TokenMint {
+		return reject(http.StatusForbidden, "PAYMENT_VERIFICATION_FAILED", "Token mint mismatch", map[string]interface{}{
+			"expected": requirement.TokenMint,
+			"provided": authorization.AssetAddress,
+		})
+	}
+	// The payment must have been made on the network it is verified on
+	if authorization.Network != requirement.Network {
+		return reject(http.StatusForbidden, "PAYMENT_VERIFICATION_FAILED", "Network mismatch", map[string]interface{}{
+			"expected": requirement.Network,
+			"provided": authorization.Network,
+		})
+	}
+	return nil
+}
+
+// verifyChain verifies a transaction on-chain for ChainVerifier, or marks it
+// for asynchronous settlement.
+func (s *Server) verifyChain(ctx context.Context, v *Verification) *Result {
+	if !s.config().AutoVerify || v.Verified {
+		return nil
+	}
+	// Stepped-up payments are not served before they reach their commitment
+	if s.settlement != nil && v.Requirement.Commitment == "" && !v.settle {
+		v.settle = true
+		return nil
+	}
+	verified, result := s.verifyOnChain(ctx, v.Requirement, v.Authorization)
+	if result != nil {
+		return result
+	}
+	if v.Requirement.Commitment != "" {
+		if err := s.processor.WaitForConfirmation(ctx, v.Authorization.TransactionHash, v.Requirement.Commitment); err != nil {
+			return reject(http.StatusForbidden, "PAYMENT_VERIFICATION_FAILED", "Payment verification failed", map[string]interface{}{
+				"message":    err.Error(),
+				"commitment": v.Requirement.Commitment,
+			})
+		}
+	}
+	v.Authorization, v.Verified = verified, true
+	return nil
+}
+
+// verifiers returns the configured verification stages.
+func (s *Server) verifiers() []Verifier {
+	if verifiers := s.config().Verifiers; verifiers != nil {
+		return verifiers
+	}
+	return DefaultVerifiers()
+}
@@ -0,0 +1,80 @@
+package serverx402
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/openlibx402/go/openlibx402-core"
+)
+
+func TestSchemaVerifierRequiresTransactionHash(t *testing.T) {
+	s, _ := newTestServer(t, &Config{AutoVerify: true, NonceStore: NewMemoryNonceStore(0)})
+	opts := Options{Amount: "1.00"}
+
+	paymentReq := issue(t, s, "/data", opts)
+	header := authorize(t, &core.PaymentAuthorization{
+		PaymentID:      paymentReq.PaymentID,
+		ActualAmount:   "1.00",
+		PaymentAddress: paymentReq.PaymentAddress,
+		AssetAddress:   paymentReq.AssetAddress,
+		Network:        paymentReq.Network,
+		Timestamp:      time.Now().UTC(),
+		PublicKey:      solana.NewWallet().PublicKey().String(),
+	})
+	result := paid(s, "/data", header, opts)
+	if result.Allowed() {
+		t.Fatal("authorization without a transaction hash was allowed")
+	}
+	if result.Status != http.StatusPaymentRequired || result.Details["message"] != "missing transaction_hash" {
+		t.Errorf("got %d %v, want 402 missing transaction_hash", result.Status, result.Details)
+	}
+}
+
+func TestSchemaVerifierWithoutAutoVerify(t *testing.T) {
+	s, _ := newTestServer(t, &Config{})
+	opts := Options{Amount: "1.00"}
+
+	paymentReq := issue(t, s, "/data", opts)
+	header := authorize(t, &core.PaymentAuthorization{
+		PaymentID:      paymentReq.PaymentID,
+		ActualAmount:   "1.00",
+		PaymentAddress: paymentReq.PaymentAddress,
+		AssetAddress:   paymentReq.AssetAddress,
+		Network:        paymentReq.Network,
+		Timestamp:      time.Now().UTC(),
+		PublicKey:      solana.NewWallet().PublicKey().String(),
+	})
+	// Verifying the transaction is left to the application
+	if result := paid(s, "/data", header, opts); !result.Allowed() {
+		t.Errorf("got %d %s, want allowed", result.Status, result.Code)
+	}
+}
+
+func TestAmountVerifier(t *testing.T) {
+	for _, tc := range []struct {
+		required, actual, code string
+	}{
+		{"0.10", "0.10", ""},
+		{"0.10", "0.1000001", ""},
+		// Amounts apart by less than a float64 can tell
+		{"0.100000000000000002", "0.100000000000000001", "PAYMENT_VERIFICATION_FAILED"},
+		{"0.10", "ten cents", "INVALID_PAYMENT_REQUEST"},
+		{"0.10", "", "INVALID_PAYMENT_REQUEST"},
+		{"ten cents", "0.10", "CONFIGURATION_ERROR"},
+	} {
+		result := AmountVerifier.Verify(context.Background(), &Verification{
+			Requirement:   &Requirement{Amount: tc.required},
+			Authorization: &core.PaymentAuthorization{ActualAmount: tc.actual},
+		})
+		var code string
+		if result != nil {
+			code = result.Code
+		}
+		if code != tc.code {
+			t.Errorf("required %q, paid %q: got %q, want %q", tc.required, tc.actual, code, tc.code)
+		}
+	}
+}
@@ -0,0 +1,337 @@
+package serverx402
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/openlibx402/go/openlibx402-core"
+)
+
+// Payment event types sent to webhooks.
+const (
+	EventPaymentRequiredIssued = "payment_required_issued"
+	EventPaymentVerified       = "payment_verified"
+	EventPaymentFailed         = "payment_failed"
+	EventPaymentExpired        = "payment_expired"
+	EventPaymentRefunded       = "payment_refunded"
+	EventPaymentDeferred       = "payment_deferred"
+	EventPaymentDefaulted      = "payment_defaulted"
+	EventFundsSwept            = "funds_swept"
+)
+
+// WebhookSignatureHeader carries the HMAC signature of a webhook delivery.
+//
+// The value has the form "t=<unix timestamp>,v1=<hex HMAC-SHA256>", where the
+// HMAC is computed with the webhook secret over "<timestamp>.<body>".
+const WebhookSignatureHeader = "X-X402-Signature"
+
+// Event is a payment event delivered to webhooks as JSON.
+type Event struct {
+	ID             string                     `json:"id"`
+	Type           string                     `json:"type"`
+	CreatedAt      time.Time                  `json:"created_at"`
+	Resource       string                     `json:"resource,omitempty"`
+	PaymentRequest *core.PaymentRequest       `json:"payment_request,omitempty"`
+	Authorization  *core.PaymentAuthorization `json:"authorization,omitempty"`
+	Refund         *core.Refund               `json:"refund,omitempty"`
+	Sweep          *Sweep                     `json:"sweep,omitempty"`
+	Message        string                     `json:"message,omitempty"`
+}
+
+// WebhookOptions configures a WebhookDispatcher.
+type WebhookOptions struct {
+	URLs       []string      // Endpoints receiving every event
+	Secret     string        // HMAC secret used to sign deliveries
+	MaxRetries int           // Retries per delivery after the first attempt (default: 3)
+	Backoff    time.Duration // Initial retry delay, doubled on each retry (default: 1 second)
+	Workers    int           // Concurrent deliveries (default: 2)
+	HTTPClient *http.Client  // HTTP client for deliveries (default: 10 second timeout)
+	Logger     *slog.Logger  // Logs failed deliveries (default: discard)
+
+	// OnError is called when a delivery fails after all retries.
+	OnError func(url string, event Event, err error)
+}
+
+// webhookDelivery is an event queued for one URL.
+type webhookDelivery struct {
+	url   string
+	event Event
+}
+
+// WebhookDispatcher POSTs signed payment events to configured URLs in the
+// background, retrying failed deliveries with exponential backoff.
+type WebhookDispatcher struct {
+	opts       WebhookOptions
+	deliveries chan webhookDelivery
+	done       chan struct{} // Closed by Close to cancel retries
+	wg         sync.WaitGroup
+	mu         sync.RWMutex
+	closed     bool
+}
+
+// NewWebhookDispatcher creates a dispatcher and starts its delivery workers.
+//
+// Usage:
+//
+//	webhooks := serverx402.NewWebhookDispatcher(serverx402.WebhookOptions{
+//	    URLs:   []string{"https://billing.example.com/x402"},
+//	    Secret: os.Getenv("X402_WEBHOOK_SECRET"),
+//	})
+//	defer webhooks.Close()
+func NewWebhookDispatcher(opts WebhookOptions) *WebhookDispatcher {
+	if opts.MaxRetries == 0 {
+		opts.MaxRetries = 3
+	}
+	if opts.Backoff == 0 {
+		opts.Backoff = time.Second
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = 2
+	}
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	opts.Logger = core.LoggerOrDiscard(opts.Logger)
+
+	d := &WebhookDispatcher{
+		opts:       opts,
+		deliveries: make(chan webhookDelivery, 1024),
+		done:       make(chan struct{}),
+	}
+	for i := 0; i < opts.Workers; i++ {
+		d.wg.Add(1)
+		go func() {
+			defer d.wg.Done()
+			for delivery := range d.deliveries {
+				d.deliver(delivery)
+			}
+		}()
+	}
+	return d
+}
+
+// Dispatch queues an event for delivery to every URL. It does not block; if
+// the queue is full the delivery is dropped and reported to OnError.
+func (d *WebhookDispatcher) Dispatch(event Event) {
+	if event.ID == "" {
+		event.ID = generateID()
+	}
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now().UTC()
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.closed {
+		return
+	}
+	for _, url := range d.opts.URLs {
+		select {
+		case d.deliveries <- webhookDelivery{url: url, event: event}:
+		default:
+			d.opts.Logger.Error("x402: webhook queue full, event dropped", "event_id", event.ID, "type", event.Type, "url", url)
+			if d.opts.OnError != nil {
+				d.opts.OnError(url, event, fmt.Errorf("webhook queue is full"))
+			}
+		}
+	}
+}
+
+// Close stops accepting events and waits for queued deliveries to finish.
+// Queued deliveries are still attempted, but failed ones are not retried:
+// they are reported to OnError instead, so that Close does not wait out the
+// backoff.
+func (d *WebhookDispatcher) Close() error {
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return nil
+	}
+	d.closed = true
+	close(d.done)
+	close(d.deliveries)
+	d.mu.Unlock()
+
+	d.wg.Wait()
+	return nil
+}
+
+// deliver sends one event to one URL, retrying with exponential backoff
+// until the dispatcher is closed.
+func (d *WebhookDispatcher) deliver(delivery webhookDelivery) {
+	body, err := json.Marshal(delivery.event)
+	if err != nil {
+		d.opts.Logger.Error("x402: failed to encode webhook event", "event_id", delivery.event.ID, "error", err)
+		if d.opts.OnError != nil {
+			d.opts.OnError(delivery.url, delivery.event, err)
+		}
+		return
+	}
+
+	backoff := d.opts.Backoff
+	for attempt := 0; ; attempt++ {
+		err = d.post(delivery.url, body)
+		if err == nil {
+			return
+		}
+		if attempt >= d.opts.MaxRetries {
+			break
+		}
+		d.opts.Logger.Debug("x402: webhook delivery failed, retrying", "event_id", delivery.event.ID, "url", delivery.url, "attempt", attempt+1, "error", err)
+		if !d.wait(backoff) {
+			break
+		}
+		backoff *= 2
+	}
+
+	d.opts.Logger.Error("x402: webhook delivery failed", "event_id", delivery.event.ID, "type", delivery.event.Type, "url", delivery.url, "error", err)
+	if d.opts.OnError != nil {
+		d.opts.OnError(delivery.url, delivery.event, err)
+	}
+}
+
+// wait waits for delay, reporting false if the dispatcher is closed first.
+func (d *WebhookDispatcher) wait(delay time.Duration) bool {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-d.done:
+		return false
+	}
+}
+
+// post makes a single signed delivery attempt.
+func (d *WebhookDispatcher) post(url string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if d.opts.Secret != "" {
+		req.Header.Set(WebhookSignatureHeader, SignWebhook(d.opts.Secret, time.Now(), body))
+	}
+
+	resp, err := d.opts.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// SignWebhook computes the WebhookSignatureHeader value for a delivery body.
+func SignWebhook(secret string, timestamp time.Time, body []byte) string {
+	ts := strconv.FormatInt(timestamp.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts + "."))
+	mac.Write(body)
+	return "t=" + ts + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyWebhookSignature checks a WebhookSignatureHeader value against the
+// body, rejecting signatures older than tolerance (0 disables the check).
+// Receivers use it to authenticate deliveries.
+func VerifyWebhookSignature(secret, header string, body []byte, tolerance time.Duration) error {
+	var ts, sig string
+	for _, part := range bytes.Split([]byte(header), []byte(",")) {
+		if kv := bytes.SplitN(part, []byte("="), 2); len(kv) == 2 {
+			switch string(kv[0]) {
+			case "t":
+				ts = string(kv[1])
+			case "v1":
+				sig = string(kv[1])
+			}
+		}
+	}
+	if ts == "" || sig == "" {
+		return fmt.Errorf("malformed webhook signature")
+	}
+
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return fmt.Errorf("malformed webhook timestamp: %w", err)
+	}
+	if tolerance > 0 && time.Since(time.Unix(unix, 0)) > tolerance {
+		return fmt.Errorf("webhook signature has expired")
+	}
+
+	expected := SignWebhook(secret, time.Unix(unix, 0), body)
+	if !hmac.Equal([]byte(expected), []byte("t="+ts+",v1="+sig)) {
+		return fmt.Errorf("webhook signature mismatch")
+	}
+	return nil
+}
+
+// emit sends an event to the configured webhooks, if any.
+func (s *Server) emit(event Event) {
+	if s.config().Webhooks != nil {
+		s.config().Webhooks.Dispatch(event)
+	}
+}
+
+// maxPendingExpiries bounds the payment requests whose expiry is tracked at
+// once, so that a flood of unpaid requests cannot grow it without limit.
+const maxPendingExpiries = 100000
+
+// trackExpiry emits payment_expired if no payment for the request is verified
+// before it expires. Requests issued once maxPendingExpiries are tracked, or
+// after Close, are not tracked.
+func (s *Server) trackExpiry(paymentReq *core.PaymentRequest) {
+	if s.config().Webhooks == nil {
+		return
+	}
+	s.pendingMu.Lock()
+	defer s.pendingMu.Unlock()
+	if s.pendingClosed {
+		return
+	}
+	if len(s.pending) >= maxPendingExpiries {
+		s.logger.Warn("x402: too many pending payment requests, expiry not tracked", core.LogKeyPaymentID, paymentReq.PaymentID)
+		return
+	}
+	if s.pending == nil {
+		s.pending = make(map[string]*time.Timer)
+	}
+	s.pending[paymentReq.PaymentID] = time.AfterFunc(time.Until(paymentReq.ExpiresAt), func() {
+		s.pendingMu.Lock()
+		_, tracked := s.pending[paymentReq.PaymentID]
+		delete(s.pending, paymentReq.PaymentID)
+		s.pendingMu.Unlock()
+		// Paid, or the server closed, while the timer fired
+		if !tracked {
+			return
+		}
+		s.emit(Event{
+			Type:           EventPaymentExpired,
+			Resource:       paymentReq.Resource,
+			PaymentRequest: paymentReq,
+		})
+	})
+}
+
+// settleExpiry stops tracking the expiry of a paid request.
+func (s *Server) settleExpiry(paymentID string) {
+	if s.config().Webhooks == nil {
+		return
+	}
+	s.pendingMu.Lock()
+	defer s.pendingMu.Unlock()
+	if timer, ok := s.pending[paymentID]; ok {
+		timer.Stop()
+		delete(s.pending, paymentID)
+	}
+}
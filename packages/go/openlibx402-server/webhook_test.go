@@ -0,0 +1,148 @@
+package serverx402
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/openlibx402/go/openlibx402-core"
+)
+
+// webhookReceiver is a webhook endpoint recording the events it receives,
+// or failing every delivery if status is not 200.
+type webhookReceiver struct {
+	*httptest.Server
+	status   int
+	attempts chan struct{}
+
+	mu     sync.Mutex
+	events []Event
+}
+
+func newWebhookReceiver(t *testing.T, status int) *webhookReceiver {
+	t.Helper()
+	receiver := &webhookReceiver{status: status, attempts: make(chan struct{}, 100)}
+	receiver.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		receiver.attempts <- struct{}{}
+		var event Event
+		if err := json.NewDecoder(r.Body).Decode(&event); err == nil && receiver.status == http.StatusOK {
+			receiver.mu.Lock()
+			receiver.events = append(receiver.events, event)
+			receiver.mu.Unlock()
+		}
+		w.WriteHeader(receiver.status)
+	}))
+	t.Cleanup(receiver.Close)
+	return receiver
+}
+
+// received returns the types of the events received.
+func (r *webhookReceiver) received() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var types []string
+	for _, event := range r.events {
+		types = append(types, event.Type)
+	}
+	return types
+}
+
+func TestWebhookCloseCancelsRetry(t *testing.T) {
+	receiver := newWebhookReceiver(t, http.StatusInternalServerError)
+	failed := make(chan error, 1)
+	webhooks := NewWebhookDispatcher(WebhookOptions{
+		URLs:    []string{receiver.URL},
+		Backoff: time.Hour,
+		OnError: func(url string, event Event, err error) { failed <- err },
+	})
+
+	webhooks.Dispatch(Event{Type: EventPaymentVerified})
+	<-receiver.attempts
+	closed := make(chan struct{})
+	go func() {
+		webhooks.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close waited for the retry backoff")
+	}
+	select {
+	case <-failed:
+	default:
+		t.Error("abandoned delivery not reported to OnError")
+	}
+}
+
+func TestWebhookRetriesFailedDelivery(t *testing.T) {
+	receiver := newWebhookReceiver(t, http.StatusInternalServerError)
+	failed := make(chan error, 1)
+	webhooks := NewWebhookDispatcher(WebhookOptions{
+		URLs:       []string{receiver.URL},
+		MaxRetries: 2,
+		Backoff:    time.Millisecond,
+		OnError:    func(url string, event Event, err error) { failed <- err },
+	})
+	defer webhooks.Close()
+
+	webhooks.Dispatch(Event{Type: EventPaymentVerified})
+	<-failed
+	if n := len(receiver.attempts); n != 3 {
+		t.Errorf("delivery attempted %d times, want 3", n)
+	}
+}
+
+func TestPaymentExpiredEvent(t *testing.T) {
+	receiver := newWebhookReceiver(t, http.StatusOK)
+	webhooks := NewWebhookDispatcher(WebhookOptions{URLs: []string{receiver.URL}})
+	s, _ := newTestServer(t, &Config{AutoVerify: true, Webhooks: webhooks})
+
+	expiring := &core.PaymentRequest{PaymentID: "expiring", ExpiresAt: time.Now().Add(10 * time.Millisecond)}
+	paid := &core.PaymentRequest{PaymentID: "paid", ExpiresAt: time.Now().Add(10 * time.Millisecond)}
+	s.trackExpiry(expiring)
+	s.trackExpiry(paid)
+	s.settleExpiry(paid.PaymentID)
+	time.Sleep(50 * time.Millisecond)
+	webhooks.Close()
+
+	got := receiver.received()
+	if len(got) != 1 || got[0] != EventPaymentExpired {
+		t.Errorf("received %v, want one %s", got, EventPaymentExpired)
+	}
+}
+
+func TestTrackExpiryIsBounded(t *testing.T) {
+	webhooks := NewWebhookDispatcher(WebhookOptions{})
+	defer webhooks.Close()
+	s, _ := newTestServer(t, &Config{Webhooks: webhooks})
+
+	expiresAt := time.Now().Add(time.Hour)
+	for i := 0; i <= maxPendingExpiries; i++ {
+		s.trackExpiry(&core.PaymentRequest{PaymentID: strconv.Itoa(i), ExpiresAt: expiresAt})
+	}
+	s.pendingMu.Lock()
+	n := len(s.pending)
+	s.pendingMu.Unlock()
+	if n != maxPendingExpiries {
+		t.Errorf("tracking %d expiries, want %d", n, maxPendingExpiries)
+	}
+}
+
+func TestTrackExpiryAfterClose(t *testing.T) {
+	webhooks := NewWebhookDispatcher(WebhookOptions{})
+	defer webhooks.Close()
+	s, _ := newTestServer(t, &Config{Webhooks: webhooks})
+
+	s.Close()
+	s.trackExpiry(&core.PaymentRequest{PaymentID: "late", ExpiresAt: time.Now().Add(time.Hour)})
+	s.pendingMu.Lock()
+	defer s.pendingMu.Unlock()
+	if len(s.pending) != 0 {
+		t.Errorf("tracking %d expiries after Close, want 0", len(s.pending))
+	}
+}